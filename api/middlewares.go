@@ -4,49 +4,309 @@ import (
 	"errors"
 	"net/http"
 	"regexp"
+	"slices"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/adfer-dev/analock-api/auth"
+	"github.com/adfer-dev/analock-api/config"
 	"github.com/adfer-dev/analock-api/constants"
 	"github.com/adfer-dev/analock-api/models"
 	"github.com/adfer-dev/analock-api/services"
+	"github.com/adfer-dev/analock-api/storage"
 	"github.com/adfer-dev/analock-api/utils"
 	"github.com/golang-jwt/jwt"
 	"github.com/gorilla/mux"
 )
 
-var tokenService services.TokenService = &services.TokenServiceImpl{}
-var userService services.UserService = &services.UserServiceImpl{}
+var tokenService services.TokenService = services.NewTokenServiceImpl(&storage.TokenStorage{})
+var userService services.UserService = services.NewUserServiceImpl(&storage.UserStorage{})
 var tokenManager auth.TokenManager = auth.GetTokenManager()
-var diaryEntryService services.DiaryEntryService = &services.DefaultDiaryEntryService{}
+var diaryEntryService services.DiaryEntryService = services.NewDefaultDiaryEntryService(
+	&storage.DiaryEntryStorage{},
+	&storage.ActivityRegistrationStorage{},
+	&storage.UserStorage{},
+)
+var bookRegistrationService services.BookActivityRegistrationService = services.NewBookActivityRegistrationServiceImpl(
+	&storage.BookActivityRegistrationStorage{},
+	&storage.ActivityRegistrationStorage{},
+)
+var gameRegistrationService services.GameActivityRegistrationService = services.NewGameActivityRegistrationServiceImpl(
+	&storage.GameActivityRegistrationStorage{},
+	&storage.ActivityRegistrationStorage{},
+)
+
+// Returned by checkAuth when the user is authenticated but its role is not allowed to use the request method on the route.
+var ErrMethodNotAllowed = errors.New(constants.ErrorMethodNotAllowed)
+
+// Returned by checkVerifiedEmail when the user has to verify its email to make the request.
+var ErrEmailNotVerified = errors.New(constants.ErrorEmailNotVerified)
+
+// Endpoints whose writes need a verified email, when it is required in the config.
+var verifiedEmailEndpoints = regexp.MustCompile(
+	`^` + constants.ApiV1UrlRoot +
+		`(` + constants.ApiUrlDiaryEntries +
+		`|` + constants.ApiUrlBookRegistrations +
+		`|` + constants.ApiUrlGameRegistrations +
+		`)(/|$)`)
+
+// Access rule of a set of routes, stating the methods allowed on them and the minimum role needed.
+type routeAccessRule struct {
+	pathPattern *regexp.Regexp
+	methods     []string
+	role        models.UserRole
+}
+
+// Access rules consulted by checkAuth, in order. Routes that match no rule are only accessible to admins.
+var routeAccessRules = []routeAccessRule{
+	{
+		pathPattern: regexp.MustCompile(`^` + constants.ApiV1UrlRoot + `/admin/`),
+		methods:     []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodDelete},
+		role:        models.Admin,
+	},
+	{
+		pathPattern: regexp.MustCompile(`^` + constants.ApiV1UrlRoot + `/users/[^/]+$`),
+		methods:     []string{http.MethodGet},
+		role:        models.Standard,
+	},
+	{
+		pathPattern: regexp.MustCompile(`^` + constants.ApiV1UrlRoot + `/auth/external-login$`),
+		methods:     []string{http.MethodPut},
+		role:        models.Standard,
+	},
+	{
+		pathPattern: regexp.MustCompile(`^` + constants.ApiV1UrlRoot + `/auth/sessions(/[^/]+)?$`),
+		methods:     []string{http.MethodGet, http.MethodDelete},
+		role:        models.Standard,
+	},
+	{
+		pathPattern: regexp.MustCompile(`^` + constants.ApiV1UrlRoot + `/auth/logout$`),
+		methods:     []string{http.MethodPost},
+		role:        models.Standard,
+	},
+	{
+		pathPattern: regexp.MustCompile(`^` + constants.ApiV1UrlRoot + `/auth/token-info$`),
+		methods:     []string{http.MethodGet},
+		role:        models.Standard,
+	},
+	{
+		pathPattern: regexp.MustCompile(`^` + constants.ApiV1UrlRoot + `/auth/link-provider$`),
+		methods:     []string{http.MethodPost},
+		role:        models.Standard,
+	},
+	{
+		pathPattern: regexp.MustCompile(`^` + constants.ApiV1UrlRoot + constants.ApiUrlUserDiaryEntries + `/[^/]+$`),
+		methods:     []string{http.MethodDelete},
+		role:        models.Standard,
+	},
+	{
+		pathPattern: regexp.MustCompile(`^` + constants.ApiV1UrlRoot + constants.ApiUrlDiaryEntries + `(/|$)`),
+		methods:     []string{http.MethodGet, http.MethodPost, http.MethodPut},
+		role:        models.Standard,
+	},
+	{
+		pathPattern: regexp.MustCompile(`^` + constants.ApiV1UrlRoot + `(` + constants.ApiUrlBookRegistrations + `|` + constants.ApiUrlGameRegistrations + `)(/|$)`),
+		methods:     []string{http.MethodGet, http.MethodPost, http.MethodPut},
+		role:        models.Standard,
+	},
+	{
+		pathPattern: regexp.MustCompile(`^` + constants.ApiV1UrlRoot + constants.ApiUrlActivityFeed + `/[^/]+$`),
+		methods:     []string{http.MethodGet},
+		role:        models.Standard,
+	},
+}
+
+// Paths of the pprof profiles, mounted when enabled in the config.
+var pprofEndpoints = regexp.MustCompile(`^` + constants.ApiV1UrlRoot + `/debug/pprof/`)
+
+// Endpoints that do not require an auth token.
+var authExemptEndpoints = regexp.MustCompile(`^(/|` + constants.ApiV1UrlRoot + `/?)$|` + constants.ApiV1UrlRoot + `/(auth/(authenticate|refreshToken)|swagger|internetArchive|time$)/*`)
 
 // AuthMiddleware is a middleware to check if each request is correctly authorized.
 // Returs the next http handler to be processed.
 func AuthMiddleware(next http.Handler) http.Handler {
-	authEndpoints := regexp.MustCompile(constants.ApiV1UrlRoot + `/(auth|swagger|internetArchive)/*`)
-
 	return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
 		//If the endpoint is not allowed, check its auth token.
-		if authEndpoints.MatchString(req.URL.Path) {
+		if authExemptEndpoints.MatchString(req.URL.Path) {
 			next.ServeHTTP(res, req)
 		} else {
-			authErr := checkAuth(req)
+			authErr := checkAuth(res, req)
 
 			//If the token is valid, execute the next function. Otherwise, respond with an error.
 			if authErr == nil {
 				next.ServeHTTP(res, req)
-			} else if authErr.Error() != "method not allowed" {
+			} else if errors.Is(authErr, ErrMethodNotAllowed) {
+				utils.WriteJSON(res, 403,
+					models.HttpError{Status: 403, Description: authErr.Error()})
+			} else {
 				utils.WriteJSON(res, 401,
 					models.HttpError{Status: 401, Description: authErr.Error()})
+			}
+		}
+	})
+}
+
+// ReadOnlyMiddleware rejects write requests when the read-only mode is enabled in the config.
+// Reads, the token refresh endpoint and the import validation endpoint, which writes nothing, are still allowed.
+// Returs the next http handler to be processed.
+func ReadOnlyMiddleware(next http.Handler) http.Handler {
+	readOnly := config.Get().ReadOnly
+	allowedWriteEndpoints := regexp.MustCompile(constants.ApiV1UrlRoot + `(/auth/refreshToken|` + constants.ApiUrlDiaryEntries + `/import/validate)$`)
+
+	return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		isWrite := req.Method == http.MethodPost || req.Method == http.MethodPut ||
+			req.Method == http.MethodPatch || req.Method == http.MethodDelete
+
+		if readOnly && isWrite && !allowedWriteEndpoints.MatchString(req.URL.Path) {
+			res.Header().Set("Retry-After", strconv.Itoa(constants.ReadOnlyModeRetryAfterSeconds))
+			utils.WriteJSON(res, 503,
+				models.HttpError{Status: 503, Description: constants.ErrorReadOnlyMode})
+		} else {
+			next.ServeHTTP(res, req)
+		}
+	})
+}
+
+// VerifiedEmailMiddleware rejects the writes of diary entries and activity registrations by users whose email is not verified,
+// when verified emails are required in the config. Admins are not checked.
+// Returs the next http handler to be processed.
+func VerifiedEmailMiddleware(next http.Handler) http.Handler {
+	requireVerifiedEmail := config.Get().RequireVerifiedEmail
+
+	return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		isWrite := req.Method == http.MethodPost || req.Method == http.MethodPut ||
+			req.Method == http.MethodPatch || req.Method == http.MethodDelete
+
+		if !requireVerifiedEmail || !isWrite || !verifiedEmailEndpoints.MatchString(req.URL.Path) {
+			next.ServeHTTP(res, req)
+			return
+		}
+
+		verifiedErr := checkVerifiedEmail(req)
+
+		if errors.Is(verifiedErr, ErrEmailNotVerified) {
+			utils.WriteJSON(res, 403,
+				models.HttpError{Status: 403, Description: verifiedErr.Error()})
+		} else if verifiedErr != nil {
+			utils.WriteJSON(res, 401,
+				models.HttpError{Status: 401, Description: verifiedErr.Error()})
+		} else {
+			next.ServeHTTP(res, req)
+		}
+	})
+}
+
+// ClientVersionMiddleware rejects requests from client versions older than the minimum one in the config,
+// stated in the X-Client-Version header. Endpoints that do not require an auth token are not checked.
+// Returs the next http handler to be processed.
+func ClientVersionMiddleware(next http.Handler) http.Handler {
+	clientVersionConfig := config.Get().ClientVersion
+
+	return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		if clientVersionConfig.Minimum == nil || authExemptEndpoints.MatchString(req.URL.Path) {
+			next.ServeHTTP(res, req)
+			return
+		}
+
+		versionHeader := req.Header.Get(constants.ClientVersionHeader)
+
+		if len(versionHeader) == 0 {
+			if clientVersionConfig.AllowMissing {
+				next.ServeHTTP(res, req)
 			} else {
-				utils.WriteJSON(res, 403,
-					models.HttpError{Status: 403, Description: authErr.Error()})
+				utils.WriteJSON(res, 400,
+					models.HttpError{Status: 400, Description: constants.ErrorClientVersionMissing})
+			}
+			return
+		}
+
+		clientVersion, parseErr := models.ParseClientVersion(versionHeader)
+
+		if parseErr != nil {
+			utils.WriteJSON(res, 400,
+				models.HttpError{Status: 400, Description: constants.ErrorClientVersionNotValid})
+		} else if clientVersion.Compare(clientVersionConfig.Minimum) < 0 {
+			utils.WriteJSON(res, http.StatusUpgradeRequired, models.UpgradeRequiredError{
+				Status:         http.StatusUpgradeRequired,
+				Description:    constants.ErrorClientVersionTooOld,
+				MinimumVersion: clientVersionConfig.Minimum.String(),
+				UpgradeUrl:     clientVersionConfig.UpgradeUrl,
+			})
+		} else {
+			next.ServeHTTP(res, req)
+		}
+	})
+}
+
+// ServerTimeMiddleware sets the X-Server-Time header to the current server time in Unix seconds,
+// so clients can detect their clock drift from any response.
+// Returs the next http handler to be processed.
+func ServerTimeMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		res.Header().Set(constants.ServerTimeHeader, strconv.FormatInt(time.Now().Unix(), 10))
+		next.ServeHTTP(res, req)
+	})
+}
+
+// Logs the slow requests, replaced by tests to check them.
+var logSlowRequest = utils.GetCustomLogger().Warningf
+
+// SlowRequestMiddleware logs a warning for each request taking longer than the slow request threshold in the config,
+// with its method, path, status and duration, and its request id if it has one.
+// The pprof profiles take as long as they are asked to capture, so they are neither logged nor have their response wrapped.
+// Returs the next http handler to be processed.
+func SlowRequestMiddleware(next http.Handler) http.Handler {
+	threshold := config.Get().Server.SlowRequestThreshold
+
+	return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		if threshold <= 0 || pprofEndpoints.MatchString(req.URL.Path) {
+			next.ServeHTTP(res, req)
+			return
+		}
+
+		recorder := &statusRecorder{ResponseWriter: res, status: http.StatusOK}
+		start := time.Now()
+
+		next.ServeHTTP(recorder, req)
+
+		if duration := time.Since(start); duration > threshold {
+			requestId := req.Header.Get(constants.RequestIdHeader)
+
+			if len(requestId) == 0 {
+				requestId = res.Header().Get(constants.RequestIdHeader)
+			}
+
+			if len(requestId) > 0 {
+				logSlowRequest("Slow request %s: %s %s responded %d in %s\n", requestId, req.Method, req.URL.Path, recorder.status, duration)
+			} else {
+				logSlowRequest("Slow request: %s %s responded %d in %s\n", req.Method, req.URL.Path, recorder.status, duration)
 			}
 		}
 	})
 }
 
+// Response writer that records the status written to it.
+type statusRecorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+}
+
+func (recorder *statusRecorder) WriteHeader(status int) {
+	if !recorder.wroteHeader {
+		recorder.status = status
+		recorder.wroteHeader = true
+	}
+
+	recorder.ResponseWriter.WriteHeader(status)
+}
+
+// Lets http.ResponseController reach the wrapped writer, so handlers can still set write deadlines.
+func (recorder *statusRecorder) Unwrap() http.ResponseWriter {
+	return recorder.ResponseWriter
+}
+
 // ValidatePathParams checks if the id parameter of an endpoint is a valid number.
 // Returs the next http handler to be processed.
 func ValidatePathParams(next http.Handler) http.Handler {
@@ -76,7 +336,12 @@ func UserOwnershipMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		ownershipErr := checkUserOwnershipMiddleware(r)
 
-		if ownershipErr != nil {
+		var notFoundErr *models.DbNotFoundError
+
+		if errors.As(ownershipErr, &notFoundErr) {
+			httpErr := utils.TranslateDbErrorToHttpError(ownershipErr)
+			utils.WriteJSON(w, httpErr.Status, httpErr)
+		} else if ownershipErr != nil {
 			utils.WriteJSON(w, 403,
 				models.HttpError{Status: 403, Description: ownershipErr.Error()})
 		} else {
@@ -93,6 +358,7 @@ func checkUserOwnershipMiddleware(req *http.Request) error {
 			`(` + constants.ApiUrlDiaryEntries +
 			`|` + constants.ApiUrlBookRegistrations +
 			`|` + constants.ApiUrlGameRegistrations +
+			`|` + constants.ApiUrlActivityFeed +
 			`)/*`)
 
 	if endpointsToCheck.MatchString(req.URL.Path) {
@@ -104,17 +370,21 @@ func checkUserOwnershipMiddleware(req *http.Request) error {
 			return claimsErr
 		}
 
-		userId := tokenClaims["sub"].(float64)
-		if req.Method == http.MethodGet {
-			if strings.Contains(req.URL.Path, "user") {
-				return checkUserOwnership(uint(itemId), uint(userId))
-			} else {
-				return checkUserOwnershipFromDiaryEntryId(uint(itemId), uint(userId))
-			}
+		userId, userIdErr := utils.UserIDFromClaims(tokenClaims)
+
+		if userIdErr != nil {
+			return userIdErr
+		}
 
-		} else if req.Method == http.MethodPut {
+		if (req.Method == http.MethodGet || req.Method == http.MethodDelete) && strings.Contains(req.URL.Path, "user") {
+			return checkUserOwnership(uint(itemId), userId)
+		} else if req.Method == http.MethodGet || req.Method == http.MethodPut {
 			if strings.Contains(req.URL.Path, constants.ApiUrlDiaryEntries) {
-				return checkUserOwnershipFromDiaryEntryId(uint(itemId), uint(userId))
+				return checkUserOwnershipFromDiaryEntryId(uint(itemId), userId)
+			} else if strings.Contains(req.URL.Path, constants.ApiUrlBookRegistrations) {
+				return checkUserOwnershipFromBookRegistrationId(uint(itemId), userId)
+			} else if strings.Contains(req.URL.Path, constants.ApiUrlGameRegistrations) {
+				return checkUserOwnershipFromGameRegistrationId(uint(itemId), userId)
 			}
 		}
 	}
@@ -124,15 +394,45 @@ func checkUserOwnershipMiddleware(req *http.Request) error {
 
 // AUX FUNCTIONS
 
+// checkVerifiedEmail checks whether the user the request token belongs to has a verified email or is an admin.
+// Returns ErrEmailNotVerified if not.
+func checkVerifiedEmail(req *http.Request) error {
+	tokenClaims, claimsErr := tokenManager.GetClaims(strings.TrimPrefix(req.Header.Get("Authorization"), "Bearer "))
+
+	if claimsErr != nil {
+		return claimsErr
+	}
+
+	userId, userIdErr := utils.UserIDFromClaims(tokenClaims)
+
+	if userIdErr != nil {
+		return userIdErr
+	}
+
+	user, getUserErr := userService.GetUserById(userId)
+
+	if getUserErr != nil {
+		return getUserErr
+	}
+
+	if user.Role != models.Admin && !user.EmailVerified {
+		return ErrEmailNotVerified
+	}
+
+	return nil
+}
+
 // checkAuth checks if a request is correctly authorized.
 // To a request to be correctly authorized it is needed to provide
 // an Authorization header with a valid and unexpired access token.
 // Returns error if one of the following happens:
 //   - The Authorization header is not provided
 //   - The token is expired
-//   - The token is not a valid JWT
-//   - The request method is not authorized
-func checkAuth(req *http.Request) error {
+//   - The token is not a valid JWT or has been revoked, unless it is a GET request within the grace period of a logged out token
+//   - The request method is not authorized for the user role on the route, returning ErrMethodNotAllowed
+//
+// The last use of an authorized token is stored, at most once per minute.
+func checkAuth(res http.ResponseWriter, req *http.Request) error {
 	fullToken := req.Header.Get("Authorization")
 
 	if fullToken == "" || !strings.HasPrefix(fullToken, "Bearer") {
@@ -141,19 +441,117 @@ func checkAuth(req *http.Request) error {
 
 	tokenString := fullToken[7:]
 
+	// The token is looked up before knowing whether it is valid,
+	// so every rejected token takes a comparable time to be checked.
+	dbToken, tokenNotFoundErr := tokenService.GetTokenByValue(tokenString)
+	tokenRevoked := tokenNotFoundErr != nil || dbToken == nil || !utils.SecureCompare(dbToken.TokenValue, tokenString)
+
 	//Validate token
 	if err := tokenManager.ValidateToken(tokenString); err != nil {
 		validationErr, ok := err.(*jwt.ValidationError)
 		if ok && validationErr.Errors == jwt.ValidationErrorExpired {
 			return errors.New("token expired. Please, get a new one at /auth/refresh-token")
 		} else {
-			return errors.New("token not valid")
+			return errors.New(constants.ErrorTokenNotValid)
+		}
+	}
+
+	// Requests sent concurrently with the one renewing the token may still use it within the renewal overlap,
+	// and requests in flight when a token is deleted may still read within its grace period
+	inRenewalOverlap := tokenRevoked && tokenService.IsTokenInRenewalOverlap(tokenString)
+	inGracePeriod := tokenRevoked && !inRenewalOverlap && req.Method == http.MethodGet && tokenService.IsTokenInGracePeriod(tokenString)
+
+	// Revoked tokens get the same error as invalid ones, so token existence cannot be enumerated
+	if tokenRevoked && !inRenewalOverlap && !inGracePeriod {
+		utils.GetCustomLogger().Infof("Revoked token used: %s\n", utils.MaskSecret(tokenString))
+		return errors.New(constants.ErrorTokenNotValid)
+	}
+
+	// Refresh tokens are long-lived, so they must not be accepted as access tokens
+	claims, claimsErr := tokenManager.GetClaims(tokenString)
+
+	if claimsErr != nil || auth.GetTokenKind(claims) != models.Access {
+		return errors.New(constants.ErrorTokenNotValid)
+	}
+
+	if routeAccessErr := checkRouteAccess(req, claims); routeAccessErr != nil {
+		return routeAccessErr
+	}
+
+	// A replaced or deleted token is no longer stored, so its use is not recorded and it is not renewed
+	if inRenewalOverlap || inGracePeriod {
+		return nil
+	}
+
+	tokenUsage.record(dbToken.Id)
+
+	if renewalWindow := config.Get().AccessTokenRenewalWindow; renewalWindow > 0 {
+		renewAccessToken(res, dbToken, claims, renewalWindow)
+	}
+
+	return nil
+}
+
+// Replaces the given access token with a new one if it expires within the given window,
+// sending the new one in the X-New-Access-Token header so the client can adopt it.
+// The old token is only accepted for a short overlap after its row is updated with the new one,
+// and only the first of the concurrent requests using it renews it.
+// Impersonation tokens are never renewed. Renewal failures are only logged, since the request is still authorized.
+func renewAccessToken(res http.ResponseWriter, dbToken *models.Token, claims jwt.MapClaims, renewalWindow time.Duration) {
+	expiration, hasExpiration := auth.GetTokenExpiration(claims)
+
+	if dbToken.Kind != models.Access || !hasExpiration || time.Until(expiration) > renewalWindow {
+		return
+	}
+
+	newTokenString, generateErr := tokenManager.GenerateToken(models.User{Id: dbToken.UserRefer}, models.Access)
+
+	if generateErr != nil {
+		utils.GetCustomLogger().Errorf("Error generating the renewed access token of user %d: %s\n", dbToken.UserRefer, generateErr.Error())
+		return
+	}
+
+	renewed, renewErr := tokenService.RenewToken(dbToken, newTokenString)
+
+	if renewErr != nil {
+		utils.GetCustomLogger().Errorf("Error saving the renewed access token of user %d: %s\n", dbToken.UserRefer, renewErr.Error())
+		return
+	}
+
+	if !renewed {
+		return
+	}
+
+	res.Header().Set(constants.NewAccessTokenHeader, newTokenString)
+}
+
+// checkRouteAccess checks if the user in the token claims has the role required by the route access rules.
+// The user is only looked up when the route requires the admin role.
+// Returns ErrMethodNotAllowed if the user is not an admin or could not be looked up.
+func checkRouteAccess(req *http.Request, claims jwt.MapClaims) error {
+	requiredRole := models.Admin
+
+	for _, rule := range routeAccessRules {
+		if rule.pathPattern.MatchString(req.URL.Path) && slices.Contains(rule.methods, req.Method) {
+			requiredRole = rule.role
+			break
 		}
 	}
 
-	//Then check if token is in the database
-	if _, tokenNotFoundErr := tokenService.GetTokenByValue(tokenString); tokenNotFoundErr != nil {
-		return errors.New("token revoked")
+	if requiredRole != models.Admin {
+		return nil
+	}
+
+	userId, userIdErr := utils.UserIDFromClaims(claims)
+
+	if userIdErr != nil {
+		return errors.New(constants.ErrorTokenNotValid)
+	}
+
+	user, getUserErr := userService.GetUserById(userId)
+
+	if getUserErr != nil || user.Role != models.Admin {
+		return ErrMethodNotAllowed
 	}
 
 	return nil
@@ -177,3 +575,25 @@ func checkUserOwnershipFromDiaryEntryId(itemId uint, userId uint) error {
 
 	return checkUserOwnership(diaryEntry.Registration.UserRefer, userId)
 }
+
+// Checks if user has ownership of a book activity registration, knowing the registration id
+func checkUserOwnershipFromBookRegistrationId(itemId uint, userId uint) error {
+	bookRegistration, getRegistrationError := bookRegistrationService.GetBookActivityRegistrationById(itemId)
+
+	if getRegistrationError != nil {
+		return getRegistrationError
+	}
+
+	return checkUserOwnership(bookRegistration.Registration.UserRefer, userId)
+}
+
+// Checks if user has ownership of a game activity registration, knowing the registration id
+func checkUserOwnershipFromGameRegistrationId(itemId uint, userId uint) error {
+	gameRegistration, getRegistrationError := gameRegistrationService.GetGameActivityRegistrationById(itemId)
+
+	if getRegistrationError != nil {
+		return getRegistrationError
+	}
+
+	return checkUserOwnership(gameRegistration.Registration.UserRefer, userId)
+}
@@ -1,23 +1,34 @@
 package api
 
 import (
+	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/adfer-dev/analock-api/auth"
 	"github.com/adfer-dev/analock-api/constants"
 	"github.com/adfer-dev/analock-api/models"
 	"github.com/adfer-dev/analock-api/services"
+	"github.com/adfer-dev/analock-api/storage"
+	"github.com/adfer-dev/analock-api/utils"
 	"github.com/golang-jwt/jwt"
 	"github.com/gorilla/mux"
 )
 
 // --- Mock Implementations ---
 type mockTokenManager struct {
-	ValidateTokenFunc func(token string) error
-	GetClaimsFunc     func(token string) (jwt.MapClaims, error)
-	GenerateTokenFunc func(user models.User, tokenKind models.TokenKind) (string, error)
+	ValidateTokenFunc              func(token string) error
+	GetClaimsFunc                  func(token string) (jwt.MapClaims, error)
+	GenerateTokenFunc              func(user models.User, tokenKind models.TokenKind) (string, error)
+	GenerateImpersonationTokenFunc func(user models.User, adminId uint, ttl time.Duration) (string, error)
 }
 
 func (m *mockTokenManager) ValidateToken(token string) error {
@@ -41,14 +52,27 @@ func (m *mockTokenManager) GenerateToken(user models.User, tokenKind models.Toke
 	return "", nil
 }
 
+func (m *mockTokenManager) GenerateImpersonationToken(user models.User, adminId uint, ttl time.Duration) (string, error) {
+	if m.GenerateImpersonationTokenFunc != nil {
+		return m.GenerateImpersonationTokenFunc(user, adminId, ttl)
+	}
+	return "", nil
+}
+
 type mockTokenService struct {
-	GetTokenByIdFunc       func(id uint) (*models.Token, error)
-	GetTokenByValueFunc    func(token string) (*models.Token, error)
-	GetUserTokenByKindFunc func(userId uint, kind models.TokenKind) (*models.Token, error)
-	GetUserTokenPairFunc   func(userId uint) ([2]*models.Token, error)
-	SaveTokenFunc          func(tokenBody *models.Token) (*models.Token, error)
-	UpdateTokenFunc        func(tokenBody *models.Token) (*models.Token, error)
-	DeleteTokenFunc        func(id uint) error
+	GetTokenByIdFunc            func(id uint) (*models.Token, error)
+	GetTokenByValueFunc         func(token string) (*models.Token, error)
+	GetUserTokenByKindFunc      func(userId uint, kind models.TokenKind) (*models.Token, error)
+	GetUserTokenPairFunc        func(userId uint) ([2]*models.Token, error)
+	SaveTokenFunc               func(tokenBody *models.Token) (*models.Token, error)
+	UpdateTokenFunc             func(tokenBody *models.Token) (*models.Token, error)
+	UpdateTokenPairFunc         func(tokenPair [2]*models.Token) ([2]*models.Token, error)
+	UpdateTokenLastUsedAtFunc   func(id uint, lastUsedAt int64) error
+	DeleteTokenFunc             func(id uint) error
+	DeleteTokenWithGraceFunc    func(id uint) error
+	IsTokenInGracePeriodFunc    func(tokenValue string) bool
+	RenewTokenFunc              func(token *models.Token, newTokenValue string) (bool, error)
+	IsTokenInRenewalOverlapFunc func(tokenValue string) bool
 }
 
 func (m *mockTokenService) GetTokenById(id uint) (*models.Token, error) {
@@ -93,6 +117,20 @@ func (m *mockTokenService) UpdateToken(tokenBody *models.Token) (*models.Token,
 	return nil, nil
 }
 
+func (m *mockTokenService) UpdateTokenPair(tokenPair [2]*models.Token) ([2]*models.Token, error) {
+	if m.UpdateTokenPairFunc != nil {
+		return m.UpdateTokenPairFunc(tokenPair)
+	}
+	return tokenPair, nil
+}
+
+func (m *mockTokenService) UpdateTokenLastUsedAt(id uint, lastUsedAt int64) error {
+	if m.UpdateTokenLastUsedAtFunc != nil {
+		return m.UpdateTokenLastUsedAtFunc(id, lastUsedAt)
+	}
+	return nil
+}
+
 func (m *mockTokenService) DeleteToken(id uint) error {
 	if m.DeleteTokenFunc != nil {
 		return m.DeleteTokenFunc(id)
@@ -100,12 +138,45 @@ func (m *mockTokenService) DeleteToken(id uint) error {
 	return nil
 }
 
+func (m *mockTokenService) DeleteTokenWithGracePeriod(id uint) error {
+	if m.DeleteTokenWithGraceFunc != nil {
+		return m.DeleteTokenWithGraceFunc(id)
+	}
+	return nil
+}
+
+func (m *mockTokenService) IsTokenInGracePeriod(tokenValue string) bool {
+	if m.IsTokenInGracePeriodFunc != nil {
+		return m.IsTokenInGracePeriodFunc(tokenValue)
+	}
+	return false
+}
+
+func (m *mockTokenService) RenewToken(token *models.Token, newTokenValue string) (bool, error) {
+	if m.RenewTokenFunc != nil {
+		return m.RenewTokenFunc(token, newTokenValue)
+	}
+	return true, nil
+}
+
+func (m *mockTokenService) IsTokenInRenewalOverlap(tokenValue string) bool {
+	if m.IsTokenInRenewalOverlapFunc != nil {
+		return m.IsTokenInRenewalOverlapFunc(tokenValue)
+	}
+	return false
+}
+
 type mockUserService struct {
 	GetUserByIdFunc    func(id uint) (*models.User, error)
 	GetUserByEmailFunc func(email string) (*models.User, error)
 	DeleteUserFunc     func(id uint) error
 	SaveUserFunc       func(userBody services.UserBody) (*models.User, error)
 	UpdateUserFunc     func(userBody services.UserBody) (*models.User, error)
+	ListUsersFunc      func(query services.UserListQuery) (*services.UserPage, error)
+}
+
+func (m *mockUserService) MarkEmailVerified(id uint) error {
+	return nil
 }
 
 func (m *mockUserService) GetUserById(id uint) (*models.User, error) {
@@ -143,13 +214,28 @@ func (m *mockUserService) UpdateUser(userBody services.UserBody) (*models.User,
 	return nil, nil
 }
 
+func (m *mockUserService) ListUsers(query services.UserListQuery) (*services.UserPage, error) {
+	if m.ListUsersFunc != nil {
+		return m.ListUsersFunc(query)
+	}
+	return nil, nil
+}
+
 type mockDiaryEntryService struct {
-	GetDiaryEntryByIdFunc       func(id uint) (*models.DiaryEntry, error)
-	GetUserEntriesFunc          func(userId uint) ([]*models.DiaryEntry, error)
-	GetUserEntriesTimeRangeFunc func(userId uint, startDate int64, endDate int64) ([]*models.DiaryEntry, error)
-	SaveDiaryEntryFunc          func(diaryEntryBody *services.SaveDiaryEntryBody, userId uint) (*models.DiaryEntry, error)
-	UpdateDiaryEntryFunc        func(diaryEntryId uint, diaryEntryBody *services.UpdateDiaryEntryBody) (*models.DiaryEntry, error)
-	DeleteDiaryEntryFunc        func(id uint) error
+	GetDiaryEntryByIdFunc              func(id uint) (*models.DiaryEntry, error)
+	GetUserEntriesFunc                 func(userId uint) ([]*models.DiaryEntry, error)
+	StreamUserEntriesFunc              func(userId uint, yield func(diaryEntry *models.DiaryEntry) error) error
+	GetUserEntriesTimeRangeFunc        func(userId uint, startDate int64, endDate int64) ([]*models.DiaryEntry, error)
+	GetUserEntrySummariesFunc          func(userId uint) ([]*models.DiaryEntrySummary, error)
+	GetUserEntrySummariesTimeRangeFunc func(userId uint, startDate int64, endDate int64) ([]*models.DiaryEntrySummary, error)
+	GetUserEntrySummariesByDayFunc     func(userId uint, startDate int64, endDate int64, location *time.Location) (map[string][]*models.DiaryEntrySummary, error)
+	GetUserEntriesOnThisDayFunc        func(userId uint, now time.Time) (map[string][]*models.DiaryEntry, error)
+	SaveDiaryEntryFunc                 func(diaryEntryBody *services.SaveDiaryEntryBody, userId uint, location *time.Location) (*models.DiaryEntry, error)
+	ImportDiaryEntriesFunc             func(diaryEntryBodies []*services.SaveDiaryEntryBody, userId uint, location *time.Location) (*services.ImportDiaryEntriesResponse, error)
+	ValidateDiaryEntriesFunc           func(diaryEntryBodies []*services.SaveDiaryEntryBody) ([]*services.DiaryEntryValidation, error)
+	UpdateDiaryEntryFunc               func(diaryEntryId uint, diaryEntryBody *services.UpdateDiaryEntryBody, location *time.Location) (*models.DiaryEntry, error)
+	DeleteDiaryEntryFunc               func(id uint) error
+	DeleteUserEntriesTimeRangeFunc     func(userId uint, startDate int64, endDate int64) (int, error)
 }
 
 func (m *mockDiaryEntryService) GetDiaryEntryById(id uint) (*models.DiaryEntry, error) {
@@ -166,6 +252,13 @@ func (m *mockDiaryEntryService) GetUserEntries(userId uint) ([]*models.DiaryEntr
 	return nil, nil
 }
 
+func (m *mockDiaryEntryService) StreamUserEntries(userId uint, yield func(diaryEntry *models.DiaryEntry) error) error {
+	if m.StreamUserEntriesFunc != nil {
+		return m.StreamUserEntriesFunc(userId, yield)
+	}
+	return nil
+}
+
 func (m *mockDiaryEntryService) GetUserEntriesTimeRange(userId uint, startDate int64, endDate int64) ([]*models.DiaryEntry, error) {
 	if m.GetUserEntriesTimeRangeFunc != nil {
 		return m.GetUserEntriesTimeRangeFunc(userId, startDate, endDate)
@@ -173,16 +266,58 @@ func (m *mockDiaryEntryService) GetUserEntriesTimeRange(userId uint, startDate i
 	return nil, nil
 }
 
-func (m *mockDiaryEntryService) SaveDiaryEntry(diaryEntryBody *services.SaveDiaryEntryBody, userId uint) (*models.DiaryEntry, error) {
+func (m *mockDiaryEntryService) GetUserEntrySummaries(userId uint) ([]*models.DiaryEntrySummary, error) {
+	if m.GetUserEntrySummariesFunc != nil {
+		return m.GetUserEntrySummariesFunc(userId)
+	}
+	return nil, nil
+}
+
+func (m *mockDiaryEntryService) GetUserEntrySummariesTimeRange(userId uint, startDate int64, endDate int64) ([]*models.DiaryEntrySummary, error) {
+	if m.GetUserEntrySummariesTimeRangeFunc != nil {
+		return m.GetUserEntrySummariesTimeRangeFunc(userId, startDate, endDate)
+	}
+	return nil, nil
+}
+
+func (m *mockDiaryEntryService) GetUserEntrySummariesByDay(userId uint, startDate int64, endDate int64, location *time.Location) (map[string][]*models.DiaryEntrySummary, error) {
+	if m.GetUserEntrySummariesByDayFunc != nil {
+		return m.GetUserEntrySummariesByDayFunc(userId, startDate, endDate, location)
+	}
+	return nil, nil
+}
+
+func (m *mockDiaryEntryService) GetUserEntriesOnThisDay(userId uint, now time.Time) (map[string][]*models.DiaryEntry, error) {
+	if m.GetUserEntriesOnThisDayFunc != nil {
+		return m.GetUserEntriesOnThisDayFunc(userId, now)
+	}
+	return nil, nil
+}
+
+func (m *mockDiaryEntryService) SaveDiaryEntry(diaryEntryBody *services.SaveDiaryEntryBody, userId uint, location *time.Location) (*models.DiaryEntry, error) {
 	if m.SaveDiaryEntryFunc != nil {
-		return m.SaveDiaryEntryFunc(diaryEntryBody, userId)
+		return m.SaveDiaryEntryFunc(diaryEntryBody, userId, location)
+	}
+	return nil, nil
+}
+
+func (m *mockDiaryEntryService) ImportDiaryEntries(diaryEntryBodies []*services.SaveDiaryEntryBody, userId uint, location *time.Location) (*services.ImportDiaryEntriesResponse, error) {
+	if m.ImportDiaryEntriesFunc != nil {
+		return m.ImportDiaryEntriesFunc(diaryEntryBodies, userId, location)
+	}
+	return nil, nil
+}
+
+func (m *mockDiaryEntryService) ValidateDiaryEntries(diaryEntryBodies []*services.SaveDiaryEntryBody) ([]*services.DiaryEntryValidation, error) {
+	if m.ValidateDiaryEntriesFunc != nil {
+		return m.ValidateDiaryEntriesFunc(diaryEntryBodies)
 	}
 	return nil, nil
 }
 
-func (m *mockDiaryEntryService) UpdateDiaryEntry(diaryEntryId uint, diaryEntryBody *services.UpdateDiaryEntryBody) (*models.DiaryEntry, error) {
+func (m *mockDiaryEntryService) UpdateDiaryEntry(diaryEntryId uint, diaryEntryBody *services.UpdateDiaryEntryBody, location *time.Location) (*models.DiaryEntry, error) {
 	if m.UpdateDiaryEntryFunc != nil {
-		return m.UpdateDiaryEntryFunc(diaryEntryId, diaryEntryBody)
+		return m.UpdateDiaryEntryFunc(diaryEntryId, diaryEntryBody, location)
 	}
 	return nil, nil
 }
@@ -194,6 +329,67 @@ func (m *mockDiaryEntryService) DeleteDiaryEntry(id uint) error {
 	return nil
 }
 
+func (m *mockDiaryEntryService) DeleteUserEntriesTimeRange(userId uint, startDate int64, endDate int64) (int, error) {
+	if m.DeleteUserEntriesTimeRangeFunc != nil {
+		return m.DeleteUserEntriesTimeRangeFunc(userId, startDate, endDate)
+	}
+	return 0, nil
+}
+
+type mockBookRegistrationService struct {
+	GetBookActivityRegistrationByIdFunc func(id uint) (*models.BookActivityRegistration, error)
+}
+
+func (m *mockBookRegistrationService) GetUserBookActivityRegistrations(userId uint) ([]*models.BookActivityRegistration, error) {
+	return nil, nil
+}
+
+func (m *mockBookRegistrationService) GetUserBookActivityRegistrationsTimeRange(userId uint, startTime int64, endTime int64) ([]*models.BookActivityRegistration, error) {
+	return nil, nil
+}
+
+func (m *mockBookRegistrationService) GetBookActivityRegistrationById(id uint) (*models.BookActivityRegistration, error) {
+	if m.GetBookActivityRegistrationByIdFunc != nil {
+		return m.GetBookActivityRegistrationByIdFunc(id)
+	}
+	return nil, nil
+}
+
+func (m *mockBookRegistrationService) CreateBookActivityRegistration(addRegistrationBody *services.AddBookActivityRegistrationBody, userId uint, location *time.Location) (*models.BookActivityRegistration, error) {
+	return nil, nil
+}
+
+func (m *mockBookRegistrationService) UpdateBookActivityRegistration(id uint, updateRegistrationBody *services.UpdateBookActivityRegistrationBody) (*models.BookActivityRegistration, error) {
+	return nil, nil
+}
+
+type mockGameRegistrationService struct {
+	GetGameActivityRegistrationByIdFunc func(id uint) (*models.GameActivityRegistration, error)
+}
+
+func (m *mockGameRegistrationService) GetUserGameActivityRegistrations(userId uint) ([]*models.GameActivityRegistration, error) {
+	return nil, nil
+}
+
+func (m *mockGameRegistrationService) GetUserGameActivityRegistrationsTimeRange(userId uint, startDate int64, endDate int64) ([]*models.GameActivityRegistration, error) {
+	return nil, nil
+}
+
+func (m *mockGameRegistrationService) GetGameActivityRegistrationById(id uint) (*models.GameActivityRegistration, error) {
+	if m.GetGameActivityRegistrationByIdFunc != nil {
+		return m.GetGameActivityRegistrationByIdFunc(id)
+	}
+	return nil, nil
+}
+
+func (m *mockGameRegistrationService) CreateGameActivityRegistration(addRegistrationBody *services.AddGameActivityRegistrationBody, userId uint, location *time.Location) (*models.GameActivityRegistration, error) {
+	return nil, nil
+}
+
+func (m *mockGameRegistrationService) UpdateGameActivityRegistration(id uint, updateRegistrationBody *services.UpdateGameActivityRegistrationBody) (*models.GameActivityRegistration, error) {
+	return nil, nil
+}
+
 // Test checkAuth function
 func TestCheckAuth(t *testing.T) {
 	// Temporarily replace global variables with mock implementations
@@ -235,18 +431,46 @@ func TestCheckAuth(t *testing.T) {
 			mockValidateTokenErr:   nil,
 			mockGetTokenByValue:    nil,
 			mockGetTokenByValueErr: errors.New("token not found"),
-			expectedErr:            errors.New("token revoked"),
+			expectedErr:            errors.New("token not valid"),
+		},
+		{
+			name:                   "Stored token value does not match",
+			authHeader:             "Bearer valid.token",
+			mockValidateTokenErr:   nil,
+			mockGetTokenByValue:    &models.Token{TokenValue: "other.token"},
+			mockGetTokenByValueErr: nil,
+			expectedErr:            errors.New("token not valid"),
+		},
+		{
+			name:                   "Refresh token used as access token",
+			authHeader:             "Bearer refresh.token",
+			mockValidateTokenErr:   nil,
+			mockGetTokenByValue:    &models.Token{TokenValue: "refresh.token"},
+			mockGetTokenByValueErr: nil,
+			mockGetClaims:          jwt.MapClaims{"sub": float64(1), auth.KindClaim: float64(models.Refresh)},
+			mockGetClaimsErr:       nil,
+			expectedErr:            errors.New("token not valid"),
+		},
+		{
+			name:                   "Token without kind claim",
+			authHeader:             "Bearer legacy.token",
+			mockValidateTokenErr:   nil,
+			mockGetTokenByValue:    &models.Token{TokenValue: "legacy.token"},
+			mockGetTokenByValueErr: nil,
+			mockGetClaims:          jwt.MapClaims{"sub": float64(1)},
+			mockGetClaimsErr:       nil,
+			expectedErr:            errors.New("token not valid"),
 		},
 		{
 			name:                   "Valid token, admin user, non-user-accessible POST",
 			authHeader:             "Bearer admin.token",
 			mockValidateTokenErr:   nil,
-			mockGetTokenByValue:    &models.Token{},
+			mockGetTokenByValue:    &models.Token{TokenValue: "admin.token"},
 			mockGetTokenByValueErr: nil,
-			mockGetClaims:          jwt.MapClaims{"sub": float64(1)},
+			mockGetClaims:          jwt.MapClaims{"sub": float64(1), auth.KindClaim: float64(models.Access)},
 			mockGetClaimsErr:       nil,
-			mockGetUserByEmail:     &models.User{Role: models.Admin},
-			mockGetUserByEmailErr:  nil,
+			mockGetUser:            &models.User{Role: models.Admin},
+			mockGetUserErr:         nil,
 			reqMethod:              http.MethodPost,
 			reqURLPath:             "/api/v1/users",
 			expectedErr:            nil,
@@ -255,26 +479,208 @@ func TestCheckAuth(t *testing.T) {
 			name:                   "Valid token, non-admin user, non-user-accessible POST",
 			authHeader:             "Bearer user.token",
 			mockValidateTokenErr:   nil,
-			mockGetTokenByValue:    &models.Token{},
+			mockGetTokenByValue:    &models.Token{TokenValue: "user.token"},
 			mockGetTokenByValueErr: nil,
-			mockGetClaims:          jwt.MapClaims{"sub": float64(1)},
+			mockGetClaims:          jwt.MapClaims{"sub": float64(1), auth.KindClaim: float64(models.Access)},
+			mockGetClaimsErr:       nil,
+			mockGetUser:            &models.User{Role: models.Standard},
+			mockGetUserErr:         nil,
+			reqMethod:              http.MethodPost,
+			reqURLPath:             "/api/v1/users",
+			expectedErr:            ErrMethodNotAllowed,
+		},
+		{
+			name:                   "Valid token, user lookup fails, non-user-accessible POST",
+			authHeader:             "Bearer user.token",
+			mockValidateTokenErr:   nil,
+			mockGetTokenByValue:    &models.Token{TokenValue: "user.token"},
+			mockGetTokenByValueErr: nil,
+			mockGetClaims:          jwt.MapClaims{"sub": float64(1), auth.KindClaim: float64(models.Access)},
 			mockGetClaimsErr:       nil,
-			mockGetUserByEmail:     &models.User{Role: models.Standard},
-			mockGetUserByEmailErr:  nil,
+			mockGetUser:            nil,
+			mockGetUserErr:         errors.New("user not found"),
 			reqMethod:              http.MethodPost,
 			reqURLPath:             "/api/v1/users",
+			expectedErr:            ErrMethodNotAllowed,
+		},
+		{
+			name:                   "Valid token, admin user, admin DELETE",
+			authHeader:             "Bearer admin.token",
+			mockValidateTokenErr:   nil,
+			mockGetTokenByValue:    &models.Token{TokenValue: "admin.token"},
+			mockGetTokenByValueErr: nil,
+			mockGetClaims:          jwt.MapClaims{"sub": float64(1), auth.KindClaim: float64(models.Access)},
+			mockGetClaimsErr:       nil,
+			mockGetUser:            &models.User{Role: models.Admin},
+			mockGetUserErr:         nil,
+			reqMethod:              http.MethodDelete,
+			reqURLPath:             "/api/v1/admin/activityRegistrations/orphans",
+			expectedErr:            nil,
+		},
+		{
+			name:                   "Valid token, non-admin user, admin DELETE",
+			authHeader:             "Bearer user.token",
+			mockValidateTokenErr:   nil,
+			mockGetTokenByValue:    &models.Token{TokenValue: "user.token"},
+			mockGetTokenByValueErr: nil,
+			mockGetClaims:          jwt.MapClaims{"sub": float64(1), auth.KindClaim: float64(models.Access)},
+			mockGetClaimsErr:       nil,
+			mockGetUser:            &models.User{Role: models.Standard},
+			mockGetUserErr:         nil,
+			reqMethod:              http.MethodDelete,
+			reqURLPath:             "/api/v1/admin/activityRegistrations/orphans",
+			expectedErr:            ErrMethodNotAllowed,
+		},
+		{
+			name:                   "Valid token, admin user, impersonate user",
+			authHeader:             "Bearer admin.token",
+			mockValidateTokenErr:   nil,
+			mockGetTokenByValue:    &models.Token{TokenValue: "admin.token"},
+			mockGetTokenByValueErr: nil,
+			mockGetClaims:          jwt.MapClaims{"sub": float64(1), auth.KindClaim: float64(models.Access)},
+			mockGetClaimsErr:       nil,
+			mockGetUser:            &models.User{Role: models.Admin},
+			mockGetUserErr:         nil,
+			reqMethod:              http.MethodPost,
+			reqURLPath:             "/api/v1/admin/users/5/impersonate",
+			expectedErr:            nil,
+		},
+		{
+			name:                   "Valid token, non-admin user, impersonate user",
+			authHeader:             "Bearer user.token",
+			mockValidateTokenErr:   nil,
+			mockGetTokenByValue:    &models.Token{TokenValue: "user.token"},
+			mockGetTokenByValueErr: nil,
+			mockGetClaims:          jwt.MapClaims{"sub": float64(1), auth.KindClaim: float64(models.Access)},
+			mockGetClaimsErr:       nil,
+			mockGetUser:            &models.User{Role: models.Standard},
+			mockGetUserErr:         nil,
+			reqMethod:              http.MethodPost,
+			reqURLPath:             "/api/v1/admin/users/5/impersonate",
+			expectedErr:            ErrMethodNotAllowed,
+		},
+		{
+			name:                   "Valid token, admin user, admin user list",
+			authHeader:             "Bearer admin.token",
+			mockValidateTokenErr:   nil,
+			mockGetTokenByValue:    &models.Token{TokenValue: "admin.token"},
+			mockGetTokenByValueErr: nil,
+			mockGetClaims:          jwt.MapClaims{"sub": float64(1), auth.KindClaim: float64(models.Access)},
+			mockGetClaimsErr:       nil,
+			mockGetUser:            &models.User{Role: models.Admin},
+			mockGetUserErr:         nil,
+			reqMethod:              http.MethodGet,
+			reqURLPath:             "/api/v1/admin/users",
+			expectedErr:            nil,
+		},
+		{
+			name:                   "Valid token, non-admin user, admin user list",
+			authHeader:             "Bearer user.token",
+			mockValidateTokenErr:   nil,
+			mockGetTokenByValue:    &models.Token{TokenValue: "user.token"},
+			mockGetTokenByValueErr: nil,
+			mockGetClaims:          jwt.MapClaims{"sub": float64(1), auth.KindClaim: float64(models.Access)},
+			mockGetClaimsErr:       nil,
+			mockGetUser:            &models.User{Role: models.Standard},
+			mockGetUserErr:         nil,
+			reqMethod:              http.MethodGet,
+			reqURLPath:             "/api/v1/admin/users",
+			expectedErr:            ErrMethodNotAllowed,
+		},
+		{
+			name:                   "Valid token, non-admin user, non-user-accessible method on user route (DELETE diaryEntries)",
+			authHeader:             "Bearer user.token",
+			mockValidateTokenErr:   nil,
+			mockGetTokenByValue:    &models.Token{TokenValue: "user.token"},
+			mockGetTokenByValueErr: nil,
+			mockGetClaims:          jwt.MapClaims{"sub": float64(1), auth.KindClaim: float64(models.Access)},
+			mockGetClaimsErr:       nil,
+			mockGetUser:            &models.User{Role: models.Standard},
+			mockGetUserErr:         nil,
+			reqMethod:              http.MethodDelete,
+			reqURLPath:             "/api/v1/diaryEntries/123",
+			expectedErr:            ErrMethodNotAllowed,
+		},
+		{
+			name:                   "Valid token, user-accessible GET (users) does not look up the user",
+			authHeader:             "Bearer user.token",
+			mockValidateTokenErr:   nil,
+			mockGetTokenByValue:    &models.Token{TokenValue: "user.token"},
+			mockGetTokenByValueErr: nil,
+			mockGetClaims:          jwt.MapClaims{"sub": float64(1), auth.KindClaim: float64(models.Access)},
+			mockGetClaimsErr:       nil,
+			mockGetUser:            nil,
+			mockGetUserErr:         errors.New("user should not be looked up"),
+			reqMethod:              http.MethodGet,
+			reqURLPath:             "/api/v1/users/1",
+			expectedErr:            nil,
+		},
+		{
+			name:                   "Valid token, non-admin user, user-accessible POST (diary entries import)",
+			authHeader:             "Bearer user.token",
+			mockValidateTokenErr:   nil,
+			mockGetTokenByValue:    &models.Token{TokenValue: "user.token"},
+			mockGetTokenByValueErr: nil,
+			mockGetClaims:          jwt.MapClaims{"sub": float64(1), auth.KindClaim: float64(models.Access)},
+			mockGetClaimsErr:       nil,
+			mockGetUser:            &models.User{Role: models.Standard},
+			mockGetUserErr:         nil,
+			reqMethod:              http.MethodPost,
+			reqURLPath:             "/api/v1/diaryEntries/import",
+			expectedErr:            nil,
+		},
+		{
+			name:                   "Valid token, non-admin user, user-accessible PUT (external login)",
+			authHeader:             "Bearer user.token",
+			mockValidateTokenErr:   nil,
+			mockGetTokenByValue:    &models.Token{TokenValue: "user.token"},
+			mockGetTokenByValueErr: nil,
+			mockGetClaims:          jwt.MapClaims{"sub": float64(1), auth.KindClaim: float64(models.Access)},
+			mockGetClaimsErr:       nil,
+			mockGetUser:            &models.User{Role: models.Standard},
+			mockGetUserErr:         nil,
+			reqMethod:              http.MethodPut,
+			reqURLPath:             "/api/v1/auth/external-login",
+			expectedErr:            nil,
+		},
+		{
+			name:                   "Valid token, non-admin user, user-accessible POST (link provider)",
+			authHeader:             "Bearer user.token",
+			mockValidateTokenErr:   nil,
+			mockGetTokenByValue:    &models.Token{TokenValue: "user.token"},
+			mockGetTokenByValueErr: nil,
+			mockGetClaims:          jwt.MapClaims{"sub": float64(1), auth.KindClaim: float64(models.Access)},
+			mockGetClaimsErr:       nil,
+			mockGetUser:            &models.User{Role: models.Standard},
+			mockGetUserErr:         nil,
+			reqMethod:              http.MethodPost,
+			reqURLPath:             "/api/v1/auth/link-provider",
+			expectedErr:            nil,
+		},
+		{
+			name:                   "Valid token, non-admin user, user-accessible DELETE (revoke session)",
+			authHeader:             "Bearer user.token",
+			mockValidateTokenErr:   nil,
+			mockGetTokenByValue:    &models.Token{TokenValue: "user.token"},
+			mockGetTokenByValueErr: nil,
+			mockGetClaims:          jwt.MapClaims{"sub": float64(1), auth.KindClaim: float64(models.Access)},
+			mockGetClaimsErr:       nil,
+			mockGetUser:            &models.User{Role: models.Standard},
+			mockGetUserErr:         nil,
+			reqMethod:              http.MethodDelete,
+			reqURLPath:             "/api/v1/auth/sessions/2",
 			expectedErr:            nil,
 		},
 		{
 			name:                   "Valid token, non-admin user, user-accessible POST (diaryEntries)",
 			authHeader:             "Bearer user.token",
 			mockValidateTokenErr:   nil,
-			mockGetTokenByValue:    &models.Token{},
+			mockGetTokenByValue:    &models.Token{TokenValue: "user.token"},
 			mockGetTokenByValueErr: nil,
-			mockGetClaims:          jwt.MapClaims{"sub": float64(1)},
+			mockGetClaims:          jwt.MapClaims{"sub": float64(1), auth.KindClaim: float64(models.Access)},
 			mockGetClaimsErr:       nil,
-			mockGetUserByEmail:     &models.User{Role: models.Standard},
-			mockGetUserByEmailErr:  nil,
+			mockGetUser:            &models.User{Role: models.Standard},
+			mockGetUserErr:         nil,
 			reqMethod:              http.MethodPost,
 			reqURLPath:             "/api/v1/diaryEntries",
 			expectedErr:            nil,
@@ -283,26 +689,40 @@ func TestCheckAuth(t *testing.T) {
 			name:                   "Valid token, non-admin user, user-accessible GET (activityRegistrations)",
 			authHeader:             "Bearer user.token",
 			mockValidateTokenErr:   nil,
-			mockGetTokenByValue:    &models.Token{},
+			mockGetTokenByValue:    &models.Token{TokenValue: "user.token"},
 			mockGetTokenByValueErr: nil,
-			mockGetClaims:          jwt.MapClaims{"sub": float64(1)},
+			mockGetClaims:          jwt.MapClaims{"sub": float64(1), auth.KindClaim: float64(models.Access)},
 			mockGetClaimsErr:       nil,
-			mockGetUserByEmail:     &models.User{Role: models.Standard},
-			mockGetUserByEmailErr:  nil,
+			mockGetUser:            &models.User{Role: models.Standard},
+			mockGetUserErr:         nil,
 			reqMethod:              http.MethodGet,
 			reqURLPath:             "/api/v1/activityRegistrations/books/user/123",
 			expectedErr:            nil,
 		},
+		{
+			name:                   "Valid token, non-admin user, user-accessible GET (activity feed)",
+			authHeader:             "Bearer user.token",
+			mockValidateTokenErr:   nil,
+			mockGetTokenByValue:    &models.Token{TokenValue: "user.token"},
+			mockGetTokenByValueErr: nil,
+			mockGetClaims:          jwt.MapClaims{"sub": float64(1), auth.KindClaim: float64(models.Access)},
+			mockGetClaimsErr:       nil,
+			mockGetUser:            &models.User{Role: models.Standard},
+			mockGetUserErr:         nil,
+			reqMethod:              http.MethodGet,
+			reqURLPath:             "/api/v1/activityRegistrations/user/123",
+			expectedErr:            nil,
+		},
 		{
 			name:                   "Valid token, non-admin user, user-accessible PUT (diaryEntries)",
 			authHeader:             "Bearer user.token",
 			mockValidateTokenErr:   nil,
-			mockGetTokenByValue:    &models.Token{},
+			mockGetTokenByValue:    &models.Token{TokenValue: "user.token"},
 			mockGetTokenByValueErr: nil,
-			mockGetClaims:          jwt.MapClaims{"sub": float64(1)},
+			mockGetClaims:          jwt.MapClaims{"sub": float64(1), auth.KindClaim: float64(models.Access)},
 			mockGetClaimsErr:       nil,
-			mockGetUserByEmail:     &models.User{Role: models.Standard},
-			mockGetUserByEmailErr:  nil,
+			mockGetUser:            &models.User{Role: models.Standard},
+			mockGetUserErr:         nil,
 			reqMethod:              http.MethodPut,
 			reqURLPath:             "/api/v1/diaryEntries/123",
 			expectedErr:            nil,
@@ -327,13 +747,13 @@ func TestCheckAuth(t *testing.T) {
 				DeleteTokenFunc:        func(id uint) error { return nil },
 			}
 			userService = &mockUserService{
-				GetUserByEmailFunc: func(email string) (*models.User, error) {
-					return testCase.mockGetUserByEmail, testCase.mockGetUserByEmailErr
+				GetUserByEmailFunc: func(email string) (*models.User, error) { return &models.User{}, nil },
+				GetUserByIdFunc: func(id uint) (*models.User, error) {
+					return testCase.mockGetUser, testCase.mockGetUserErr
 				},
-				GetUserByIdFunc: func(id uint) (*models.User, error) { return &models.User{}, nil },
-				DeleteUserFunc:  func(id uint) error { return nil },
-				SaveUserFunc:    func(userBody services.UserBody) (*models.User, error) { return &models.User{}, nil },
-				UpdateUserFunc:  func(userBody services.UserBody) (*models.User, error) { return &models.User{}, nil },
+				DeleteUserFunc: func(id uint) error { return nil },
+				SaveUserFunc:   func(userBody services.UserBody) (*models.User, error) { return &models.User{}, nil },
+				UpdateUserFunc: func(userBody services.UserBody) (*models.User, error) { return &models.User{}, nil },
 			}
 
 			req, _ := http.NewRequest(testCase.reqMethod, testCase.reqURLPath, nil)
@@ -341,11 +761,15 @@ func TestCheckAuth(t *testing.T) {
 				req.Header.Set("Authorization", testCase.authHeader)
 			}
 
-			err := checkAuth(req)
+			err := checkAuth(httptest.NewRecorder(), req)
 
 			if (err == nil && testCase.expectedErr != nil) || (err != nil && testCase.expectedErr == nil) || (err != nil && err.Error() != testCase.expectedErr.Error()) {
 				t.Errorf("checkAuth() error = %v, wantErr %v", err, testCase.expectedErr)
 			}
+
+			if testCase.expectedErr == ErrMethodNotAllowed && !errors.Is(err, ErrMethodNotAllowed) {
+				t.Errorf("checkAuth() error = %v, want ErrMethodNotAllowed", err)
+			}
 		})
 	}
 }
@@ -359,8 +783,8 @@ type testCaseCheckAuth struct {
 	mockGetTokenByValueErr error
 	mockGetClaims          jwt.MapClaims
 	mockGetClaimsErr       error
-	mockGetUserByEmail     *models.User
-	mockGetUserByEmailErr  error
+	mockGetUser            *models.User
+	mockGetUserErr         error
 	reqMethod              string
 	reqURLPath             string
 	expectedErr            error
@@ -390,6 +814,9 @@ type testCaseCheckUserOwnershipMiddleware struct {
 	mockGetUserByIdErr       error
 	mockGetDiaryEntryById    *models.DiaryEntry
 	mockGetDiaryEntryByIdErr error
+	mockGetBookRegistration  *models.BookActivityRegistration
+	mockGetGameRegistration  *models.GameActivityRegistration
+	mockGetRegistrationErr   error
 	expectedErr              error
 }
 
@@ -399,10 +826,14 @@ func TestCheckUserOwnershipMiddleware(t *testing.T) {
 	originalTokenManager := tokenManager
 	originalUserService := userService
 	originalDiaryEntryService := diaryEntryService
+	originalBookRegistrationService := bookRegistrationService
+	originalGameRegistrationService := gameRegistrationService
 	defer func() {
 		tokenManager = originalTokenManager
 		userService = originalUserService
 		diaryEntryService = originalDiaryEntryService
+		bookRegistrationService = originalBookRegistrationService
+		gameRegistrationService = originalGameRegistrationService
 	}()
 
 	// Init test cases
@@ -416,6 +847,15 @@ func TestCheckUserOwnershipMiddleware(t *testing.T) {
 			mockGetClaimsErr: errors.New("invalid claims"),
 			expectedErr:      errors.New("invalid claims"),
 		},
+		{
+			name:          "Token claims without subject",
+			reqMethod:     http.MethodGet,
+			reqURLPath:    "/api/v1/diaryEntries/123",
+			reqID:         "123",
+			authHeader:    "Bearer valid.token",
+			mockGetClaims: jwt.MapClaims{},
+			expectedErr:   utils.ErrInvalidSubjectClaim,
+		},
 		{
 			name:                     "GET diary entry - user does not own",
 			reqMethod:                http.MethodGet,
@@ -469,42 +909,144 @@ func TestCheckUserOwnershipMiddleware(t *testing.T) {
 			expectedErr:              nil,
 		},
 		{
-			name:                     "GET book registration - user does not own",
-			reqMethod:                http.MethodGet,
-			reqURLPath:               "/api/v1/activityRegistrations/books/123",
-			reqID:                    "123",
-			authHeader:               "Bearer valid.token",
-			mockGetClaims:            jwt.MapClaims{"sub": float64(123)},
-			mockGetDiaryEntryById:    &models.DiaryEntry{Registration: models.ActivityRegistration{UserRefer: 456}},
-			mockGetDiaryEntryByIdErr: nil,
-			mockGetUserById:          &models.User{Email: "user@example.com"},
-			mockGetUserByIdErr:       nil,
-			expectedErr:              errors.New(constants.ErrorUnauthorizedOperation),
+			name:                    "PUT book registration - user does not own",
+			reqMethod:               http.MethodPut,
+			reqURLPath:              "/api/v1/activityRegistrations/books/123",
+			reqID:                   "123",
+			authHeader:              "Bearer valid.token",
+			mockGetClaims:           jwt.MapClaims{"sub": float64(123)},
+			mockGetBookRegistration: &models.BookActivityRegistration{Registration: models.ActivityRegistration{UserRefer: 456}},
+			expectedErr:             errors.New(constants.ErrorUnauthorizedOperation),
 		},
 		{
-			name:                     "GET game registration - user owns",
-			reqMethod:                http.MethodGet,
-			reqURLPath:               "/api/v1/activityRegistrations/games/123",
-			reqID:                    "123",
-			authHeader:               "Bearer valid.token",
-			mockGetClaims:            jwt.MapClaims{"sub": float64(123)},
-			mockGetDiaryEntryById:    &models.DiaryEntry{Registration: models.ActivityRegistration{UserRefer: 123}},
-			mockGetDiaryEntryByIdErr: nil,
-			mockGetUserById:          &models.User{Id: 123},
-			mockGetUserByIdErr:       nil,
-			expectedErr:              nil,
+			name:                    "PUT book registration - user owns",
+			reqMethod:               http.MethodPut,
+			reqURLPath:              "/api/v1/activityRegistrations/books/123",
+			reqID:                   "123",
+			authHeader:              "Bearer valid.token",
+			mockGetClaims:           jwt.MapClaims{"sub": float64(123)},
+			mockGetBookRegistration: &models.BookActivityRegistration{Registration: models.ActivityRegistration{UserRefer: 123}},
+			expectedErr:             nil,
 		},
 		{
-			name:          "Non-GET/PUT method (e.g., POST) - should pass through",
-			reqMethod:     http.MethodPost,
-			reqURLPath:    "/api/v1/diaryEntries/123",
-			reqID:         "123",
-			authHeader:    "Bearer valid.token",
-			mockGetClaims: jwt.MapClaims{"sub": float64(1)},
-			expectedErr:   nil,
+			name:                    "PUT game registration - user does not own",
+			reqMethod:               http.MethodPut,
+			reqURLPath:              "/api/v1/activityRegistrations/games/123",
+			reqID:                   "123",
+			authHeader:              "Bearer valid.token",
+			mockGetClaims:           jwt.MapClaims{"sub": float64(123)},
+			mockGetGameRegistration: &models.GameActivityRegistration{Registration: models.ActivityRegistration{UserRefer: 456}},
+			expectedErr:             errors.New(constants.ErrorUnauthorizedOperation),
 		},
 		{
-			name:          "Non-protected endpoint - should pass through",
+			name:                    "PUT game registration - user owns",
+			reqMethod:               http.MethodPut,
+			reqURLPath:              "/api/v1/activityRegistrations/games/123",
+			reqID:                   "123",
+			authHeader:              "Bearer valid.token",
+			mockGetClaims:           jwt.MapClaims{"sub": float64(123)},
+			mockGetGameRegistration: &models.GameActivityRegistration{Registration: models.ActivityRegistration{UserRefer: 123}},
+			expectedErr:             nil,
+		},
+		{
+			name:                   "PUT game registration - not found",
+			reqMethod:              http.MethodPut,
+			reqURLPath:             "/api/v1/activityRegistrations/games/123",
+			reqID:                  "123",
+			authHeader:             "Bearer valid.token",
+			mockGetClaims:          jwt.MapClaims{"sub": float64(123)},
+			mockGetRegistrationErr: &models.DbNotFoundError{DbItem: &models.GameActivityRegistration{}},
+			expectedErr:            &models.DbNotFoundError{DbItem: &models.GameActivityRegistration{}},
+		},
+		{
+			name:                    "GET book registration - user does not own",
+			reqMethod:               http.MethodGet,
+			reqURLPath:              "/api/v1/activityRegistrations/books/123",
+			reqID:                   "123",
+			authHeader:              "Bearer valid.token",
+			mockGetClaims:           jwt.MapClaims{"sub": float64(123)},
+			mockGetBookRegistration: &models.BookActivityRegistration{Registration: models.ActivityRegistration{UserRefer: 456}},
+			expectedErr:             errors.New(constants.ErrorUnauthorizedOperation),
+		},
+		{
+			name:                    "GET book registration - user owns",
+			reqMethod:               http.MethodGet,
+			reqURLPath:              "/api/v1/activityRegistrations/books/123",
+			reqID:                   "123",
+			authHeader:              "Bearer valid.token",
+			mockGetClaims:           jwt.MapClaims{"sub": float64(123)},
+			mockGetBookRegistration: &models.BookActivityRegistration{Registration: models.ActivityRegistration{UserRefer: 123}},
+			expectedErr:             nil,
+		},
+		{
+			name:                    "GET game registration - user does not own",
+			reqMethod:               http.MethodGet,
+			reqURLPath:              "/api/v1/activityRegistrations/games/123",
+			reqID:                   "123",
+			authHeader:              "Bearer valid.token",
+			mockGetClaims:           jwt.MapClaims{"sub": float64(123)},
+			mockGetGameRegistration: &models.GameActivityRegistration{Registration: models.ActivityRegistration{UserRefer: 456}},
+			expectedErr:             errors.New(constants.ErrorUnauthorizedOperation),
+		},
+		{
+			name:                    "GET game registration - user owns",
+			reqMethod:               http.MethodGet,
+			reqURLPath:              "/api/v1/activityRegistrations/games/123",
+			reqID:                   "123",
+			authHeader:              "Bearer valid.token",
+			mockGetClaims:           jwt.MapClaims{"sub": float64(123)},
+			mockGetGameRegistration: &models.GameActivityRegistration{Registration: models.ActivityRegistration{UserRefer: 123}},
+			expectedErr:             nil,
+		},
+		{
+			name:            "GET activity feed - other user",
+			reqMethod:       http.MethodGet,
+			reqURLPath:      "/api/v1/activityRegistrations/user/456",
+			reqID:           "456",
+			authHeader:      "Bearer valid.token",
+			mockGetClaims:   jwt.MapClaims{"sub": float64(123)},
+			mockGetUserById: &models.User{Id: 456},
+			expectedErr:     errors.New(constants.ErrorUnauthorizedOperation),
+		},
+		{
+			name:            "GET activity feed - own feed",
+			reqMethod:       http.MethodGet,
+			reqURLPath:      "/api/v1/activityRegistrations/user/123",
+			reqID:           "123",
+			authHeader:      "Bearer valid.token",
+			mockGetClaims:   jwt.MapClaims{"sub": float64(123)},
+			mockGetUserById: &models.User{Id: 123},
+			expectedErr:     nil,
+		},
+		{
+			name:          "DELETE user diary entries - other user",
+			reqMethod:     http.MethodDelete,
+			reqURLPath:    "/api/v1/diaryEntries/user/456",
+			reqID:         "456",
+			authHeader:    "Bearer valid.token",
+			mockGetClaims: jwt.MapClaims{"sub": float64(123)},
+			expectedErr:   errors.New(constants.ErrorUnauthorizedOperation),
+		},
+		{
+			name:          "DELETE user diary entries - own entries",
+			reqMethod:     http.MethodDelete,
+			reqURLPath:    "/api/v1/diaryEntries/user/123",
+			reqID:         "123",
+			authHeader:    "Bearer valid.token",
+			mockGetClaims: jwt.MapClaims{"sub": float64(123)},
+			expectedErr:   nil,
+		},
+		{
+			name:          "Non-GET/PUT method (e.g., POST) - should pass through",
+			reqMethod:     http.MethodPost,
+			reqURLPath:    "/api/v1/diaryEntries/123",
+			reqID:         "123",
+			authHeader:    "Bearer valid.token",
+			mockGetClaims: jwt.MapClaims{"sub": float64(1)},
+			expectedErr:   nil,
+		},
+		{
+			name:          "Non-protected endpoint - should pass through",
 			reqMethod:     http.MethodGet,
 			reqURLPath:    "/api/v1/users/123",
 			reqID:         "123",
@@ -530,6 +1072,16 @@ func TestCheckUserOwnershipMiddleware(t *testing.T) {
 					return testCase.mockGetDiaryEntryById, testCase.mockGetDiaryEntryByIdErr
 				},
 			}
+			bookRegistrationService = &mockBookRegistrationService{
+				GetBookActivityRegistrationByIdFunc: func(id uint) (*models.BookActivityRegistration, error) {
+					return testCase.mockGetBookRegistration, testCase.mockGetRegistrationErr
+				},
+			}
+			gameRegistrationService = &mockGameRegistrationService{
+				GetGameActivityRegistrationByIdFunc: func(id uint) (*models.GameActivityRegistration, error) {
+					return testCase.mockGetGameRegistration, testCase.mockGetRegistrationErr
+				},
+			}
 
 			// Create request with path variables
 			req := httptest.NewRequest(testCase.reqMethod, testCase.reqURLPath, nil)
@@ -548,3 +1100,726 @@ func TestCheckUserOwnershipMiddleware(t *testing.T) {
 		})
 	}
 }
+
+// Test UserOwnershipMiddleware response statuses
+func TestUserOwnershipMiddlewareStatus(t *testing.T) {
+	originalTokenManager := tokenManager
+	originalGameRegistrationService := gameRegistrationService
+	defer func() {
+		tokenManager = originalTokenManager
+		gameRegistrationService = originalGameRegistrationService
+	}()
+
+	tokenManager = &mockTokenManager{
+		GetClaimsFunc: func(token string) (jwt.MapClaims, error) { return jwt.MapClaims{"sub": float64(123)}, nil },
+	}
+
+	tests := []struct {
+		name             string
+		mockRegistration *models.GameActivityRegistration
+		mockErr          error
+		expectedStatus   int
+	}{
+		{"Owned registration", &models.GameActivityRegistration{Registration: models.ActivityRegistration{UserRefer: 123}}, nil, http.StatusOK},
+		{"Registration of another user", &models.GameActivityRegistration{Registration: models.ActivityRegistration{UserRefer: 456}}, nil, http.StatusForbidden},
+		{"Missing registration", nil, &models.DbNotFoundError{DbItem: &models.GameActivityRegistration{}}, http.StatusNotFound},
+	}
+
+	for _, testCase := range tests {
+		t.Run(testCase.name, func(t *testing.T) {
+			gameRegistrationService = &mockGameRegistrationService{
+				GetGameActivityRegistrationByIdFunc: func(id uint) (*models.GameActivityRegistration, error) {
+					return testCase.mockRegistration, testCase.mockErr
+				},
+			}
+			nextHandler := http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+				res.WriteHeader(http.StatusOK)
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/activityRegistrations/games/123", nil)
+			req = mux.SetURLVars(req, map[string]string{"id": "123"})
+			req.Header.Set("Authorization", "Bearer valid.token")
+			res := httptest.NewRecorder()
+
+			UserOwnershipMiddleware(nextHandler).ServeHTTP(res, req)
+
+			if res.Code != testCase.expectedStatus {
+				t.Errorf("UserOwnershipMiddleware() status = %d, want %d", res.Code, testCase.expectedStatus)
+			}
+		})
+	}
+}
+
+// Test VerifiedEmailMiddleware
+func TestVerifiedEmailMiddleware(t *testing.T) {
+	originalTokenManager := tokenManager
+	originalUserService := userService
+	defer func() {
+		tokenManager = originalTokenManager
+		userService = originalUserService
+	}()
+
+	tokenManager = &mockTokenManager{
+		GetClaimsFunc: func(token string) (jwt.MapClaims, error) {
+			userId, _ := strconv.Atoi(token)
+			return jwt.MapClaims{"sub": float64(userId)}, nil
+		},
+	}
+	userService = &mockUserService{
+		GetUserByIdFunc: func(id uint) (*models.User, error) {
+			switch id {
+			case 1:
+				return &models.User{Id: id, Role: models.Standard, EmailVerified: true}, nil
+			case 2:
+				return &models.User{Id: id, Role: models.Standard}, nil
+			case 3:
+				return &models.User{Id: id, Role: models.Admin}, nil
+			default:
+				return nil, &models.DbNotFoundError{DbItem: &models.User{}}
+			}
+		},
+	}
+	nextHandler := http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		res.WriteHeader(http.StatusOK)
+	})
+
+	tests := []struct {
+		name           string
+		required       string
+		userId         string
+		reqMethod      string
+		reqURLPath     string
+		expectedStatus int
+	}{
+		{"Verified user writes", "true", "1", http.MethodPost, "/api/v1/diaryEntries", http.StatusOK},
+		{"Unverified user writes a diary entry", "true", "2", http.MethodPost, "/api/v1/diaryEntries", http.StatusForbidden},
+		{"Unverified user updates a registration", "true", "2", http.MethodPut, "/api/v1/activityRegistrations/books/1", http.StatusForbidden},
+		{"Unverified user deletes diary entries", "true", "2", http.MethodDelete, "/api/v1/diaryEntries/user/2", http.StatusForbidden},
+		{"Unverified user reads", "true", "2", http.MethodGet, "/api/v1/diaryEntries/user/2", http.StatusOK},
+		{"Unverified user writes elsewhere", "true", "2", http.MethodPut, "/api/v1/auth/external-login", http.StatusOK},
+		{"Unverified admin writes", "true", "3", http.MethodPost, "/api/v1/diaryEntries", http.StatusOK},
+		{"Unknown user writes", "true", "4", http.MethodPost, "/api/v1/diaryEntries", http.StatusUnauthorized},
+		{"Verification not required", "false", "2", http.MethodPost, "/api/v1/diaryEntries", http.StatusOK},
+	}
+
+	for _, testCase := range tests {
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Setenv("API_REQUIRE_VERIFIED_EMAIL", testCase.required)
+
+			req := httptest.NewRequest(testCase.reqMethod, testCase.reqURLPath, nil)
+			req.Header.Set("Authorization", "Bearer "+testCase.userId)
+			res := httptest.NewRecorder()
+
+			VerifiedEmailMiddleware(nextHandler).ServeHTTP(res, req)
+
+			if res.Code != testCase.expectedStatus {
+				t.Errorf("VerifiedEmailMiddleware() status = %d, want %d", res.Code, testCase.expectedStatus)
+			}
+
+			if testCase.expectedStatus == http.StatusForbidden && !strings.Contains(res.Body.String(), constants.ErrorEmailNotVerified) {
+				t.Errorf("VerifiedEmailMiddleware() body = %s, want the email not verified error", res.Body.String())
+			}
+		})
+	}
+}
+
+// Test ReadOnlyMiddleware
+func TestReadOnlyMiddleware(t *testing.T) {
+	nextHandler := http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		res.WriteHeader(http.StatusOK)
+	})
+
+	tests := []struct {
+		name           string
+		readOnly       string
+		reqMethod      string
+		reqURLPath     string
+		expectedStatus int
+	}{
+		{"Read-only mode, GET passes", "true", http.MethodGet, "/api/v1/diaryEntries/user/1", http.StatusOK},
+		{"Read-only mode, POST blocked", "true", http.MethodPost, "/api/v1/diaryEntries", http.StatusServiceUnavailable},
+		{"Read-only mode, PUT blocked", "true", http.MethodPut, "/api/v1/diaryEntries/1", http.StatusServiceUnavailable},
+		{"Read-only mode, DELETE blocked", "true", http.MethodDelete, "/api/v1/diaryEntries/1", http.StatusServiceUnavailable},
+		{"Read-only mode, token refresh passes", "true", http.MethodPost, "/api/v1/auth/refreshToken", http.StatusOK},
+		{"Read-only mode, import validation passes", "true", http.MethodPost, "/api/v1/diaryEntries/import/validate", http.StatusOK},
+		{"Read-only mode, import is rejected", "true", http.MethodPost, "/api/v1/diaryEntries/import", http.StatusServiceUnavailable},
+		{"Read-only mode disabled, POST passes", "false", http.MethodPost, "/api/v1/diaryEntries", http.StatusOK},
+	}
+
+	for _, testCase := range tests {
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Setenv("API_READ_ONLY", testCase.readOnly)
+
+			req := httptest.NewRequest(testCase.reqMethod, testCase.reqURLPath, nil)
+			res := httptest.NewRecorder()
+
+			ReadOnlyMiddleware(nextHandler).ServeHTTP(res, req)
+
+			if res.Code != testCase.expectedStatus {
+				t.Errorf("ReadOnlyMiddleware() status = %d, want %d", res.Code, testCase.expectedStatus)
+			}
+			if testCase.expectedStatus == http.StatusServiceUnavailable && res.Header().Get("Retry-After") == "" {
+				t.Errorf("ReadOnlyMiddleware() Retry-After header not set")
+			}
+		})
+	}
+}
+
+func TestClientVersionMiddleware(t *testing.T) {
+	nextHandler := http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		res.WriteHeader(http.StatusOK)
+	})
+
+	tests := []struct {
+		name           string
+		minVersion     string
+		allowMissing   string
+		clientVersion  string
+		reqURLPath     string
+		expectedStatus int
+	}{
+		{"Version below the minimum", "1.4.0", "true", "1.3.9", "/api/v1/diaryEntries/user/1", http.StatusUpgradeRequired},
+		{"Pre-release of the minimum version", "1.4.0", "true", "1.4.0-beta.1", "/api/v1/diaryEntries/user/1", http.StatusUpgradeRequired},
+		{"Version equal to the minimum", "1.4.0", "true", "1.4.0", "/api/v1/diaryEntries/user/1", http.StatusOK},
+		{"Version above the minimum", "1.4.0", "true", "1.10.0", "/api/v1/diaryEntries/user/1", http.StatusOK},
+		{"Missing version allowed", "1.4.0", "true", "", "/api/v1/diaryEntries/user/1", http.StatusOK},
+		{"Missing version rejected", "1.4.0", "false", "", "/api/v1/diaryEntries/user/1", http.StatusBadRequest},
+		{"Version not valid", "1.4.0", "true", "latest", "/api/v1/diaryEntries/user/1", http.StatusBadRequest},
+		{"Auth-exempt endpoint is not checked", "1.4.0", "false", "1.0.0", "/api/v1/auth/refreshToken", http.StatusOK},
+		{"No minimum version", "", "false", "", "/api/v1/diaryEntries/user/1", http.StatusOK},
+	}
+
+	for _, testCase := range tests {
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Setenv("API_MIN_CLIENT_VERSION", testCase.minVersion)
+			t.Setenv("API_CLIENT_VERSION_ALLOW_MISSING", testCase.allowMissing)
+			t.Setenv("API_CLIENT_UPGRADE_URL", "https://example.com/download")
+
+			req := httptest.NewRequest(http.MethodGet, testCase.reqURLPath, nil)
+			if testCase.clientVersion != "" {
+				req.Header.Set(constants.ClientVersionHeader, testCase.clientVersion)
+			}
+			res := httptest.NewRecorder()
+
+			ClientVersionMiddleware(nextHandler).ServeHTTP(res, req)
+
+			if res.Code != testCase.expectedStatus {
+				t.Errorf("ClientVersionMiddleware() status = %d, want %d", res.Code, testCase.expectedStatus)
+			}
+
+			if testCase.expectedStatus == http.StatusUpgradeRequired {
+				var upgradeErr models.UpgradeRequiredError
+				if decodeErr := json.NewDecoder(res.Body).Decode(&upgradeErr); decodeErr != nil {
+					t.Fatal(decodeErr)
+				}
+				if upgradeErr.MinimumVersion != testCase.minVersion || upgradeErr.UpgradeUrl != "https://example.com/download" {
+					t.Errorf("ClientVersionMiddleware() body = %+v", upgradeErr)
+				}
+			}
+		})
+	}
+}
+
+// Test ServerTimeMiddleware
+func TestServerTimeMiddleware(t *testing.T) {
+	nextHandler := http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		res.WriteHeader(http.StatusOK)
+	})
+
+	before := time.Now().Unix()
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/diaryEntries/user/1", nil)
+	res := httptest.NewRecorder()
+
+	ServerTimeMiddleware(nextHandler).ServeHTTP(res, req)
+
+	serverTime, parseErr := strconv.ParseInt(res.Header().Get(constants.ServerTimeHeader), 10, 64)
+
+	if parseErr != nil {
+		t.Fatalf("ServerTimeMiddleware() header not valid: %v", parseErr)
+	}
+	if serverTime < before || serverTime > time.Now().Unix() {
+		t.Errorf("ServerTimeMiddleware() time = %d, not within the request", serverTime)
+	}
+}
+
+func TestSlowRequestMiddleware(t *testing.T) {
+	t.Setenv("API_SLOW_REQUEST_MS", "20")
+
+	originalLogSlowRequest := logSlowRequest
+	defer func() { logSlowRequest = originalLogSlowRequest }()
+
+	var logged []string
+	logSlowRequest = func(format string, values ...any) {
+		logged = append(logged, fmt.Sprintf(format, values...))
+	}
+
+	slowHandler := http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		time.Sleep(40 * time.Millisecond)
+		res.WriteHeader(http.StatusAccepted)
+	})
+	fastHandler := http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		res.WriteHeader(http.StatusOK)
+	})
+
+	// Test case: Fast requests are not logged
+	SlowRequestMiddleware(fastHandler).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/v1/time", nil))
+
+	if len(logged) != 0 {
+		t.Fatalf("SlowRequestMiddleware() logged a fast request: %v", logged)
+	}
+
+	// Test case: Slow requests are logged with their method, path, status and request id
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/diaryEntries", nil)
+	req.Header.Set(constants.RequestIdHeader, "request-1")
+	res := httptest.NewRecorder()
+	SlowRequestMiddleware(slowHandler).ServeHTTP(res, req)
+
+	if res.Code != http.StatusAccepted {
+		t.Errorf("SlowRequestMiddleware() status = %d, want %d", res.Code, http.StatusAccepted)
+	}
+	if len(logged) != 1 || !strings.HasPrefix(logged[0], "Slow request request-1: POST /api/v1/diaryEntries responded 202 in ") {
+		t.Fatalf("SlowRequestMiddleware() logged %v", logged)
+	}
+
+	// Test case: Requests without a request id are logged without it
+	SlowRequestMiddleware(slowHandler).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/v1/internetArchive/books/search", nil))
+
+	if len(logged) != 2 || !strings.HasPrefix(logged[1], "Slow request: GET /api/v1/internetArchive/books/search responded 202 in ") {
+		t.Fatalf("SlowRequestMiddleware() logged %v", logged)
+	}
+
+	// Test case: The pprof profiles are not logged, as they take as long as they are asked to
+	SlowRequestMiddleware(slowHandler).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/v1/debug/pprof/profile", nil))
+
+	if len(logged) != 2 {
+		t.Fatalf("SlowRequestMiddleware() logged a pprof profile: %v", logged)
+	}
+
+	// Test case: No request is logged when the threshold is zero
+	t.Setenv("API_SLOW_REQUEST_MS", "0")
+	SlowRequestMiddleware(slowHandler).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/v1/time", nil))
+
+	if len(logged) != 2 {
+		t.Errorf("SlowRequestMiddleware() logged with a zero threshold: %v", logged)
+	}
+}
+
+// Test AuthMiddleware public endpoints
+func TestAuthMiddlewarePublicEndpoints(t *testing.T) {
+	nextHandler := http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		res.WriteHeader(http.StatusOK)
+	})
+
+	tests := []struct {
+		name           string
+		reqMethod      string
+		reqURLPath     string
+		expectedStatus int
+	}{
+		{"Root is public", http.MethodGet, "/", http.StatusOK},
+		{"API root is public", http.MethodGet, "/api/v1", http.StatusOK},
+		{"API root with trailing slash is public", http.MethodGet, "/api/v1/", http.StatusOK},
+		{"Authenticate is public", http.MethodPost, "/api/v1/auth/authenticate", http.StatusOK},
+		{"Refresh token is public", http.MethodPost, "/api/v1/auth/refreshToken", http.StatusOK},
+		{"Internet Archive is public", http.MethodGet, "/api/v1/internetArchive/books/search", http.StatusOK},
+		{"Server time is public", http.MethodGet, "/api/v1/time", http.StatusOK},
+		{"Paths starting with time require auth", http.MethodGet, "/api/v1/timeline", http.StatusUnauthorized},
+		{"External login update requires auth", http.MethodPut, "/api/v1/auth/external-login", http.StatusUnauthorized},
+		{"Provider linking requires auth", http.MethodPost, "/api/v1/auth/link-provider", http.StatusUnauthorized},
+		{"Sessions require auth", http.MethodGet, "/api/v1/auth/sessions", http.StatusUnauthorized},
+		{"Logout requires auth", http.MethodPost, "/api/v1/auth/logout", http.StatusUnauthorized},
+		{"Diary entries require auth", http.MethodGet, "/api/v1/diaryEntries/user/1", http.StatusUnauthorized},
+	}
+
+	for _, testCase := range tests {
+		t.Run(testCase.name, func(t *testing.T) {
+			req := httptest.NewRequest(testCase.reqMethod, testCase.reqURLPath, nil)
+			res := httptest.NewRecorder()
+
+			AuthMiddleware(nextHandler).ServeHTTP(res, req)
+
+			if res.Code != testCase.expectedStatus {
+				t.Errorf("AuthMiddleware() status = %d, want %d", res.Code, testCase.expectedStatus)
+			}
+		})
+	}
+}
+
+// Test AuthMiddleware access token renewal
+func TestAuthMiddlewareAccessTokenRenewal(t *testing.T) {
+	originalTokenManager := tokenManager
+	originalTokenService := tokenService
+	defer func() {
+		tokenManager = originalTokenManager
+		tokenService = originalTokenService
+	}()
+
+	nextHandler := http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		res.WriteHeader(http.StatusOK)
+	})
+
+	tests := []struct {
+		name              string
+		renewalWindow     string
+		expiresIn         time.Duration
+		dbTokenKind       models.TokenKind
+		updateErr         error
+		expectedNewToken  string
+		expectedDbUpdates int
+	}{
+		{"Near-expiry access token is renewed", "5m", time.Minute, models.Access, nil, "renewed.token", 1},
+		{"Fresh access token is not renewed", "5m", 30 * time.Minute, models.Access, nil, "", 0},
+		{"Renewal disabled", "0", time.Minute, models.Access, nil, "", 0},
+		{"Near-expiry impersonation token is not renewed", "5m", time.Minute, models.Impersonation, nil, "", 0},
+		{"Renewed token could not be saved", "5m", time.Minute, models.Access, errors.New("db error"), "", 1},
+	}
+
+	for _, testCase := range tests {
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Setenv("API_ACCESS_TOKEN_RENEWAL_WINDOW", testCase.renewalWindow)
+
+			tokenManager = &mockTokenManager{
+				GetClaimsFunc: func(token string) (jwt.MapClaims, error) {
+					return jwt.MapClaims{
+						"sub":          float64(1),
+						"exp":          float64(time.Now().Add(testCase.expiresIn).Unix()),
+						auth.KindClaim: float64(models.Access),
+					}, nil
+				},
+				GenerateTokenFunc: func(user models.User, tokenKind models.TokenKind) (string, error) {
+					return "renewed.token", nil
+				},
+			}
+			var dbUpdates []*models.Token
+			tokenService = &mockTokenService{
+				GetTokenByValueFunc: func(token string) (*models.Token, error) {
+					return &models.Token{Id: 7, TokenValue: "user.token", UserRefer: 1, Kind: testCase.dbTokenKind}, nil
+				},
+				RenewTokenFunc: func(token *models.Token, newTokenValue string) (bool, error) {
+					dbUpdates = append(dbUpdates, &models.Token{Id: token.Id, TokenValue: newTokenValue, Kind: token.Kind})
+					return testCase.updateErr == nil, testCase.updateErr
+				},
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/diaryEntries/user/1", nil)
+			req.Header.Set("Authorization", "Bearer user.token")
+			res := httptest.NewRecorder()
+
+			AuthMiddleware(nextHandler).ServeHTTP(res, req)
+
+			if res.Code != http.StatusOK {
+				t.Errorf("AuthMiddleware() status = %d, want %d", res.Code, http.StatusOK)
+			}
+
+			if newToken := res.Header().Get(constants.NewAccessTokenHeader); newToken != testCase.expectedNewToken {
+				t.Errorf("AuthMiddleware() new access token = %q, want %q", newToken, testCase.expectedNewToken)
+			}
+
+			if len(dbUpdates) != testCase.expectedDbUpdates {
+				t.Fatalf("AuthMiddleware() token updates = %d, want %d", len(dbUpdates), testCase.expectedDbUpdates)
+			}
+
+			if len(dbUpdates) > 0 && (dbUpdates[0].Id != 7 || dbUpdates[0].TokenValue != "renewed.token" || dbUpdates[0].Kind != models.Access) {
+				t.Errorf("AuthMiddleware() updated token = %+v, want the renewed token in row 7", dbUpdates[0])
+			}
+		})
+	}
+}
+
+// Token storage holding a single token, safe for concurrent use.
+type singleTokenStorage struct {
+	storage.TokenStorageInterface
+	lock  sync.Mutex
+	token models.Token
+}
+
+func (tokenStorage *singleTokenStorage) Get(id uint) (interface{}, error) {
+	tokenStorage.lock.Lock()
+	defer tokenStorage.lock.Unlock()
+
+	if id != tokenStorage.token.Id {
+		return nil, &models.DbNotFoundError{DbItem: &models.Token{}}
+	}
+
+	token := tokenStorage.token
+	return &token, nil
+}
+
+func (tokenStorage *singleTokenStorage) GetByValue(tokenValue string) (interface{}, error) {
+	tokenStorage.lock.Lock()
+	defer tokenStorage.lock.Unlock()
+
+	if tokenValue != tokenStorage.token.TokenValue {
+		return nil, &models.DbNotFoundError{DbItem: &models.Token{}}
+	}
+
+	token := tokenStorage.token
+	return &token, nil
+}
+
+func (tokenStorage *singleTokenStorage) Update(data interface{}) error {
+	tokenStorage.lock.Lock()
+	defer tokenStorage.lock.Unlock()
+
+	tokenStorage.token = *data.(*models.Token)
+	return nil
+}
+
+func (tokenStorage *singleTokenStorage) UpdateLastUsedAt(id uint, lastUsedAt int64) error {
+	return nil
+}
+
+func TestAuthMiddlewareConcurrentAccessTokenRenewal(t *testing.T) {
+	originalTokenManager := tokenManager
+	originalTokenService := tokenService
+	defer func() {
+		tokenManager = originalTokenManager
+		tokenService = originalTokenService
+	}()
+
+	t.Setenv("API_ACCESS_TOKEN_RENEWAL_WINDOW", "5m")
+
+	var generatedTokens atomic.Int32
+	tokenManager = &mockTokenManager{
+		GetClaimsFunc: func(token string) (jwt.MapClaims, error) {
+			return jwt.MapClaims{
+				"sub":          float64(1),
+				"exp":          float64(time.Now().Add(time.Minute).Unix()),
+				auth.KindClaim: float64(models.Access),
+			}, nil
+		},
+		GenerateTokenFunc: func(user models.User, tokenKind models.TokenKind) (string, error) {
+			return fmt.Sprintf("renewed.token.%d", generatedTokens.Add(1)), nil
+		},
+	}
+	tokenStorage := &singleTokenStorage{token: models.Token{Id: 7, TokenValue: "concurrent.token", UserRefer: 1, Kind: models.Access}}
+	tokenService = services.NewTokenServiceImpl(tokenStorage)
+
+	nextHandler := http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		res.WriteHeader(http.StatusOK)
+	})
+	authorize := func(token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/diaryEntries", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		res := httptest.NewRecorder()
+		AuthMiddleware(nextHandler).ServeHTTP(res, req)
+		return res
+	}
+
+	const requests = 20
+	responses := make([]*httptest.ResponseRecorder, requests)
+	var waitGroup sync.WaitGroup
+	for i := 0; i < requests; i++ {
+		waitGroup.Add(1)
+		go func() {
+			defer waitGroup.Done()
+			responses[i] = authorize("concurrent.token")
+		}()
+	}
+	waitGroup.Wait()
+
+	// Test case: Every concurrent request is authorized, and only one of them renews the token
+	var newTokens []string
+	for _, res := range responses {
+		if res.Code != http.StatusOK {
+			t.Errorf("AuthMiddleware() status = %d, want %d", res.Code, http.StatusOK)
+		}
+
+		if newToken := res.Header().Get(constants.NewAccessTokenHeader); newToken != "" {
+			newTokens = append(newTokens, newToken)
+		}
+	}
+
+	if len(newTokens) != 1 {
+		t.Fatalf("AuthMiddleware() renewed the token %d times, want 1", len(newTokens))
+	}
+
+	if storedToken, _ := tokenStorage.Get(7); storedToken.(*models.Token).TokenValue != newTokens[0] {
+		t.Errorf("AuthMiddleware() stored token = %q, want %q", storedToken.(*models.Token).TokenValue, newTokens[0])
+	}
+
+	// Test case: The old token is still accepted within the overlap, without being renewed again
+	res := authorize("concurrent.token")
+
+	if res.Code != http.StatusOK {
+		t.Errorf("AuthMiddleware() status = %d, want %d", res.Code, http.StatusOK)
+	}
+
+	if newToken := res.Header().Get(constants.NewAccessTokenHeader); newToken != "" {
+		t.Errorf("AuthMiddleware() new access token = %q, want none", newToken)
+	}
+}
+
+func TestAuthMiddlewareDeletedTokenGracePeriod(t *testing.T) {
+	originalTokenManager := tokenManager
+	originalTokenService := tokenService
+	defer func() {
+		tokenManager = originalTokenManager
+		tokenService = originalTokenService
+	}()
+
+	tokenManager = &mockTokenManager{
+		GetClaimsFunc: func(token string) (jwt.MapClaims, error) {
+			return jwt.MapClaims{"sub": float64(1), auth.KindClaim: float64(models.Access)}, nil
+		},
+	}
+	var lastUsedUpdates int
+	tokenService = &mockTokenService{
+		GetTokenByValueFunc: func(token string) (*models.Token, error) {
+			return nil, &models.DbNotFoundError{DbItem: &models.Token{}}
+		},
+		IsTokenInGracePeriodFunc: func(tokenValue string) bool {
+			return tokenValue == "grace.token"
+		},
+		UpdateTokenLastUsedAtFunc: func(id uint, lastUsedAt int64) error {
+			lastUsedUpdates++
+			return nil
+		},
+	}
+
+	nextHandler := http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		res.WriteHeader(http.StatusOK)
+	})
+
+	tests := []struct {
+		name           string
+		method         string
+		token          string
+		expectedStatus int
+	}{
+		{"GET within the grace period", http.MethodGet, "grace.token", http.StatusOK},
+		{"POST within the grace period", http.MethodPost, "grace.token", http.StatusUnauthorized},
+		{"DELETE within the grace period", http.MethodDelete, "grace.token", http.StatusUnauthorized},
+		{"GET after the grace period", http.MethodGet, "expired-grace.token", http.StatusUnauthorized},
+	}
+
+	for _, testCase := range tests {
+		t.Run(testCase.name, func(t *testing.T) {
+			req := httptest.NewRequest(testCase.method, "/api/v1/diaryEntries/user/1", nil)
+			req.Header.Set("Authorization", "Bearer "+testCase.token)
+			res := httptest.NewRecorder()
+
+			AuthMiddleware(nextHandler).ServeHTTP(res, req)
+
+			if res.Code != testCase.expectedStatus {
+				t.Errorf("AuthMiddleware() status = %d, want %d", res.Code, testCase.expectedStatus)
+			}
+		})
+	}
+
+	if lastUsedUpdates != 0 {
+		t.Errorf("AuthMiddleware() recorded the use of a deleted token %d times", lastUsedUpdates)
+	}
+}
+
+func TestAuthMiddlewareRouteAccess(t *testing.T) {
+	originalTokenManager := tokenManager
+	originalTokenService := tokenService
+	originalUserService := userService
+	defer func() {
+		tokenManager = originalTokenManager
+		tokenService = originalTokenService
+		userService = originalUserService
+	}()
+
+	tokenManager = &mockTokenManager{
+		GetClaimsFunc: func(token string) (jwt.MapClaims, error) {
+			return jwt.MapClaims{"sub": float64(1), auth.KindClaim: float64(models.Access)}, nil
+		},
+	}
+	tokenService = &mockTokenService{
+		GetTokenByValueFunc: func(token string) (*models.Token, error) { return &models.Token{TokenValue: token}, nil },
+	}
+
+	nextHandler := http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		res.WriteHeader(http.StatusOK)
+	})
+
+	tests := []struct {
+		name           string
+		userRole       models.UserRole
+		reqMethod      string
+		reqURLPath     string
+		expectedStatus int
+	}{
+		{"Standard user cannot create users", models.Standard, http.MethodPost, "/api/v1/users", http.StatusForbidden},
+		{"Admin can create users", models.Admin, http.MethodPost, "/api/v1/users", http.StatusOK},
+		{"Standard user cannot delete users", models.Standard, http.MethodDelete, "/api/v1/users/1", http.StatusForbidden},
+		{"Standard user can get users", models.Standard, http.MethodGet, "/api/v1/users/1", http.StatusOK},
+		{"Standard user cannot use admin routes", models.Standard, http.MethodGet, "/api/v1/admin/users", http.StatusForbidden},
+		{"Standard user cannot get platform stats", models.Standard, http.MethodGet, "/api/v1/admin/stats", http.StatusForbidden},
+		{"Standard user cannot get profiles", models.Standard, http.MethodGet, "/api/v1/debug/pprof/heap", http.StatusForbidden},
+		{"Admin can get profiles", models.Admin, http.MethodGet, "/api/v1/debug/pprof/heap", http.StatusOK},
+		{"Standard user can get token info", models.Standard, http.MethodGet, "/api/v1/auth/token-info", http.StatusOK},
+		{"Standard user can delete user diary entries", models.Standard, http.MethodDelete, "/api/v1/diaryEntries/user/1", http.StatusOK},
+		{"Standard user cannot delete a diary entry", models.Standard, http.MethodDelete, "/api/v1/diaryEntries/1", http.StatusForbidden},
+	}
+
+	for _, testCase := range tests {
+		t.Run(testCase.name, func(t *testing.T) {
+			userService = &mockUserService{
+				GetUserByIdFunc: func(id uint) (*models.User, error) { return &models.User{Id: id, Role: testCase.userRole}, nil },
+			}
+
+			req := httptest.NewRequest(testCase.reqMethod, testCase.reqURLPath, nil)
+			req.Header.Set("Authorization", "Bearer user.token")
+			res := httptest.NewRecorder()
+
+			AuthMiddleware(nextHandler).ServeHTTP(res, req)
+
+			if res.Code != testCase.expectedStatus {
+				t.Errorf("AuthMiddleware() status = %d, want %d", res.Code, testCase.expectedStatus)
+			}
+		})
+	}
+}
+
+func TestAuthMiddlewareTokenKind(t *testing.T) {
+	originalTokenManager := tokenManager
+	originalTokenService := tokenService
+	defer func() {
+		tokenManager = originalTokenManager
+		tokenService = originalTokenService
+	}()
+
+	tokenManager = auth.GetTokenManager()
+	user := models.User{Id: 1}
+
+	nextHandler := http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		res.WriteHeader(http.StatusOK)
+	})
+
+	tests := []struct {
+		name           string
+		tokenKind      models.TokenKind
+		expectedStatus int
+	}{
+		{"Access token is accepted", models.Access, http.StatusOK},
+		{"Refresh token is rejected", models.Refresh, http.StatusUnauthorized},
+	}
+
+	for _, testCase := range tests {
+		t.Run(testCase.name, func(t *testing.T) {
+			tokenString, generateErr := tokenManager.GenerateToken(user, testCase.tokenKind)
+			if generateErr != nil {
+				t.Fatal(generateErr)
+			}
+
+			tokenService = &mockTokenService{
+				GetTokenByValueFunc: func(token string) (*models.Token, error) {
+					return &models.Token{TokenValue: tokenString, UserRefer: user.Id, Kind: testCase.tokenKind}, nil
+				},
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/diaryEntries/user/1", nil)
+			req.Header.Set("Authorization", "Bearer "+tokenString)
+			res := httptest.NewRecorder()
+
+			AuthMiddleware(nextHandler).ServeHTTP(res, req)
+
+			if res.Code != testCase.expectedStatus {
+				t.Errorf("AuthMiddleware() status = %d, want %d", res.Code, testCase.expectedStatus)
+			}
+		})
+	}
+}
@@ -1,14 +1,26 @@
 package api
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"net/http"
-
+	"net/http/pprof"
 	"os"
+	"os/signal"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
 
+	"github.com/adfer-dev/analock-api/config"
 	"github.com/adfer-dev/analock-api/constants"
+	"github.com/adfer-dev/analock-api/database"
 	"github.com/adfer-dev/analock-api/docs"
 	"github.com/adfer-dev/analock-api/handlers"
+	"github.com/adfer-dev/analock-api/jobs"
+	"github.com/adfer-dev/analock-api/services"
+	"github.com/adfer-dev/analock-api/utils"
 	"github.com/gorilla/mux"
 	"github.com/rs/cors"
 	httpSwagger "github.com/swaggo/http-swagger"
@@ -16,51 +28,236 @@ import (
 
 type APIServer struct {
 	Port   int
+	Config *config.Config
 	router *mux.Router
 }
 
 func (server *APIServer) Run() error {
+	// The server does not start without a reachable database
+	if _, connectErr := database.Connect(); connectErr != nil {
+		return fmt.Errorf("database is unreachable: %w", connectErr)
+	}
+
 	server.router = mux.NewRouter()
 
 	// Swagger documentation
+	if server.Config.Swagger.Enabled {
+		server.initSwagger()
+	}
+
+	// Profiling, for admins only as no route access rule matches it
+	if server.Config.PprofEnabled {
+		server.initPprof()
+	}
+
+	// CORS config
+	corsHandler := newCorsHandler(server.router)
+
+	// Middlewares
+	server.router.Use(SlowRequestMiddleware, ServerTimeMiddleware, ClientVersionMiddleware, ReadOnlyMiddleware, AuthMiddleware, VerifiedEmailMiddleware, ValidatePathParams, UserOwnershipMiddleware)
+
+	server.initRoutes()
+	server.initErrorHandlers()
+
+	scheduler := jobs.GetSchedulerInstance()
+
+	if jobsErr := server.initJobs(scheduler); jobsErr != nil {
+		return jobsErr
+	}
+
+	scheduler.Start()
+
+	httpServer := newHttpServer(fmt.Sprintf(":%d", server.Port), corsHandler, server.Config.Server)
+	shutdownErr := make(chan error, 1)
+
+	go func() {
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+		<-signals
+
+		utils.GetCustomLogger().Info("Shutting down server...")
+		shutdownErr <- shutdown(httpServer, scheduler, server.Config.Server.ShutdownTimeout)
+	}()
+
+	if listenErr := httpServer.ListenAndServe(); !errors.Is(listenErr, http.ErrServerClosed) {
+		scheduler.Stop()
+		return listenErr
+	}
+
+	return <-shutdownErr
+}
+
+// Stops the scheduled jobs and shuts the HTTP server down, letting in-flight requests finish within the given timeout.
+func shutdown(httpServer *http.Server, scheduler *jobs.Scheduler, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	shutdownErr := httpServer.Shutdown(ctx)
+	scheduler.Stop()
+
+	return shutdownErr
+}
+
+// Registers the periodic jobs enabled in the config.
+func (server *APIServer) initJobs(scheduler *jobs.Scheduler) error {
+	if server.Config.OrphanSweeper.Enabled {
+		return scheduler.Register(services.NewOrphanRegistrationSweepJob())
+	}
+
+	return nil
+}
+
+// Builds the HTTP server listening at the given address, with the timeouts of the given config,
+// so slow or hung connections cannot hold the server resources forever.
+func newHttpServer(address string, handler http.Handler, serverConfig config.ServerConfig) *http.Server {
+	return &http.Server{
+		Addr:         address,
+		Handler:      handler,
+		ReadTimeout:  serverConfig.ReadTimeout,
+		WriteTimeout: serverConfig.WriteTimeout,
+		IdleTimeout:  serverConfig.IdleTimeout,
+	}
+}
+
+// Methods preflight requests can be answered for, when the requested route supports them.
+var corsMethods = []string{http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodDelete}
 
-	// set swagger host from environment
-	environment := os.Getenv("API_ENVIRONMENT")
-	if environment != "local" {
-		docs.SwaggerInfo.Host = os.Getenv("API_PROD_URL_HOST")
+// Wraps the given router with the CORS config.
+// Preflight requests are answered with the methods the requested route supports, instead of all the methods the API uses.
+func newCorsHandler(router *mux.Router) http.Handler {
+	return cors.New(cors.Options{
+		AllowedOrigins:     []string{"*"},
+		AllowCredentials:   true,
+		AllowedHeaders:     []string{"Authorization", "Content-Type"},
+		AllowedMethods:     corsMethods,
+		ExposedHeaders:     []string{constants.ServerTimeHeader, constants.NewAccessTokenHeader},
+		MaxAge:             86400,
+		OptionsPassthrough: true,
+		Debug:              false,
+	}).Handler(newPreflightHandler(router))
+}
+
+// Answers the preflight requests the CORS handler lets through, and passes any other request to the router.
+// If the route does not support the requested method, the preflight fails without CORS headers.
+func newPreflightHandler(router *mux.Router) http.Handler {
+	return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		requestedMethod := req.Header.Get("Access-Control-Request-Method")
+
+		if req.Method != http.MethodOptions || len(requestedMethod) == 0 {
+			router.ServeHTTP(res, req)
+			return
+		}
+
+		routeMethods := getRouteMethods(router, req)
+
+		if len(routeMethods) == 0 {
+			clearCorsHeaders(res)
+			utils.ParseToHandlerFunc(handleNotFound)(res, req)
+			return
+		}
+
+		res.Header().Set("Allow", strings.Join(routeMethods, ", "))
+
+		if !slices.Contains(routeMethods, requestedMethod) {
+			clearCorsHeaders(res)
+			utils.ParseToHandlerFunc(handleMethodNotAllowed)(res, req)
+			return
+		}
+
+		if len(res.Header().Get("Access-Control-Allow-Origin")) > 0 {
+			res.Header().Set("Access-Control-Allow-Methods", strings.Join(routeMethods, ", "))
+		}
+
+		res.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// Gets the CORS methods the route matching the path of the given request supports.
+func getRouteMethods(router *mux.Router, req *http.Request) []string {
+	routeMethods := []string{}
+
+	for _, method := range corsMethods {
+		methodReq := req.Clone(req.Context())
+		methodReq.Method = method
+		var match mux.RouteMatch
+
+		if router.Match(methodReq, &match) && match.MatchErr == nil {
+			routeMethods = append(routeMethods, method)
+		}
+	}
+
+	return routeMethods
+}
+
+// Removes the CORS headers already set on the response, so the preflight request fails.
+func clearCorsHeaders(res http.ResponseWriter) {
+	for header := range res.Header() {
+		if strings.HasPrefix(header, "Access-Control-") {
+			res.Header().Del(header)
+		}
+	}
+}
+
+// Makes unmatched routes and disallowed methods respond with a JSON HttpError, as the rest of the API does.
+func (server *APIServer) initErrorHandlers() {
+	server.router.NotFoundHandler = utils.ParseToHandlerFunc(handleNotFound)
+	server.router.MethodNotAllowedHandler = utils.ParseToHandlerFunc(handleMethodNotAllowed)
+}
+
+func handleNotFound(res http.ResponseWriter, req *http.Request) error {
+	return utils.WriteError(res, http.StatusNotFound, fmt.Sprintf("route %s not found.", req.URL.Path))
+}
+
+func handleMethodNotAllowed(res http.ResponseWriter, req *http.Request) error {
+	return utils.WriteError(res, http.StatusMethodNotAllowed, fmt.Sprintf("method %s not allowed on route %s.", req.Method, req.URL.Path))
+}
+
+// Sets swagger host and base path from the config and mounts the Swagger UI.
+func (server *APIServer) initSwagger() {
+	if host := server.Config.Swagger.Host; len(host) > 0 {
+		docs.SwaggerInfo.Host = host
+	} else if !server.Config.IsLocal() {
+		docs.SwaggerInfo.Host = server.Config.ProdUrlHost
 	} else {
 		docs.SwaggerInfo.Host = fmt.Sprintf("%s:%d", "localhost", server.Port)
 	}
 
+	if basePath := server.Config.Swagger.BasePath; len(basePath) > 0 {
+		docs.SwaggerInfo.BasePath = basePath
+	}
+
 	server.router.PathPrefix(constants.ApiV1UrlRoot + "/swagger/").Handler(httpSwagger.Handler(
 		httpSwagger.URL(constants.ApiV1UrlRoot+"/swagger/doc.json"),
 		httpSwagger.DeepLinking(true),
 		httpSwagger.DocExpansion("none"),
 		httpSwagger.DomID("swagger-ui"),
 	))
+}
 
-	// CORS config
-	corsHandler := cors.New(cors.Options{
-		AllowedOrigins:   []string{"*"},
-		AllowCredentials: true,
-		AllowedHeaders:   []string{"Authorization", "Content-Type"},
-		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE"},
-		MaxAge:           86400,
-		Debug:            false,
-	}).Handler(server.router)
-
-	// Middlewares
-	server.router.Use(AuthMiddleware, ValidatePathParams, UserOwnershipMiddleware)
-
-	server.initRoutes()
+// Mounts the pprof handlers under /api/v1/debug/pprof/, with the pprof write timeout of the config.
+// The CPU profile and trace handlers still push the deadline back by the time they capture for.
+// The API root is stripped from the path, as the pprof index serves the profiles by their path under /debug/pprof/.
+func (server *APIServer) initPprof() {
+	pprofMux := http.NewServeMux()
+	pprofMux.HandleFunc("/debug/pprof/", pprof.Index)
+	pprofMux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	pprofMux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	pprofMux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	pprofMux.HandleFunc("/debug/pprof/trace", pprof.Trace)
 
-	return http.ListenAndServe(fmt.Sprintf(":%d", server.Port), corsHandler)
+	server.router.PathPrefix(constants.ApiV1UrlRoot + "/debug/pprof/").Handler(utils.WithWriteTimeout(
+		config.Get().Server.PprofWriteTimeout,
+		http.StripPrefix(constants.ApiV1UrlRoot, pprofMux).ServeHTTP,
+	))
 }
 
 func (server *APIServer) initRoutes() {
+	handlers.InitRootRoutes(server.router)
 	handlers.InitUserRoutes(server.router)
 	handlers.InitAuthRoutes(server.router)
 	handlers.InitDiaryEntryRoutes(server.router)
 	handlers.InitActivityRegistrationRoutes(server.router)
 	handlers.InitInternetArchiveRoutes(server.router)
+	handlers.InitAdminRoutes(server.router)
+	handlers.InitTimeRoutes(server.router)
 }
@@ -0,0 +1,199 @@
+package api
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/adfer-dev/analock-api/config"
+	"github.com/adfer-dev/analock-api/models"
+	"github.com/gorilla/mux"
+)
+
+func TestSwaggerRoutes(t *testing.T) {
+	t.Run("Mounted when initialized", func(t *testing.T) {
+		server := &APIServer{Port: 3000, Config: &config.Config{Environment: "local"}, router: mux.NewRouter()}
+		server.initSwagger()
+
+		res := httptest.NewRecorder()
+		server.router.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/api/v1/swagger/index.html", nil))
+
+		if res.Code != http.StatusOK {
+			t.Errorf("swagger status = %d, want %d", res.Code, http.StatusOK)
+		}
+	})
+
+	t.Run("Not found when not initialized", func(t *testing.T) {
+		server := &APIServer{Port: 3000, router: mux.NewRouter()}
+
+		res := httptest.NewRecorder()
+		server.router.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/api/v1/swagger/index.html", nil))
+
+		if res.Code != http.StatusNotFound {
+			t.Errorf("swagger status = %d, want %d", res.Code, http.StatusNotFound)
+		}
+	})
+}
+
+func TestPprofRoutes(t *testing.T) {
+	t.Run("Mounted when initialized", func(t *testing.T) {
+		server := &APIServer{Port: 3000, router: mux.NewRouter()}
+		server.initPprof()
+
+		for _, path := range []string{"/api/v1/debug/pprof/", "/api/v1/debug/pprof/heap?debug=1", "/api/v1/debug/pprof/cmdline"} {
+			res := httptest.NewRecorder()
+			server.router.ServeHTTP(res, httptest.NewRequest(http.MethodGet, path, nil))
+
+			if res.Code != http.StatusOK {
+				t.Errorf("pprof %s status = %d, want %d", path, res.Code, http.StatusOK)
+			}
+		}
+	})
+
+	t.Run("Outlast the server write timeout", func(t *testing.T) {
+		t.Setenv("API_SERVER_PPROF_WRITE_TIMEOUT", "1m")
+
+		server := &APIServer{Port: 3000, router: mux.NewRouter()}
+		server.initPprof()
+		// Stands for a dump that takes longer to build than the server write timeout.
+		server.router.Use(func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+				time.Sleep(300 * time.Millisecond)
+				next.ServeHTTP(res, req)
+			})
+		})
+		httpServer := httptest.NewUnstartedServer(server.router)
+		httpServer.Config.WriteTimeout = 100 * time.Millisecond
+		httpServer.Start()
+		defer httpServer.Close()
+
+		res, getErr := http.Get(httpServer.URL + "/api/v1/debug/pprof/goroutine?debug=1")
+
+		if getErr != nil {
+			t.Fatalf("pprof goroutine request failed: %s", getErr)
+		}
+		defer res.Body.Close()
+
+		dump, readErr := io.ReadAll(res.Body)
+
+		if res.StatusCode != http.StatusOK || readErr != nil || len(dump) == 0 {
+			t.Errorf("pprof goroutine status = %d, read error = %v, %d bytes, want a whole dump", res.StatusCode, readErr, len(dump))
+		}
+	})
+
+	t.Run("Not found when not initialized", func(t *testing.T) {
+		server := &APIServer{Port: 3000, router: mux.NewRouter()}
+		server.initErrorHandlers()
+
+		res := httptest.NewRecorder()
+		server.router.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/api/v1/debug/pprof/heap", nil))
+
+		if res.Code != http.StatusNotFound {
+			t.Errorf("pprof status = %d, want %d", res.Code, http.StatusNotFound)
+		}
+	})
+}
+
+func TestErrorHandlers(t *testing.T) {
+	server := &APIServer{Port: 3000, router: mux.NewRouter()}
+	server.router.HandleFunc("/api/v1/time", func(res http.ResponseWriter, req *http.Request) {}).Methods(http.MethodGet)
+	server.initErrorHandlers()
+	handler := newCorsHandler(server.router)
+
+	tests := []struct {
+		name           string
+		method         string
+		path           string
+		expectedStatus int
+	}{
+		{"Unknown path", http.MethodGet, "/api/v1/unknown", http.StatusNotFound},
+		{"Disallowed method", http.MethodDelete, "/api/v1/time", http.StatusMethodNotAllowed},
+	}
+
+	for _, testCase := range tests {
+		t.Run(testCase.name, func(t *testing.T) {
+			req := httptest.NewRequest(testCase.method, testCase.path, nil)
+			req.Header.Set("Origin", "http://example.com")
+			res := httptest.NewRecorder()
+
+			handler.ServeHTTP(res, req)
+
+			if res.Code != testCase.expectedStatus {
+				t.Errorf("status = %d, want %d", res.Code, testCase.expectedStatus)
+			}
+
+			if contentType := res.Header().Get("Content-Type"); contentType != "application/json" {
+				t.Errorf("content type = %q, want %q", contentType, "application/json")
+			}
+
+			if allowedOrigin := res.Header().Get("Access-Control-Allow-Origin"); allowedOrigin == "" {
+				t.Error("CORS headers were not set")
+			}
+
+			httpError := &models.HttpError{}
+
+			if decodeErr := json.NewDecoder(res.Body).Decode(httpError); decodeErr != nil {
+				t.Fatalf("could not decode response body: %s", decodeErr.Error())
+			}
+
+			if httpError.Status != testCase.expectedStatus {
+				t.Errorf("body status = %d, want %d", httpError.Status, testCase.expectedStatus)
+			}
+		})
+	}
+}
+
+func TestCorsPreflight(t *testing.T) {
+	server := &APIServer{Port: 3000, router: mux.NewRouter()}
+	emptyHandler := func(res http.ResponseWriter, req *http.Request) {}
+	server.router.HandleFunc("/api/v1/auth/authenticate", emptyHandler).Methods(http.MethodPost)
+	server.router.HandleFunc("/api/v1/internetArchive/books/{bookId}/download", emptyHandler).Methods(http.MethodGet)
+	server.router.HandleFunc("/api/v1/internetArchive/books/{bookId}/download", emptyHandler).Methods(http.MethodHead)
+	server.initErrorHandlers()
+	handler := newCorsHandler(server.router)
+
+	tests := []struct {
+		name                   string
+		path                   string
+		requestedMethod        string
+		expectedStatus         int
+		expectedAllowedMethods string
+	}{
+		{"Supported method", "/api/v1/auth/authenticate", http.MethodPost, http.StatusNoContent, http.MethodPost},
+		{"Route with several methods", "/api/v1/internetArchive/books/book/download", http.MethodGet, http.StatusNoContent, "GET, HEAD"},
+		{"Unsupported method", "/api/v1/auth/authenticate", http.MethodDelete, http.StatusMethodNotAllowed, ""},
+		{"Unknown path", "/api/v1/unknown", http.MethodGet, http.StatusNotFound, ""},
+	}
+
+	for _, testCase := range tests {
+		t.Run(testCase.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodOptions, testCase.path, nil)
+			req.Header.Set("Origin", "http://example.com")
+			req.Header.Set("Access-Control-Request-Method", testCase.requestedMethod)
+			res := httptest.NewRecorder()
+
+			handler.ServeHTTP(res, req)
+
+			if res.Code != testCase.expectedStatus {
+				t.Errorf("status = %d, want %d", res.Code, testCase.expectedStatus)
+			}
+
+			if allowedMethods := res.Header().Get("Access-Control-Allow-Methods"); allowedMethods != testCase.expectedAllowedMethods {
+				t.Errorf("allowed methods = %q, want %q", allowedMethods, testCase.expectedAllowedMethods)
+			}
+
+			allowedOrigin := res.Header().Get("Access-Control-Allow-Origin")
+
+			if testCase.expectedStatus == http.StatusNoContent && allowedOrigin == "" {
+				t.Error("CORS headers were not set")
+			}
+
+			if testCase.expectedStatus != http.StatusNoContent && allowedOrigin != "" {
+				t.Error("CORS headers were set on a failed preflight")
+			}
+		})
+	}
+}
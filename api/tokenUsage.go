@@ -0,0 +1,69 @@
+package api
+
+import (
+	"sync"
+	"time"
+
+	"github.com/adfer-dev/analock-api/constants"
+	"github.com/adfer-dev/analock-api/utils"
+)
+
+// Records when tokens are used, writing the time to the database at most once per debounce interval per token.
+type tokenUsageRecorder struct {
+	lock sync.Mutex
+	// Time each token was last written at. Writes older than the debounce interval
+	// no longer hold back the next one, so they are swept at most once per interval.
+	lastWrites map[uint]time.Time
+	lastSweep  time.Time
+	debounce   time.Duration
+	now        func() time.Time
+}
+
+func newTokenUsageRecorder(debounce time.Duration) *tokenUsageRecorder {
+	return &tokenUsageRecorder{
+		lastWrites: make(map[uint]time.Time),
+		debounce:   debounce,
+		now:        time.Now,
+	}
+}
+
+var tokenUsage = newTokenUsageRecorder(constants.TokenLastUsedDebounce)
+
+// Stores the current time, in Unix seconds, as the last use of the token with the given id,
+// unless it was already stored less than the debounce interval ago.
+// Failing to store it does not fail the request, so errors are only logged.
+func (recorder *tokenUsageRecorder) record(tokenId uint) {
+	now := recorder.now()
+
+	recorder.lock.Lock()
+	lastWrite, written := recorder.lastWrites[tokenId]
+
+	if written && now.Sub(lastWrite) < recorder.debounce {
+		recorder.lock.Unlock()
+		return
+	}
+
+	recorder.lastWrites[tokenId] = now
+	recorder.sweep(now)
+	recorder.lock.Unlock()
+
+	if updateErr := tokenService.UpdateTokenLastUsedAt(tokenId, now.Unix()); updateErr != nil {
+		utils.GetCustomLogger().Errorf("Error updating last use of token %d: %s\n", tokenId, updateErr.Error())
+	}
+}
+
+// Deletes the writes older than the debounce interval, unless they were already swept less than an interval ago.
+// Must be called holding the lock.
+func (recorder *tokenUsageRecorder) sweep(now time.Time) {
+	if now.Sub(recorder.lastSweep) < recorder.debounce {
+		return
+	}
+
+	for tokenId, lastWrite := range recorder.lastWrites {
+		if now.Sub(lastWrite) >= recorder.debounce {
+			delete(recorder.lastWrites, tokenId)
+		}
+	}
+
+	recorder.lastSweep = now
+}
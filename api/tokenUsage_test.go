@@ -0,0 +1,104 @@
+package api
+
+import (
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/adfer-dev/analock-api/auth"
+	"github.com/adfer-dev/analock-api/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckAuthRecordsTokenUseDebounced(t *testing.T) {
+	originalTokenManager := tokenManager
+	originalTokenService := tokenService
+	originalTokenUsage := tokenUsage
+	defer func() {
+		tokenManager = originalTokenManager
+		tokenService = originalTokenService
+		tokenUsage = originalTokenUsage
+	}()
+
+	tokenManager = auth.GetTokenManager()
+	user := models.User{Id: 1}
+	tokenString, generateErr := tokenManager.GenerateToken(user, models.Access)
+	if generateErr != nil {
+		t.Fatal(generateErr)
+	}
+
+	var writesLock sync.Mutex
+	var writes []int64
+	tokenService = &mockTokenService{
+		GetTokenByValueFunc: func(token string) (*models.Token, error) {
+			return &models.Token{Id: 3, TokenValue: tokenString, UserRefer: user.Id, Kind: models.Access}, nil
+		},
+		UpdateTokenLastUsedAtFunc: func(id uint, lastUsedAt int64) error {
+			writesLock.Lock()
+			defer writesLock.Unlock()
+			writes = append(writes, lastUsedAt)
+			return nil
+		},
+	}
+
+	now := time.Unix(1_000, 0)
+	tokenUsage = newTokenUsageRecorder(time.Minute)
+	tokenUsage.now = func() time.Time { return now }
+
+	authorize := func() {
+		req := httptest.NewRequest("GET", "/api/v1/diaryEntries/user/1", nil)
+		req.Header.Set("Authorization", "Bearer "+tokenString)
+		assert.NoError(t, checkAuth(httptest.NewRecorder(), req))
+	}
+
+	// Test case: Rapid concurrent requests only write the last use once
+	var waitGroup sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		waitGroup.Add(1)
+		go func() {
+			defer waitGroup.Done()
+			authorize()
+		}()
+	}
+	waitGroup.Wait()
+
+	assert.Equal(t, []int64{1_000}, writes)
+
+	// Test case: Requests within the debounce interval do not write
+	now = now.Add(59 * time.Second)
+	authorize()
+
+	assert.Len(t, writes, 1)
+
+	// Test case: The first request after the debounce interval writes again
+	now = now.Add(time.Second)
+	authorize()
+
+	assert.Equal(t, []int64{1_000, 1_060}, writes)
+}
+
+func TestTokenUsageRecorderSweepsOldWrites(t *testing.T) {
+	originalTokenService := tokenService
+	defer func() { tokenService = originalTokenService }()
+
+	tokenService = &mockTokenService{
+		UpdateTokenLastUsedAtFunc: func(id uint, lastUsedAt int64) error { return nil },
+	}
+
+	now := time.Unix(1_000, 0)
+	recorder := newTokenUsageRecorder(time.Minute)
+	recorder.now = func() time.Time { return now }
+
+	for tokenId := uint(1); tokenId <= 100; tokenId++ {
+		recorder.record(tokenId)
+	}
+
+	assert.Len(t, recorder.lastWrites, 100)
+
+	// Test case: Writes older than the debounce interval are dropped on the next write
+	now = now.Add(time.Minute)
+	recorder.record(101)
+
+	assert.Equal(t, map[uint]time.Time{101: now}, recorder.lastWrites)
+}
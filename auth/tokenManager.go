@@ -8,9 +8,16 @@ import (
 	"github.com/golang-jwt/jwt"
 )
 
+// Name of the claim holding the kind of the token
+const KindClaim = "kind"
+
+// Name of the claim holding the id of the admin an impersonation token was issued to
+const ImpersonatedByClaim = "impersonatedBy"
+
 // TokenManager interface
 type TokenManager interface {
 	GenerateToken(user models.User, kind models.TokenKind) (string, error)
+	GenerateImpersonationToken(user models.User, adminId uint, ttl time.Duration) (string, error)
 	ValidateToken(tokenString string) error
 	GetClaims(tokenString string) (jwt.MapClaims, error)
 }
@@ -20,6 +27,8 @@ type TokenManagerImpl struct {
 	secretKeyProvider func() ([]byte, error)
 }
 
+var _ TokenManager = (*TokenManagerImpl)(nil)
+
 var tokenManagerInstance *TokenManagerImpl
 
 func GetTokenManager() *TokenManagerImpl {
@@ -64,6 +73,7 @@ func (d *TokenManagerImpl) GenerateToken(user models.User, kind models.TokenKind
 
 	claims["sub"] = user.Id
 	claims["exp"] = expiration
+	claims[KindClaim] = kind
 
 	tokenString, err := token.SignedString(secretKey)
 
@@ -73,6 +83,26 @@ func (d *TokenManagerImpl) GenerateToken(user models.User, kind models.TokenKind
 	return tokenString, nil
 }
 
+// Generates an access token of the given user for the given admin, expiring after the given time.
+// The token holds the admin id in the impersonatedBy claim, so it can be told apart from the user's own tokens.
+func (d *TokenManagerImpl) GenerateImpersonationToken(user models.User, adminId uint, ttl time.Duration) (string, error) {
+	secretKey, envErr := d.secretKeyProvider()
+
+	if envErr != nil {
+		return "", envErr
+	}
+
+	token := jwt.New(jwt.SigningMethodHS256)
+	claims := token.Claims.(jwt.MapClaims)
+
+	claims["sub"] = user.Id
+	claims["exp"] = time.Now().Add(ttl).Unix()
+	claims[KindClaim] = models.Access
+	claims[ImpersonatedByClaim] = adminId
+
+	return token.SignedString(secretKey)
+}
+
 func (d *TokenManagerImpl) ValidateToken(tokenString string) error {
 	secretKey, envErr := d.secretKeyProvider()
 
@@ -127,3 +157,27 @@ func (d *TokenManagerImpl) GetClaims(tokenString string) (jwt.MapClaims, error)
 
 	return claims, nil
 }
+
+// GetTokenExpiration returns the expiration time stored in the given token claims.
+// It returns false if the claim is missing or its format is not correct.
+func GetTokenExpiration(claims jwt.MapClaims) (time.Time, bool) {
+	expiration, ok := claims["exp"].(float64)
+
+	if !ok {
+		return time.Time{}, false
+	}
+
+	return time.Unix(int64(expiration), 0), true
+}
+
+// GetTokenKind returns the kind stored in the given token claims.
+// It returns 0 if the claim is missing or its format is not correct.
+func GetTokenKind(claims jwt.MapClaims) models.TokenKind {
+	kind, ok := claims[KindClaim].(float64)
+
+	if !ok {
+		return 0
+	}
+
+	return models.TokenKind(kind)
+}
@@ -43,6 +43,7 @@ func TestDefaultTokenManager_GenerateToken(t *testing.T) {
 		exp, ok := claims["exp"].(float64)
 		assert.True(t, ok)
 		assert.InDelta(t, time.Now().Add(1*time.Hour).Unix(), int64(exp), 5)
+		assert.Equal(t, models.Access, GetTokenKind(claims))
 	})
 
 	t.Run("generate_refresh_token", func(t *testing.T) {
@@ -62,6 +63,7 @@ func TestDefaultTokenManager_GenerateToken(t *testing.T) {
 		exp, ok := claims["exp"].(float64)
 		assert.True(t, ok)
 		assert.InDelta(t, time.Now().Add(24*7*time.Hour).Unix(), int64(exp), 5)
+		assert.Equal(t, models.Refresh, GetTokenKind(claims))
 	})
 
 	t.Run("error_from_get_secret_key", func(t *testing.T) {
@@ -72,6 +74,27 @@ func TestDefaultTokenManager_GenerateToken(t *testing.T) {
 	})
 }
 
+func TestDefaultTokenManager_GenerateImpersonationToken(t *testing.T) {
+	manager := newDefaultTokenManagerWithProvider(mockSecretKeyProvider)
+	user := models.User{Id: 1, Email: "test@example.com"}
+
+	tokenString, err := manager.GenerateImpersonationToken(user, 7, 15*time.Minute)
+	assert.NoError(t, err)
+
+	claims, claimsErr := manager.GetClaims(tokenString)
+	assert.NoError(t, claimsErr)
+	assert.Equal(t, user.Id, uint(claims["sub"].(float64)))
+	assert.Equal(t, uint(7), uint(claims[ImpersonatedByClaim].(float64)))
+	assert.InDelta(t, time.Now().Add(15*time.Minute).Unix(), int64(claims["exp"].(float64)), 5)
+	// Test case: Impersonation tokens are always access tokens
+	assert.Equal(t, models.Access, GetTokenKind(claims))
+
+	// Test case: The user's own tokens have no impersonatedBy claim
+	accessToken, _ := manager.GenerateToken(user, models.Access)
+	accessClaims, _ := manager.GetClaims(accessToken)
+	assert.NotContains(t, accessClaims, ImpersonatedByClaim)
+}
+
 func TestDefaultTokenManager_ValidateToken(t *testing.T) {
 	manager := newDefaultTokenManagerWithProvider(mockSecretKeyProvider)
 	user := models.User{Id: 1, Email: "test@example.com"}
@@ -0,0 +1,630 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/adfer-dev/analock-api/constants"
+	"github.com/adfer-dev/analock-api/models"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	DefaultDatabaseConnectionRetries       = 5
+	DefaultDatabaseConnectionRetryInterval = 1 * time.Second
+	DefaultInternetArchiveUrl              = "https://archive.org"
+	DefaultCircuitBreakerFailureThreshold  = 5
+	DefaultCircuitBreakerFailureWindow     = time.Minute
+	DefaultCircuitBreakerCooldown          = 30 * time.Second
+	DefaultOrphanSweepInterval             = 24 * time.Hour
+	DefaultRefreshCookieSameSite           = "strict"
+	DefaultStreakMilestones                = "7,30,100,365"
+	DefaultOutboundUserAgent               = "AnalockAPI/1.0 (+https://github.com/adfer-dev/analock-api)"
+	// Time allowed to read a whole request, headers and body included.
+	DefaultServerReadTimeout = 15 * time.Second
+	// Time allowed to write a response, counted from the end of the request headers.
+	DefaultServerWriteTimeout = 30 * time.Second
+	// Time a keep-alive connection is kept open waiting for the next request.
+	DefaultServerIdleTimeout = 2 * time.Minute
+	// Time allowed to write a book download, which streams whole EPUB files.
+	DefaultServerDownloadWriteTimeout = 10 * time.Minute
+	// Time allowed to write a pprof profile, which captures 30 seconds of CPU usage by default.
+	DefaultServerPprofWriteTimeout = 2 * time.Minute
+	// Time in-flight requests are given to finish when the server shuts down.
+	DefaultServerShutdownTimeout = 15 * time.Second
+	// Longest random delay added to each scheduled job run.
+	DefaultJobsMaxJitter = 30 * time.Second
+	// Time the access tokens issued to admins impersonating a user are valid for.
+	DefaultImpersonationTokenTtl = 15 * time.Minute
+	// Longest diary entry title, in characters.
+	DefaultMaxDiaryEntryTitleLength = 200
+	// Highest page of the Internet Archive book search results that can be requested.
+	DefaultInternetArchiveMaxSearchPage = 100
+	InfoLogLevel                        = "info"
+	DebugLogLevel                       = "debug"
+	localEnvironment                    = "local"
+)
+
+// Config holds the settings of the API, loaded from env variables at startup.
+type Config struct {
+	Environment string
+	// Host the API is served from outside the local environment.
+	ProdUrlHost                      string
+	Server                           ServerConfig
+	Database                         DatabaseConfig
+	Cache                            CacheConfig
+	Swagger                          SwaggerConfig
+	InternetArchive                  InternetArchiveConfig
+	OrphanSweeper                    OrphanSweeperConfig
+	Signup                           SignupConfig
+	Apple                            AppleConfig
+	MilestoneWebhook                 MilestoneWebhookConfig
+	Outbound                         OutboundConfig
+	Jobs                             JobsConfig
+	ClientVersion                    ClientVersionConfig
+	ReadOnly                         bool
+	ResponseEnvelope                 bool
+	DeduplicateActivityRegistrations bool
+	// Zero means there is no quota.
+	MaxDiaryEntriesPerUser int64
+	// Zero means titles can have any length.
+	MaxDiaryEntryTitleLength uint
+	// Whether users can only write one diary entry per calendar day.
+	DiaryOnePerDay bool
+	// Whether users must have a verified email to write diary entries and activity registrations.
+	RequireVerifiedEmail bool
+	// Whether list endpoints write their items as they are read from the database, instead of caching the whole list.
+	StreamListResponses bool
+	// Either strict or lax.
+	RefreshCookieSameSite string
+	ImpersonationTokenTtl time.Duration
+	// Access tokens used within this time of expiring are renewed. Zero means they are never renewed.
+	AccessTokenRenewalWindow time.Duration
+	// Deleted access tokens are still accepted for GET requests within this time, so in-flight requests are not rejected.
+	// Zero means they are rejected as soon as they are deleted.
+	DeletedTokenGracePeriod time.Duration
+	// Whether the pprof profiles are served to admins under /api/v1/debug/pprof/.
+	PprofEnabled bool
+	// Either info or debug.
+	LogLevel string
+}
+
+type ServerConfig struct {
+	ReadTimeout  time.Duration
+	WriteTimeout time.Duration
+	IdleTimeout  time.Duration
+	// Replaces the write timeout on the book download route. Zero means no timeout.
+	DownloadWriteTimeout time.Duration
+	// Replaces the write timeout on the pprof routes. Zero means no timeout.
+	PprofWriteTimeout time.Duration
+	ShutdownTimeout   time.Duration
+	// Requests taking longer are logged. Zero means no request is logged.
+	SlowRequestThreshold time.Duration
+}
+
+type DatabaseConfig struct {
+	Url                     string
+	Token                   string
+	ConnectionRetries       uint
+	ConnectionRetryInterval time.Duration
+}
+
+type CacheConfig struct {
+	// Either memory or redis.
+	Backend             string
+	RedisUrl            string
+	Expiration          time.Duration
+	EvictionInterval    time.Duration
+	ResourceExpirations map[constants.CacheResource]time.Duration
+	// Time expired entries are kept to be served when refreshing them fails. Zero disables serving stale entries.
+	StaleRetention time.Duration
+}
+
+type SwaggerConfig struct {
+	Enabled  bool
+	Host     string
+	BasePath string
+}
+
+type InternetArchiveConfig struct {
+	BaseUrl string
+	// Zero disables the circuit breaker.
+	BreakerFailureThreshold uint
+	BreakerFailureWindow    time.Duration
+	BreakerCooldown         time.Duration
+	// Whether book registrations are only accepted for identifiers Internet Archive has metadata for.
+	VerifyIdentifiers bool
+	// Highest page of the book search results that can be requested. Zero only allows the first page.
+	MaxSearchPage uint
+	// Collections books can be searched in and retrieved from. Empty means every collection is allowed.
+	AllowedCollections []string
+	// Whether clients can get the Internet Archive URL of book files, to download them directly instead of through the API.
+	DirectDownloadEnabled bool
+}
+
+type JobsConfig struct {
+	// Zero disables the jitter.
+	MaxJitter time.Duration
+}
+
+// ClientVersionConfig holds the oldest client app version the API accepts requests from.
+type ClientVersionConfig struct {
+	// Nil disables the version check.
+	Minimum *models.ClientVersion
+	// URL clients that are too old are told to upgrade from.
+	UpgradeUrl string
+	// Whether requests that do not state their client version are accepted.
+	AllowMissing bool
+}
+
+type OrphanSweeperConfig struct {
+	Enabled  bool
+	Interval time.Duration
+}
+
+type MilestoneWebhookConfig struct {
+	// URL activity milestones are posted to. Empty disables the webhook.
+	Url string
+	// Key the payloads are signed with.
+	Secret string
+	// Streak lengths, in consecutive days with activity, that are notified.
+	StreakMilestones []uint
+}
+
+// OutboundConfig holds how the requests to external services, such as the Internet Archive, are sent.
+type OutboundConfig struct {
+	UserAgent string
+	// Proxy the requests are routed through. If nil, the HTTP_PROXY and HTTPS_PROXY env variables are honored.
+	ProxyUrl *url.URL
+}
+
+type SignupConfig struct {
+	Enabled bool
+	// Codes that let users sign up when signup is disabled.
+	InviteCodes []string
+}
+
+type AppleConfig struct {
+	// Audience Apple ID tokens must be issued for, the app's bundle or services id. Empty disables linking Apple accounts.
+	ClientId string
+}
+
+// Checks whether the API runs in the local environment.
+func (config *Config) IsLocal() bool {
+	return config.Environment == localEnvironment
+}
+
+var current *Config
+
+// Loads the config from env variables, failing with an error that lists every missing or invalid variable.
+func Load() (*Config, error) {
+	config, err := load(os.Getenv)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return config, nil
+}
+
+// Sets the config returned by Get. Must be called at startup, before serving any request.
+func Set(config *Config) {
+	current = config
+}
+
+// Gets the config set at startup.
+// If none was set, as when running tests, it is loaded from env variables on each call, using the defaults for the invalid ones.
+func Get() *Config {
+	if current != nil {
+		return current
+	}
+
+	config, _ := load(os.Getenv)
+
+	return config
+}
+
+// Loads the config from the env variables the given function looks up.
+// The returned config is always usable, holding the defaults in place of the invalid variables.
+func load(getenv func(string) string) (*Config, error) {
+	env := &envReader{getenv: getenv}
+	config := &Config{
+		Environment: env.required("API_ENVIRONMENT"),
+		ProdUrlHost: getenv("API_PROD_URL_HOST"),
+		Server: ServerConfig{
+			ReadTimeout:          env.positiveDuration("API_SERVER_READ_TIMEOUT", DefaultServerReadTimeout),
+			WriteTimeout:         env.positiveDuration("API_SERVER_WRITE_TIMEOUT", DefaultServerWriteTimeout),
+			IdleTimeout:          env.positiveDuration("API_SERVER_IDLE_TIMEOUT", DefaultServerIdleTimeout),
+			DownloadWriteTimeout: env.nonNegativeDuration("API_SERVER_DOWNLOAD_WRITE_TIMEOUT", DefaultServerDownloadWriteTimeout),
+			PprofWriteTimeout:    env.nonNegativeDuration("API_SERVER_PPROF_WRITE_TIMEOUT", DefaultServerPprofWriteTimeout),
+			ShutdownTimeout:      env.positiveDuration("API_SERVER_SHUTDOWN_TIMEOUT", DefaultServerShutdownTimeout),
+			SlowRequestThreshold: time.Duration(env.nonNegativeInt("API_SLOW_REQUEST_MS", 0)) * time.Millisecond,
+		},
+		Database: DatabaseConfig{
+			Url:                     env.required("TURSO_DB_URL"),
+			Token:                   getenv("TURSO_DB_TOKEN"),
+			ConnectionRetries:       env.uint("API_DB_CONNECTION_RETRIES", DefaultDatabaseConnectionRetries),
+			ConnectionRetryInterval: env.duration("API_DB_CONNECTION_RETRY_INTERVAL", DefaultDatabaseConnectionRetryInterval),
+		},
+		Cache: CacheConfig{
+			Backend:             env.oneOf("API_CACHE_BACKEND", constants.MemoryCacheBackend, constants.MemoryCacheBackend, constants.RedisCacheBackend),
+			Expiration:          env.duration("API_CACHE_EXPIRATION", 0),
+			ResourceExpirations: env.resourceExpirations("API_CACHE_RESOURCE_EXPIRATIONS"),
+			StaleRetention:      env.nonNegativeDuration("API_CACHE_STALE_RETENTION", 0),
+		},
+		Swagger: SwaggerConfig{
+			Host:     getenv("API_SWAGGER_HOST"),
+			BasePath: getenv("API_SWAGGER_BASE_PATH"),
+		},
+		InternetArchive: InternetArchiveConfig{
+			BaseUrl:                 env.string("API_IA_BASE_URL", DefaultInternetArchiveUrl),
+			BreakerFailureThreshold: env.uint("API_IA_BREAKER_FAILURE_THRESHOLD", DefaultCircuitBreakerFailureThreshold),
+			BreakerFailureWindow:    env.duration("API_IA_BREAKER_FAILURE_WINDOW", DefaultCircuitBreakerFailureWindow),
+			BreakerCooldown:         env.duration("API_IA_BREAKER_COOLDOWN", DefaultCircuitBreakerCooldown),
+			VerifyIdentifiers:       env.bool("API_IA_VERIFY_IDENTIFIERS", false),
+			MaxSearchPage:           env.uint("API_IA_MAX_SEARCH_PAGE", DefaultInternetArchiveMaxSearchPage),
+			AllowedCollections:      env.list("API_IA_ALLOWED_COLLECTIONS"),
+			DirectDownloadEnabled:   env.bool("API_IA_DIRECT_DOWNLOAD_ENABLED", false),
+		},
+		OrphanSweeper: OrphanSweeperConfig{
+			Enabled:  env.bool("API_ORPHAN_SWEEPER_ENABLED", false),
+			Interval: env.positiveDuration("API_ORPHAN_SWEEPER_INTERVAL", DefaultOrphanSweepInterval),
+		},
+		Signup: SignupConfig{
+			Enabled:     env.bool("API_SIGNUP_ENABLED", true),
+			InviteCodes: env.list("API_SIGNUP_INVITE_CODES"),
+		},
+		Apple: AppleConfig{
+			ClientId: getenv("API_APPLE_CLIENT_ID"),
+		},
+		MilestoneWebhook: MilestoneWebhookConfig{
+			Url:              getenv("API_MILESTONE_WEBHOOK_URL"),
+			Secret:           getenv("API_MILESTONE_WEBHOOK_SECRET"),
+			StreakMilestones: env.uintList("API_MILESTONE_STREAK_DAYS", DefaultStreakMilestones),
+		},
+		Outbound: OutboundConfig{
+			UserAgent: env.string("API_OUTBOUND_USER_AGENT", DefaultOutboundUserAgent),
+			ProxyUrl:  env.url("API_OUTBOUND_PROXY"),
+		},
+		Jobs: JobsConfig{
+			MaxJitter: env.nonNegativeDuration("API_JOBS_MAX_JITTER", DefaultJobsMaxJitter),
+		},
+		ClientVersion: ClientVersionConfig{
+			Minimum:      env.clientVersion("API_MIN_CLIENT_VERSION"),
+			UpgradeUrl:   getenv("API_CLIENT_UPGRADE_URL"),
+			AllowMissing: env.bool("API_CLIENT_VERSION_ALLOW_MISSING", true),
+		},
+		ReadOnly:                         env.bool("API_READ_ONLY", false),
+		ResponseEnvelope:                 env.bool("API_RESPONSE_ENVELOPE", false),
+		DeduplicateActivityRegistrations: env.bool("API_DEDUPLICATE_ACTIVITY_REGISTRATIONS", false),
+		MaxDiaryEntriesPerUser:           env.nonNegativeInt("API_MAX_DIARY_ENTRIES_PER_USER", 0),
+		MaxDiaryEntryTitleLength:         env.uint("API_MAX_DIARY_ENTRY_TITLE_LENGTH", DefaultMaxDiaryEntryTitleLength),
+		DiaryOnePerDay:                   env.bool("API_DIARY_ONE_PER_DAY", false),
+		RequireVerifiedEmail:             env.bool("API_REQUIRE_VERIFIED_EMAIL", false),
+		StreamListResponses:              env.bool("API_STREAM_LIST_RESPONSES", false),
+		RefreshCookieSameSite:            env.oneOf("API_REFRESH_COOKIE_SAME_SITE", DefaultRefreshCookieSameSite, "strict", "lax"),
+		ImpersonationTokenTtl:            env.positiveDuration("API_IMPERSONATION_TOKEN_TTL", DefaultImpersonationTokenTtl),
+		AccessTokenRenewalWindow:         env.nonNegativeDuration("API_ACCESS_TOKEN_RENEWAL_WINDOW", 0),
+		DeletedTokenGracePeriod:          env.nonNegativeDuration("API_DELETED_TOKEN_GRACE_PERIOD", 0),
+		PprofEnabled:                     env.bool("API_PPROF_ENABLED", false),
+		LogLevel:                         env.oneOf("API_LOG_LEVEL", InfoLogLevel, InfoLogLevel, DebugLogLevel),
+	}
+
+	// Swagger UI is enabled by default only in the local environment
+	config.Swagger.Enabled = env.bool("API_SWAGGER_ENABLED", config.IsLocal())
+
+	if len(getenv("API_CACHE_EXPIRATION")) == 0 {
+		env.missing("API_CACHE_EXPIRATION")
+	}
+
+	if config.Cache.Backend == constants.RedisCacheBackend {
+		config.Cache.RedisUrl = env.redisUrl("API_CACHE_REDIS_URL")
+	} else {
+		config.Cache.EvictionInterval = env.positiveDuration("API_CACHE_EVICTION_INTERVAL", 0)
+
+		if len(getenv("API_CACHE_EVICTION_INTERVAL")) == 0 {
+			env.missing("API_CACHE_EVICTION_INTERVAL")
+		}
+	}
+
+	if config.Swagger.Enabled && !config.IsLocal() && len(config.Swagger.Host) == 0 && len(config.ProdUrlHost) == 0 {
+		env.errs = append(env.errs, errors.New("API_PROD_URL_HOST or API_SWAGGER_HOST is required when Swagger UI is enabled outside the local environment"))
+	}
+
+	if len(config.MilestoneWebhook.Url) > 0 && len(config.MilestoneWebhook.Secret) == 0 {
+		env.errs = append(env.errs, errors.New("API_MILESTONE_WEBHOOK_SECRET is required when API_MILESTONE_WEBHOOK_URL is set"))
+	}
+
+	if len(env.errs) > 0 {
+		return config, fmt.Errorf("invalid configuration:\n%w", errors.Join(env.errs...))
+	}
+
+	return config, nil
+}
+
+// Reads env variables, collecting the errors of the missing or invalid ones.
+type envReader struct {
+	getenv func(string) string
+	errs   []error
+}
+
+func (env *envReader) missing(name string) {
+	env.errs = append(env.errs, fmt.Errorf("%s is required", name))
+}
+
+func (env *envReader) invalid(name string, value string, reason string) {
+	env.errs = append(env.errs, fmt.Errorf("%s=%q is not valid: %s", name, value, reason))
+}
+
+func (env *envReader) required(name string) string {
+	value := env.getenv(name)
+
+	if len(value) == 0 {
+		env.missing(name)
+	}
+
+	return value
+}
+
+func (env *envReader) string(name string, fallback string) string {
+	if value := env.getenv(name); len(value) > 0 {
+		return value
+	}
+
+	return fallback
+}
+
+func (env *envReader) oneOf(name string, fallback string, allowed ...string) string {
+	value := env.getenv(name)
+
+	if len(value) == 0 {
+		return fallback
+	}
+
+	for _, allowedValue := range allowed {
+		if strings.EqualFold(value, allowedValue) {
+			return allowedValue
+		}
+	}
+
+	env.invalid(name, value, "must be one of "+strings.Join(allowed, ", "))
+	return fallback
+}
+
+func (env *envReader) bool(name string, fallback bool) bool {
+	value := env.getenv(name)
+
+	if len(value) == 0 {
+		return fallback
+	}
+
+	parsed, parseErr := strconv.ParseBool(value)
+
+	if parseErr != nil {
+		env.invalid(name, value, "must be true or false")
+		return fallback
+	}
+
+	return parsed
+}
+
+func (env *envReader) uint(name string, fallback uint) uint {
+	value := env.getenv(name)
+
+	if len(value) == 0 {
+		return fallback
+	}
+
+	parsed, parseErr := strconv.ParseUint(value, 10, 32)
+
+	if parseErr != nil {
+		env.invalid(name, value, "must be a non negative integer")
+		return fallback
+	}
+
+	return uint(parsed)
+}
+
+func (env *envReader) nonNegativeInt(name string, fallback int64) int64 {
+	value := env.getenv(name)
+
+	if len(value) == 0 {
+		return fallback
+	}
+
+	parsed, parseErr := strconv.ParseInt(value, 10, 64)
+
+	if parseErr != nil || parsed < 0 {
+		env.invalid(name, value, "must be a non negative integer")
+		return fallback
+	}
+
+	return parsed
+}
+
+func (env *envReader) duration(name string, fallback time.Duration) time.Duration {
+	value := env.getenv(name)
+
+	if len(value) == 0 {
+		return fallback
+	}
+
+	parsed, parseErr := time.ParseDuration(value)
+
+	if parseErr != nil {
+		env.invalid(name, value, "must be a duration such as 30s or 1h")
+		return fallback
+	}
+
+	return parsed
+}
+
+func (env *envReader) nonNegativeDuration(name string, fallback time.Duration) time.Duration {
+	value := env.getenv(name)
+	parsed := env.duration(name, fallback)
+
+	if len(value) > 0 && parsed < 0 {
+		env.invalid(name, value, "must not be negative")
+		return fallback
+	}
+
+	return parsed
+}
+
+func (env *envReader) positiveDuration(name string, fallback time.Duration) time.Duration {
+	value := env.getenv(name)
+	parsed := env.duration(name, fallback)
+
+	if len(value) > 0 && parsed <= 0 {
+		env.invalid(name, value, "must be positive")
+		return fallback
+	}
+
+	return parsed
+}
+
+// Reads a list of values separated by commas, skipping the empty ones.
+func (env *envReader) list(name string) []string {
+	values := []string{}
+
+	for _, value := range strings.Split(env.getenv(name), ",") {
+		if value = strings.TrimSpace(value); len(value) > 0 {
+			values = append(values, value)
+		}
+	}
+
+	return values
+}
+
+// Reads a list of positive integers separated by commas.
+func (env *envReader) uintList(name string, fallback string) []uint {
+	value := env.string(name, fallback)
+	values, parseErr := parseUintList(value)
+
+	if parseErr != nil {
+		env.invalid(name, value, parseErr.Error())
+		values, _ = parseUintList(fallback)
+	}
+
+	return values
+}
+
+func (env *envReader) resourceExpirations(name string) map[constants.CacheResource]time.Duration {
+	value := env.getenv(name)
+	resourceExpirations, parseErr := parseResourceExpirations(value)
+
+	if parseErr != nil {
+		env.invalid(name, value, parseErr.Error())
+		return map[constants.CacheResource]time.Duration{}
+	}
+
+	return resourceExpirations
+}
+
+// Reads an absolute URL. Returns nil if it is not set.
+func (env *envReader) url(name string) *url.URL {
+	value := env.getenv(name)
+
+	if len(value) == 0 {
+		return nil
+	}
+
+	parsed, parseErr := url.Parse(value)
+
+	if parseErr != nil || !parsed.IsAbs() || len(parsed.Host) == 0 {
+		env.invalid(name, value, "must be an absolute URL")
+		return nil
+	}
+
+	return parsed
+}
+
+// Reads a semantic version. Returns nil if it is not set.
+func (env *envReader) clientVersion(name string) *models.ClientVersion {
+	value := env.getenv(name)
+
+	if len(value) == 0 {
+		return nil
+	}
+
+	parsed, parseErr := models.ParseClientVersion(value)
+
+	if parseErr != nil {
+		env.invalid(name, value, "must be a semantic version such as 1.4.2")
+		return nil
+	}
+
+	return parsed
+}
+
+func (env *envReader) redisUrl(name string) string {
+	value := env.required(name)
+
+	if len(value) > 0 {
+		if _, parseErr := redis.ParseURL(value); parseErr != nil {
+			env.invalid(name, value, parseErr.Error())
+		}
+	}
+
+	return value
+}
+
+// Parses resource=duration pairs separated by commas into a map of resource expirations.
+func parseResourceExpirations(value string) (map[constants.CacheResource]time.Duration, error) {
+	resourceExpirations := make(map[constants.CacheResource]time.Duration)
+
+	for _, pair := range strings.Split(value, ",") {
+		if len(strings.TrimSpace(pair)) == 0 {
+			continue
+		}
+
+		resource, durationString, found := strings.Cut(pair, "=")
+
+		if !found {
+			return nil, fmt.Errorf("resource expiration %q is not formatted as resource=duration", pair)
+		}
+
+		expiration, parseErr := time.ParseDuration(strings.TrimSpace(durationString))
+
+		if parseErr != nil {
+			return nil, parseErr
+		}
+
+		cacheResource := constants.CacheResource(strings.TrimSpace(resource))
+
+		if !slices.Contains(constants.CacheResources, cacheResource) {
+			return nil, fmt.Errorf("%q is not a cache resource", resource)
+		}
+
+		resourceExpirations[cacheResource] = expiration
+	}
+
+	return resourceExpirations, nil
+}
+
+// Parses positive integers separated by commas.
+func parseUintList(value string) ([]uint, error) {
+	values := []uint{}
+
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); len(item) == 0 {
+			continue
+		}
+
+		parsed, parseErr := strconv.ParseUint(item, 10, 32)
+
+		if parseErr != nil || parsed == 0 {
+			return nil, fmt.Errorf("%q is not a positive integer", item)
+		}
+
+		values = append(values, uint(parsed))
+	}
+
+	return values, nil
+}
@@ -0,0 +1,348 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/adfer-dev/analock-api/constants"
+	"github.com/stretchr/testify/assert"
+)
+
+// Builds an env lookup function from the given variables, on top of the required ones.
+func testEnv(variables map[string]string) func(string) string {
+	env := map[string]string{
+		"API_ENVIRONMENT":             "local",
+		"TURSO_DB_URL":                "file:test.db",
+		"API_CACHE_EXPIRATION":        "1h",
+		"API_CACHE_EVICTION_INTERVAL": "10m",
+	}
+
+	for name, value := range variables {
+		env[name] = value
+	}
+
+	return func(name string) string {
+		return env[name]
+	}
+}
+
+func TestLoadDefaults(t *testing.T) {
+	config, err := load(testEnv(nil))
+
+	assert.NoError(t, err)
+	assert.Equal(t, "file:test.db", config.Database.Url)
+	assert.Equal(t, uint(DefaultDatabaseConnectionRetries), config.Database.ConnectionRetries)
+	assert.Equal(t, DefaultDatabaseConnectionRetryInterval, config.Database.ConnectionRetryInterval)
+	assert.Equal(t, "memory", config.Cache.Backend)
+	assert.Equal(t, time.Hour, config.Cache.Expiration)
+	assert.Equal(t, 10*time.Minute, config.Cache.EvictionInterval)
+	assert.Equal(t, DefaultInternetArchiveUrl, config.InternetArchive.BaseUrl)
+	assert.Equal(t, uint(DefaultCircuitBreakerFailureThreshold), config.InternetArchive.BreakerFailureThreshold)
+	assert.Equal(t, DefaultOrphanSweepInterval, config.OrphanSweeper.Interval)
+	assert.True(t, config.Signup.Enabled)
+	assert.Empty(t, config.Signup.InviteCodes)
+	assert.Equal(t, DefaultRefreshCookieSameSite, config.RefreshCookieSameSite)
+	assert.False(t, config.ReadOnly)
+	assert.False(t, config.InternetArchive.VerifyIdentifiers)
+	assert.Equal(t, uint(DefaultInternetArchiveMaxSearchPage), config.InternetArchive.MaxSearchPage)
+	assert.Empty(t, config.InternetArchive.AllowedCollections)
+	assert.False(t, config.InternetArchive.DirectDownloadEnabled)
+	assert.True(t, config.Swagger.Enabled)
+	assert.Equal(t, ServerConfig{
+		ReadTimeout:          DefaultServerReadTimeout,
+		WriteTimeout:         DefaultServerWriteTimeout,
+		IdleTimeout:          DefaultServerIdleTimeout,
+		DownloadWriteTimeout: DefaultServerDownloadWriteTimeout,
+		PprofWriteTimeout:    DefaultServerPprofWriteTimeout,
+		ShutdownTimeout:      DefaultServerShutdownTimeout,
+	}, config.Server)
+	assert.Equal(t, DefaultJobsMaxJitter, config.Jobs.MaxJitter)
+	assert.Equal(t, DefaultImpersonationTokenTtl, config.ImpersonationTokenTtl)
+	assert.Equal(t, uint(DefaultMaxDiaryEntryTitleLength), config.MaxDiaryEntryTitleLength)
+	assert.False(t, config.DiaryOnePerDay)
+	assert.False(t, config.RequireVerifiedEmail)
+	assert.False(t, config.StreamListResponses)
+	assert.Zero(t, config.AccessTokenRenewalWindow)
+	assert.Zero(t, config.DeletedTokenGracePeriod)
+	assert.False(t, config.PprofEnabled)
+	assert.Equal(t, InfoLogLevel, config.LogLevel)
+}
+
+func TestLoadServerTimeouts(t *testing.T) {
+	config, err := load(testEnv(map[string]string{
+		"API_SERVER_WRITE_TIMEOUT":          "1m",
+		"API_SERVER_DOWNLOAD_WRITE_TIMEOUT": "0",
+		"API_SERVER_PPROF_WRITE_TIMEOUT":    "5m",
+		"API_SERVER_SHUTDOWN_TIMEOUT":       "5s",
+		"API_SLOW_REQUEST_MS":               "750",
+	}))
+
+	assert.NoError(t, err)
+	assert.Equal(t, time.Minute, config.Server.WriteTimeout)
+	assert.Equal(t, time.Duration(0), config.Server.DownloadWriteTimeout)
+	assert.Equal(t, 5*time.Minute, config.Server.PprofWriteTimeout)
+	assert.Equal(t, 5*time.Second, config.Server.ShutdownTimeout)
+	assert.Equal(t, 750*time.Millisecond, config.Server.SlowRequestThreshold)
+
+	_, invalidErr := load(testEnv(map[string]string{
+		"API_SERVER_READ_TIMEOUT":           "0s",
+		"API_SERVER_DOWNLOAD_WRITE_TIMEOUT": "-1m",
+		"API_SLOW_REQUEST_MS":               "1s",
+	}))
+
+	assert.ErrorContains(t, invalidErr, "API_SLOW_REQUEST_MS=")
+	assert.ErrorContains(t, invalidErr, "API_SERVER_READ_TIMEOUT=")
+	assert.ErrorContains(t, invalidErr, "API_SERVER_DOWNLOAD_WRITE_TIMEOUT=")
+}
+
+func TestLoadCacheStaleRetention(t *testing.T) {
+	config, err := load(testEnv(nil))
+
+	assert.NoError(t, err)
+	assert.Equal(t, time.Duration(0), config.Cache.StaleRetention)
+
+	config, err = load(testEnv(map[string]string{"API_CACHE_STALE_RETENTION": "30m"}))
+
+	assert.NoError(t, err)
+	assert.Equal(t, 30*time.Minute, config.Cache.StaleRetention)
+
+	_, invalidErr := load(testEnv(map[string]string{"API_CACHE_STALE_RETENTION": "-1m"}))
+
+	assert.ErrorContains(t, invalidErr, "API_CACHE_STALE_RETENTION=")
+}
+
+func TestLoadFromEnv(t *testing.T) {
+	config, err := load(testEnv(map[string]string{
+		"API_ENVIRONMENT":                 "production",
+		"API_PROD_URL_HOST":               "api.example.com",
+		"API_CACHE_BACKEND":               "redis",
+		"API_CACHE_REDIS_URL":             "redis://localhost:6379/0",
+		"API_CACHE_EVICTION_INTERVAL":     "",
+		"API_CACHE_RESOURCE_EXPIRATIONS":  "iaBookMetadata=6h",
+		"API_READ_ONLY":                   "true",
+		"API_SIGNUP_ENABLED":              "false",
+		"API_SIGNUP_INVITE_CODES":         "first, ,second",
+		"API_APPLE_CLIENT_ID":             "com.example.analock",
+		"API_MAX_DIARY_ENTRIES_PER_USER":  "100",
+		"API_REFRESH_COOKIE_SAME_SITE":    "Lax",
+		"API_IA_VERIFY_IDENTIFIERS":       "true",
+		"API_IA_MAX_SEARCH_PAGE":          "10",
+		"API_IA_ALLOWED_COLLECTIONS":      "gutenberg, americana",
+		"API_IA_DIRECT_DOWNLOAD_ENABLED":  "true",
+		"API_REQUIRE_VERIFIED_EMAIL":      "true",
+		"API_STREAM_LIST_RESPONSES":       "true",
+		"API_ACCESS_TOKEN_RENEWAL_WINDOW": "5m",
+		"API_DELETED_TOKEN_GRACE_PERIOD":  "10s",
+		"API_PPROF_ENABLED":               "true",
+	}))
+
+	assert.NoError(t, err)
+	assert.False(t, config.IsLocal())
+	assert.Equal(t, "redis", config.Cache.Backend)
+	assert.Equal(t, "redis://localhost:6379/0", config.Cache.RedisUrl)
+	assert.Equal(t, map[constants.CacheResource]time.Duration{"iaBookMetadata": 6 * time.Hour}, config.Cache.ResourceExpirations)
+	assert.True(t, config.ReadOnly)
+	assert.False(t, config.Signup.Enabled)
+	assert.Equal(t, []string{"first", "second"}, config.Signup.InviteCodes)
+	assert.Equal(t, "com.example.analock", config.Apple.ClientId)
+	assert.Equal(t, int64(100), config.MaxDiaryEntriesPerUser)
+	assert.Equal(t, "lax", config.RefreshCookieSameSite)
+	assert.True(t, config.InternetArchive.VerifyIdentifiers)
+	assert.Equal(t, uint(10), config.InternetArchive.MaxSearchPage)
+	assert.Equal(t, []string{"gutenberg", "americana"}, config.InternetArchive.AllowedCollections)
+	assert.True(t, config.InternetArchive.DirectDownloadEnabled)
+	assert.True(t, config.RequireVerifiedEmail)
+	assert.True(t, config.StreamListResponses)
+	assert.Equal(t, 5*time.Minute, config.AccessTokenRenewalWindow)
+	assert.Equal(t, 10*time.Second, config.DeletedTokenGracePeriod)
+	assert.True(t, config.PprofEnabled)
+	assert.False(t, config.Swagger.Enabled)
+}
+
+func TestLoadMissingVariables(t *testing.T) {
+	config, err := load(func(string) string { return "" })
+
+	assert.NotNil(t, config)
+	assert.Error(t, err)
+
+	for _, name := range []string{"API_ENVIRONMENT", "TURSO_DB_URL", "API_CACHE_EXPIRATION", "API_CACHE_EVICTION_INTERVAL"} {
+		assert.Contains(t, err.Error(), name+" is required")
+	}
+}
+
+func TestLoadInvalidVariables(t *testing.T) {
+	config, err := load(testEnv(map[string]string{
+		"API_DB_CONNECTION_RETRIES":        "many",
+		"API_CACHE_BACKEND":                "disk",
+		"API_CACHE_RESOURCE_EXPIRATIONS":   "iaBookMetadata",
+		"API_READ_ONLY":                    "maybe",
+		"API_ORPHAN_SWEEPER_INTERVAL":      "-1h",
+		"API_IA_BREAKER_COOLDOWN":          "not a duration",
+		"API_MAX_DIARY_ENTRIES_PER_USER":   "-1",
+		"API_REFRESH_COOKIE_SAME_SITE":     "none",
+		"API_IA_BREAKER_FAILURE_THRESHOLD": "3",
+	}))
+
+	assert.Error(t, err)
+
+	invalidVariables := []string{
+		"API_DB_CONNECTION_RETRIES",
+		"API_CACHE_BACKEND",
+		"API_CACHE_RESOURCE_EXPIRATIONS",
+		"API_READ_ONLY",
+		"API_ORPHAN_SWEEPER_INTERVAL",
+		"API_IA_BREAKER_COOLDOWN",
+		"API_MAX_DIARY_ENTRIES_PER_USER",
+		"API_REFRESH_COOKIE_SAME_SITE",
+	}
+
+	// Test case: Every invalid variable is reported, one per line
+	assert.Len(t, strings.Split(err.Error(), "\n"), len(invalidVariables)+1)
+
+	for _, name := range invalidVariables {
+		assert.Contains(t, err.Error(), name+"=")
+	}
+
+	// Test case: Invalid variables fall back to their defaults
+	assert.Equal(t, uint(DefaultDatabaseConnectionRetries), config.Database.ConnectionRetries)
+	assert.Equal(t, DefaultOrphanSweepInterval, config.OrphanSweeper.Interval)
+	assert.Equal(t, DefaultCircuitBreakerCooldown, config.InternetArchive.BreakerCooldown)
+	assert.Equal(t, uint(3), config.InternetArchive.BreakerFailureThreshold)
+}
+
+func TestLoadMilestoneWebhook(t *testing.T) {
+	config, err := load(testEnv(map[string]string{
+		"API_MILESTONE_WEBHOOK_URL":    "https://hooks.example.com/milestones",
+		"API_MILESTONE_WEBHOOK_SECRET": "secret",
+		"API_MILESTONE_STREAK_DAYS":    "7, 30",
+	}))
+
+	assert.NoError(t, err)
+	assert.Equal(t, []uint{7, 30}, config.MilestoneWebhook.StreakMilestones)
+
+	config, err = load(testEnv(map[string]string{
+		"API_MILESTONE_WEBHOOK_URL": "https://hooks.example.com/milestones",
+		"API_MILESTONE_STREAK_DAYS": "7,0",
+	}))
+
+	assert.ErrorContains(t, err, "API_MILESTONE_WEBHOOK_SECRET is required")
+	assert.ErrorContains(t, err, "API_MILESTONE_STREAK_DAYS=")
+	assert.Equal(t, []uint{7, 30, 100, 365}, config.MilestoneWebhook.StreakMilestones)
+}
+
+func TestLoadOutbound(t *testing.T) {
+	config, err := load(testEnv(map[string]string{"API_OUTBOUND_PROXY": "http://proxy.example.com:3128"}))
+
+	assert.NoError(t, err)
+	assert.Equal(t, DefaultOutboundUserAgent, config.Outbound.UserAgent)
+	assert.Equal(t, "proxy.example.com:3128", config.Outbound.ProxyUrl.Host)
+
+	config, err = load(testEnv(map[string]string{"API_OUTBOUND_PROXY": "proxy.example.com"}))
+
+	assert.ErrorContains(t, err, "API_OUTBOUND_PROXY=")
+	assert.Nil(t, config.Outbound.ProxyUrl)
+}
+
+func TestLoadClientVersion(t *testing.T) {
+	config, err := load(testEnv(nil))
+
+	assert.NoError(t, err)
+	assert.Nil(t, config.ClientVersion.Minimum)
+	assert.True(t, config.ClientVersion.AllowMissing)
+
+	config, err = load(testEnv(map[string]string{
+		"API_MIN_CLIENT_VERSION":           "1.4.0",
+		"API_CLIENT_UPGRADE_URL":           "https://example.com/download",
+		"API_CLIENT_VERSION_ALLOW_MISSING": "false",
+	}))
+
+	assert.NoError(t, err)
+	assert.Equal(t, "1.4.0", config.ClientVersion.Minimum.String())
+	assert.Equal(t, "https://example.com/download", config.ClientVersion.UpgradeUrl)
+	assert.False(t, config.ClientVersion.AllowMissing)
+
+	config, err = load(testEnv(map[string]string{"API_MIN_CLIENT_VERSION": "1.4"}))
+
+	assert.ErrorContains(t, err, "API_MIN_CLIENT_VERSION=")
+	assert.Nil(t, config.ClientVersion.Minimum)
+}
+
+func TestLoadRedisBackend(t *testing.T) {
+	_, missingErr := load(testEnv(map[string]string{"API_CACHE_BACKEND": "redis"}))
+	assert.ErrorContains(t, missingErr, "API_CACHE_REDIS_URL is required")
+
+	_, invalidErr := load(testEnv(map[string]string{"API_CACHE_BACKEND": "redis", "API_CACHE_REDIS_URL": "localhost:6379"}))
+	assert.ErrorContains(t, invalidErr, "API_CACHE_REDIS_URL=")
+}
+
+func TestLoadSwaggerEnabled(t *testing.T) {
+	tests := []struct {
+		name        string
+		environment string
+		enabledEnv  string
+		expected    bool
+	}{
+		{"Local by default", "local", "", true},
+		{"Production by default", "production", "", false},
+		{"Production explicitly enabled", "production", "true", true},
+		{"Local explicitly disabled", "local", "false", false},
+	}
+
+	for _, testCase := range tests {
+		t.Run(testCase.name, func(t *testing.T) {
+			config, err := load(testEnv(map[string]string{
+				"API_ENVIRONMENT":     testCase.environment,
+				"API_SWAGGER_ENABLED": testCase.enabledEnv,
+				"API_SWAGGER_HOST":    "api.example.com",
+			}))
+
+			assert.NoError(t, err)
+			assert.Equal(t, testCase.expected, config.Swagger.Enabled)
+		})
+	}
+
+	// Test case: The host Swagger UI is served from is required outside the local environment
+	_, err := load(testEnv(map[string]string{"API_ENVIRONMENT": "production", "API_SWAGGER_ENABLED": "true"}))
+	assert.ErrorContains(t, err, "API_PROD_URL_HOST")
+}
+
+func TestGetWithoutSet(t *testing.T) {
+	t.Setenv("API_READ_ONLY", "true")
+	t.Setenv("API_DB_CONNECTION_RETRIES", "many")
+
+	config := Get()
+
+	assert.True(t, config.ReadOnly)
+	assert.Equal(t, uint(DefaultDatabaseConnectionRetries), config.Database.ConnectionRetries)
+}
+
+func TestParseResourceExpirations(t *testing.T) {
+	tests := []struct {
+		name     string
+		value    string
+		expected map[constants.CacheResource]time.Duration
+		wantErr  bool
+	}{
+		{"Empty", "", map[constants.CacheResource]time.Duration{}, false},
+		{"Several resources", "iaBookMetadata=6h, diaryEntries=5m", map[constants.CacheResource]time.Duration{"iaBookMetadata": 6 * time.Hour, "diaryEntries": 5 * time.Minute}, false},
+		{"Missing duration", "iaBookMetadata", nil, true},
+		{"Invalid duration", "iaBookMetadata=long", nil, true},
+		{"Unknown resource", "iaBookMetdata=6h", nil, true},
+	}
+
+	for _, testCase := range tests {
+		t.Run(testCase.name, func(t *testing.T) {
+			expirations, err := parseResourceExpirations(testCase.value)
+
+			if (err != nil) != testCase.wantErr {
+				t.Fatalf("parseResourceExpirations() error = %v, wantErr %v", err, testCase.wantErr)
+			}
+
+			if !testCase.wantErr && !reflect.DeepEqual(expirations, testCase.expected) {
+				t.Errorf("parseResourceExpirations() = %v, want %v", expirations, testCase.expected)
+			}
+		})
+	}
+}
@@ -1,23 +1,116 @@
 package constants
 
+import "time"
+
 const StartDateQueryParam = "start_date"
 const EndDateQueryParam = "end_date"
+const FieldsQueryParam = "fields"
+const FieldsSummaryValue = "summary"
+const TimezoneQueryParam = "tz"
+const RefreshQueryParam = "refresh"
+const DayQueryParam = "day"
+const TzOffsetQueryParam = "tzOffset"
+const MaxTzOffsetMinutes = 14 * 60
+const CalendarDayFormat = "2006-01-02"
+const DiaryEntrySummaryPreviewLength = 100
+const DiaryEntryCalendarMaxDays = 366
+const DiaryEntryImportMaxBatchSize = 100
+const DiaryEntryImportMaxBodyBytes = 10 << 20
+const DaySeconds = 24 * 60 * 60
+
+// Dates sent by clients are Unix seconds, from 2000-01-01 UTC up to a day after the current time,
+// so a date sent in milliseconds by mistake is rejected instead of being stored tens of thousands of years ahead.
+const MinTimestampSeconds = 946684800
+const MaxTimestampFutureSkewSeconds = DaySeconds
+const TokenLastUsedDebounce = time.Minute
+const AccessTokenRenewalOverlap = 30 * time.Second
 const QueryParamError = "the query parameter %s is not provided or its format is not correct."
 const ErrorUnauthorizedOperation = "you have no permissions over the resource you are trying to access to"
 const ErrorGeneric = "something went wrong, please try again"
 const ErrorRequiredParams = "all parameters must be provided."
+const ErrorRequestBodyRequired = "request body is required."
+const ErrorRequestBodyTooLarge = "request body is too large."
+const ErrorCalendarRangeNotValid = "the date range must not end before it starts nor span more than %d days."
+const ErrorTokenNotValid = "token not valid"
+const ErrorMethodNotAllowed = "method not allowed"
+const ErrorUnknownBodyField = "field %s is not allowed in the request body."
+const ErrorTimestampNotValid = "Field%s must be a Unix timestamp in seconds, not before 2000 nor in the future."
+const WarningStaleSearchResults = "the live search failed, these results may be outdated."
+const ErrorReadOnlyMode = "the API is in read-only mode, please try again later"
+const ErrorCollectionNotAllowed = "the collection %s is not allowed."
+const ErrorActivityAlreadyRegistered = "the activity is already registered."
+const ErrorEmailNotVerified = "your email is not verified. Please, authenticate again with a provider that verifies it"
+const ReadOnlyModeRetryAfterSeconds = 300
+const ErrorClientVersionTooOld = "this version of the app is no longer supported, please upgrade it"
+const ErrorClientVersionMissing = "the X-Client-Version header must be provided"
+const ErrorClientVersionNotValid = "the X-Client-Version header must be a semantic version such as 1.4.2"
+const ClientVersionHeader = "X-Client-Version"
+const ServerTimeHeader = "X-Server-Time"
+const NewAccessTokenHeader = "X-New-Access-Token"
+const RequestIdHeader = "X-Request-Id"
+const WebhookSignatureHeader = "X-Analock-Signature"
+const CacheStatusHeader = "X-Cache"
+const ChecksumMd5Header = "X-Checksum-Md5"
+const ChecksumStatusTrailer = "X-Checksum-Status"
+const ChecksumStatusVerified = "verified"
+const ChecksumStatusMismatch = "mismatch"
+const CacheStatusStale = "stale"
+const RefreshTokenCookieName = "refreshToken"
+const RefreshTokenCookiePath = "/api/v1/auth"
 const ApiV1UrlRoot = "/api/v1"
 const ApiUrlDiaryEntries = "/diaryEntries"
 const ApiUrlUserDiaryEntries = "/diaryEntries/user"
 const ApiUrlBookRegistrations = "/activityRegistrations/books"
 const ApiUrlGameRegistrations = "/activityRegistrations/games"
+const ApiUrlActivityFeed = "/activityRegistrations/user"
 const ApiGoogleTokenValidationUrl = "https://www.googleapis.com/oauth2/v3/tokeninfo"
-const DiaryEntriesCacheResource = "diaryEntries"
-const BookActivityRegistrationsCacheResource = "bookActivityRegistrations"
-const GameActivityRegistrationsCacheResource = "gameActivityRegistrations"
-const InternetArchiveBookSearchCacheResource = "iaBookSearch"
-const InternetArchiveBookMetadataCacheResource = "iaBookMetadata"
-const InternetArchiveBookDownloadCacheResource = "iaBookDownload"
+const ApiAppleKeysUrl = "https://appleid.apple.com/auth/keys"
+const AppleTokenIssuer = "https://appleid.apple.com"
+const MemoryCacheBackend = "memory"
+const RedisCacheBackend = "redis"
+const RedisCacheKeyPrefix = "analock:"
+const RedisStaleCacheKeyPrefix = "analock:stale:"
+
+// CacheResource names a kind of cached resource. The keys of its cache entries start with it.
+type CacheResource string
+
+const (
+	DiaryEntriesCacheResource                CacheResource = "diaryEntries"
+	BookActivityRegistrationsCacheResource   CacheResource = "bookActivityRegistrations"
+	GameActivityRegistrationsCacheResource   CacheResource = "gameActivityRegistrations"
+	InternetArchiveBookSearchCacheResource   CacheResource = "iaBookSearch"
+	InternetArchiveBookMetadataCacheResource CacheResource = "iaBookMetadata"
+	InternetArchiveBookDownloadCacheResource CacheResource = "iaBookDownload"
+	InternetArchiveRelatedBooksCacheResource CacheResource = "iaRelatedBooks"
+	PlatformStatsCacheResource               CacheResource = "platformStats"
+)
+
+// All the cache resources, so the ones given in the config can be checked.
+var CacheResources = []CacheResource{
+	DiaryEntriesCacheResource,
+	BookActivityRegistrationsCacheResource,
+	GameActivityRegistrationsCacheResource,
+	InternetArchiveBookSearchCacheResource,
+	InternetArchiveBookMetadataCacheResource,
+	InternetArchiveBookDownloadCacheResource,
+	InternetArchiveRelatedBooksCacheResource,
+	PlatformStatsCacheResource,
+}
+
+// Time the platform stats are cached unless API_CACHE_RESOURCE_EXPIRATIONS sets another one.
+const PlatformStatsCacheExpiration = time.Minute
+
+const OrphanRegistrationSweepJobName = "orphanRegistrationSweep"
+const InternetArchiveRelatedBooksDefaultRows = 10
+const InternetArchiveRelatedBooksMaxRows = 50
+const InternetArchiveRelatedBooksMaxSubjects = 5
+const InternetArchiveDirectDownloadNote = "Download the file from this URL directly. If Internet Archive cannot be reached, download it through the download endpoint instead."
+const AdminUserListDefaultPageSize = 20
+const AdminUserListMaxPageSize = 100
+const ActivityFeedDefaultPageSize = 20
+const ActivityFeedMaxPageSize = 100
+const PlatformStatsDefaultNewUsersDays = 7
+const PlatformStatsMaxNewUsersDays = 365
 
 // TEST CONSTANTS
 const TestAccessTokenValue = "mock_access_jwt_from_manager_v_agnostic"
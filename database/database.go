@@ -3,16 +3,21 @@ package database
 import (
 	"database/sql"
 	"fmt"
-	"os"
+	"log"
+	"sync"
+	"time"
 
+	"github.com/adfer-dev/analock-api/config"
 	"github.com/adfer-dev/analock-api/utils"
 	_ "github.com/tursodatabase/go-libsql"
 )
 
 const (
-	createUsersTableQuery = "CREATE TABLE IF NOT EXISTS `user` (`id` integer, `email` text, 'username' text, `role` integer" +
+	createUsersTableQuery = "CREATE TABLE IF NOT EXISTS `user` (`id` integer, `email` text, 'username' text, `role` integer, `created_at` integer" +
+		", `email_verified` integer NOT NULL DEFAULT 0" +
 		", PRIMARY KEY (`id`), UNIQUE (`email`));"
 	createTokensTableQuery = "CREATE TABLE IF NOT EXISTS `token` (`id` integer, `value` text, `kind` integer, `user_id` text," +
+		" `created_at` integer, `last_used_at` integer," +
 		" PRIMARY KEY (`id`)," +
 		" UNIQUE (`user_id`, `kind`)," +
 		" CONSTRAINT `fk_users_tokens` FOREIGN KEY (`user_id`)" +
@@ -22,7 +27,7 @@ const (
 		" PRIMARY KEY (`id`), UNIQUE (`provider_client_id`)," +
 		" CONSTRAINT `fk_users_external_login` FOREIGN KEY (`user_id`)" +
 		" REFERENCES `user` (`id`) ON DELETE CASCADE ON UPDATE CASCADE);"
-	createDiaryEntryTableQuery = "CREATE TABLE IF NOT EXISTS `diary_entry` (`id` integer, `title` text, `content` text, `registration_id` integer," +
+	createDiaryEntryTableQuery = "CREATE TABLE IF NOT EXISTS `diary_entry` (`id` integer, `title` text, `content` text, `registration_id` integer, `updated_at` integer," +
 		" PRIMARY KEY (`id`)," +
 		" UNIQUE (`id`, `registration_id`)," +
 		" CONSTRAINT `fk_activity_registration_diary_entry` FOREIGN KEY (`registration_id`)" +
@@ -31,6 +36,7 @@ const (
 		"`id` integer PRIMARY KEY, " +
 		"`registration_date` integer, " +
 		"`user_id` integer, " +
+		"`platform` text, " +
 		"CONSTRAINT `fk_activity_registration_user` FOREIGN KEY (`user_id`) " +
 		"REFERENCES `user` (`id`) ON DELETE CASCADE ON UPDATE CASCADE);"
 	createActivityRegistrationBookTableQuery = "CREATE TABLE IF NOT EXISTS `activity_registration_book` (" +
@@ -45,6 +51,20 @@ const (
 		"`game_name` text, " +
 		"CONSTRAINT `fk_activity_registration` FOREIGN KEY (`registration_id`) " +
 		"REFERENCES `activity_registration` (`id`) ON DELETE CASCADE ON UPDATE CASCADE);"
+	addActivityRegistrationPlatformColumnQuery   = "ALTER TABLE `activity_registration` ADD COLUMN `platform` text;"
+	addUserCreatedAtColumnQuery                  = "ALTER TABLE `user` ADD COLUMN `created_at` integer;"
+	addDiaryEntryUpdatedAtColumnQuery            = "ALTER TABLE `diary_entry` ADD COLUMN `updated_at` integer;"
+	addTokenCreatedAtColumnQuery                 = "ALTER TABLE `token` ADD COLUMN `created_at` integer;"
+	addTokenLastUsedAtColumnQuery                = "ALTER TABLE `token` ADD COLUMN `last_used_at` integer;"
+	addUserEmailVerifiedColumnQuery              = "ALTER TABLE `user` ADD COLUMN `email_verified` integer NOT NULL DEFAULT 0;"
+	createActivityRegistrationUserDateIndexQuery = "CREATE INDEX IF NOT EXISTS `idx_activity_registration_user_date` " +
+		"ON `activity_registration` (`user_id`, `registration_date`);"
+	createDiaryEntryRegistrationIndexQuery = "CREATE INDEX IF NOT EXISTS `idx_diary_entry_registration` " +
+		"ON `diary_entry` (`registration_id`);"
+	createActivityRegistrationBookRegistrationIndexQuery = "CREATE INDEX IF NOT EXISTS `idx_activity_registration_book_registration` " +
+		"ON `activity_registration_book` (`registration_id`);"
+	createActivityRegistrationGameRegistrationIndexQuery = "CREATE INDEX IF NOT EXISTS `idx_activity_registration_game_registration` " +
+		"ON `activity_registration_game` (`registration_id`);"
 )
 
 type Database struct {
@@ -52,27 +72,79 @@ type Database struct {
 }
 
 var connectionInstance *Database
+var connectionLock sync.Mutex
 
+// Gets the database instance, connecting to the database if it is not connected yet.
+// The storages can not work without the database, so the process exits if it is unreachable.
 func GetDatabaseInstance() *Database {
+	instance, connectErr := Connect()
 
-	if connectionInstance == nil {
-		db, dbErr := sql.Open("libsql", fmt.Sprintf("%s?authToken=%s", os.Getenv("TURSO_DB_URL"), os.Getenv("TURSO_DB_TOKEN")))
+	if connectErr != nil {
+		log.Fatalf("Database is unreachable: %s", connectErr.Error())
+	}
 
-		if dbErr != nil {
-			utils.GetCustomLogger().Error(dbErr.Error())
-		}
+	return instance
+}
 
-		if connErr := db.Ping(); connErr != nil {
-			utils.GetCustomLogger().Error(connErr.Error())
-		} else {
-			utils.GetCustomLogger().Info("Connected to database")
-		}
+// Connects to the database and creates its tables, unless it is already connected.
+// The ping is retried with the configured backoff, and the instance is only kept once the database is reachable,
+// so a failed connection is attempted again on the next call.
+func Connect() (*Database, error) {
+	connectionLock.Lock()
+	defer connectionLock.Unlock()
+
+	if connectionInstance != nil {
+		return connectionInstance, nil
+	}
+
+	db, dbErr := sql.Open("libsql", fmt.Sprintf("%s?authToken=%s", config.Get().Database.Url, config.Get().Database.Token))
+
+	if dbErr != nil {
+		return nil, dbErr
+	}
 
-		connectionInstance = &Database{dbConnection: db}
-		initDatabase()
+	maxRetries, retryInterval := getConnectionRetryConfig()
+
+	if connErr := pingWithRetry(db.Ping, maxRetries, retryInterval); connErr != nil {
+		db.Close()
+		return nil, connErr
 	}
 
-	return connectionInstance
+	utils.GetCustomLogger().Info("Connected to database")
+
+	connectionInstance = &Database{dbConnection: db}
+	initDatabase()
+
+	return connectionInstance, nil
+}
+
+// Pings the database and retries the ping until it succeeds or the maximum number of retries is reached.
+//
+// The retry interval is exponential, being doubled for each retry (starting at the given base interval).
+func pingWithRetry(ping func() error, maxRetries uint, baseInterval time.Duration) error {
+	connErr := ping()
+	interval := baseInterval
+
+	for currentRetries := uint(0); connErr != nil && currentRetries < maxRetries; currentRetries++ {
+		utils.GetCustomLogger().Errorf(
+			"Database ping failed: %s. Retrying in %s... %d retries left.\n",
+			connErr.Error(),
+			interval,
+			maxRetries-currentRetries,
+		)
+		time.Sleep(interval)
+		interval *= 2
+		connErr = ping()
+	}
+
+	return connErr
+}
+
+// Gets the database connection retry count and base interval from the config.
+func getConnectionRetryConfig() (uint, time.Duration) {
+	databaseConfig := config.Get().Database
+
+	return databaseConfig.ConnectionRetries, databaseConfig.ConnectionRetryInterval
 }
 
 func (conn *Database) GetConnection() *sql.DB {
@@ -96,4 +168,49 @@ func initDatabase() {
 			utils.GetCustomLogger().Error(fmt.Sprintf("Error when creating table %s: %s", tableName, createTableErr.Error()))
 		}
 	}
+
+	// Columns added after a table was first created
+	addColumnIfNotExists("activity_registration", "platform", addActivityRegistrationPlatformColumnQuery)
+	addColumnIfNotExists("user", "created_at", addUserCreatedAtColumnQuery)
+	addColumnIfNotExists("diary_entry", "updated_at", addDiaryEntryUpdatedAtColumnQuery)
+	addColumnIfNotExists("token", "created_at", addTokenCreatedAtColumnQuery)
+	addColumnIfNotExists("token", "last_used_at", addTokenLastUsedAtColumnQuery)
+	addColumnIfNotExists("user", "email_verified", addUserEmailVerifiedColumnQuery)
+
+	// Indexes are created once every table exists
+	var createIndexQueryMap map[string]string = make(map[string]string)
+
+	createIndexQueryMap["idx_activity_registration_user_date"] = createActivityRegistrationUserDateIndexQuery
+	createIndexQueryMap["idx_diary_entry_registration"] = createDiaryEntryRegistrationIndexQuery
+	createIndexQueryMap["idx_activity_registration_book_registration"] = createActivityRegistrationBookRegistrationIndexQuery
+	createIndexQueryMap["idx_activity_registration_game_registration"] = createActivityRegistrationGameRegistrationIndexQuery
+
+	for indexName, query := range createIndexQueryMap {
+		_, createIndexErr := connectionInstance.GetConnection().Exec(query)
+		if createIndexErr != nil {
+			utils.GetCustomLogger().Error(fmt.Sprintf("Error when creating index %s: %s", indexName, createIndexErr.Error()))
+		}
+	}
+}
+
+// Runs the given query, adding a column to an already existing table, if the table does not have that column yet.
+func addColumnIfNotExists(tableName string, columnName string, query string) {
+	var columnCount int
+
+	countErr := connectionInstance.GetConnection().
+		QueryRow("SELECT COUNT(*) FROM pragma_table_info(?) WHERE name = ?;", tableName, columnName).
+		Scan(&columnCount)
+
+	if countErr != nil {
+		utils.GetCustomLogger().Error(fmt.Sprintf("Error when checking column %s of table %s: %s", columnName, tableName, countErr.Error()))
+		return
+	}
+
+	if columnCount > 0 {
+		return
+	}
+
+	if _, addColumnErr := connectionInstance.GetConnection().Exec(query); addColumnErr != nil {
+		utils.GetCustomLogger().Error(fmt.Sprintf("Error when adding column %s to table %s: %s", columnName, tableName, addColumnErr.Error()))
+	}
 }
@@ -0,0 +1,154 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/adfer-dev/analock-api/config"
+	"github.com/stretchr/testify/assert"
+)
+
+// openTestDatabaseFile opens the given local database file and runs the table and index creation on it.
+func openTestDatabaseFile(tb testing.TB, path string) *sql.DB {
+	db, openErr := sql.Open("libsql", "file:"+path)
+
+	if openErr != nil {
+		tb.Fatal(openErr)
+	}
+
+	originalConnectionInstance := connectionInstance
+	connectionInstance = &Database{dbConnection: db}
+	tb.Cleanup(func() {
+		connectionInstance = originalConnectionInstance
+		db.Close()
+	})
+
+	initDatabase()
+
+	return db
+}
+
+func TestInitDatabaseAddsMissingColumns(t *testing.T) {
+	path := fmt.Sprintf("%s/test.db", t.TempDir())
+	db, openErr := sql.Open("libsql", "file:"+path)
+
+	if openErr != nil {
+		t.Fatal(openErr)
+	}
+
+	// Table as it was created before the platform column existed
+	if _, createErr := db.Exec("CREATE TABLE `activity_registration` (`id` integer PRIMARY KEY, `registration_date` integer, `user_id` integer);"); createErr != nil {
+		t.Fatal(createErr)
+	}
+
+	// Table as it was created before the email_verified column existed, with a user already stored
+	if _, createErr := db.Exec("CREATE TABLE `user` (`id` integer, `email` text, 'username' text, `role` integer, `created_at` integer, PRIMARY KEY (`id`), UNIQUE (`email`));"); createErr != nil {
+		t.Fatal(createErr)
+	}
+	if _, insertErr := db.Exec("INSERT INTO user (email, username, role, created_at) VALUES ('old@example.com', 'old', 2, 0);"); insertErr != nil {
+		t.Fatal(insertErr)
+	}
+	db.Close()
+
+	db = openTestDatabaseFile(t, path)
+
+	var columnCount int
+	countErr := db.QueryRow("SELECT COUNT(*) FROM pragma_table_info('activity_registration') WHERE name = 'platform';").Scan(&columnCount)
+
+	assert.NoError(t, countErr)
+	assert.Equal(t, 1, columnCount)
+
+	// Test case: Users stored before the column existed are not verified
+	var emailVerified bool
+	selectErr := db.QueryRow("SELECT email_verified FROM user WHERE email = 'old@example.com';").Scan(&emailVerified)
+
+	assert.NoError(t, selectErr)
+	assert.False(t, emailVerified)
+}
+
+func TestPingWithRetry(t *testing.T) {
+	t.Run("succeeds_after_failures", func(t *testing.T) {
+		attempts := 0
+		err := pingWithRetry(func() error {
+			attempts++
+			if attempts < 3 {
+				return errors.New("connection refused")
+			}
+			return nil
+		}, 5, time.Millisecond)
+
+		assert.NoError(t, err)
+		assert.Equal(t, 3, attempts)
+	})
+
+	t.Run("fails_when_retries_exhausted", func(t *testing.T) {
+		attempts := 0
+		err := pingWithRetry(func() error {
+			attempts++
+			return errors.New("connection refused")
+		}, 2, time.Millisecond)
+
+		assert.EqualError(t, err, "connection refused")
+		assert.Equal(t, 3, attempts)
+	})
+}
+
+func TestGetConnectionRetryConfig(t *testing.T) {
+	t.Run("defaults", func(t *testing.T) {
+		t.Setenv("API_DB_CONNECTION_RETRIES", "")
+		t.Setenv("API_DB_CONNECTION_RETRY_INTERVAL", "")
+
+		maxRetries, retryInterval := getConnectionRetryConfig()
+		assert.Equal(t, uint(config.DefaultDatabaseConnectionRetries), maxRetries)
+		assert.Equal(t, config.DefaultDatabaseConnectionRetryInterval, retryInterval)
+	})
+
+	t.Run("from_env", func(t *testing.T) {
+		t.Setenv("API_DB_CONNECTION_RETRIES", "3")
+		t.Setenv("API_DB_CONNECTION_RETRY_INTERVAL", "250ms")
+
+		maxRetries, retryInterval := getConnectionRetryConfig()
+		assert.Equal(t, uint(3), maxRetries)
+		assert.Equal(t, 250*time.Millisecond, retryInterval)
+	})
+
+	t.Run("invalid_env", func(t *testing.T) {
+		t.Setenv("API_DB_CONNECTION_RETRIES", "many")
+		t.Setenv("API_DB_CONNECTION_RETRY_INTERVAL", "soon")
+
+		maxRetries, retryInterval := getConnectionRetryConfig()
+		assert.Equal(t, uint(config.DefaultDatabaseConnectionRetries), maxRetries)
+		assert.Equal(t, config.DefaultDatabaseConnectionRetryInterval, retryInterval)
+	})
+}
+
+func TestConnectUnreachableDatabase(t *testing.T) {
+	originalConnectionInstance := connectionInstance
+	connectionInstance = nil
+	defer func() { connectionInstance = originalConnectionInstance }()
+
+	databaseDir := t.TempDir() + "/missing"
+	t.Setenv("TURSO_DB_URL", "file:"+databaseDir+"/test.db")
+	t.Setenv("API_DB_CONNECTION_RETRIES", "1")
+	t.Setenv("API_DB_CONNECTION_RETRY_INTERVAL", "1ms")
+
+	instance, connectErr := Connect()
+
+	assert.Error(t, connectErr)
+	assert.Nil(t, instance)
+	assert.Nil(t, connectionInstance)
+
+	// Test case: The failed connection is not kept, so the next call connects once the database is reachable
+	assert.NoError(t, os.Mkdir(databaseDir, 0o700))
+
+	instance, connectErr = Connect()
+
+	assert.NoError(t, connectErr)
+	assert.Same(t, connectionInstance, instance)
+	assert.NoError(t, instance.GetConnection().Ping())
+	instance.GetConnection().Close()
+}
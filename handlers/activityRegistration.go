@@ -1,25 +1,47 @@
 package handlers
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/adfer-dev/analock-api/constants"
 	"github.com/adfer-dev/analock-api/models"
 	"github.com/adfer-dev/analock-api/services"
+	"github.com/adfer-dev/analock-api/storage"
 	"github.com/adfer-dev/analock-api/utils"
 	"github.com/gorilla/mux"
 )
 
-var bookRegistrationService services.BookActivityRegistrationService = &services.BookActivityRegistrationServiceImpl{}
-var gameRegistrationService services.GameActivityRegistrationService = &services.GameActivityRegistrationServiceImpl{}
+var bookRegistrationService services.BookActivityRegistrationService = services.NewBookActivityRegistrationServiceImpl(
+	&storage.BookActivityRegistrationStorage{},
+	&storage.ActivityRegistrationStorage{},
+)
+var gameRegistrationService services.GameActivityRegistrationService = services.NewGameActivityRegistrationServiceImpl(
+	&storage.GameActivityRegistrationStorage{},
+	&storage.ActivityRegistrationStorage{},
+)
+var activityFeedService services.ActivityFeedService = services.NewActivityFeedServiceImpl(&storage.ActivityRegistrationStorage{})
+
+// Values of the type query param of the activity feed, mapped to the registrations they list.
+var activityFeedTypes = map[string]models.ActivityFeedItemType{
+	"all":   "",
+	"books": models.BookActivityFeedItem,
+	"games": models.GameActivityFeedItem,
+}
 
 func InitActivityRegistrationRoutes(router *mux.Router) {
 	router.HandleFunc("/api/v1/activityRegistrations/books/user/{id:[0-9]+}", utils.ParseToHandlerFunc(handleGetUserBookActivityRegistrations)).Methods("GET")
 	router.HandleFunc("/api/v1/activityRegistrations/games/user/{id:[0-9]+}", utils.ParseToHandlerFunc(handleGetUserGameActivityRegistrations)).Methods("GET")
+	router.HandleFunc("/api/v1/activityRegistrations/user/{id:[0-9]+}", utils.ParseToHandlerFunc(handleGetUserActivityFeed)).Methods("GET")
+	router.HandleFunc("/api/v1/activityRegistrations/books/{id:[0-9]+}", utils.ParseToHandlerFunc(handleGetBookActivityRegistration)).Methods("GET")
+	router.HandleFunc("/api/v1/activityRegistrations/games/{id:[0-9]+}", utils.ParseToHandlerFunc(handleGetGameActivityRegistration)).Methods("GET")
 	router.HandleFunc("/api/v1/activityRegistrations/books", utils.ParseToHandlerFunc(handleCreateBookActivityRegistration)).Methods("POST")
 	router.HandleFunc("/api/v1/activityRegistrations/games", utils.ParseToHandlerFunc(handleCreateGameActivityRegistration)).Methods("POST")
+	router.HandleFunc("/api/v1/activityRegistrations/books/{id:[0-9]+}", utils.ParseToHandlerFunc(handleUpdateBookActivityRegistration)).Methods("PUT")
+	router.HandleFunc("/api/v1/activityRegistrations/games/{id:[0-9]+}", utils.ParseToHandlerFunc(handleUpdateGameActivityRegistration)).Methods("PUT")
 }
 
 // @Summary		Get user book activity registrations
@@ -30,20 +52,32 @@ func InitActivityRegistrationRoutes(router *mux.Router) {
 // @Param			id			path		int	true	"User ID"
 // @Param			start_date	query		int	false	"Start date timestamp"
 // @Param			end_date		query		int	false	"End date timestamp"
+// @Param			day			query		int	false	"Unix timestamp in seconds of a day to get its registrations, instead of the date range"
+// @Param			tzOffset		query		int	false	"UTC offset of the day, in minutes"
+// @Param			refresh		query		bool	false	"Skip cached values and refresh them, only honored for admins"
+// @Param			Cache-Control	header		string	false	"no-cache skips cached values and refreshes them, only honored for admins"
 // @Success		200			{array}		models.BookActivityRegistration
 // @Failure		400			{object}	models.HttpError
+// @Failure		404			{object}	models.HttpError
 // @Failure		500			{object}	models.HttpError
 // @Security		BearerAuth
 // @Router			/activityRegistrations/books/user/{id} [get]
 func handleGetUserBookActivityRegistrations(res http.ResponseWriter, req *http.Request) error {
 	userId, _ := strconv.Atoi(mux.Vars(req)["id"])
-	startDateString := req.URL.Query().Get(constants.StartDateQueryParam)
-	endDateString := req.URL.Query().Get(constants.EndDateQueryParam)
 
-	if len(startDateString) == 0 || len(endDateString) == 0 {
+	if httpErr := checkListedUserExists(uint(userId)); httpErr != nil {
+		return utils.WriteJSON(res, httpErr.Status, httpErr)
+	}
+	startDate, endDate, hasDateRange, rangeErr := utils.ParseDateRangeQueryParams(req)
+
+	if rangeErr != nil {
+		return utils.WriteJSON(res, 400, models.HttpError{Status: http.StatusBadRequest, Description: rangeErr.Error()})
+	}
+
+	if !hasDateRange {
 		userBookRegistrations, err := services.GetCacheServiceInstance().CacheResource(func() (interface{}, error) {
 			return bookRegistrationService.GetUserBookActivityRegistrations(uint(userId))
-		}, constants.BookActivityRegistrationsCacheResource, utils.BuildUserCacheKey(uint(userId)))
+		}, constants.BookActivityRegistrationsCacheResource, utils.BuildUserCacheKey(uint(userId)), cacheBypassRequested(req))
 
 		if err != nil {
 			return utils.WriteJSON(res, 500, err.Error())
@@ -52,24 +86,13 @@ func handleGetUserBookActivityRegistrations(res http.ResponseWriter, req *http.R
 		return utils.WriteJSON(res, 200, userBookRegistrations)
 	}
 
-	startDate, startTimeErr := strconv.Atoi(req.URL.Query().Get(constants.StartDateQueryParam))
-
-	if startTimeErr != nil {
-		return utils.WriteJSON(res, 400, models.HttpError{Status: http.StatusBadRequest, Description: fmt.Sprintf(constants.QueryParamError, constants.StartDateQueryParam)})
-	}
-
-	endDate, endTimeErr := strconv.Atoi(req.URL.Query().Get(constants.EndDateQueryParam))
-
-	if endTimeErr != nil {
-		return utils.WriteJSON(res, 400, models.HttpError{Status: http.StatusBadRequest, Description: fmt.Sprintf(constants.QueryParamError, constants.EndDateQueryParam)})
-	}
-
 	userRegistrations, err := services.GetCacheServiceInstance().CacheResource(
 		func() (interface{}, error) {
 			return bookRegistrationService.GetUserBookActivityRegistrationsTimeRange(uint(userId), int64(startDate), int64(endDate))
 		},
 		constants.BookActivityRegistrationsCacheResource,
 		utils.BuildUserDateRangeCacheKey(uint(userId), startDate, endDate),
+		cacheBypassRequested(req),
 	)
 	if err != nil {
 		return utils.WriteJSON(res, 400, models.HttpError{Status: http.StatusBadRequest, Description: err.Error()})
@@ -86,20 +109,32 @@ func handleGetUserBookActivityRegistrations(res http.ResponseWriter, req *http.R
 // @Param			id			path		int	true	"User ID"
 // @Param			start_date	query		int	false	"Start date timestamp"
 // @Param			end_date		query		int	false	"End date timestamp"
+// @Param			day			query		int	false	"Unix timestamp in seconds of a day to get its registrations, instead of the date range"
+// @Param			tzOffset		query		int	false	"UTC offset of the day, in minutes"
+// @Param			refresh		query		bool	false	"Skip cached values and refresh them, only honored for admins"
+// @Param			Cache-Control	header		string	false	"no-cache skips cached values and refreshes them, only honored for admins"
 // @Success		200			{array}		models.GameActivityRegistration
 // @Failure		400			{object}	models.HttpError
+// @Failure		404			{object}	models.HttpError
 // @Failure		500			{object}	models.HttpError
 // @Security		BearerAuth
 // @Router			/activityRegistrations/games/user/{id} [get]
 func handleGetUserGameActivityRegistrations(res http.ResponseWriter, req *http.Request) error {
 	userId, _ := strconv.Atoi(mux.Vars(req)["id"])
-	startDateString := req.URL.Query().Get(constants.StartDateQueryParam)
-	endDateString := req.URL.Query().Get(constants.EndDateQueryParam)
 
-	if len(startDateString) == 0 || len(endDateString) == 0 {
+	if httpErr := checkListedUserExists(uint(userId)); httpErr != nil {
+		return utils.WriteJSON(res, httpErr.Status, httpErr)
+	}
+	startDate, endDate, hasDateRange, rangeErr := utils.ParseDateRangeQueryParams(req)
+
+	if rangeErr != nil {
+		return utils.WriteJSON(res, 400, models.HttpError{Status: http.StatusBadRequest, Description: rangeErr.Error()})
+	}
+
+	if !hasDateRange {
 		userGameRegistrations, err := services.GetCacheServiceInstance().CacheResource(func() (interface{}, error) {
 			return gameRegistrationService.GetUserGameActivityRegistrations(uint(userId))
-		}, constants.GameActivityRegistrationsCacheResource, utils.BuildUserCacheKey(uint(userId)))
+		}, constants.GameActivityRegistrationsCacheResource, utils.BuildUserCacheKey(uint(userId)), cacheBypassRequested(req))
 
 		if err != nil {
 			return utils.WriteJSON(res, 500, err.Error())
@@ -108,23 +143,13 @@ func handleGetUserGameActivityRegistrations(res http.ResponseWriter, req *http.R
 		return utils.WriteJSON(res, 200, userGameRegistrations)
 	}
 
-	startDate, startTimeErr := strconv.Atoi(req.URL.Query().Get(constants.StartDateQueryParam))
-
-	if startTimeErr != nil {
-		return utils.WriteJSON(res, 400, models.HttpError{Status: http.StatusBadRequest, Description: fmt.Sprintf(constants.QueryParamError, constants.StartDateQueryParam)})
-	}
-
-	endDate, endTimeErr := strconv.Atoi(req.URL.Query().Get(constants.EndDateQueryParam))
-
-	if endTimeErr != nil {
-		return utils.WriteJSON(res, 400, models.HttpError{Status: http.StatusBadRequest, Description: fmt.Sprintf(constants.QueryParamError, constants.EndDateQueryParam)})
-	}
 	userRegistrations, err := services.GetCacheServiceInstance().CacheResource(
 		func() (interface{}, error) {
 			return gameRegistrationService.GetUserGameActivityRegistrationsTimeRange(uint(userId), int64(startDate), int64(endDate))
 		},
 		constants.GameActivityRegistrationsCacheResource,
 		utils.BuildUserDateRangeCacheKey(uint(userId), startDate, endDate),
+		cacheBypassRequested(req),
 	)
 	if err != nil {
 		return utils.WriteJSON(res, 400, err.Error())
@@ -135,12 +160,17 @@ func handleGetUserGameActivityRegistrations(res http.ResponseWriter, req *http.R
 
 // @Summary		Create book activity registration
 // @Description	Create a new book activity registration
+// @Description	When API_IA_VERIFY_IDENTIFIERS is true, the book must exist in Internet Archive.
+// @Description	When API_DEDUPLICATE_ACTIVITY_REGISTRATIONS is true, registering the same book twice on the same day, in the given timezone, returns the existing registration.
 // @Tags			activities
 // @Accept			json
 // @Produce		json
 // @Param			body	body		services.AddBookActivityRegistrationBody	true	"Book activity registration information"
+// @Param			tz		query		string										false	"IANA timezone of the registration date's day, e.g. Europe/Madrid"
 // @Success		200		{object}	models.BookActivityRegistration
-// @Failure		400		{object}	models.HttpError
+// @Failure		400		{object}	models.ValidationErrorResponse
+// @Failure		409		{object}	models.HttpError
+// @Failure		503		{object}	models.HttpError
 // @Security		BearerAuth
 // @Router			/activityRegistrations/books [post]
 func handleCreateBookActivityRegistration(res http.ResponseWriter, req *http.Request) error {
@@ -149,7 +179,11 @@ func handleCreateBookActivityRegistration(res http.ResponseWriter, req *http.Req
 	validationErrs := utils.HandleValidation(req, &entryBody)
 
 	if len(validationErrs) > 0 {
-		return utils.WriteJSON(res, 400, validationErrs)
+		return utils.WriteValidationErrors(res, 400, validationErrs)
+	}
+
+	if httpErr := checkInternetArchiveBookExists(entryBody.InternetArchiveId); httpErr != nil {
+		return utils.WriteJSON(res, httpErr.Status, httpErr)
 	}
 
 	tokenClaims, claimsErr := utils.GetTokenClaimsFromRequest(req)
@@ -162,16 +196,31 @@ func handleCreateBookActivityRegistration(res http.ResponseWriter, req *http.Req
 		return utils.WriteJSON(res, 500, constants.ErrorGeneric)
 	}
 
+	userId, userIdErr := utils.UserIDFromClaims(tokenClaims)
+
+	if userIdErr != nil {
+		return utils.WriteError(res, 401, constants.ErrorTokenNotValid)
+	}
+
+	// An empty timezone is loaded as UTC
+	location, locationErr := time.LoadLocation(req.URL.Query().Get(constants.TimezoneQueryParam))
+
+	if locationErr != nil {
+		return utils.WriteJSON(res, 400, models.HttpError{Status: http.StatusBadRequest, Description: fmt.Sprintf(constants.QueryParamError, constants.TimezoneQueryParam)})
+	}
+
 	savedBookRegistration, saveBookRegistrationErr := bookRegistrationService.CreateBookActivityRegistration(
 		&entryBody,
-		uint(tokenClaims["sub"].(float64)),
+		userId,
+		location,
 	)
-	cacheEvictionErr := services.GetCacheServiceInstance().EvictUserResource(
+	services.GetCacheServiceInstance().EvictUserResource(
 		constants.BookActivityRegistrationsCacheResource,
-		savedBookRegistration.Registration.UserRefer,
+		userId,
 	)
 
-	if cacheEvictionErr != nil {
+	if isAlreadyExistsError(saveBookRegistrationErr) {
+		return utils.WriteError(res, http.StatusConflict, constants.ErrorActivityAlreadyRegistered)
 	}
 
 	if saveBookRegistrationErr != nil {
@@ -183,12 +232,15 @@ func handleCreateBookActivityRegistration(res http.ResponseWriter, req *http.Req
 
 // @Summary		Create game activity registration
 // @Description	Create a new game activity registration
+// @Description	When API_DEDUPLICATE_ACTIVITY_REGISTRATIONS is true, registering the same game twice on the same day, in the given timezone, returns the existing registration.
 // @Tags			activities
 // @Accept			json
 // @Produce		json
 // @Param			body	body		services.AddGameActivityRegistrationBody	true	"Game activity registration information"
+// @Param			tz		query		string										false	"IANA timezone of the registration date's day, e.g. Europe/Madrid"
 // @Success		200		{object}	models.GameActivityRegistration
-// @Failure		400		{object}	models.HttpError
+// @Failure		400		{object}	models.ValidationErrorResponse
+// @Failure		409		{object}	models.HttpError
 // @Security		BearerAuth
 // @Router			/activityRegistrations/games [post]
 func handleCreateGameActivityRegistration(res http.ResponseWriter, req *http.Request) error {
@@ -197,7 +249,7 @@ func handleCreateGameActivityRegistration(res http.ResponseWriter, req *http.Req
 	validationErrs := utils.HandleValidation(req, &entryBody)
 
 	if len(validationErrs) > 0 {
-		return utils.WriteJSON(res, 400, validationErrs)
+		return utils.WriteValidationErrors(res, 400, validationErrs)
 	}
 
 	tokenClaims, claimsErr := utils.GetTokenClaimsFromRequest(req)
@@ -210,18 +262,233 @@ func handleCreateGameActivityRegistration(res http.ResponseWriter, req *http.Req
 		return utils.WriteJSON(res, 500, constants.ErrorGeneric)
 	}
 
+	userId, userIdErr := utils.UserIDFromClaims(tokenClaims)
+
+	if userIdErr != nil {
+		return utils.WriteError(res, 401, constants.ErrorTokenNotValid)
+	}
+
+	// An empty timezone is loaded as UTC
+	location, locationErr := time.LoadLocation(req.URL.Query().Get(constants.TimezoneQueryParam))
+
+	if locationErr != nil {
+		return utils.WriteJSON(res, 400, models.HttpError{Status: http.StatusBadRequest, Description: fmt.Sprintf(constants.QueryParamError, constants.TimezoneQueryParam)})
+	}
+
 	savedGameRegistration, saveGameRegistrationErr := gameRegistrationService.CreateGameActivityRegistration(
 		&entryBody,
-		uint(tokenClaims["sub"].(float64)),
+		userId,
+		location,
 	)
 	services.GetCacheServiceInstance().EvictUserResource(
 		constants.GameActivityRegistrationsCacheResource,
-		savedGameRegistration.Registration.UserRefer,
+		userId,
 	)
 
+	if isAlreadyExistsError(saveGameRegistrationErr) {
+		return utils.WriteError(res, http.StatusConflict, constants.ErrorActivityAlreadyRegistered)
+	}
+
 	if saveGameRegistrationErr != nil {
 		return utils.WriteJSON(res, 400, saveGameRegistrationErr.Error())
 	}
 
 	return utils.WriteJSON(res, 200, savedGameRegistration)
 }
+
+// Checks whether the given error is due to the registration already being stored,
+// as when a unique constraint rejects a concurrent double submit.
+func isAlreadyExistsError(err error) bool {
+	var alreadyExistsErr *models.DbItemAlreadyExistsError
+
+	return errors.As(err, &alreadyExistsErr)
+}
+
+// @Summary		Get user activity feed
+// @Description	Get a page of the book and game activity registrations of a user together, sorted by registration date
+// @Tags			activities
+// @Produce		json
+// @Param			id			path		int		true	"User ID"
+// @Param			sort		query		string	false	"Registration date order, desc by default"	Enums(asc, desc)
+// @Param			type		query		string	false	"Registrations to list, all by default"	Enums(all, books, games)
+// @Param			page		query		int		false	"Page number, starting at 1"
+// @Param			pageSize	query		int		false	"Page size, 20 by default and 100 at most"
+// @Success		200			{object}	services.ActivityFeedPage
+// @Failure		400			{object}	models.HttpError
+// @Failure		403			{object}	models.HttpError
+// @Failure		404			{object}	models.HttpError
+// @Failure		500			{object}	models.HttpError
+// @Security		BearerAuth
+// @Router			/activityRegistrations/user/{id} [get]
+func handleGetUserActivityFeed(res http.ResponseWriter, req *http.Request) error {
+	userId, _ := strconv.Atoi(mux.Vars(req)["id"])
+
+	if httpErr := checkListedUserExists(uint(userId)); httpErr != nil {
+		return utils.WriteJSON(res, httpErr.Status, httpErr)
+	}
+	page, pageSize, pageErr := utils.ParsePageQueryParams(req, constants.ActivityFeedDefaultPageSize, constants.ActivityFeedMaxPageSize)
+
+	if pageErr != nil {
+		return utils.WriteError(res, 400, pageErr.Error())
+	}
+
+	query := services.ActivityFeedQuery{UserId: uint(userId), Descending: true, Page: page, PageSize: pageSize}
+
+	switch req.URL.Query().Get("sort") {
+	case "", "desc":
+	case "asc":
+		query.Descending = false
+	default:
+		return utils.WriteError(res, 400, fmt.Sprintf(constants.QueryParamError, "sort"))
+	}
+
+	if typeString := req.URL.Query().Get("type"); len(typeString) > 0 {
+		feedType, ok := activityFeedTypes[typeString]
+
+		if !ok {
+			return utils.WriteError(res, 400, fmt.Sprintf(constants.QueryParamError, "type"))
+		}
+
+		query.Type = feedType
+	}
+
+	feed, feedErr := activityFeedService.GetUserActivityFeed(query)
+
+	if feedErr != nil {
+		utils.GetCustomLogger().Errorf(
+			"Error getting activity feed of user %d: %s",
+			userId,
+			feedErr.Error(),
+		)
+		return utils.WriteError(res, 500, "could not retrieve activity feed.")
+	}
+
+	return utils.WriteJSON(res, 200, feed)
+}
+
+// @Summary		Get book activity registration
+// @Description	Get a book activity registration by its ID
+// @Tags			activities
+// @Produce		json
+// @Param			id	path		int	true	"Book activity registration ID"
+// @Success		200	{object}	models.BookActivityRegistration
+// @Failure		403	{object}	models.HttpError
+// @Failure		404	{object}	models.HttpError
+// @Security		BearerAuth
+// @Router			/activityRegistrations/books/{id} [get]
+func handleGetBookActivityRegistration(res http.ResponseWriter, req *http.Request) error {
+	registrationId, _ := strconv.Atoi(mux.Vars(req)["id"])
+
+	registration, err := bookRegistrationService.GetBookActivityRegistrationById(uint(registrationId))
+
+	if err != nil {
+		httpErr := utils.TranslateDbErrorToHttpError(err)
+		return utils.WriteJSON(res, httpErr.Status, httpErr)
+	}
+
+	return utils.WriteJSON(res, 200, registration)
+}
+
+// @Summary		Get game activity registration
+// @Description	Get a game activity registration by its ID
+// @Tags			activities
+// @Produce		json
+// @Param			id	path		int	true	"Game activity registration ID"
+// @Success		200	{object}	models.GameActivityRegistration
+// @Failure		403	{object}	models.HttpError
+// @Failure		404	{object}	models.HttpError
+// @Security		BearerAuth
+// @Router			/activityRegistrations/games/{id} [get]
+func handleGetGameActivityRegistration(res http.ResponseWriter, req *http.Request) error {
+	registrationId, _ := strconv.Atoi(mux.Vars(req)["id"])
+
+	registration, err := gameRegistrationService.GetGameActivityRegistrationById(uint(registrationId))
+
+	if err != nil {
+		httpErr := utils.TranslateDbErrorToHttpError(err)
+		return utils.WriteJSON(res, httpErr.Status, httpErr)
+	}
+
+	return utils.WriteJSON(res, 200, registration)
+}
+
+// @Summary		Update book activity registration
+// @Description	Update the registration date and the Internet Archive identifier of a book activity registration
+// @Description	When API_IA_VERIFY_IDENTIFIERS is true, the book must exist in Internet Archive.
+// @Tags			activities
+// @Accept			json
+// @Produce		json
+// @Param			id		path		int											true	"Book activity registration ID"
+// @Param			body	body		services.UpdateBookActivityRegistrationBody	true	"Updated book activity registration information"
+// @Success		200		{object}	models.BookActivityRegistration
+// @Failure		400		{object}	models.ValidationErrorResponse
+// @Failure		404		{object}	models.HttpError
+// @Failure		500		{object}	models.HttpError
+// @Security		BearerAuth
+// @Router			/activityRegistrations/books/{id} [put]
+func handleUpdateBookActivityRegistration(res http.ResponseWriter, req *http.Request) error {
+	registrationId, _ := strconv.Atoi(mux.Vars(req)["id"])
+	updateRegistrationBody := services.UpdateBookActivityRegistrationBody{}
+
+	validationErrs := utils.HandleValidation(req, &updateRegistrationBody)
+
+	if len(validationErrs) > 0 {
+		return utils.WriteValidationErrors(res, 400, validationErrs)
+	}
+
+	if httpErr := checkInternetArchiveBookExists(updateRegistrationBody.InternetArchiveId); httpErr != nil {
+		return utils.WriteJSON(res, httpErr.Status, httpErr)
+	}
+
+	updatedRegistration, updateRegistrationErr := bookRegistrationService.UpdateBookActivityRegistration(uint(registrationId), &updateRegistrationBody)
+
+	if updateRegistrationErr != nil {
+		httpErr := utils.TranslateDbErrorToHttpError(updateRegistrationErr)
+		return utils.WriteJSON(res, httpErr.Status, httpErr)
+	}
+
+	services.GetCacheServiceInstance().EvictUserResource(
+		constants.BookActivityRegistrationsCacheResource,
+		updatedRegistration.Registration.UserRefer,
+	)
+
+	return utils.WriteJSON(res, 200, updatedRegistration)
+}
+
+// @Summary		Update game activity registration
+// @Description	Update the registration date and the game name of a game activity registration
+// @Tags			activities
+// @Accept			json
+// @Produce		json
+// @Param			id		path		int											true	"Game activity registration ID"
+// @Param			body	body		services.UpdateGameActivityRegistrationBody	true	"Updated game activity registration information"
+// @Success		200		{object}	models.GameActivityRegistration
+// @Failure		400		{object}	models.ValidationErrorResponse
+// @Failure		404		{object}	models.HttpError
+// @Failure		500		{object}	models.HttpError
+// @Security		BearerAuth
+// @Router			/activityRegistrations/games/{id} [put]
+func handleUpdateGameActivityRegistration(res http.ResponseWriter, req *http.Request) error {
+	registrationId, _ := strconv.Atoi(mux.Vars(req)["id"])
+	updateRegistrationBody := services.UpdateGameActivityRegistrationBody{}
+
+	validationErrs := utils.HandleValidation(req, &updateRegistrationBody)
+
+	if len(validationErrs) > 0 {
+		return utils.WriteValidationErrors(res, 400, validationErrs)
+	}
+
+	updatedRegistration, updateRegistrationErr := gameRegistrationService.UpdateGameActivityRegistration(uint(registrationId), &updateRegistrationBody)
+
+	if updateRegistrationErr != nil {
+		httpErr := utils.TranslateDbErrorToHttpError(updateRegistrationErr)
+		return utils.WriteJSON(res, httpErr.Status, httpErr)
+	}
+
+	services.GetCacheServiceInstance().EvictUserResource(
+		constants.GameActivityRegistrationsCacheResource,
+		updatedRegistration.Registration.UserRefer,
+	)
+
+	return utils.WriteJSON(res, 200, updatedRegistration)
+}
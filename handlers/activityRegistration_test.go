@@ -0,0 +1,55 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/adfer-dev/analock-api/auth"
+	"github.com/adfer-dev/analock-api/constants"
+	"github.com/adfer-dev/analock-api/models"
+	"github.com/adfer-dev/analock-api/services"
+	"github.com/adfer-dev/analock-api/storage/memory"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+// Game registration storage in which every game is already registered, as if a unique constraint rejected it.
+type registeredGamesStorage struct {
+	*memory.GameActivityRegistrationStorage
+}
+
+func (gameStorage *registeredGamesStorage) Create(data interface{}) error {
+	return &models.DbItemAlreadyExistsError{DbItem: &models.GameActivityRegistration{}}
+}
+
+func TestHandleCreateGameActivityRegistrationConflict(t *testing.T) {
+	t.Setenv("API_CACHE_EXPIRATION", "1h")
+	t.Setenv("API_CACHE_EVICTION_INTERVAL", "1h")
+
+	var userId uint = 4331
+	database := memory.NewDatabase()
+
+	originalGameRegistrationService := gameRegistrationService
+	gameRegistrationService = services.NewGameActivityRegistrationServiceImpl(
+		&registeredGamesStorage{memory.NewGameActivityRegistrationStorage(database)},
+		memory.NewActivityRegistrationStorage(database),
+	)
+	defer func() { gameRegistrationService = originalGameRegistrationService }()
+
+	accessToken, tokenErr := auth.GetTokenManager().GenerateToken(models.User{Id: userId}, models.Access)
+	assert.NoError(t, tokenErr)
+
+	router := mux.NewRouter()
+	InitActivityRegistrationRoutes(router)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/activityRegistrations/games", strings.NewReader(`{"gameName":"sudoku","registrationDate":1700000005}`))
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	res := httptest.NewRecorder()
+
+	router.ServeHTTP(res, req)
+
+	assert.Equal(t, http.StatusConflict, res.Code)
+	assert.Contains(t, res.Body.String(), constants.ErrorActivityAlreadyRegistered)
+}
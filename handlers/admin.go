@@ -0,0 +1,276 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/adfer-dev/analock-api/constants"
+	"github.com/adfer-dev/analock-api/jobs"
+	"github.com/adfer-dev/analock-api/models"
+	"github.com/adfer-dev/analock-api/services"
+	"github.com/adfer-dev/analock-api/storage"
+	"github.com/adfer-dev/analock-api/utils"
+	"github.com/gorilla/mux"
+)
+
+type SweepOrphanRegistrationsResponse struct {
+	Deleted int64 `json:"deleted"`
+}
+
+type RunJobResponse struct {
+	Job string `json:"job"`
+}
+
+var orphanRegistrationSweeper services.OrphanRegistrationSweeper = services.NewOrphanRegistrationSweeperImpl(&storage.ActivityRegistrationStorage{})
+var platformStatsService services.PlatformStatsService = services.NewPlatformStatsServiceImpl(&storage.PlatformStatsStorage{})
+
+func InitAdminRoutes(router *mux.Router) {
+	router.HandleFunc("/api/v1/admin/users", utils.ParseToHandlerFunc(handleListUsers)).Methods("GET")
+	router.HandleFunc("/api/v1/admin/jobs/{jobName}/run", utils.ParseToHandlerFunc(handleRunJob)).Methods("POST")
+	router.HandleFunc("/api/v1/admin/users/{id}/impersonate", utils.ParseToHandlerFunc(handleImpersonateUser)).Methods("POST")
+	router.HandleFunc("/api/v1/admin/stats", utils.ParseToHandlerFunc(handleGetPlatformStats)).Methods("GET")
+
+	if services.IsOrphanRegistrationSweeperEnabled() {
+		router.HandleFunc("/api/v1/admin/activityRegistrations/orphans", utils.ParseToHandlerFunc(handleSweepOrphanRegistrations)).Methods("DELETE")
+	}
+}
+
+// @Summary		Sweep orphan activity registrations
+// @Description	Deletes the activity registrations that have no diary entry, book or game registration attached.
+// @Description	Only available to admins and when API_ORPHAN_SWEEPER_ENABLED is true.
+// @Tags			admin
+// @Produce		json
+// @Success		200	{object}	SweepOrphanRegistrationsResponse
+// @Failure		403	{object}	models.HttpError
+// @Failure		409	{object}	models.HttpError
+// @Failure		500	{object}	models.HttpError
+// @Security		BearerAuth
+// @Router			/admin/activityRegistrations/orphans [delete]
+func handleSweepOrphanRegistrations(res http.ResponseWriter, req *http.Request) error {
+	tokenClaims, claimsErr := utils.GetTokenClaimsFromRequest(req)
+
+	if claimsErr != nil {
+		utils.GetCustomLogger().Errorf(
+			"Error getting claims on sweep orphan registrations: %s",
+			claimsErr.Error(),
+		)
+		return utils.WriteJSON(res, 500, constants.ErrorGeneric)
+	}
+
+	userId, userIdErr := utils.UserIDFromClaims(tokenClaims)
+
+	if userIdErr != nil {
+		return utils.WriteError(res, 401, constants.ErrorTokenNotValid)
+	}
+
+	user, userErr := userService.GetUserById(userId)
+
+	if userErr != nil {
+		httpErr := utils.TranslateDbErrorToHttpError(userErr)
+		return utils.WriteJSON(res, httpErr.Status, httpErr)
+	}
+
+	if user.Role != models.Admin {
+		return utils.WriteError(res, 403, constants.ErrorUnauthorizedOperation)
+	}
+
+	deleted, sweepErr := orphanRegistrationSweeper.Sweep()
+
+	if errors.Is(sweepErr, services.ErrSweepWritesInFlight) {
+		return utils.WriteError(res, 409, sweepErr.Error())
+	}
+
+	if sweepErr != nil {
+		return utils.WriteJSON(res, 500, sweepErr.Error())
+	}
+
+	utils.GetCustomLogger().Infof("Deleted %d orphan activity registrations\n", deleted)
+
+	return utils.WriteJSON(res, 200, SweepOrphanRegistrationsResponse{Deleted: deleted})
+}
+
+// @Summary		Run a job
+// @Description	Runs the scheduled job with the given name now, waiting for it to finish.
+// @Description	Only available to admins.
+// @Tags			admin
+// @Produce		json
+// @Param			jobName	path		string	true	"Name of the job"
+// @Success		200	{object}	RunJobResponse
+// @Failure		403	{object}	models.HttpError
+// @Failure		404	{object}	models.HttpError
+// @Failure		500	{object}	models.HttpError
+// @Security		BearerAuth
+// @Router			/admin/jobs/{jobName}/run [post]
+func handleRunJob(res http.ResponseWriter, req *http.Request) error {
+	jobName := mux.Vars(req)["jobName"]
+	runErr := jobs.GetSchedulerInstance().Trigger(jobName)
+
+	if errors.Is(runErr, jobs.ErrJobNotFound) {
+		return utils.WriteError(res, 404, runErr.Error())
+	}
+
+	if runErr != nil {
+		utils.GetCustomLogger().Errorf(
+			"Error running job %s: %s",
+			jobName,
+			runErr.Error(),
+		)
+		return utils.WriteError(res, 500, "could not run the job.")
+	}
+
+	return utils.WriteJSON(res, 200, RunJobResponse{Job: jobName})
+}
+
+// @Summary		List users
+// @Description	Lists a page of users, optionally filtered by role and by a fragment of their email, and sorted by creation date or email.
+// @Description	Only available to admins.
+// @Tags			admin
+// @Produce		json
+// @Param			page			query		int		false	"Page number, starting at 1"
+// @Param			pageSize		query		int		false	"Page size, 20 by default and 100 at most"
+// @Param			role			query		string	false	"Role of the users"	Enums(admin, standard)
+// @Param			emailContains	query		string	false	"Fragment the email of the users contains, case insensitive"
+// @Param			sortBy			query		string	false	"Field to sort users by, created_at by default"	Enums(created_at, email)
+// @Success		200	{object}	services.UserPage
+// @Failure		400	{object}	models.HttpError
+// @Failure		403	{object}	models.HttpError
+// @Failure		500	{object}	models.HttpError
+// @Security		BearerAuth
+// @Router			/admin/users [get]
+func handleListUsers(res http.ResponseWriter, req *http.Request) error {
+	page, pageSize, pageErr := utils.ParsePageQueryParams(req, constants.AdminUserListDefaultPageSize, constants.AdminUserListMaxPageSize)
+
+	if pageErr != nil {
+		return utils.WriteError(res, 400, pageErr.Error())
+	}
+
+	queryParams := req.URL.Query()
+	query := services.UserListQuery{
+		EmailContains: queryParams.Get("emailContains"),
+		SortBy:        models.UserSortByCreatedAt,
+		Page:          page,
+		PageSize:      pageSize,
+	}
+
+	if roleString := queryParams.Get("role"); len(roleString) > 0 {
+		role, ok := models.ParseUserRole(roleString)
+
+		if !ok {
+			return utils.WriteError(res, 400, fmt.Sprintf(constants.QueryParamError, "role"))
+		}
+
+		query.Role = role
+	}
+
+	if sortBy := models.UserSortField(queryParams.Get("sortBy")); len(sortBy) > 0 {
+		if sortBy != models.UserSortByCreatedAt && sortBy != models.UserSortByEmail {
+			return utils.WriteError(res, 400, fmt.Sprintf(constants.QueryParamError, "sortBy"))
+		}
+
+		query.SortBy = sortBy
+	}
+
+	users, listErr := userService.ListUsers(query)
+
+	if listErr != nil {
+		utils.GetCustomLogger().Errorf(
+			"Error listing users: %s",
+			listErr.Error(),
+		)
+		return utils.WriteError(res, 500, "could not list users.")
+	}
+
+	return utils.WriteJSON(res, 200, users)
+}
+
+// @Summary		Impersonate a user
+// @Description	Issues a short-lived access token of the given user, for support purposes. No refresh token is issued.
+// @Description	The token holds the admin id in its impersonatedBy claim and every impersonation is logged.
+// @Description	Only available to admins, and admins cannot be impersonated.
+// @Tags			admin
+// @Produce		json
+// @Param			id	path		int	true	"User ID"
+// @Success		200	{object}	services.ImpersonationResponse
+// @Failure		401	{object}	models.HttpError
+// @Failure		403	{object}	models.HttpError
+// @Failure		404	{object}	models.HttpError
+// @Failure		500	{object}	models.HttpError
+// @Security		BearerAuth
+// @Router			/admin/users/{id}/impersonate [post]
+func handleImpersonateUser(res http.ResponseWriter, req *http.Request) error {
+	userId, _ := strconv.Atoi(mux.Vars(req)["id"])
+
+	tokenClaims, claimsErr := utils.GetTokenClaimsFromRequest(req)
+
+	if claimsErr != nil {
+		utils.GetCustomLogger().Errorf(
+			"Error getting claims on impersonate user: %s",
+			claimsErr.Error(),
+		)
+		return utils.WriteJSON(res, 500, constants.ErrorGeneric)
+	}
+
+	adminId, adminIdErr := utils.UserIDFromClaims(tokenClaims)
+
+	if adminIdErr != nil {
+		return utils.WriteError(res, 401, constants.ErrorTokenNotValid)
+	}
+
+	impersonation, impersonateErr := authService.ImpersonateUser(adminId, uint(userId))
+
+	if impersonateErr != nil {
+		httpErr := translateAuthErrorToHttpError(impersonateErr)
+		return utils.WriteJSON(res, httpErr.Status, httpErr)
+	}
+
+	return utils.WriteJSON(res, 200, impersonation)
+}
+
+// @Summary		Get platform stats
+// @Description	Gets the total users, diary entries, book and game registrations, and the users created within the last given days.
+// @Description	The stats are cached for a minute by default. Only available to admins.
+// @Tags			admin
+// @Produce		json
+// @Param			days			query		int		false	"Days users count as new within, 7 by default and 365 at most"
+// @Param			refresh			query		bool	false	"Skip cached values and refresh them"
+// @Param			Cache-Control	header		string	false	"no-cache skips cached values and refreshes them"
+// @Success		200	{object}	models.PlatformStats
+// @Failure		400	{object}	models.HttpError
+// @Failure		403	{object}	models.HttpError
+// @Failure		500	{object}	models.HttpError
+// @Security		BearerAuth
+// @Router			/admin/stats [get]
+func handleGetPlatformStats(res http.ResponseWriter, req *http.Request) error {
+	days := constants.PlatformStatsDefaultNewUsersDays
+
+	if daysString := req.URL.Query().Get("days"); len(daysString) > 0 {
+		parsedDays, parseErr := strconv.Atoi(daysString)
+
+		if parseErr != nil || parsedDays <= 0 || parsedDays > constants.PlatformStatsMaxNewUsersDays {
+			return utils.WriteError(res, 400, fmt.Sprintf(constants.QueryParamError, "days"))
+		}
+
+		days = parsedDays
+	}
+
+	stats, statsErr := services.GetCacheServiceInstance().CacheResource(
+		func() (interface{}, error) {
+			return platformStatsService.GetPlatformStats(days)
+		},
+		constants.PlatformStatsCacheResource,
+		strconv.Itoa(days),
+		cacheBypassRequested(req),
+	)
+
+	if statsErr != nil {
+		utils.GetCustomLogger().Errorf(
+			"Error getting platform stats: %s",
+			statsErr.Error(),
+		)
+		return utils.WriteError(res, 500, "could not get the platform stats.")
+	}
+
+	return utils.WriteJSON(res, 200, stats)
+}
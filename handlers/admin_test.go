@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/adfer-dev/analock-api/auth"
+	"github.com/adfer-dev/analock-api/constants"
+	"github.com/adfer-dev/analock-api/models"
+	"github.com/adfer-dev/analock-api/services"
+	"github.com/adfer-dev/analock-api/storage/memory"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHandleGetPlatformStats(t *testing.T) {
+	t.Setenv("API_CACHE_EXPIRATION", "1h")
+	t.Setenv("API_CACHE_EVICTION_INTERVAL", "1h")
+
+	var adminId uint = 4341
+	useExistingAdmins(t, adminId)
+
+	database := memory.NewDatabase()
+	userStorage := memory.NewUserStorage(database)
+	now := time.Now().Unix()
+	assert.NoError(t, userStorage.Create(&models.User{Email: "recent@example.com", CreatedAt: now - constants.DaySeconds}))
+	assert.NoError(t, userStorage.Create(&models.User{Email: "old@example.com", CreatedAt: now - 60*constants.DaySeconds}))
+
+	originalPlatformStatsService := platformStatsService
+	platformStatsService = services.NewPlatformStatsServiceImpl(memory.NewPlatformStatsStorage(database))
+	defer func() { platformStatsService = originalPlatformStatsService }()
+
+	accessToken, tokenErr := auth.GetTokenManager().GenerateToken(models.User{Id: adminId}, models.Access)
+	assert.NoError(t, tokenErr)
+
+	router := mux.NewRouter()
+	InitAdminRoutes(router)
+
+	getStats := func(query string) (*httptest.ResponseRecorder, models.PlatformStats) {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/admin/stats"+query, nil)
+		req.Header.Set("Authorization", "Bearer "+accessToken)
+		res := httptest.NewRecorder()
+
+		router.ServeHTTP(res, req)
+
+		var stats models.PlatformStats
+		json.Unmarshal(res.Body.Bytes(), &stats)
+
+		return res, stats
+	}
+
+	// Test case: New users are counted within the default number of days
+	res, stats := getStats("")
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, models.PlatformStats{TotalUsers: 2, NewUsers: 1, NewUsersDays: constants.PlatformStatsDefaultNewUsersDays}, stats)
+
+	// Test case: New users are counted within the given number of days
+	res, stats = getStats("?days=90")
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, models.PlatformStats{TotalUsers: 2, NewUsers: 2, NewUsersDays: 90}, stats)
+
+	// Test case: The stats are cached until a refresh is requested
+	assert.NoError(t, userStorage.Create(&models.User{Email: "newest@example.com", CreatedAt: now}))
+
+	_, stats = getStats("")
+	assert.Equal(t, int64(2), stats.TotalUsers)
+
+	_, stats = getStats("?refresh=true")
+	assert.Equal(t, models.PlatformStats{TotalUsers: 3, NewUsers: 2, NewUsersDays: constants.PlatformStatsDefaultNewUsersDays}, stats)
+
+	// Test case: Days must be positive and within the max
+	for _, query := range []string{"?days=0", "?days=366", "?days=week"} {
+		res, _ = getStats(query)
+		assert.Equal(t, http.StatusBadRequest, res.Code, query)
+	}
+}
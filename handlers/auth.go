@@ -1,13 +1,17 @@
 package handlers
 
 import (
-	"fmt"
-	"log"
+	"errors"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/adfer-dev/analock-api/auth"
+	"github.com/adfer-dev/analock-api/config"
+	"github.com/adfer-dev/analock-api/constants"
 	"github.com/adfer-dev/analock-api/models"
 	"github.com/adfer-dev/analock-api/services"
+	"github.com/adfer-dev/analock-api/storage"
 	"github.com/adfer-dev/analock-api/utils"
 	"github.com/gorilla/mux"
 )
@@ -15,24 +19,40 @@ import (
 func InitAuthRoutes(router *mux.Router) {
 	router.HandleFunc("/api/v1/auth/authenticate", utils.ParseToHandlerFunc(handleAuthenticateUser)).Methods("POST")
 	router.HandleFunc("/api/v1/auth/refreshToken", utils.ParseToHandlerFunc(handleRefreshToken)).Methods("POST")
+	router.HandleFunc("/api/v1/auth/external-login", utils.ParseToHandlerFunc(handleUpdateExternalLoginToken)).Methods("PUT")
+	router.HandleFunc("/api/v1/auth/link-provider", utils.ParseToHandlerFunc(handleLinkProvider)).Methods("POST")
+	router.HandleFunc("/api/v1/auth/token-info", utils.ParseToHandlerFunc(handleGetTokenInfo)).Methods("GET")
+	router.HandleFunc("/api/v1/auth/sessions", utils.ParseToHandlerFunc(handleGetSessions)).Methods("GET")
+	router.HandleFunc("/api/v1/auth/sessions/{id}", utils.ParseToHandlerFunc(handleRevokeSession)).Methods("DELETE")
+	router.HandleFunc("/api/v1/auth/logout", utils.ParseToHandlerFunc(handleLogOut)).Methods("POST")
+}
+
+type TokenInfoResponse struct {
+	// Expiration time of the token, in unix seconds.
+	ExpiresAt        int64  `json:"exp"`
+	ExpiresInSeconds int64  `json:"expiresInSeconds"`
+	Kind             string `json:"kind" example:"access"`
 }
 
 var authService *services.AuthService = services.NewAuthService(
 	services.NewGoogleTokenValidatorImpl(),
+	services.NewAppleTokenValidatorImpl(),
 	auth.GetTokenManager(),
-	&services.UserServiceImpl{},
-	&services.TokenServiceImpl{},
-	&services.ExternalLoginServiceImpl{},
+	services.NewUserServiceImpl(&storage.UserStorage{}),
+	services.NewTokenServiceImpl(&storage.TokenStorage{}),
+	services.NewExternalLoginServiceImpl(&storage.ExternalLoginStorage{}),
 )
 
 // @Summary		Authenticate user
-// @Description	Authenticates a user and returns access and refresh tokens
+// @Description	Authenticates a user and returns access and refresh tokens, along with the user's profile
 // @Tags			auth
 // @Accept			json
 // @Produce		json
 // @Param			body	body		services.UserAuthenticateBody	true	"Authentication request"
 // @Success		200		{object}	services.TokenResponse
-// @Failure		400		{object}	models.HttpError
+// @Failure		400		{object}	models.ValidationErrorResponse
+// @Failure		401		{object}	models.HttpError
+// @Failure		403		{object}	models.HttpError
 // @Failure		500		{object}	models.HttpError
 // @Router			/auth/authenticate [post]
 func handleAuthenticateUser(res http.ResponseWriter, req *http.Request) error {
@@ -41,12 +61,22 @@ func handleAuthenticateUser(res http.ResponseWriter, req *http.Request) error {
 	validationErrs := utils.HandleValidation(req, &authenticateBody)
 
 	if len(validationErrs) > 0 {
-		return utils.WriteJSON(res, 400, validationErrs)
+		return utils.WriteValidationErrors(res, 400, validationErrs)
 	}
 
-	accessToken, refreshToken, authErr := authService.AuthenticateUser(authenticateBody)
+	accessToken, refreshToken, user, authErr := authService.AuthenticateUser(authenticateBody)
 
 	if authErr != nil {
+		utils.GetCustomLogger().Errorf(
+			"Error authenticating user %s: %s\n",
+			utils.MaskEmail(authenticateBody.Email),
+			authErr.Error(),
+		)
+
+		if httpErr := translateAuthErrorToHttpError(authErr); httpErr.Status != http.StatusInternalServerError {
+			return utils.WriteJSON(res, httpErr.Status, httpErr)
+		}
+
 		return utils.WriteJSON(res, 500, models.HttpError{Status: http.StatusInternalServerError, Description: "Error happenned when authenticating user. Please, try again."})
 	}
 
@@ -55,9 +85,13 @@ func handleAuthenticateUser(res http.ResponseWriter, req *http.Request) error {
 	if claimsErr != nil {
 		return claimsErr
 	}
-	res.Header().Add("Set-Cookie", fmt.Sprintf("refreshToken=%s; Expires=%d; HttpOnly", refreshToken.TokenValue, int64(claims["exp"].(float64))))
+	http.SetCookie(res, buildRefreshTokenCookie(refreshToken.TokenValue, time.Unix(int64(claims["exp"].(float64)), 0)))
 	return utils.WriteJSON(res, 200,
-		services.TokenResponse{AccessToken: accessToken.TokenValue, RefreshToken: refreshToken.TokenValue})
+		services.TokenResponse{
+			AccessToken:  accessToken.TokenValue,
+			RefreshToken: refreshToken.TokenValue,
+			User:         services.NewUserProfileResponse(user),
+		})
 }
 
 // @Summary		Refresh access token
@@ -67,7 +101,10 @@ func handleAuthenticateUser(res http.ResponseWriter, req *http.Request) error {
 // @Produce		json
 // @Param			body	body		services.RefreshTokenRequest	true	"Refresh token request"
 // @Success		200		{object}	services.TokenResponse
-// @Failure		403		{object}	models.HttpError
+// @Failure		401		{object}	models.HttpError
+// @Failure		403		{object}	models.ValidationErrorResponse
+// @Failure		404		{object}	models.HttpError
+// @Failure		500		{object}	models.HttpError
 // @Router			/auth/refreshToken [post]
 func handleRefreshToken(res http.ResponseWriter, req *http.Request) error {
 	authenticateBody := services.RefreshTokenRequest{}
@@ -75,16 +112,317 @@ func handleRefreshToken(res http.ResponseWriter, req *http.Request) error {
 	validationErrs := utils.HandleValidation(req, &authenticateBody)
 
 	if len(validationErrs) > 0 {
-		return utils.WriteJSON(res, 403, validationErrs)
+		return utils.WriteValidationErrors(res, 403, validationErrs)
 	}
 
 	newAccessToken, refreshTokenErr := authService.RefreshToken(authenticateBody)
 
-	log.Println(refreshTokenErr)
-
 	if refreshTokenErr != nil {
-		return utils.WriteJSON(res, 403, refreshTokenErr)
+		utils.GetCustomLogger().Errorf(
+			"Error refreshing token %s: %s\n",
+			utils.MaskSecret(authenticateBody.RefreshToken),
+			refreshTokenErr.Error(),
+		)
+		httpErr := translateAuthErrorToHttpError(refreshTokenErr)
+		return utils.WriteJSON(res, httpErr.Status, httpErr)
 	}
 
 	return utils.WriteJSON(res, 200, newAccessToken)
 }
+
+// @Summary		Update external login token
+// @Description	Validates a fresh provider token and stores it as the authenticated user's external login token
+// @Tags			auth
+// @Accept			json
+// @Produce		json
+// @Param			body	body		services.UpdateExternalLoginTokenBody	true	"New provider token"
+// @Success		200		{object}	services.ExternalLoginResponse
+// @Failure		400		{object}	models.ValidationErrorResponse
+// @Failure		401		{object}	models.HttpError
+// @Failure		404		{object}	models.HttpError
+// @Failure		500		{object}	models.HttpError
+// @Security		BearerAuth
+// @Router			/auth/external-login [put]
+func handleUpdateExternalLoginToken(res http.ResponseWriter, req *http.Request) error {
+	updateBody := services.UpdateExternalLoginTokenBody{}
+
+	validationErrs := utils.HandleValidation(req, &updateBody)
+
+	if len(validationErrs) > 0 {
+		return utils.WriteValidationErrors(res, 400, validationErrs)
+	}
+
+	tokenClaims, claimsErr := utils.GetTokenClaimsFromRequest(req)
+
+	if claimsErr != nil {
+		utils.GetCustomLogger().Errorf(
+			"Error getting claims on update external login token: %s",
+			claimsErr.Error(),
+		)
+		return utils.WriteJSON(res, 500, constants.ErrorGeneric)
+	}
+
+	userId, userIdErr := utils.UserIDFromClaims(tokenClaims)
+
+	if userIdErr != nil {
+		return utils.WriteError(res, 401, constants.ErrorTokenNotValid)
+	}
+
+	externalLogin, updateErr := authService.UpdateExternalLoginToken(userId, updateBody)
+
+	if updateErr != nil {
+		httpErr := translateAuthErrorToHttpError(updateErr)
+		return utils.WriteJSON(res, httpErr.Status, httpErr)
+	}
+
+	return utils.WriteJSON(res, 200, externalLogin)
+}
+
+// @Summary		Link login provider
+// @Description	Validates the given provider token and links the provider account to the authenticated user, returning the providers linked to it
+// @Description	The provider is either google or apple, and the token must be issued for the account with the given provider id.
+// @Description	Apple accounts can only be linked when API_APPLE_CLIENT_ID is set.
+// @Tags			auth
+// @Accept			json
+// @Produce		json
+// @Param			body	body		services.LinkProviderBody	true	"Provider to link"
+// @Success		200		{object}	services.LinkedProvidersResponse
+// @Failure		400		{object}	models.ValidationErrorResponse
+// @Failure		401		{object}	models.HttpError
+// @Failure		409		{object}	models.HttpError
+// @Failure		500		{object}	models.HttpError
+// @Security		BearerAuth
+// @Router			/auth/link-provider [post]
+func handleLinkProvider(res http.ResponseWriter, req *http.Request) error {
+	linkBody := services.LinkProviderBody{}
+
+	validationErrs := utils.HandleValidation(req, &linkBody)
+
+	if len(validationErrs) > 0 {
+		return utils.WriteValidationErrors(res, 400, validationErrs)
+	}
+
+	tokenClaims, claimsErr := utils.GetTokenClaimsFromRequest(req)
+
+	if claimsErr != nil {
+		utils.GetCustomLogger().Errorf(
+			"Error getting claims on link provider: %s",
+			claimsErr.Error(),
+		)
+		return utils.WriteJSON(res, 500, constants.ErrorGeneric)
+	}
+
+	userId, userIdErr := utils.UserIDFromClaims(tokenClaims)
+
+	if userIdErr != nil {
+		return utils.WriteError(res, 401, constants.ErrorTokenNotValid)
+	}
+
+	linkedProviders, linkErr := authService.LinkProvider(userId, linkBody)
+
+	if linkErr != nil {
+		httpErr := translateAuthErrorToHttpError(linkErr)
+		return utils.WriteJSON(res, httpErr.Status, httpErr)
+	}
+
+	return utils.WriteJSON(res, 200, linkedProviders)
+}
+
+// @Summary		Get token info
+// @Description	Gets the expiration time and kind of the access token the request is authorized with,
+// @Description	so clients can refresh it before it expires without decoding it.
+// @Description	Tokens issued to admins impersonating a user have the impersonation kind.
+// @Tags			auth
+// @Produce		json
+// @Success		200	{object}	TokenInfoResponse
+// @Failure		401	{object}	models.HttpError
+// @Security		BearerAuth
+// @Router			/auth/token-info [get]
+func handleGetTokenInfo(res http.ResponseWriter, req *http.Request) error {
+	tokenClaims, claimsErr := utils.GetTokenClaimsFromRequest(req)
+
+	if claimsErr != nil {
+		return utils.WriteError(res, 401, constants.ErrorTokenNotValid)
+	}
+
+	expiration, hasExpiration := auth.GetTokenExpiration(tokenClaims)
+
+	if !hasExpiration {
+		return utils.WriteError(res, 401, constants.ErrorTokenNotValid)
+	}
+
+	kind := auth.GetTokenKind(tokenClaims)
+
+	if _, impersonated := tokenClaims[auth.ImpersonatedByClaim]; impersonated {
+		kind = models.Impersonation
+	}
+
+	return utils.WriteJSON(res, 200, TokenInfoResponse{
+		ExpiresAt:        expiration.Unix(),
+		ExpiresInSeconds: max(int64(time.Until(expiration).Seconds()), 0),
+		Kind:             kind.String(),
+	})
+}
+
+// @Summary		List sessions
+// @Description	Lists the sessions of the authenticated user, with the time each one was created and last used, in Unix seconds.
+// @Description	A user only has one refresh token, so at most one session is returned. Sessions have no device identifier.
+// @Tags			auth
+// @Produce		json
+// @Success		200	{array}		models.Session
+// @Failure		401	{object}	models.HttpError
+// @Failure		500	{object}	models.HttpError
+// @Security		BearerAuth
+// @Router			/auth/sessions [get]
+func handleGetSessions(res http.ResponseWriter, req *http.Request) error {
+	tokenClaims, claimsErr := utils.GetTokenClaimsFromRequest(req)
+
+	if claimsErr != nil {
+		utils.GetCustomLogger().Errorf(
+			"Error getting claims on get sessions: %s",
+			claimsErr.Error(),
+		)
+		return utils.WriteJSON(res, 500, constants.ErrorGeneric)
+	}
+
+	userId, userIdErr := utils.UserIDFromClaims(tokenClaims)
+
+	if userIdErr != nil {
+		return utils.WriteError(res, 401, constants.ErrorTokenNotValid)
+	}
+
+	sessions, getSessionsErr := authService.GetUserSessions(userId)
+
+	if getSessionsErr != nil {
+		httpErr := translateAuthErrorToHttpError(getSessionsErr)
+		return utils.WriteJSON(res, httpErr.Status, httpErr)
+	}
+
+	return utils.WriteJSON(res, 200, sessions)
+}
+
+// @Summary		Revoke session
+// @Description	Revokes a session of the authenticated user, so its refresh token can no longer be used
+// @Tags			auth
+// @Param			id	path	int	true	"Session ID"
+// @Success		204
+// @Failure		401	{object}	models.HttpError
+// @Failure		404	{object}	models.HttpError
+// @Failure		500	{object}	models.HttpError
+// @Security		BearerAuth
+// @Router			/auth/sessions/{id} [delete]
+func handleRevokeSession(res http.ResponseWriter, req *http.Request) error {
+	sessionId, _ := strconv.Atoi(mux.Vars(req)["id"])
+
+	tokenClaims, claimsErr := utils.GetTokenClaimsFromRequest(req)
+
+	if claimsErr != nil {
+		utils.GetCustomLogger().Errorf(
+			"Error getting claims on revoke session: %s",
+			claimsErr.Error(),
+		)
+		return utils.WriteJSON(res, 500, constants.ErrorGeneric)
+	}
+
+	userId, userIdErr := utils.UserIDFromClaims(tokenClaims)
+
+	if userIdErr != nil {
+		return utils.WriteError(res, 401, constants.ErrorTokenNotValid)
+	}
+
+	if revokeErr := authService.RevokeUserSession(userId, uint(sessionId)); revokeErr != nil {
+		httpErr := translateAuthErrorToHttpError(revokeErr)
+		return utils.WriteJSON(res, httpErr.Status, httpErr)
+	}
+
+	res.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+// @Summary		Log out
+// @Description	Logs the authenticated user out, deleting its access and refresh tokens.
+// @Description	If the API has a deleted token grace period, the access token can still be used for GET requests during it.
+// @Tags			auth
+// @Success		204
+// @Failure		401	{object}	models.HttpError
+// @Failure		500	{object}	models.HttpError
+// @Security		BearerAuth
+// @Router			/auth/logout [post]
+func handleLogOut(res http.ResponseWriter, req *http.Request) error {
+	tokenClaims, claimsErr := utils.GetTokenClaimsFromRequest(req)
+
+	if claimsErr != nil {
+		utils.GetCustomLogger().Errorf(
+			"Error getting claims on log out: %s",
+			claimsErr.Error(),
+		)
+		return utils.WriteJSON(res, 500, constants.ErrorGeneric)
+	}
+
+	userId, userIdErr := utils.UserIDFromClaims(tokenClaims)
+
+	if userIdErr != nil {
+		return utils.WriteError(res, 401, constants.ErrorTokenNotValid)
+	}
+
+	if logOutErr := authService.LogOutUser(userId); logOutErr != nil {
+		httpErr := translateAuthErrorToHttpError(logOutErr)
+		return utils.WriteJSON(res, httpErr.Status, httpErr)
+	}
+
+	res.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+// Builds the cookie holding the given refresh token, which expires along with it.
+// The cookie is only sent over HTTPS unless running in the local environment.
+func buildRefreshTokenCookie(refreshToken string, expiration time.Time) *http.Cookie {
+	return &http.Cookie{
+		Name:     constants.RefreshTokenCookieName,
+		Value:    refreshToken,
+		Path:     constants.RefreshTokenCookiePath,
+		Expires:  expiration,
+		MaxAge:   max(int(time.Until(expiration).Seconds()), 1),
+		HttpOnly: true,
+		Secure:   !config.Get().IsLocal(),
+		SameSite: getRefreshTokenCookieSameSite(),
+	}
+}
+
+// Gets the SameSite attribute of the refresh token cookie from the config.
+func getRefreshTokenCookieSameSite() http.SameSite {
+	if config.Get().RefreshCookieSameSite == "lax" {
+		return http.SameSiteLaxMode
+	}
+
+	return http.SameSiteStrictMode
+}
+
+// Maps the sentinel errors returned by the auth service to HttpError structs.
+// Other errors are translated as database errors.
+func translateAuthErrorToHttpError(err error) *models.HttpError {
+	switch {
+	case errors.Is(err, services.ErrRefreshTokenExpired):
+		return &models.HttpError{Status: http.StatusUnauthorized, Description: services.ErrRefreshTokenExpired.Error()}
+	case errors.Is(err, services.ErrInvalidToken):
+		return &models.HttpError{Status: http.StatusUnauthorized, Description: services.ErrInvalidToken.Error()}
+	case errors.Is(err, services.ErrProviderTokenInvalid):
+		return &models.HttpError{Status: http.StatusUnauthorized, Description: services.ErrProviderTokenInvalid.Error()}
+	case errors.Is(err, services.ErrProviderNotSupported):
+		return &models.HttpError{Status: http.StatusBadRequest, Description: services.ErrProviderNotSupported.Error()}
+	case errors.Is(err, services.ErrProviderAlreadyLinked):
+		return &models.HttpError{Status: http.StatusConflict, Description: services.ErrProviderAlreadyLinked.Error()}
+	case errors.Is(err, services.ErrSignupClosed):
+		return &models.HttpError{Status: http.StatusForbidden, Description: services.ErrSignupClosed.Error()}
+	case errors.Is(err, services.ErrInviteCodeInvalid):
+		return &models.HttpError{Status: http.StatusForbidden, Description: services.ErrInviteCodeInvalid.Error()}
+	case errors.Is(err, services.ErrImpersonationNotAllowed):
+		return &models.HttpError{Status: http.StatusForbidden, Description: services.ErrImpersonationNotAllowed.Error()}
+	case errors.Is(err, services.ErrSessionNotFound):
+		return &models.HttpError{Status: http.StatusNotFound, Description: services.ErrSessionNotFound.Error()}
+	case errors.Is(err, services.ErrUserNotFound):
+		return &models.HttpError{Status: http.StatusNotFound, Description: services.ErrUserNotFound.Error()}
+	default:
+		return utils.TranslateDbErrorToHttpError(err)
+	}
+}
@@ -0,0 +1,179 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/adfer-dev/analock-api/auth"
+	"github.com/adfer-dev/analock-api/constants"
+	"github.com/adfer-dev/analock-api/models"
+	"github.com/adfer-dev/analock-api/services"
+	"github.com/golang-jwt/jwt"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTranslateAuthErrorToHttpError(t *testing.T) {
+	tests := []struct {
+		name                string
+		err                 error
+		expectedStatus      int
+		expectedDescription string
+	}{
+		{"Invalid token", fmt.Errorf("%w: token is expired", services.ErrInvalidToken), http.StatusUnauthorized, "token not valid"},
+		{"Expired refresh token", fmt.Errorf("%w: token is expired", services.ErrRefreshTokenExpired), http.StatusUnauthorized, services.ErrRefreshTokenExpired.Error()},
+		{"Invalid provider token", services.ErrProviderTokenInvalid, http.StatusUnauthorized, "provider token not valid"},
+		{"Provider not supported", services.ErrProviderNotSupported, http.StatusBadRequest, "login provider not supported"},
+		{"Provider already linked", services.ErrProviderAlreadyLinked, http.StatusConflict, "login provider already linked to an account"},
+		{"Sign-up closed", services.ErrSignupClosed, http.StatusForbidden, "registration closed"},
+		{"Invite code not valid", services.ErrInviteCodeInvalid, http.StatusForbidden, "invite code not valid"},
+		{"Impersonation not allowed", services.ErrImpersonationNotAllowed, http.StatusForbidden, "admins cannot be impersonated"},
+		{"Session not found", services.ErrSessionNotFound, http.StatusNotFound, "session not found"},
+		{"User not found", fmt.Errorf("%w: %w", services.ErrUserNotFound, &models.DbNotFoundError{DbItem: models.User{}}), http.StatusNotFound, "user not found"},
+		{"Database not found error", &models.DbNotFoundError{DbItem: models.Token{}}, http.StatusNotFound, "Token not found"},
+		{"Unknown error", errors.New("database is down"), http.StatusInternalServerError, "database is down"},
+	}
+
+	for _, testCase := range tests {
+		t.Run(testCase.name, func(t *testing.T) {
+			httpErr := translateAuthErrorToHttpError(testCase.err)
+
+			assert.Equal(t, testCase.expectedStatus, httpErr.Status)
+			assert.Equal(t, testCase.expectedDescription, httpErr.Description)
+		})
+	}
+}
+
+func TestBuildRefreshTokenCookie(t *testing.T) {
+	tests := []struct {
+		name             string
+		environment      string
+		sameSite         string
+		expectedSecure   bool
+		expectedSameSite http.SameSite
+	}{
+		{"Production", "production", "", true, http.SameSiteStrictMode},
+		{"Production with lax SameSite", "production", "lax", true, http.SameSiteLaxMode},
+		{"Local", "local", "strict", false, http.SameSiteStrictMode},
+		{"Invalid SameSite falls back to strict", "production", "none", true, http.SameSiteStrictMode},
+	}
+
+	for _, testCase := range tests {
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Setenv("API_ENVIRONMENT", testCase.environment)
+			t.Setenv("API_REFRESH_COOKIE_SAME_SITE", testCase.sameSite)
+			expiration := time.Now().Add(time.Hour).Truncate(time.Second)
+
+			res := httptest.NewRecorder()
+			http.SetCookie(res, buildRefreshTokenCookie("refresh.token", expiration))
+			cookies := res.Result().Cookies()
+
+			assert.Len(t, cookies, 1)
+			assert.Equal(t, "refreshToken", cookies[0].Name)
+			assert.Equal(t, "refresh.token", cookies[0].Value)
+			assert.Equal(t, "/api/v1/auth", cookies[0].Path)
+			assert.True(t, cookies[0].HttpOnly)
+			assert.Equal(t, testCase.expectedSecure, cookies[0].Secure)
+			assert.Equal(t, testCase.expectedSameSite, cookies[0].SameSite)
+			assert.True(t, expiration.Equal(cookies[0].Expires))
+			assert.InDelta(t, time.Hour.Seconds(), cookies[0].MaxAge, 2)
+		})
+	}
+}
+
+func TestHandleRefreshTokenExpired(t *testing.T) {
+	router := mux.NewRouter()
+	InitAuthRoutes(router)
+	secretKey, keyErr := auth.GetSecretKey()
+	assert.NoError(t, keyErr)
+
+	expiredToken, signErr := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"sub":          1,
+		"exp":          time.Now().Add(-time.Minute).Unix(),
+		auth.KindClaim: models.Refresh,
+	}).SignedString(secretKey)
+	assert.NoError(t, signErr)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/auth/refreshToken", strings.NewReader(`{"refreshToken":"`+expiredToken+`"}`))
+	res := httptest.NewRecorder()
+
+	router.ServeHTTP(res, req)
+
+	httpErr := models.HttpError{}
+	assert.Equal(t, http.StatusUnauthorized, res.Code)
+	assert.NoError(t, json.Unmarshal(res.Body.Bytes(), &httpErr))
+	assert.Equal(t, services.ErrRefreshTokenExpired.Error(), httpErr.Description)
+}
+
+func TestHandleAuthenticateEmptyBody(t *testing.T) {
+	router := mux.NewRouter()
+	InitAuthRoutes(router)
+
+	for _, body := range []string{"", "   "} {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/auth/authenticate", strings.NewReader(body))
+		res := httptest.NewRecorder()
+
+		router.ServeHTTP(res, req)
+
+		assert.Equal(t, http.StatusBadRequest, res.Code, "body %q", body)
+		assert.Contains(t, res.Body.String(), constants.ErrorRequestBodyRequired, "body %q", body)
+	}
+}
+
+func TestHandleGetTokenInfo(t *testing.T) {
+	router := mux.NewRouter()
+	InitAuthRoutes(router)
+	secretKey, keyErr := auth.GetSecretKey()
+	assert.NoError(t, keyErr)
+
+	// Signs a token with the given claims, as the token manager does.
+	signToken := func(claims jwt.MapClaims) string {
+		token, signErr := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(secretKey)
+		assert.NoError(t, signErr)
+		return token
+	}
+	getTokenInfo := func(token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/auth/token-info", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		res := httptest.NewRecorder()
+
+		router.ServeHTTP(res, req)
+
+		return res
+	}
+
+	// Test case: A token about to expire reports its expiration and the few seconds left
+	expiration := time.Now().Add(30 * time.Second).Unix()
+	res := getTokenInfo(signToken(jwt.MapClaims{"sub": 1, "exp": expiration, auth.KindClaim: models.Access}))
+	tokenInfo := TokenInfoResponse{}
+
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.NoError(t, json.Unmarshal(res.Body.Bytes(), &tokenInfo))
+	assert.Equal(t, expiration, tokenInfo.ExpiresAt)
+	assert.InDelta(t, 30, tokenInfo.ExpiresInSeconds, 2)
+	assert.Equal(t, "access", tokenInfo.Kind)
+
+	// Test case: Impersonation tokens are told apart from access tokens
+	impersonationToken, generateErr := auth.GetTokenManager().GenerateImpersonationToken(models.User{Id: 1}, 2, time.Minute)
+	assert.NoError(t, generateErr)
+	res = getTokenInfo(impersonationToken)
+
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.NoError(t, json.Unmarshal(res.Body.Bytes(), &tokenInfo))
+	assert.Equal(t, "impersonation", tokenInfo.Kind)
+
+	// Test case: Expired, tampered and expiration-less tokens are not valid
+	for _, token := range []string{
+		signToken(jwt.MapClaims{"sub": 1, "exp": time.Now().Add(-time.Minute).Unix(), auth.KindClaim: models.Access}),
+		signToken(jwt.MapClaims{"sub": 1, "exp": expiration, auth.KindClaim: models.Access}) + "x",
+		signToken(jwt.MapClaims{"sub": 1, auth.KindClaim: models.Access}),
+	} {
+		assert.Equal(t, http.StatusUnauthorized, getTokenInfo(token).Code)
+	}
+}
@@ -0,0 +1,46 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/adfer-dev/analock-api/constants"
+	"github.com/adfer-dev/analock-api/models"
+	"github.com/adfer-dev/analock-api/utils"
+)
+
+// Checks whether the request asks to skip cached values, either with a Cache-Control: no-cache header
+// or the refresh=true query param. It is only honored for admins, for any other user it is ignored.
+func cacheBypassRequested(req *http.Request) bool {
+	noCache := strings.Contains(strings.ToLower(req.Header.Get("Cache-Control")), "no-cache")
+
+	if !noCache && req.URL.Query().Get(constants.RefreshQueryParam) != "true" {
+		return false
+	}
+
+	if !strings.HasPrefix(req.Header.Get("Authorization"), "Bearer ") {
+		return false
+	}
+
+	tokenClaims, claimsErr := utils.GetTokenClaimsFromRequest(req)
+
+	if claimsErr != nil {
+		return false
+	}
+
+	userId, userIdErr := utils.UserIDFromClaims(tokenClaims)
+
+	if userIdErr != nil {
+		return false
+	}
+
+	user, userErr := userService.GetUserById(userId)
+
+	if userErr != nil || user.Role != models.Admin {
+		return false
+	}
+
+	utils.GetCustomLogger().Infof("Cache bypassed by admin %d on %s\n", userId, req.URL.Path)
+
+	return true
+}
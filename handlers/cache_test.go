@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/adfer-dev/analock-api/auth"
+	"github.com/adfer-dev/analock-api/constants"
+	"github.com/adfer-dev/analock-api/models"
+	"github.com/adfer-dev/analock-api/services"
+	"github.com/adfer-dev/analock-api/storage/memory"
+	"github.com/adfer-dev/analock-api/utils"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCacheBypassRequested(t *testing.T) {
+	var adminId uint = 4340
+	var standardUserId uint = 4341
+	useExistingAdmins(t, adminId)
+	userService.(*existingUsersService).userIds = []uint{standardUserId}
+
+	adminToken, adminTokenErr := auth.GetTokenManager().GenerateToken(models.User{Id: adminId, Role: models.Admin}, models.Access)
+	assert.NoError(t, adminTokenErr)
+	standardToken, standardTokenErr := auth.GetTokenManager().GenerateToken(models.User{Id: standardUserId}, models.Access)
+	assert.NoError(t, standardTokenErr)
+
+	tests := []struct {
+		name         string
+		token        string
+		target       string
+		cacheControl string
+		expected     bool
+	}{
+		{"Admin no-cache header", adminToken, "/", "no-cache", true},
+		{"Admin refresh param", adminToken, "/?refresh=true", "", true},
+		{"Admin without bypass", adminToken, "/", "", false},
+		{"Admin refresh param not true", adminToken, "/?refresh=1", "", false},
+		{"Standard user no-cache header", standardToken, "/", "no-cache", false},
+		{"Standard user refresh param", standardToken, "/?refresh=true", "", false},
+		{"No token", "", "/?refresh=true", "no-cache", false},
+	}
+
+	for _, testCase := range tests {
+		t.Run(testCase.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, testCase.target, nil)
+
+			if len(testCase.token) > 0 {
+				req.Header.Set("Authorization", "Bearer "+testCase.token)
+			}
+
+			if len(testCase.cacheControl) > 0 {
+				req.Header.Set("Cache-Control", testCase.cacheControl)
+			}
+
+			assert.Equal(t, testCase.expected, cacheBypassRequested(req))
+		})
+	}
+}
+
+func TestHandleGetUserEntriesCacheBypass(t *testing.T) {
+	t.Setenv("API_CACHE_EXPIRATION", "1h")
+	t.Setenv("API_CACHE_EVICTION_INTERVAL", "1h")
+
+	var adminId uint = 4342
+	var userId uint = 4343
+	useExistingAdmins(t, adminId)
+	userService.(*existingUsersService).userIds = []uint{userId}
+	database := memory.NewDatabase()
+	diaryEntryStorage := memory.NewDiaryEntryStorage(database)
+
+	originalDiaryEntryService := diaryEntryService
+	diaryEntryService = services.NewDefaultDiaryEntryService(diaryEntryStorage, memory.NewActivityRegistrationStorage(database), memory.NewUserStorage(database))
+	defer func() { diaryEntryService = originalDiaryEntryService }()
+
+	adminToken, adminTokenErr := auth.GetTokenManager().GenerateToken(models.User{Id: adminId, Role: models.Admin}, models.Access)
+	assert.NoError(t, adminTokenErr)
+	userToken, userTokenErr := auth.GetTokenManager().GenerateToken(models.User{Id: userId}, models.Access)
+	assert.NoError(t, userTokenErr)
+
+	services.GetCacheServiceInstance().CacheResource(
+		func() (interface{}, error) { return []*models.DiaryEntry{}, nil },
+		constants.DiaryEntriesCacheResource,
+		utils.BuildUserCacheKey(userId),
+		false,
+	)
+	assert.NoError(t, diaryEntryStorage.CreateMany([]*models.DiaryEntry{
+		{Title: "title", Content: "content", Registration: models.ActivityRegistration{RegistrationDate: 100, UserRefer: userId}},
+	}))
+
+	router := mux.NewRouter()
+	InitDiaryEntryRoutes(router)
+	getEntries := func(token string, target string) []*models.DiaryEntry {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Cache-Control", "no-cache")
+		res := httptest.NewRecorder()
+
+		router.ServeHTTP(res, req)
+
+		assert.Equal(t, http.StatusOK, res.Code)
+		var entries []*models.DiaryEntry
+		assert.NoError(t, json.Unmarshal(res.Body.Bytes(), &entries))
+
+		return entries
+	}
+	target := "/api/v1/diaryEntries/user/" + formatId(userId)
+
+	// Test case: A standard user asking to bypass the cache is served the cached entries
+	assert.Empty(t, getEntries(userToken, target))
+
+	// Test case: An admin bypassing the cache is served the stored entries
+	assert.Len(t, getEntries(adminToken, target+"?refresh=true"), 1)
+
+	// Test case: The bypass repopulates the cache for every other user
+	assert.Len(t, getEntries(userToken, target), 1)
+}
@@ -1,50 +1,111 @@
 package handlers
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
+	"hash/fnv"
+	"io"
 	"net/http"
 	"strconv"
+	"time"
 
+	"github.com/adfer-dev/analock-api/config"
 	"github.com/adfer-dev/analock-api/constants"
 	"github.com/adfer-dev/analock-api/models"
 	"github.com/adfer-dev/analock-api/services"
+	"github.com/adfer-dev/analock-api/storage"
 	"github.com/adfer-dev/analock-api/utils"
 	"github.com/gorilla/mux"
 )
 
-var diaryEntryService services.DiaryEntryService = &services.DefaultDiaryEntryService{}
+type DeleteDiaryEntriesResponse struct {
+	Deleted int `json:"deleted"`
+}
+
+var diaryEntryService services.DiaryEntryService = services.NewDefaultDiaryEntryService(
+	&storage.DiaryEntryStorage{},
+	&storage.ActivityRegistrationStorage{},
+	&storage.UserStorage{},
+)
 
 func InitDiaryEntryRoutes(router *mux.Router) {
 	router.HandleFunc("/api/v1/diaryEntries/user/{id:[0-9]+}", utils.ParseToHandlerFunc(handleGetUserEntries)).Methods("GET")
+	router.HandleFunc("/api/v1/diaryEntries/user/{id:[0-9]+}", utils.ParseToHandlerFunc(handleDeleteUserEntries)).Methods("DELETE")
+	router.HandleFunc("/api/v1/diaryEntries/user/{id:[0-9]+}/calendar", utils.ParseToHandlerFunc(handleGetUserEntriesCalendar)).Methods("GET")
+	router.HandleFunc("/api/v1/diaryEntries/user/{id:[0-9]+}/on-this-day", utils.ParseToHandlerFunc(handleGetUserEntriesOnThisDay)).Methods("GET")
 	router.HandleFunc("/api/v1/diaryEntries", utils.ParseToHandlerFunc(handleCreateDiaryEntry)).Methods("POST")
+	router.HandleFunc("/api/v1/diaryEntries/import", utils.ParseToHandlerFunc(handleImportDiaryEntries)).Methods("POST")
+	router.HandleFunc("/api/v1/diaryEntries/import/validate", utils.ParseToHandlerFunc(handleValidateDiaryEntries)).Methods("POST")
+	router.HandleFunc("/api/v1/diaryEntries/{id:[0-9]+}", utils.ParseToHandlerFunc(handleGetDiaryEntry)).Methods("GET")
 	router.HandleFunc("/api/v1/diaryEntries/{id:[0-9]+}", utils.ParseToHandlerFunc(handleUpdateDiaryEntry)).Methods("PUT")
 }
 
 // @Summary		Get user diary entries
-// @Description	Get all diary entries for a user, optionally filtered by date range
+// @Description	Get all diary entries for a user, optionally filtered by date range.
+// @Description	When fields=summary, only the id, title, registration date and a content preview of each entry are returned.
+// @Description	When API_STREAM_LIST_RESPONSES is true, the full list of entries is written as it is read, without caching it.
 // @Tags			diary
 // @Accept			json
 // @Produce		json
-// @Param			id			path		int	true	"User ID"
-// @Param			startDate	query		int	false	"Start date timestamp"
-// @Param			endDate		query		int	false	"End date timestamp"
+// @Param			id			path		int		true	"User ID"
+// @Param			startDate	query		int		false	"Start date timestamp"
+// @Param			endDate		query		int		false	"End date timestamp"
+// @Param			day			query		int		false	"Unix timestamp in seconds of a day to get its entries, instead of the date range"
+// @Param			tzOffset	query		int		false	"UTC offset of the day, in minutes"
+// @Param			fields		query		string	false	"Set to summary to get entry summaries"	Enums(summary)
+// @Param			refresh		query		bool	false	"Skip cached values and refresh them, only honored for admins"
+// @Param			Cache-Control	header		string	false	"no-cache skips cached values and refreshes them, only honored for admins"
 // @Success		200			{array}		models.DiaryEntry
+// @Success		200			{array}		models.DiaryEntrySummary
 // @Failure		400			{object}	models.HttpError
+// @Failure		404			{object}	models.HttpError
 // @Failure		500			{object}	models.HttpError
 // @Security		BearerAuth
 // @Router			/diaryEntries/user/{id} [get]
 func handleGetUserEntries(res http.ResponseWriter, req *http.Request) error {
 	userId, _ := strconv.Atoi(mux.Vars(req)["id"])
 
-	startDateString := req.URL.Query().Get(constants.StartDateQueryParam)
-	endDateString := req.URL.Query().Get(constants.EndDateQueryParam)
+	if httpErr := checkListedUserExists(uint(userId)); httpErr != nil {
+		return utils.WriteJSON(res, httpErr.Status, httpErr)
+	}
 
-	if len(startDateString) == 0 || len(endDateString) == 0 {
-		userDiaryEntries, err := services.GetCacheServiceInstance().CacheResource(
-			func() (interface{}, error) { return diaryEntryService.GetUserEntries(uint(userId)) },
-			constants.DiaryEntriesCacheResource,
-			utils.BuildUserCacheKey(uint(userId)),
-		)
+	fields := req.URL.Query().Get(constants.FieldsQueryParam)
+
+	if len(fields) > 0 && fields != constants.FieldsSummaryValue {
+		return utils.WriteJSON(res, 400, models.HttpError{Status: http.StatusBadRequest, Description: fmt.Sprintf(constants.QueryParamError, constants.FieldsQueryParam)})
+	}
+
+	summaryMode := fields == constants.FieldsSummaryValue
+	startDate, endDate, hasDateRange, rangeErr := utils.ParseDateRangeQueryParams(req)
+
+	if rangeErr != nil {
+		return utils.WriteJSON(res, 400, models.HttpError{Status: http.StatusBadRequest, Description: rangeErr.Error()})
+	}
+
+	if !hasDateRange && !summaryMode && config.Get().StreamListResponses {
+		return streamUserEntries(res, uint(userId))
+	}
+
+	if !hasDateRange {
+		var userDiaryEntries interface{}
+		var err error
+
+		if summaryMode {
+			userDiaryEntries, err = services.GetCacheServiceInstance().CacheResource(
+				func() (interface{}, error) { return diaryEntryService.GetUserEntrySummaries(uint(userId)) },
+				constants.DiaryEntriesCacheResource,
+				utils.BuildUserSummaryCacheKey(uint(userId)),
+				cacheBypassRequested(req),
+			)
+		} else {
+			userDiaryEntries, err = services.GetCacheServiceInstance().CacheResource(
+				func() (interface{}, error) { return diaryEntryService.GetUserEntries(uint(userId)) },
+				constants.DiaryEntriesCacheResource,
+				utils.BuildUserCacheKey(uint(userId)),
+				cacheBypassRequested(req),
+			)
+		}
 
 		if err != nil {
 			return utils.WriteJSON(res, 500, err.Error())
@@ -53,32 +114,232 @@ func handleGetUserEntries(res http.ResponseWriter, req *http.Request) error {
 		return utils.WriteJSON(res, 200, userDiaryEntries)
 	}
 
-	startDate, startDateErr := strconv.Atoi(startDateString)
+	if summaryMode {
+		dateIntervalUserSummaries, err := services.GetCacheServiceInstance().CacheResource(
+			func() (interface{}, error) {
+				return diaryEntryService.GetUserEntrySummariesTimeRange(uint(userId), int64(startDate), int64(endDate))
+			},
+			constants.DiaryEntriesCacheResource,
+			utils.BuildUserSummaryDateRangeCacheKey(uint(userId), startDate, endDate),
+			cacheBypassRequested(req),
+		)
+		if err != nil {
+			return utils.WriteJSON(res, 500, err.Error())
+		}
+
+		return utils.WriteJSON(res, 200, dateIntervalUserSummaries)
+	}
+
+	dateIntervalUserDiaryEntries, err := services.GetCacheServiceInstance().CacheResource(
+		func() (interface{}, error) {
+			return diaryEntryService.GetUserEntriesTimeRange(uint(userId), int64(startDate), int64(endDate))
+		},
+		constants.DiaryEntriesCacheResource,
+		utils.BuildUserDateRangeCacheKey(uint(userId), startDate, endDate),
+		cacheBypassRequested(req),
+	)
+	if err != nil {
+		return utils.WriteJSON(res, 500, err.Error())
+	}
+
+	return utils.WriteJSON(res, 200, dateIntervalUserDiaryEntries)
+}
+
+// Writes all the entries of the given user as they are read from the database, so they are never held in memory at once.
+func streamUserEntries(res http.ResponseWriter, userId uint) error {
+	started, streamErr := utils.WriteJSONArrayStream(res, 200, func(yield func(item any) error) error {
+		return diaryEntryService.StreamUserEntries(userId, func(diaryEntry *models.DiaryEntry) error {
+			return yield(diaryEntry)
+		})
+	})
+
+	if streamErr != nil && started {
+		utils.GetCustomLogger().Errorf("Error streaming the diary entries of user %d: %s\n", userId, streamErr.Error())
+
+		// The status and part of the list were already sent, so the connection is closed
+		// for the client to notice the list is incomplete, instead of getting a 200 with a truncated body.
+		panic(http.ErrAbortHandler)
+	}
+
+	return streamErr
+}
+
+// @Summary		Get diary entry
+// @Description	Get a diary entry by its ID.
+// @Description	The response has ETag and Last-Modified headers, so clients polling the entry can send
+// @Description	If-None-Match or If-Modified-Since to get a 304 while it is unchanged.
+// @Tags			diary
+// @Produce		json
+// @Param			id					path		int		true	"Diary entry ID"
+// @Param			If-None-Match		header		string	false	"ETag of the entry the client has"
+// @Param			If-Modified-Since	header		string	false	"Last-Modified date of the entry the client has"
+// @Success		200					{object}	models.DiaryEntry
+// @Success		304					"Entry not modified"
+// @Failure		403					{object}	models.HttpError
+// @Failure		404					{object}	models.HttpError
+// @Security		BearerAuth
+// @Router			/diaryEntries/{id} [get]
+func handleGetDiaryEntry(res http.ResponseWriter, req *http.Request) error {
+	entryId, _ := strconv.Atoi(mux.Vars(req)["id"])
+
+	diaryEntry, err := diaryEntryService.GetDiaryEntryById(uint(entryId))
+
+	if err != nil {
+		httpErr := utils.TranslateDbErrorToHttpError(err)
+		return utils.WriteJSON(res, httpErr.Status, httpErr)
+	}
+
+	etag := getDiaryEntryETag(diaryEntry)
+	var lastModified time.Time
+
+	if diaryEntry.UpdatedAt > 0 {
+		lastModified = time.Unix(diaryEntry.UpdatedAt, 0)
+	}
+
+	utils.SetValidatorHeaders(res, etag, lastModified)
+
+	if utils.IsNotModified(req, etag, lastModified) {
+		res.WriteHeader(http.StatusNotModified)
+		return nil
+	}
+
+	return utils.WriteJSON(res, 200, diaryEntry)
+}
+
+// Gets the entity tag of the entry from its id and last change time.
+// The change time has second precision, so a hash of the entry fields is added for updates within the same second to change it too.
+func getDiaryEntryETag(diaryEntry *models.DiaryEntry) string {
+	fieldsHash := fnv.New64a()
+	fmt.Fprintf(fieldsHash, "%s\x00%s\x00%d", diaryEntry.Title, diaryEntry.Content, diaryEntry.Registration.RegistrationDate)
+
+	return fmt.Sprintf("\"%d-%d-%x\"", diaryEntry.Id, diaryEntry.UpdatedAt, fieldsHash.Sum64())
+}
+
+// @Summary		Get user diary entries by day
+// @Description	Get the entry summaries of a user within a date range, grouped by day (YYYY-MM-DD).
+// @Description	Days are computed in the given IANA timezone, which defaults to UTC.
+// @Description	The range must not end before it starts nor span more than 366 days.
+// @Tags			diary
+// @Accept			json
+// @Produce		json
+// @Param			id			path		int		true	"User ID"
+// @Param			start_date	query		int		true	"Start date Unix timestamp in seconds"
+// @Param			end_date	query		int		true	"End date Unix timestamp in seconds"
+// @Param			tz			query		string	false	"IANA timezone, e.g. Europe/Madrid"
+// @Param			refresh		query		bool	false	"Skip cached values and refresh them, only honored for admins"
+// @Param			Cache-Control	header		string	false	"no-cache skips cached values and refreshes them, only honored for admins"
+// @Success		200			{object}	map[string][]models.DiaryEntrySummary
+// @Failure		400			{object}	models.HttpError
+// @Failure		404			{object}	models.HttpError
+// @Failure		500			{object}	models.HttpError
+// @Security		BearerAuth
+// @Router			/diaryEntries/user/{id}/calendar [get]
+func handleGetUserEntriesCalendar(res http.ResponseWriter, req *http.Request) error {
+	userId, _ := strconv.Atoi(mux.Vars(req)["id"])
+
+	if httpErr := checkListedUserExists(uint(userId)); httpErr != nil {
+		return utils.WriteJSON(res, httpErr.Status, httpErr)
+	}
+
+	startDate, startDateErr := strconv.Atoi(req.URL.Query().Get(constants.StartDateQueryParam))
 
 	if startDateErr != nil {
 		return utils.WriteJSON(res, 400, models.HttpError{Status: http.StatusBadRequest, Description: fmt.Sprintf(constants.QueryParamError, constants.StartDateQueryParam)})
 	}
-	endDate, endDateErr := strconv.Atoi(endDateString)
+	endDate, endDateErr := strconv.Atoi(req.URL.Query().Get(constants.EndDateQueryParam))
 
 	if endDateErr != nil {
 		return utils.WriteJSON(res, 400, models.HttpError{Status: http.StatusBadRequest, Description: fmt.Sprintf(constants.QueryParamError, constants.EndDateQueryParam)})
 	}
-	dateIntervalUserDiaryEntries, err := diaryEntryService.GetUserEntriesTimeRange(uint(userId), int64(startDate), int64(endDate))
+
+	// The entries in the range are loaded whole to be grouped, so its span is capped
+	if endDate < startDate || int64(endDate-startDate) > constants.DiaryEntryCalendarMaxDays*constants.DaySeconds {
+		return utils.WriteError(res, 400, fmt.Sprintf(constants.ErrorCalendarRangeNotValid, constants.DiaryEntryCalendarMaxDays))
+	}
+
+	// An empty timezone is loaded as UTC
+	location, locationErr := time.LoadLocation(req.URL.Query().Get(constants.TimezoneQueryParam))
+
+	if locationErr != nil {
+		return utils.WriteJSON(res, 400, models.HttpError{Status: http.StatusBadRequest, Description: fmt.Sprintf(constants.QueryParamError, constants.TimezoneQueryParam)})
+	}
+
+	entriesByDay, err := services.GetCacheServiceInstance().CacheResource(
+		func() (interface{}, error) {
+			return diaryEntryService.GetUserEntrySummariesByDay(uint(userId), int64(startDate), int64(endDate), location)
+		},
+		constants.DiaryEntriesCacheResource,
+		utils.BuildUserCalendarCacheKey(uint(userId), startDate, endDate, location.String()),
+		cacheBypassRequested(req),
+	)
+
 	if err != nil {
 		return utils.WriteJSON(res, 500, err.Error())
 	}
 
-	return utils.WriteJSON(res, 200, dateIntervalUserDiaryEntries)
+	return utils.WriteJSON(res, 200, entriesByDay)
+}
+
+// @Summary		Get user diary entries on this day
+// @Description	Get the entries of a user registered on today's month and day in previous years, grouped by year (YYYY).
+// @Description	Today is computed in the given IANA timezone, which defaults to UTC.
+// @Tags			diary
+// @Produce		json
+// @Param			id	path		int		true	"User ID"
+// @Param			tz	query		string	false	"IANA timezone, e.g. Europe/Madrid"
+// @Param			refresh		query		bool	false	"Skip cached values and refresh them, only honored for admins"
+// @Param			Cache-Control	header		string	false	"no-cache skips cached values and refreshes them, only honored for admins"
+// @Success		200	{object}	map[string][]models.DiaryEntry
+// @Failure		400	{object}	models.HttpError
+// @Failure		403	{object}	models.HttpError
+// @Failure		404	{object}	models.HttpError
+// @Failure		500	{object}	models.HttpError
+// @Security		BearerAuth
+// @Router			/diaryEntries/user/{id}/on-this-day [get]
+func handleGetUserEntriesOnThisDay(res http.ResponseWriter, req *http.Request) error {
+	userId, _ := strconv.Atoi(mux.Vars(req)["id"])
+
+	if httpErr := checkListedUserExists(uint(userId)); httpErr != nil {
+		return utils.WriteJSON(res, httpErr.Status, httpErr)
+	}
+
+	// An empty timezone is loaded as UTC
+	location, locationErr := time.LoadLocation(req.URL.Query().Get(constants.TimezoneQueryParam))
+
+	if locationErr != nil {
+		return utils.WriteJSON(res, 400, models.HttpError{Status: http.StatusBadRequest, Description: fmt.Sprintf(constants.QueryParamError, constants.TimezoneQueryParam)})
+	}
+
+	now := time.Now().In(location)
+	entriesByYear, err := services.GetCacheServiceInstance().CacheResource(
+		func() (interface{}, error) {
+			return diaryEntryService.GetUserEntriesOnThisDay(uint(userId), now)
+		},
+		constants.DiaryEntriesCacheResource,
+		utils.BuildUserOnThisDayCacheKey(uint(userId), now.Format(constants.CalendarDayFormat), location.String()),
+		cacheBypassRequested(req),
+	)
+
+	if err != nil {
+		return utils.WriteJSON(res, 500, err.Error())
+	}
+
+	return utils.WriteJSON(res, 200, entriesByYear)
 }
 
 // @Summary		Create diary entry
 // @Description	Create a new diary entry for a user
+// @Description	Fails with 403 if the user has reached the maximum number of diary entries, unless they are an admin.
+// @Description	When the API only allows one entry per day, fails with 409 if the user already has an entry on the publish date's day, in the given timezone.
 // @Tags			diary
 // @Accept			json
 // @Produce		json
 // @Param			body	body		services.SaveDiaryEntryBody	true	"Diary entry information"
+// @Param			tz		query		string						false	"IANA timezone of the publish date's day, e.g. Europe/Madrid"
 // @Success		201		{object}	models.DiaryEntry
-// @Failure		400		{object}	models.HttpError
+// @Failure		400		{object}	models.ValidationErrorResponse
+// @Failure		403		{object}	models.HttpError
+// @Failure		409		{object}	models.HttpError
 // @Failure		500		{object}	models.HttpError
 // @Security		BearerAuth
 // @Router			/diaryEntries [post]
@@ -88,7 +349,7 @@ func handleCreateDiaryEntry(res http.ResponseWriter, req *http.Request) error {
 	validationErrs := utils.HandleValidation(req, &entryBody)
 
 	if len(validationErrs) > 0 {
-		return utils.WriteJSON(res, 400, validationErrs)
+		return utils.WriteValidationErrors(res, 400, validationErrs)
 	}
 
 	tokenClaims, claimsErr := utils.GetTokenClaimsFromRequest(req)
@@ -101,14 +362,33 @@ func handleCreateDiaryEntry(res http.ResponseWriter, req *http.Request) error {
 		return utils.WriteJSON(res, 500, constants.ErrorGeneric)
 	}
 
-	userId := uint(tokenClaims["sub"].(float64))
+	userId, userIdErr := utils.UserIDFromClaims(tokenClaims)
+
+	if userIdErr != nil {
+		return utils.WriteError(res, 401, constants.ErrorTokenNotValid)
+	}
+
+	// An empty timezone is loaded as UTC
+	location, locationErr := time.LoadLocation(req.URL.Query().Get(constants.TimezoneQueryParam))
+
+	if locationErr != nil {
+		return utils.WriteJSON(res, 400, models.HttpError{Status: http.StatusBadRequest, Description: fmt.Sprintf(constants.QueryParamError, constants.TimezoneQueryParam)})
+	}
 
-	savedEntry, saveEntryErr := diaryEntryService.SaveDiaryEntry(&entryBody, userId)
-	services.GetCacheServiceInstance().EvictResourceItem(
+	savedEntry, saveEntryErr := diaryEntryService.SaveDiaryEntry(&entryBody, userId, location)
+	services.GetCacheServiceInstance().EvictUserResource(
 		constants.DiaryEntriesCacheResource,
-		utils.BuildUserCacheKey(userId),
+		userId,
 	)
 
+	if errors.Is(saveEntryErr, services.ErrDiaryEntryQuotaReached) {
+		return utils.WriteError(res, http.StatusForbidden, saveEntryErr.Error())
+	}
+
+	if errors.Is(saveEntryErr, services.ErrDiaryEntryDayTaken) {
+		return utils.WriteError(res, http.StatusConflict, saveEntryErr.Error())
+	}
+
 	if saveEntryErr != nil {
 		return utils.WriteJSON(res, 500, saveEntryErr.Error())
 	}
@@ -116,15 +396,180 @@ func handleCreateDiaryEntry(res http.ResponseWriter, req *http.Request) error {
 	return utils.WriteJSON(res, 201, savedEntry)
 }
 
+// @Summary		Import diary entries
+// @Description	Import several diary entries for a user within a single transaction.
+// @Description	Each entry is validated independently, invalid entries are reported by their index and not imported.
+// @Description	When the API only allows one entry per day, entries on a day already taken, in the given timezone, are reported as invalid.
+// @Tags			diary
+// @Accept			json
+// @Produce		json
+// @Param			body	body		[]services.SaveDiaryEntryBody	true	"Diary entries to import (max 100)"
+// @Param			tz		query		string							false	"IANA timezone of the publish dates' days, e.g. Europe/Madrid"
+// @Success		200		{object}	services.ImportDiaryEntriesResponse
+// @Failure		400		{object}	models.HttpError
+// @Failure		403		{object}	models.HttpError
+// @Failure		413		{object}	models.HttpError
+// @Failure		500		{object}	models.HttpError
+// @Security		BearerAuth
+// @Router			/diaryEntries/import [post]
+func handleImportDiaryEntries(res http.ResponseWriter, req *http.Request) error {
+	entryBodies, decodeErr := readDiaryEntriesToImport(res, req)
+
+	if decodeErr != nil {
+		return utils.WriteJSON(res, decodeErr.Status, decodeErr)
+	}
+
+	tokenClaims, claimsErr := utils.GetTokenClaimsFromRequest(req)
+
+	if claimsErr != nil {
+		utils.GetCustomLogger().Errorf(
+			"Error getting claims on import diary entries: %s",
+			claimsErr.Error(),
+		)
+		return utils.WriteJSON(res, 500, constants.ErrorGeneric)
+	}
+
+	userId, userIdErr := utils.UserIDFromClaims(tokenClaims)
+
+	if userIdErr != nil {
+		return utils.WriteError(res, 401, constants.ErrorTokenNotValid)
+	}
+
+	// An empty timezone is loaded as UTC
+	location, locationErr := time.LoadLocation(req.URL.Query().Get(constants.TimezoneQueryParam))
+
+	if locationErr != nil {
+		return utils.WriteJSON(res, 400, models.HttpError{Status: http.StatusBadRequest, Description: fmt.Sprintf(constants.QueryParamError, constants.TimezoneQueryParam)})
+	}
+
+	importResponse, importErr := diaryEntryService.ImportDiaryEntries(entryBodies, userId, location)
+
+	if errors.Is(importErr, services.ErrDiaryEntryImportBatchSize) {
+		return utils.WriteError(res, http.StatusBadRequest, importErr.Error())
+	}
+
+	if errors.Is(importErr, services.ErrDiaryEntryQuotaReached) {
+		return utils.WriteError(res, http.StatusForbidden, importErr.Error())
+	}
+
+	if importErr != nil {
+		return utils.WriteJSON(res, 500, importErr.Error())
+	}
+
+	if importResponse.Imported > 0 {
+		services.GetCacheServiceInstance().EvictUserResources(
+			[]constants.CacheResource{constants.DiaryEntriesCacheResource},
+			userId,
+		)
+	}
+
+	return utils.WriteJSON(res, 200, importResponse)
+}
+
+// @Summary		Validate diary entries to import
+// @Description	Validate several diary entries the same way the import does, without importing any of them.
+// @Description	Each entry is reported by its index, telling whether it is valid and, if not, its errors.
+// @Tags			diary
+// @Accept			json
+// @Produce		json
+// @Param			body	body		[]services.SaveDiaryEntryBody	true	"Diary entries to validate (max 100)"
+// @Success		200		{array}		services.DiaryEntryValidation
+// @Failure		400		{object}	models.HttpError
+// @Failure		500		{object}	models.HttpError
+// @Security		BearerAuth
+// @Router			/diaryEntries/import/validate [post]
+func handleValidateDiaryEntries(res http.ResponseWriter, req *http.Request) error {
+	entryBodies, decodeErr := readDiaryEntriesToImport(res, req)
+
+	if decodeErr != nil {
+		return utils.WriteJSON(res, decodeErr.Status, decodeErr)
+	}
+
+	validations, validateErr := diaryEntryService.ValidateDiaryEntries(entryBodies)
+
+	if errors.Is(validateErr, services.ErrDiaryEntryImportBatchSize) {
+		return utils.WriteError(res, http.StatusBadRequest, validateErr.Error())
+	}
+
+	if validateErr != nil {
+		return utils.WriteJSON(res, 500, validateErr.Error())
+	}
+
+	return utils.WriteJSON(res, 200, validations)
+}
+
+// Reads the batch of diary entries to import from the request body, rejecting unknown fields.
+// Returns the HTTP error to respond with if the body is not valid.
+func readDiaryEntriesToImport(res http.ResponseWriter, req *http.Request) ([]*services.SaveDiaryEntryBody, *models.HttpError) {
+	entryBodies := []*services.SaveDiaryEntryBody{}
+	decoder := json.NewDecoder(http.MaxBytesReader(res, req.Body, constants.DiaryEntryImportMaxBodyBytes))
+	decoder.DisallowUnknownFields()
+
+	// The entries are decoded one by one, so a batch over the max size is rejected without reading it whole
+	openingToken, tokenErr := decoder.Token()
+
+	if tokenErr != nil {
+		return nil, translateImportDecodeError(tokenErr)
+	}
+
+	if openingToken != json.Delim('[') {
+		return nil, &models.HttpError{Status: http.StatusBadRequest, Description: "Not valid JSON."}
+	}
+
+	for decoder.More() {
+		if len(entryBodies) == constants.DiaryEntryImportMaxBatchSize {
+			return nil, &models.HttpError{Status: http.StatusBadRequest, Description: services.ErrDiaryEntryImportBatchSize.Error()}
+		}
+
+		entryBody := &services.SaveDiaryEntryBody{}
+
+		if decodeErr := decoder.Decode(entryBody); decodeErr != nil {
+			return nil, translateImportDecodeError(decodeErr)
+		}
+
+		entryBodies = append(entryBodies, entryBody)
+	}
+
+	if _, tokenErr := decoder.Token(); tokenErr != nil {
+		return nil, translateImportDecodeError(tokenErr)
+	}
+
+	return entryBodies, nil
+}
+
+// Translates an error decoding the entries to import into the HTTP error to respond with.
+func translateImportDecodeError(decodeErr error) *models.HttpError {
+	var maxBytesErr *http.MaxBytesError
+
+	// The decoder only returns io.EOF itself when it finds nothing but whitespace
+	if decodeErr == io.EOF {
+		return &models.HttpError{Status: http.StatusBadRequest, Description: constants.ErrorRequestBodyRequired}
+	}
+
+	if errors.As(decodeErr, &maxBytesErr) {
+		return &models.HttpError{Status: http.StatusRequestEntityTooLarge, Description: constants.ErrorRequestBodyTooLarge}
+	}
+
+	if field, unknown := utils.UnknownJSONField(decodeErr); unknown {
+		return &models.HttpError{Status: http.StatusBadRequest, Description: fmt.Sprintf(constants.ErrorUnknownBodyField, field)}
+	}
+
+	return &models.HttpError{Status: http.StatusBadRequest, Description: "Not valid JSON."}
+}
+
 // @Summary		Update diary entry
 // @Description	Update an existing diary entry
+// @Description	When the API only allows one entry per day, fails with 409 if another entry of the user is on the publish date's day, in the given timezone.
 // @Tags			diary
 // @Accept			json
 // @Produce		json
 // @Param			id		path		int								true	"Diary entry ID"
 // @Param			body	body		services.UpdateDiaryEntryBody	true	"Updated diary entry information"
+// @Param			tz		query		string							false	"IANA timezone of the publish date's day, e.g. Europe/Madrid"
 // @Success		200		{object}	models.DiaryEntry
-// @Failure		400		{object}	models.HttpError
+// @Failure		400		{object}	models.ValidationErrorResponse
+// @Failure		404		{object}	models.HttpError
+// @Failure		409		{object}	models.HttpError
 // @Failure		500		{object}	models.HttpError
 // @Security		BearerAuth
 // @Router			/diaryEntries/{id} [put]
@@ -135,19 +580,81 @@ func handleUpdateDiaryEntry(res http.ResponseWriter, req *http.Request) error {
 	validationErrs := utils.HandleValidation(req, &updateEntryBody)
 
 	if len(validationErrs) > 0 {
-		return utils.WriteJSON(res, 400, validationErrs)
+		return utils.WriteValidationErrors(res, 400, validationErrs)
 	}
 
-	updatedEntry, updateEntryErr := diaryEntryService.UpdateDiaryEntry(uint(entryId), &updateEntryBody)
+	// An empty timezone is loaded as UTC
+	location, locationErr := time.LoadLocation(req.URL.Query().Get(constants.TimezoneQueryParam))
 
-	services.GetCacheServiceInstance().EvictResourceItem(
-		constants.DiaryEntriesCacheResource,
-		utils.BuildUserCacheKey(updatedEntry.Registration.UserRefer),
-	)
+	if locationErr != nil {
+		return utils.WriteJSON(res, 400, models.HttpError{Status: http.StatusBadRequest, Description: fmt.Sprintf(constants.QueryParamError, constants.TimezoneQueryParam)})
+	}
+
+	updatedEntry, updateEntryErr := diaryEntryService.UpdateDiaryEntry(uint(entryId), &updateEntryBody, location)
+
+	if errors.Is(updateEntryErr, services.ErrDiaryEntryDayTaken) {
+		return utils.WriteError(res, http.StatusConflict, updateEntryErr.Error())
+	}
 
 	if updateEntryErr != nil {
-		return utils.WriteJSON(res, 500, updateEntryErr.Error())
+		httpErr := utils.TranslateDbErrorToHttpError(updateEntryErr)
+		return utils.WriteJSON(res, httpErr.Status, httpErr)
 	}
 
+	services.GetCacheServiceInstance().EvictUserResource(
+		constants.DiaryEntriesCacheResource,
+		updatedEntry.Registration.UserRefer,
+	)
+
 	return utils.WriteJSON(res, 200, updatedEntry)
 }
+
+// @Summary		Delete user diary entries
+// @Description	Delete all the diary entries of a user published within a date range, both ends included, along with their activity registrations.
+// @Description	Either all the entries in the range are deleted or none are.
+// @Tags			diary
+// @Produce		json
+// @Param			id			path		int	true	"User ID"
+// @Param			start_date	query		int	true	"Start date timestamp"
+// @Param			end_date	query		int	true	"End date timestamp"
+// @Success		200			{object}	DeleteDiaryEntriesResponse
+// @Failure		400			{object}	models.HttpError
+// @Failure		403			{object}	models.HttpError
+// @Failure		404			{object}	models.HttpError
+// @Failure		500			{object}	models.HttpError
+// @Security		BearerAuth
+// @Router			/diaryEntries/user/{id} [delete]
+func handleDeleteUserEntries(res http.ResponseWriter, req *http.Request) error {
+	userId, _ := strconv.Atoi(mux.Vars(req)["id"])
+
+	if httpErr := checkListedUserExists(uint(userId)); httpErr != nil {
+		return utils.WriteJSON(res, httpErr.Status, httpErr)
+	}
+
+	startDate, startDateErr := strconv.ParseInt(req.URL.Query().Get(constants.StartDateQueryParam), 10, 64)
+
+	if startDateErr != nil {
+		return utils.WriteJSON(res, 400, models.HttpError{Status: http.StatusBadRequest, Description: fmt.Sprintf(constants.QueryParamError, constants.StartDateQueryParam)})
+	}
+
+	endDate, endDateErr := strconv.ParseInt(req.URL.Query().Get(constants.EndDateQueryParam), 10, 64)
+
+	if endDateErr != nil || endDate < startDate {
+		return utils.WriteJSON(res, 400, models.HttpError{Status: http.StatusBadRequest, Description: fmt.Sprintf(constants.QueryParamError, constants.EndDateQueryParam)})
+	}
+
+	deleted, deleteErr := diaryEntryService.DeleteUserEntriesTimeRange(uint(userId), startDate, endDate)
+
+	if deleteErr != nil {
+		return utils.WriteJSON(res, 500, deleteErr.Error())
+	}
+
+	if deleted > 0 {
+		services.GetCacheServiceInstance().EvictUserResources(
+			[]constants.CacheResource{constants.DiaryEntriesCacheResource},
+			uint(userId),
+		)
+	}
+
+	return utils.WriteJSON(res, 200, DeleteDiaryEntriesResponse{Deleted: deleted})
+}
@@ -0,0 +1,664 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/adfer-dev/analock-api/auth"
+	"github.com/adfer-dev/analock-api/constants"
+	"github.com/adfer-dev/analock-api/models"
+	"github.com/adfer-dev/analock-api/services"
+	"github.com/adfer-dev/analock-api/storage/memory"
+	"github.com/adfer-dev/analock-api/utils"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHandleGetDiaryEntryConditional(t *testing.T) {
+	database := memory.NewDatabase()
+	diaryEntryStorage := memory.NewDiaryEntryStorage(database)
+	updatedAt := time.Date(2024, 5, 10, 12, 30, 15, 0, time.UTC).Unix()
+	diaryEntry := &models.DiaryEntry{Title: "title", Content: "content", Registration: models.ActivityRegistration{RegistrationDate: 100, UserRefer: 1}, UpdatedAt: updatedAt}
+	assert.NoError(t, diaryEntryStorage.CreateMany([]*models.DiaryEntry{diaryEntry}))
+
+	originalDiaryEntryService := diaryEntryService
+	diaryEntryService = services.NewDefaultDiaryEntryService(diaryEntryStorage, memory.NewActivityRegistrationStorage(database), memory.NewUserStorage(database))
+	defer func() { diaryEntryService = originalDiaryEntryService }()
+
+	router := mux.NewRouter()
+	InitDiaryEntryRoutes(router)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/diaryEntries/"+formatId(diaryEntry.Id), nil)
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+
+	etag := res.Header().Get("ETag")
+	lastModified := res.Header().Get("Last-Modified")
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.NotEmpty(t, etag)
+	assert.Equal(t, "Fri, 10 May 2024 12:30:15 GMT", lastModified)
+	assert.Contains(t, res.Body.String(), `"title":"title"`)
+
+	tests := []struct {
+		name           string
+		header         string
+		value          string
+		expectedStatus int
+	}{
+		{"Matching ETag", "If-None-Match", etag, http.StatusNotModified},
+		{"Stale ETag", "If-None-Match", `"0-0"`, http.StatusOK},
+		{"Not modified since", "If-Modified-Since", lastModified, http.StatusNotModified},
+		{"Modified since", "If-Modified-Since", "Fri, 10 May 2024 12:00:00 GMT", http.StatusOK},
+	}
+
+	for _, testCase := range tests {
+		t.Run(testCase.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/diaryEntries/"+formatId(diaryEntry.Id), nil)
+			req.Header.Set(testCase.header, testCase.value)
+			res := httptest.NewRecorder()
+
+			router.ServeHTTP(res, req)
+
+			assert.Equal(t, testCase.expectedStatus, res.Code)
+			assert.Equal(t, etag, res.Header().Get("ETag"))
+
+			if testCase.expectedStatus == http.StatusNotModified {
+				assert.Empty(t, res.Body.String())
+			}
+		})
+	}
+
+	t.Run("ETag changes on update", func(t *testing.T) {
+		_, updateErr := diaryEntryService.UpdateDiaryEntry(diaryEntry.Id, &services.UpdateDiaryEntryBody{Title: "new title", Content: "content", PublishDate: 100}, time.UTC)
+		assert.NoError(t, updateErr)
+
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/diaryEntries/"+formatId(diaryEntry.Id), nil)
+		req.Header.Set("If-None-Match", etag)
+		res := httptest.NewRecorder()
+
+		router.ServeHTTP(res, req)
+
+		assert.Equal(t, http.StatusOK, res.Code)
+		assert.NotEqual(t, etag, res.Header().Get("ETag"))
+	})
+
+	t.Run("ETag changes on update within the same second", func(t *testing.T) {
+		updatedEntry := *diaryEntry
+		updatedEntry.Content = "new content"
+
+		assert.NotEqual(t, getDiaryEntryETag(diaryEntry), getDiaryEntryETag(&updatedEntry))
+	})
+
+	t.Run("Missing entry", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/diaryEntries/999", nil)
+		res := httptest.NewRecorder()
+
+		router.ServeHTTP(res, req)
+
+		assert.Equal(t, http.StatusNotFound, res.Code)
+	})
+}
+
+func TestHandleCreateDiaryEntryEvictsUserEntries(t *testing.T) {
+	t.Setenv("API_CACHE_EXPIRATION", "1h")
+	t.Setenv("API_CACHE_EVICTION_INTERVAL", "1h")
+
+	var userId uint = 4321
+	useExistingUsers(t, userId)
+	database := memory.NewDatabase()
+
+	originalDiaryEntryService := diaryEntryService
+	diaryEntryService = services.NewDefaultDiaryEntryService(memory.NewDiaryEntryStorage(database), memory.NewActivityRegistrationStorage(database), memory.NewUserStorage(database))
+	defer func() { diaryEntryService = originalDiaryEntryService }()
+
+	accessToken, tokenErr := auth.GetTokenManager().GenerateToken(models.User{Id: userId}, models.Access)
+	assert.NoError(t, tokenErr)
+
+	cachedKeys := []string{utils.BuildUserCacheKey(userId), utils.BuildUserDateRangeCacheKey(userId, 0, 1000)}
+	calls := 0
+	getEntries := func() (interface{}, error) {
+		calls++
+		return []*models.DiaryEntry{}, nil
+	}
+
+	for _, key := range cachedKeys {
+		services.GetCacheServiceInstance().CacheResource(getEntries, constants.DiaryEntriesCacheResource, key, false)
+	}
+
+	router := mux.NewRouter()
+	InitDiaryEntryRoutes(router)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/diaryEntries", strings.NewReader(`{"title":"title","content":"content","publishDate":1700000005}`))
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	res := httptest.NewRecorder()
+
+	router.ServeHTTP(res, req)
+
+	assert.Equal(t, http.StatusCreated, res.Code)
+
+	calls = 0
+
+	for _, key := range cachedKeys {
+		services.GetCacheServiceInstance().CacheResource(getEntries, constants.DiaryEntriesCacheResource, key, false)
+	}
+
+	assert.Equal(t, len(cachedKeys), calls, "all the cached variants of the user entries are evicted")
+}
+
+func TestHandleDiaryEntryBodyUnknownFields(t *testing.T) {
+	router := mux.NewRouter()
+	InitDiaryEntryRoutes(router)
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+	}{
+		{"Create with an id", http.MethodPost, "/api/v1/diaryEntries", `{"id":5,"title":"title","content":"content","publishDate":1700000005}`},
+		{"Update with an owner", http.MethodPut, "/api/v1/diaryEntries/1", `{"title":"title","content":"content","publishDate":1700000005,"userId":2}`},
+		{"Import with an owner", http.MethodPost, "/api/v1/diaryEntries/import", `[{"title":"title","content":"content","publishDate":1700000005,"userId":2}]`},
+		{"Import validation with an owner", http.MethodPost, "/api/v1/diaryEntries/import/validate", `[{"title":"title","content":"content","publishDate":1700000005,"userId":2}]`},
+	}
+
+	for _, testCase := range tests {
+		t.Run(testCase.name, func(t *testing.T) {
+			req := httptest.NewRequest(testCase.method, testCase.path, strings.NewReader(testCase.body))
+			res := httptest.NewRecorder()
+
+			router.ServeHTTP(res, req)
+
+			assert.Equal(t, http.StatusBadRequest, res.Code)
+			assert.Contains(t, res.Body.String(), "is not allowed in the request body")
+		})
+	}
+}
+
+func TestHandleDeleteUserEntries(t *testing.T) {
+	t.Setenv("API_CACHE_EXPIRATION", "1h")
+	t.Setenv("API_CACHE_EVICTION_INTERVAL", "1h")
+
+	var userId uint = 4324
+	useExistingUsers(t, userId)
+	database := memory.NewDatabase()
+	diaryEntryStorage := memory.NewDiaryEntryStorage(database)
+
+	originalDiaryEntryService := diaryEntryService
+	diaryEntryService = services.NewDefaultDiaryEntryService(diaryEntryStorage, memory.NewActivityRegistrationStorage(database), memory.NewUserStorage(database))
+	defer func() { diaryEntryService = originalDiaryEntryService }()
+
+	assert.NoError(t, diaryEntryStorage.CreateMany([]*models.DiaryEntry{
+		{Title: "before", Registration: models.ActivityRegistration{RegistrationDate: 99, UserRefer: userId}},
+		{Title: "start", Registration: models.ActivityRegistration{RegistrationDate: 100, UserRefer: userId}},
+		{Title: "end", Registration: models.ActivityRegistration{RegistrationDate: 200, UserRefer: userId}},
+	}))
+
+	calls := 0
+	getEntries := func() (interface{}, error) {
+		calls++
+		return []*models.DiaryEntry{}, nil
+	}
+	services.GetCacheServiceInstance().CacheResource(getEntries, constants.DiaryEntriesCacheResource, utils.BuildUserCacheKey(userId), false)
+
+	router := mux.NewRouter()
+	InitDiaryEntryRoutes(router)
+	userEntriesPath := "/api/v1/diaryEntries/user/" + formatId(userId)
+
+	tests := []struct {
+		name  string
+		query string
+	}{
+		{"Missing start date", "?end_date=200"},
+		{"Missing end date", "?start_date=100"},
+		{"End date before start date", "?start_date=200&end_date=100"},
+	}
+
+	for _, testCase := range tests {
+		t.Run(testCase.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodDelete, userEntriesPath+testCase.query, nil)
+			res := httptest.NewRecorder()
+
+			router.ServeHTTP(res, req)
+
+			assert.Equal(t, http.StatusBadRequest, res.Code)
+		})
+	}
+
+	req := httptest.NewRequest(http.MethodDelete, userEntriesPath+"?start_date=100&end_date=200", nil)
+	res := httptest.NewRecorder()
+
+	router.ServeHTTP(res, req)
+
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.JSONEq(t, `{"deleted":2}`, res.Body.String())
+
+	userEntries, getErr := diaryEntryService.GetUserEntries(userId)
+	assert.NoError(t, getErr)
+	assert.Len(t, userEntries, 1)
+	assert.Equal(t, "before", userEntries[0].Title)
+
+	services.GetCacheServiceInstance().CacheResource(getEntries, constants.DiaryEntriesCacheResource, utils.BuildUserCacheKey(userId), false)
+	assert.Equal(t, 2, calls, "the user entries are evicted from the cache")
+}
+
+func TestHandleGetUserEntriesDateRangeCache(t *testing.T) {
+	t.Setenv("API_CACHE_EXPIRATION", "1h")
+	t.Setenv("API_CACHE_EVICTION_INTERVAL", "1h")
+
+	var userId uint = 4322
+	useExistingUsers(t, userId)
+	database := memory.NewDatabase()
+	diaryEntryStorage := memory.NewDiaryEntryStorage(database)
+
+	originalDiaryEntryService := diaryEntryService
+	diaryEntryService = services.NewDefaultDiaryEntryService(diaryEntryStorage, memory.NewActivityRegistrationStorage(database), memory.NewUserStorage(database))
+	defer func() { diaryEntryService = originalDiaryEntryService }()
+
+	accessToken, tokenErr := auth.GetTokenManager().GenerateToken(models.User{Id: userId}, models.Access)
+	assert.NoError(t, tokenErr)
+
+	router := mux.NewRouter()
+	InitDiaryEntryRoutes(router)
+
+	countEntries := func(query string) int {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/diaryEntries/user/"+formatId(userId)+"?start_date=1700000000&end_date=1700000010"+query, nil)
+		res := httptest.NewRecorder()
+
+		router.ServeHTTP(res, req)
+
+		assert.Equal(t, http.StatusOK, res.Code)
+		var entries []map[string]interface{}
+		assert.NoError(t, json.Unmarshal(res.Body.Bytes(), &entries))
+
+		return len(entries)
+	}
+
+	assert.Equal(t, 0, countEntries(""))
+	assert.Equal(t, 0, countEntries("&fields=summary"))
+
+	// Entries stored without going through the handlers are not seen until the cache is evicted
+	assert.NoError(t, diaryEntryStorage.CreateMany([]*models.DiaryEntry{
+		{Title: "title", Content: "content", Registration: models.ActivityRegistration{RegistrationDate: 1700000001, UserRefer: userId}},
+	}))
+	assert.Equal(t, 0, countEntries(""))
+	assert.Equal(t, 0, countEntries("&fields=summary"))
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/diaryEntries", strings.NewReader(`{"title":"title","content":"content","publishDate":1700000005}`))
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	assert.Equal(t, http.StatusCreated, res.Code)
+
+	assert.Equal(t, 2, countEntries(""))
+	assert.Equal(t, 2, countEntries("&fields=summary"))
+}
+
+func TestHandleGetUserEntriesOnThisDay(t *testing.T) {
+	t.Setenv("API_CACHE_EXPIRATION", "1h")
+	t.Setenv("API_CACHE_EVICTION_INTERVAL", "1h")
+
+	var userId uint = 4325
+	useExistingUsers(t, userId)
+	database := memory.NewDatabase()
+	diaryEntryStorage := memory.NewDiaryEntryStorage(database)
+
+	originalDiaryEntryService := diaryEntryService
+	diaryEntryService = services.NewDefaultDiaryEntryService(diaryEntryStorage, memory.NewActivityRegistrationStorage(database), memory.NewUserStorage(database))
+	defer func() { diaryEntryService = originalDiaryEntryService }()
+
+	madrid, _ := time.LoadLocation("Europe/Madrid")
+	now := time.Now().In(madrid)
+	lastYear := time.Date(now.Year()-1, now.Month(), now.Day(), 12, 0, 0, 0, madrid)
+	assert.NoError(t, diaryEntryStorage.CreateMany([]*models.DiaryEntry{
+		{Title: "last year", Content: "content", Registration: models.ActivityRegistration{RegistrationDate: lastYear.Unix(), UserRefer: userId}},
+		{Title: "another day", Content: "content", Registration: models.ActivityRegistration{RegistrationDate: lastYear.AddDate(0, 0, -2).Unix(), UserRefer: userId}},
+	}))
+
+	router := mux.NewRouter()
+	InitDiaryEntryRoutes(router)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/diaryEntries/user/"+formatId(userId)+"/on-this-day?tz=Europe/Madrid", nil)
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+
+	entriesByYear := map[string][]*models.DiaryEntry{}
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.NoError(t, json.Unmarshal(res.Body.Bytes(), &entriesByYear))
+	assert.Len(t, entriesByYear, 1)
+	assert.Len(t, entriesByYear[strconv.Itoa(lastYear.Year())], 1)
+	assert.Equal(t, "last year", entriesByYear[strconv.Itoa(lastYear.Year())][0].Title)
+
+	// Test case: Unknown timezones are rejected
+	req = httptest.NewRequest(http.MethodGet, "/api/v1/diaryEntries/user/"+formatId(userId)+"/on-this-day?tz=Mars/Olympus", nil)
+	res = httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+
+	assert.Equal(t, http.StatusBadRequest, res.Code)
+}
+
+func TestHandleGetUserEntriesCalendarRange(t *testing.T) {
+	var userId uint = 4326
+	useExistingUsers(t, userId)
+
+	router := mux.NewRouter()
+	InitDiaryEntryRoutes(router)
+
+	for _, query := range []string{
+		// Test case: The range ends before it starts
+		"start_date=1700000001&end_date=1700000000",
+		// Test case: The range spans more days than allowed
+		"start_date=1600000000&end_date=1700000000",
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/diaryEntries/user/"+formatId(userId)+"/calendar?"+query, nil)
+		res := httptest.NewRecorder()
+		router.ServeHTTP(res, req)
+
+		assert.Equal(t, http.StatusBadRequest, res.Code, query)
+		assert.Contains(t, res.Body.String(), fmt.Sprintf(constants.ErrorCalendarRangeNotValid, constants.DiaryEntryCalendarMaxDays))
+	}
+}
+
+func TestHandleUpdateUnknownDiaryEntry(t *testing.T) {
+	database := memory.NewDatabase()
+
+	originalDiaryEntryService := diaryEntryService
+	diaryEntryService = services.NewDefaultDiaryEntryService(memory.NewDiaryEntryStorage(database), memory.NewActivityRegistrationStorage(database), memory.NewUserStorage(database))
+	defer func() { diaryEntryService = originalDiaryEntryService }()
+
+	router := mux.NewRouter()
+	InitDiaryEntryRoutes(router)
+
+	req := httptest.NewRequest(http.MethodPut, "/api/v1/diaryEntries/999", strings.NewReader(`{"title":"title","content":"content","publishDate":1700000005}`))
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+
+	assert.Equal(t, http.StatusNotFound, res.Code)
+}
+
+func formatId(id uint) string {
+	return strconv.FormatUint(uint64(id), 10)
+}
+
+func TestHandleGetUserEntriesStream(t *testing.T) {
+	t.Setenv("API_CACHE_EXPIRATION", "1h")
+	t.Setenv("API_CACHE_EVICTION_INTERVAL", "1h")
+
+	var userId uint = 5678
+	useExistingUsers(t, userId)
+	database := memory.NewDatabase()
+	diaryEntryStorage := memory.NewDiaryEntryStorage(database)
+	assert.NoError(t, diaryEntryStorage.CreateMany([]*models.DiaryEntry{
+		{Title: "first", Content: "content", Registration: models.ActivityRegistration{RegistrationDate: 100, UserRefer: userId}},
+		{Title: "second", Content: "<content>", Registration: models.ActivityRegistration{RegistrationDate: 200, UserRefer: userId}},
+	}))
+
+	originalDiaryEntryService := diaryEntryService
+	diaryEntryService = services.NewDefaultDiaryEntryService(diaryEntryStorage, memory.NewActivityRegistrationStorage(database), memory.NewUserStorage(database))
+	defer func() { diaryEntryService = originalDiaryEntryService }()
+
+	router := mux.NewRouter()
+	InitDiaryEntryRoutes(router)
+	getEntries := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/diaryEntries/user/"+formatId(userId), nil)
+		res := httptest.NewRecorder()
+		router.ServeHTTP(res, req)
+		return res
+	}
+
+	t.Setenv("API_STREAM_LIST_RESPONSES", "false")
+	bufferedRes := getEntries()
+	services.GetCacheServiceInstance().EvictUserResource(constants.DiaryEntriesCacheResource, userId)
+
+	t.Setenv("API_STREAM_LIST_RESPONSES", "true")
+	streamedRes := getEntries()
+
+	// Test case: The streamed list is the same the buffered one
+	assert.Equal(t, http.StatusOK, streamedRes.Code)
+	assert.Equal(t, "application/json", streamedRes.Header().Get("Content-Type"))
+	assert.JSONEq(t, bufferedRes.Body.String(), streamedRes.Body.String())
+
+	// Test case: The streamed list is not cached, so new entries are listed right away
+	assert.NoError(t, diaryEntryStorage.CreateMany([]*models.DiaryEntry{
+		{Title: "third", Content: "content", Registration: models.ActivityRegistration{RegistrationDate: 300, UserRefer: userId}},
+	}))
+	streamedEntries := []*models.DiaryEntry{}
+	assert.NoError(t, json.NewDecoder(getEntries().Body).Decode(&streamedEntries))
+	assert.Len(t, streamedEntries, 3)
+}
+
+// Diary entry storage that generates the entries of any user as they are streamed, without storing them.
+type generatedDiaryEntryStorage struct {
+	*memory.DiaryEntryStorage
+	count   int
+	content string
+	// Called every sampleEvery entries streamed.
+	sample      func()
+	sampleEvery int
+}
+
+func (storage *generatedDiaryEntryStorage) StreamByUserId(userId uint, yield func(diaryEntry *models.DiaryEntry) error) error {
+	for i := 0; i < storage.count; i++ {
+		if i%storage.sampleEvery == 0 {
+			storage.sample()
+		}
+
+		diaryEntry := &models.DiaryEntry{Id: uint(i + 1), Title: "title", Content: storage.content, Registration: models.ActivityRegistration{Id: uint(i + 1), RegistrationDate: int64(i), UserRefer: userId}}
+
+		if err := yield(diaryEntry); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Response writer that only counts the bytes written to it.
+type countingResponseWriter struct {
+	header  http.Header
+	status  int
+	written int
+}
+
+func (res *countingResponseWriter) Header() http.Header {
+	return res.header
+}
+
+func (res *countingResponseWriter) Write(data []byte) (int, error) {
+	res.written += len(data)
+	return len(data), nil
+}
+
+func (res *countingResponseWriter) WriteHeader(status int) {
+	res.status = status
+}
+
+func TestHandleGetUserEntriesStreamBoundedMemory(t *testing.T) {
+	t.Setenv("API_STREAM_LIST_RESPONSES", "true")
+
+	var userId uint = 5679
+	useExistingUsers(t, userId)
+	database := memory.NewDatabase()
+
+	const entryCount = 64 * 1024
+	const maxHeapGrowth = 16 * 1024 * 1024
+	var baseline runtime.MemStats
+	var peakHeap uint64
+	diaryEntryStorage := &generatedDiaryEntryStorage{
+		DiaryEntryStorage: memory.NewDiaryEntryStorage(database),
+		count:             entryCount,
+		content:           strings.Repeat("a", 1024),
+		sampleEvery:       1024,
+		sample: func() {
+			var stats runtime.MemStats
+			runtime.ReadMemStats(&stats)
+			peakHeap = max(peakHeap, stats.HeapAlloc)
+		},
+	}
+
+	originalDiaryEntryService := diaryEntryService
+	diaryEntryService = services.NewDefaultDiaryEntryService(diaryEntryStorage, memory.NewActivityRegistrationStorage(database), memory.NewUserStorage(database))
+	defer func() { diaryEntryService = originalDiaryEntryService }()
+
+	router := mux.NewRouter()
+	InitDiaryEntryRoutes(router)
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/diaryEntries/user/"+formatId(userId), nil)
+	res := &countingResponseWriter{header: http.Header{}}
+
+	runtime.GC()
+	runtime.ReadMemStats(&baseline)
+	router.ServeHTTP(res, req)
+
+	// Test case: The whole list is written, while the heap grows way less than its size
+	assert.Equal(t, http.StatusOK, res.status)
+	assert.Greater(t, res.written, entryCount*1024)
+	assert.Less(t, peakHeap, baseline.HeapAlloc+maxHeapGrowth)
+}
+
+// Diary entry storage whose stream fails after yielding a single entry.
+type failingStreamDiaryEntryStorage struct {
+	*memory.DiaryEntryStorage
+}
+
+func (storage *failingStreamDiaryEntryStorage) StreamByUserId(userId uint, yield func(diaryEntry *models.DiaryEntry) error) error {
+	if err := yield(&models.DiaryEntry{Id: 1, Title: "title", Content: "content", Registration: models.ActivityRegistration{Id: 1, UserRefer: userId}}); err != nil {
+		return err
+	}
+
+	return errors.New("connection lost")
+}
+
+func TestHandleGetUserEntriesStreamAbort(t *testing.T) {
+	t.Setenv("API_STREAM_LIST_RESPONSES", "true")
+
+	var userId uint = 5680
+	useExistingUsers(t, userId)
+	database := memory.NewDatabase()
+
+	originalDiaryEntryService := diaryEntryService
+	diaryEntryService = services.NewDefaultDiaryEntryService(&failingStreamDiaryEntryStorage{memory.NewDiaryEntryStorage(database)}, memory.NewActivityRegistrationStorage(database), memory.NewUserStorage(database))
+	defer func() { diaryEntryService = originalDiaryEntryService }()
+
+	router := mux.NewRouter()
+	InitDiaryEntryRoutes(router)
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/diaryEntries/user/"+formatId(userId), nil)
+	res := httptest.NewRecorder()
+
+	// Test case: A failure after the list started aborts the response instead of ending it as a success
+	assert.PanicsWithValue(t, http.ErrAbortHandler, func() { router.ServeHTTP(res, req) })
+}
+
+func TestHandleValidateDiaryEntries(t *testing.T) {
+	database := memory.NewDatabase()
+
+	originalDiaryEntryService := diaryEntryService
+	diaryEntryService = services.NewDefaultDiaryEntryService(memory.NewDiaryEntryStorage(database), memory.NewActivityRegistrationStorage(database), memory.NewUserStorage(database))
+	defer func() { diaryEntryService = originalDiaryEntryService }()
+
+	router := mux.NewRouter()
+	InitDiaryEntryRoutes(router)
+
+	longTitle := strings.Repeat("a", 201)
+	body := `[
+		{"title":"title","content":"content","publishDate":1700000005},
+		{"title":"","content":"content","publishDate":1700000005},
+		{"title":"` + longTitle + `","content":"content","publishDate":1700000005},
+		{"title":"title","content":"content","publishDate":1700000006}
+	]`
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/diaryEntries/import/validate", strings.NewReader(body))
+	res := httptest.NewRecorder()
+
+	router.ServeHTTP(res, req)
+
+	validations := []*services.DiaryEntryValidation{}
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.NoError(t, json.NewDecoder(res.Body).Decode(&validations))
+	assert.Len(t, validations, 4)
+
+	for index, expectedValid := range []bool{true, false, false, true} {
+		assert.Equal(t, index, validations[index].Index)
+		assert.Equal(t, expectedValid, validations[index].Valid, "entry %d", index)
+		assert.Equal(t, expectedValid, len(validations[index].Errors) == 0, "entry %d", index)
+	}
+
+	// Test case: Requests without a batch are told the body is required
+	req = httptest.NewRequest(http.MethodPost, "/api/v1/diaryEntries/import/validate", strings.NewReader(" "))
+	res = httptest.NewRecorder()
+
+	router.ServeHTTP(res, req)
+
+	assert.Equal(t, http.StatusBadRequest, res.Code)
+	assert.Contains(t, res.Body.String(), constants.ErrorRequestBodyRequired)
+
+	// Test case: Empty batches are rejected, as they are on import
+	req = httptest.NewRequest(http.MethodPost, "/api/v1/diaryEntries/import/validate", strings.NewReader(`[]`))
+	res = httptest.NewRecorder()
+
+	router.ServeHTTP(res, req)
+
+	assert.Equal(t, http.StatusBadRequest, res.Code)
+}
+
+// Reader repeating an entry to import endlessly, as the rest of a batch too large to read whole.
+type endlessEntriesReader struct {
+	entry []byte
+	read  int
+}
+
+func (reader *endlessEntriesReader) Read(data []byte) (int, error) {
+	written := 0
+
+	for written < len(data) {
+		copied := copy(data[written:], reader.entry[reader.read%len(reader.entry):])
+		written += copied
+		reader.read += copied
+	}
+
+	return written, nil
+}
+
+func TestReadDiaryEntriesToImport(t *testing.T) {
+	entry := `{"title":"title","content":"content","publishDate":1700000005}`
+
+	tests := []struct {
+		name           string
+		body           io.Reader
+		expectedStatus int
+		expectedError  string
+	}{
+		{"Batch over the max size", io.MultiReader(strings.NewReader("["), &endlessEntriesReader{entry: []byte(entry + ",")}), http.StatusBadRequest, services.ErrDiaryEntryImportBatchSize.Error()},
+		{"Body over the max size", io.MultiReader(strings.NewReader(`[{"title":"title","content":"`), &endlessEntriesReader{entry: []byte("a")}), http.StatusRequestEntityTooLarge, constants.ErrorRequestBodyTooLarge},
+		{"Not a list", strings.NewReader(entry), http.StatusBadRequest, "Not valid JSON."},
+		{"Unterminated list", strings.NewReader("[" + entry), http.StatusBadRequest, "Not valid JSON."},
+		{"Unknown field", strings.NewReader(`[{"title":"title","owner":2}]`), http.StatusBadRequest, fmt.Sprintf(constants.ErrorUnknownBodyField, "owner")},
+	}
+
+	for _, testCase := range tests {
+		t.Run(testCase.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/diaryEntries/import", testCase.body)
+
+			entryBodies, httpErr := readDiaryEntriesToImport(httptest.NewRecorder(), req)
+
+			assert.Nil(t, entryBodies)
+			assert.Equal(t, testCase.expectedStatus, httpErr.Status)
+			assert.Equal(t, testCase.expectedError, httpErr.Description)
+		})
+	}
+
+	// Test case: Batches up to the max size are read whole
+	entries := strings.TrimSuffix(strings.Repeat(entry+",", constants.DiaryEntryImportMaxBatchSize), ",")
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/diaryEntries/import", strings.NewReader("["+entries+"]"))
+
+	entryBodies, httpErr := readDiaryEntriesToImport(httptest.NewRecorder(), req)
+
+	assert.Nil(t, httpErr)
+	assert.Len(t, entryBodies, constants.DiaryEntryImportMaxBatchSize)
+}
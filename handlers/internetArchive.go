@@ -1,44 +1,76 @@
 package handlers
 
 import (
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"hash"
 	"io"
 	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
 
+	"github.com/adfer-dev/analock-api/config"
 	"github.com/adfer-dev/analock-api/constants"
+	"github.com/adfer-dev/analock-api/models"
 	"github.com/adfer-dev/analock-api/services"
 	"github.com/adfer-dev/analock-api/utils"
 	"github.com/gorilla/mux"
 )
 
+type BookDownloadUrlResponse struct {
+	Url  string `json:"url"`
+	Note string `json:"note"`
+}
+
 var internetArchiveService services.InternetArchiveService = &services.InternetArchiveServiceImpl{}
 
 func InitInternetArchiveRoutes(router *mux.Router) {
 	router.HandleFunc("/api/v1/internetArchive/books/search", utils.ParseToHandlerFunc(handleSearchInternetArchiveBooks)).Methods("GET")
 	router.HandleFunc("/api/v1/internetArchive/books/{bookId}/metadata", utils.ParseToHandlerFunc(handleGetInternetArchiveBookMetadata)).Methods("GET")
-	router.HandleFunc("/api/v1/internetArchive/books/{bookId}/download", utils.ParseToHandlerFunc(handleBookDownload)).Methods("GET")
+	router.HandleFunc("/api/v1/internetArchive/books/{bookId}/files", utils.ParseToHandlerFunc(handleGetInternetArchiveBookFiles)).Methods("GET")
+	router.HandleFunc("/api/v1/internetArchive/books/{bookId}/related", utils.ParseToHandlerFunc(handleGetRelatedInternetArchiveBooks)).Methods("GET")
+	router.HandleFunc("/api/v1/internetArchive/books/{bookId}/download", utils.WithWriteTimeout(
+		config.Get().Server.DownloadWriteTimeout,
+		utils.ParseToHandlerFunc(handleBookDownload),
+	)).Methods("GET")
+	router.HandleFunc("/api/v1/internetArchive/books/{bookId}/download", utils.ParseToHandlerFunc(handleBookDownloadHead)).Methods("HEAD")
+
+	if config.Get().InternetArchive.DirectDownloadEnabled {
+		router.HandleFunc("/api/v1/internetArchive/books/{bookId}/download-url", utils.ParseToHandlerFunc(handleGetBookDownloadUrl)).Methods("GET")
+	}
 }
 
 // @Summary		Gets all Internet Archive books that match given params
-// @Description	Gets all Internet Archive books that match given params
+// @Description	Gets all Internet Archive books that match given params.
+// @Description	Results are paged by the rows param, and numFound and start can be used to compute the number of pages.
+// @Description	If the live search fails and stale results are retained, they are returned with a warning and the X-Cache: stale header.
+// @Description	Fails with 400 if the collection is not in API_IA_ALLOWED_COLLECTIONS, when it is set.
 // @Tags			internet archive
 // @Produce		json
 // @Param			collection	query		string	true	"The collection"
 // @Param			language		query		string	true	"The language"
-// @Param			subject		query		string	true	"The subject"
+// @Param			subject		query		[]string	true	"The subjects, books with any of them match"	collectionFormat(multi)
 // @Param			rows		query		int	true	"Row limit"
+// @Param			page		query		int	false	"Page of the results, starting at 1"
+// @Param			refresh		query		bool	false	"Skip cached values and refresh them, only honored for admins"
+// @Param			Cache-Control	header		string	false	"no-cache skips cached values and refreshes them, only honored for admins"
 // @Success		200			{object}		models.InternetArchiveSearchResponse
 // @Failure		400			{object}	models.HttpError
 // @Failure		500			{object}	models.HttpError
+// @Failure		503			{object}	models.HttpError
 // @Security		BearerAuth
 // @Router			/internetArchive/books/search [get]
 func handleSearchInternetArchiveBooks(res http.ResponseWriter, req *http.Request) error {
 	collection := req.URL.Query().Get("collection")
 	language := req.URL.Query().Get("language")
-	subject := req.URL.Query().Get("subject")
+	subjects := searchSubjects(req)
 	rows := req.URL.Query().Get("rows")
 
-	if len(collection) == 0 || len(language) == 0 || len(subject) == 0 || len(rows) == 0 {
+	if len(collection) == 0 || len(language) == 0 || len(subjects) == 0 || len(rows) == 0 {
 		return utils.WriteError(
 			res,
 			400,
@@ -46,12 +78,29 @@ func handleSearchInternetArchiveBooks(res http.ResponseWriter, req *http.Request
 		)
 	}
 
-	books, err := services.GetCacheServiceInstance().CacheResource(
+	if !services.IsInternetArchiveCollectionAllowed(collection) {
+		return utils.WriteError(res, 400, fmt.Sprintf(constants.ErrorCollectionNotAllowed, collection))
+	}
+
+	page := 1
+
+	if pageString := req.URL.Query().Get("page"); len(pageString) > 0 {
+		parsedPage, parseErr := strconv.Atoi(pageString)
+
+		if parseErr != nil || parsedPage <= 0 || (parsedPage > 1 && parsedPage > int(config.Get().InternetArchive.MaxSearchPage)) {
+			return utils.WriteError(res, 400, fmt.Sprintf(constants.QueryParamError, "page"))
+		}
+
+		page = parsedPage
+	}
+
+	books, stale, err := services.GetCacheServiceInstance().CacheResourceOrStale(
 		func() (interface{}, error) {
-			return internetArchiveService.SearchBooks(collection, language, subject, rows)
+			return internetArchiveService.SearchBooks(collection, language, subjects, rows, page)
 		},
 		constants.InternetArchiveBookSearchCacheResource,
-		fmt.Sprintf("collection%s-language%s-subject%s-rows%s", collection, language, subject, rows),
+		getSearchCacheKey(collection, language, subjects, rows, page),
+		cacheBypassRequested(req),
 	)
 
 	if err != nil {
@@ -61,22 +110,78 @@ func handleSearchInternetArchiveBooks(res http.ResponseWriter, req *http.Request
 		)
 		return utils.WriteError(
 			res,
-			500,
+			internetArchiveErrorStatus(err),
 			"could not retrieve internet archive books.",
 		)
 	}
 
+	if stale {
+		return writeStaleSearchResults(res, books)
+	}
+
 	return utils.WriteJSON(res, 200, &books)
 }
 
+// Gets the distinct non-empty subject params of the request, sorted so the same subjects in any order share the cache.
+func searchSubjects(req *http.Request) []string {
+	subjects := []string{}
+
+	for _, subject := range req.URL.Query()["subject"] {
+		if len(subject) > 0 {
+			subjects = append(subjects, subject)
+		}
+	}
+
+	slices.Sort(subjects)
+
+	return slices.Compact(subjects)
+}
+
+// Gets the cache key of a search. The params are encoded as a query string, so values holding
+// separators, like a subject with a comma, cannot make two different searches share a key.
+func getSearchCacheKey(collection string, language string, subjects []string, rows string, page int) string {
+	return url.Values{
+		"collection": {collection},
+		"language":   {language},
+		"subject":    subjects,
+		"rows":       {rows},
+		"page":       {strconv.Itoa(page)},
+	}.Encode()
+}
+
+// Writes the cached search results served because the live search failed, warning they may be outdated.
+func writeStaleSearchResults(res http.ResponseWriter, books interface{}) error {
+	cachedResults, decodeErr := services.CachedValueAs[*models.InternetArchiveSearchResponse](books)
+
+	if decodeErr != nil {
+		utils.GetCustomLogger().Errorf(
+			"Could not read stale search results: %s\n",
+			decodeErr.Error(),
+		)
+		return utils.WriteError(res, 500, "could not retrieve internet archive books.")
+	}
+
+	// The cached results are copied, as the in-memory cache shares them with later requests
+	staleResults := *cachedResults
+	staleResults.Warning = constants.WarningStaleSearchResults
+	res.Header().Set(constants.CacheStatusHeader, constants.CacheStatusStale)
+
+	return utils.WriteJSON(res, 200, &staleResults)
+}
+
 // @Summary		Get IA book metadata
 // @Description	Gets the metadata of the book that matches given identifier
+// @Description	Fails with 403 if the book is not in any of the collections in API_IA_ALLOWED_COLLECTIONS, when it is set.
 // @Tags			internet archive
 // @Produce			json
 // @Param			bookId			path		string	true	"The IA book's identifier"
+// @Param			refresh		query		bool	false	"Skip cached values and refresh them, only honored for admins"
+// @Param			Cache-Control	header		string	false	"no-cache skips cached values and refreshes them, only honored for admins"
 // @Success		200			{object}		models.InternetArchiveMetadataResponse
 // @Failure		400			{object}	models.HttpError
+// @Failure		403			{object}	models.HttpError
 // @Failure		500			{object}	models.HttpError
+// @Failure		503			{object}	models.HttpError
 // @Security		BearerAuth
 // @Router			/internetArchive/books/{bookId}/metadata [get]
 func handleGetInternetArchiveBookMetadata(res http.ResponseWriter, req *http.Request) error {
@@ -90,13 +195,7 @@ func handleGetInternetArchiveBookMetadata(res http.ResponseWriter, req *http.Req
 		)
 	}
 
-	metadata, err := services.GetCacheServiceInstance().CacheResource(
-		func() (interface{}, error) {
-			return internetArchiveService.GetBookMetadata(bookId)
-		},
-		constants.InternetArchiveBookMetadataCacheResource,
-		fmt.Sprintf("book-%s", bookId),
-	)
+	metadata, err := getCachedBookMetadata(bookId, cacheBypassRequested(req))
 
 	if err != nil {
 		utils.GetCustomLogger().Errorf(
@@ -105,7 +204,7 @@ func handleGetInternetArchiveBookMetadata(res http.ResponseWriter, req *http.Req
 		)
 		return utils.WriteError(
 			res,
-			500,
+			internetArchiveErrorStatus(err),
 			"could not retrieve internet archive book metadata.",
 		)
 	}
@@ -113,15 +212,131 @@ func handleGetInternetArchiveBookMetadata(res http.ResponseWriter, req *http.Req
 	return utils.WriteJSON(res, 200, metadata)
 }
 
+// @Summary		Get IA book files
+// @Description	Gets the files of the book that matches given identifier, so one can be chosen to download
+// @Tags			internet archive
+// @Produce			json
+// @Param			bookId			path		string	true	"The IA book's identifier"
+// @Param			format		query		string	false	"Only return the files whose format contains this one, ignoring case (e.g. epub)"
+// @Param			refresh		query		bool	false	"Skip cached values and refresh them, only honored for admins"
+// @Param			Cache-Control	header		string	false	"no-cache skips cached values and refreshes them, only honored for admins"
+// @Success		200			{array}		models.InternetArchiveFile
+// @Failure		400			{object}	models.HttpError
+// @Failure		403			{object}	models.HttpError
+// @Failure		500			{object}	models.HttpError
+// @Failure		503			{object}	models.HttpError
+// @Security		BearerAuth
+// @Router			/internetArchive/books/{bookId}/files [get]
+func handleGetInternetArchiveBookFiles(res http.ResponseWriter, req *http.Request) error {
+	bookId, exists := mux.Vars(req)["bookId"]
+
+	if !exists {
+		return utils.WriteError(
+			res,
+			400,
+			constants.ErrorRequiredParams,
+		)
+	}
+
+	metadata, err := getCachedBookMetadata(bookId, cacheBypassRequested(req))
+
+	if err != nil {
+		utils.GetCustomLogger().Errorf(
+			"Files book request failed: %s\n",
+			err.Error(),
+		)
+		return utils.WriteError(
+			res,
+			internetArchiveErrorStatus(err),
+			"could not retrieve internet archive book files.",
+		)
+	}
+
+	return utils.WriteJSON(res, 200, metadata.FilterFilesByFormat(req.URL.Query().Get("format")))
+}
+
+// @Summary		Get related IA books
+// @Description	Gets the books that share subjects with the book that matches given identifier, excluding the book itself.
+// @Tags			internet archive
+// @Produce			json
+// @Param			bookId			path		string	true	"The IA book's identifier"
+// @Param			rows		query		int	false	"Row limit, 10 by default and 50 at most"
+// @Param			refresh		query		bool	false	"Skip cached values and refresh them, only honored for admins"
+// @Param			Cache-Control	header		string	false	"no-cache skips cached values and refreshes them, only honored for admins"
+// @Success		200			{object}		models.InternetArchiveSearchResponse
+// @Failure		400			{object}	models.HttpError
+// @Failure		403			{object}	models.HttpError
+// @Failure		500			{object}	models.HttpError
+// @Failure		503			{object}	models.HttpError
+// @Security		BearerAuth
+// @Router			/internetArchive/books/{bookId}/related [get]
+func handleGetRelatedInternetArchiveBooks(res http.ResponseWriter, req *http.Request) error {
+	bookId := mux.Vars(req)["bookId"]
+	rows := constants.InternetArchiveRelatedBooksDefaultRows
+
+	if rowsString := req.URL.Query().Get("rows"); len(rowsString) > 0 {
+		parsedRows, parseErr := strconv.Atoi(rowsString)
+
+		if parseErr != nil || parsedRows <= 0 || parsedRows > constants.InternetArchiveRelatedBooksMaxRows {
+			return utils.WriteError(res, 400, fmt.Sprintf(constants.QueryParamError, "rows"))
+		}
+
+		rows = parsedRows
+	}
+
+	bypassCache := cacheBypassRequested(req)
+	relatedBooks, err := services.GetCacheServiceInstance().CacheResource(
+		func() (interface{}, error) {
+			metadata, metadataErr := getCachedBookMetadata(bookId, bypassCache)
+
+			if metadataErr != nil {
+				return nil, metadataErr
+			}
+
+			return internetArchiveService.GetRelatedBooks(&metadata.Metadata, rows)
+		},
+		constants.InternetArchiveRelatedBooksCacheResource,
+		fmt.Sprintf("book-%s-rows%d", bookId, rows),
+		bypassCache,
+	)
+
+	if err != nil {
+		utils.GetCustomLogger().Errorf(
+			"Related books request failed: %s\n",
+			err.Error(),
+		)
+		return utils.WriteError(
+			res,
+			internetArchiveErrorStatus(err),
+			"could not retrieve related internet archive books.",
+		)
+	}
+
+	return utils.WriteJSON(res, 200, relatedBooks)
+}
+
 // @Summary		Downloads given book
 // @Description	Downloads Internet Archive book with given identifier and file name.
+// @Description	The content type and file extension are set from the file format found in the book's metadata.
+// @Description	If a Range header is given, only the requested bytes are returned, allowing to resume downloads.
+// @Description	When the metadata has the file's MD5 checksum, whole downloads are checked against it.
+// @Description	The expected checksum is sent in the X-Checksum-Md5 header, and the result in the X-Checksum-Status trailer.
+// @Description	Checked downloads are sent without Content-Length, as chunked responses, so HTTP/1.1 clients get the trailer.
 // @Tags			internet archive
-// @Produce			application/epub+zip
+// @Produce			application/epub+zip,application/pdf,text/plain,application/octet-stream
 // @Param			bookId			path		string	true	"The IA book's identifier."
 // @Param			file	query		string	true	"The name of the file to be downloaded from IA API."
-// @Success		200			{file}		"Returns book's EPUB file"
+// @Param			Range	header		string	false	"The byte range to download, e.g. bytes=0-1023"
+// @Success		200			{file}		"Returns book's file"
+// @Header		200			{string}	X-Checksum-Md5	"The file's MD5 checksum in the metadata, if any"
+// @Success		206			{file}		"Returns the requested range of book's file"
+// @Header		416			{string}	Content-Range	"The file size, as bytes */size"
 // @Failure		400			{object}	models.HttpError
+// @Failure		403			{object}	models.HttpError
+// @Failure		404			{object}	models.HttpError
+// @Failure		416			"The requested range is not satisfiable, with an empty body"
 // @Failure		500			{object}	models.HttpError
+// @Failure		503			{object}	models.HttpError
 // @Security		BearerAuth
 // @Router			/internetArchive/books/{bookId}/download [get]
 func handleBookDownload(res http.ResponseWriter, req *http.Request) error {
@@ -136,7 +351,29 @@ func handleBookDownload(res http.ResponseWriter, req *http.Request) error {
 		)
 	}
 
-	response, downloadErr := internetArchiveService.DownloadBook(bookId, file)
+	bookFile, bookFileErr := getBookFile(bookId, file)
+
+	if bookFileErr != nil {
+		utils.GetCustomLogger().Errorf(
+			"Metadata book request failed: %s\n",
+			bookFileErr.Error(),
+		)
+		return utils.WriteError(
+			res,
+			internetArchiveErrorStatus(bookFileErr),
+			"could not retrieve internet archive book metadata.",
+		)
+	}
+
+	if bookFile == nil {
+		return utils.WriteError(
+			res,
+			404,
+			"book file not found.",
+		)
+	}
+
+	response, downloadErr := internetArchiveService.DownloadBook(bookId, file, req.Header.Get("Range"))
 	if downloadErr != nil {
 		utils.GetCustomLogger().Errorf(
 			"Download book request failed: %s\n",
@@ -144,17 +381,365 @@ func handleBookDownload(res http.ResponseWriter, req *http.Request) error {
 		)
 		return utils.WriteError(
 			res,
-			500,
+			internetArchiveErrorStatus(downloadErr),
 			"could not download book.",
 		)
 	}
 
 	defer response.Body.Close()
 
-	res.Header().Set("Content-Type", "application/epub+zip")
-	res.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s.epub\"", bookId))
-	res.Header().Set("Content-Length", fmt.Sprintf("%d", response.ContentLength))
-	_, writeErr := io.Copy(res, response.Body)
+	// Other statuses have an error page in the body instead of the file, so a JSON error is sent instead.
+	// Client errors, like restricted or missing files, are relayed as they are.
+	if response.StatusCode != http.StatusOK && response.StatusCode != http.StatusPartialContent &&
+		response.StatusCode != http.StatusRequestedRangeNotSatisfiable {
+		utils.GetCustomLogger().Errorf(
+			"Download book request failed: status %d\n",
+			response.StatusCode,
+		)
+
+		status := http.StatusInternalServerError
+		if response.StatusCode >= 400 && response.StatusCode < 500 {
+			status = response.StatusCode
+		}
+
+		return utils.WriteError(
+			res,
+			status,
+			"could not download book.",
+		)
+	}
+
+	// Unsatisfiable ranges have no file in the body, so only the file size is relayed
+	if response.StatusCode == http.StatusRequestedRangeNotSatisfiable {
+		res.Header().Set("Content-Range", response.Header.Get("Content-Range"))
+		res.WriteHeader(http.StatusRequestedRangeNotSatisfiable)
+		return nil
+	}
+
+	status := http.StatusOK
+
+	// Relay partial responses so clients can resume downloads
+	if response.StatusCode == http.StatusPartialContent {
+		status = response.StatusCode
+		res.Header().Set("Content-Range", response.Header.Get("Content-Range"))
+	}
+
+	if acceptRanges := response.Header.Get("Accept-Ranges"); len(acceptRanges) > 0 {
+		res.Header().Set("Accept-Ranges", acceptRanges)
+	}
+
+	setBookFileHeaders(res, bookId, bookFile, response.ContentLength)
+	downloadWriter := &bookDownloadWriter{ResponseWriter: res, status: status}
+	body := io.Reader(response.Body)
+
+	// Only whole files can be checked against the checksum in the metadata.
+	// The result is sent in a trailer, which HTTP/1.1 clients only get with a chunked response,
+	// so the length is not sent. The expected checksum is also sent for clients to verify the file themselves.
+	var checksum hash.Hash
+	if status == http.StatusOK && len(bookFile.Md5) > 0 {
+		checksum = md5.New()
+		body = io.TeeReader(response.Body, checksum)
+		res.Header().Del("Content-Length")
+		res.Header().Set(constants.ChecksumMd5Header, bookFile.Md5)
+		res.Header().Set("Trailer", constants.ChecksumStatusTrailer)
+	}
+
+	_, copyErr := io.Copy(downloadWriter, body)
+
+	if copyErr == nil && response.ContentLength >= 0 && downloadWriter.written != response.ContentLength {
+		copyErr = fmt.Errorf("expected %d bytes, got %d", response.ContentLength, downloadWriter.written)
+	}
+
+	if copyErr == nil {
+		downloadWriter.start()
 
-	return writeErr
+		if checksum != nil {
+			res.Header().Set(constants.ChecksumStatusTrailer, verifyBookChecksum(bookId, bookFile, checksum))
+		}
+
+		return nil
+	}
+
+	if !downloadWriter.started {
+		utils.GetCustomLogger().Errorf(
+			"Download book request failed before streaming the file: %s\n",
+			copyErr.Error(),
+		)
+
+		for _, header := range []string{"Content-Type", "Content-Disposition", "Content-Length", "Content-Range", "Accept-Ranges", "Trailer", constants.ChecksumMd5Header} {
+			res.Header().Del(header)
+		}
+
+		return utils.WriteError(
+			res,
+			500,
+			"could not download book.",
+		)
+	}
+
+	utils.GetCustomLogger().Errorf(
+		"Download book request failed after streaming %d bytes: %s\n",
+		downloadWriter.written,
+		copyErr.Error(),
+	)
+
+	// The status and part of the file were already sent, so the connection is closed
+	// for the client to notice the download is incomplete, instead of writing an error.
+	panic(http.ErrAbortHandler)
+}
+
+// Compares the checksum of the streamed book file with the one in the metadata, logging a warning on mismatch.
+// Returns the result of the comparison, to be sent to the client.
+func verifyBookChecksum(bookId string, bookFile *models.InternetArchiveFile, checksum hash.Hash) string {
+	streamedChecksum := hex.EncodeToString(checksum.Sum(nil))
+
+	if !strings.EqualFold(streamedChecksum, bookFile.Md5) {
+		utils.GetCustomLogger().Warningf(
+			"Checksum mismatch downloading book %s file %s: expected %s, got %s\n",
+			bookId,
+			bookFile.Name,
+			bookFile.Md5,
+			streamedChecksum,
+		)
+		return constants.ChecksumStatusMismatch
+	}
+
+	return constants.ChecksumStatusVerified
+}
+
+// Response writer that sends the status code along with the first bytes of the file,
+// so an error can still be written if the download fails before any byte is read.
+type bookDownloadWriter struct {
+	http.ResponseWriter
+	status  int
+	started bool
+	written int64
+}
+
+func (writer *bookDownloadWriter) Write(data []byte) (int, error) {
+	writer.start()
+	written, writeErr := writer.ResponseWriter.Write(data)
+	writer.written += int64(written)
+
+	return written, writeErr
+}
+
+// Sends the status code, if it was not sent yet.
+func (writer *bookDownloadWriter) start() {
+	if !writer.started {
+		writer.started = true
+		writer.ResponseWriter.WriteHeader(writer.status)
+	}
+}
+
+// @Summary		Gets given book download headers
+// @Description	Gets the size, type and disposition headers of an Internet Archive book file without downloading it.
+// @Tags			internet archive
+// @Param			bookId	path	string	true	"The IA book's identifier."
+// @Param			file	query	string	true	"The name of the file to be downloaded from IA API."
+// @Success		200		"Book's file headers"
+// @Failure		400		"Required params not provided"
+// @Failure		404		"Book file not found"
+// @Failure		500		"Could not get book file headers"
+// @Failure		503		"Internet Archive is unavailable"
+// @Security		BearerAuth
+// @Router			/internetArchive/books/{bookId}/download [head]
+func handleBookDownloadHead(res http.ResponseWriter, req *http.Request) error {
+	bookId, exists := mux.Vars(req)["bookId"]
+	file := req.URL.Query().Get("file")
+
+	if !exists || len(file) == 0 {
+		res.WriteHeader(400)
+		return nil
+	}
+
+	bookFile, bookFileErr := getBookFile(bookId, file)
+
+	if bookFileErr != nil {
+		utils.GetCustomLogger().Errorf(
+			"Metadata book request failed: %s\n",
+			bookFileErr.Error(),
+		)
+		res.WriteHeader(internetArchiveErrorStatus(bookFileErr))
+		return nil
+	}
+
+	if bookFile == nil {
+		res.WriteHeader(404)
+		return nil
+	}
+
+	response, headErr := internetArchiveService.GetBookFileHeaders(bookId, file)
+
+	if headErr != nil {
+		utils.GetCustomLogger().Errorf(
+			"Book file headers request failed: %s\n",
+			headErr.Error(),
+		)
+		res.WriteHeader(internetArchiveErrorStatus(headErr))
+		return nil
+	}
+
+	response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		res.WriteHeader(response.StatusCode)
+		return nil
+	}
+
+	setBookFileHeaders(res, bookId, bookFile, response.ContentLength)
+	res.WriteHeader(200)
+
+	return nil
+}
+
+// @Summary		Gets given book download URL
+// @Description	Gets the Internet Archive URL of a book file, so clients can download it directly instead of through the API.
+// @Description	The file must be in the book's metadata. The download endpoint is still available for when Internet Archive cannot be reached.
+// @Description	Only available when API_IA_DIRECT_DOWNLOAD_ENABLED is true.
+// @Tags			internet archive
+// @Produce		json
+// @Param			bookId	path		string	true	"The IA book's identifier."
+// @Param			file	query		string	true	"The name of the file to be downloaded from IA API."
+// @Success		200		{object}	BookDownloadUrlResponse
+// @Failure		400		{object}	models.HttpError
+// @Failure		403		{object}	models.HttpError
+// @Failure		404		{object}	models.HttpError
+// @Failure		500		{object}	models.HttpError
+// @Failure		503		{object}	models.HttpError
+// @Security		BearerAuth
+// @Router			/internetArchive/books/{bookId}/download-url [get]
+func handleGetBookDownloadUrl(res http.ResponseWriter, req *http.Request) error {
+	bookId, exists := mux.Vars(req)["bookId"]
+	file := req.URL.Query().Get("file")
+
+	if !exists || len(file) == 0 {
+		return utils.WriteError(
+			res,
+			400,
+			constants.ErrorRequiredParams,
+		)
+	}
+
+	bookFile, bookFileErr := getBookFile(bookId, file)
+
+	if bookFileErr != nil {
+		utils.GetCustomLogger().Errorf(
+			"Metadata book request failed: %s\n",
+			bookFileErr.Error(),
+		)
+		return utils.WriteError(
+			res,
+			internetArchiveErrorStatus(bookFileErr),
+			"could not retrieve internet archive book metadata.",
+		)
+	}
+
+	if bookFile == nil {
+		return utils.WriteError(
+			res,
+			404,
+			"book file not found.",
+		)
+	}
+
+	return utils.WriteJSON(res, 200, BookDownloadUrlResponse{
+		Url:  internetArchiveService.GetBookFileUrl(bookId, bookFile.Name),
+		Note: constants.InternetArchiveDirectDownloadNote,
+	})
+}
+
+// Gets the status code of a failed Internet Archive call.
+// While Internet Archive is unavailable calls fail fast, and clients are told to retry later.
+func internetArchiveErrorStatus(err error) int {
+	if errors.Is(err, services.ErrUpstreamUnavailable) {
+		return http.StatusServiceUnavailable
+	}
+
+	if errors.Is(err, services.ErrCollectionNotAllowed) {
+		return http.StatusForbidden
+	}
+
+	return http.StatusInternalServerError
+}
+
+// Gets the metadata of the given book, caching it. If bypass is set, the cached metadata is refreshed.
+// Returns ErrCollectionNotAllowed if the book is not in any of the collections the config allows.
+func getCachedBookMetadata(bookId string, bypass bool) (*models.InternetArchiveMetadataResponse, error) {
+	metadata, err := services.GetCacheServiceInstance().CacheResource(
+		func() (interface{}, error) {
+			return internetArchiveService.GetBookMetadata(bookId)
+		},
+		constants.InternetArchiveBookMetadataCacheResource,
+		fmt.Sprintf("book-%s", bookId),
+		bypass,
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	bookMetadata, decodeErr := services.CachedValueAs[*models.InternetArchiveMetadataResponse](metadata)
+
+	if decodeErr != nil {
+		return nil, decodeErr
+	}
+
+	// Checked on every call rather than before caching, so the allowlist applies to already cached books
+	if bookMetadata.Exists() && !services.IsInternetArchiveCollectionAllowed(bookMetadata.Metadata.Collection...) {
+		return nil, fmt.Errorf("%w: %s", services.ErrCollectionNotAllowed, bookId)
+	}
+
+	return bookMetadata, nil
+}
+
+// Checks that Internet Archive has the book with the given identifier, when the config enables verifying identifiers.
+// Returns the HTTP error to respond with if it does not, or it could not be checked.
+func checkInternetArchiveBookExists(bookId string) *models.HttpError {
+	if !config.Get().InternetArchive.VerifyIdentifiers {
+		return nil
+	}
+
+	metadata, metadataErr := getCachedBookMetadata(bookId, false)
+
+	if metadataErr != nil {
+		utils.GetCustomLogger().Errorf(
+			"Error verifying internet archive book %s: %s\n",
+			bookId,
+			metadataErr.Error(),
+		)
+		status := internetArchiveErrorStatus(metadataErr)
+		return &models.HttpError{Status: status, Description: "could not verify the internet archive book."}
+	}
+
+	if !metadata.Exists() {
+		return &models.HttpError{Status: 400, Description: "internet archive book not found."}
+	}
+
+	return nil
+}
+
+// Gets the given file of a book from its cached metadata.
+// Returns nil if the book has no such file.
+func getBookFile(bookId string, fileName string) (*models.InternetArchiveFile, error) {
+	metadata, metadataErr := getCachedBookMetadata(bookId, false)
+
+	if metadataErr != nil {
+		return nil, metadataErr
+	}
+
+	return metadata.FindFile(fileName), nil
+}
+
+// Sets the type, disposition and length headers of a book file response.
+// The length is only set when it is known, that is, when it is not negative.
+func setBookFileHeaders(res http.ResponseWriter, bookId string, bookFile *models.InternetArchiveFile, contentLength int64) {
+	contentType, extension := bookFile.GetContentType()
+
+	res.Header().Set("Content-Type", contentType)
+	res.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s%s\"", bookId, extension))
+
+	if contentLength >= 0 {
+		res.Header().Set("Content-Length", fmt.Sprintf("%d", contentLength))
+	}
 }
@@ -0,0 +1,699 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/adfer-dev/analock-api/constants"
+	"github.com/adfer-dev/analock-api/models"
+	"github.com/adfer-dev/analock-api/services"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+// Mock Internet Archive server, serving the metadata of a book with an EPUB and a PDF file.
+// File downloads support range requests.
+// The downloads of brokenBook fail, the EPUB one midway through the file and the PDF one before any byte is sent.
+// The download of restrictedBook is forbidden, answering with an HTML error page.
+// The metadata of checkedBook has the checksums of its files, the right one for the EPUB and a wrong one for the PDF.
+// Searches find 25 books, starting the results at the requested page.
+// Only collectedBook is in a collection, gutenberg.
+func newMockInternetArchiveServer(bookContent []byte) *httptest.Server {
+	bookChecksum := md5.Sum(bookContent)
+
+	return httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/advancedsearch.php":
+			rows, _ := strconv.Atoi(req.URL.Query().Get("rows"))
+			page, _ := strconv.Atoi(req.URL.Query().Get("page"))
+			res.Header().Set("Content-Type", "application/json")
+			fmt.Fprintf(res, `{"response":{"numFound":25,"start":%d,"docs":[]}}`, (page-1)*rows)
+		case "/metadata/book1":
+			res.Header().Set("Content-Type", "application/json")
+			res.Write([]byte(`{"files":[{"name":"book1.epub","format":"EPUB"},{"name":"book1.pdf","format":"Text PDF"}],"metadata":{"identifier":"book1"}}`))
+		case "/metadata/missingBook":
+			// Internet Archive answers with empty metadata for unknown identifiers
+			res.Header().Set("Content-Type", "application/json")
+			res.Write([]byte(`{}`))
+		case "/metadata/checkedBook":
+			res.Header().Set("Content-Type", "application/json")
+			fmt.Fprintf(
+				res,
+				`{"files":[{"name":"checkedBook.epub","format":"EPUB","md5":"%s"},{"name":"checkedBook.pdf","format":"Text PDF","md5":"%s"}],"metadata":{"identifier":"checkedBook"}}`,
+				hex.EncodeToString(bookChecksum[:]),
+				strings.Repeat("0", 32),
+			)
+		case "/metadata/collectedBook":
+			res.Header().Set("Content-Type", "application/json")
+			res.Write([]byte(`{"files":[{"name":"collectedBook.epub","format":"EPUB"}],"metadata":{"identifier":"collectedBook","collection":["gutenberg","americana"]}}`))
+		case "/download/book1/book1.epub", "/download/book1/book1.pdf", "/download/checkedBook/checkedBook.epub", "/download/checkedBook/checkedBook.pdf", "/download/collectedBook/collectedBook.epub":
+			http.ServeContent(res, req, "", time.Time{}, bytes.NewReader(bookContent))
+		case "/metadata/brokenBook":
+			res.Header().Set("Content-Type", "application/json")
+			res.Write([]byte(`{"files":[{"name":"brokenBook.epub","format":"EPUB"},{"name":"brokenBook.pdf","format":"Text PDF"}],"metadata":{"identifier":"brokenBook"}}`))
+		case "/download/brokenBook/brokenBook.epub", "/download/brokenBook/brokenBook.pdf":
+			res.Header().Set("Content-Length", "16384")
+			res.WriteHeader(http.StatusOK)
+			if req.URL.Path == "/download/brokenBook/brokenBook.epub" {
+				res.Write(bytes.Repeat([]byte("a"), 8192))
+			}
+			res.(http.Flusher).Flush()
+			// Closing the connection before the whole file is sent
+			conn, _, _ := res.(http.Hijacker).Hijack()
+			conn.Close()
+		case "/metadata/restrictedBook":
+			res.Header().Set("Content-Type", "application/json")
+			res.Write([]byte(`{"files":[{"name":"restrictedBook.epub","format":"EPUB"}],"metadata":{"identifier":"restrictedBook"}}`))
+		case "/download/restrictedBook/restrictedBook.epub":
+			res.Header().Set("Content-Type", "text/html")
+			res.WriteHeader(http.StatusForbidden)
+			res.Write([]byte("<html>Access restricted</html>"))
+		default:
+			res.WriteHeader(http.StatusNotFound)
+		}
+	}))
+}
+
+// Builds a router with the Internet Archive routes, setting up the env the cache needs.
+func newInternetArchiveTestRouter(t *testing.T) *mux.Router {
+	t.Setenv("API_CACHE_EXPIRATION", "1h")
+	t.Setenv("API_CACHE_EVICTION_INTERVAL", "1h")
+
+	router := mux.NewRouter()
+	InitInternetArchiveRoutes(router)
+
+	return router
+}
+
+func TestHandleBookDownloadRange(t *testing.T) {
+	bookContent := []byte("0123456789abcdefghij")
+
+	upstream := newMockInternetArchiveServer(bookContent)
+	defer upstream.Close()
+
+	originalInternetArchiveService := internetArchiveService
+	internetArchiveService = &services.InternetArchiveServiceImpl{BaseURL: upstream.URL}
+	defer func() { internetArchiveService = originalInternetArchiveService }()
+
+	router := newInternetArchiveTestRouter(t)
+
+	t.Run("ranged_request", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/internetArchive/books/book1/download?file=book1.epub", nil)
+		req.Header.Set("Range", "bytes=10-14")
+		res := httptest.NewRecorder()
+
+		router.ServeHTTP(res, req)
+
+		assert.Equal(t, http.StatusPartialContent, res.Code)
+		assert.Equal(t, "bytes 10-14/20", res.Header().Get("Content-Range"))
+		assert.Equal(t, "bytes", res.Header().Get("Accept-Ranges"))
+		assert.Equal(t, "5", res.Header().Get("Content-Length"))
+		assert.Equal(t, "abcde", res.Body.String())
+	})
+
+	t.Run("full_request", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/internetArchive/books/book1/download?file=book1.epub", nil)
+		res := httptest.NewRecorder()
+
+		router.ServeHTTP(res, req)
+
+		assert.Equal(t, http.StatusOK, res.Code)
+		assert.Empty(t, res.Header().Get("Content-Range"))
+		assert.Equal(t, "application/epub+zip", res.Header().Get("Content-Type"))
+		assert.Equal(t, "20", res.Header().Get("Content-Length"))
+		assert.Equal(t, bookContent, res.Body.Bytes())
+	})
+
+	t.Run("unsatisfiable_range", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/internetArchive/books/book1/download?file=book1.epub", nil)
+		req.Header.Set("Range", "bytes=50-60")
+		res := httptest.NewRecorder()
+
+		router.ServeHTTP(res, req)
+
+		assert.Equal(t, http.StatusRequestedRangeNotSatisfiable, res.Code)
+		assert.Equal(t, "bytes */20", res.Header().Get("Content-Range"))
+		assert.Empty(t, res.Header().Get("Content-Type"))
+		assert.Empty(t, res.Header().Get("Content-Disposition"))
+		assert.Empty(t, res.Header().Get("Content-Length"))
+		assert.Empty(t, res.Body.String())
+	})
+}
+
+func TestHandleBookDownloadContentType(t *testing.T) {
+	upstream := newMockInternetArchiveServer([]byte("book content"))
+	defer upstream.Close()
+
+	originalInternetArchiveService := internetArchiveService
+	internetArchiveService = &services.InternetArchiveServiceImpl{BaseURL: upstream.URL}
+	defer func() { internetArchiveService = originalInternetArchiveService }()
+
+	router := newInternetArchiveTestRouter(t)
+
+	tests := []struct {
+		name                string
+		reqMethod           string
+		file                string
+		expectedStatus      int
+		expectedType        string
+		expectedDisposition string
+	}{
+		{"EPUB download", http.MethodGet, "book1.epub", http.StatusOK, "application/epub+zip", `attachment; filename="book1.epub"`},
+		{"PDF download", http.MethodGet, "book1.pdf", http.StatusOK, "application/pdf", `attachment; filename="book1.pdf"`},
+		{"PDF headers", http.MethodHead, "book1.pdf", http.StatusOK, "application/pdf", `attachment; filename="book1.pdf"`},
+		{"Missing file download", http.MethodGet, "book1.mobi", http.StatusNotFound, "", ""},
+		{"Missing file headers", http.MethodHead, "book1.mobi", http.StatusNotFound, "", ""},
+	}
+
+	for _, testCase := range tests {
+		t.Run(testCase.name, func(t *testing.T) {
+			req := httptest.NewRequest(testCase.reqMethod, "/api/v1/internetArchive/books/book1/download?file="+testCase.file, nil)
+			res := httptest.NewRecorder()
+
+			router.ServeHTTP(res, req)
+
+			assert.Equal(t, testCase.expectedStatus, res.Code)
+			if testCase.expectedStatus == http.StatusOK {
+				assert.Equal(t, testCase.expectedType, res.Header().Get("Content-Type"))
+				assert.Equal(t, testCase.expectedDisposition, res.Header().Get("Content-Disposition"))
+				assert.Equal(t, "12", res.Header().Get("Content-Length"))
+			}
+		})
+	}
+}
+
+func TestHandleBookDownloadUpstreamFailure(t *testing.T) {
+	upstream := newMockInternetArchiveServer(nil)
+	defer upstream.Close()
+
+	originalInternetArchiveService := internetArchiveService
+	internetArchiveService = &services.InternetArchiveServiceImpl{BaseURL: upstream.URL}
+	defer func() { internetArchiveService = originalInternetArchiveService }()
+
+	server := httptest.NewServer(newInternetArchiveTestRouter(t))
+	defer server.Close()
+
+	t.Run("failure_before_streaming", func(t *testing.T) {
+		res, err := http.Get(server.URL + "/api/v1/internetArchive/books/brokenBook/download?file=brokenBook.pdf")
+		if !assert.NoError(t, err) {
+			return
+		}
+		defer res.Body.Close()
+
+		httpErr := models.HttpError{}
+		assert.NoError(t, json.NewDecoder(res.Body).Decode(&httpErr))
+		assert.Equal(t, http.StatusInternalServerError, res.StatusCode)
+		assert.Equal(t, "application/json", res.Header.Get("Content-Type"))
+		assert.Empty(t, res.Header.Get("Content-Disposition"))
+		assert.Equal(t, "could not download book.", httpErr.Description)
+	})
+
+	t.Run("forbidden_download", func(t *testing.T) {
+		res, err := http.Get(server.URL + "/api/v1/internetArchive/books/restrictedBook/download?file=restrictedBook.epub")
+		if !assert.NoError(t, err) {
+			return
+		}
+		defer res.Body.Close()
+
+		httpErr := models.HttpError{}
+		assert.NoError(t, json.NewDecoder(res.Body).Decode(&httpErr))
+		assert.Equal(t, http.StatusForbidden, res.StatusCode)
+		assert.Equal(t, "application/json", res.Header.Get("Content-Type"))
+		assert.Empty(t, res.Header.Get("Content-Disposition"))
+		assert.Equal(t, "could not download book.", httpErr.Description)
+	})
+
+	t.Run("failure_mid_stream", func(t *testing.T) {
+		res, err := http.Get(server.URL + "/api/v1/internetArchive/books/brokenBook/download?file=brokenBook.epub")
+		if !assert.NoError(t, err) {
+			return
+		}
+		defer res.Body.Close()
+
+		body, readErr := io.ReadAll(res.Body)
+
+		// The response is cut short instead of ending with a JSON error
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+		assert.Equal(t, "application/epub+zip", res.Header.Get("Content-Type"))
+		assert.ErrorIs(t, readErr, io.ErrUnexpectedEOF)
+		assert.Equal(t, bytes.Repeat([]byte("a"), 8192), body)
+	})
+}
+
+// Internet Archive service whose downloads are cut short without failing,
+// like a transport that does not check the length of the response body.
+type truncatingInternetArchiveService struct {
+	services.InternetArchiveServiceImpl
+	maxBytes int64
+}
+
+func (service *truncatingInternetArchiveService) DownloadBook(bookId string, fileName string, byteRange string) (*http.Response, error) {
+	response, err := service.InternetArchiveServiceImpl.DownloadBook(bookId, fileName, byteRange)
+
+	if err == nil {
+		response.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.LimitReader(response.Body, service.maxBytes), response.Body}
+	}
+
+	return response, err
+}
+
+func TestHandleBookDownloadIntegrity(t *testing.T) {
+	bookContent := []byte("0123456789abcdefghij")
+
+	upstream := newMockInternetArchiveServer(bookContent)
+	defer upstream.Close()
+
+	originalInternetArchiveService := internetArchiveService
+	internetArchiveService = &services.InternetArchiveServiceImpl{BaseURL: upstream.URL}
+	defer func() { internetArchiveService = originalInternetArchiveService }()
+
+	router := newInternetArchiveTestRouter(t)
+
+	tests := []struct {
+		name           string
+		file           string
+		byteRange      string
+		expectedStatus string
+	}{
+		{"Matching checksum", "checkedBook.epub", "", constants.ChecksumStatusVerified},
+		{"Mismatching checksum", "checkedBook.pdf", "", constants.ChecksumStatusMismatch},
+		{"Ranges are not checked", "checkedBook.epub", "bytes=0-4", ""},
+	}
+
+	for _, testCase := range tests {
+		t.Run(testCase.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/internetArchive/books/checkedBook/download?file="+testCase.file, nil)
+			if len(testCase.byteRange) > 0 {
+				req.Header.Set("Range", testCase.byteRange)
+			}
+			res := httptest.NewRecorder()
+
+			router.ServeHTTP(res, req)
+
+			result := res.Result()
+			assert.Equal(t, testCase.expectedStatus, result.Trailer.Get(constants.ChecksumStatusTrailer))
+			if len(testCase.expectedStatus) > 0 {
+				assert.Equal(t, http.StatusOK, res.Code)
+				assert.Equal(t, bookContent, res.Body.Bytes())
+				assert.NotEmpty(t, res.Header().Get(constants.ChecksumMd5Header))
+			} else {
+				assert.Empty(t, res.Header().Get(constants.ChecksumMd5Header))
+			}
+		})
+	}
+
+	t.Run("trailer_over_http", func(t *testing.T) {
+		server := httptest.NewServer(router)
+		defer server.Close()
+
+		res, err := http.Get(server.URL + "/api/v1/internetArchive/books/checkedBook/download?file=checkedBook.epub")
+		if !assert.NoError(t, err) {
+			return
+		}
+		defer res.Body.Close()
+
+		body, readErr := io.ReadAll(res.Body)
+
+		// Trailers are only read along with the end of the body, which must be chunked to have them
+		assert.NoError(t, readErr)
+		assert.Equal(t, bookContent, body)
+		assert.Equal(t, int64(-1), res.ContentLength)
+		assert.Equal(t, []string{"chunked"}, res.TransferEncoding)
+		assert.Equal(t, constants.ChecksumStatusVerified, res.Trailer.Get(constants.ChecksumStatusTrailer))
+	})
+
+	t.Run("truncated_download", func(t *testing.T) {
+		largeBookContent := bytes.Repeat([]byte("b"), 16384)
+		largeUpstream := newMockInternetArchiveServer(largeBookContent)
+		defer largeUpstream.Close()
+
+		internetArchiveService = &truncatingInternetArchiveService{services.InternetArchiveServiceImpl{BaseURL: largeUpstream.URL}, 8192}
+		server := httptest.NewServer(router)
+		defer server.Close()
+
+		res, err := http.Get(server.URL + "/api/v1/internetArchive/books/book1/download?file=book1.epub")
+		if !assert.NoError(t, err) {
+			return
+		}
+		defer res.Body.Close()
+
+		body, readErr := io.ReadAll(res.Body)
+
+		// The streamed byte count does not match the length, so the connection is closed
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+		assert.Equal(t, "16384", res.Header.Get("Content-Length"))
+		assert.ErrorIs(t, readErr, io.ErrUnexpectedEOF)
+		assert.Equal(t, largeBookContent[:8192], body)
+	})
+}
+
+func TestGetContentType(t *testing.T) {
+	tests := []struct {
+		file              models.InternetArchiveFile
+		expectedType      string
+		expectedExtension string
+	}{
+		{models.InternetArchiveFile{Name: "book.epub", Format: "EPUB"}, "application/epub+zip", ".epub"},
+		{models.InternetArchiveFile{Name: "book.pdf", Format: "Text PDF"}, "application/pdf", ".pdf"},
+		{models.InternetArchiveFile{Name: "book_djvu.txt", Format: "DjVuTXT"}, "text/plain; charset=utf-8", ".txt"},
+		{models.InternetArchiveFile{Name: "book.json", Format: "Metadata"}, "application/json", ".json"},
+		{models.InternetArchiveFile{Name: "book", Format: "Unknown"}, "application/octet-stream", ""},
+	}
+
+	for _, testCase := range tests {
+		contentType, extension := testCase.file.GetContentType()
+
+		assert.Equal(t, testCase.expectedType, contentType, testCase.file.Format)
+		assert.Equal(t, testCase.expectedExtension, extension, testCase.file.Format)
+	}
+}
+
+func TestHandleSearchBooksPage(t *testing.T) {
+	upstream := newMockInternetArchiveServer(nil)
+	defer upstream.Close()
+
+	originalInternetArchiveService := internetArchiveService
+	internetArchiveService = &services.InternetArchiveServiceImpl{BaseURL: upstream.URL}
+	defer func() { internetArchiveService = originalInternetArchiveService }()
+
+	t.Setenv("API_IA_MAX_SEARCH_PAGE", "3")
+	router := newInternetArchiveTestRouter(t)
+	searchPath := "/api/v1/internetArchive/books/search?collection=books&language=english&subject=fiction&rows=10"
+
+	tests := []struct {
+		name          string
+		query         string
+		expectedStart int
+	}{
+		{"Default page", "", 0},
+		{"First page", "&page=1", 0},
+		{"Last page", "&page=3", 20},
+	}
+
+	for _, testCase := range tests {
+		t.Run(testCase.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, searchPath+testCase.query, nil)
+			res := httptest.NewRecorder()
+
+			router.ServeHTTP(res, req)
+
+			searchResults := models.InternetArchiveSearchResponse{}
+			assert.Equal(t, http.StatusOK, res.Code)
+			assert.NoError(t, json.NewDecoder(res.Body).Decode(&searchResults))
+			assert.Equal(t, 25, searchResults.Response.NumFound)
+			assert.Equal(t, testCase.expectedStart, searchResults.Response.Start)
+		})
+	}
+
+	for _, page := range []string{"0", "-1", "4", "next"} {
+		req := httptest.NewRequest(http.MethodGet, searchPath+"&page="+page, nil)
+		res := httptest.NewRecorder()
+
+		router.ServeHTTP(res, req)
+
+		assert.Equal(t, http.StatusBadRequest, res.Code, "page=%s", page)
+	}
+}
+
+func TestHandleSearchBooksSubjects(t *testing.T) {
+	queries := []string{}
+	upstream := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		queries = append(queries, req.URL.Query().Get("q"))
+		res.Header().Set("Content-Type", "application/json")
+		res.Write([]byte(`{"response":{"numFound":0,"start":0,"docs":[]}}`))
+	}))
+	defer upstream.Close()
+
+	originalInternetArchiveService := internetArchiveService
+	internetArchiveService = &services.InternetArchiveServiceImpl{BaseURL: upstream.URL}
+	defer func() { internetArchiveService = originalInternetArchiveService }()
+
+	router := newInternetArchiveTestRouter(t)
+	searchPath := "/api/v1/internetArchive/books/search?collection=subjects&language=english&rows=10"
+
+	tests := []struct {
+		name            string
+		query           string
+		expectedQueries []string
+	}{
+		{"Single subject", "&subject=fiction", []string{`collection:"subjects" AND language:"english" AND subject:("fiction") AND mediatype:texts`}},
+		{"Multiple subjects", "&subject=poetry&subject=fiction", []string{`collection:"subjects" AND language:"english" AND subject:("fiction" OR "poetry") AND mediatype:texts`}},
+		// The same subjects in any order, or repeated, are served from the cache
+		{"Multiple subjects in another order", "&subject=fiction&subject=poetry&subject=fiction", []string{}},
+		{"Empty subjects are ignored", "&subject=&subject=history", []string{`collection:"subjects" AND language:"english" AND subject:("history") AND mediatype:texts`}},
+		// A subject holding a comma does not share the cache with the subjects it separates
+		{"Subject with a comma", "&subject=fiction,poetry", []string{`collection:"subjects" AND language:"english" AND subject:("fiction,poetry") AND mediatype:texts`}},
+	}
+
+	for _, testCase := range tests {
+		t.Run(testCase.name, func(t *testing.T) {
+			queries = []string{}
+			req := httptest.NewRequest(http.MethodGet, searchPath+testCase.query, nil)
+			res := httptest.NewRecorder()
+
+			router.ServeHTTP(res, req)
+
+			assert.Equal(t, http.StatusOK, res.Code)
+			assert.Equal(t, testCase.expectedQueries, queries)
+		})
+	}
+
+	// Test case: At least one non-empty subject is required
+	for _, query := range []string{"", "&subject="} {
+		req := httptest.NewRequest(http.MethodGet, searchPath+query, nil)
+		res := httptest.NewRecorder()
+
+		router.ServeHTTP(res, req)
+
+		assert.Equal(t, http.StatusBadRequest, res.Code, "query %q", query)
+	}
+}
+
+func TestInternetArchiveAllowedCollections(t *testing.T) {
+	upstream := newMockInternetArchiveServer([]byte("book content"))
+	defer upstream.Close()
+
+	originalInternetArchiveService := internetArchiveService
+	internetArchiveService = &services.InternetArchiveServiceImpl{BaseURL: upstream.URL}
+	defer func() { internetArchiveService = originalInternetArchiveService }()
+
+	t.Setenv("API_IA_ALLOWED_COLLECTIONS", "gutenberg,folkscanomy")
+	router := newInternetArchiveTestRouter(t)
+
+	tests := []struct {
+		name           string
+		reqMethod      string
+		reqURLPath     string
+		expectedStatus int
+	}{
+		{"Search in an allowed collection", http.MethodGet, "/api/v1/internetArchive/books/search?collection=gutenberg&language=english&subject=fiction&rows=10", http.StatusOK},
+		{"Search in a disallowed collection", http.MethodGet, "/api/v1/internetArchive/books/search?collection=books&language=english&subject=fiction&rows=10", http.StatusBadRequest},
+		{"Metadata of a book in an allowed collection", http.MethodGet, "/api/v1/internetArchive/books/collectedBook/metadata", http.StatusOK},
+		{"Metadata of a book in no allowed collection", http.MethodGet, "/api/v1/internetArchive/books/book1/metadata", http.StatusForbidden},
+		{"Files of a book in no allowed collection", http.MethodGet, "/api/v1/internetArchive/books/book1/files", http.StatusForbidden},
+		{"Related books of a book in no allowed collection", http.MethodGet, "/api/v1/internetArchive/books/book1/related", http.StatusForbidden},
+		{"Download of a book in an allowed collection", http.MethodGet, "/api/v1/internetArchive/books/collectedBook/download?file=collectedBook.epub", http.StatusOK},
+		{"Download of a book in no allowed collection", http.MethodGet, "/api/v1/internetArchive/books/book1/download?file=book1.epub", http.StatusForbidden},
+		{"Download headers of a book in no allowed collection", http.MethodHead, "/api/v1/internetArchive/books/book1/download?file=book1.epub", http.StatusForbidden},
+	}
+
+	for _, testCase := range tests {
+		t.Run(testCase.name, func(t *testing.T) {
+			req := httptest.NewRequest(testCase.reqMethod, testCase.reqURLPath, nil)
+			res := httptest.NewRecorder()
+
+			router.ServeHTTP(res, req)
+
+			assert.Equal(t, testCase.expectedStatus, res.Code)
+		})
+	}
+
+	// Test case: Every collection is allowed when the allowlist is empty
+	t.Setenv("API_IA_ALLOWED_COLLECTIONS", "")
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/internetArchive/books/book1/metadata", nil)
+	res := httptest.NewRecorder()
+
+	router.ServeHTTP(res, req)
+
+	assert.Equal(t, http.StatusOK, res.Code)
+}
+
+func TestHandleGetRelatedBooksRows(t *testing.T) {
+	router := newInternetArchiveTestRouter(t)
+
+	for _, rows := range []string{"0", "51", "many"} {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/internetArchive/books/book1/related?rows="+rows, nil)
+		res := httptest.NewRecorder()
+
+		router.ServeHTTP(res, req)
+
+		assert.Equal(t, http.StatusBadRequest, res.Code, "rows=%s", rows)
+	}
+}
+
+func TestHandleInternetArchiveUnavailable(t *testing.T) {
+	breaker := services.NewCircuitBreaker(services.CircuitBreakerConfig{FailureThreshold: 1, FailureWindow: time.Minute, Cooldown: time.Hour})
+	breaker.RecordFailure()
+
+	originalInternetArchiveService := internetArchiveService
+	internetArchiveService = &services.InternetArchiveServiceImpl{BaseURL: "http://127.0.0.1:0", CircuitBreaker: breaker}
+	defer func() { internetArchiveService = originalInternetArchiveService }()
+
+	router := newInternetArchiveTestRouter(t)
+
+	for _, reqMethod := range []string{http.MethodGet, http.MethodHead} {
+		req := httptest.NewRequest(reqMethod, "/api/v1/internetArchive/books/unavailableBook/download?file=book.epub", nil)
+		res := httptest.NewRecorder()
+
+		router.ServeHTTP(res, req)
+
+		assert.Equal(t, http.StatusServiceUnavailable, res.Code, reqMethod)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/internetArchive/books/unavailableBook/metadata", nil)
+	res := httptest.NewRecorder()
+
+	router.ServeHTTP(res, req)
+
+	assert.Equal(t, http.StatusServiceUnavailable, res.Code)
+}
+
+func TestHandleGetBookFiles(t *testing.T) {
+	upstream := newMockInternetArchiveServer([]byte("book content"))
+	defer upstream.Close()
+
+	originalInternetArchiveService := internetArchiveService
+	internetArchiveService = &services.InternetArchiveServiceImpl{BaseURL: upstream.URL}
+	defer func() { internetArchiveService = originalInternetArchiveService }()
+
+	router := newInternetArchiveTestRouter(t)
+
+	tests := []struct {
+		name          string
+		query         string
+		expectedFiles []models.InternetArchiveFile
+	}{
+		{"All files", "", []models.InternetArchiveFile{{Name: "book1.epub", Format: "EPUB"}, {Name: "book1.pdf", Format: "Text PDF"}}},
+		{"Filtered by format", "?format=epub", []models.InternetArchiveFile{{Name: "book1.epub", Format: "EPUB"}}},
+		{"No file with format", "?format=mobi", []models.InternetArchiveFile{}},
+	}
+
+	for _, testCase := range tests {
+		t.Run(testCase.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/internetArchive/books/book1/files"+testCase.query, nil)
+			res := httptest.NewRecorder()
+
+			router.ServeHTTP(res, req)
+
+			files := []models.InternetArchiveFile{}
+			assert.Equal(t, http.StatusOK, res.Code)
+			assert.NoError(t, json.NewDecoder(res.Body).Decode(&files))
+			assert.Equal(t, testCase.expectedFiles, files)
+		})
+	}
+}
+
+func TestHandleGetBookDownloadUrl(t *testing.T) {
+	upstream := newMockInternetArchiveServer([]byte("book content"))
+	defer upstream.Close()
+
+	originalInternetArchiveService := internetArchiveService
+	internetArchiveService = &services.InternetArchiveServiceImpl{BaseURL: upstream.URL}
+	defer func() { internetArchiveService = originalInternetArchiveService }()
+
+	// Test case: The endpoint is not available unless enabled
+	disabledRouter := newInternetArchiveTestRouter(t)
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/internetArchive/books/book1/download-url?file=book1.epub", nil)
+	res := httptest.NewRecorder()
+
+	disabledRouter.ServeHTTP(res, req)
+
+	assert.Equal(t, http.StatusNotFound, res.Code)
+
+	t.Setenv("API_IA_DIRECT_DOWNLOAD_ENABLED", "true")
+	router := newInternetArchiveTestRouter(t)
+
+	tests := []struct {
+		name           string
+		path           string
+		expectedStatus int
+		expectedUrl    string
+	}{
+		{"File in the metadata", "/api/v1/internetArchive/books/book1/download-url?file=book1.pdf", http.StatusOK, upstream.URL + "/download/book1/book1.pdf"},
+		{"File not in the metadata", "/api/v1/internetArchive/books/book1/download-url?file=book1.mobi", http.StatusNotFound, ""},
+		{"Unknown book", "/api/v1/internetArchive/books/missingBook/download-url?file=missingBook.epub", http.StatusNotFound, ""},
+		{"No file", "/api/v1/internetArchive/books/book1/download-url", http.StatusBadRequest, ""},
+	}
+
+	for _, testCase := range tests {
+		t.Run(testCase.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, testCase.path, nil)
+			res := httptest.NewRecorder()
+
+			router.ServeHTTP(res, req)
+
+			assert.Equal(t, testCase.expectedStatus, res.Code)
+
+			if testCase.expectedStatus == http.StatusOK {
+				var response BookDownloadUrlResponse
+				assert.NoError(t, json.NewDecoder(res.Body).Decode(&response))
+				assert.Equal(t, testCase.expectedUrl, response.Url)
+				assert.Equal(t, constants.InternetArchiveDirectDownloadNote, response.Note)
+			}
+		})
+	}
+}
+
+func TestWriteStaleSearchResults(t *testing.T) {
+	cachedResults := &models.InternetArchiveSearchResponse{
+		Response: models.InternetArchiveBookResponse{NumFound: 1, Docs: []models.InternetArchiveBook{{Identifier: "book1"}}},
+	}
+	res := httptest.NewRecorder()
+
+	assert.NoError(t, writeStaleSearchResults(res, cachedResults))
+
+	searchResults := models.InternetArchiveSearchResponse{}
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, constants.CacheStatusStale, res.Header().Get(constants.CacheStatusHeader))
+	assert.NoError(t, json.NewDecoder(res.Body).Decode(&searchResults))
+	assert.Equal(t, constants.WarningStaleSearchResults, searchResults.Warning)
+	assert.Equal(t, cachedResults.Response, searchResults.Response)
+	assert.Empty(t, cachedResults.Warning)
+}
+
+func TestCheckInternetArchiveBookExists(t *testing.T) {
+	upstream := newMockInternetArchiveServer([]byte("book content"))
+	defer upstream.Close()
+
+	originalInternetArchiveService := internetArchiveService
+	internetArchiveService = &services.InternetArchiveServiceImpl{BaseURL: upstream.URL}
+	defer func() { internetArchiveService = originalInternetArchiveService }()
+
+	t.Setenv("API_CACHE_EXPIRATION", "1h")
+	t.Setenv("API_CACHE_EVICTION_INTERVAL", "1h")
+
+	// Test case: Identifiers are not verified by default
+	assert.Nil(t, checkInternetArchiveBookExists("missingBook"))
+
+	t.Setenv("API_IA_VERIFY_IDENTIFIERS", "true")
+
+	assert.Nil(t, checkInternetArchiveBookExists("book1"))
+
+	httpErr := checkInternetArchiveBookExists("missingBook")
+
+	assert.NotNil(t, httpErr)
+	assert.Equal(t, http.StatusBadRequest, httpErr.Status)
+}
@@ -0,0 +1,40 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/adfer-dev/analock-api/config"
+	"github.com/adfer-dev/analock-api/constants"
+	"github.com/adfer-dev/analock-api/docs"
+	"github.com/adfer-dev/analock-api/utils"
+	"github.com/gorilla/mux"
+)
+
+type ServiceDescriptorResponse struct {
+	Name    string `json:"name" example:"Analock API"`
+	Version string `json:"version" example:"1.0"`
+	// Paths of the public entrypoints of the API, by name
+	Links map[string]string `json:"links"`
+}
+
+func InitRootRoutes(router *mux.Router) {
+	router.HandleFunc("/", utils.ParseToHandlerFunc(handleGetServiceDescriptor)).Methods("GET")
+	router.HandleFunc("/api/v1", utils.ParseToHandlerFunc(handleGetServiceDescriptor)).Methods("GET")
+}
+
+// @Summary		Get service descriptor
+// @Description	Get the name and version of the API and links to its public entrypoints.
+// @Description	The swagger link is only included when Swagger UI is enabled.
+// @Tags			root
+// @Produce		json
+// @Success		200	{object}	ServiceDescriptorResponse
+// @Router			/ [get]
+func handleGetServiceDescriptor(res http.ResponseWriter, req *http.Request) error {
+	links := map[string]string{"time": constants.ApiV1UrlRoot + "/time"}
+
+	if config.Get().Swagger.Enabled {
+		links["swagger"] = constants.ApiV1UrlRoot + "/swagger/index.html"
+	}
+
+	return utils.WriteJSON(res, 200, ServiceDescriptorResponse{Name: docs.SwaggerInfo.Title, Version: docs.SwaggerInfo.Version, Links: links})
+}
@@ -0,0 +1,48 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHandleGetServiceDescriptor(t *testing.T) {
+	router := mux.NewRouter()
+	InitRootRoutes(router)
+
+	for _, path := range []string{"/", "/api/v1"} {
+		t.Run(path, func(t *testing.T) {
+			t.Setenv("API_SWAGGER_ENABLED", "true")
+			req := httptest.NewRequest(http.MethodGet, path, nil)
+			res := httptest.NewRecorder()
+
+			router.ServeHTTP(res, req)
+
+			descriptor := ServiceDescriptorResponse{}
+			assert.Equal(t, http.StatusOK, res.Code)
+			assert.NoError(t, json.NewDecoder(res.Body).Decode(&descriptor))
+			assert.Equal(t, "Analock API", descriptor.Name)
+			assert.NotEmpty(t, descriptor.Version)
+			assert.Equal(t, map[string]string{
+				"time":    "/api/v1/time",
+				"swagger": "/api/v1/swagger/index.html",
+			}, descriptor.Links)
+		})
+	}
+
+	// Test case: The swagger link is left out when Swagger UI is disabled
+	t.Setenv("API_SWAGGER_ENABLED", "false")
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	res := httptest.NewRecorder()
+
+	router.ServeHTTP(res, req)
+
+	descriptor := ServiceDescriptorResponse{}
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.NoError(t, json.NewDecoder(res.Body).Decode(&descriptor))
+	assert.NotContains(t, descriptor.Links, "swagger")
+}
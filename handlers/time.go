@@ -0,0 +1,31 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/adfer-dev/analock-api/utils"
+	"github.com/gorilla/mux"
+)
+
+type ServerTimeResponse struct {
+	// Current server time as a Unix timestamp in seconds, like the registration dates
+	Now      int64  `json:"now" example:"1704067200"`
+	Timezone string `json:"tz" example:"UTC"`
+}
+
+func InitTimeRoutes(router *mux.Router) {
+	router.HandleFunc("/api/v1/time", utils.ParseToHandlerFunc(handleGetServerTime)).Methods("GET")
+}
+
+// @Summary		Get server time
+// @Description	Get the current server time, so clients can correct their clock drift when computing dates.
+// @Tags			time
+// @Produce		json
+// @Success		200	{object}	ServerTimeResponse
+// @Router			/time [get]
+func handleGetServerTime(res http.ResponseWriter, req *http.Request) error {
+	now := time.Now().UTC()
+
+	return utils.WriteJSON(res, 200, ServerTimeResponse{Now: now.Unix(), Timezone: now.Location().String()})
+}
@@ -0,0 +1,30 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHandleGetServerTime(t *testing.T) {
+	router := mux.NewRouter()
+	InitTimeRoutes(router)
+
+	before := time.Now().Unix()
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/time", nil)
+	res := httptest.NewRecorder()
+
+	router.ServeHTTP(res, req)
+
+	serverTime := ServerTimeResponse{}
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.NoError(t, json.NewDecoder(res.Body).Decode(&serverTime))
+	assert.Equal(t, "UTC", serverTime.Timezone)
+	assert.GreaterOrEqual(t, serverTime.Now, before)
+	assert.LessOrEqual(t, serverTime.Now, time.Now().Unix())
+}
@@ -4,7 +4,9 @@ import (
 	"net/http"
 	"strconv"
 
+	"github.com/adfer-dev/analock-api/models"
 	"github.com/adfer-dev/analock-api/services"
+	"github.com/adfer-dev/analock-api/storage"
 	"github.com/adfer-dev/analock-api/utils"
 	"github.com/gorilla/mux"
 )
@@ -14,7 +16,7 @@ func InitUserRoutes(router *mux.Router) {
 	router.HandleFunc("/api/v1/users/{email}", utils.ParseToHandlerFunc(handleGetUserByEmail)).Methods("GET")
 }
 
-var userService services.UserService = &services.UserServiceImpl{}
+var userService services.UserService = services.NewUserServiceImpl(&storage.UserStorage{})
 
 // @Summary		Get user by ID
 // @Description	Get user information by their ID
@@ -61,3 +63,13 @@ func handleGetUserByEmail(res http.ResponseWriter, req *http.Request) error {
 
 	return utils.WriteJSON(res, 200, user)
 }
+
+// Checks that the user whose resources are listed exists, so an unknown user gets a 404 instead of an empty list.
+// Returns the error to respond with, or nil if the user exists.
+func checkListedUserExists(userId uint) *models.HttpError {
+	if _, err := userService.GetUserById(userId); err != nil {
+		return utils.TranslateDbErrorToHttpError(err)
+	}
+
+	return nil
+}
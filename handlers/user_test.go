@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"github.com/adfer-dev/analock-api/models"
+	"github.com/adfer-dev/analock-api/services"
+	"github.com/adfer-dev/analock-api/storage/memory"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+// Mock user service in which only the users with the given ids exist.
+type existingUsersService struct {
+	services.UserService
+	userIds  []uint
+	adminIds []uint
+}
+
+func (existingUsersService *existingUsersService) GetUserById(id uint) (*models.User, error) {
+	if slices.Contains(existingUsersService.adminIds, id) {
+		return &models.User{Id: id, Role: models.Admin}, nil
+	}
+
+	if !slices.Contains(existingUsersService.userIds, id) {
+		return nil, &models.DbNotFoundError{DbItem: &models.User{}}
+	}
+
+	return &models.User{Id: id}, nil
+}
+
+// Replaces the user service with one in which only the users with the given ids exist, for the duration of the test.
+func useExistingUsers(t *testing.T, userIds ...uint) {
+	originalUserService := userService
+	userService = &existingUsersService{userIds: userIds}
+	t.Cleanup(func() { userService = originalUserService })
+}
+
+// Replaces the user service with one in which the users with the given ids exist and are admins, for the duration of the test.
+func useExistingAdmins(t *testing.T, adminIds ...uint) {
+	originalUserService := userService
+	userService = &existingUsersService{adminIds: adminIds}
+	t.Cleanup(func() { userService = originalUserService })
+}
+
+func TestListEndpointsUnknownUser(t *testing.T) {
+	t.Setenv("API_CACHE_EXPIRATION", "1h")
+	t.Setenv("API_CACHE_EVICTION_INTERVAL", "1h")
+	useExistingUsers(t, 4323)
+
+	database := memory.NewDatabase()
+	activityRegistrationStorage := memory.NewActivityRegistrationStorage(database)
+
+	originalDiaryEntryService := diaryEntryService
+	originalBookRegistrationService := bookRegistrationService
+	originalGameRegistrationService := gameRegistrationService
+	originalActivityFeedService := activityFeedService
+	diaryEntryService = services.NewDefaultDiaryEntryService(memory.NewDiaryEntryStorage(database), activityRegistrationStorage, memory.NewUserStorage(database))
+	bookRegistrationService = services.NewBookActivityRegistrationServiceImpl(memory.NewBookActivityRegistrationStorage(database), activityRegistrationStorage)
+	gameRegistrationService = services.NewGameActivityRegistrationServiceImpl(memory.NewGameActivityRegistrationStorage(database), activityRegistrationStorage)
+	activityFeedService = services.NewActivityFeedServiceImpl(activityRegistrationStorage)
+	defer func() {
+		diaryEntryService = originalDiaryEntryService
+		bookRegistrationService = originalBookRegistrationService
+		gameRegistrationService = originalGameRegistrationService
+		activityFeedService = originalActivityFeedService
+	}()
+
+	router := mux.NewRouter()
+	InitDiaryEntryRoutes(router)
+	InitActivityRegistrationRoutes(router)
+
+	paths := []string{
+		"/api/v1/diaryEntries/user/%d",
+		"/api/v1/diaryEntries/user/%d?start_date=0&end_date=1000",
+		"/api/v1/diaryEntries/user/%d/calendar?start_date=0&end_date=1000",
+		"/api/v1/activityRegistrations/books/user/%d",
+		"/api/v1/activityRegistrations/games/user/%d",
+		"/api/v1/activityRegistrations/user/%d",
+	}
+
+	for _, path := range paths {
+		t.Run(path, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, fmt.Sprintf(path, 4323), nil)
+			res := httptest.NewRecorder()
+			router.ServeHTTP(res, req)
+
+			assert.Equal(t, http.StatusOK, res.Code, "existing user without items")
+
+			req = httptest.NewRequest(http.MethodGet, fmt.Sprintf(path, 4324), nil)
+			res = httptest.NewRecorder()
+			router.ServeHTTP(res, req)
+
+			assert.Equal(t, http.StatusNotFound, res.Code, "unknown user")
+		})
+	}
+}
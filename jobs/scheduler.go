@@ -0,0 +1,170 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/adfer-dev/analock-api/config"
+	"github.com/adfer-dev/analock-api/utils"
+)
+
+var ErrJobNotFound = errors.New("job not found")
+var ErrJobAlreadyRegistered = errors.New("a job with that name is already registered")
+var ErrSchedulerStarted = errors.New("jobs cannot be registered once the scheduler has started")
+
+// Job is a task the scheduler runs periodically.
+type Job struct {
+	Name     string
+	Interval time.Duration
+	// The context is cancelled when the scheduler stops.
+	Run func(ctx context.Context) error
+}
+
+type scheduledJob struct {
+	job Job
+	// Held while the job runs, so scheduled and manual runs never overlap.
+	runLock sync.Mutex
+}
+
+// Scheduler runs the registered jobs periodically until it is stopped.
+// Each run is delayed by a random jitter, so jobs with the same interval do not all run at once.
+type Scheduler struct {
+	lock      sync.Mutex
+	jobs      map[string]*scheduledJob
+	maxJitter time.Duration
+	started   bool
+	stopped   bool
+	ctx       context.Context
+	cancel    context.CancelFunc
+	waitGroup sync.WaitGroup
+}
+
+// Creates a scheduler whose runs are delayed by a random jitter up to the given one.
+func NewScheduler(maxJitter time.Duration) *Scheduler {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	return &Scheduler{jobs: make(map[string]*scheduledJob), maxJitter: maxJitter, ctx: ctx, cancel: cancel}
+}
+
+var schedulerInstance *Scheduler
+var schedulerInstanceOnce sync.Once
+
+// Gets the scheduler shared by the whole API, with the jitter in the config.
+func GetSchedulerInstance() *Scheduler {
+	schedulerInstanceOnce.Do(func() {
+		schedulerInstance = NewScheduler(config.Get().Jobs.MaxJitter)
+	})
+
+	return schedulerInstance
+}
+
+// Registers the given job. Jobs must be registered before the scheduler starts.
+func (scheduler *Scheduler) Register(job Job) error {
+	if job.Interval <= 0 {
+		return fmt.Errorf("job %s interval must be positive, got %s", job.Name, job.Interval)
+	}
+
+	scheduler.lock.Lock()
+	defer scheduler.lock.Unlock()
+
+	if scheduler.started {
+		return ErrSchedulerStarted
+	}
+
+	if _, exists := scheduler.jobs[job.Name]; exists {
+		return ErrJobAlreadyRegistered
+	}
+
+	scheduler.jobs[job.Name] = &scheduledJob{job: job}
+
+	return nil
+}
+
+// Starts running the registered jobs periodically. Starting an already started scheduler does nothing.
+func (scheduler *Scheduler) Start() {
+	scheduler.lock.Lock()
+	defer scheduler.lock.Unlock()
+
+	if scheduler.started {
+		return
+	}
+
+	scheduler.started = true
+
+	for _, job := range scheduler.jobs {
+		scheduler.waitGroup.Add(1)
+		go scheduler.schedule(job)
+	}
+}
+
+// Stops running the jobs, cancelling the context of the running ones and waiting for them to return.
+func (scheduler *Scheduler) Stop() {
+	scheduler.lock.Lock()
+	scheduler.stopped = true
+	scheduler.lock.Unlock()
+
+	scheduler.cancel()
+	scheduler.waitGroup.Wait()
+}
+
+// Runs the job with the given name now, waiting for it to return.
+// If a run of the job is already in progress, it waits for that run to finish first.
+// Returns ErrJobNotFound if no job with that name is registered.
+func (scheduler *Scheduler) Trigger(name string) error {
+	scheduler.lock.Lock()
+	job, exists := scheduler.jobs[name]
+	stopped := scheduler.stopped
+	scheduler.lock.Unlock()
+
+	if !exists {
+		return ErrJobNotFound
+	}
+
+	if stopped {
+		return context.Canceled
+	}
+
+	utils.GetCustomLogger().Infof("Job %s triggered manually\n", name)
+
+	return scheduler.run(job)
+}
+
+// Runs the given job after each interval plus a random jitter, until the scheduler stops.
+func (scheduler *Scheduler) schedule(job *scheduledJob) {
+	defer scheduler.waitGroup.Done()
+
+	for {
+		timer := time.NewTimer(job.job.Interval + scheduler.jitter())
+
+		select {
+		case <-timer.C:
+			if runErr := scheduler.run(job); runErr != nil {
+				utils.GetCustomLogger().Errorf("Job %s failed: %s\n", job.job.Name, runErr.Error())
+			}
+		case <-scheduler.ctx.Done():
+			timer.Stop()
+			return
+		}
+	}
+}
+
+// Runs the given job once, after any run of it in progress.
+func (scheduler *Scheduler) run(job *scheduledJob) error {
+	job.runLock.Lock()
+	defer job.runLock.Unlock()
+
+	return job.job.Run(scheduler.ctx)
+}
+
+// Gets a random delay up to the max jitter.
+func (scheduler *Scheduler) jitter() time.Duration {
+	if scheduler.maxJitter <= 0 {
+		return 0
+	}
+
+	return time.Duration(rand.Int63n(int64(scheduler.maxJitter)))
+}
@@ -0,0 +1,99 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSchedulerRunsAndStopsJob(t *testing.T) {
+	t.Parallel()
+	scheduler := NewScheduler(0)
+	var runs atomic.Int32
+	cancelled := make(chan struct{})
+
+	assert.NoError(t, scheduler.Register(Job{
+		Name:     "counter",
+		Interval: 10 * time.Millisecond,
+		Run: func(ctx context.Context) error {
+			if runs.Add(1) == 3 {
+				<-ctx.Done()
+				close(cancelled)
+			}
+			return nil
+		},
+	}))
+
+	scheduler.Start()
+	assert.Eventually(t, func() bool { return runs.Load() >= 3 }, time.Second, 5*time.Millisecond)
+	scheduler.Stop()
+
+	// Test case: Stopping cancels the running job and waits for it
+	select {
+	case <-cancelled:
+	default:
+		t.Fatal("Stop returned before the running job was cancelled")
+	}
+
+	// Test case: The job does not run after the scheduler stops
+	runsAfterStop := runs.Load()
+	time.Sleep(30 * time.Millisecond)
+	assert.Equal(t, runsAfterStop, runs.Load())
+}
+
+func TestSchedulerTrigger(t *testing.T) {
+	t.Parallel()
+	scheduler := NewScheduler(0)
+	runErr := errors.New("job failed")
+	runs := 0
+
+	assert.NoError(t, scheduler.Register(Job{
+		Name:     "manual",
+		Interval: time.Hour,
+		Run: func(ctx context.Context) error {
+			runs++
+			return runErr
+		},
+	}))
+
+	assert.ErrorIs(t, scheduler.Trigger("manual"), runErr)
+	assert.Equal(t, 1, runs)
+	assert.ErrorIs(t, scheduler.Trigger("unknown"), ErrJobNotFound)
+
+	scheduler.Stop()
+
+	assert.ErrorIs(t, scheduler.Trigger("manual"), context.Canceled)
+	assert.Equal(t, 1, runs)
+}
+
+func TestSchedulerRegister(t *testing.T) {
+	t.Parallel()
+	scheduler := NewScheduler(0)
+	job := Job{Name: "job", Interval: time.Hour, Run: func(ctx context.Context) error { return nil }}
+
+	assert.NoError(t, scheduler.Register(job))
+	assert.ErrorIs(t, scheduler.Register(job), ErrJobAlreadyRegistered)
+	assert.Error(t, scheduler.Register(Job{Name: "no interval", Run: job.Run}))
+
+	scheduler.Start()
+	defer scheduler.Stop()
+
+	assert.ErrorIs(t, scheduler.Register(Job{Name: "late", Interval: time.Hour, Run: job.Run}), ErrSchedulerStarted)
+}
+
+func TestSchedulerJitter(t *testing.T) {
+	t.Parallel()
+	scheduler := NewScheduler(time.Second)
+
+	for i := 0; i < 100; i++ {
+		jitter := scheduler.jitter()
+		assert.GreaterOrEqual(t, jitter, time.Duration(0))
+		assert.Less(t, jitter, time.Second)
+	}
+
+	assert.Zero(t, NewScheduler(0).jitter())
+}
@@ -5,6 +5,7 @@ import (
 	"log"
 
 	"github.com/adfer-dev/analock-api/api"
+	"github.com/adfer-dev/analock-api/config"
 	"github.com/adfer-dev/analock-api/utils"
 	"github.com/joho/godotenv"
 )
@@ -36,8 +37,21 @@ func main() {
 		log.Fatal("No env file is present")
 	}
 
-	server := api.APIServer{Port: 3000}
+	apiConfig, configErr := config.Load()
+
+	if configErr != nil {
+		log.Fatal(configErr.Error())
+	}
+
+	config.Set(apiConfig)
+	server := api.APIServer{Port: 3000, Config: apiConfig}
 
 	utils.GetCustomLogger().Info(fmt.Sprintf("Server listening at port %d...\n", server.Port))
-	utils.GetCustomLogger().Error(server.Run().Error())
+
+	if runErr := server.Run(); runErr != nil {
+		utils.GetCustomLogger().Error(runErr.Error())
+		return
+	}
+
+	utils.GetCustomLogger().Info("Server stopped")
 }
@@ -0,0 +1,27 @@
+package models
+
+type ActivityFeedItemType string
+
+const (
+	BookActivityFeedItem ActivityFeedItemType = "book"
+	GameActivityFeedItem ActivityFeedItemType = "game"
+)
+
+// ActivityFeedItem is a book or game activity registration, as listed in the activity feed of a user.
+type ActivityFeedItem struct {
+	Type                      ActivityFeedItemType `json:"type"`
+	Id                        uint                 `json:"id"`
+	Registration              ActivityRegistration `json:"registration"`
+	InternetArchiveIdentifier string               `json:"internetArchiveId,omitempty"`
+	GameName                  string               `json:"gameName,omitempty"`
+}
+
+// ActivityFeedFilter holds the criteria the activity feed of a user is listed by.
+// An empty type lists both book and game registrations.
+type ActivityFeedFilter struct {
+	UserId     uint
+	Type       ActivityFeedItemType
+	Descending bool
+	Limit      int
+	Offset     int
+}
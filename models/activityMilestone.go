@@ -0,0 +1,14 @@
+package models
+
+const StreakMilestoneEvent = "streak_milestone"
+
+// ActivityMilestone is the payload posted to the milestone webhook when a user reaches an activity milestone.
+type ActivityMilestone struct {
+	Event  string `json:"event"`
+	UserId uint   `json:"userId"`
+	// Consecutive days with activity, up to the day of the registration that reached the milestone.
+	// Days are counted in the timezone the registration was created with, or UTC if none was given.
+	StreakDays uint `json:"streakDays"`
+	// Start of the day the milestone was reached, in that timezone, in Unix seconds.
+	ReachedAt int64 `json:"reachedAt"`
+}
@@ -1,7 +1,8 @@
 package models
 
 type ActivityRegistration struct {
-	Id               uint  `json:"id"`
-	RegistrationDate int64 `json:"registrationDate"`
-	UserRefer        uint  `json:"userId"`
+	Id               uint   `json:"id"`
+	RegistrationDate int64  `json:"registrationDate"`
+	UserRefer        uint   `json:"userId"`
+	Platform         string `json:"platform,omitempty"`
 }
@@ -0,0 +1,127 @@
+package models
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ClientVersion is a semantic version of a client app, such as 1.4.2 or 2.0.0-beta.1.
+type ClientVersion struct {
+	Major      uint64
+	Minor      uint64
+	Patch      uint64
+	PreRelease []string
+}
+
+// Parses a semantic version, with an optional v prefix. Build metadata is ignored.
+func ParseClientVersion(value string) (*ClientVersion, error) {
+	version, _, _ := strings.Cut(strings.TrimPrefix(strings.TrimSpace(value), "v"), "+")
+	core, preRelease, hasPreRelease := strings.Cut(version, "-")
+	parts := strings.Split(core, ".")
+
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("%q is not a semantic version such as 1.4.2", value)
+	}
+
+	numbers := make([]uint64, len(parts))
+
+	for i, part := range parts {
+		number, parseErr := parseVersionNumber(part)
+
+		if parseErr != nil {
+			return nil, fmt.Errorf("%q is not a semantic version such as 1.4.2", value)
+		}
+
+		numbers[i] = number
+	}
+
+	clientVersion := &ClientVersion{Major: numbers[0], Minor: numbers[1], Patch: numbers[2]}
+
+	if hasPreRelease {
+		clientVersion.PreRelease = strings.Split(preRelease, ".")
+
+		for _, identifier := range clientVersion.PreRelease {
+			if len(identifier) == 0 {
+				return nil, fmt.Errorf("%q has an empty pre-release identifier", value)
+			}
+		}
+	}
+
+	return clientVersion, nil
+}
+
+// Compares the version with the given one following semantic versioning precedence.
+// Returns a negative number if it is older, zero if both are equal and a positive number if it is newer.
+func (version *ClientVersion) Compare(other *ClientVersion) int {
+	if version.Major != other.Major {
+		return compareUint(version.Major, other.Major)
+	}
+
+	if version.Minor != other.Minor {
+		return compareUint(version.Minor, other.Minor)
+	}
+
+	if version.Patch != other.Patch {
+		return compareUint(version.Patch, other.Patch)
+	}
+
+	// A pre-release is older than the release it precedes
+	if len(version.PreRelease) == 0 || len(other.PreRelease) == 0 {
+		return len(other.PreRelease) - len(version.PreRelease)
+	}
+
+	for i := 0; i < len(version.PreRelease) && i < len(other.PreRelease); i++ {
+		if comparison := comparePreReleaseIdentifiers(version.PreRelease[i], other.PreRelease[i]); comparison != 0 {
+			return comparison
+		}
+	}
+
+	return len(version.PreRelease) - len(other.PreRelease)
+}
+
+func (version *ClientVersion) String() string {
+	core := fmt.Sprintf("%d.%d.%d", version.Major, version.Minor, version.Patch)
+
+	if len(version.PreRelease) == 0 {
+		return core
+	}
+
+	return core + "-" + strings.Join(version.PreRelease, ".")
+}
+
+// Parses a version number, which must not have leading zeros.
+func parseVersionNumber(value string) (uint64, error) {
+	if len(value) > 1 && value[0] == '0' {
+		return 0, fmt.Errorf("%q has leading zeros", value)
+	}
+
+	return strconv.ParseUint(value, 10, 64)
+}
+
+// Numeric identifiers are compared as numbers and are older than alphanumeric ones, which are compared as text.
+func comparePreReleaseIdentifiers(a string, b string) int {
+	aNumber, aErr := strconv.ParseUint(a, 10, 64)
+	bNumber, bErr := strconv.ParseUint(b, 10, 64)
+
+	switch {
+	case aErr == nil && bErr == nil:
+		return compareUint(aNumber, bNumber)
+	case aErr == nil:
+		return -1
+	case bErr == nil:
+		return 1
+	default:
+		return strings.Compare(a, b)
+	}
+}
+
+func compareUint(a uint64, b uint64) int {
+	if a < b {
+		return -1
+	} else if a > b {
+		return 1
+	}
+
+	return 0
+}
@@ -0,0 +1,60 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseClientVersion(t *testing.T) {
+	tests := []struct {
+		value           string
+		expectedVersion *ClientVersion
+		expectedErr     bool
+	}{
+		{"1.4.2", &ClientVersion{Major: 1, Minor: 4, Patch: 2}, false},
+		{"v2.0.0", &ClientVersion{Major: 2}, false},
+		{"2.0.0-beta.1+build.7", &ClientVersion{Major: 2, PreRelease: []string{"beta", "1"}}, false},
+		{"1.4", nil, true},
+		{"1.04.2", nil, true},
+		{"1.4.x", nil, true},
+		{"1.4.2-", nil, true},
+		{"", nil, true},
+	}
+
+	for _, testCase := range tests {
+		t.Run(testCase.value, func(t *testing.T) {
+			version, err := ParseClientVersion(testCase.value)
+
+			if testCase.expectedErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, testCase.expectedVersion, version)
+			}
+		})
+	}
+}
+
+func TestClientVersionCompare(t *testing.T) {
+	// Sorted from oldest to newest
+	versions := []string{"1.0.0-alpha", "1.0.0-alpha.1", "1.0.0-alpha.beta", "1.0.0-beta.2", "1.0.0-beta.11", "1.0.0", "1.0.1", "1.2.0", "1.10.0", "2.0.0"}
+
+	for i, value := range versions {
+		version, _ := ParseClientVersion(value)
+
+		for j, otherValue := range versions {
+			otherVersion, _ := ParseClientVersion(otherValue)
+			comparison := version.Compare(otherVersion)
+
+			switch {
+			case i < j:
+				assert.Negative(t, comparison, "%s should be older than %s", value, otherValue)
+			case i > j:
+				assert.Positive(t, comparison, "%s should be newer than %s", value, otherValue)
+			default:
+				assert.Zero(t, comparison, "%s should equal itself", value)
+			}
+		}
+	}
+}
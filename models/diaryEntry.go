@@ -5,4 +5,6 @@ type DiaryEntry struct {
 	Title        string               `json:"title"`
 	Content      string               `json:"content"`
 	Registration ActivityRegistration `json:"registration"`
+	// Time of the last change to the entry, in Unix seconds. Zero for entries not changed since it is tracked.
+	UpdatedAt int64 `json:"updatedAt"`
 }
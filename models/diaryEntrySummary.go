@@ -0,0 +1,8 @@
+package models
+
+type DiaryEntrySummary struct {
+	Id               uint   `json:"id"`
+	Title            string `json:"title"`
+	ContentPreview   string `json:"contentPreview"`
+	RegistrationDate int64  `json:"registrationDate"`
+}
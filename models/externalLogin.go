@@ -4,8 +4,32 @@ type LoginProvider int
 
 const (
 	Google LoginProvider = iota + 1
+	Apple
 )
 
+// Names of the login providers, as received and returned by the API.
+var loginProviderNames = map[LoginProvider]string{
+	Google: "google",
+	Apple:  "apple",
+}
+
+// Returns the name of the login provider, or an empty string if it is unknown.
+func (provider LoginProvider) String() string {
+	return loginProviderNames[provider]
+}
+
+// Parses the login provider with the given name.
+// Returns false if no provider has that name.
+func ParseLoginProvider(name string) (LoginProvider, bool) {
+	for provider, providerName := range loginProviderNames {
+		if providerName == name {
+			return provider, true
+		}
+	}
+
+	return 0, false
+}
+
 type ExternalLogin struct {
 	Id          uint          `json:"id"`
 	Provider    LoginProvider `json:"provider"`
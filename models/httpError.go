@@ -1,6 +1,14 @@
 package models
 
 type HttpError struct {
-	Status      int    `json:"status"`
-	Description string `json:"description"`
+	Status      int    `json:"status" example:"400"`
+	Description string `json:"description" example:"FieldTitle must be provided."`
+}
+
+// Error returned to clients older than the minimum version the API supports.
+type UpgradeRequiredError struct {
+	Status         int    `json:"status" example:"426"`
+	Description    string `json:"description" example:"this version of the app is no longer supported, please upgrade it"`
+	MinimumVersion string `json:"minimumVersion" example:"1.4.0"`
+	UpgradeUrl     string `json:"upgradeUrl,omitempty"`
 }
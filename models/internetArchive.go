@@ -1,7 +1,18 @@
 package models
 
+import (
+	"bytes"
+	"encoding/json"
+	"mime"
+	"path"
+	"strconv"
+	"strings"
+)
+
 type InternetArchiveSearchResponse struct {
 	Response InternetArchiveBookResponse `json:"response"`
+	// Set when the results are served stale, because the live search failed.
+	Warning string `json:"warning,omitempty"`
 }
 
 type InternetArchiveBookResponse struct {
@@ -11,9 +22,33 @@ type InternetArchiveBookResponse struct {
 }
 
 type InternetArchiveBook struct {
-	Identifier string `json:"identifier"`
-	Title      string `json:"title"`
-	Creator    string `json:"creator"`
+	Identifier string              `json:"identifier"`
+	Title      string              `json:"title"`
+	Creator    string              `json:"creator,omitempty"`
+	Year       InternetArchiveYear `json:"year,omitempty"`
+	Downloads  int                 `json:"downloads,omitempty"`
+}
+
+// Year an item was published in. Internet Archive gives it either as a number or as a string,
+// which is not always a year, so anything that is not a year is read as unknown (zero).
+type InternetArchiveYear int
+
+func (year *InternetArchiveYear) UnmarshalJSON(data []byte) error {
+	var number int
+
+	if err := json.Unmarshal(data, &number); err == nil {
+		*year = InternetArchiveYear(number)
+		return nil
+	}
+
+	var text string
+
+	if err := json.Unmarshal(data, &text); err == nil {
+		number, _ = strconv.Atoi(strings.TrimSpace(text))
+	}
+
+	*year = InternetArchiveYear(number)
+	return nil
 }
 
 type InternetArchiveMetadataResponse struct {
@@ -24,25 +59,132 @@ type InternetArchiveMetadataResponse struct {
 type InternetArchiveFile struct {
 	Name   string `json:"name"`
 	Format string `json:"format"`
+	// Not given by Internet Archive for every file.
+	Md5 string `json:"md5,omitempty"`
+}
+
+// Gets the files of the item described by the metadata whose format contains the given one, ignoring case.
+// Returns all the files if the format is empty.
+func (metadataResponse *InternetArchiveMetadataResponse) FilterFilesByFormat(format string) []InternetArchiveFile {
+	files := []InternetArchiveFile{}
+	format = strings.ToLower(format)
+
+	for _, file := range metadataResponse.Files {
+		if strings.Contains(strings.ToLower(file.Format), format) {
+			files = append(files, file)
+		}
+	}
+
+	return files
+}
+
+// Checks whether the metadata describes an existing item, as Internet Archive returns empty metadata for unknown identifiers.
+func (metadataResponse *InternetArchiveMetadataResponse) Exists() bool {
+	return len(metadataResponse.Metadata.Identifier) > 0
+}
+
+// Gets the file with the given name from the item described by the metadata.
+// Returns nil if the item has no such file.
+func (metadataResponse *InternetArchiveMetadataResponse) FindFile(fileName string) *InternetArchiveFile {
+	for index := range metadataResponse.Files {
+		if metadataResponse.Files[index].Name == fileName {
+			return &metadataResponse.Files[index]
+		}
+	}
+
+	return nil
+}
+
+// Gets the content type and file extension matching the file format.
+// Unknown formats fall back to the file name extension, or to a generic binary type.
+func (file *InternetArchiveFile) GetContentType() (string, string) {
+	format := strings.ToLower(file.Format)
+
+	switch {
+	case strings.Contains(format, "epub"):
+		return "application/epub+zip", ".epub"
+	case strings.Contains(format, "pdf"):
+		return "application/pdf", ".pdf"
+	case strings.Contains(format, "djvutxt") || format == "text":
+		return "text/plain; charset=utf-8", ".txt"
+	}
+
+	extension := path.Ext(file.Name)
+
+	if contentType := mime.TypeByExtension(extension); len(extension) > 0 && len(contentType) > 0 {
+		return contentType, extension
+	}
+
+	return "application/octet-stream", extension
+}
+
+// Subjects of an Internet Archive item.
+// Internet Archive returns them either as a single string or as an array of strings, so both are accepted.
+type InternetArchiveSubjects []string
+
+func (subjects *InternetArchiveSubjects) UnmarshalJSON(data []byte) error {
+	if bytes.Equal(data, []byte("null")) {
+		*subjects = nil
+		return nil
+	}
+
+	var single string
+
+	if err := json.Unmarshal(data, &single); err == nil {
+		*subjects = InternetArchiveSubjects{single}
+		return nil
+	}
+
+	var multiple []string
+
+	if err := json.Unmarshal(data, &multiple); err != nil {
+		return err
+	}
+
+	*subjects = multiple
+	return nil
+}
+
+// Gets the distinct subjects of the item.
+// Subjects may also be separated by semicolons within a single string.
+func (metadata *InternetArchiveMetadata) GetSubjects() []string {
+	subjects := []string{}
+	seenSubjects := map[string]bool{}
+
+	for _, rawSubjects := range metadata.Subject {
+		for _, rawSubject := range strings.Split(rawSubjects, ";") {
+			subject := strings.TrimSpace(rawSubject)
+			key := strings.ToLower(subject)
+
+			if len(subject) == 0 || seenSubjects[key] {
+				continue
+			}
+
+			seenSubjects[key] = true
+			subjects = append(subjects, subject)
+		}
+	}
+
+	return subjects
 }
 
 type InternetArchiveMetadata struct {
-	Identifier       string      `json:"identifier"`
-	Mediatype        string      `json:"mediatype"`
-	Collection       []string    `json:"collection"`
-	Description      string      `json:"description"`
-	Scanner          string      `json:"scanner"`
-	Subject          interface{} `json:"subject"`
-	Title            string      `json:"title"`
-	Publicdate       string      `json:"publicdate"`
-	Uploader         string      `json:"uploader"`
-	Addeddate        string      `json:"addeddate"`
-	Language         string      `json:"language"`
-	IdentifierAccess string      `json:"identifier-access"`
-	IdentifierArk    string      `json:"identifier-ark"`
-	Ppi              string      `json:"ppi"`
-	Ocr              string      `json:"ocr"`
-	RepubState       string      `json:"repub_state"`
-	Curation         string      `json:"curation"`
-	BackupLocation   string      `json:"backup_location"`
+	Identifier       string                  `json:"identifier"`
+	Mediatype        string                  `json:"mediatype,omitempty"`
+	Collection       []string                `json:"collection,omitempty"`
+	Description      string                  `json:"description,omitempty"`
+	Scanner          string                  `json:"scanner,omitempty"`
+	Subject          InternetArchiveSubjects `json:"subject,omitempty"`
+	Title            string                  `json:"title"`
+	Publicdate       string                  `json:"publicdate,omitempty"`
+	Uploader         string                  `json:"uploader,omitempty"`
+	Addeddate        string                  `json:"addeddate,omitempty"`
+	Language         string                  `json:"language,omitempty"`
+	IdentifierAccess string                  `json:"identifier-access,omitempty"`
+	IdentifierArk    string                  `json:"identifier-ark,omitempty"`
+	Ppi              string                  `json:"ppi,omitempty"`
+	Ocr              string                  `json:"ocr,omitempty"`
+	RepubState       string                  `json:"repub_state,omitempty"`
+	Curation         string                  `json:"curation,omitempty"`
+	BackupLocation   string                  `json:"backup_location,omitempty"`
 }
@@ -0,0 +1,83 @@
+package models
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInternetArchiveSubjectsUnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		name             string
+		payload          string
+		expectedSubjects InternetArchiveSubjects
+		expectedErr      bool
+	}{
+		{"single_string", `{"subject":"Fiction"}`, InternetArchiveSubjects{"Fiction"}, false},
+		{"array", `{"subject":["Fiction","Poetry"]}`, InternetArchiveSubjects{"Fiction", "Poetry"}, false},
+		{"null", `{"subject":null}`, nil, false},
+		{"missing", `{}`, nil, false},
+		{"invalid", `{"subject":3}`, nil, true},
+	}
+
+	for _, testCase := range tests {
+		t.Run(testCase.name, func(t *testing.T) {
+			metadata := InternetArchiveMetadata{}
+
+			err := json.Unmarshal([]byte(testCase.payload), &metadata)
+
+			if testCase.expectedErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, testCase.expectedSubjects, metadata.Subject)
+		})
+	}
+}
+
+func TestInternetArchiveYearUnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		name         string
+		payload      string
+		expectedYear InternetArchiveYear
+	}{
+		{"number", `{"year":1865}`, 1865},
+		{"string", `{"year":"1865"}`, 1865},
+		{"not_a_year", `{"year":"circa 1865"}`, 0},
+		{"null", `{"year":null}`, 0},
+		{"missing", `{}`, 0},
+	}
+
+	for _, testCase := range tests {
+		t.Run(testCase.name, func(t *testing.T) {
+			book := InternetArchiveBook{}
+
+			assert.NoError(t, json.Unmarshal([]byte(testCase.payload), &book))
+			assert.Equal(t, testCase.expectedYear, book.Year)
+		})
+	}
+}
+
+func TestInternetArchiveMarshalJSONOmitsEmptyFields(t *testing.T) {
+	serializedBook, err := json.Marshal(InternetArchiveBook{Identifier: "book1", Title: "Book 1"})
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"identifier":"book1","title":"Book 1"}`, string(serializedBook))
+
+	serializedMetadata, err := json.Marshal(InternetArchiveMetadata{Identifier: "book1", Title: "Book 1"})
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"identifier":"book1","title":"Book 1"}`, string(serializedMetadata))
+
+	// Test case: Fields that are set are kept
+	serializedBook, err = json.Marshal(InternetArchiveBook{Identifier: "book1", Title: "Book 1", Creator: "Author", Year: 1865})
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"identifier":"book1","title":"Book 1","creator":"Author","year":1865}`, string(serializedBook))
+}
+
+func TestGetSubjects(t *testing.T) {
+	metadata := InternetArchiveMetadata{Subject: InternetArchiveSubjects{"Fiction; Poetry", " fiction ", "", "History"}}
+
+	assert.Equal(t, []string{"Fiction", "Poetry", "History"}, metadata.GetSubjects())
+	assert.Empty(t, (&InternetArchiveMetadata{}).GetSubjects())
+}
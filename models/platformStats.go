@@ -0,0 +1,12 @@
+package models
+
+// PlatformStats holds aggregate counts of the whole platform, for the admin dashboard.
+type PlatformStats struct {
+	TotalUsers             int64 `json:"totalUsers"`
+	TotalDiaryEntries      int64 `json:"totalDiaryEntries"`
+	TotalBookRegistrations int64 `json:"totalBookRegistrations"`
+	TotalGameRegistrations int64 `json:"totalGameRegistrations"`
+	// Users created within the last NewUsersDays days.
+	NewUsers     int64 `json:"newUsers"`
+	NewUsersDays int   `json:"newUsersDays"`
+}
@@ -5,11 +5,37 @@ type TokenKind int
 const (
 	Access TokenKind = iota + 1
 	Refresh
+	// Access tokens issued to admins impersonating a user are stored apart from the user's own ones.
+	Impersonation
 )
 
+// Gets the name of the token kind, as shown to clients.
+func (kind TokenKind) String() string {
+	switch kind {
+	case Access:
+		return "access"
+	case Refresh:
+		return "refresh"
+	case Impersonation:
+		return "impersonation"
+	default:
+		return "unknown"
+	}
+}
+
+// Token of a user. Its creation and last use times are Unix seconds.
 type Token struct {
 	Id         uint   `json:"id"`
 	TokenValue string `json:"token"`
 	UserRefer  uint   `json:"user_id"`
 	Kind       TokenKind
+	CreatedAt  int64 `json:"createdAt"`
+	LastUsedAt int64 `json:"lastUsedAt"`
+}
+
+// Session is a refresh token of a user, without its value. Times are Unix seconds.
+type Session struct {
+	Id         uint  `json:"id"`
+	CreatedAt  int64 `json:"createdAt"`
+	LastUsedAt int64 `json:"lastUsedAt"`
 }
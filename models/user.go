@@ -7,9 +7,48 @@ const (
 	Standard
 )
 
+// Names of the user roles, as received by the API.
+var userRoleNames = map[UserRole]string{
+	Admin:    "admin",
+	Standard: "standard",
+}
+
+// Parses the user role with the given name.
+// Returns false if no role has that name.
+func ParseUserRole(name string) (UserRole, bool) {
+	for role, roleName := range userRoleNames {
+		if roleName == name {
+			return role, true
+		}
+	}
+
+	return 0, false
+}
+
+// User of the API. Its creation time is Unix seconds.
 type User struct {
-	Id       uint     `json:"id"`
-	Email    string   `json:"email"`
-	UserName string   `json:"userName"`
-	Role     UserRole `json:"role"`
+	Id        uint     `json:"id"`
+	Email     string   `json:"email"`
+	UserName  string   `json:"userName"`
+	Role      UserRole `json:"role"`
+	CreatedAt int64    `json:"createdAt"`
+	// Whether a login provider asserted the user owns the email.
+	EmailVerified bool `json:"emailVerified"`
+}
+
+// Fields users can be sorted by when listing them.
+type UserSortField string
+
+const (
+	UserSortByCreatedAt UserSortField = "created_at"
+	UserSortByEmail     UserSortField = "email"
+)
+
+// UserListFilter holds the criteria users are listed by. Zero valued criteria do not filter.
+type UserListFilter struct {
+	Role          UserRole
+	EmailContains string
+	SortBy        UserSortField
+	Limit         int
+	Offset        int
 }
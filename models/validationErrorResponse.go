@@ -0,0 +1,8 @@
+package models
+
+// Body of the responses to requests whose body is not valid JSON or does not pass validation.
+// Each of the errors describes a single invalid field, or the JSON parsing error.
+type ValidationErrorResponse struct {
+	Status int          `json:"status" example:"400"`
+	Errors []*HttpError `json:"errors"`
+}
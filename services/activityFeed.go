@@ -0,0 +1,69 @@
+package services
+
+import (
+	"github.com/adfer-dev/analock-api/models"
+	"github.com/adfer-dev/analock-api/storage"
+)
+
+// ActivityFeedQuery holds the criteria and page to list the activity feed of a user by.
+type ActivityFeedQuery struct {
+	UserId     uint
+	Type       models.ActivityFeedItemType
+	Descending bool
+	Page       int
+	PageSize   int
+}
+
+// ActivityFeedPage is a page of the activity feed of a user, along with the count of registrations matching the criteria.
+type ActivityFeedPage struct {
+	Items    []*models.ActivityFeedItem `json:"items"`
+	Total    int64                      `json:"total"`
+	Page     int                        `json:"page"`
+	PageSize int                        `json:"pageSize"`
+}
+
+// ActivityFeedService lists the book and game registrations of a user together.
+type ActivityFeedService interface {
+	GetUserActivityFeed(query ActivityFeedQuery) (*ActivityFeedPage, error)
+}
+
+type ActivityFeedServiceImpl struct {
+	activityRegistrationStorage storage.ActivityRegistrationStorageInterface
+}
+
+var _ ActivityFeedService = (*ActivityFeedServiceImpl)(nil)
+
+// Creates an activity feed service backed by the given storage.
+func NewActivityFeedServiceImpl(activityRegistrationStorage storage.ActivityRegistrationStorageInterface) *ActivityFeedServiceImpl {
+	return &ActivityFeedServiceImpl{activityRegistrationStorage: activityRegistrationStorage}
+}
+
+// Lists the page of the activity feed of a user matching the given criteria. Pages start at 1.
+func (activityFeedService *ActivityFeedServiceImpl) GetUserActivityFeed(query ActivityFeedQuery) (*ActivityFeedPage, error) {
+	filter := &models.ActivityFeedFilter{
+		UserId:     query.UserId,
+		Type:       query.Type,
+		Descending: query.Descending,
+		Limit:      query.PageSize,
+		Offset:     (query.Page - 1) * query.PageSize,
+	}
+
+	feedItems, feedErr := activityFeedService.activityRegistrationStorage.GetFeed(filter)
+
+	if feedErr != nil {
+		return nil, feedErr
+	}
+
+	total, countErr := activityFeedService.activityRegistrationStorage.CountFeed(filter)
+
+	if countErr != nil {
+		return nil, countErr
+	}
+
+	return &ActivityFeedPage{
+		Items:    feedItems.([]*models.ActivityFeedItem),
+		Total:    total,
+		Page:     query.Page,
+		PageSize: query.PageSize,
+	}, nil
+}
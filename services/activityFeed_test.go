@@ -0,0 +1,54 @@
+package services
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/adfer-dev/analock-api/models"
+	"github.com/adfer-dev/analock-api/storage/memory"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetUserActivityFeed(t *testing.T) {
+	t.Parallel()
+
+	database := memory.NewDatabase()
+	activityRegistrationStorage := memory.NewActivityRegistrationStorage(database)
+	bookRegistrationStorage := memory.NewBookActivityRegistrationStorage(database)
+	gameRegistrationStorage := memory.NewGameActivityRegistrationStorage(database)
+	activityFeedService := NewActivityFeedServiceImpl(activityRegistrationStorage)
+
+	bookRegistration := &models.BookActivityRegistration{InternetArchiveIdentifier: "book", Registration: models.ActivityRegistration{RegistrationDate: 100, UserRefer: 1}}
+	assert.NoError(t, activityRegistrationStorage.Create(&bookRegistration.Registration))
+	assert.NoError(t, bookRegistrationStorage.Create(bookRegistration))
+
+	for _, registrationDate := range []int64{50, 200} {
+		gameRegistration := &models.GameActivityRegistration{GameName: "sudoku", Registration: models.ActivityRegistration{RegistrationDate: registrationDate, UserRefer: 1}}
+		assert.NoError(t, activityRegistrationStorage.Create(&gameRegistration.Registration))
+		assert.NoError(t, gameRegistrationStorage.Create(gameRegistration))
+	}
+
+	page, err := activityFeedService.GetUserActivityFeed(ActivityFeedQuery{UserId: 1, Descending: true, Page: 1, PageSize: 2})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), page.Total)
+	assert.Len(t, page.Items, 2)
+	assert.Equal(t, models.GameActivityFeedItem, page.Items[0].Type)
+	assert.Equal(t, "sudoku", page.Items[0].GameName)
+	assert.Equal(t, models.BookActivityFeedItem, page.Items[1].Type)
+	assert.Equal(t, "book", page.Items[1].InternetArchiveIdentifier)
+
+	page, err = activityFeedService.GetUserActivityFeed(ActivityFeedQuery{UserId: 1, Descending: true, Page: 2, PageSize: 2})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, page.Page)
+	assert.Len(t, page.Items, 1)
+	assert.Equal(t, int64(50), page.Items[0].Registration.RegistrationDate)
+}
+
+func TestGetUserActivityFeedStorageError(t *testing.T) {
+	t.Parallel()
+
+	activityFeedService := NewActivityFeedServiceImpl(&mockActivityRegistrationStorage{Err: errors.New("forced feed error")})
+
+	_, err := activityFeedService.GetUserActivityFeed(ActivityFeedQuery{UserId: 1, Page: 1, PageSize: 10})
+	assert.EqualError(t, err, "forced feed error")
+}
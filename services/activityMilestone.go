@@ -0,0 +1,168 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/adfer-dev/analock-api/config"
+	"github.com/adfer-dev/analock-api/constants"
+	"github.com/adfer-dev/analock-api/models"
+	"github.com/adfer-dev/analock-api/storage"
+	"github.com/adfer-dev/analock-api/utils"
+)
+
+// Times a webhook post is retried after failing. Milestones are posted in the background, so they are retried the most.
+const milestoneWebhookRetries uint = 5
+
+// WebhookDispatcher posts signed JSON payloads to an external service.
+type WebhookDispatcher struct {
+	url     string
+	secret  string
+	breaker *CircuitBreaker
+}
+
+// Creates a dispatcher posting to the given URL, signing the payloads with the given secret.
+func NewWebhookDispatcher(url string, secret string, breaker *CircuitBreaker) *WebhookDispatcher {
+	return &WebhookDispatcher{url: url, secret: secret, breaker: breaker}
+}
+
+// Posts the given payload, sending the HMAC-SHA256 signature of its body in the X-Analock-Signature header.
+func (dispatcher *WebhookDispatcher) Dispatch(payload interface{}) error {
+	body, marshalErr := json.Marshal(payload)
+
+	if marshalErr != nil {
+		return marshalErr
+	}
+
+	_, reqErr := PerformRequest[struct{}](
+		dispatcher.breaker,
+		http.MethodPost,
+		dispatcher.url,
+		json.RawMessage(body),
+		map[string]string{constants.WebhookSignatureHeader: SignWebhookPayload(dispatcher.secret, body)},
+		milestoneWebhookRetries,
+	)
+
+	return reqErr
+}
+
+// Signs the given webhook body with the given secret, so receivers can check it was sent by the API.
+// Returns the hex encoded HMAC-SHA256, prefixed by the algorithm.
+func SignWebhookPayload(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+var milestoneWebhookCircuitBreaker *CircuitBreaker
+var milestoneWebhookCircuitBreakerOnce sync.Once
+
+// Gets the dispatcher of the milestone webhook configured in the config.
+// Returns nil if no webhook is configured.
+func getMilestoneWebhookDispatcher() *WebhookDispatcher {
+	webhookConfig := config.Get().MilestoneWebhook
+
+	if len(webhookConfig.Url) == 0 {
+		return nil
+	}
+
+	milestoneWebhookCircuitBreakerOnce.Do(func() {
+		milestoneWebhookCircuitBreaker = NewCircuitBreaker(CircuitBreakerConfig{
+			FailureThreshold: config.DefaultCircuitBreakerFailureThreshold,
+			FailureWindow:    config.DefaultCircuitBreakerFailureWindow,
+			Cooldown:         config.DefaultCircuitBreakerCooldown,
+		})
+	})
+
+	return NewWebhookDispatcher(webhookConfig.Url, webhookConfig.Secret, milestoneWebhookCircuitBreaker)
+}
+
+// Checks in background whether the given newly created registration makes its user reach a streak milestone,
+// counting the days in the given location, and notifies it to the milestone webhook if so.
+// Does nothing if no webhook is configured.
+func notifyActivityMilestone(activityRegistrationStorage storage.ActivityRegistrationStorageInterface, registration *models.ActivityRegistration, location *time.Location) {
+	dispatcher := getMilestoneWebhookDispatcher()
+
+	if dispatcher == nil {
+		return
+	}
+
+	milestones := config.Get().MilestoneWebhook.StreakMilestones
+	createdRegistration := *registration
+
+	go func() {
+		milestone, reached, milestoneErr := getReachedStreakMilestone(activityRegistrationStorage, &createdRegistration, milestones, location)
+
+		if milestoneErr != nil {
+			utils.GetCustomLogger().Errorf("Could not check the activity milestones of user %d: %s\n", createdRegistration.UserRefer, milestoneErr.Error())
+			return
+		}
+
+		if !reached {
+			return
+		}
+
+		if dispatchErr := dispatcher.Dispatch(milestone); dispatchErr != nil {
+			utils.GetCustomLogger().Errorf("Could not notify the activity milestone of user %d: %s\n", createdRegistration.UserRefer, dispatchErr.Error())
+		}
+	}()
+}
+
+// Gets the streak milestone the given registration makes its user reach, if any.
+//
+// The streak is the number of consecutive calendar days, in the given location, with activity up to the day of the registration.
+// A milestone is only reached by the first registration of the day, so it is notified once.
+func getReachedStreakMilestone(
+	activityRegistrationStorage storage.ActivityRegistrationStorageInterface,
+	registration *models.ActivityRegistration,
+	milestones []uint,
+	location *time.Location,
+) (*models.ActivityMilestone, bool, error) {
+	if len(milestones) == 0 {
+		return nil, false, nil
+	}
+
+	dayStart, dayEnd := utils.LocationDayBounds(registration.RegistrationDate, location)
+	// One more day than the longest milestone is counted, so longer streaks do not look like it
+	longestMilestone := slices.Max(milestones)
+	day := time.Unix(dayStart, 0).In(location)
+	dayCounts, countErr := activityRegistrationStorage.CountByDay(
+		registration.UserRefer,
+		day.AddDate(0, 0, -int(longestMilestone)).Unix(),
+		dayEnd,
+		location,
+	)
+
+	if countErr != nil {
+		return nil, false, countErr
+	}
+
+	if dayCounts[dayStart] != 1 {
+		return nil, false, nil
+	}
+
+	var streakDays uint
+
+	// Days are stepped by date, as they do not last 24 hours when daylight saving time changes
+	for ; dayCounts[day.Unix()] > 0 && streakDays <= longestMilestone; day = day.AddDate(0, 0, -1) {
+		streakDays++
+	}
+
+	if !slices.Contains(milestones, streakDays) {
+		return nil, false, nil
+	}
+
+	return &models.ActivityMilestone{
+		Event:      models.StreakMilestoneEvent,
+		UserId:     registration.UserRefer,
+		StreakDays: streakDays,
+		ReachedAt:  dayStart,
+	}, true, nil
+}
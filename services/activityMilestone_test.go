@@ -0,0 +1,196 @@
+package services
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/adfer-dev/analock-api/constants"
+	"github.com/adfer-dev/analock-api/models"
+	"github.com/adfer-dev/analock-api/storage/memory"
+	"github.com/adfer-dev/analock-api/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+// Creates an activity registration of the given user at noon of the given day, counted from the unix epoch.
+func createRegistrationOnDay(t *testing.T, activityRegistrationStorage *memory.ActivityRegistrationStorage, userId uint, day int64) *models.ActivityRegistration {
+	registration := &models.ActivityRegistration{RegistrationDate: day*constants.DaySeconds + constants.DaySeconds/2, UserRefer: userId}
+	assert.NoError(t, activityRegistrationStorage.Create(registration))
+
+	return registration
+}
+
+func TestGetReachedStreakMilestone(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name               string
+		previousDays       []int64
+		day                int64
+		expectedStreakDays uint
+		expectedReached    bool
+	}{
+		{"Streak reaches milestone", []int64{8, 9}, 10, 3, true},
+		{"Streak below milestone", []int64{9}, 10, 0, false},
+		{"Streak broken by a day without activity", []int64{7, 9}, 10, 0, false},
+		{"Streak past milestone", []int64{6, 7, 8, 9}, 10, 0, false},
+		{"Longest milestone", []int64{6, 7, 8, 9}, 10, 5, true},
+		{"Not the first registration of the day", []int64{8, 9, 10}, 10, 0, false},
+	}
+
+	for _, testCase := range tests {
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+
+			activityRegistrationStorage := memory.NewActivityRegistrationStorage(memory.NewDatabase())
+			milestones := []uint{3}
+
+			if testCase.name == "Longest milestone" {
+				milestones = []uint{3, 5}
+			}
+
+			for _, day := range testCase.previousDays {
+				createRegistrationOnDay(t, activityRegistrationStorage, 1, day)
+			}
+
+			// Registrations of other users do not count
+			createRegistrationOnDay(t, activityRegistrationStorage, 2, testCase.day-1)
+
+			registration := createRegistrationOnDay(t, activityRegistrationStorage, 1, testCase.day)
+			milestone, reached, err := getReachedStreakMilestone(activityRegistrationStorage, registration, milestones, time.UTC)
+
+			assert.NoError(t, err)
+			assert.Equal(t, testCase.expectedReached, reached)
+
+			if testCase.expectedReached {
+				assert.Equal(t, &models.ActivityMilestone{
+					Event:      models.StreakMilestoneEvent,
+					UserId:     1,
+					StreakDays: testCase.expectedStreakDays,
+					ReachedAt:  testCase.day * constants.DaySeconds,
+				}, milestone)
+			}
+		})
+	}
+}
+
+func TestGetReachedStreakMilestoneInLocation(t *testing.T) {
+	t.Parallel()
+
+	madrid, _ := time.LoadLocation("Europe/Madrid")
+
+	tests := []struct {
+		name               string
+		registrationDates  []time.Time
+		location           *time.Location
+		expectedStreakDays uint
+		expectedReached    bool
+	}{
+		{
+			"Consecutive local days on non consecutive UTC days",
+			[]time.Time{time.Date(2024, 3, 9, 23, 30, 0, 0, time.UTC), time.Date(2024, 3, 11, 8, 0, 0, 0, time.UTC)},
+			madrid, 2, true,
+		},
+		{
+			"Consecutive local days counted in UTC",
+			[]time.Time{time.Date(2024, 3, 9, 23, 30, 0, 0, time.UTC), time.Date(2024, 3, 11, 8, 0, 0, 0, time.UTC)},
+			time.UTC, 0, false,
+		},
+		{
+			"Same local day on consecutive UTC days",
+			[]time.Time{time.Date(2024, 3, 9, 23, 30, 0, 0, time.UTC), time.Date(2024, 3, 10, 8, 0, 0, 0, time.UTC)},
+			madrid, 0, false,
+		},
+		{
+			"Streak through the summer time change",
+			[]time.Time{time.Date(2024, 3, 30, 12, 0, 0, 0, madrid), time.Date(2024, 3, 31, 12, 0, 0, 0, madrid), time.Date(2024, 4, 1, 12, 0, 0, 0, madrid)},
+			madrid, 3, true,
+		},
+	}
+
+	for _, testCase := range tests {
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+
+			activityRegistrationStorage := memory.NewActivityRegistrationStorage(memory.NewDatabase())
+			var registration *models.ActivityRegistration
+
+			for _, registrationDate := range testCase.registrationDates {
+				registration = &models.ActivityRegistration{RegistrationDate: registrationDate.Unix(), UserRefer: 1}
+				assert.NoError(t, activityRegistrationStorage.Create(registration))
+			}
+
+			milestone, reached, err := getReachedStreakMilestone(activityRegistrationStorage, registration, []uint{2, 3}, testCase.location)
+
+			assert.NoError(t, err)
+			assert.Equal(t, testCase.expectedReached, reached)
+
+			if testCase.expectedReached {
+				dayStart, _ := utils.LocationDayBounds(registration.RegistrationDate, testCase.location)
+				assert.Equal(t, testCase.expectedStreakDays, milestone.StreakDays)
+				assert.Equal(t, dayStart, milestone.ReachedAt)
+			}
+		})
+	}
+}
+
+func TestCreateRegistrationNotifiesMilestone(t *testing.T) {
+	type webhookCall struct {
+		body      []byte
+		signature string
+	}
+
+	calls := make(chan webhookCall, 2)
+	receiver := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		body, _ := io.ReadAll(req.Body)
+		calls <- webhookCall{body: body, signature: req.Header.Get(constants.WebhookSignatureHeader)}
+		res.WriteHeader(http.StatusNoContent)
+	}))
+	defer receiver.Close()
+
+	t.Setenv("API_MILESTONE_WEBHOOK_URL", receiver.URL)
+	t.Setenv("API_MILESTONE_WEBHOOK_SECRET", "secret")
+	t.Setenv("API_MILESTONE_STREAK_DAYS", "2")
+
+	database := memory.NewDatabase()
+	activityRegistrationStorage := memory.NewActivityRegistrationStorage(database)
+	gameRegistrationService := NewGameActivityRegistrationServiceImpl(memory.NewGameActivityRegistrationStorage(database), activityRegistrationStorage)
+	createRegistrationOnDay(t, activityRegistrationStorage, 1, 9)
+	registrationBody := &AddGameActivityRegistrationBody{GameName: "sudoku", RegistrationDate: 10*constants.DaySeconds + 1}
+
+	_, createErr := gameRegistrationService.CreateGameActivityRegistration(registrationBody, 1, time.UTC)
+	assert.NoError(t, createErr)
+
+	select {
+	case call := <-calls:
+		milestone := &models.ActivityMilestone{}
+		assert.NoError(t, json.Unmarshal(call.body, milestone))
+		assert.Equal(t, &models.ActivityMilestone{Event: models.StreakMilestoneEvent, UserId: 1, StreakDays: 2, ReachedAt: 10 * constants.DaySeconds}, milestone)
+		assert.Equal(t, SignWebhookPayload("secret", call.body), call.signature)
+	case <-time.After(5 * time.Second):
+		t.Fatal("milestone webhook was not called")
+	}
+
+	// Test case: Later registrations of the same day do not notify the milestone again
+	_, createErr = gameRegistrationService.CreateGameActivityRegistration(registrationBody, 1, time.UTC)
+	assert.NoError(t, createErr)
+
+	select {
+	case <-calls:
+		t.Error("milestone webhook was called twice")
+	case <-time.After(200 * time.Millisecond):
+	}
+}
+
+func TestSignWebhookPayload(t *testing.T) {
+	t.Parallel()
+
+	// HMAC-SHA256 of the body with the key "key", as computed by openssl
+	assert.Equal(t,
+		"sha256=f7bc83f430538424b13298e6aa6fb143ef4d59a14946175997479dbc2d1a3cd8",
+		SignWebhookPayload("key", []byte("The quick brown fox jumps over the lazy dog")),
+	)
+}
@@ -1,43 +1,96 @@
 package services
 
 import (
+	"errors"
+	"time"
+
+	"github.com/adfer-dev/analock-api/config"
 	"github.com/adfer-dev/analock-api/models"
 	"github.com/adfer-dev/analock-api/storage"
+	"github.com/adfer-dev/analock-api/utils"
 )
 
-// BookActicityRegistrationService interface and implementation
+// BookActivityRegistrationService interface and implementation
 type BookActivityRegistrationService interface {
 	GetUserBookActivityRegistrations(userId uint) ([]*models.BookActivityRegistration, error)
 	GetUserBookActivityRegistrationsTimeRange(userId uint, startTime int64, endTime int64) ([]*models.BookActivityRegistration, error)
-	CreateBookActivityRegistration(addRegistrationBody *AddBookActivityRegistrationBody, userId uint) (*models.BookActivityRegistration, error)
+	GetBookActivityRegistrationById(id uint) (*models.BookActivityRegistration, error)
+	CreateBookActivityRegistration(addRegistrationBody *AddBookActivityRegistrationBody, userId uint, location *time.Location) (*models.BookActivityRegistration, error)
+	UpdateBookActivityRegistration(id uint, updateRegistrationBody *UpdateBookActivityRegistrationBody) (*models.BookActivityRegistration, error)
+}
+type BookActivityRegistrationServiceImpl struct {
+	bookRegistrationStorage     storage.BookActivityRegistrationStorageInterface
+	activityRegistrationStorage storage.ActivityRegistrationStorageInterface
+}
+
+var _ BookActivityRegistrationService = (*BookActivityRegistrationServiceImpl)(nil)
+
+// Creates a book activity registration service backed by the given storages.
+func NewBookActivityRegistrationServiceImpl(
+	bookRegistrationStorage storage.BookActivityRegistrationStorageInterface,
+	activityRegistrationStorage storage.ActivityRegistrationStorageInterface,
+) *BookActivityRegistrationServiceImpl {
+	return &BookActivityRegistrationServiceImpl{
+		bookRegistrationStorage:     bookRegistrationStorage,
+		activityRegistrationStorage: activityRegistrationStorage,
+	}
 }
-type BookActivityRegistrationServiceImpl struct{}
 
-// GameActicityRegistrationService interface and implementation
+// GameActivityRegistrationService interface and implementation
 type GameActivityRegistrationService interface {
 	GetUserGameActivityRegistrations(userId uint) ([]*models.GameActivityRegistration, error)
 	GetUserGameActivityRegistrationsTimeRange(userId uint, startDate int64, endDate int64) ([]*models.GameActivityRegistration, error)
-	CreateGameActivityRegistration(addRegistrationBody *AddGameActivityRegistrationBody, userId uint) (*models.GameActivityRegistration, error)
+	GetGameActivityRegistrationById(id uint) (*models.GameActivityRegistration, error)
+	CreateGameActivityRegistration(addRegistrationBody *AddGameActivityRegistrationBody, userId uint, location *time.Location) (*models.GameActivityRegistration, error)
+	UpdateGameActivityRegistration(id uint, updateRegistrationBody *UpdateGameActivityRegistrationBody) (*models.GameActivityRegistration, error)
+}
+type GameActivityRegistrationServiceImpl struct {
+	gameRegistrationStorage     storage.GameActivityRegistrationStorageInterface
+	activityRegistrationStorage storage.ActivityRegistrationStorageInterface
+}
+
+var _ GameActivityRegistrationService = (*GameActivityRegistrationServiceImpl)(nil)
+
+// Creates a game activity registration service backed by the given storages.
+func NewGameActivityRegistrationServiceImpl(
+	gameRegistrationStorage storage.GameActivityRegistrationStorageInterface,
+	activityRegistrationStorage storage.ActivityRegistrationStorageInterface,
+) *GameActivityRegistrationServiceImpl {
+	return &GameActivityRegistrationServiceImpl{
+		gameRegistrationStorage:     gameRegistrationStorage,
+		activityRegistrationStorage: activityRegistrationStorage,
+	}
 }
-type GameActivityRegistrationServiceImpl struct{}
 
 // Request bodies structs
 type AddBookActivityRegistrationBody struct {
-	InternetArchiveId string `json:"internetArchiveId" validate:"required"`
-	RegistrationDate  int64  `json:"registrationDate" validate:"required"`
+	InternetArchiveId string `json:"internetArchiveId" validate:"required,iaidentifier"`
+	// Unix seconds.
+	RegistrationDate int64  `json:"registrationDate" validate:"required,unixseconds"`
+	Platform         string `json:"platform" validate:"omitempty,oneof=android ios web"`
 }
 
 type AddGameActivityRegistrationBody struct {
-	GameName         string `json:"gameName" validate:"required"`
-	RegistrationDate int64  `json:"registrationDate" validate:"required"`
+	GameName string `json:"gameName" validate:"required"`
+	// Unix seconds.
+	RegistrationDate int64  `json:"registrationDate" validate:"required,unixseconds"`
+	Platform         string `json:"platform" validate:"omitempty,oneof=android ios web"`
 }
 
-var bookActivityRegistrationStorage storage.BookActivityRegistrationStorageInterface = &storage.BookActivityRegistrationStorage{}
-var gameActivityRegistrationStorage storage.GameActivityRegistrationStorageInterface = &storage.GameActivityRegistrationStorage{}
-var activityRegistrationStorage storage.ActivityRegistrationStorageInterface = &storage.ActivityRegistrationStorage{}
+type UpdateBookActivityRegistrationBody struct {
+	InternetArchiveId string `json:"internetArchiveId" validate:"required,iaidentifier"`
+	// Unix seconds.
+	RegistrationDate int64 `json:"registrationDate" validate:"required,unixseconds"`
+}
+
+type UpdateGameActivityRegistrationBody struct {
+	GameName string `json:"gameName" validate:"required"`
+	// Unix seconds.
+	RegistrationDate int64 `json:"registrationDate" validate:"required,unixseconds"`
+}
 
 func (bookActivityRegistrationService *BookActivityRegistrationServiceImpl) GetUserBookActivityRegistrations(userId uint) ([]*models.BookActivityRegistration, error) {
-	dbUserRegistrations, err := bookActivityRegistrationStorage.GetByUserId(userId)
+	dbUserRegistrations, err := bookActivityRegistrationService.bookRegistrationStorage.GetByUserId(userId)
 
 	if err != nil {
 		return nil, err
@@ -46,8 +99,8 @@ func (bookActivityRegistrationService *BookActivityRegistrationServiceImpl) GetU
 	return dbUserRegistrations.([]*models.BookActivityRegistration), nil
 }
 
-func (bookActivityRegistrationService *GameActivityRegistrationServiceImpl) GetUserGameActivityRegistrations(userId uint) ([]*models.GameActivityRegistration, error) {
-	dbUserRegistrations, err := gameActivityRegistrationStorage.GetByUserId(userId)
+func (gameActivityRegistrationService *GameActivityRegistrationServiceImpl) GetUserGameActivityRegistrations(userId uint) ([]*models.GameActivityRegistration, error) {
+	dbUserRegistrations, err := gameActivityRegistrationService.gameRegistrationStorage.GetByUserId(userId)
 
 	if err != nil {
 		return nil, err
@@ -56,8 +109,28 @@ func (bookActivityRegistrationService *GameActivityRegistrationServiceImpl) GetU
 	return dbUserRegistrations.([]*models.GameActivityRegistration), nil
 }
 
+func (bookActivityRegistrationService *BookActivityRegistrationServiceImpl) GetBookActivityRegistrationById(id uint) (*models.BookActivityRegistration, error) {
+	dbRegistration, err := bookActivityRegistrationService.bookRegistrationStorage.Get(id)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return dbRegistration.(*models.BookActivityRegistration), nil
+}
+
+func (gameActivityRegistrationService *GameActivityRegistrationServiceImpl) GetGameActivityRegistrationById(id uint) (*models.GameActivityRegistration, error) {
+	dbRegistration, err := gameActivityRegistrationService.gameRegistrationStorage.Get(id)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return dbRegistration.(*models.GameActivityRegistration), nil
+}
+
 func (bookActivityRegistrationService *BookActivityRegistrationServiceImpl) GetUserBookActivityRegistrationsTimeRange(userId uint, startTime int64, endTime int64) ([]*models.BookActivityRegistration, error) {
-	dbUserRegistrations, err := bookActivityRegistrationStorage.GetByUserIdAndTimeRange(userId, startTime, endTime)
+	dbUserRegistrations, err := bookActivityRegistrationService.bookRegistrationStorage.GetByUserIdAndTimeRange(userId, startTime, endTime)
 
 	if err != nil {
 		return nil, err
@@ -67,7 +140,7 @@ func (bookActivityRegistrationService *BookActivityRegistrationServiceImpl) GetU
 }
 
 func (gameActivityRegistrationService *GameActivityRegistrationServiceImpl) GetUserGameActivityRegistrationsTimeRange(userId uint, startDate int64, endDate int64) ([]*models.GameActivityRegistration, error) {
-	dbUserRegistrations, err := gameActivityRegistrationStorage.GetByUserIdAndInterval(userId, startDate, endDate)
+	dbUserRegistrations, err := gameActivityRegistrationService.gameRegistrationStorage.GetByUserIdAndInterval(userId, startDate, endDate)
 
 	if err != nil {
 		return nil, err
@@ -76,12 +149,46 @@ func (gameActivityRegistrationService *GameActivityRegistrationServiceImpl) GetU
 	return dbUserRegistrations.([]*models.GameActivityRegistration), nil
 }
 
-func (bookActivityRegistrationService *BookActivityRegistrationServiceImpl) CreateBookActivityRegistration(addRegistrationBody *AddBookActivityRegistrationBody, userId uint) (*models.BookActivityRegistration, error) {
+// Lock per user id held from the deduplication check until the registration is stored,
+// so concurrent creations of the same registration cannot both miss the existing one.
+// Like diaryEntryCreationLocks, it only serializes the writes handled by this process.
+var activityRegistrationCreationLocks = newKeyedLock()
+
+// Checks whether the deduplication of activity registrations is enabled.
+func isRegistrationDeduplicationEnabled() bool {
+	return config.Get().DeduplicateActivityRegistrations
+}
+
+// Creates a book activity registration of the given user.
+// If deduplication is enabled, registering the same book twice on the same day of the given location
+// returns the existing registration.
+func (bookActivityRegistrationService *BookActivityRegistrationServiceImpl) CreateBookActivityRegistration(addRegistrationBody *AddBookActivityRegistrationBody, userId uint, location *time.Location) (*models.BookActivityRegistration, error) {
+	unlockUser := activityRegistrationCreationLocks.Lock(userId)
+	defer unlockUser()
+
+	if isRegistrationDeduplicationEnabled() {
+		dayStart, dayEnd := utils.LocationDayBounds(addRegistrationBody.RegistrationDate, location)
+		existingRegistration, getErr := bookActivityRegistrationService.bookRegistrationStorage.GetByUserIdIdentifierAndTimeRange(userId, addRegistrationBody.InternetArchiveId, dayStart, dayEnd)
+
+		if getErr == nil {
+			return existingRegistration.(*models.BookActivityRegistration), nil
+		}
+
+		var notFoundErr *models.DbNotFoundError
+		if !errors.As(getErr, &notFoundErr) {
+			return nil, getErr
+		}
+	}
+
+	registrationWritesLock.RLock()
+	defer registrationWritesLock.RUnlock()
+
 	dbActivityRegistration := &models.ActivityRegistration{
 		RegistrationDate: addRegistrationBody.RegistrationDate,
 		UserRefer:        userId,
+		Platform:         addRegistrationBody.Platform,
 	}
-	createActivityRegistrationErr := activityRegistrationStorage.Create(dbActivityRegistration)
+	createActivityRegistrationErr := bookActivityRegistrationService.activityRegistrationStorage.Create(dbActivityRegistration)
 
 	if createActivityRegistrationErr != nil {
 		return nil, createActivityRegistrationErr
@@ -92,22 +199,47 @@ func (bookActivityRegistrationService *BookActivityRegistrationServiceImpl) Crea
 		Registration:              *dbActivityRegistration,
 	}
 
-	createBookActivityRegistrationErr := bookActivityRegistrationStorage.Create(dbBookActivityRegistration)
+	createBookActivityRegistrationErr := bookActivityRegistrationService.bookRegistrationStorage.Create(dbBookActivityRegistration)
 
 	if createBookActivityRegistrationErr != nil {
 		return nil, createBookActivityRegistrationErr
 	}
 
+	notifyActivityMilestone(bookActivityRegistrationService.activityRegistrationStorage, dbActivityRegistration, location)
+
 	return dbBookActivityRegistration, nil
 }
 
-func (gameActivityRegistrationService *GameActivityRegistrationServiceImpl) CreateGameActivityRegistration(addRegistrationBody *AddGameActivityRegistrationBody, userId uint) (*models.GameActivityRegistration, error) {
+// Creates a game activity registration of the given user.
+// If deduplication is enabled, registering the same game twice on the same day of the given location
+// returns the existing registration.
+func (gameActivityRegistrationService *GameActivityRegistrationServiceImpl) CreateGameActivityRegistration(addRegistrationBody *AddGameActivityRegistrationBody, userId uint, location *time.Location) (*models.GameActivityRegistration, error) {
+	unlockUser := activityRegistrationCreationLocks.Lock(userId)
+	defer unlockUser()
+
+	if isRegistrationDeduplicationEnabled() {
+		dayStart, dayEnd := utils.LocationDayBounds(addRegistrationBody.RegistrationDate, location)
+		existingRegistration, getErr := gameActivityRegistrationService.gameRegistrationStorage.GetByUserIdGameNameAndInterval(userId, addRegistrationBody.GameName, dayStart, dayEnd)
+
+		if getErr == nil {
+			return existingRegistration.(*models.GameActivityRegistration), nil
+		}
+
+		var notFoundErr *models.DbNotFoundError
+		if !errors.As(getErr, &notFoundErr) {
+			return nil, getErr
+		}
+	}
+
+	registrationWritesLock.RLock()
+	defer registrationWritesLock.RUnlock()
 
 	dbActivityRegistration := &models.ActivityRegistration{
 		RegistrationDate: addRegistrationBody.RegistrationDate,
 		UserRefer:        userId,
+		Platform:         addRegistrationBody.Platform,
 	}
-	createActivityRegistrationErr := activityRegistrationStorage.Create(dbActivityRegistration)
+	createActivityRegistrationErr := gameActivityRegistrationService.activityRegistrationStorage.Create(dbActivityRegistration)
 
 	if createActivityRegistrationErr != nil {
 		return nil, createActivityRegistrationErr
@@ -118,11 +250,81 @@ func (gameActivityRegistrationService *GameActivityRegistrationServiceImpl) Crea
 		Registration: *dbActivityRegistration,
 	}
 
-	createGameActivityRegistrationErr := gameActivityRegistrationStorage.Create(dbGameActivityRegistration)
+	createGameActivityRegistrationErr := gameActivityRegistrationService.gameRegistrationStorage.Create(dbGameActivityRegistration)
 
 	if createGameActivityRegistrationErr != nil {
 		return nil, createGameActivityRegistrationErr
 	}
 
+	notifyActivityMilestone(gameActivityRegistrationService.activityRegistrationStorage, dbActivityRegistration, location)
+
 	return dbGameActivityRegistration, nil
 }
+
+// Updates the registration date and the Internet Archive identifier of a book activity registration.
+func (bookActivityRegistrationService *BookActivityRegistrationServiceImpl) UpdateBookActivityRegistration(id uint, updateRegistrationBody *UpdateBookActivityRegistrationBody) (*models.BookActivityRegistration, error) {
+	storedRegistration, getRegistrationErr := bookActivityRegistrationService.GetBookActivityRegistrationById(id)
+
+	if getRegistrationErr != nil {
+		return nil, getRegistrationErr
+	}
+
+	dbActivityRegistration := &models.ActivityRegistration{
+		Id:               storedRegistration.Registration.Id,
+		RegistrationDate: updateRegistrationBody.RegistrationDate,
+		UserRefer:        storedRegistration.Registration.UserRefer,
+		Platform:         storedRegistration.Registration.Platform,
+	}
+	updateActivityRegistrationErr := bookActivityRegistrationService.activityRegistrationStorage.Update(dbActivityRegistration)
+
+	if updateActivityRegistrationErr != nil {
+		return nil, updateActivityRegistrationErr
+	}
+
+	updatedBookRegistration := &models.BookActivityRegistration{
+		Id:                        id,
+		InternetArchiveIdentifier: updateRegistrationBody.InternetArchiveId,
+		Registration:              *dbActivityRegistration,
+	}
+	updateBookRegistrationErr := bookActivityRegistrationService.bookRegistrationStorage.Update(updatedBookRegistration)
+
+	if updateBookRegistrationErr != nil {
+		return nil, updateBookRegistrationErr
+	}
+
+	return updatedBookRegistration, nil
+}
+
+// Updates the registration date and the game name of a game activity registration.
+func (gameActivityRegistrationService *GameActivityRegistrationServiceImpl) UpdateGameActivityRegistration(id uint, updateRegistrationBody *UpdateGameActivityRegistrationBody) (*models.GameActivityRegistration, error) {
+	storedRegistration, getRegistrationErr := gameActivityRegistrationService.GetGameActivityRegistrationById(id)
+
+	if getRegistrationErr != nil {
+		return nil, getRegistrationErr
+	}
+
+	dbActivityRegistration := &models.ActivityRegistration{
+		Id:               storedRegistration.Registration.Id,
+		RegistrationDate: updateRegistrationBody.RegistrationDate,
+		UserRefer:        storedRegistration.Registration.UserRefer,
+		Platform:         storedRegistration.Registration.Platform,
+	}
+	updateActivityRegistrationErr := gameActivityRegistrationService.activityRegistrationStorage.Update(dbActivityRegistration)
+
+	if updateActivityRegistrationErr != nil {
+		return nil, updateActivityRegistrationErr
+	}
+
+	updatedGameRegistration := &models.GameActivityRegistration{
+		Id:           id,
+		GameName:     updateRegistrationBody.GameName,
+		Registration: *dbActivityRegistration,
+	}
+	updateGameRegistrationErr := gameActivityRegistrationService.gameRegistrationStorage.Update(updatedGameRegistration)
+
+	if updateGameRegistrationErr != nil {
+		return nil, updateGameRegistrationErr
+	}
+
+	return updatedGameRegistration, nil
+}
@@ -2,10 +2,13 @@ package services
 
 import (
 	"errors"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/adfer-dev/analock-api/constants"
 	"github.com/adfer-dev/analock-api/models"
+	"github.com/adfer-dev/analock-api/storage/memory"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -43,6 +46,19 @@ func (m *mockBookActivityRegistrationStorage) GetByUserIdAndTimeRange(userId uin
 	return filteredRegs, nil
 }
 
+func (m *mockBookActivityRegistrationStorage) GetByUserIdIdentifierAndTimeRange(userId uint, internetArchiveId string, startTime int64, endTime int64) (interface{}, error) {
+	if m.Err != nil {
+		return nil, m.Err
+	}
+	for _, reg := range m.Registrations[userId] {
+		if reg.InternetArchiveIdentifier == internetArchiveId &&
+			reg.Registration.RegistrationDate >= startTime && reg.Registration.RegistrationDate <= endTime {
+			return reg, nil
+		}
+	}
+	return nil, &models.DbNotFoundError{DbItem: &models.BookActivityRegistration{}}
+}
+
 func (m *mockBookActivityRegistrationStorage) Create(data interface{}) error {
 	if m.Err != nil {
 		return m.Err
@@ -56,6 +72,39 @@ func (m *mockBookActivityRegistrationStorage) Create(data interface{}) error {
 	return nil
 }
 
+func (m *mockBookActivityRegistrationStorage) Get(id uint) (interface{}, error) {
+	if m.Err != nil {
+		return nil, m.Err
+	}
+	for _, regs := range m.Registrations {
+		for _, reg := range regs {
+			if reg.Id == id {
+				return reg, nil
+			}
+		}
+	}
+	return nil, &models.DbNotFoundError{DbItem: &models.BookActivityRegistration{}}
+}
+
+func (m *mockBookActivityRegistrationStorage) Update(data interface{}) error {
+	if m.Err != nil {
+		return m.Err
+	}
+	updatedReg, ok := data.(*models.BookActivityRegistration)
+	if !ok {
+		return &models.DbCouldNotParseItemError{DbItem: &models.BookActivityRegistration{}}
+	}
+	for _, regs := range m.Registrations {
+		for index, reg := range regs {
+			if reg.Id == updatedReg.Id {
+				regs[index] = updatedReg
+				return nil
+			}
+		}
+	}
+	return &models.DbNotFoundError{DbItem: &models.BookActivityRegistration{}}
+}
+
 type mockGameActivityRegistrationStorage struct {
 	Registrations map[uint][]*models.GameActivityRegistration
 	Err           error
@@ -90,6 +139,19 @@ func (m *mockGameActivityRegistrationStorage) GetByUserIdAndInterval(userId uint
 	return filteredRegs, nil
 }
 
+func (m *mockGameActivityRegistrationStorage) GetByUserIdGameNameAndInterval(userId uint, gameName string, startDate int64, endDate int64) (interface{}, error) {
+	if m.Err != nil {
+		return nil, m.Err
+	}
+	for _, reg := range m.Registrations[userId] {
+		if reg.GameName == gameName &&
+			reg.Registration.RegistrationDate >= startDate && reg.Registration.RegistrationDate <= endDate {
+			return reg, nil
+		}
+	}
+	return nil, &models.DbNotFoundError{DbItem: &models.GameActivityRegistration{}}
+}
+
 func (m *mockGameActivityRegistrationStorage) Create(data interface{}) error {
 	if m.Err != nil {
 		return m.Err
@@ -102,10 +164,44 @@ func (m *mockGameActivityRegistrationStorage) Create(data interface{}) error {
 	return nil
 }
 
+func (m *mockGameActivityRegistrationStorage) Get(id uint) (interface{}, error) {
+	if m.Err != nil {
+		return nil, m.Err
+	}
+	for _, regs := range m.Registrations {
+		for _, reg := range regs {
+			if reg.Id == id {
+				return reg, nil
+			}
+		}
+	}
+	return nil, &models.DbNotFoundError{DbItem: &models.GameActivityRegistration{}}
+}
+
+func (m *mockGameActivityRegistrationStorage) Update(data interface{}) error {
+	if m.Err != nil {
+		return m.Err
+	}
+	updatedReg, ok := data.(*models.GameActivityRegistration)
+	if !ok {
+		return &models.DbCouldNotParseItemError{DbItem: &models.GameActivityRegistration{}}
+	}
+	for _, regs := range m.Registrations {
+		for index, reg := range regs {
+			if reg.Id == updatedReg.Id {
+				regs[index] = updatedReg
+				return nil
+			}
+		}
+	}
+	return &models.DbNotFoundError{DbItem: &models.GameActivityRegistration{}}
+}
+
 type mockActivityRegistrationStorage struct {
 	CreatedActivity *models.ActivityRegistration
 	UpdatedActivity *models.ActivityRegistration
 	DeletedId       uint
+	OrphanCount     int64
 	Err             error
 	UpdateErr       error
 	DeleteErr       error
@@ -143,17 +239,43 @@ func (m *mockActivityRegistrationStorage) Delete(id uint) error {
 	return nil
 }
 
-var bookRegistrationService BookActivityRegistrationService = &BookActivityRegistrationServiceImpl{}
-var gameRegistrationService GameActivityRegistrationService = &GameActivityRegistrationServiceImpl{}
+func (m *mockActivityRegistrationStorage) GetFeed(filter *models.ActivityFeedFilter) (interface{}, error) {
+	if m.Err != nil {
+		return nil, m.Err
+	}
+	return []*models.ActivityFeedItem{}, nil
+}
+
+func (m *mockActivityRegistrationStorage) CountFeed(filter *models.ActivityFeedFilter) (int64, error) {
+	if m.Err != nil {
+		return 0, m.Err
+	}
+	return 0, nil
+}
+
+func (m *mockActivityRegistrationStorage) CountByDay(userId uint, startTime int64, endTime int64, location *time.Location) (map[int64]int64, error) {
+	if m.Err != nil {
+		return nil, m.Err
+	}
+	return map[int64]int64{}, nil
+}
+
+func (m *mockActivityRegistrationStorage) DeleteOrphans() (int64, error) {
+	if m.DeleteErr != nil {
+		return 0, m.DeleteErr
+	}
+	deleted := m.OrphanCount
+	m.OrphanCount = 0
+	return deleted, nil
+}
 
 func TestGetUserBookActivityRegistrations(t *testing.T) {
-	originalBookStorage := bookActivityRegistrationStorage
+	t.Parallel()
+
 	mockStorage := &mockBookActivityRegistrationStorage{
 		Registrations: make(map[uint][]*models.BookActivityRegistration),
 	}
-	bookActivityRegistrationStorage = mockStorage // Temporally replace global storage with mock
-
-	defer func() { bookActivityRegistrationStorage = originalBookStorage }() // Restore original
+	bookRegistrationService := NewBookActivityRegistrationServiceImpl(mockStorage, &mockActivityRegistrationStorage{})
 
 	// Setup test data
 	userId := uint(1)
@@ -179,13 +301,12 @@ func TestGetUserBookActivityRegistrations(t *testing.T) {
 }
 
 func TestGetUserGameActivityRegistrations(t *testing.T) {
-	originalGameStorage := gameActivityRegistrationStorage
+	t.Parallel()
+
 	mockStorage := &mockGameActivityRegistrationStorage{
 		Registrations: make(map[uint][]*models.GameActivityRegistration),
 	}
-	gameActivityRegistrationStorage = mockStorage
-
-	defer func() { gameActivityRegistrationStorage = originalGameStorage }()
+	gameRegistrationService := NewGameActivityRegistrationServiceImpl(mockStorage, &mockActivityRegistrationStorage{})
 
 	userId := uint(1)
 	expectedRegs := []*models.GameActivityRegistration{
@@ -206,12 +327,12 @@ func TestGetUserGameActivityRegistrations(t *testing.T) {
 }
 
 func TestGetUserBookActivityRegistrationsTimeRange(t *testing.T) {
-	originalBookStorage := bookActivityRegistrationStorage
+	t.Parallel()
+
 	mockStorage := &mockBookActivityRegistrationStorage{
 		Registrations: make(map[uint][]*models.BookActivityRegistration),
 	}
-	bookActivityRegistrationStorage = mockStorage
-	defer func() { bookActivityRegistrationStorage = originalBookStorage }()
+	bookRegistrationService := NewBookActivityRegistrationServiceImpl(mockStorage, &mockActivityRegistrationStorage{})
 
 	userId := uint(1)
 	now := time.Now().Unix()
@@ -233,12 +354,12 @@ func TestGetUserBookActivityRegistrationsTimeRange(t *testing.T) {
 }
 
 func TestGetUserGameActivityRegistrationsTimeRange(t *testing.T) {
-	originalGameStorage := gameActivityRegistrationStorage
+	t.Parallel()
+
 	mockStorage := &mockGameActivityRegistrationStorage{
 		Registrations: make(map[uint][]*models.GameActivityRegistration),
 	}
-	gameActivityRegistrationStorage = mockStorage
-	defer func() { gameActivityRegistrationStorage = originalGameStorage }()
+	gameRegistrationService := NewGameActivityRegistrationServiceImpl(mockStorage, &mockActivityRegistrationStorage{})
 
 	userId := uint(1)
 	now := time.Now().Unix()
@@ -259,35 +380,30 @@ func TestGetUserGameActivityRegistrationsTimeRange(t *testing.T) {
 }
 
 func TestCreateBookActivityRegistration(t *testing.T) {
-	originalBookStorage := bookActivityRegistrationStorage
-	originalActivityStorage := activityRegistrationStorage
+	t.Parallel()
 
 	mockBookStore := &mockBookActivityRegistrationStorage{
 		Registrations: make(map[uint][]*models.BookActivityRegistration),
 	}
 	mockActivityStore := &mockActivityRegistrationStorage{}
 
-	bookActivityRegistrationStorage = mockBookStore
-	activityRegistrationStorage = mockActivityStore
-
-	defer func() {
-		bookActivityRegistrationStorage = originalBookStorage
-		activityRegistrationStorage = originalActivityStorage
-	}()
+	bookRegistrationService := NewBookActivityRegistrationServiceImpl(mockBookStore, mockActivityStore)
 
 	addRegBody := &AddBookActivityRegistrationBody{
 		InternetArchiveId: "test_ia_id",
 		RegistrationDate:  time.Now().Unix(),
+		Platform:          "android",
 	}
 
 	userRefer := uint(1)
-	createdReg, err := bookRegistrationService.CreateBookActivityRegistration(addRegBody, userRefer)
+	createdReg, err := bookRegistrationService.CreateBookActivityRegistration(addRegBody, userRefer, time.UTC)
 
 	assert.NoError(t, err)
 	assert.NotNil(t, createdReg)
 	assert.Equal(t, addRegBody.InternetArchiveId, createdReg.InternetArchiveIdentifier)
 	assert.Equal(t, addRegBody.RegistrationDate, createdReg.Registration.RegistrationDate)
 	assert.Equal(t, userRefer, createdReg.Registration.UserRefer)
+	assert.Equal(t, addRegBody.Platform, createdReg.Registration.Platform)
 
 	// Assert that the generic activity registration was also "created"
 	assert.NotNil(t, mockActivityStore.CreatedActivity)
@@ -296,47 +412,42 @@ func TestCreateBookActivityRegistration(t *testing.T) {
 
 	// Test case: Error during activity registration creation
 	mockActivityStore.Err = assert.AnError
-	_, err = bookRegistrationService.CreateBookActivityRegistration(addRegBody, userRefer)
+	_, err = bookRegistrationService.CreateBookActivityRegistration(addRegBody, userRefer, time.UTC)
 	assert.Error(t, err)
 	mockActivityStore.Err = nil // Reset error
 
 	// Test case: Error during book activity registration creation
 	mockBookStore.Err = assert.AnError
-	_, err = bookRegistrationService.CreateBookActivityRegistration(addRegBody, userRefer)
+	_, err = bookRegistrationService.CreateBookActivityRegistration(addRegBody, userRefer, time.UTC)
 	assert.Error(t, err)
 	mockBookStore.Err = nil // Reset error
 }
 
 func TestCreateGameActivityRegistration(t *testing.T) {
-	originalGameStorage := gameActivityRegistrationStorage
-	originalActivityStorage := activityRegistrationStorage
+	t.Parallel()
 
 	mockGameStore := &mockGameActivityRegistrationStorage{
 		Registrations: make(map[uint][]*models.GameActivityRegistration),
 	}
 	mockActivityStore := &mockActivityRegistrationStorage{}
 
-	gameActivityRegistrationStorage = mockGameStore
-	activityRegistrationStorage = mockActivityStore
-
-	defer func() {
-		gameActivityRegistrationStorage = originalGameStorage
-		activityRegistrationStorage = originalActivityStorage
-	}()
+	gameRegistrationService := NewGameActivityRegistrationServiceImpl(mockGameStore, mockActivityStore)
 
 	addRegBody := &AddGameActivityRegistrationBody{
 		GameName:         "test_game",
 		RegistrationDate: time.Now().Unix(),
+		Platform:         "ios",
 	}
 	userRefer := uint(1)
 
-	createdReg, err := gameRegistrationService.CreateGameActivityRegistration(addRegBody, userRefer)
+	createdReg, err := gameRegistrationService.CreateGameActivityRegistration(addRegBody, userRefer, time.UTC)
 
 	assert.NoError(t, err)
 	assert.NotNil(t, createdReg)
 	assert.Equal(t, addRegBody.GameName, createdReg.GameName)
 	assert.Equal(t, addRegBody.RegistrationDate, createdReg.Registration.RegistrationDate)
 	assert.Equal(t, userRefer, createdReg.Registration.UserRefer)
+	assert.Equal(t, addRegBody.Platform, createdReg.Registration.Platform)
 
 	assert.NotNil(t, mockActivityStore.CreatedActivity)
 	assert.Equal(t, addRegBody.RegistrationDate, mockActivityStore.CreatedActivity.RegistrationDate)
@@ -344,13 +455,217 @@ func TestCreateGameActivityRegistration(t *testing.T) {
 
 	// Test case: Error during activity registration creation
 	mockActivityStore.Err = assert.AnError
-	_, err = gameRegistrationService.CreateGameActivityRegistration(addRegBody, userRefer)
+	_, err = gameRegistrationService.CreateGameActivityRegistration(addRegBody, userRefer, time.UTC)
 	assert.Error(t, err)
 	mockActivityStore.Err = nil
 
 	// Test case: Error during game activity registration creation
 	mockGameStore.Err = assert.AnError
-	_, err = gameRegistrationService.CreateGameActivityRegistration(addRegBody, userRefer)
+	_, err = gameRegistrationService.CreateGameActivityRegistration(addRegBody, userRefer, time.UTC)
 	assert.Error(t, err)
 	mockGameStore.Err = nil
 }
+
+func TestUpdateBookActivityRegistration(t *testing.T) {
+	t.Parallel()
+
+	userRefer := uint(1)
+	mockBookStore := &mockBookActivityRegistrationStorage{
+		Registrations: map[uint][]*models.BookActivityRegistration{
+			userRefer: {{Id: 5, InternetArchiveIdentifier: "ia_id1", Registration: models.ActivityRegistration{Id: 10, RegistrationDate: 100, UserRefer: userRefer, Platform: "web"}}},
+		},
+	}
+	mockActivityStore := &mockActivityRegistrationStorage{}
+
+	bookRegistrationService := NewBookActivityRegistrationServiceImpl(mockBookStore, mockActivityStore)
+
+	updateBody := &UpdateBookActivityRegistrationBody{InternetArchiveId: "ia_id2", RegistrationDate: 200}
+
+	updatedReg, err := bookRegistrationService.UpdateBookActivityRegistration(5, updateBody)
+
+	assert.NoError(t, err)
+	assert.Equal(t, uint(5), updatedReg.Id)
+	assert.Equal(t, "ia_id2", updatedReg.InternetArchiveIdentifier)
+	assert.Equal(t, int64(200), updatedReg.Registration.RegistrationDate)
+	assert.Equal(t, userRefer, updatedReg.Registration.UserRefer)
+	assert.Equal(t, "web", updatedReg.Registration.Platform)
+	assert.Equal(t, uint(10), mockActivityStore.UpdatedActivity.Id)
+	assert.Equal(t, int64(200), mockActivityStore.UpdatedActivity.RegistrationDate)
+	assert.Equal(t, "ia_id2", mockBookStore.Registrations[userRefer][0].InternetArchiveIdentifier)
+
+	// Test case: Registration not found
+	_, err = bookRegistrationService.UpdateBookActivityRegistration(99, updateBody)
+	assert.IsType(t, &models.DbNotFoundError{}, err)
+
+	// Test case: Error during activity registration update
+	mockActivityStore.UpdateErr = assert.AnError
+	_, err = bookRegistrationService.UpdateBookActivityRegistration(5, updateBody)
+	assert.ErrorIs(t, err, assert.AnError)
+	mockActivityStore.UpdateErr = nil
+}
+
+func TestUpdateGameActivityRegistration(t *testing.T) {
+	t.Parallel()
+
+	userRefer := uint(1)
+	mockGameStore := &mockGameActivityRegistrationStorage{
+		Registrations: map[uint][]*models.GameActivityRegistration{
+			userRefer: {{Id: 5, GameName: "sudoku", Registration: models.ActivityRegistration{Id: 10, RegistrationDate: 100, UserRefer: userRefer}}},
+		},
+	}
+	mockActivityStore := &mockActivityRegistrationStorage{}
+
+	gameRegistrationService := NewGameActivityRegistrationServiceImpl(mockGameStore, mockActivityStore)
+
+	updateBody := &UpdateGameActivityRegistrationBody{GameName: "chess", RegistrationDate: 200}
+
+	updatedReg, err := gameRegistrationService.UpdateGameActivityRegistration(5, updateBody)
+
+	assert.NoError(t, err)
+	assert.Equal(t, uint(5), updatedReg.Id)
+	assert.Equal(t, "chess", updatedReg.GameName)
+	assert.Equal(t, int64(200), updatedReg.Registration.RegistrationDate)
+	assert.Equal(t, uint(10), mockActivityStore.UpdatedActivity.Id)
+	assert.Equal(t, "chess", mockGameStore.Registrations[userRefer][0].GameName)
+
+	// Test case: Registration not found
+	_, err = gameRegistrationService.UpdateGameActivityRegistration(99, updateBody)
+	assert.IsType(t, &models.DbNotFoundError{}, err)
+
+	// Test case: Error during game activity registration update
+	mockGameStore.Err = assert.AnError
+	_, err = gameRegistrationService.UpdateGameActivityRegistration(5, updateBody)
+	assert.ErrorIs(t, err, assert.AnError)
+	mockGameStore.Err = nil
+}
+
+func TestCreateBookActivityRegistrationDeduplication(t *testing.T) {
+	mockBookStore := &mockBookActivityRegistrationStorage{
+		Registrations: make(map[uint][]*models.BookActivityRegistration),
+	}
+	bookRegistrationService := NewBookActivityRegistrationServiceImpl(mockBookStore, &mockActivityRegistrationStorage{})
+
+	t.Setenv("API_DEDUPLICATE_ACTIVITY_REGISTRATIONS", "true")
+
+	userRefer := uint(1)
+	dayStart := int64(1700006400) // 2023-11-15T00:00:00Z
+	addRegBody := &AddBookActivityRegistrationBody{InternetArchiveId: "test_ia_id", RegistrationDate: dayStart + 1}
+
+	createdReg, err := bookRegistrationService.CreateBookActivityRegistration(addRegBody, userRefer, time.UTC)
+	assert.NoError(t, err)
+
+	// Test case: Same book on the same day returns the existing registration
+	sameDayBody := &AddBookActivityRegistrationBody{InternetArchiveId: "test_ia_id", RegistrationDate: dayStart + constants.DaySeconds - 1}
+	duplicateReg, err := bookRegistrationService.CreateBookActivityRegistration(sameDayBody, userRefer, time.UTC)
+	assert.NoError(t, err)
+	assert.Same(t, createdReg, duplicateReg)
+	assert.Len(t, mockBookStore.Registrations[userRefer], 1)
+
+	// Test case: Same book on a different day is created
+	nextDayBody := &AddBookActivityRegistrationBody{InternetArchiveId: "test_ia_id", RegistrationDate: dayStart + constants.DaySeconds}
+	nextDayReg, err := bookRegistrationService.CreateBookActivityRegistration(nextDayBody, userRefer, time.UTC)
+	assert.NoError(t, err)
+	assert.NotSame(t, createdReg, nextDayReg)
+	assert.Len(t, mockBookStore.Registrations[userRefer], 2)
+
+	// Test case: Duplicates are created when deduplication is disabled
+	t.Setenv("API_DEDUPLICATE_ACTIVITY_REGISTRATIONS", "false")
+	_, err = bookRegistrationService.CreateBookActivityRegistration(sameDayBody, userRefer, time.UTC)
+	assert.NoError(t, err)
+	assert.Len(t, mockBookStore.Registrations[userRefer], 3)
+}
+
+func TestCreateGameActivityRegistrationDeduplication(t *testing.T) {
+	mockGameStore := &mockGameActivityRegistrationStorage{
+		Registrations: make(map[uint][]*models.GameActivityRegistration),
+	}
+	gameRegistrationService := NewGameActivityRegistrationServiceImpl(mockGameStore, &mockActivityRegistrationStorage{})
+
+	t.Setenv("API_DEDUPLICATE_ACTIVITY_REGISTRATIONS", "true")
+
+	userRefer := uint(1)
+	dayStart := int64(1700006400) // 2023-11-15T00:00:00Z
+	addRegBody := &AddGameActivityRegistrationBody{GameName: "test_game", RegistrationDate: dayStart}
+
+	createdReg, err := gameRegistrationService.CreateGameActivityRegistration(addRegBody, userRefer, time.UTC)
+	assert.NoError(t, err)
+
+	// Test case: Same game on the same day returns the existing registration
+	sameDayBody := &AddGameActivityRegistrationBody{GameName: "test_game", RegistrationDate: dayStart + 3600}
+	duplicateReg, err := gameRegistrationService.CreateGameActivityRegistration(sameDayBody, userRefer, time.UTC)
+	assert.NoError(t, err)
+	assert.Same(t, createdReg, duplicateReg)
+	assert.Len(t, mockGameStore.Registrations[userRefer], 1)
+
+	// Test case: Same game on the previous day is created
+	previousDayBody := &AddGameActivityRegistrationBody{GameName: "test_game", RegistrationDate: dayStart - 1}
+	_, err = gameRegistrationService.CreateGameActivityRegistration(previousDayBody, userRefer, time.UTC)
+	assert.NoError(t, err)
+	assert.Len(t, mockGameStore.Registrations[userRefer], 2)
+
+	// Test case: The day is taken in the given timezone, so registrations on different UTC days can be the same day
+	madrid, _ := time.LoadLocation("Europe/Madrid")
+	lateBody := &AddGameActivityRegistrationBody{GameName: "madrid_game", RegistrationDate: time.Date(2024, time.March, 10, 23, 30, 0, 0, time.UTC).Unix()}
+	earlyBody := &AddGameActivityRegistrationBody{GameName: "madrid_game", RegistrationDate: time.Date(2024, time.March, 11, 0, 30, 0, 0, time.UTC).Unix()}
+	lateReg, err := gameRegistrationService.CreateGameActivityRegistration(lateBody, userRefer, madrid)
+	assert.NoError(t, err)
+	earlyReg, err := gameRegistrationService.CreateGameActivityRegistration(earlyBody, userRefer, madrid)
+	assert.NoError(t, err)
+	assert.Same(t, lateReg, earlyReg)
+	assert.Len(t, mockGameStore.Registrations[userRefer], 3)
+
+	// Test case: Lookup errors other than not found are returned
+	mockGameStore.Err = assert.AnError
+	_, err = gameRegistrationService.CreateGameActivityRegistration(addRegBody, userRefer, time.UTC)
+	assert.ErrorIs(t, err, assert.AnError)
+}
+
+// Game registration storage that is slow to answer the reads of the deduplication check.
+type slowCheckGameRegistrationStorage struct {
+	*memory.GameActivityRegistrationStorage
+}
+
+func (storage *slowCheckGameRegistrationStorage) GetByUserIdGameNameAndInterval(userId uint, gameName string, startDate int64, endDate int64) (interface{}, error) {
+	registration, err := storage.GameActivityRegistrationStorage.GetByUserIdGameNameAndInterval(userId, gameName, startDate, endDate)
+
+	// Widens the window between the deduplication check and the registration creation
+	time.Sleep(time.Millisecond)
+
+	return registration, err
+}
+
+func TestCreateGameActivityRegistrationDeduplicationConcurrent(t *testing.T) {
+	database := memory.NewDatabase()
+	gameStorage := &slowCheckGameRegistrationStorage{GameActivityRegistrationStorage: memory.NewGameActivityRegistrationStorage(database)}
+	gameRegistrationService := NewGameActivityRegistrationServiceImpl(gameStorage, memory.NewActivityRegistrationStorage(database))
+
+	t.Setenv("API_DEDUPLICATE_ACTIVITY_REGISTRATIONS", "true")
+
+	userRefer := uint(1)
+	addRegBody := &AddGameActivityRegistrationBody{GameName: "test_game", RegistrationDate: 1700006400}
+
+	var waitGroup sync.WaitGroup
+	createdRegs := make([]*models.GameActivityRegistration, 2)
+
+	for i := range createdRegs {
+		waitGroup.Add(1)
+		go func() {
+			defer waitGroup.Done()
+			createdReg, err := gameRegistrationService.CreateGameActivityRegistration(addRegBody, userRefer, time.UTC)
+			assert.NoError(t, err)
+			createdRegs[i] = createdReg
+		}()
+	}
+	waitGroup.Wait()
+
+	// Test case: Concurrent creations of the same registration store a single one
+	userRegs, err := gameStorage.GetByUserId(userRefer)
+	assert.NoError(t, err)
+	assert.Len(t, userRegs, 1)
+	assert.Equal(t, createdRegs[0].Id, createdRegs[1].Id)
+
+	// Test case: The lock of the user is released
+	activityRegistrationCreationLocks.lock.Lock()
+	defer activityRegistrationCreationLocks.lock.Unlock()
+	assert.NotContains(t, activityRegistrationCreationLocks.locks, userRefer)
+}
@@ -1,19 +1,29 @@
 package services
 
 import (
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
 	"errors"
 	"fmt"
-	"log"
+	"math/big"
 	"net/http"
+	"net/url"
+	"strings"
+	"time"
 
 	"github.com/adfer-dev/analock-api/auth"
+	"github.com/adfer-dev/analock-api/config"
 	"github.com/adfer-dev/analock-api/constants"
 	"github.com/adfer-dev/analock-api/models"
+	"github.com/adfer-dev/analock-api/utils"
+	"github.com/golang-jwt/jwt"
 )
 
 // AuthService struct
 type AuthService struct {
 	googleValidator GoogleTokenValidator
+	appleValidator  AppleTokenValidator
 	AppTokenManager auth.TokenManager
 	userService     UserService
 	tokenService    TokenService
@@ -23,6 +33,7 @@ type AuthService struct {
 // AuthService constructor
 func NewAuthService(
 	googleValidator GoogleTokenValidator,
+	appleValidator AppleTokenValidator,
 	appTokenManager auth.TokenManager,
 	userService UserService,
 	tokenService TokenService,
@@ -30,6 +41,7 @@ func NewAuthService(
 ) *AuthService {
 	return &AuthService{
 		googleValidator: googleValidator,
+		appleValidator:  appleValidator,
 		AppTokenManager: appTokenManager,
 		userService:     userService,
 		tokenService:    tokenService,
@@ -43,11 +55,33 @@ type UserAuthenticateBody struct {
 	UserName      string `json:"userName" validate:"required"`
 	ProviderId    string `json:"providerId" validate:"required"`
 	ProviderToken string `json:"providerToken" validate:"required,jwt"`
+	InviteCode    string `json:"inviteCode,omitempty"`
 }
 
 type TokenResponse struct {
-	AccessToken  string `json:"accessToken"`
-	RefreshToken string `json:"refreshToken"`
+	AccessToken  string               `json:"accessToken"`
+	RefreshToken string               `json:"refreshToken"`
+	User         *UserProfileResponse `json:"user,omitempty"`
+}
+
+// Profile of the authenticated user, holding only the fields the client needs.
+type UserProfileResponse struct {
+	Id            uint            `json:"id"`
+	Email         string          `json:"email"`
+	UserName      string          `json:"userName"`
+	Role          models.UserRole `json:"role"`
+	EmailVerified bool            `json:"emailVerified"`
+}
+
+// Builds the profile of the given user.
+func NewUserProfileResponse(user *models.User) *UserProfileResponse {
+	return &UserProfileResponse{
+		Id:            user.Id,
+		Email:         user.Email,
+		UserName:      user.UserName,
+		Role:          user.Role,
+		EmailVerified: user.EmailVerified,
+	}
 }
 
 type RefreshTokenRequest struct {
@@ -58,32 +92,83 @@ type RefreshTokenResponse struct {
 	Token string `json:"token"`
 }
 
+type ImpersonationResponse struct {
+	AccessToken    string `json:"accessToken"`
+	UserId         uint   `json:"userId"`
+	ImpersonatedBy uint   `json:"impersonatedBy"`
+	// Unix seconds.
+	ExpiresAt int64 `json:"expiresAt"`
+}
+
+type UpdateExternalLoginTokenBody struct {
+	ProviderToken string `json:"providerToken" validate:"required,jwt"`
+}
+
+type ExternalLoginResponse struct {
+	Provider models.LoginProvider `json:"provider"`
+	UserId   uint                 `json:"userId"`
+}
+
+type LinkProviderBody struct {
+	Provider      string `json:"provider" validate:"required" example:"apple"`
+	ProviderId    string `json:"providerId" validate:"required"`
+	ProviderToken string `json:"providerToken" validate:"required,jwt"`
+}
+
+type LinkedProvidersResponse struct {
+	Providers []string `json:"providers" example:"google,apple"`
+}
+
 // AuthService methods
-func (authService *AuthService) AuthenticateUser(authBody UserAuthenticateBody) (*models.Token, *models.Token, error) {
-	googleValidateErr := authService.validateGoogleToken(authBody.ProviderToken)
+// Authenticates a user with the given provider token, creating the user if it does not exist yet.
+// Returns the access and refresh tokens along with the authenticated user,
+// or ErrProviderTokenInvalid if the provider rejects the token.
+// When sign-up is disabled, new users are only created with a valid invite code;
+// otherwise ErrSignupClosed or ErrInviteCodeInvalid is returned.
+func (authService *AuthService) AuthenticateUser(authBody UserAuthenticateBody) (*models.Token, *models.Token, *models.User, error) {
+	tokenInfo, googleValidateErr := authService.validateGoogleToken(authBody.ProviderToken)
 	if googleValidateErr != nil {
-		return nil, nil, googleValidateErr
+		return nil, nil, nil, googleValidateErr
 	}
 
+	// The email is only verified if it is the one Google asserts, not just any the client sent
+	emailVerified := tokenInfo.EmailVerified && strings.EqualFold(tokenInfo.Email, authBody.Email)
 	user, getUserErr := authService.userService.GetUserByEmail(authBody.Email)
 
 	if getUserErr == nil {
+		if emailVerified && !user.EmailVerified {
+			if verifyErr := authService.userService.MarkEmailVerified(user.Id); verifyErr != nil {
+				return nil, nil, nil, verifyErr
+			}
+			user.EmailVerified = true
+		}
+
 		externalLogin := &UpdateExternalLoginBody{
+			Provider:    models.Google,
 			ClientToken: authBody.ProviderToken,
 		}
 		_, saveExternalLoginError := authService.extLoginService.UpdateUserExternalLoginToken(user.Id, externalLogin)
 		if saveExternalLoginError != nil {
-			return nil, nil, saveExternalLoginError
+			return nil, nil, nil, saveExternalLoginError
 		}
-		return authService.updateTokenPair(user)
+		accessToken, refreshToken, tokenErr := authService.updateTokenPair(user)
+		if tokenErr != nil {
+			return nil, nil, nil, tokenErr
+		}
+		return accessToken, refreshToken, user, nil
 	} else {
+		if signupErr := checkSignupAllowed(authBody.InviteCode); signupErr != nil {
+			return nil, nil, nil, signupErr
+		}
+
 		userBody := UserBody{
-			Email:    authBody.Email,
-			UserName: authBody.UserName,
+			Email:         authBody.Email,
+			UserName:      authBody.UserName,
+			EmailVerified: emailVerified,
 		}
 		savedUser, saveUserError := authService.userService.SaveUser(userBody)
 		if saveUserError != nil {
-			return nil, nil, saveUserError
+			return nil, nil, nil, saveUserError
 		}
 
 		externalLogin := &models.ExternalLogin{
@@ -95,30 +180,81 @@ func (authService *AuthService) AuthenticateUser(authBody UserAuthenticateBody)
 		_, saveExternalLoginError := authService.extLoginService.SaveExternalLogin(externalLogin)
 		if saveExternalLoginError != nil {
 			// Consider rolling back user creation or logging, for now, return error
-			return nil, nil, saveExternalLoginError
+			return nil, nil, nil, saveExternalLoginError
+		}
+		accessToken, refreshToken, tokenErr := authService.generateAndSaveTokenPair(savedUser)
+		if tokenErr != nil {
+			return nil, nil, nil, tokenErr
 		}
-		return authService.generateAndSaveTokenPair(savedUser)
+		return accessToken, refreshToken, savedUser, nil
 	}
 }
 
+// Checks whether a new user can sign up with the given invite code.
+// Anyone can sign up unless signup is disabled in the config, in which case only its invite codes are accepted.
+func checkSignupAllowed(inviteCode string) error {
+	signupConfig := config.Get().Signup
+
+	if signupConfig.Enabled {
+		return nil
+	}
+
+	if len(inviteCode) == 0 {
+		return ErrSignupClosed
+	}
+
+	for _, validCode := range signupConfig.InviteCodes {
+		if utils.SecureCompare(inviteCode, validCode) {
+			return nil
+		}
+	}
+
+	return ErrInviteCodeInvalid
+}
+
+// Generates a new access token for the user the given refresh token belongs to, recording the refresh token use.
+// Returns ErrInvalidToken if the refresh token is not valid or was revoked and ErrUserNotFound if its user does not exist.
 func (authService *AuthService) RefreshToken(request RefreshTokenRequest) (*RefreshTokenResponse, error) {
 	validationErr := authService.AppTokenManager.ValidateToken(request.RefreshToken)
 	if validationErr != nil {
-		return nil, validationErr
+		var jwtValidationErr *jwt.ValidationError
+
+		if errors.As(validationErr, &jwtValidationErr) && jwtValidationErr.Errors == jwt.ValidationErrorExpired {
+			return nil, fmt.Errorf("%w: %w", ErrRefreshTokenExpired, validationErr)
+		}
+
+		return nil, fmt.Errorf("%w: %w", ErrInvalidToken, validationErr)
 	}
 
 	claims, claimsErr := authService.AppTokenManager.GetClaims(request.RefreshToken)
 	if claimsErr != nil {
-		return nil, claimsErr
+		return nil, fmt.Errorf("%w: %w", ErrInvalidToken, claimsErr)
+	}
+
+	userId, userIdErr := utils.UserIDFromClaims(claims)
+
+	if userIdErr != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidToken, userIdErr)
 	}
 
-	userId, ok := claims["sub"].(float64)
+	var notFoundErr *models.DbNotFoundError
+
+	// A refresh token that is no longer stored belongs to a revoked session
+	dbRefreshToken, getDbRefreshTokenErr := authService.tokenService.GetTokenByValue(request.RefreshToken)
+
+	if errors.As(getDbRefreshTokenErr, &notFoundErr) {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidToken, getDbRefreshTokenErr)
+	}
 
-	if !ok {
-		return nil, errors.New("user id is not a number or not found")
+	if getDbRefreshTokenErr != nil {
+		return nil, getDbRefreshTokenErr
 	}
 
-	user, getUserErr := authService.userService.GetUserById(uint(userId))
+	user, getUserErr := authService.userService.GetUserById(userId)
+
+	if errors.As(getUserErr, &notFoundErr) {
+		return nil, fmt.Errorf("%w: %w", ErrUserNotFound, getUserErr)
+	}
 
 	if getUserErr != nil {
 		return nil, getUserErr
@@ -129,18 +265,36 @@ func (authService *AuthService) RefreshToken(request RefreshTokenRequest) (*Refr
 		return nil, accessTokenErr
 	}
 
-	dbAccessToken, getDbAccessTokenErr := authService.tokenService.GetUserTokenByKind(user.Id, models.Access)
-	if getDbAccessTokenErr != nil {
-		return nil, getDbAccessTokenErr
+	now := time.Now().Unix()
+
+	if touchErr := authService.tokenService.UpdateTokenLastUsedAt(dbRefreshToken.Id, now); touchErr != nil {
+		return nil, touchErr
 	}
 
 	accessToken := &models.Token{
-		Id:         dbAccessToken.Id,
 		TokenValue: accessTokenString,
 		Kind:       models.Access,
 		UserRefer:  user.Id,
+		CreatedAt:  now,
 	}
 
+	dbAccessToken, getDbAccessTokenErr := authService.tokenService.GetUserTokenByKind(user.Id, models.Access)
+
+	// The access token row may have been removed while the refresh token is still valid, so a new one is stored
+	if errors.As(getDbAccessTokenErr, &notFoundErr) {
+		if _, saveAccessTokenErr := authService.tokenService.SaveToken(accessToken); saveAccessTokenErr != nil {
+			return nil, saveAccessTokenErr
+		}
+
+		return &RefreshTokenResponse{Token: accessToken.TokenValue}, nil
+	}
+
+	if getDbAccessTokenErr != nil {
+		return nil, getDbAccessTokenErr
+	}
+
+	accessToken.Id = dbAccessToken.Id
+
 	_, saveAccessTokenErr := authService.tokenService.UpdateToken(accessToken)
 	if saveAccessTokenErr != nil {
 		return nil, saveAccessTokenErr
@@ -149,15 +303,273 @@ func (authService *AuthService) RefreshToken(request RefreshTokenRequest) (*Refr
 	return &RefreshTokenResponse{Token: accessToken.TokenValue}, nil
 }
 
+// Gets the sessions of the given user, which are its refresh tokens without their values.
+// A user only has one refresh token, so at most one session is returned.
+func (authService *AuthService) GetUserSessions(userId uint) ([]*models.Session, error) {
+	refreshToken, getRefreshTokenErr := authService.tokenService.GetUserTokenByKind(userId, models.Refresh)
+
+	var notFoundErr *models.DbNotFoundError
+	if errors.As(getRefreshTokenErr, &notFoundErr) {
+		return []*models.Session{}, nil
+	}
+
+	if getRefreshTokenErr != nil {
+		return nil, getRefreshTokenErr
+	}
+
+	return []*models.Session{{
+		Id:         refreshToken.Id,
+		CreatedAt:  refreshToken.CreatedAt,
+		LastUsedAt: refreshToken.LastUsedAt,
+	}}, nil
+}
+
+// Revokes the session with the given id, deleting its refresh token along with the user's access token.
+// Returns ErrSessionNotFound if the user has no session with that id.
+func (authService *AuthService) RevokeUserSession(userId uint, sessionId uint) error {
+	refreshToken, getRefreshTokenErr := authService.tokenService.GetTokenById(sessionId)
+
+	var notFoundErr *models.DbNotFoundError
+	if errors.As(getRefreshTokenErr, &notFoundErr) {
+		return ErrSessionNotFound
+	}
+
+	if getRefreshTokenErr != nil {
+		return getRefreshTokenErr
+	}
+
+	if refreshToken.UserRefer != userId || refreshToken.Kind != models.Refresh {
+		return ErrSessionNotFound
+	}
+
+	if deleteErr := authService.tokenService.DeleteToken(refreshToken.Id); deleteErr != nil {
+		return deleteErr
+	}
+
+	accessToken, getAccessTokenErr := authService.tokenService.GetUserTokenByKind(userId, models.Access)
+
+	if errors.As(getAccessTokenErr, &notFoundErr) {
+		return nil
+	}
+
+	if getAccessTokenErr != nil {
+		return getAccessTokenErr
+	}
+
+	return authService.tokenService.DeleteToken(accessToken.Id)
+}
+
+// Logs the given user out, deleting its token pair. The access token is deleted with a grace period,
+// so the requests in flight when logging out can still read.
+func (authService *AuthService) LogOutUser(userId uint) error {
+	tokenPair, getTokenPairErr := authService.tokenService.GetUserTokenPair(userId)
+
+	var notFoundErr *models.DbNotFoundError
+	if errors.As(getTokenPairErr, &notFoundErr) {
+		return nil
+	}
+
+	if getTokenPairErr != nil {
+		return getTokenPairErr
+	}
+
+	for _, token := range tokenPair {
+		if token == nil {
+			continue
+		}
+
+		deleteToken := authService.tokenService.DeleteToken
+
+		if token.Kind == models.Access {
+			deleteToken = authService.tokenService.DeleteTokenWithGracePeriod
+		}
+
+		if deleteErr := deleteToken(token.Id); deleteErr != nil {
+			return deleteErr
+		}
+	}
+
+	return nil
+}
+
+// Issues a short-lived access token of the given user to the given admin, replacing the previous one issued for that user.
+// Returns ErrUserNotFound if the user does not exist and ErrImpersonationNotAllowed if the user is an admin.
+func (authService *AuthService) ImpersonateUser(adminId uint, userId uint) (*ImpersonationResponse, error) {
+	user, getUserErr := authService.userService.GetUserById(userId)
+
+	var notFoundErr *models.DbNotFoundError
+	if errors.As(getUserErr, &notFoundErr) {
+		return nil, fmt.Errorf("%w: %w", ErrUserNotFound, getUserErr)
+	}
+
+	if getUserErr != nil {
+		return nil, getUserErr
+	}
+
+	// Impersonating an admin would let the token be used on admin endpoints
+	if user.Role == models.Admin {
+		return nil, ErrImpersonationNotAllowed
+	}
+
+	now := time.Now()
+	ttl := config.Get().ImpersonationTokenTtl
+	tokenString, generateErr := authService.AppTokenManager.GenerateImpersonationToken(*user, adminId, ttl)
+
+	if generateErr != nil {
+		return nil, generateErr
+	}
+
+	token := &models.Token{
+		TokenValue: tokenString,
+		Kind:       models.Impersonation,
+		UserRefer:  user.Id,
+		CreatedAt:  now.Unix(),
+	}
+
+	previousToken, getPreviousTokenErr := authService.tokenService.GetUserTokenByKind(user.Id, models.Impersonation)
+
+	if errors.As(getPreviousTokenErr, &notFoundErr) {
+		_, saveErr := authService.tokenService.SaveToken(token)
+
+		if saveErr != nil {
+			return nil, saveErr
+		}
+	} else if getPreviousTokenErr != nil {
+		return nil, getPreviousTokenErr
+	} else {
+		token.Id = previousToken.Id
+
+		if _, updateErr := authService.tokenService.UpdateToken(token); updateErr != nil {
+			return nil, updateErr
+		}
+	}
+
+	expiresAt := now.Add(ttl)
+	utils.GetCustomLogger().Infof(
+		"Audit: admin %d impersonated user %d until %s\n",
+		adminId,
+		user.Id,
+		expiresAt.UTC().Format(time.RFC3339),
+	)
+
+	return &ImpersonationResponse{
+		AccessToken:    tokenString,
+		UserId:         user.Id,
+		ImpersonatedBy: adminId,
+		ExpiresAt:      expiresAt.Unix(),
+	}, nil
+}
+
+// Validates the given provider token and stores it as the user's external login token.
+// Returns ErrProviderTokenInvalid if the provider rejects the token or the token belongs to another Google account.
+func (authService *AuthService) UpdateExternalLoginToken(userId uint, body UpdateExternalLoginTokenBody) (*ExternalLoginResponse, error) {
+	tokenInfo, googleValidateErr := authService.validateGoogleToken(body.ProviderToken)
+	if googleValidateErr != nil {
+		utils.GetCustomLogger().Errorf(
+			"Provider token validation failed for user %d: %s\n",
+			userId,
+			googleValidateErr.Error(),
+		)
+		return nil, googleValidateErr
+	}
+
+	userLogins, getUserLoginsErr := authService.extLoginService.GetUserExternalLogins(userId)
+	if getUserLoginsErr != nil {
+		return nil, getUserLoginsErr
+	}
+
+	if !hasExternalLogin(userLogins, models.Google, tokenInfo.Subject) {
+		utils.GetCustomLogger().Errorf("Provider token of user %d belongs to another Google account\n", userId)
+		return nil, ErrProviderTokenInvalid
+	}
+
+	externalLogin, updateErr := authService.extLoginService.UpdateUserExternalLoginToken(
+		userId,
+		&UpdateExternalLoginBody{Provider: models.Google, ClientToken: body.ProviderToken},
+	)
+	if updateErr != nil {
+		return nil, updateErr
+	}
+
+	return &ExternalLoginResponse{Provider: models.Google, UserId: externalLogin.UserRefer}, nil
+}
+
+// Validates the given provider token and links the provider account to the user.
+// Returns ErrProviderNotSupported if the provider is unknown or not configured,
+// ErrProviderTokenInvalid if the provider rejects the token or it was not issued for the given provider account,
+// and ErrProviderAlreadyLinked if the provider account or the provider itself is already linked.
+func (authService *AuthService) LinkProvider(userId uint, body LinkProviderBody) (*LinkedProvidersResponse, error) {
+	provider, supported := models.ParseLoginProvider(body.Provider)
+
+	if !supported {
+		return nil, ErrProviderNotSupported
+	}
+
+	subject, validateErr := authService.validateProviderToken(provider, body.ProviderToken)
+	if validateErr != nil {
+		utils.GetCustomLogger().Errorf(
+			"Provider token validation failed for user %d: %s\n",
+			userId,
+			validateErr.Error(),
+		)
+		return nil, validateErr
+	}
+
+	// Only the account the token was issued for can be linked
+	if len(subject) == 0 || subject != body.ProviderId {
+		utils.GetCustomLogger().Errorf("Provider token of user %d was not issued for the %s account to link\n", userId, provider)
+		return nil, ErrProviderTokenInvalid
+	}
+
+	_, getExistingErr := authService.extLoginService.GetExternalLoginByClientId(body.ProviderId)
+
+	var notFoundErr *models.DbNotFoundError
+	if getExistingErr == nil {
+		return nil, ErrProviderAlreadyLinked
+	} else if !errors.As(getExistingErr, &notFoundErr) {
+		return nil, getExistingErr
+	}
+
+	userLogins, getUserLoginsErr := authService.extLoginService.GetUserExternalLogins(userId)
+	if getUserLoginsErr != nil {
+		return nil, getUserLoginsErr
+	}
+
+	for _, userLogin := range userLogins {
+		if userLogin.Provider == provider {
+			return nil, ErrProviderAlreadyLinked
+		}
+	}
+
+	externalLogin := &models.ExternalLogin{
+		Provider:    provider,
+		ClientId:    body.ProviderId,
+		ClientToken: body.ProviderToken,
+		UserRefer:   userId,
+	}
+	if _, saveErr := authService.extLoginService.SaveExternalLogin(externalLogin); saveErr != nil {
+		return nil, saveErr
+	}
+
+	response := &LinkedProvidersResponse{Providers: make([]string, 0, len(userLogins)+1)}
+	for _, userLogin := range append(userLogins, externalLogin) {
+		response.Providers = append(response.Providers, userLogin.Provider.String())
+	}
+
+	return response, nil
+}
+
 func (authService *AuthService) generateAndSaveTokenPair(user *models.User) (accessToken *models.Token, refreshToken *models.Token, err error) {
 	accessTokenString, accessTokenErr := authService.AppTokenManager.GenerateToken(*user, models.Access)
 	if accessTokenErr != nil {
 		return nil, nil, accessTokenErr
 	}
+	now := time.Now().Unix()
 	accessToken = &models.Token{
 		TokenValue: accessTokenString,
 		Kind:       models.Access,
 		UserRefer:  user.Id,
+		CreatedAt:  now,
 	}
 
 	refreshTokenString, refreshTokenErr := authService.AppTokenManager.GenerateToken(*user, models.Refresh)
@@ -168,6 +580,7 @@ func (authService *AuthService) generateAndSaveTokenPair(user *models.User) (acc
 		TokenValue: refreshTokenString,
 		Kind:       models.Refresh,
 		UserRefer:  user.Id,
+		CreatedAt:  now,
 	}
 
 	_, saveAccessTokenErr := authService.tokenService.SaveToken(accessToken)
@@ -200,24 +613,18 @@ func (authService *AuthService) updateTokenPair(user *models.User) (accessToken
 	}
 
 	var updatedAccess, updatedRefresh *models.Token
+	// Signing in again starts a new session
+	now := time.Now().Unix()
 
 	for _, token := range tokenPair {
-		var currentTokenToUpdate *models.Token
-		if token.Kind == models.Access {
-			token.TokenValue = accessTokenString
-			updatedAccess = token
-			currentTokenToUpdate = updatedAccess
-		} else if token.Kind == models.Refresh {
-			token.TokenValue = refreshTokenString
-			updatedRefresh = token
-			currentTokenToUpdate = updatedRefresh
+		if token == nil {
+			continue
 		}
 
-		if currentTokenToUpdate != nil {
-			_, updateErr := authService.tokenService.UpdateToken(currentTokenToUpdate)
-			if updateErr != nil {
-				return nil, nil, updateErr // return early on first error
-			}
+		if token.Kind == models.Access {
+			updatedAccess = &models.Token{Id: token.Id, TokenValue: accessTokenString, Kind: token.Kind, UserRefer: token.UserRefer, CreatedAt: now}
+		} else if token.Kind == models.Refresh {
+			updatedRefresh = &models.Token{Id: token.Id, TokenValue: refreshTokenString, Kind: token.Kind, UserRefer: token.UserRefer, CreatedAt: now}
 		}
 	}
 
@@ -225,18 +632,93 @@ func (authService *AuthService) updateTokenPair(user *models.User) (accessToken
 		return nil, nil, errors.New("failed to update token pair, one or both tokens not found in existing pair")
 	}
 
+	// Both tokens are updated together, so a failure never leaves a new access token paired with a stale refresh token
+	if _, updateErr := authService.tokenService.UpdateTokenPair([2]*models.Token{updatedAccess, updatedRefresh}); updateErr != nil {
+		return nil, nil, updateErr
+	}
+
 	return updatedAccess, updatedRefresh, nil
 }
 
-func (authService *AuthService) validateGoogleToken(idToken string) error {
+// Reports whether the logins contain the given provider account.
+// An empty client id never matches, as it means the provider did not identify the account.
+func hasExternalLogin(logins []*models.ExternalLogin, provider models.LoginProvider, clientId string) bool {
+	if clientId == "" {
+		return false
+	}
+
+	for _, login := range logins {
+		if login.Provider == provider && login.ClientId == clientId {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (authService *AuthService) validateGoogleToken(idToken string) (*GoogleTokenInfo, error) {
 	return authService.googleValidator.Validate(idToken)
 }
 
+// Validates the token with the validator of the given provider, returning the id of the provider account it was issued for.
+func (authService *AuthService) validateProviderToken(provider models.LoginProvider, token string) (string, error) {
+	switch provider {
+	case models.Google:
+		tokenInfo, validateErr := authService.validateGoogleToken(token)
+		if validateErr != nil {
+			return "", validateErr
+		}
+		return tokenInfo.Subject, nil
+	case models.Apple:
+		tokenInfo, validateErr := authService.appleValidator.Validate(token)
+		if validateErr != nil {
+			return "", validateErr
+		}
+		return tokenInfo.Subject, nil
+	default:
+		return "", ErrProviderNotSupported
+	}
+}
+
 // Interfaces and implementations for the GoogleTokenValidator
 
 // GoogleTokenValidator interface
 type GoogleTokenValidator interface {
-	Validate(idToken string) error
+	Validate(idToken string) (*GoogleTokenInfo, error)
+}
+
+// Claims of a valid Google ID token, as returned by Google's tokeninfo endpoint.
+type GoogleTokenInfo struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+}
+
+func (tokenInfo *GoogleTokenInfo) UnmarshalJSON(data []byte) error {
+	var rawTokenInfo struct {
+		Subject string `json:"sub"`
+		Email   string `json:"email"`
+		// Google gives it as a string, but it is accepted as a boolean too.
+		EmailVerified interface{} `json:"email_verified"`
+	}
+
+	if err := json.Unmarshal(data, &rawTokenInfo); err != nil {
+		return err
+	}
+
+	tokenInfo.Subject = rawTokenInfo.Subject
+	tokenInfo.Email = rawTokenInfo.Email
+
+	switch emailVerified := rawTokenInfo.EmailVerified.(type) {
+	case bool:
+		tokenInfo.EmailVerified = emailVerified
+	case string:
+		tokenInfo.EmailVerified = emailVerified == "true"
+	default:
+		tokenInfo.EmailVerified = false
+	}
+
+	return nil
 }
 
 // Interface implementation for GoogleTokenValidator
@@ -245,6 +727,8 @@ type GoogleTokenValidatorImpl struct {
 	TokenInfoBaseURL string
 }
 
+var _ GoogleTokenValidator = (*GoogleTokenValidatorImpl)(nil)
+
 // Constructor for GoogleTokenValidator implementation.
 // Sets TokenInfoBaseUrl to default Google token validation URL.
 func NewGoogleTokenValidatorImpl() *GoogleTokenValidatorImpl {
@@ -253,8 +737,10 @@ func NewGoogleTokenValidatorImpl() *GoogleTokenValidatorImpl {
 	}
 }
 
-// Validates the Google token
-func (d *GoogleTokenValidatorImpl) Validate(idToken string) error {
+// Validates the Google token, returning the claims Google gives for it.
+// Returns ErrProviderTokenInvalid if Google rejects it.
+// If the claims cannot be read, the token is still valid but its account and email are unknown.
+func (d *GoogleTokenValidatorImpl) Validate(idToken string) (*GoogleTokenInfo, error) {
 	httpClient := d.Client
 	if httpClient == nil {
 		httpClient = http.DefaultClient
@@ -263,13 +749,168 @@ func (d *GoogleTokenValidatorImpl) Validate(idToken string) error {
 	reqURL := fmt.Sprintf("%s?id_token=%s", d.TokenInfoBaseURL, idToken)
 	googleAuthRes, googleAuthReqErr := httpClient.Get(reqURL)
 	if googleAuthReqErr != nil {
-		return googleAuthReqErr
+		// the request URL contains the token, so it is not kept in the error
+		if urlErr, ok := googleAuthReqErr.(*url.Error); ok {
+			urlErr.URL = d.TokenInfoBaseURL
+		}
+		return nil, googleAuthReqErr
 	}
 	defer googleAuthRes.Body.Close()
 
 	if googleAuthRes.StatusCode != http.StatusOK {
-		log.Printf("Google token validation failed with status: %s", googleAuthRes.Status)
-		return errors.New("google token not valid")
+		utils.GetCustomLogger().Errorf(
+			"Google token validation failed with status: %s for token %s\n",
+			googleAuthRes.Status,
+			utils.MaskSecret(idToken),
+		)
+		return nil, ErrProviderTokenInvalid
 	}
-	return nil
+
+	tokenInfo := &GoogleTokenInfo{}
+
+	if decodeErr := json.NewDecoder(googleAuthRes.Body).Decode(tokenInfo); decodeErr != nil {
+		utils.GetCustomLogger().Errorf("Could not read the Google token info: %s\n", decodeErr.Error())
+		return &GoogleTokenInfo{}, nil
+	}
+
+	return tokenInfo, nil
+}
+
+// Interfaces and implementations for the AppleTokenValidator
+
+// AppleTokenValidator interface
+type AppleTokenValidator interface {
+	Validate(idToken string) (*AppleTokenInfo, error)
+}
+
+// Claims of a valid Apple ID token.
+type AppleTokenInfo struct {
+	Subject string
+	Email   string
+}
+
+// Interface implementation for AppleTokenValidator
+type AppleTokenValidatorImpl struct {
+	Client  *http.Client
+	KeysURL string
+	// Audience the tokens must be issued for. If empty, it is read from the config.
+	ClientId string
+}
+
+var _ AppleTokenValidator = (*AppleTokenValidatorImpl)(nil)
+
+// Constructor for AppleTokenValidator implementation.
+// Sets KeysURL to the default Apple public keys URL.
+func NewAppleTokenValidatorImpl() *AppleTokenValidatorImpl {
+	return &AppleTokenValidatorImpl{
+		KeysURL: constants.ApiAppleKeysUrl,
+	}
+}
+
+// Public key Apple signs its ID tokens with, in JWK format.
+type appleKey struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+// Validates the Apple ID token, checking its signature against Apple's public keys, its issuer, audience and expiry.
+// Returns ErrProviderNotSupported if no Apple client id is configured, and ErrProviderTokenInvalid if the token is not valid.
+func (d *AppleTokenValidatorImpl) Validate(idToken string) (*AppleTokenInfo, error) {
+	clientId := d.ClientId
+	if len(clientId) == 0 {
+		clientId = config.Get().Apple.ClientId
+	}
+
+	if len(clientId) == 0 {
+		return nil, ErrProviderNotSupported
+	}
+
+	keys, keysErr := d.getKeys()
+	if keysErr != nil {
+		return nil, keysErr
+	}
+
+	token, parseErr := jwt.Parse(idToken, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodRSA); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+
+		kid, _ := token.Header["kid"].(string)
+		for _, key := range keys {
+			if key.Kid == kid && key.Kty == "RSA" {
+				return parseAppleKey(key)
+			}
+		}
+
+		return nil, fmt.Errorf("unknown key id: %s", kid)
+	})
+	if parseErr != nil {
+		utils.GetCustomLogger().Errorf(
+			"Apple token validation failed for token %s: %s\n",
+			utils.MaskSecret(idToken),
+			parseErr.Error(),
+		)
+		return nil, ErrProviderTokenInvalid
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok ||
+		!claims.VerifyIssuer(constants.AppleTokenIssuer, true) ||
+		!claims.VerifyAudience(clientId, true) ||
+		!claims.VerifyExpiresAt(time.Now().Unix(), true) {
+		return nil, ErrProviderTokenInvalid
+	}
+
+	subject, _ := claims["sub"].(string)
+	email, _ := claims["email"].(string)
+
+	return &AppleTokenInfo{Subject: subject, Email: email}, nil
+}
+
+// Gets the public keys Apple currently signs its ID tokens with.
+func (d *AppleTokenValidatorImpl) getKeys() ([]appleKey, error) {
+	httpClient := d.Client
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+
+	keysRes, keysReqErr := httpClient.Get(d.KeysURL)
+	if keysReqErr != nil {
+		return nil, keysReqErr
+	}
+	defer keysRes.Body.Close()
+
+	if keysRes.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("could not get the Apple public keys: %s", keysRes.Status)
+	}
+
+	var keySet struct {
+		Keys []appleKey `json:"keys"`
+	}
+
+	if decodeErr := json.NewDecoder(keysRes.Body).Decode(&keySet); decodeErr != nil {
+		return nil, decodeErr
+	}
+
+	return keySet.Keys, nil
+}
+
+// Builds the RSA public key of the given JWK.
+func parseAppleKey(key appleKey) (*rsa.PublicKey, error) {
+	modulus, modulusErr := base64.RawURLEncoding.DecodeString(key.N)
+	if modulusErr != nil {
+		return nil, modulusErr
+	}
+
+	exponent, exponentErr := base64.RawURLEncoding.DecodeString(key.E)
+	if exponentErr != nil {
+		return nil, exponentErr
+	}
+
+	return &rsa.PublicKey{
+		N: new(big.Int).SetBytes(modulus),
+		E: int(new(big.Int).SetBytes(exponent).Int64()),
+	}, nil
 }
@@ -1,12 +1,18 @@
 package services
 
 import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
 	"errors"
+	"math/big"
 	"net/http"
 	"net/http/httptest"
 	"testing"
 	"time"
 
+	"github.com/adfer-dev/analock-api/auth"
 	"github.com/adfer-dev/analock-api/constants"
 	"github.com/adfer-dev/analock-api/models"
 	jwt "github.com/golang-jwt/jwt"
@@ -18,20 +24,40 @@ import (
 // Mock implementation for GoogleTokenValidator
 type mockGoogleTokenValidator struct {
 	ValidateFunc func(idToken string) error
+	// Claims returned for valid tokens. If nil, no claims are returned.
+	TokenInfo *GoogleTokenInfo
 }
 
-func (m *mockGoogleTokenValidator) Validate(idToken string) error {
+func (m *mockGoogleTokenValidator) Validate(idToken string) (*GoogleTokenInfo, error) {
+	if m.ValidateFunc != nil {
+		if err := m.ValidateFunc(idToken); err != nil {
+			return nil, err
+		}
+	}
+	if m.TokenInfo != nil {
+		return m.TokenInfo, nil
+	}
+	return &GoogleTokenInfo{}, nil
+}
+
+// Mock implementation for AppleTokenValidator
+type mockAppleTokenValidator struct {
+	ValidateFunc func(idToken string) (*AppleTokenInfo, error)
+}
+
+func (m *mockAppleTokenValidator) Validate(idToken string) (*AppleTokenInfo, error) {
 	if m.ValidateFunc != nil {
 		return m.ValidateFunc(idToken)
 	}
-	return nil
+	return &AppleTokenInfo{}, nil
 }
 
 // Mock implementation for TokenManager
 type mockTokenManager struct {
-	GenerateTokenFunc func(user models.User, kind models.TokenKind) (string, error)
-	ValidateTokenFunc func(tokenString string) error
-	GetClaimsFunc     func(tokenString string) (jwt.MapClaims, error)
+	GenerateTokenFunc              func(user models.User, kind models.TokenKind) (string, error)
+	GenerateImpersonationTokenFunc func(user models.User, adminId uint, ttl time.Duration) (string, error)
+	ValidateTokenFunc              func(tokenString string) error
+	GetClaimsFunc                  func(tokenString string) (jwt.MapClaims, error)
 }
 
 func (m *mockTokenManager) GenerateToken(user models.User, kind models.TokenKind) (string, error) {
@@ -44,6 +70,13 @@ func (m *mockTokenManager) GenerateToken(user models.User, kind models.TokenKind
 	return constants.TestRefreshTokenValue, nil
 }
 
+func (m *mockTokenManager) GenerateImpersonationToken(user models.User, adminId uint, ttl time.Duration) (string, error) {
+	if m.GenerateImpersonationTokenFunc != nil {
+		return m.GenerateImpersonationTokenFunc(user, adminId, ttl)
+	}
+	return constants.TestAccessTokenValue, nil
+}
+
 func (m *mockTokenManager) ValidateToken(tokenString string) error {
 	if m.ValidateTokenFunc != nil {
 		return m.ValidateTokenFunc(tokenString)
@@ -69,11 +102,13 @@ func (m *mockTokenManager) GetClaims(tokenString string) (jwt.MapClaims, error)
 
 // Mock implementation for UserService
 type mockUserService struct {
-	GetUserByIdFunc    func(id uint) (*models.User, error)
-	GetUserByEmailFunc func(email string) (*models.User, error)
-	SaveUserFunc       func(userBody UserBody) (*models.User, error)
-	UpdateUserFunc     func(userBody UserBody) (*models.User, error)
-	DeleteUserFunc     func(id uint) error
+	GetUserByIdFunc       func(id uint) (*models.User, error)
+	GetUserByEmailFunc    func(email string) (*models.User, error)
+	SaveUserFunc          func(userBody UserBody) (*models.User, error)
+	UpdateUserFunc        func(userBody UserBody) (*models.User, error)
+	MarkEmailVerifiedFunc func(id uint) error
+	DeleteUserFunc        func(id uint) error
+	ListUsersFunc         func(query UserListQuery) (*UserPage, error)
 }
 
 func (m *mockUserService) GetUserById(id uint) (*models.User, error) {
@@ -110,6 +145,13 @@ func (m *mockUserService) UpdateUser(userBody UserBody) (*models.User, error) {
 	return &models.User{Email: userBody.Email, UserName: userBody.UserName, Role: models.Standard}, nil
 }
 
+func (m *mockUserService) MarkEmailVerified(id uint) error {
+	if m.MarkEmailVerifiedFunc != nil {
+		return m.MarkEmailVerifiedFunc(id)
+	}
+	return nil
+}
+
 func (m *mockUserService) DeleteUser(id uint) error {
 	if m.DeleteUserFunc != nil {
 		return m.DeleteUserFunc(id)
@@ -117,15 +159,28 @@ func (m *mockUserService) DeleteUser(id uint) error {
 	return nil
 }
 
+func (m *mockUserService) ListUsers(query UserListQuery) (*UserPage, error) {
+	if m.ListUsersFunc != nil {
+		return m.ListUsersFunc(query)
+	}
+	return &UserPage{Users: []*models.User{}, Page: query.Page, PageSize: query.PageSize}, nil
+}
+
 // Mock implementation for TokenService
 type mockTokenService struct {
-	GetTokenByIdFunc       func(id uint) (*models.Token, error)
-	GetTokenByValueFunc    func(tokenValue string) (*models.Token, error)
-	GetUserTokenByKindFunc func(userId uint, kind models.TokenKind) (*models.Token, error)
-	UpdateTokenFunc        func(tokenBody *models.Token) (*models.Token, error)
-	SaveTokenFunc          func(tokenBody *models.Token) (*models.Token, error)
-	GetUserTokenPairFunc   func(userId uint) ([2]*models.Token, error)
-	DeleteTokenFunc        func(id uint) error
+	GetTokenByIdFunc            func(id uint) (*models.Token, error)
+	GetTokenByValueFunc         func(tokenValue string) (*models.Token, error)
+	GetUserTokenByKindFunc      func(userId uint, kind models.TokenKind) (*models.Token, error)
+	UpdateTokenFunc             func(tokenBody *models.Token) (*models.Token, error)
+	SaveTokenFunc               func(tokenBody *models.Token) (*models.Token, error)
+	GetUserTokenPairFunc        func(userId uint) ([2]*models.Token, error)
+	UpdateTokenPairFunc         func(tokenPair [2]*models.Token) ([2]*models.Token, error)
+	UpdateTokenLastUsedAtFunc   func(id uint, lastUsedAt int64) error
+	DeleteTokenFunc             func(id uint) error
+	DeleteTokenWithGraceFunc    func(id uint) error
+	IsTokenInGracePeriodFunc    func(tokenValue string) bool
+	RenewTokenFunc              func(token *models.Token, newTokenValue string) (bool, error)
+	IsTokenInRenewalOverlapFunc func(tokenValue string) bool
 }
 
 func (m *mockTokenService) GetTokenById(id uint) (*models.Token, error) {
@@ -176,6 +231,20 @@ func (m *mockTokenService) GetUserTokenPair(userId uint) ([2]*models.Token, erro
 	}, nil
 }
 
+func (m *mockTokenService) UpdateTokenPair(tokenPair [2]*models.Token) ([2]*models.Token, error) {
+	if m.UpdateTokenPairFunc != nil {
+		return m.UpdateTokenPairFunc(tokenPair)
+	}
+	return tokenPair, nil
+}
+
+func (m *mockTokenService) UpdateTokenLastUsedAt(id uint, lastUsedAt int64) error {
+	if m.UpdateTokenLastUsedAtFunc != nil {
+		return m.UpdateTokenLastUsedAtFunc(id, lastUsedAt)
+	}
+	return nil
+}
+
 func (m *mockTokenService) DeleteToken(id uint) error {
 	if m.DeleteTokenFunc != nil {
 		return m.DeleteTokenFunc(id)
@@ -183,10 +252,39 @@ func (m *mockTokenService) DeleteToken(id uint) error {
 	return nil
 }
 
+func (m *mockTokenService) DeleteTokenWithGracePeriod(id uint) error {
+	if m.DeleteTokenWithGraceFunc != nil {
+		return m.DeleteTokenWithGraceFunc(id)
+	}
+	return nil
+}
+
+func (m *mockTokenService) IsTokenInGracePeriod(tokenValue string) bool {
+	if m.IsTokenInGracePeriodFunc != nil {
+		return m.IsTokenInGracePeriodFunc(tokenValue)
+	}
+	return false
+}
+
+func (m *mockTokenService) RenewToken(token *models.Token, newTokenValue string) (bool, error) {
+	if m.RenewTokenFunc != nil {
+		return m.RenewTokenFunc(token, newTokenValue)
+	}
+	return true, nil
+}
+
+func (m *mockTokenService) IsTokenInRenewalOverlap(tokenValue string) bool {
+	if m.IsTokenInRenewalOverlapFunc != nil {
+		return m.IsTokenInRenewalOverlapFunc(tokenValue)
+	}
+	return false
+}
+
 // Mock implementation for ExternalLoginService
 type mockExternalLoginService struct {
 	GetExternalLoginByIdFunc         func(id uint) (*models.ExternalLogin, error)
 	GetExternalLoginByClientIdFunc   func(clientId string) (*models.ExternalLogin, error)
+	GetUserExternalLoginsFunc        func(userId uint) ([]*models.ExternalLogin, error)
 	SaveExternalLoginFunc            func(externalLoginBody *models.ExternalLogin) (*models.ExternalLogin, error)
 	UpdateExternalLoginFunc          func(externalLoginBody *models.ExternalLogin) (*models.ExternalLogin, error)
 	UpdateUserExternalLoginTokenFunc func(userId uint, externalLoginBody *UpdateExternalLoginBody) (*models.ExternalLogin, error)
@@ -207,6 +305,13 @@ func (m *mockExternalLoginService) GetExternalLoginByClientId(clientId string) (
 	return &models.ExternalLogin{ClientId: clientId, Id: 99}, nil
 }
 
+func (m *mockExternalLoginService) GetUserExternalLogins(userId uint) ([]*models.ExternalLogin, error) {
+	if m.GetUserExternalLoginsFunc != nil {
+		return m.GetUserExternalLoginsFunc(userId)
+	}
+	return []*models.ExternalLogin{}, nil
+}
+
 func (m *mockExternalLoginService) SaveExternalLogin(externalLoginBody *models.ExternalLogin) (*models.ExternalLogin, error) {
 	if m.SaveExternalLoginFunc != nil {
 		return m.SaveExternalLoginFunc(externalLoginBody)
@@ -255,7 +360,7 @@ func TestAuthenticateUser_ExistingUser(t *testing.T) {
 	mockTokenSvc := &mockTokenService{}
 	mockExtLoginSvc := &mockExternalLoginService{}
 
-	authService := NewAuthService(googleVal, mockAppTokenMgr, mockUserSvc, mockTokenSvc, mockExtLoginSvc)
+	authService := NewAuthService(googleVal, &mockAppleTokenValidator{}, mockAppTokenMgr, mockUserSvc, mockTokenSvc, mockExtLoginSvc)
 
 	authBody := UserAuthenticateBody{
 		Email:         "exists@example.com",
@@ -264,13 +369,54 @@ func TestAuthenticateUser_ExistingUser(t *testing.T) {
 		ProviderToken: "valid_google_token",
 	}
 
-	accessToken, refreshToken, err := authService.AuthenticateUser(authBody)
+	accessToken, refreshToken, user, err := authService.AuthenticateUser(authBody)
 
 	assert.NoError(t, err)
 	assert.NotNil(t, accessToken)
 	assert.NotNil(t, refreshToken)
 	assert.Equal(t, constants.TestAccessTokenValue, accessToken.TokenValue)
 	assert.Equal(t, constants.TestRefreshTokenValue, refreshToken.TokenValue)
+	assert.Equal(t, &models.User{Id: 1, Email: "exists@example.com", UserName: "Existing User"}, user)
+}
+
+func TestAuthenticateUser_TokenPairUpdateFails(t *testing.T) {
+	mockGoogleServer = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer mockGoogleServer.Close()
+
+	googleVal := NewGoogleTokenValidatorImpl()
+	googleVal.Client = mockGoogleServer.Client()
+	googleVal.TokenInfoBaseURL = mockGoogleServer.URL
+
+	updatedTokens := 0
+	mockTokenSvc := &mockTokenService{
+		UpdateTokenFunc: func(tokenBody *models.Token) (*models.Token, error) {
+			updatedTokens++
+			return tokenBody, nil
+		},
+		UpdateTokenPairFunc: func(tokenPair [2]*models.Token) ([2]*models.Token, error) {
+			assert.Equal(t, models.Access, tokenPair[0].Kind)
+			assert.Equal(t, models.Refresh, tokenPair[1].Kind)
+			return [2]*models.Token{}, errors.New("refresh token update failed")
+		},
+	}
+
+	authService := NewAuthService(googleVal, &mockAppleTokenValidator{}, &mockTokenManager{}, &mockUserService{}, mockTokenSvc, &mockExternalLoginService{})
+
+	authBody := UserAuthenticateBody{
+		Email:         "exists@example.com",
+		UserName:      "Existing User",
+		ProviderId:    "google123",
+		ProviderToken: "valid_google_token",
+	}
+
+	accessToken, refreshToken, _, err := authService.AuthenticateUser(authBody)
+
+	assert.EqualError(t, err, "refresh token update failed")
+	assert.Nil(t, accessToken)
+	assert.Nil(t, refreshToken)
+	assert.Zero(t, updatedTokens)
 }
 
 func TestAuthenticateUser_NewUser(t *testing.T) {
@@ -291,7 +437,7 @@ func TestAuthenticateUser_NewUser(t *testing.T) {
 	mockTokenSvc := &mockTokenService{}
 	mockExtLoginSvc := &mockExternalLoginService{}
 
-	authService := NewAuthService(mockGoogleVal, mockAppTokenMgr, mockUserSvc, mockTokenSvc, mockExtLoginSvc)
+	authService := NewAuthService(mockGoogleVal, &mockAppleTokenValidator{}, mockAppTokenMgr, mockUserSvc, mockTokenSvc, mockExtLoginSvc)
 
 	authBody := UserAuthenticateBody{
 		Email:         "new@example.com",
@@ -300,13 +446,14 @@ func TestAuthenticateUser_NewUser(t *testing.T) {
 		ProviderToken: "valid_google_token",
 	}
 
-	accessToken, refreshToken, err := authService.AuthenticateUser(authBody)
+	accessToken, refreshToken, user, err := authService.AuthenticateUser(authBody)
 
 	assert.NoError(t, err)
 	assert.NotNil(t, accessToken)
 	assert.NotNil(t, refreshToken)
 	assert.Equal(t, constants.TestAccessTokenValue, accessToken.TokenValue)
 	assert.Equal(t, constants.TestRefreshTokenValue, refreshToken.TokenValue)
+	assert.Equal(t, &models.User{Id: 2, Email: "new@example.com", UserName: "New User", Role: models.Standard}, user)
 }
 
 func TestAuthenticateUser_GoogleTokenInvalid(t *testing.T) {
@@ -324,7 +471,7 @@ func TestAuthenticateUser_GoogleTokenInvalid(t *testing.T) {
 	mockTokenSvc := &mockTokenService{}
 	mockExtLoginSvc := &mockExternalLoginService{}
 
-	authService := NewAuthService(googleVal, mockAppTokenMgr, mockUserSvc, mockTokenSvc, mockExtLoginSvc)
+	authService := NewAuthService(googleVal, &mockAppleTokenValidator{}, mockAppTokenMgr, mockUserSvc, mockTokenSvc, mockExtLoginSvc)
 
 	authBody := UserAuthenticateBody{
 		Email:         "test@example.com",
@@ -333,10 +480,11 @@ func TestAuthenticateUser_GoogleTokenInvalid(t *testing.T) {
 		ProviderToken: "invalid_google_token",
 	}
 
-	_, _, err := authService.AuthenticateUser(authBody)
+	_, _, user, err := authService.AuthenticateUser(authBody)
 
 	assert.Error(t, err)
-	assert.EqualError(t, err, "google token not valid")
+	assert.ErrorIs(t, err, ErrProviderTokenInvalid)
+	assert.Nil(t, user)
 }
 
 func TestRefreshToken_Valid(t *testing.T) {
@@ -353,7 +501,7 @@ func TestRefreshToken_Valid(t *testing.T) {
 	}
 	mockTokenService := &mockTokenService{}
 
-	authService := NewAuthService(nil, mockTokenManager, mockUserService, mockTokenService, nil)
+	authService := NewAuthService(nil, &mockAppleTokenValidator{}, mockTokenManager, mockUserService, mockTokenService, nil)
 
 	req := RefreshTokenRequest{
 		RefreshToken: "valid_refresh_token",
@@ -366,13 +514,56 @@ func TestRefreshToken_Valid(t *testing.T) {
 	assert.Equal(t, constants.TestAccessTokenValue, res.Token)
 }
 
+func TestRefreshToken_MissingAccessToken(t *testing.T) {
+	mockTokenManager := &mockTokenManager{
+		ValidateTokenFunc: func(tokenString string) error { return nil },
+		GetClaimsFunc: func(tokenString string) (jwt.MapClaims, error) {
+			return jwt.MapClaims{"sub": float64(1)}, nil
+		},
+	}
+	var savedToken *models.Token
+	mockTokenService := &mockTokenService{
+		GetUserTokenByKindFunc: func(userId uint, kind models.TokenKind) (*models.Token, error) {
+			return nil, &models.DbNotFoundError{DbItem: &models.Token{}}
+		},
+		SaveTokenFunc: func(tokenBody *models.Token) (*models.Token, error) {
+			savedToken = tokenBody
+			return tokenBody, nil
+		},
+		UpdateTokenFunc: func(tokenBody *models.Token) (*models.Token, error) {
+			t.Fatal("Missing access token was updated instead of saved")
+			return nil, nil
+		},
+	}
+
+	authService := NewAuthService(nil, &mockAppleTokenValidator{}, mockTokenManager, &mockUserService{}, mockTokenService, nil)
+
+	res, err := authService.RefreshToken(RefreshTokenRequest{RefreshToken: "valid_refresh_token"})
+
+	assert.NoError(t, err)
+	assert.Equal(t, constants.TestAccessTokenValue, res.Token)
+	assert.Equal(t, constants.TestAccessTokenValue, savedToken.TokenValue)
+	assert.Equal(t, models.Access, savedToken.Kind)
+	assert.Equal(t, uint(1), savedToken.UserRefer)
+	assert.NotZero(t, savedToken.CreatedAt)
+
+	// Test case: Other errors getting the access token are still returned
+	mockTokenService.GetUserTokenByKindFunc = func(userId uint, kind models.TokenKind) (*models.Token, error) {
+		return nil, errors.New("database unavailable")
+	}
+
+	_, err = authService.RefreshToken(RefreshTokenRequest{RefreshToken: "valid_refresh_token"})
+
+	assert.EqualError(t, err, "database unavailable")
+}
+
 func TestRefreshToken_InvalidToken(t *testing.T) {
 	mockAppTokenMgr := &mockTokenManager{
 		ValidateTokenFunc: func(tokenString string) error {
 			return errors.New("invalid token from test")
 		},
 	}
-	authService := NewAuthService(nil, mockAppTokenMgr, nil, nil, nil)
+	authService := NewAuthService(nil, &mockAppleTokenValidator{}, mockAppTokenMgr, nil, nil, nil)
 
 	req := RefreshTokenRequest{
 		RefreshToken: "invalid_token_for_refresh",
@@ -382,7 +573,27 @@ func TestRefreshToken_InvalidToken(t *testing.T) {
 
 	assert.Error(t, err)
 	assert.Nil(t, res)
-	assert.EqualError(t, err, "invalid token from test")
+	assert.ErrorIs(t, err, ErrInvalidToken)
+	assert.EqualError(t, err, "token not valid: invalid token from test")
+}
+
+func TestRefreshToken_Expired(t *testing.T) {
+	secretKey, keyErr := auth.GetSecretKey()
+	assert.NoError(t, keyErr)
+	expiredToken, signErr := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"sub":          1,
+		"exp":          time.Now().Add(-time.Minute).Unix(),
+		auth.KindClaim: models.Refresh,
+	}).SignedString(secretKey)
+	assert.NoError(t, signErr)
+
+	authService := NewAuthService(nil, &mockAppleTokenValidator{}, auth.GetTokenManager(), nil, nil, nil)
+
+	res, err := authService.RefreshToken(RefreshTokenRequest{RefreshToken: expiredToken})
+
+	assert.Nil(t, res)
+	assert.ErrorIs(t, err, ErrRefreshTokenExpired)
+	assert.NotErrorIs(t, err, ErrInvalidToken)
 }
 
 func TestRefreshToken_UserNotFound(t *testing.T) {
@@ -395,13 +606,13 @@ func TestRefreshToken_UserNotFound(t *testing.T) {
 	mockUserSvc := &mockUserService{
 		GetUserByIdFunc: func(userId uint) (*models.User, error) {
 			if userId == 1 {
-				return nil, errors.New("user not found for refresh test")
+				return nil, &models.DbNotFoundError{DbItem: models.User{}}
 			}
 			return nil, errors.New("unexpected email in GetUserByEmail mock")
 		},
 	}
 	mockTokenService := &mockTokenService{}
-	authService := NewAuthService(nil, mockAppTokenMgr, mockUserSvc, mockTokenService, nil)
+	authService := NewAuthService(nil, &mockAppleTokenValidator{}, mockAppTokenMgr, mockUserSvc, mockTokenService, nil)
 
 	req := RefreshTokenRequest{
 		RefreshToken: "valid_refresh_token_unknown_user",
@@ -411,5 +622,711 @@ func TestRefreshToken_UserNotFound(t *testing.T) {
 
 	assert.Error(t, err)
 	assert.Nil(t, res)
-	assert.EqualError(t, err, "user not found for refresh test")
+	assert.ErrorIs(t, err, ErrUserNotFound)
+}
+
+func TestRefreshToken_SubjectNotANumber(t *testing.T) {
+	mockAppTokenMgr := &mockTokenManager{
+		ValidateTokenFunc: func(tokenString string) error { return nil },
+		GetClaimsFunc: func(tokenString string) (jwt.MapClaims, error) {
+			return jwt.MapClaims{"sub": "not-a-number"}, nil
+		},
+	}
+	authService := NewAuthService(nil, &mockAppleTokenValidator{}, mockAppTokenMgr, nil, nil, nil)
+
+	res, err := authService.RefreshToken(RefreshTokenRequest{RefreshToken: "refresh_token_without_subject"})
+
+	assert.Nil(t, res)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+}
+
+func TestRefreshToken_UserLookupError(t *testing.T) {
+	mockAppTokenMgr := &mockTokenManager{
+		ValidateTokenFunc: func(tokenString string) error { return nil },
+		GetClaimsFunc: func(tokenString string) (jwt.MapClaims, error) {
+			return jwt.MapClaims{"sub": float64(1)}, nil
+		},
+	}
+	mockUserSvc := &mockUserService{
+		GetUserByIdFunc: func(userId uint) (*models.User, error) {
+			return nil, errors.New("database is down")
+		},
+	}
+	authService := NewAuthService(nil, &mockAppleTokenValidator{}, mockAppTokenMgr, mockUserSvc, &mockTokenService{}, nil)
+
+	_, err := authService.RefreshToken(RefreshTokenRequest{RefreshToken: "valid_refresh_token"})
+
+	assert.EqualError(t, err, "database is down")
+	assert.NotErrorIs(t, err, ErrUserNotFound)
+	assert.NotErrorIs(t, err, ErrInvalidToken)
+}
+
+func TestRefreshToken_RevokedSession(t *testing.T) {
+	mockAppTokenMgr := &mockTokenManager{
+		ValidateTokenFunc: func(tokenString string) error { return nil },
+		GetClaimsFunc: func(tokenString string) (jwt.MapClaims, error) {
+			return jwt.MapClaims{"sub": float64(1)}, nil
+		},
+	}
+	var touchedTokenId uint
+	mockTokenService := &mockTokenService{
+		GetTokenByValueFunc: func(tokenValue string) (*models.Token, error) {
+			return nil, &models.DbNotFoundError{DbItem: &models.Token{}}
+		},
+		UpdateTokenLastUsedAtFunc: func(id uint, lastUsedAt int64) error {
+			touchedTokenId = id
+			return nil
+		},
+	}
+	authService := NewAuthService(nil, &mockAppleTokenValidator{}, mockAppTokenMgr, &mockUserService{}, mockTokenService, nil)
+
+	// Test case: The refresh token is no longer stored
+	_, err := authService.RefreshToken(RefreshTokenRequest{RefreshToken: "revoked_refresh_token"})
+
+	assert.ErrorIs(t, err, ErrInvalidToken)
+
+	// Test case: The use of a stored refresh token is recorded
+	mockTokenService.GetTokenByValueFunc = func(tokenValue string) (*models.Token, error) {
+		return &models.Token{Id: 5, TokenValue: tokenValue, Kind: models.Refresh, UserRefer: 1}, nil
+	}
+
+	_, err = authService.RefreshToken(RefreshTokenRequest{RefreshToken: "valid_refresh_token"})
+
+	assert.NoError(t, err)
+	assert.Equal(t, uint(5), touchedTokenId)
+}
+
+func TestGetUserSessions(t *testing.T) {
+	mockTokenService := &mockTokenService{
+		GetUserTokenByKindFunc: func(userId uint, kind models.TokenKind) (*models.Token, error) {
+			return &models.Token{Id: 2, TokenValue: "refresh_token", Kind: kind, UserRefer: userId, CreatedAt: 1000, LastUsedAt: 2000}, nil
+		},
+	}
+	authService := NewAuthService(nil, &mockAppleTokenValidator{}, &mockTokenManager{}, &mockUserService{}, mockTokenService, nil)
+
+	sessions, err := authService.GetUserSessions(1)
+
+	assert.NoError(t, err)
+	assert.Equal(t, []*models.Session{{Id: 2, CreatedAt: 1000, LastUsedAt: 2000}}, sessions)
+
+	// Test case: The user has no refresh token
+	mockTokenService.GetUserTokenByKindFunc = func(userId uint, kind models.TokenKind) (*models.Token, error) {
+		return nil, &models.DbNotFoundError{DbItem: &models.Token{}}
+	}
+
+	sessions, err = authService.GetUserSessions(1)
+
+	assert.NoError(t, err)
+	assert.Empty(t, sessions)
+}
+
+func TestRevokeUserSession(t *testing.T) {
+	var deletedTokenIds []uint
+	mockTokenService := &mockTokenService{
+		GetTokenByIdFunc: func(id uint) (*models.Token, error) {
+			if id != 2 {
+				return nil, &models.DbNotFoundError{DbItem: &models.Token{}}
+			}
+			return &models.Token{Id: 2, TokenValue: "refresh_token", Kind: models.Refresh, UserRefer: 1}, nil
+		},
+		GetUserTokenByKindFunc: func(userId uint, kind models.TokenKind) (*models.Token, error) {
+			return &models.Token{Id: 1, TokenValue: "access_token", Kind: kind, UserRefer: userId}, nil
+		},
+		DeleteTokenFunc: func(id uint) error {
+			deletedTokenIds = append(deletedTokenIds, id)
+			return nil
+		},
+	}
+	authService := NewAuthService(nil, &mockAppleTokenValidator{}, &mockTokenManager{}, &mockUserService{}, mockTokenService, nil)
+
+	// Test case: The session belongs to another user
+	assert.ErrorIs(t, authService.RevokeUserSession(3, 2), ErrSessionNotFound)
+
+	// Test case: The session does not exist
+	assert.ErrorIs(t, authService.RevokeUserSession(1, 7), ErrSessionNotFound)
+	assert.Empty(t, deletedTokenIds)
+
+	// Test case: Both the refresh token and the access token are deleted
+	assert.NoError(t, authService.RevokeUserSession(1, 2))
+	assert.Equal(t, []uint{2, 1}, deletedTokenIds)
+}
+
+func TestRevokeUserSessionWithGracePeriod(t *testing.T) {
+	t.Setenv("API_DELETED_TOKEN_GRACE_PERIOD", "1m")
+
+	tokenStorageMock := newMockTokenStorage()
+	for _, token := range []*models.Token{
+		{Id: 70, TokenValue: "revoked_access_token", Kind: models.Access, UserRefer: 70},
+		{Id: 71, TokenValue: "revoked_refresh_token", Kind: models.Refresh, UserRefer: 70},
+	} {
+		tokenStorageMock.TokensById[token.Id] = token
+		tokenStorageMock.TokensByValue[token.TokenValue] = token
+		tokenStorageMock.TokensByUserAndKind[getTokenStorageKey(token.UserRefer, token.Kind)] = token
+	}
+	tokenService := NewTokenServiceImpl(tokenStorageMock)
+	authService := NewAuthService(nil, &mockAppleTokenValidator{}, &mockTokenManager{}, &mockUserService{}, tokenService, nil)
+
+	// Test case: Revoking a session rejects its access token right away, the grace period is only for logouts
+	assert.NoError(t, authService.RevokeUserSession(70, 71))
+	assert.NotContains(t, tokenStorageMock.TokensById, uint(70))
+	assert.False(t, tokenService.IsTokenInGracePeriod("revoked_access_token"))
+}
+
+func TestLogOutUser(t *testing.T) {
+	var deletedTokenIds, gracefullyDeletedTokenIds []uint
+	mockTokenService := &mockTokenService{
+		DeleteTokenFunc: func(id uint) error {
+			deletedTokenIds = append(deletedTokenIds, id)
+			return nil
+		},
+		DeleteTokenWithGraceFunc: func(id uint) error {
+			gracefullyDeletedTokenIds = append(gracefullyDeletedTokenIds, id)
+			return nil
+		},
+	}
+	authService := NewAuthService(nil, &mockAppleTokenValidator{}, &mockTokenManager{}, &mockUserService{}, mockTokenService, nil)
+
+	// Test case: Only the access token is deleted with the grace period
+	assert.NoError(t, authService.LogOutUser(1))
+	assert.Equal(t, []uint{1}, gracefullyDeletedTokenIds)
+	assert.Equal(t, []uint{2}, deletedTokenIds)
+
+	// Test case: Users already logged out have nothing to delete
+	mockTokenService.GetUserTokenPairFunc = func(userId uint) ([2]*models.Token, error) {
+		return [2]*models.Token{}, &models.DbNotFoundError{DbItem: &models.Token{}}
+	}
+	assert.NoError(t, authService.LogOutUser(1))
+
+	// Test case: Token deletion errors are returned
+	mockTokenService.GetUserTokenPairFunc = nil
+	mockTokenService.DeleteTokenWithGraceFunc = func(id uint) error { return errors.New("forced delete error") }
+	assert.EqualError(t, authService.LogOutUser(1), "forced delete error")
+}
+
+func TestImpersonateUser(t *testing.T) {
+	var savedToken, updatedToken *models.Token
+	previousTokenExists := false
+	mockUserSvc := &mockUserService{
+		GetUserByIdFunc: func(id uint) (*models.User, error) {
+			switch id {
+			case 1:
+				return &models.User{Id: 1, Role: models.Standard}, nil
+			case 2:
+				return &models.User{Id: 2, Role: models.Admin}, nil
+			}
+			return nil, &models.DbNotFoundError{DbItem: &models.User{}}
+		},
+	}
+	mockTokenSvc := &mockTokenService{
+		GetUserTokenByKindFunc: func(userId uint, kind models.TokenKind) (*models.Token, error) {
+			if !previousTokenExists {
+				return nil, &models.DbNotFoundError{DbItem: &models.Token{}}
+			}
+			return &models.Token{Id: 5, Kind: kind, UserRefer: userId}, nil
+		},
+		SaveTokenFunc: func(tokenBody *models.Token) (*models.Token, error) {
+			savedToken = tokenBody
+			return tokenBody, nil
+		},
+		UpdateTokenFunc: func(tokenBody *models.Token) (*models.Token, error) {
+			updatedToken = tokenBody
+			return tokenBody, nil
+		},
+	}
+	authService := NewAuthService(nil, &mockAppleTokenValidator{}, &mockTokenManager{}, mockUserSvc, mockTokenSvc, nil)
+
+	// Test case: The impersonation token is stored and the admin is recorded in the response
+	response, err := authService.ImpersonateUser(9, 1)
+
+	assert.NoError(t, err)
+	assert.Equal(t, constants.TestAccessTokenValue, response.AccessToken)
+	assert.Equal(t, uint(1), response.UserId)
+	assert.Equal(t, uint(9), response.ImpersonatedBy)
+	assert.Greater(t, response.ExpiresAt, time.Now().Unix())
+	assert.Less(t, response.ExpiresAt, time.Now().Add(24*time.Hour).Unix())
+	if assert.NotNil(t, savedToken) {
+		assert.Equal(t, models.Impersonation, savedToken.Kind)
+		assert.Equal(t, uint(1), savedToken.UserRefer)
+	}
+
+	// Test case: A previous impersonation token is replaced
+	previousTokenExists = true
+	_, err = authService.ImpersonateUser(9, 1)
+
+	assert.NoError(t, err)
+	if assert.NotNil(t, updatedToken) {
+		assert.Equal(t, uint(5), updatedToken.Id)
+		assert.Equal(t, models.Impersonation, updatedToken.Kind)
+	}
+
+	// Test case: Admins cannot be impersonated
+	_, err = authService.ImpersonateUser(9, 2)
+	assert.ErrorIs(t, err, ErrImpersonationNotAllowed)
+
+	// Test case: The user does not exist
+	_, err = authService.ImpersonateUser(9, 3)
+	assert.ErrorIs(t, err, ErrUserNotFound)
+}
+
+func TestUpdateExternalLoginToken(t *testing.T) {
+	mockExtLoginSvc := &mockExternalLoginService{
+		GetUserExternalLoginsFunc: func(userId uint) ([]*models.ExternalLogin, error) {
+			return []*models.ExternalLogin{{ClientId: "google_subject", UserRefer: userId, Provider: models.Google}}, nil
+		},
+	}
+	validGoogleVal := &mockGoogleTokenValidator{TokenInfo: &GoogleTokenInfo{Subject: "google_subject"}}
+	authService := NewAuthService(validGoogleVal, &mockAppleTokenValidator{}, &mockTokenManager{}, &mockUserService{}, &mockTokenService{}, mockExtLoginSvc)
+
+	t.Run("valid_provider_token", func(t *testing.T) {
+		var updatedUserId uint
+		var updatedToken string
+		mockExtLoginSvc.UpdateUserExternalLoginTokenFunc = func(userId uint, body *UpdateExternalLoginBody) (*models.ExternalLogin, error) {
+			updatedUserId = userId
+			updatedToken = body.ClientToken
+			return &models.ExternalLogin{UserRefer: userId, ClientToken: body.ClientToken}, nil
+		}
+
+		response, err := authService.UpdateExternalLoginToken(7, UpdateExternalLoginTokenBody{ProviderToken: "new_google_token"})
+
+		assert.NoError(t, err)
+		assert.Equal(t, &ExternalLoginResponse{Provider: models.Google, UserId: 7}, response)
+		assert.Equal(t, uint(7), updatedUserId)
+		assert.Equal(t, "new_google_token", updatedToken)
+	})
+
+	t.Run("invalid_provider_token", func(t *testing.T) {
+		updateCalled := false
+		mockExtLoginSvc.UpdateUserExternalLoginTokenFunc = func(userId uint, body *UpdateExternalLoginBody) (*models.ExternalLogin, error) {
+			updateCalled = true
+			return nil, nil
+		}
+		invalidGoogleVal := &mockGoogleTokenValidator{ValidateFunc: func(idToken string) error { return ErrProviderTokenInvalid }}
+		invalidAuthService := NewAuthService(invalidGoogleVal, &mockAppleTokenValidator{}, &mockTokenManager{}, &mockUserService{}, &mockTokenService{}, mockExtLoginSvc)
+
+		_, err := invalidAuthService.UpdateExternalLoginToken(7, UpdateExternalLoginTokenBody{ProviderToken: "bad_google_token"})
+
+		assert.ErrorIs(t, err, ErrProviderTokenInvalid)
+		assert.False(t, updateCalled)
+	})
+
+	t.Run("provider_token_of_another_account", func(t *testing.T) {
+		updateCalled := false
+		mockExtLoginSvc.UpdateUserExternalLoginTokenFunc = func(userId uint, body *UpdateExternalLoginBody) (*models.ExternalLogin, error) {
+			updateCalled = true
+			return nil, nil
+		}
+		otherGoogleVal := &mockGoogleTokenValidator{TokenInfo: &GoogleTokenInfo{Subject: "other_google_subject", Email: "other@example.com"}}
+		otherAuthService := NewAuthService(otherGoogleVal, &mockAppleTokenValidator{}, &mockTokenManager{}, &mockUserService{}, &mockTokenService{}, mockExtLoginSvc)
+
+		_, err := otherAuthService.UpdateExternalLoginToken(7, UpdateExternalLoginTokenBody{ProviderToken: "other_google_token"})
+
+		assert.ErrorIs(t, err, ErrProviderTokenInvalid)
+		assert.False(t, updateCalled)
+	})
+
+	t.Run("provider_token_without_subject", func(t *testing.T) {
+		updateCalled := false
+		mockExtLoginSvc.UpdateUserExternalLoginTokenFunc = func(userId uint, body *UpdateExternalLoginBody) (*models.ExternalLogin, error) {
+			updateCalled = true
+			return nil, nil
+		}
+		noSubjectAuthService := NewAuthService(&mockGoogleTokenValidator{}, &mockAppleTokenValidator{}, &mockTokenManager{}, &mockUserService{}, &mockTokenService{}, mockExtLoginSvc)
+
+		_, err := noSubjectAuthService.UpdateExternalLoginToken(7, UpdateExternalLoginTokenBody{ProviderToken: "google_token"})
+
+		assert.ErrorIs(t, err, ErrProviderTokenInvalid)
+		assert.False(t, updateCalled)
+	})
+
+	t.Run("external_login_update_error", func(t *testing.T) {
+		mockExtLoginSvc.UpdateUserExternalLoginTokenFunc = func(userId uint, body *UpdateExternalLoginBody) (*models.ExternalLogin, error) {
+			return nil, errors.New("update failed")
+		}
+
+		_, err := authService.UpdateExternalLoginToken(7, UpdateExternalLoginTokenBody{ProviderToken: "new_google_token"})
+
+		assert.EqualError(t, err, "update failed")
+	})
+}
+
+func TestLinkProvider(t *testing.T) {
+	notFoundErr := &models.DbNotFoundError{DbItem: &models.ExternalLogin{}}
+	validGoogleVal := &mockGoogleTokenValidator{TokenInfo: &GoogleTokenInfo{Subject: "new_client_id"}}
+	validAppleVal := &mockAppleTokenValidator{ValidateFunc: func(idToken string) (*AppleTokenInfo, error) {
+		return &AppleTokenInfo{Subject: "apple_client_id"}, nil
+	}}
+	linkBody := LinkProviderBody{Provider: "google", ProviderId: "new_client_id", ProviderToken: "google_token"}
+
+	t.Run("provider_linked", func(t *testing.T) {
+		var savedLogin *models.ExternalLogin
+		mockExtLoginSvc := &mockExternalLoginService{
+			GetExternalLoginByClientIdFunc: func(clientId string) (*models.ExternalLogin, error) { return nil, notFoundErr },
+			SaveExternalLoginFunc: func(externalLoginBody *models.ExternalLogin) (*models.ExternalLogin, error) {
+				savedLogin = externalLoginBody
+				return externalLoginBody, nil
+			},
+		}
+		authService := NewAuthService(validGoogleVal, &mockAppleTokenValidator{}, &mockTokenManager{}, &mockUserService{}, &mockTokenService{}, mockExtLoginSvc)
+
+		response, err := authService.LinkProvider(7, linkBody)
+
+		assert.NoError(t, err)
+		assert.Equal(t, &LinkedProvidersResponse{Providers: []string{"google"}}, response)
+		assert.Equal(t, &models.ExternalLogin{Provider: models.Google, ClientId: "new_client_id", ClientToken: "google_token", UserRefer: 7}, savedLogin)
+	})
+
+	t.Run("apple_linked_to_google_user", func(t *testing.T) {
+		var savedLogin *models.ExternalLogin
+		mockExtLoginSvc := &mockExternalLoginService{
+			GetExternalLoginByClientIdFunc: func(clientId string) (*models.ExternalLogin, error) { return nil, notFoundErr },
+			GetUserExternalLoginsFunc: func(userId uint) ([]*models.ExternalLogin, error) {
+				return []*models.ExternalLogin{{ClientId: "google_client_id", UserRefer: userId, Provider: models.Google}}, nil
+			},
+			SaveExternalLoginFunc: func(externalLoginBody *models.ExternalLogin) (*models.ExternalLogin, error) {
+				savedLogin = externalLoginBody
+				return externalLoginBody, nil
+			},
+		}
+		authService := NewAuthService(validGoogleVal, validAppleVal, &mockTokenManager{}, &mockUserService{}, &mockTokenService{}, mockExtLoginSvc)
+
+		response, err := authService.LinkProvider(7, LinkProviderBody{Provider: "apple", ProviderId: "apple_client_id", ProviderToken: "apple_token"})
+
+		assert.NoError(t, err)
+		assert.Equal(t, &LinkedProvidersResponse{Providers: []string{"google", "apple"}}, response)
+		assert.Equal(t, &models.ExternalLogin{Provider: models.Apple, ClientId: "apple_client_id", ClientToken: "apple_token", UserRefer: 7}, savedLogin)
+	})
+
+	t.Run("provider_id_of_another_account", func(t *testing.T) {
+		saveCalled := false
+		mockExtLoginSvc := &mockExternalLoginService{
+			GetExternalLoginByClientIdFunc: func(clientId string) (*models.ExternalLogin, error) { return nil, notFoundErr },
+			SaveExternalLoginFunc: func(externalLoginBody *models.ExternalLogin) (*models.ExternalLogin, error) {
+				saveCalled = true
+				return externalLoginBody, nil
+			},
+		}
+		authService := NewAuthService(validGoogleVal, validAppleVal, &mockTokenManager{}, &mockUserService{}, &mockTokenService{}, mockExtLoginSvc)
+
+		_, err := authService.LinkProvider(7, LinkProviderBody{Provider: "apple", ProviderId: "other_apple_client_id", ProviderToken: "apple_token"})
+
+		assert.ErrorIs(t, err, ErrProviderTokenInvalid)
+		assert.False(t, saveCalled)
+	})
+
+	t.Run("provider_not_supported", func(t *testing.T) {
+		authService := NewAuthService(validGoogleVal, &mockAppleTokenValidator{}, &mockTokenManager{}, &mockUserService{}, &mockTokenService{}, &mockExternalLoginService{})
+
+		_, err := authService.LinkProvider(7, LinkProviderBody{Provider: "unknown", ProviderId: "id", ProviderToken: "token"})
+
+		assert.ErrorIs(t, err, ErrProviderNotSupported)
+	})
+
+	t.Run("invalid_provider_token", func(t *testing.T) {
+		invalidGoogleVal := &mockGoogleTokenValidator{ValidateFunc: func(idToken string) error { return ErrProviderTokenInvalid }}
+		authService := NewAuthService(invalidGoogleVal, &mockAppleTokenValidator{}, &mockTokenManager{}, &mockUserService{}, &mockTokenService{}, &mockExternalLoginService{})
+
+		_, err := authService.LinkProvider(7, linkBody)
+
+		assert.ErrorIs(t, err, ErrProviderTokenInvalid)
+	})
+
+	t.Run("client_id_linked_to_another_account", func(t *testing.T) {
+		saveCalled := false
+		mockExtLoginSvc := &mockExternalLoginService{
+			GetExternalLoginByClientIdFunc: func(clientId string) (*models.ExternalLogin, error) {
+				return &models.ExternalLogin{ClientId: clientId, UserRefer: 8, Provider: models.Google}, nil
+			},
+			SaveExternalLoginFunc: func(externalLoginBody *models.ExternalLogin) (*models.ExternalLogin, error) {
+				saveCalled = true
+				return externalLoginBody, nil
+			},
+		}
+		authService := NewAuthService(validGoogleVal, &mockAppleTokenValidator{}, &mockTokenManager{}, &mockUserService{}, &mockTokenService{}, mockExtLoginSvc)
+
+		_, err := authService.LinkProvider(7, linkBody)
+
+		assert.ErrorIs(t, err, ErrProviderAlreadyLinked)
+		assert.False(t, saveCalled)
+	})
+
+	t.Run("provider_already_linked_to_user", func(t *testing.T) {
+		mockExtLoginSvc := &mockExternalLoginService{
+			GetExternalLoginByClientIdFunc: func(clientId string) (*models.ExternalLogin, error) { return nil, notFoundErr },
+			GetUserExternalLoginsFunc: func(userId uint) ([]*models.ExternalLogin, error) {
+				return []*models.ExternalLogin{{ClientId: "old_client_id", UserRefer: userId, Provider: models.Google}}, nil
+			},
+		}
+		authService := NewAuthService(validGoogleVal, &mockAppleTokenValidator{}, &mockTokenManager{}, &mockUserService{}, &mockTokenService{}, mockExtLoginSvc)
+
+		_, err := authService.LinkProvider(7, linkBody)
+
+		assert.ErrorIs(t, err, ErrProviderAlreadyLinked)
+	})
+
+	t.Run("client_id_lookup_error", func(t *testing.T) {
+		mockExtLoginSvc := &mockExternalLoginService{
+			GetExternalLoginByClientIdFunc: func(clientId string) (*models.ExternalLogin, error) { return nil, errors.New("database is down") },
+		}
+		authService := NewAuthService(validGoogleVal, &mockAppleTokenValidator{}, &mockTokenManager{}, &mockUserService{}, &mockTokenService{}, mockExtLoginSvc)
+
+		_, err := authService.LinkProvider(7, linkBody)
+
+		assert.EqualError(t, err, "database is down")
+	})
+}
+
+func TestGoogleTokenValidatorTokenInfo(t *testing.T) {
+	tests := []struct {
+		name             string
+		responseBody     string
+		expectedSubject  string
+		expectedEmail    string
+		expectedVerified bool
+	}{
+		{"Verified as a string", `{"sub":"1234","email":"user@example.com","email_verified":"true"}`, "1234", "user@example.com", true},
+		{"Not verified as a string", `{"sub":"1234","email":"user@example.com","email_verified":"false"}`, "1234", "user@example.com", false},
+		{"Verified as a boolean", `{"sub":"1234","email":"user@example.com","email_verified":true}`, "1234", "user@example.com", true},
+		{"Missing verification", `{"sub":"1234","email":"user@example.com"}`, "1234", "user@example.com", false},
+		{"Missing subject", `{"email":"user@example.com","email_verified":"true"}`, "", "user@example.com", true},
+		{"Claims not readable", `not json`, "", "", false},
+	}
+
+	for _, testCase := range tests {
+		t.Run(testCase.name, func(t *testing.T) {
+			googleServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(testCase.responseBody))
+			}))
+			defer googleServer.Close()
+
+			googleVal := NewGoogleTokenValidatorImpl()
+			googleVal.Client = googleServer.Client()
+			googleVal.TokenInfoBaseURL = googleServer.URL
+
+			tokenInfo, err := googleVal.Validate("google_token")
+
+			assert.NoError(t, err)
+			assert.Equal(t, &GoogleTokenInfo{
+				Subject:       testCase.expectedSubject,
+				Email:         testCase.expectedEmail,
+				EmailVerified: testCase.expectedVerified,
+			}, tokenInfo)
+		})
+	}
+}
+
+func TestAppleTokenValidator(t *testing.T) {
+	privateKey, keyErr := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, keyErr)
+	otherPrivateKey, keyErr := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, keyErr)
+
+	appleServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{{
+			"kid": "apple_key",
+			"kty": "RSA",
+			"n":   base64.RawURLEncoding.EncodeToString(privateKey.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(privateKey.E)).Bytes()),
+		}}})
+	}))
+	defer appleServer.Close()
+
+	signToken := func(kid string, key *rsa.PrivateKey, claims jwt.MapClaims) string {
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+		token.Header["kid"] = kid
+		tokenString, signErr := token.SignedString(key)
+		assert.NoError(t, signErr)
+		return tokenString
+	}
+	validClaims := func() jwt.MapClaims {
+		return jwt.MapClaims{
+			"iss":   constants.AppleTokenIssuer,
+			"aud":   "com.example.analock",
+			"sub":   "apple_subject",
+			"email": "user@example.com",
+			"exp":   time.Now().Add(time.Hour).Unix(),
+		}
+	}
+	withClaim := func(name string, value interface{}) jwt.MapClaims {
+		claims := validClaims()
+		claims[name] = value
+		return claims
+	}
+
+	tests := []struct {
+		name          string
+		token         string
+		expectedInfo  *AppleTokenInfo
+		expectedError error
+	}{
+		{"Valid token", signToken("apple_key", privateKey, validClaims()), &AppleTokenInfo{Subject: "apple_subject", Email: "user@example.com"}, nil},
+		{"Other audience", signToken("apple_key", privateKey, withClaim("aud", "com.example.other")), nil, ErrProviderTokenInvalid},
+		{"Other issuer", signToken("apple_key", privateKey, withClaim("iss", "https://example.com")), nil, ErrProviderTokenInvalid},
+		{"Expired", signToken("apple_key", privateKey, withClaim("exp", time.Now().Add(-time.Hour).Unix())), nil, ErrProviderTokenInvalid},
+		{"Unknown key", signToken("other_key", privateKey, validClaims()), nil, ErrProviderTokenInvalid},
+		{"Signed with another key", signToken("apple_key", otherPrivateKey, validClaims()), nil, ErrProviderTokenInvalid},
+		{"Not a token", "not_a_token", nil, ErrProviderTokenInvalid},
+	}
+
+	for _, testCase := range tests {
+		t.Run(testCase.name, func(t *testing.T) {
+			appleVal := NewAppleTokenValidatorImpl()
+			appleVal.Client = appleServer.Client()
+			appleVal.KeysURL = appleServer.URL
+			appleVal.ClientId = "com.example.analock"
+
+			tokenInfo, err := appleVal.Validate(testCase.token)
+
+			assert.ErrorIs(t, err, testCase.expectedError)
+			assert.Equal(t, testCase.expectedInfo, tokenInfo)
+		})
+	}
+
+	// Test case: Apple tokens are not accepted when no client id is configured
+	t.Setenv("API_APPLE_CLIENT_ID", "")
+	appleVal := NewAppleTokenValidatorImpl()
+	appleVal.Client = appleServer.Client()
+	appleVal.KeysURL = appleServer.URL
+
+	_, err := appleVal.Validate(signToken("apple_key", privateKey, validClaims()))
+
+	assert.ErrorIs(t, err, ErrProviderNotSupported)
+}
+
+func TestAuthenticateUser_EmailVerified(t *testing.T) {
+	verifiedGoogleVal := &mockGoogleTokenValidator{TokenInfo: &GoogleTokenInfo{Email: "new@example.com", EmailVerified: true}}
+
+	t.Run("new_user_with_verified_email", func(t *testing.T) {
+		mockUserSvc := &mockUserService{
+			GetUserByEmailFunc: func(email string) (*models.User, error) { return nil, errors.New("user not found") },
+			SaveUserFunc: func(userBody UserBody) (*models.User, error) {
+				return &models.User{Id: 2, Email: userBody.Email, EmailVerified: userBody.EmailVerified}, nil
+			},
+		}
+		authService := NewAuthService(verifiedGoogleVal, &mockAppleTokenValidator{}, &mockTokenManager{}, mockUserSvc, &mockTokenService{}, &mockExternalLoginService{})
+
+		_, _, user, err := authService.AuthenticateUser(UserAuthenticateBody{Email: "New@example.com", ProviderToken: "google_token"})
+
+		assert.NoError(t, err)
+		assert.True(t, user.EmailVerified)
+	})
+
+	t.Run("email_other_than_the_verified_one", func(t *testing.T) {
+		mockUserSvc := &mockUserService{
+			GetUserByEmailFunc: func(email string) (*models.User, error) { return nil, errors.New("user not found") },
+			SaveUserFunc: func(userBody UserBody) (*models.User, error) {
+				return &models.User{Id: 2, Email: userBody.Email, EmailVerified: userBody.EmailVerified}, nil
+			},
+		}
+		authService := NewAuthService(verifiedGoogleVal, &mockAppleTokenValidator{}, &mockTokenManager{}, mockUserSvc, &mockTokenService{}, &mockExternalLoginService{})
+
+		_, _, user, err := authService.AuthenticateUser(UserAuthenticateBody{Email: "other@example.com", ProviderToken: "google_token"})
+
+		assert.NoError(t, err)
+		assert.False(t, user.EmailVerified)
+	})
+
+	t.Run("existing_user_gets_verified", func(t *testing.T) {
+		var verifiedUserIds []uint
+		mockUserSvc := &mockUserService{
+			GetUserByEmailFunc: func(email string) (*models.User, error) { return &models.User{Id: 1, Email: email}, nil },
+			MarkEmailVerifiedFunc: func(id uint) error {
+				verifiedUserIds = append(verifiedUserIds, id)
+				return nil
+			},
+		}
+		authService := NewAuthService(verifiedGoogleVal, &mockAppleTokenValidator{}, &mockTokenManager{}, mockUserSvc, &mockTokenService{}, &mockExternalLoginService{})
+
+		_, _, user, err := authService.AuthenticateUser(UserAuthenticateBody{Email: "new@example.com", ProviderToken: "google_token"})
+
+		assert.NoError(t, err)
+		assert.True(t, user.EmailVerified)
+		assert.Equal(t, []uint{1}, verifiedUserIds)
+	})
+
+	t.Run("verification_fails", func(t *testing.T) {
+		mockUserSvc := &mockUserService{
+			GetUserByEmailFunc:    func(email string) (*models.User, error) { return &models.User{Id: 1, Email: email}, nil },
+			MarkEmailVerifiedFunc: func(id uint) error { return errors.New("database is down") },
+		}
+		authService := NewAuthService(verifiedGoogleVal, &mockAppleTokenValidator{}, &mockTokenManager{}, mockUserSvc, &mockTokenService{}, &mockExternalLoginService{})
+
+		_, _, _, err := authService.AuthenticateUser(UserAuthenticateBody{Email: "new@example.com", ProviderToken: "google_token"})
+
+		assert.EqualError(t, err, "database is down")
+	})
+}
+
+func TestTokenResponseUserProfile(t *testing.T) {
+	user := &models.User{Id: 1, Email: "user@example.com", UserName: "user", Role: models.Standard, CreatedAt: 100, EmailVerified: true}
+
+	withUser, _ := json.Marshal(TokenResponse{AccessToken: "access", RefreshToken: "refresh", User: NewUserProfileResponse(user)})
+	withoutUser, _ := json.Marshal(TokenResponse{AccessToken: "access", RefreshToken: "refresh"})
+
+	assert.JSONEq(t, `{"accessToken":"access","refreshToken":"refresh","user":{"id":1,"email":"user@example.com","userName":"user","role":2,"emailVerified":true}}`, string(withUser))
+	assert.JSONEq(t, `{"accessToken":"access","refreshToken":"refresh"}`, string(withoutUser))
+}
+
+func TestAuthenticateUser_Signup(t *testing.T) {
+	tests := []struct {
+		name          string
+		signupEnabled string
+		inviteCodes   string
+		inviteCode    string
+		existingUser  bool
+		expectedErr   error
+	}{
+		{"Sign-up enabled by default", "", "", "", false, nil},
+		{"Sign-up closed", "false", "", "", false, ErrSignupClosed},
+		{"Sign-up closed, existing user", "false", "", "", true, nil},
+		{"Sign-up closed, valid invite code", "false", "first, second", "second", false, nil},
+		{"Sign-up closed, invalid invite code", "false", "first, second", "third", false, ErrInviteCodeInvalid},
+		{"Sign-up closed, no invite codes configured", "false", "", "first", false, ErrInviteCodeInvalid},
+	}
+
+	for _, testCase := range tests {
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Setenv("API_SIGNUP_ENABLED", testCase.signupEnabled)
+			t.Setenv("API_SIGNUP_INVITE_CODES", testCase.inviteCodes)
+
+			savedUser := false
+			mockUserSvc := &mockUserService{
+				SaveUserFunc: func(userBody UserBody) (*models.User, error) {
+					savedUser = true
+					return &models.User{Id: 2, Email: userBody.Email, UserName: userBody.UserName, Role: models.Standard}, nil
+				},
+			}
+
+			if !testCase.existingUser {
+				mockUserSvc.GetUserByEmailFunc = func(email string) (*models.User, error) {
+					return nil, errors.New("user not found")
+				}
+			}
+
+			authService := NewAuthService(
+				&mockGoogleTokenValidator{ValidateFunc: func(idToken string) error { return nil }}, &mockAppleTokenValidator{},
+				&mockTokenManager{},
+				mockUserSvc,
+				&mockTokenService{},
+				&mockExternalLoginService{},
+			)
+
+			_, _, user, err := authService.AuthenticateUser(UserAuthenticateBody{
+				Email:         "exists@example.com",
+				UserName:      "User",
+				ProviderId:    "google123",
+				ProviderToken: "valid_google_token",
+				InviteCode:    testCase.inviteCode,
+			})
+
+			if testCase.expectedErr != nil {
+				assert.ErrorIs(t, err, testCase.expectedErr)
+				assert.Nil(t, user)
+				assert.False(t, savedUser)
+			} else {
+				assert.NoError(t, err)
+				assert.NotNil(t, user)
+				assert.Equal(t, !testCase.existingUser, savedUser)
+			}
+		})
+	}
 }
@@ -1,92 +1,201 @@
 package services
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
+	"hash/fnv"
 	"log"
-	"os"
+	"maps"
 	"regexp"
+	"strings"
 	"sync"
 	"time"
 
+	"github.com/adfer-dev/analock-api/config"
+	"github.com/adfer-dev/analock-api/constants"
 	"github.com/adfer-dev/analock-api/utils"
 )
 
-var cacheServiceInstance *cacheServiceImpl
+var cacheServiceInstance CacheService
 
+// CacheService caches resources under keys built from the concatenation of resource + key.
+// Its backing is chosen with the cache backend in the config.
 type CacheService interface {
-	CacheResource(f func() (interface{}, error), resource string, key string) (interface{}, error)
-	EvictResourceItem(f CacheFunc, resource string, key string) (any, error)
-	EvictUserResource(resource string, userId int) error
+	CacheResource(f func() (interface{}, error), resource constants.CacheResource, key string, bypass bool) (interface{}, error)
+	CacheResourceOrStale(f func() (interface{}, error), resource constants.CacheResource, key string, bypass bool) (interface{}, bool, error)
+	EvictResourceItem(resource constants.CacheResource, key string)
+	EvictUserResource(resource constants.CacheResource, userId uint) error
+	EvictUserResources(resources []constants.CacheResource, userId uint) error
 }
 
 type cacheServiceImpl struct {
-	cache *cache
+	cache       *cache
+	expirations CacheExpirations
+}
+
+var _ CacheService = (*cacheServiceImpl)(nil)
+
+// CacheExpirations holds the time cached entries last, which can be overridden per resource.
+type CacheExpirations struct {
+	Default   time.Duration
+	Resources map[constants.CacheResource]time.Duration
+	// Time the entries cached by CacheResourceOrStale are kept after expiring. Zero disables serving stale entries.
+	StaleRetention time.Duration
+}
+
+// Gets the time the entries of the given resource last.
+func (expirations CacheExpirations) ForResource(resource constants.CacheResource) time.Duration {
+	if expiration, ok := expirations.Resources[resource]; ok {
+		return expiration
+	}
+
+	return expirations.Default
 }
 
 type CacheFunc func() (interface{}, error)
 
-// Gets the singleton instance of the Cache Service
-func GetCacheServiceInstance() *cacheServiceImpl {
+// Gets the singleton instance of the Cache Service.
+// It is backed by Redis if the config sets the redis cache backend, and in memory otherwise.
+func GetCacheServiceInstance() CacheService {
 	if cacheServiceInstance == nil {
-		cacheServiceInstance = NewCacheService()
+		if config.Get().Cache.Backend == constants.RedisCacheBackend {
+			cacheServiceInstance = NewRedisCacheServiceFromConfig()
+		} else {
+			cacheServiceInstance = NewCacheService()
+		}
 	}
 
 	return cacheServiceInstance
 }
 
-// Builds a new Cache Service
+// Converts a value returned by CacheResource to the given type.
+// Distributed backends return cache hits as JSON, so they are decoded into it.
+func CachedValueAs[T any](cached interface{}) (T, error) {
+	if value, ok := cached.(T); ok {
+		return value, nil
+	}
+
+	var value T
+	raw, ok := cached.(json.RawMessage)
+
+	if !ok {
+		return value, fmt.Errorf("cached value of type %T cannot be converted to %T", cached, value)
+	}
+
+	return value, json.Unmarshal(raw, &value)
+}
+
+// Builds a new in-memory Cache Service
 func NewCacheService() *cacheServiceImpl {
-	expirationTime, expirationParseErr := time.ParseDuration(os.Getenv("API_CACHE_EXPIRATION"))
-	evictionInterval, intervalParseErr := time.ParseDuration(os.Getenv("API_CACHE_EVICTION_INTERVAL"))
+	evictionInterval := config.Get().Cache.EvictionInterval
 
-	if expirationParseErr != nil {
-		log.Fatalf(
-			"Error when parsing cache exp from env variable: %s",
-			expirationParseErr.Error(),
-		)
+	if evictionInterval <= 0 {
+		log.Fatalf("Cache eviction interval must be positive, got %s", evictionInterval)
 	}
+	return &cacheServiceImpl{cache: newCache(evictionInterval), expirations: getCacheExpirations()}
+}
+
+// Gets the time cached entries last, and the per resource overrides, from the config.
+func getCacheExpirations() CacheExpirations {
+	cacheConfig := config.Get().Cache
+	resourceExpirations := map[constants.CacheResource]time.Duration{
+		// Stats change with every write, so they are only cached briefly.
+		constants.PlatformStatsCacheResource: min(cacheConfig.Expiration, constants.PlatformStatsCacheExpiration),
+	}
+	maps.Copy(resourceExpirations, cacheConfig.ResourceExpirations)
+
+	return CacheExpirations{
+		Default:        cacheConfig.Expiration,
+		Resources:      resourceExpirations,
+		StaleRetention: cacheConfig.StaleRetention,
+	}
+}
 
-	if intervalParseErr != nil {
-		log.Fatalf(
-			"Error when parsing eviction interval from env variable: %s",
-			intervalParseErr.Error(),
+// Builds the regex matching the keys of any of the given resources that belong to the given user.
+// The user key must be followed by the end of the key or a dash, so the keys of user 12 do not match user 1.
+func buildUserResourcesRegex(resources []constants.CacheResource, userId uint) (*regexp.Regexp, error) {
+	quotedResources := make([]string, 0, len(resources))
+
+	for _, resource := range resources {
+		quotedResources = append(quotedResources, regexp.QuoteMeta(string(resource)))
+	}
+
+	regex, regexErr := regexp.Compile(
+		fmt.Sprintf("^(%s)-%s($|-)", strings.Join(quotedResources, "|"), regexp.QuoteMeta(utils.BuildUserCacheKey(userId))),
+	)
+
+	if regexErr != nil {
+		utils.GetCustomLogger().Errorf(
+			"Regex error on cache evict: %s",
+			regexErr.Error(),
 		)
 	}
-	return &cacheServiceImpl{cache: newCache(expirationTime, evictionInterval)}
+
+	return regex, regexErr
 }
 
 // Caches the result of the given function or returns the already cached value if exists.
 // When caching the resource, builds a key based on the concatenation of resource + key
-func (cs *cacheServiceImpl) CacheResource(f func() (interface{}, error), resource string, key string) (interface{}, error) {
+// If bypass is set, the cached value is not returned, but it is still replaced by the function result.
+func (cs *cacheServiceImpl) CacheResource(f func() (interface{}, error), resource constants.CacheResource, key string, bypass bool) (interface{}, error) {
 	fullKey := fmt.Sprintf("%s-%s", resource, key)
-	cached, cacheErr := cs.cache.get(fullKey)
 
-	if cacheErr == nil {
-		log.Printf("CACHE HIT: key: %s, value: %+v\n", fullKey, cached)
-		return cached, nil
+	if !bypass {
+		if cached, cacheErr := cs.cache.get(fullKey); cacheErr == nil {
+			log.Printf("CACHE HIT: key: %s, value: %+v\n", fullKey, cached)
+			return cached, nil
+		}
 	}
 
 	fnRes, fnErr := f()
 
 	if fnErr == nil {
-		cs.cache.put(fullKey, fnRes)
+		cs.cache.put(fullKey, fnRes, cs.expirations.ForResource(resource), 0)
 	}
 
 	return fnRes, fnErr
 }
 
+// Caches the result of the given function or returns the already cached value if exists, like CacheResource.
+// If the function fails, the expired entry is returned instead while it is kept by the stale retention,
+// reporting the value is stale. Otherwise, the function error is returned.
+// If bypass is set, the fresh cached value is not returned, but it is still replaced by the function result.
+func (cs *cacheServiceImpl) CacheResourceOrStale(f func() (interface{}, error), resource constants.CacheResource, key string, bypass bool) (interface{}, bool, error) {
+	fullKey := fmt.Sprintf("%s-%s", resource, key)
+
+	if !bypass {
+		if cached, cacheErr := cs.cache.get(fullKey); cacheErr == nil {
+			log.Printf("CACHE HIT: key: %s, value: %+v\n", fullKey, cached)
+			return cached, false, nil
+		}
+	}
+
+	fnRes, fnErr := f()
+
+	if fnErr == nil {
+		cs.cache.put(fullKey, fnRes, cs.expirations.ForResource(resource), cs.expirations.StaleRetention)
+		return fnRes, false, nil
+	}
+
+	if stale, staleErr := cs.cache.getStale(fullKey); staleErr == nil {
+		log.Printf("CACHE STALE HIT: key: %s, value: %+v\n", fullKey, stale)
+		return stale, true, nil
+	}
+
+	return fnRes, false, fnErr
+}
+
 // Evicts all the cache entries whose keys starts with a concatenation of the given resource and user.
-func (cs *cacheServiceImpl) EvictUserResource(resource string, userId uint) error {
-	regex, regexErr := regexp.Compile(
-		fmt.Sprintf("^%s-%s*", resource, utils.BuildUserCacheKey(userId)),
-	)
+func (cs *cacheServiceImpl) EvictUserResource(resource constants.CacheResource, userId uint) error {
+	return cs.EvictUserResources([]constants.CacheResource{resource}, userId)
+}
+
+// Evicts the cache entries of the given user for all the given resources, sweeping the cache once.
+func (cs *cacheServiceImpl) EvictUserResources(resources []constants.CacheResource, userId uint) error {
+	regex, regexErr := buildUserResourcesRegex(resources, userId)
 
 	if regexErr != nil {
-		utils.GetCustomLogger().Errorf(
-			"Regex error on cache evict: %s",
-			regexErr.Error(),
-		)
 		return regexErr
 	}
 
@@ -96,39 +205,85 @@ func (cs *cacheServiceImpl) EvictUserResource(resource string, userId uint) erro
 }
 
 // Evicts the cache entry holding the key that results from the concatenation of resource + key params.
-func (cs *cacheServiceImpl) EvictResourceItem(resource string, key string) {
+func (cs *cacheServiceImpl) EvictResourceItem(resource constants.CacheResource, key string) {
 	cs.cache.delete(fmt.Sprintf("%s-%s", resource, key))
 }
 
+// Number of shards the in-memory cache entries are split into.
+// Each shard has its own lock, so evicting the entries of a shard does not block the other shards.
+const cacheShardCount = 16
+
 type cache struct {
-	entries        map[string]*cacheEntry
-	evicter        *cacheEvicter
-	mutex          sync.Mutex
-	expirationTime time.Duration
+	shards  []*cacheShard
+	evicter *cacheEvicter
+}
+
+type cacheShard struct {
+	entries map[string]*cacheEntry
+	mutex   sync.Mutex
 }
 
 type cacheEntry struct {
-	entry interface{}
-	time  time.Time
+	entry     interface{}
+	expiresAt time.Time
+	// Time the entry is evicted at, which is later than its expiration if it is kept to be served stale.
+	evictsAt time.Time
 }
 
-// Adds a new entry to the cache having the given key and value.
-func (cache *cache) put(key string, value interface{}) {
+// Counts of a cache eviction run, logged to spot runs that hold the locks for long.
+type cacheEvictionStats struct {
+	Scanned  int
+	Evicted  int
+	Duration time.Duration
+	// Longest time the lock of a shard was held, during which reads and writes to that shard waited.
+	MaxLockHold time.Duration
+}
+
+// Gets the shard holding the entry with the given key.
+func (cache *cache) shard(key string) *cacheShard {
+	hash := fnv.New32a()
+	hash.Write([]byte(key))
+
+	return cache.shards[hash.Sum32()%uint32(len(cache.shards))]
+}
+
+// Adds a new entry to the cache having the given key and value, which expires after the given time.
+// The expired entry is kept for the given stale retention before being evicted.
+func (cache *cache) put(key string, value interface{}, expiration time.Duration, staleRetention time.Duration) {
 	log.Printf("CACHE PUT: key: %s, value: %+v\n", key, value)
-	cache.mutex.Lock()
-	cache.entries[key] = &cacheEntry{entry: value, time: time.Now()}
-	cache.mutex.Unlock()
+	expiresAt := time.Now().Add(expiration)
+	shard := cache.shard(key)
+	shard.mutex.Lock()
+	shard.entries[key] = &cacheEntry{entry: value, expiresAt: expiresAt, evictsAt: expiresAt.Add(staleRetention)}
+	shard.mutex.Unlock()
 }
 
 // Gets the value of the entry with the given key.
-// Returns error if no entry with that key was found.
+// Returns error if no entry with that key was found, or it has expired.
 func (cache *cache) get(key string) (interface{}, error) {
-	cache.mutex.Lock()
-	defer cache.mutex.Unlock()
+	shard := cache.shard(key)
+	shard.mutex.Lock()
+	defer shard.mutex.Unlock()
 
-	result, present := cache.entries[key]
+	result, present := shard.entries[key]
 
-	if !present {
+	if !present || time.Now().After(result.expiresAt) {
+		return nil, errors.New("cache entry is not present")
+	}
+
+	return result.entry, nil
+}
+
+// Gets the value of the entry with the given key, even if it has expired, until it is evicted.
+// Returns error if no entry with that key was found.
+func (cache *cache) getStale(key string) (interface{}, error) {
+	shard := cache.shard(key)
+	shard.mutex.Lock()
+	defer shard.mutex.Unlock()
+
+	result, present := shard.entries[key]
+
+	if !present || time.Now().After(result.evictsAt) {
 		return nil, errors.New("cache entry is not present")
 	}
 
@@ -138,45 +293,77 @@ func (cache *cache) get(key string) (interface{}, error) {
 // Deletes the entry that matches the given key from the cache.
 func (cache *cache) delete(key string) {
 	log.Printf("DELETE FROM CACHE: key: %s\n", key)
-	cache.mutex.Lock()
-	delete(cache.entries, key)
-	cache.mutex.Unlock()
+	shard := cache.shard(key)
+	shard.mutex.Lock()
+	delete(shard.entries, key)
+	shard.mutex.Unlock()
 }
 
 // Deletes the entries whose keys match the given regex pattern.
 func (cache *cache) deleteIfMatches(regex *regexp.Regexp) {
 	log.Printf("DELETE FROM CACHE: regex: %s\n", regex.String())
-	cache.mutex.Lock()
-	defer cache.mutex.Unlock()
 
-	for key := range cache.entries {
-		if regex.MatchString(key) {
-			delete(cache.entries, key)
+	for _, shard := range cache.shards {
+		shard.mutex.Lock()
+
+		for key := range shard.entries {
+			if regex.MatchString(key) {
+				delete(shard.entries, key)
+			}
 		}
+
+		shard.mutex.Unlock()
 	}
 }
 
-// Handles the eviction of expired cache entries.
-func (cache *cache) handleEviction(currentTime time.Time) {
-	utils.GetCustomLogger().Info("Running cache eviction...")
-	cache.mutex.Lock()
-	defer cache.mutex.Unlock()
-
-	for key, value := range cache.entries {
-		if currentTime.After(value.time.Add(cache.expirationTime)) {
-			utils.GetCustomLogger().Infof("Evicting %s\n", key)
-			delete(cache.entries, key)
+// Handles the eviction of expired cache entries, once their stale retention has also passed.
+// The shards are swept one at a time, so only the entries of the shard being swept are locked.
+func (cache *cache) handleEviction(currentTime time.Time) cacheEvictionStats {
+	stats := cacheEvictionStats{}
+	start := time.Now()
+
+	for _, shard := range cache.shards {
+		shard.mutex.Lock()
+		lockedAt := time.Now()
+		stats.Scanned += len(shard.entries)
+
+		for key, value := range shard.entries {
+			if currentTime.After(value.evictsAt) {
+				delete(shard.entries, key)
+				stats.Evicted++
+			}
 		}
+
+		stats.MaxLockHold = max(stats.MaxLockHold, time.Since(lockedAt))
+		shard.mutex.Unlock()
 	}
+
+	stats.Duration = time.Since(start)
+	utils.GetCustomLogger().Debugf(
+		"Cache eviction run took %s holding a lock up to %s, scanned %d entries and evicted %d\n",
+		stats.Duration,
+		stats.MaxLockHold,
+		stats.Scanned,
+		stats.Evicted,
+	)
+
+	return stats
 }
 
 // Builds a new cache and runs the eviction thread
-func newCache(expirationTime time.Duration, evictionInterval time.Duration) *cache {
-	cache := &cache{}
-	evicter := &cacheEvicter{exitChannel: make(chan int), evictionInterval: evictionInterval}
-	cache.entries = make(map[string]*cacheEntry)
-	cache.expirationTime = expirationTime
-	cache.evicter = evicter
+func newCache(evictionInterval time.Duration) *cache {
+	return newShardedCache(evictionInterval, cacheShardCount)
+}
+
+// Builds a new cache whose entries are split into the given number of shards, and runs the eviction thread
+func newShardedCache(evictionInterval time.Duration, shardCount int) *cache {
+	cache := &cache{shards: make([]*cacheShard, shardCount)}
+
+	for i := range cache.shards {
+		cache.shards[i] = &cacheShard{entries: make(map[string]*cacheEntry)}
+	}
+
+	cache.evicter = &cacheEvicter{exitChannel: make(chan int), evictionInterval: evictionInterval}
 	go cache.evicter.Run(cache)
 
 	return cache
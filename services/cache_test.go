@@ -1,13 +1,18 @@
 package services
 
 import (
+	"errors"
+	"fmt"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/adfer-dev/analock-api/constants"
 	"github.com/adfer-dev/analock-api/models"
+	"github.com/adfer-dev/analock-api/utils"
 )
 
-var cacheService = &cacheServiceImpl{cache: newCache(5*time.Minute, 1*time.Minute)}
+var cacheService = &cacheServiceImpl{cache: newCache(1 * time.Minute), expirations: CacheExpirations{Default: 5 * time.Minute}}
 
 func TestCacheResource(t *testing.T) {
 	cacheService.CacheResource(func() (interface{}, error) {
@@ -21,7 +26,7 @@ func TestCacheResource(t *testing.T) {
 				UserRefer:        1,
 			},
 		}, nil
-	}, "diaryEntries", "user-1")
+	}, "diaryEntries", "user-1", false)
 
 	_, err := cacheService.cache.get("diaryEntries-user-1")
 
@@ -30,6 +35,38 @@ func TestCacheResource(t *testing.T) {
 	}
 }
 
+func TestCacheResourceBypass(t *testing.T) {
+	bypassCacheService := &cacheServiceImpl{cache: newCache(1 * time.Minute), expirations: CacheExpirations{Default: 5 * time.Minute}}
+	calls := 0
+	getValue := func() (interface{}, error) {
+		calls++
+		return fmt.Sprintf("value-%d", calls), nil
+	}
+
+	bypassCacheService.CacheResource(getValue, "diaryEntries", "user-1", false)
+
+	// Test case: Bypassing the cache calls the function and repopulates the cache with its result
+	if value, err := bypassCacheService.CacheResource(getValue, "diaryEntries", "user-1", true); err != nil || value != "value-2" {
+		t.Fatalf("Cache was not bypassed, got %v, error %v", value, err)
+	}
+
+	// Test case: Later reads are served the refreshed value
+	if value, err := bypassCacheService.CacheResource(getValue, "diaryEntries", "user-1", false); err != nil || value != "value-2" || calls != 2 {
+		t.Fatalf("Refreshed value not cached, got %v after %d calls, error %v", value, calls, err)
+	}
+
+	// Test case: Bypassing a stale resource also repopulates it
+	bypassCacheService.CacheResourceOrStale(getValue, "iaBookSearch", "query", false)
+
+	if value, stale, err := bypassCacheService.CacheResourceOrStale(getValue, "iaBookSearch", "query", true); err != nil || stale || value != "value-4" {
+		t.Fatalf("Stale resource cache was not bypassed, got %v, stale %t, error %v", value, stale, err)
+	}
+
+	if cached, err := bypassCacheService.cache.get("iaBookSearch-query"); err != nil || cached != "value-4" {
+		t.Fatalf("Refreshed stale resource not cached, got %v, error %v", cached, err)
+	}
+}
+
 func TestEvictCacheResource(t *testing.T) {
 	cacheService.EvictResourceItem("diaryEntries", "user-1")
 
@@ -39,3 +76,281 @@ func TestEvictCacheResource(t *testing.T) {
 		t.Fatal("Entry is still cached")
 	}
 }
+
+func TestCacheResourceExpirations(t *testing.T) {
+	resourceCacheService := &cacheServiceImpl{
+		cache: newCache(1 * time.Minute),
+		expirations: CacheExpirations{
+			Default:   5 * time.Minute,
+			Resources: map[constants.CacheResource]time.Duration{"iaBookMetadata": 6 * time.Hour},
+		},
+	}
+	getValue := func() (interface{}, error) { return "value", nil }
+
+	resourceCacheService.CacheResource(getValue, "diaryEntries", "user-1", false)
+	resourceCacheService.CacheResource(getValue, "iaBookMetadata", "book-1", false)
+
+	resourceCacheService.cache.handleEviction(time.Now().Add(10 * time.Minute))
+
+	if _, err := resourceCacheService.cache.get("diaryEntries-user-1"); err == nil {
+		t.Fatal("Entry with default expiration is still cached")
+	}
+
+	if _, err := resourceCacheService.cache.get("iaBookMetadata-book-1"); err != nil {
+		t.Fatal("Entry with resource expiration is not cached")
+	}
+
+	resourceCacheService.cache.handleEviction(time.Now().Add(7 * time.Hour))
+
+	if _, err := resourceCacheService.cache.get("iaBookMetadata-book-1"); err == nil {
+		t.Fatal("Entry with resource expiration is still cached")
+	}
+}
+
+func TestGetCacheExpirationsPlatformStats(t *testing.T) {
+	t.Setenv("API_CACHE_EXPIRATION", "1h")
+
+	if expiration := getCacheExpirations().ForResource(constants.PlatformStatsCacheResource); expiration != constants.PlatformStatsCacheExpiration {
+		t.Fatalf("Expected platform stats to be cached for %s by default, got %s", constants.PlatformStatsCacheExpiration, expiration)
+	}
+
+	t.Setenv("API_CACHE_EXPIRATION", "10s")
+
+	if expiration := getCacheExpirations().ForResource(constants.PlatformStatsCacheResource); expiration != 10*time.Second {
+		t.Fatalf("Expected platform stats not to be cached longer than other resources, got %s", expiration)
+	}
+
+	t.Setenv("API_CACHE_RESOURCE_EXPIRATIONS", "platformStats=5m")
+
+	if expiration := getCacheExpirations().ForResource(constants.PlatformStatsCacheResource); expiration != 5*time.Minute {
+		t.Fatalf("Expected the configured platform stats expiration to be used, got %s", expiration)
+	}
+}
+
+func TestEvictUserResources(t *testing.T) {
+	userCacheService := &cacheServiceImpl{cache: newCache(1 * time.Minute), expirations: CacheExpirations{Default: 5 * time.Minute}}
+	getValue := func() (interface{}, error) { return "value", nil }
+	keys := []string{
+		"diaryEntries-user-1",
+		"diaryEntries-user-1-summary",
+		"diaryEntries-user-1-start1-end2",
+		"diaryEntries-user-12",
+		"diaryEntries-user-2",
+		"bookActivityRegistrations-user-1",
+		"gameActivityRegistrations-user-1",
+	}
+
+	for _, key := range keys {
+		resource, userKey, _ := strings.Cut(key, "-")
+		userCacheService.CacheResource(getValue, constants.CacheResource(resource), userKey, false)
+	}
+
+	if err := userCacheService.EvictUserResources([]constants.CacheResource{"diaryEntries", "bookActivityRegistrations"}, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	expectedCached := map[string]bool{
+		"diaryEntries-user-1":              false,
+		"diaryEntries-user-1-summary":      false,
+		"diaryEntries-user-1-start1-end2":  false,
+		"diaryEntries-user-12":             true,
+		"diaryEntries-user-2":              true,
+		"bookActivityRegistrations-user-1": false,
+		"gameActivityRegistrations-user-1": true,
+	}
+
+	for key, cached := range expectedCached {
+		if _, err := userCacheService.cache.get(key); (err == nil) != cached {
+			t.Errorf("entry %s cached = %v, want %v", key, err == nil, cached)
+		}
+	}
+}
+
+func TestEvictUserResourceDoesNotMatchOtherUsers(t *testing.T) {
+	userCacheService := &cacheServiceImpl{cache: newCache(1 * time.Minute), expirations: CacheExpirations{Default: 5 * time.Minute}}
+	getValue := func() (interface{}, error) { return "value", nil }
+
+	userCacheService.CacheResource(getValue, "diaryEntries", "user-1", false)
+	userCacheService.CacheResource(getValue, "diaryEntries", "user-10", false)
+	userCacheService.CacheResource(getValue, "diaryEntries", "user-3", false)
+
+	if err := userCacheService.EvictUserResource("diaryEntries", 1); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := userCacheService.cache.get("diaryEntries-user-1"); err == nil {
+		t.Error("Entry of the user is still cached")
+	}
+
+	for _, key := range []string{"diaryEntries-user-10", "diaryEntries-user-3"} {
+		if _, err := userCacheService.cache.get(key); err != nil {
+			t.Errorf("Entry %s of another user was evicted", key)
+		}
+	}
+}
+
+func TestEvictUserResourceDateRangeKeys(t *testing.T) {
+	userCacheService := &cacheServiceImpl{cache: newCache(1 * time.Minute), expirations: CacheExpirations{Default: 5 * time.Minute}}
+	getValue := func() (interface{}, error) { return "value", nil }
+	evictedKeys := []string{
+		utils.BuildUserCacheKey(1),
+		utils.BuildUserSummaryCacheKey(1),
+		utils.BuildUserDateRangeCacheKey(1, 100, 200),
+		utils.BuildUserCalendarCacheKey(1, 100, 200, "Europe/Madrid"),
+	}
+	keptKeys := []string{
+		utils.BuildUserDateRangeCacheKey(12, 100, 200),
+		utils.BuildUserCalendarCacheKey(11, 100, 200, "UTC"),
+	}
+
+	for _, key := range append(evictedKeys, keptKeys...) {
+		userCacheService.CacheResource(getValue, constants.DiaryEntriesCacheResource, key, false)
+	}
+
+	if err := userCacheService.EvictUserResource(constants.DiaryEntriesCacheResource, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, key := range evictedKeys {
+		if _, err := userCacheService.cache.get(string(constants.DiaryEntriesCacheResource) + "-" + key); err == nil {
+			t.Errorf("Entry %s is still cached", key)
+		}
+	}
+
+	for _, key := range keptKeys {
+		if _, err := userCacheService.cache.get(string(constants.DiaryEntriesCacheResource) + "-" + key); err != nil {
+			t.Errorf("Entry %s of another user was evicted", key)
+		}
+	}
+}
+
+func TestBuildUserResourcesRegexEscapesKeys(t *testing.T) {
+	regex, err := buildUserResourcesRegex([]constants.CacheResource{"diary.entries"}, 1)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !regex.MatchString("diary.entries-user-1-start1-end2") {
+		t.Error("Regex does not match the resource")
+	}
+
+	if regex.MatchString("diaryXentries-user-1") {
+		t.Error("Regex does not escape the resource")
+	}
+}
+
+func TestCacheResourceOrStale(t *testing.T) {
+	staleCacheService := &cacheServiceImpl{
+		cache:       newCache(1 * time.Minute),
+		expirations: CacheExpirations{Default: 5 * time.Minute, StaleRetention: time.Hour},
+	}
+	failingValue := func() (interface{}, error) { return nil, errors.New("upstream failed") }
+
+	staleCacheService.CacheResourceOrStale(func() (interface{}, error) { return "value", nil }, "iaBookSearch", "query", false)
+
+	// Test case: The entry is served while it has not expired, without calling the function
+	if value, stale, err := staleCacheService.CacheResourceOrStale(failingValue, "iaBookSearch", "query", false); err != nil || stale || value != "value" {
+		t.Fatalf("Fresh entry not served, got %v, stale %t, error %v", value, stale, err)
+	}
+
+	staleCacheService.cache.shard("iaBookSearch-query").entries["iaBookSearch-query"].expiresAt = time.Now().Add(-time.Minute)
+
+	// Test case: The expired entry is served stale when the function fails
+	if value, stale, err := staleCacheService.CacheResourceOrStale(failingValue, "iaBookSearch", "query", false); err != nil || !stale || value != "value" {
+		t.Fatalf("Stale entry not served, got %v, stale %t, error %v", value, stale, err)
+	}
+
+	// Test case: The expired entry is kept until its stale retention passes
+	staleCacheService.cache.handleEviction(time.Now().Add(30 * time.Minute))
+
+	if _, err := staleCacheService.cache.getStale("iaBookSearch-query"); err != nil {
+		t.Fatal("Entry was evicted within its stale retention")
+	}
+
+	staleCacheService.cache.handleEviction(time.Now().Add(2 * time.Hour))
+
+	// Test case: The function error is returned once the entry is evicted
+	if _, stale, err := staleCacheService.CacheResourceOrStale(failingValue, "iaBookSearch", "query", false); err == nil || stale {
+		t.Fatal("Evicted entry was served stale")
+	}
+}
+
+func TestCacheResourceOrStaleWithoutRetention(t *testing.T) {
+	failingValue := func() (interface{}, error) { return nil, errors.New("upstream failed") }
+
+	cacheService.CacheResourceOrStale(func() (interface{}, error) { return "value", nil }, "iaBookSearch", "no-retention", false)
+	cacheService.cache.shard("iaBookSearch-no-retention").entries["iaBookSearch-no-retention"].expiresAt = time.Now().Add(-time.Minute)
+	cacheService.cache.shard("iaBookSearch-no-retention").entries["iaBookSearch-no-retention"].evictsAt = time.Now().Add(-time.Minute)
+
+	if _, stale, err := cacheService.CacheResourceOrStale(failingValue, "iaBookSearch", "no-retention", false); err == nil || stale {
+		t.Fatal("Expired entry was served stale without stale retention")
+	}
+}
+
+func TestCacheEvictionStats(t *testing.T) {
+	evictionCache := newCache(1 * time.Minute)
+	evictionCache.put("diaryEntries-user-1", "value", time.Minute, 0)
+	evictionCache.put("diaryEntries-user-2", "value", time.Minute, 0)
+	evictionCache.put("iaBookMetadata-book-1", "value", time.Hour, 0)
+
+	stats := evictionCache.handleEviction(time.Now().Add(10 * time.Minute))
+
+	if stats.Scanned != 3 || stats.Evicted != 2 {
+		t.Fatalf("Expected 3 entries scanned and 2 evicted, got %d and %d", stats.Scanned, stats.Evicted)
+	}
+
+	if _, err := evictionCache.get("iaBookMetadata-book-1"); err != nil {
+		t.Fatal("Entry that has not expired was evicted")
+	}
+}
+
+// Measures cache reads while eviction runs sweep a large cache back to back, along with the longest time
+// an eviction run holds a lock. With a single shard, as with a global lock, reads wait for whole sweeps.
+func BenchmarkCacheGetDuringEviction(b *testing.B) {
+	const entryCount = 100000
+
+	for _, shardCount := range []int{1, cacheShardCount} {
+		b.Run(fmt.Sprintf("shards_%d", shardCount), func(b *testing.B) {
+			benchmarkCache := newShardedCache(time.Hour, shardCount)
+			defer benchmarkCache.evicter.Stop()
+
+			// Filled without put, which logs each entry
+			for i := 0; i < entryCount; i++ {
+				key := fmt.Sprintf("key-%d", i)
+				benchmarkCache.shard(key).entries[key] = &cacheEntry{entry: i, expiresAt: time.Now().Add(time.Hour), evictsAt: time.Now().Add(time.Hour)}
+			}
+
+			stopEviction := make(chan struct{})
+			evictionDone := make(chan struct{})
+			var maxLockHold time.Duration
+
+			go func() {
+				defer close(evictionDone)
+
+				for {
+					select {
+					case <-stopEviction:
+						return
+					default:
+						maxLockHold = max(maxLockHold, benchmarkCache.handleEviction(time.Now()).MaxLockHold)
+					}
+				}
+			}()
+
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				i := 0
+				for pb.Next() {
+					benchmarkCache.get(fmt.Sprintf("key-%d", i%entryCount))
+					i++
+				}
+			})
+			b.StopTimer()
+
+			close(stopEviction)
+			<-evictionDone
+			b.ReportMetric(float64(maxLockHold.Microseconds()), "max-lock-hold-µs")
+		})
+	}
+}
@@ -0,0 +1,149 @@
+package services
+
+import (
+	"sync"
+	"time"
+
+	"github.com/adfer-dev/analock-api/config"
+	"github.com/adfer-dev/analock-api/utils"
+)
+
+type circuitState int
+
+const (
+	circuitClosed circuitState = iota
+	circuitOpen
+	circuitHalfOpen
+)
+
+// CircuitBreakerConfig holds the thresholds a circuit breaker opens and closes by.
+type CircuitBreakerConfig struct {
+	// Consecutive failures within the failure window that open the circuit. Zero disables the breaker.
+	FailureThreshold uint
+	FailureWindow    time.Duration
+	// Time the circuit stays open before letting a probe call through.
+	Cooldown time.Duration
+}
+
+// CircuitBreaker short-circuits the calls to an upstream service after several consecutive failures,
+// so a service that is down is not flooded with requests.
+//
+// Once the cooldown has passed, a single probe call is let through: the circuit is closed again if it succeeds,
+// and opened for another cooldown otherwise.
+type CircuitBreaker struct {
+	lock           sync.Mutex
+	config         CircuitBreakerConfig
+	state          circuitState
+	failures       uint
+	firstFailureAt time.Time
+	openedAt       time.Time
+	now            func() time.Time
+}
+
+// Creates a closed circuit breaker with the given thresholds.
+func NewCircuitBreaker(config CircuitBreakerConfig) *CircuitBreaker {
+	return &CircuitBreaker{config: config, now: time.Now}
+}
+
+// Checks whether a call to the upstream service can be made.
+// Returns ErrUpstreamUnavailable if the circuit is open, or half-open with a probe call already in flight.
+func (breaker *CircuitBreaker) Allow() error {
+	if breaker.config.FailureThreshold == 0 {
+		return nil
+	}
+
+	breaker.lock.Lock()
+	defer breaker.lock.Unlock()
+
+	switch breaker.state {
+	case circuitOpen:
+		if breaker.now().Sub(breaker.openedAt) < breaker.config.Cooldown {
+			return ErrUpstreamUnavailable
+		}
+
+		utils.GetCustomLogger().Info("Circuit breaker half-open, probing upstream service")
+		breaker.state = circuitHalfOpen
+		return nil
+	case circuitHalfOpen:
+		return ErrUpstreamUnavailable
+	default:
+		return nil
+	}
+}
+
+// Records a successful call, closing the circuit.
+func (breaker *CircuitBreaker) RecordSuccess() {
+	breaker.lock.Lock()
+	defer breaker.lock.Unlock()
+
+	if breaker.state != circuitClosed {
+		utils.GetCustomLogger().Info("Circuit breaker closed")
+	}
+
+	breaker.state = circuitClosed
+	breaker.failures = 0
+}
+
+// Records a failed call, opening the circuit if the probe call failed
+// or the failure threshold is reached within the failure window.
+func (breaker *CircuitBreaker) RecordFailure() {
+	if breaker.config.FailureThreshold == 0 {
+		return
+	}
+
+	breaker.lock.Lock()
+	defer breaker.lock.Unlock()
+
+	now := breaker.now()
+
+	switch breaker.state {
+	case circuitHalfOpen:
+		breaker.open(now)
+	case circuitClosed:
+		if breaker.failures == 0 || now.Sub(breaker.firstFailureAt) > breaker.config.FailureWindow {
+			breaker.failures = 0
+			breaker.firstFailureAt = now
+		}
+
+		breaker.failures++
+
+		if breaker.failures >= breaker.config.FailureThreshold {
+			breaker.open(now)
+		}
+	}
+}
+
+// Opens the circuit at the given time. The caller must hold the lock.
+func (breaker *CircuitBreaker) open(now time.Time) {
+	utils.GetCustomLogger().Errorf(
+		"Circuit breaker open for %s after %d consecutive failures\n",
+		breaker.config.Cooldown,
+		breaker.failures,
+	)
+	breaker.state = circuitOpen
+	breaker.openedAt = now
+	breaker.failures = 0
+}
+
+var internetArchiveCircuitBreaker *CircuitBreaker
+var internetArchiveCircuitBreakerOnce sync.Once
+
+// Gets the circuit breaker shared by all the calls to the Internet Archive API.
+func getInternetArchiveCircuitBreaker() *CircuitBreaker {
+	internetArchiveCircuitBreakerOnce.Do(func() {
+		internetArchiveCircuitBreaker = NewCircuitBreaker(getCircuitBreakerConfig())
+	})
+
+	return internetArchiveCircuitBreaker
+}
+
+// Gets the circuit breaker thresholds from the config.
+func getCircuitBreakerConfig() CircuitBreakerConfig {
+	internetArchiveConfig := config.Get().InternetArchive
+
+	return CircuitBreakerConfig{
+		FailureThreshold: internetArchiveConfig.BreakerFailureThreshold,
+		FailureWindow:    internetArchiveConfig.BreakerFailureWindow,
+		Cooldown:         internetArchiveConfig.BreakerCooldown,
+	}
+}
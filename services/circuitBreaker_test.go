@@ -0,0 +1,114 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/adfer-dev/analock-api/config"
+	"github.com/stretchr/testify/assert"
+)
+
+// Builds a circuit breaker whose clock is moved by the returned function.
+func newTestCircuitBreaker(config CircuitBreakerConfig) (*CircuitBreaker, func(time.Duration)) {
+	now := time.Unix(0, 0)
+	breaker := NewCircuitBreaker(config)
+	breaker.now = func() time.Time { return now }
+
+	return breaker, func(elapsed time.Duration) { now = now.Add(elapsed) }
+}
+
+func TestCircuitBreakerOpensAfterConsecutiveFailures(t *testing.T) {
+	t.Parallel()
+	breaker, _ := newTestCircuitBreaker(CircuitBreakerConfig{FailureThreshold: 3, FailureWindow: time.Minute, Cooldown: 30 * time.Second})
+
+	for i := 0; i < 2; i++ {
+		assert.NoError(t, breaker.Allow())
+		breaker.RecordFailure()
+	}
+
+	assert.NoError(t, breaker.Allow())
+	breaker.RecordFailure()
+
+	assert.ErrorIs(t, breaker.Allow(), ErrUpstreamUnavailable)
+}
+
+func TestCircuitBreakerSuccessResetsFailures(t *testing.T) {
+	t.Parallel()
+	breaker, _ := newTestCircuitBreaker(CircuitBreakerConfig{FailureThreshold: 2, FailureWindow: time.Minute, Cooldown: 30 * time.Second})
+
+	breaker.RecordFailure()
+	breaker.RecordSuccess()
+	breaker.RecordFailure()
+
+	assert.NoError(t, breaker.Allow())
+}
+
+func TestCircuitBreakerFailuresOutsideWindow(t *testing.T) {
+	t.Parallel()
+	breaker, advance := newTestCircuitBreaker(CircuitBreakerConfig{FailureThreshold: 2, FailureWindow: time.Minute, Cooldown: 30 * time.Second})
+
+	breaker.RecordFailure()
+	advance(2 * time.Minute)
+	breaker.RecordFailure()
+
+	assert.NoError(t, breaker.Allow())
+
+	breaker.RecordFailure()
+
+	assert.ErrorIs(t, breaker.Allow(), ErrUpstreamUnavailable)
+}
+
+func TestCircuitBreakerHalfOpen(t *testing.T) {
+	t.Parallel()
+
+	t.Run("probe_succeeds", func(t *testing.T) {
+		t.Parallel()
+		breaker, advance := newTestCircuitBreaker(CircuitBreakerConfig{FailureThreshold: 1, FailureWindow: time.Minute, Cooldown: 30 * time.Second})
+
+		breaker.RecordFailure()
+		advance(10 * time.Second)
+		assert.ErrorIs(t, breaker.Allow(), ErrUpstreamUnavailable)
+
+		advance(20 * time.Second)
+		assert.NoError(t, breaker.Allow())
+		assert.ErrorIs(t, breaker.Allow(), ErrUpstreamUnavailable, "only one probe is let through")
+
+		breaker.RecordSuccess()
+		assert.NoError(t, breaker.Allow())
+		assert.NoError(t, breaker.Allow())
+	})
+
+	t.Run("probe_fails", func(t *testing.T) {
+		t.Parallel()
+		breaker, advance := newTestCircuitBreaker(CircuitBreakerConfig{FailureThreshold: 1, FailureWindow: time.Minute, Cooldown: 30 * time.Second})
+
+		breaker.RecordFailure()
+		advance(30 * time.Second)
+		assert.NoError(t, breaker.Allow())
+
+		breaker.RecordFailure()
+		assert.ErrorIs(t, breaker.Allow(), ErrUpstreamUnavailable)
+
+		advance(30 * time.Second)
+		assert.NoError(t, breaker.Allow())
+	})
+}
+
+func TestCircuitBreakerDisabled(t *testing.T) {
+	t.Parallel()
+	breaker, _ := newTestCircuitBreaker(CircuitBreakerConfig{})
+
+	for i := 0; i < 10; i++ {
+		breaker.RecordFailure()
+	}
+
+	assert.NoError(t, breaker.Allow())
+}
+
+func TestGetCircuitBreakerConfig(t *testing.T) {
+	t.Setenv("API_IA_BREAKER_FAILURE_THRESHOLD", "3")
+	t.Setenv("API_IA_BREAKER_FAILURE_WINDOW", "2m")
+	t.Setenv("API_IA_BREAKER_COOLDOWN", "not a duration")
+
+	assert.Equal(t, CircuitBreakerConfig{FailureThreshold: 3, FailureWindow: 2 * time.Minute, Cooldown: config.DefaultCircuitBreakerCooldown}, getCircuitBreakerConfig())
+}
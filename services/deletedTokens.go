@@ -0,0 +1,43 @@
+package services
+
+import (
+	"sync"
+	"time"
+)
+
+// Values of recently deleted or replaced tokens, each kept until its grace period ends.
+type deletedTokenSet struct {
+	lock        sync.Mutex
+	expirations map[string]time.Time
+}
+
+func newDeletedTokenSet() *deletedTokenSet {
+	return &deletedTokenSet{expirations: make(map[string]time.Time)}
+}
+
+// Adds the given token value until the given time.
+// The values whose grace period has ended are removed, so the set only holds the recently deleted ones.
+func (set *deletedTokenSet) Add(tokenValue string, expiresAt time.Time) {
+	set.lock.Lock()
+	defer set.lock.Unlock()
+
+	now := time.Now()
+
+	for value, expiration := range set.expirations {
+		if !now.Before(expiration) {
+			delete(set.expirations, value)
+		}
+	}
+
+	set.expirations[tokenValue] = expiresAt
+}
+
+// Checks whether the given token value was deleted and its grace period has not ended yet.
+func (set *deletedTokenSet) Contains(tokenValue string) bool {
+	set.lock.Lock()
+	defer set.lock.Unlock()
+
+	expiration, exists := set.expirations[tokenValue]
+
+	return exists && time.Now().Before(expiration)
+}
@@ -1,37 +1,102 @@
 package services
 
 import (
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/adfer-dev/analock-api/config"
+	"github.com/adfer-dev/analock-api/constants"
 	"github.com/adfer-dev/analock-api/models"
 	"github.com/adfer-dev/analock-api/storage"
+	"github.com/adfer-dev/analock-api/utils"
 )
 
 type SaveDiaryEntryBody struct {
-	Title       string `json:"title" validate:"required"`
-	Content     string `json:"content" validate:"required"`
-	PublishDate int64  `json:"publishDate" validate:"required"`
+	Title   string `json:"title" validate:"required,diarytitle"`
+	Content string `json:"content" validate:"required"`
+	// Unix seconds.
+	PublishDate int64 `json:"publishDate" validate:"required,unixseconds"`
 }
 
 type UpdateDiaryEntryBody struct {
-	Title       string `json:"title" validate:"required"`
-	Content     string `json:"content" validate:"required"`
-	PublishDate int64  `json:"publishDate" validate:"required"`
+	Title   string `json:"title" validate:"required,diarytitle"`
+	Content string `json:"content" validate:"required"`
+	// Unix seconds.
+	PublishDate int64 `json:"publishDate" validate:"required,unixseconds"`
 }
 
-var diaryEntryStorage storage.DiaryEntryStorageInterface = &storage.DiaryEntryStorage{}
+type ImportDiaryEntryError struct {
+	Index  int      `json:"index"`
+	Errors []string `json:"errors"`
+}
+
+type ImportDiaryEntriesResponse struct {
+	Imported int                      `json:"imported"`
+	Failed   int                      `json:"failed"`
+	Entries  []*models.DiaryEntry     `json:"entries"`
+	Errors   []*ImportDiaryEntryError `json:"errors"`
+}
+
+// Result of validating an entry of a batch to import, without importing it.
+type DiaryEntryValidation struct {
+	Index  int      `json:"index"`
+	Valid  bool     `json:"valid"`
+	Errors []string `json:"errors"`
+}
 
 type DiaryEntryService interface {
 	GetDiaryEntryById(id uint) (*models.DiaryEntry, error)
 	GetUserEntries(userId uint) ([]*models.DiaryEntry, error)
+	StreamUserEntries(userId uint, yield func(diaryEntry *models.DiaryEntry) error) error
 	GetUserEntriesTimeRange(userId uint, startDate int64, endDate int64) ([]*models.DiaryEntry, error)
-	SaveDiaryEntry(diaryEntryBody *SaveDiaryEntryBody, userId uint) (*models.DiaryEntry, error)
-	UpdateDiaryEntry(diaryEntryId uint, diaryEntryBody *UpdateDiaryEntryBody) (*models.DiaryEntry, error)
+	GetUserEntrySummaries(userId uint) ([]*models.DiaryEntrySummary, error)
+	GetUserEntrySummariesTimeRange(userId uint, startDate int64, endDate int64) ([]*models.DiaryEntrySummary, error)
+	GetUserEntrySummariesByDay(userId uint, startDate int64, endDate int64, location *time.Location) (map[string][]*models.DiaryEntrySummary, error)
+	GetUserEntriesOnThisDay(userId uint, now time.Time) (map[string][]*models.DiaryEntry, error)
+	SaveDiaryEntry(diaryEntryBody *SaveDiaryEntryBody, userId uint, location *time.Location) (*models.DiaryEntry, error)
+	ImportDiaryEntries(diaryEntryBodies []*SaveDiaryEntryBody, userId uint, location *time.Location) (*ImportDiaryEntriesResponse, error)
+	ValidateDiaryEntries(diaryEntryBodies []*SaveDiaryEntryBody) ([]*DiaryEntryValidation, error)
+	UpdateDiaryEntry(diaryEntryId uint, diaryEntryBody *UpdateDiaryEntryBody, location *time.Location) (*models.DiaryEntry, error)
 	DeleteDiaryEntry(id uint) error
+	DeleteUserEntriesTimeRange(userId uint, startDate int64, endDate int64) (int, error)
+}
+
+type DefaultDiaryEntryService struct {
+	diaryEntryStorage           storage.DiaryEntryStorageInterface
+	activityRegistrationStorage storage.ActivityRegistrationStorageInterface
+	userStorage                 storage.UserStorageInterface
 }
 
-type DefaultDiaryEntryService struct{}
+var _ DiaryEntryService = (*DefaultDiaryEntryService)(nil)
+
+// Lock per diary entry id held while an entry is updated, so concurrent updates of the same entry
+// are applied one after another instead of mixing their fields.
+// It only serializes the updates handled by this process: when several instances of the API share the database,
+// updates of the same entry sent to different instances can still race until entries are versioned.
+var diaryEntryUpdateLocks = newKeyedLock()
+
+// Lock per user id held from the diary entries quota and day checks until the entries are stored,
+// so concurrent creations and updates of the same user cannot exceed the quota or take the same day
+// between checking and storing.
+// Like diaryEntryUpdateLocks, it only serializes the writes handled by this process.
+var diaryEntryCreationLocks = newKeyedLock()
+
+// Creates a diary entry service backed by the given storages.
+func NewDefaultDiaryEntryService(
+	diaryEntryStorage storage.DiaryEntryStorageInterface,
+	activityRegistrationStorage storage.ActivityRegistrationStorageInterface,
+	userStorage storage.UserStorageInterface,
+) *DefaultDiaryEntryService {
+	return &DefaultDiaryEntryService{
+		diaryEntryStorage:           diaryEntryStorage,
+		activityRegistrationStorage: activityRegistrationStorage,
+		userStorage:                 userStorage,
+	}
+}
 
 func (defaultDiaryEntryService *DefaultDiaryEntryService) GetDiaryEntryById(id uint) (*models.DiaryEntry, error) {
-	diaryEntry, err := diaryEntryStorage.Get(id)
+	diaryEntry, err := defaultDiaryEntryService.diaryEntryStorage.Get(id)
 
 	if err != nil {
 		return nil, err
@@ -42,7 +107,7 @@ func (defaultDiaryEntryService *DefaultDiaryEntryService) GetDiaryEntryById(id u
 
 func (defaultDiaryEntryService *DefaultDiaryEntryService) GetUserEntries(userId uint) ([]*models.DiaryEntry, error) {
 
-	diaryEntry, err := diaryEntryStorage.GetByUserId(userId)
+	diaryEntry, err := defaultDiaryEntryService.diaryEntryStorage.GetByUserId(userId)
 
 	if err != nil {
 		return nil, err
@@ -50,8 +115,14 @@ func (defaultDiaryEntryService *DefaultDiaryEntryService) GetUserEntries(userId
 	return diaryEntry.([]*models.DiaryEntry), nil
 }
 
+// Calls yield with each of the user's entries as they are read, in the same order GetUserEntries returns them,
+// stopping at the first error yield returns.
+func (defaultDiaryEntryService *DefaultDiaryEntryService) StreamUserEntries(userId uint, yield func(diaryEntry *models.DiaryEntry) error) error {
+	return defaultDiaryEntryService.diaryEntryStorage.StreamByUserId(userId, yield)
+}
+
 func (defaultDiaryEntryService *DefaultDiaryEntryService) GetUserEntriesTimeRange(userId uint, startDate int64, endDate int64) ([]*models.DiaryEntry, error) {
-	diaryEntry, err := diaryEntryStorage.GetByUserIdAndDateInterval(userId, startDate, endDate)
+	diaryEntry, err := defaultDiaryEntryService.diaryEntryStorage.GetByUserIdAndDateInterval(userId, startDate, endDate)
 
 	if err != nil {
 		return nil, err
@@ -60,13 +131,100 @@ func (defaultDiaryEntryService *DefaultDiaryEntryService) GetUserEntriesTimeRang
 	return diaryEntry.([]*models.DiaryEntry), nil
 }
 
-func (defaultDiaryEntryService *DefaultDiaryEntryService) SaveDiaryEntry(diaryEntryBody *SaveDiaryEntryBody, userId uint) (*models.DiaryEntry, error) {
+func (defaultDiaryEntryService *DefaultDiaryEntryService) GetUserEntrySummaries(userId uint) ([]*models.DiaryEntrySummary, error) {
+	summaries, err := defaultDiaryEntryService.diaryEntryStorage.GetSummariesByUserId(userId, constants.DiaryEntrySummaryPreviewLength)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return summaries.([]*models.DiaryEntrySummary), nil
+}
+
+func (defaultDiaryEntryService *DefaultDiaryEntryService) GetUserEntrySummariesTimeRange(userId uint, startDate int64, endDate int64) ([]*models.DiaryEntrySummary, error) {
+	summaries, err := defaultDiaryEntryService.diaryEntryStorage.GetSummariesByUserIdAndDateInterval(userId, startDate, endDate, constants.DiaryEntrySummaryPreviewLength)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return summaries.([]*models.DiaryEntrySummary), nil
+}
+
+// Gets the entry summaries of a user within the given date range in Unix seconds, grouped by the day
+// (formatted as YYYY-MM-DD) their registration date falls on in the given location.
+func (defaultDiaryEntryService *DefaultDiaryEntryService) GetUserEntrySummariesByDay(userId uint, startDate int64, endDate int64, location *time.Location) (map[string][]*models.DiaryEntrySummary, error) {
+	summaries, err := defaultDiaryEntryService.GetUserEntrySummariesTimeRange(userId, startDate, endDate)
+
+	if err != nil {
+		return nil, err
+	}
+
+	summariesByDay := make(map[string][]*models.DiaryEntrySummary)
+	for _, summary := range summaries {
+		day := time.Unix(summary.RegistrationDate, 0).In(location).Format(constants.CalendarDayFormat)
+		summariesByDay[day] = append(summariesByDay[day], summary)
+	}
+
+	return summariesByDay, nil
+}
+
+// Gets the entries of a user registered on the same month and day as the given time in previous years,
+// grouped by year (formatted as YYYY). Days are computed from the registration dates, in Unix seconds, in the location of the given time.
+// Only the entries within those days are read, querying the day of each year since the earliest date clients can send.
+func (defaultDiaryEntryService *DefaultDiaryEntryService) GetUserEntriesOnThisDay(userId uint, now time.Time) (map[string][]*models.DiaryEntry, error) {
+	location := now.Location()
+	firstYear := time.Unix(constants.MinTimestampSeconds, 0).In(location).Year()
+	dayIntervals := []storage.DateInterval{}
+
+	for year := firstYear; year < now.Year(); year++ {
+		day := time.Date(year, now.Month(), now.Day(), 0, 0, 0, 0, location)
+
+		// February 29 only exists on leap years, other years normalize it to March 1
+		if day.Month() != now.Month() {
+			continue
+		}
+
+		dayStart, dayEnd := utils.LocationDayBounds(day.Unix(), location)
+		dayIntervals = append(dayIntervals, storage.DateInterval{StartDate: dayStart, EndDate: dayEnd})
+	}
+
+	entries, err := defaultDiaryEntryService.diaryEntryStorage.GetByUserIdAndDateIntervals(userId, dayIntervals)
+
+	if err != nil {
+		return nil, err
+	}
+
+	entriesByYear := make(map[string][]*models.DiaryEntry)
+	for _, entry := range entries.([]*models.DiaryEntry) {
+		year := strconv.Itoa(time.Unix(entry.Registration.RegistrationDate, 0).In(location).Year())
+		entriesByYear[year] = append(entriesByYear[year], entry)
+	}
+
+	return entriesByYear, nil
+}
+
+func (defaultDiaryEntryService *DefaultDiaryEntryService) SaveDiaryEntry(diaryEntryBody *SaveDiaryEntryBody, userId uint, location *time.Location) (*models.DiaryEntry, error) {
+	unlock := diaryEntryCreationLocks.Lock(userId)
+	defer unlock()
+
+	if quotaErr := defaultDiaryEntryService.checkDiaryEntriesQuota(userId, 1); quotaErr != nil {
+		return nil, quotaErr
+	}
+
+	if dayErr := defaultDiaryEntryService.checkDiaryEntryDay(userId, diaryEntryBody.PublishDate, location, 0); dayErr != nil {
+		return nil, dayErr
+	}
+
+	registrationWritesLock.RLock()
+	defer registrationWritesLock.RUnlock()
+
 	dbActivityRegistration := &models.ActivityRegistration{
 		RegistrationDate: diaryEntryBody.PublishDate,
 		UserRefer:        userId,
 	}
 
-	saveRegistrationErr := activityRegistrationStorage.Create(dbActivityRegistration)
+	saveRegistrationErr := defaultDiaryEntryService.activityRegistrationStorage.Create(dbActivityRegistration)
 
 	if saveRegistrationErr != nil {
 		return nil, saveRegistrationErr
@@ -76,8 +234,9 @@ func (defaultDiaryEntryService *DefaultDiaryEntryService) SaveDiaryEntry(diaryEn
 		Title:        diaryEntryBody.Title,
 		Content:      diaryEntryBody.Content,
 		Registration: *dbActivityRegistration,
+		UpdatedAt:    time.Now().Unix(),
 	}
-	err := diaryEntryStorage.Create(dbEntry)
+	err := defaultDiaryEntryService.diaryEntryStorage.Create(dbEntry)
 
 	if err != nil {
 		return nil, err
@@ -86,19 +245,142 @@ func (defaultDiaryEntryService *DefaultDiaryEntryService) SaveDiaryEntry(diaryEn
 	return dbEntry, nil
 }
 
-func (defaultDiaryEntryService *DefaultDiaryEntryService) UpdateDiaryEntry(diaryEntryId uint, diaryEntryBody *UpdateDiaryEntryBody) (*models.DiaryEntry, error) {
+// Validates each of the given entries and stores the valid ones within a single transaction.
+// Invalid entries are reported by their index in the request instead of aborting the whole import.
+// When the config allows a single entry per day, entries on a day already taken, either by a stored entry
+// or by a previous entry of the batch, are reported as invalid too.
+func (defaultDiaryEntryService *DefaultDiaryEntryService) ImportDiaryEntries(diaryEntryBodies []*SaveDiaryEntryBody, userId uint, location *time.Location) (*ImportDiaryEntriesResponse, error) {
+	if len(diaryEntryBodies) == 0 || len(diaryEntryBodies) > constants.DiaryEntryImportMaxBatchSize {
+		return nil, ErrDiaryEntryImportBatchSize
+	}
+
+	importResponse := &ImportDiaryEntriesResponse{
+		Entries: []*models.DiaryEntry{},
+		Errors:  []*ImportDiaryEntryError{},
+	}
+
+	unlock := diaryEntryCreationLocks.Lock(userId)
+	defer unlock()
+
+	onePerDay := config.Get().DiaryOnePerDay
+	batchDays := map[int64]bool{}
+
+	for index, diaryEntryBody := range diaryEntryBodies {
+		if itemErrors := validateImportedDiaryEntry(diaryEntryBody); len(itemErrors) > 0 {
+			importResponse.Errors = append(importResponse.Errors,
+				&ImportDiaryEntryError{Index: index, Errors: itemErrors})
+			continue
+		}
+
+		if onePerDay {
+			dayStart, _ := utils.LocationDayBounds(diaryEntryBody.PublishDate, location)
+			dayErr := defaultDiaryEntryService.checkDiaryEntryDay(userId, diaryEntryBody.PublishDate, location, 0)
+
+			if dayErr == nil && batchDays[dayStart] {
+				dayErr = ErrDiaryEntryDayTaken
+			}
+
+			if errors.Is(dayErr, ErrDiaryEntryDayTaken) {
+				importResponse.Errors = append(importResponse.Errors,
+					&ImportDiaryEntryError{Index: index, Errors: []string{dayErr.Error()}})
+				continue
+			}
+
+			if dayErr != nil {
+				return nil, dayErr
+			}
+
+			batchDays[dayStart] = true
+		}
+
+		importResponse.Entries = append(importResponse.Entries, &models.DiaryEntry{
+			Title:   diaryEntryBody.Title,
+			Content: diaryEntryBody.Content,
+			Registration: models.ActivityRegistration{
+				RegistrationDate: diaryEntryBody.PublishDate,
+				UserRefer:        userId,
+			},
+			UpdatedAt: time.Now().Unix(),
+		})
+	}
+
+	if len(importResponse.Entries) > 0 {
+		if quotaErr := defaultDiaryEntryService.checkDiaryEntriesQuota(userId, len(importResponse.Entries)); quotaErr != nil {
+			return nil, quotaErr
+		}
+
+		registrationWritesLock.RLock()
+		defer registrationWritesLock.RUnlock()
+
+		if err := defaultDiaryEntryService.diaryEntryStorage.CreateMany(importResponse.Entries); err != nil {
+			return nil, err
+		}
+	}
+
+	importResponse.Imported = len(importResponse.Entries)
+	importResponse.Failed = len(importResponse.Errors)
+
+	return importResponse, nil
+}
+
+// Validates each of the given entries the same way ImportDiaryEntries does, without storing any of them,
+// so clients can preview which entries of a batch would be imported.
+func (defaultDiaryEntryService *DefaultDiaryEntryService) ValidateDiaryEntries(diaryEntryBodies []*SaveDiaryEntryBody) ([]*DiaryEntryValidation, error) {
+	if len(diaryEntryBodies) == 0 || len(diaryEntryBodies) > constants.DiaryEntryImportMaxBatchSize {
+		return nil, ErrDiaryEntryImportBatchSize
+	}
+
+	validations := make([]*DiaryEntryValidation, 0, len(diaryEntryBodies))
+
+	for index, diaryEntryBody := range diaryEntryBodies {
+		itemErrors := validateImportedDiaryEntry(diaryEntryBody)
+		validations = append(validations, &DiaryEntryValidation{Index: index, Valid: len(itemErrors) == 0, Errors: itemErrors})
+	}
+
+	return validations, nil
+}
+
+// Gets the descriptions of the validation errors of an entry to import. Returns an empty slice if it is valid.
+func validateImportedDiaryEntry(diaryEntryBody *SaveDiaryEntryBody) []string {
+	if diaryEntryBody == nil {
+		return []string{"Not valid JSON."}
+	}
+
+	validationErrs := utils.ValidateBody(diaryEntryBody)
+	itemErrors := make([]string, 0, len(validationErrs))
+
+	for _, validationErr := range validationErrs {
+		itemErrors = append(itemErrors, validationErr.Description)
+	}
+
+	return itemErrors
+}
+
+// Updates the entry and its publish date. When the config allows a single entry per day, fails if the new
+// publish date falls on a day taken by another entry of the user, in the given location.
+func (defaultDiaryEntryService *DefaultDiaryEntryService) UpdateDiaryEntry(diaryEntryId uint, diaryEntryBody *UpdateDiaryEntryBody, location *time.Location) (*models.DiaryEntry, error) {
+	unlock := diaryEntryUpdateLocks.Lock(diaryEntryId)
+	defer unlock()
+
 	storedDiaryEntry, getDiaryEntryError := defaultDiaryEntryService.GetDiaryEntryById(diaryEntryId)
 
 	if getDiaryEntryError != nil {
 		return nil, getDiaryEntryError
 	}
 
+	unlockUser := diaryEntryCreationLocks.Lock(storedDiaryEntry.Registration.UserRefer)
+	defer unlockUser()
+
+	if dayErr := defaultDiaryEntryService.checkDiaryEntryDay(storedDiaryEntry.Registration.UserRefer, diaryEntryBody.PublishDate, location, diaryEntryId); dayErr != nil {
+		return nil, dayErr
+	}
+
 	dbRegistration := &models.ActivityRegistration{
 		Id:               storedDiaryEntry.Registration.Id,
 		RegistrationDate: diaryEntryBody.PublishDate,
 		UserRefer:        storedDiaryEntry.Registration.UserRefer,
 	}
-	updateRegistrationErr := activityRegistrationStorage.Update(dbRegistration)
+	updateRegistrationErr := defaultDiaryEntryService.activityRegistrationStorage.Update(dbRegistration)
 
 	if updateRegistrationErr != nil {
 		return nil, updateRegistrationErr
@@ -109,8 +391,9 @@ func (defaultDiaryEntryService *DefaultDiaryEntryService) UpdateDiaryEntry(diary
 		Title:        diaryEntryBody.Title,
 		Content:      diaryEntryBody.Content,
 		Registration: *dbRegistration,
+		UpdatedAt:    time.Now().Unix(),
 	}
-	err := diaryEntryStorage.Update(updatedDiaryEntry)
+	err := defaultDiaryEntryService.diaryEntryStorage.Update(updatedDiaryEntry)
 
 	if err != nil {
 		return nil, err
@@ -119,12 +402,102 @@ func (defaultDiaryEntryService *DefaultDiaryEntryService) UpdateDiaryEntry(diary
 	return updatedDiaryEntry, nil
 }
 
+// Deletes the entry along with its activity registration within a single transaction,
+// so it does not depend on the registration delete cascading to the entry.
 func (defaultDiaryEntryService *DefaultDiaryEntryService) DeleteDiaryEntry(id uint) error {
+	unlock := diaryEntryUpdateLocks.Lock(id)
+	defer unlock()
+
 	diaryEntry, err := defaultDiaryEntryService.GetDiaryEntryById(id)
 
 	if err != nil {
 		return err
 	}
 
-	return activityRegistrationStorage.Delete(diaryEntry.Registration.Id)
+	unlockUser := diaryEntryCreationLocks.Lock(diaryEntry.Registration.UserRefer)
+	defer unlockUser()
+
+	return defaultDiaryEntryService.diaryEntryStorage.DeleteMany([]*models.DiaryEntry{diaryEntry})
+}
+
+// Deletes the entries of a user published within the given date interval, both ends included, along with their activity registrations.
+// Either all the entries are deleted or none are. Returns the number of deleted entries.
+func (defaultDiaryEntryService *DefaultDiaryEntryService) DeleteUserEntriesTimeRange(userId uint, startDate int64, endDate int64) (int, error) {
+	diaryEntries, err := defaultDiaryEntryService.GetUserEntriesTimeRange(userId, startDate, endDate)
+
+	if err != nil {
+		return 0, err
+	}
+
+	if len(diaryEntries) == 0 {
+		return 0, nil
+	}
+
+	if deleteErr := defaultDiaryEntryService.diaryEntryStorage.DeleteMany(diaryEntries); deleteErr != nil {
+		return 0, deleteErr
+	}
+
+	return len(diaryEntries), nil
+}
+
+// Gets the maximum number of diary entries per user from the config.
+// Returns 0 if there is no quota.
+func getMaxDiaryEntriesPerUser() int64 {
+	return config.Get().MaxDiaryEntriesPerUser
+}
+
+// Checks whether the given user can store an entry published at the given date, when the config allows
+// a single entry per day. The day is the calendar day of the date in the given location.
+// The entry with the excluded id does not take the day, so an entry can be updated within its own day.
+func (defaultDiaryEntryService *DefaultDiaryEntryService) checkDiaryEntryDay(userId uint, publishDate int64, location *time.Location, excludedEntryId uint) error {
+	if !config.Get().DiaryOnePerDay {
+		return nil
+	}
+
+	dayStart, dayEnd := utils.LocationDayBounds(publishDate, location)
+	dayEntries, getErr := defaultDiaryEntryService.diaryEntryStorage.GetByUserIdAndDateInterval(userId, dayStart, dayEnd)
+
+	if getErr != nil {
+		return getErr
+	}
+
+	for _, dayEntry := range dayEntries.([]*models.DiaryEntry) {
+		if dayEntry.Id != excludedEntryId {
+			return ErrDiaryEntryDayTaken
+		}
+	}
+
+	return nil
+}
+
+// Checks whether the given user can store the given number of new entries without exceeding the diary entries quota.
+// Admins are exempt from the quota.
+func (defaultDiaryEntryService *DefaultDiaryEntryService) checkDiaryEntriesQuota(userId uint, newEntries int) error {
+	maxEntries := getMaxDiaryEntriesPerUser()
+
+	if maxEntries == 0 {
+		return nil
+	}
+
+	user, getUserErr := defaultDiaryEntryService.userStorage.Get(userId)
+
+	if getUserErr != nil {
+		return getUserErr
+	}
+
+	if user.(*models.User).Role == models.Admin {
+		return nil
+	}
+
+	entriesCount, countErr := defaultDiaryEntryService.diaryEntryStorage.CountByUserId(userId)
+
+	if countErr != nil {
+		return countErr
+	}
+
+	if entriesCount+int64(newEntries) > maxEntries {
+		return ErrDiaryEntryQuotaReached
+	}
+
+	return nil
 }
@@ -2,22 +2,34 @@ package services
 
 import (
 	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/adfer-dev/analock-api/constants"
 	"github.com/adfer-dev/analock-api/models"
+	"github.com/adfer-dev/analock-api/storage"
+	"github.com/adfer-dev/analock-api/storage/memory"
 	"github.com/stretchr/testify/assert"
 )
 
 // mockDiaryEntryStorage implements DiaryEntryStorageInterface
 type mockDiaryEntryStorage struct {
-	Entries      map[uint]*models.DiaryEntry
-	UserEntries  map[uint][]*models.DiaryEntry
-	GetErr       error
-	GetByUIDErr  error
-	GetByDateErr error
-	CreateErr    error
-	UpdateErr    error
+	Entries        map[uint]*models.DiaryEntry
+	UserEntries    map[uint][]*models.DiaryEntry
+	GetErr         error
+	GetByUIDErr    error
+	GetByDateErr   error
+	SummaryErr     error
+	CountErr       error
+	CreateErr      error
+	CreatedBatches [][]*models.DiaryEntry
+	UpdateErr      error
+	DeleteErr      error
+	DeletedBatches [][]*models.DiaryEntry
 }
 
 func (m *mockDiaryEntryStorage) Get(id uint) (interface{}, error) {
@@ -42,6 +54,18 @@ func (m *mockDiaryEntryStorage) GetByUserId(userId uint) (interface{}, error) {
 	return entries, nil
 }
 
+func (m *mockDiaryEntryStorage) StreamByUserId(userId uint, yield func(diaryEntry *models.DiaryEntry) error) error {
+	if m.GetByUIDErr != nil {
+		return m.GetByUIDErr
+	}
+	for _, entry := range m.UserEntries[userId] {
+		if err := yield(entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (m *mockDiaryEntryStorage) GetByUserIdAndDateInterval(userId uint, startDate int64, endDate int64) (interface{}, error) {
 	if m.GetByDateErr != nil {
 		return nil, m.GetByDateErr
@@ -59,6 +83,66 @@ func (m *mockDiaryEntryStorage) GetByUserIdAndDateInterval(userId uint, startDat
 	return filteredEntries, nil
 }
 
+func (m *mockDiaryEntryStorage) GetByUserIdAndDateIntervals(userId uint, intervals []storage.DateInterval) (interface{}, error) {
+	if m.GetByDateErr != nil {
+		return nil, m.GetByDateErr
+	}
+	filteredEntries := []*models.DiaryEntry{}
+	for _, entry := range m.UserEntries[userId] {
+		for _, interval := range intervals {
+			if entry.Registration.RegistrationDate >= interval.StartDate && entry.Registration.RegistrationDate <= interval.EndDate {
+				filteredEntries = append(filteredEntries, entry)
+				break
+			}
+		}
+	}
+	return filteredEntries, nil
+}
+
+func (m *mockDiaryEntryStorage) GetSummariesByUserId(userId uint, previewLength int) (interface{}, error) {
+	if m.SummaryErr != nil {
+		return nil, m.SummaryErr
+	}
+	return m.buildSummaries(m.UserEntries[userId], previewLength), nil
+}
+
+func (m *mockDiaryEntryStorage) GetSummariesByUserIdAndDateInterval(userId uint, startDate int64, endDate int64, previewLength int) (interface{}, error) {
+	if m.SummaryErr != nil {
+		return nil, m.SummaryErr
+	}
+	var filteredEntries []*models.DiaryEntry
+	for _, entry := range m.UserEntries[userId] {
+		if entry.Registration.RegistrationDate >= startDate && entry.Registration.RegistrationDate <= endDate {
+			filteredEntries = append(filteredEntries, entry)
+		}
+	}
+	return m.buildSummaries(filteredEntries, previewLength), nil
+}
+
+func (m *mockDiaryEntryStorage) buildSummaries(entries []*models.DiaryEntry, previewLength int) []*models.DiaryEntrySummary {
+	summaries := []*models.DiaryEntrySummary{}
+	for _, entry := range entries {
+		preview := []rune(entry.Content)
+		if len(preview) > previewLength {
+			preview = preview[:previewLength]
+		}
+		summaries = append(summaries, &models.DiaryEntrySummary{
+			Id:               entry.Id,
+			Title:            entry.Title,
+			ContentPreview:   string(preview),
+			RegistrationDate: entry.Registration.RegistrationDate,
+		})
+	}
+	return summaries
+}
+
+func (m *mockDiaryEntryStorage) CountByUserId(userId uint) (int64, error) {
+	if m.CountErr != nil {
+		return 0, m.CountErr
+	}
+	return int64(len(m.UserEntries[userId])), nil
+}
+
 func (m *mockDiaryEntryStorage) Create(data interface{}) error {
 	if m.CreateErr != nil {
 		return m.CreateErr
@@ -78,6 +162,23 @@ func (m *mockDiaryEntryStorage) Create(data interface{}) error {
 	return nil
 }
 
+func (m *mockDiaryEntryStorage) CreateMany(data interface{}) error {
+	if m.CreateErr != nil {
+		return m.CreateErr
+	}
+	entries, ok := data.([]*models.DiaryEntry)
+	if !ok {
+		return errors.New("create many: invalid type for DiaryEntry slice")
+	}
+	m.CreatedBatches = append(m.CreatedBatches, entries)
+	for _, entry := range entries {
+		if createErr := m.Create(entry); createErr != nil {
+			return createErr
+		}
+	}
+	return nil
+}
+
 func (m *mockDiaryEntryStorage) Update(data interface{}) error {
 	if m.UpdateErr != nil {
 		return m.UpdateErr
@@ -104,15 +205,49 @@ func (m *mockDiaryEntryStorage) Update(data interface{}) error {
 	return nil
 }
 
-var diaryEntryService DiaryEntryService = &DefaultDiaryEntryService{}
+func (m *mockDiaryEntryStorage) Delete(id uint) error {
+	if m.DeleteErr != nil {
+		return m.DeleteErr
+	}
+	entry, exists := m.Entries[id]
+	if !exists {
+		return errors.New("delete: diary entry not found")
+	}
+	delete(m.Entries, id)
+	userEntries := m.UserEntries[entry.Registration.UserRefer]
+	for i, ue := range userEntries {
+		if ue.Id == id {
+			m.UserEntries[entry.Registration.UserRefer] = append(userEntries[:i], userEntries[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+func (m *mockDiaryEntryStorage) DeleteMany(data interface{}) error {
+	if m.DeleteErr != nil {
+		return m.DeleteErr
+	}
+	entries, ok := data.([]*models.DiaryEntry)
+	if !ok {
+		return errors.New("delete many: invalid type for DiaryEntry slice")
+	}
+	m.DeletedBatches = append(m.DeletedBatches, entries)
+	for _, entry := range entries {
+		if deleteErr := m.Delete(entry.Id); deleteErr != nil {
+			return deleteErr
+		}
+	}
+	return nil
+}
 
 func TestGetDiaryEntryById(t *testing.T) {
-	originalDiaryEntryStorage := diaryEntryStorage
+	t.Parallel()
+
 	diaryEntryStorageMock := &mockDiaryEntryStorage{
 		Entries: make(map[uint]*models.DiaryEntry),
 	}
-	diaryEntryStorage = diaryEntryStorageMock
-	defer func() { diaryEntryStorage = originalDiaryEntryStorage }()
+	diaryEntryService := NewDefaultDiaryEntryService(diaryEntryStorageMock, &mockActivityRegistrationStorage{}, newuserStorageMockUserStorage())
 
 	testEntry := &models.DiaryEntry{Id: 1, Title: "Test Title", Content: "Test content"}
 	diaryEntryStorageMock.Entries[testEntry.Id] = testEntry
@@ -131,12 +266,12 @@ func TestGetDiaryEntryById(t *testing.T) {
 }
 
 func TestGetUserEntries(t *testing.T) {
-	originalDiaryEntryStorage := diaryEntryStorage
+	t.Parallel()
+
 	diaryEntryStorageMock := &mockDiaryEntryStorage{
 		UserEntries: make(map[uint][]*models.DiaryEntry),
 	}
-	diaryEntryStorage = diaryEntryStorageMock
-	defer func() { diaryEntryStorage = originalDiaryEntryStorage }()
+	diaryEntryService := NewDefaultDiaryEntryService(diaryEntryStorageMock, &mockActivityRegistrationStorage{}, newuserStorageMockUserStorage())
 
 	userId := uint(1)
 	expectedEntries := []*models.DiaryEntry{
@@ -160,12 +295,12 @@ func TestGetUserEntries(t *testing.T) {
 }
 
 func TestGetUserEntriesTimeRange(t *testing.T) {
-	originalDiaryEntryStorage := diaryEntryStorage
+	t.Parallel()
+
 	diaryEntryStorageMock := &mockDiaryEntryStorage{
 		UserEntries: make(map[uint][]*models.DiaryEntry),
 	}
-	diaryEntryStorage = diaryEntryStorageMock
-	defer func() { diaryEntryStorage = originalDiaryEntryStorage }()
+	diaryEntryService := NewDefaultDiaryEntryService(diaryEntryStorageMock, &mockActivityRegistrationStorage{}, newuserStorageMockUserStorage())
 
 	userId := uint(1)
 	now := time.Now().Unix()
@@ -184,9 +319,144 @@ func TestGetUserEntriesTimeRange(t *testing.T) {
 	assert.EqualError(t, err, "forced GetByDateErr error")
 }
 
+func TestGetUserEntrySummaries(t *testing.T) {
+	t.Parallel()
+
+	diaryEntryStorageMock := &mockDiaryEntryStorage{
+		UserEntries: make(map[uint][]*models.DiaryEntry),
+	}
+	diaryEntryService := NewDefaultDiaryEntryService(diaryEntryStorageMock, &mockActivityRegistrationStorage{}, newuserStorageMockUserStorage())
+
+	userId := uint(1)
+	longContent := strings.Repeat("a", constants.DiaryEntrySummaryPreviewLength+50)
+	diaryEntryStorageMock.UserEntries[userId] = []*models.DiaryEntry{
+		{Id: 1, Title: "Entry 1", Content: longContent, Registration: models.ActivityRegistration{UserRefer: userId, RegistrationDate: 100}},
+		{Id: 2, Title: "Entry 2", Content: "short", Registration: models.ActivityRegistration{UserRefer: userId, RegistrationDate: 200}},
+	}
+
+	summaries, err := diaryEntryService.GetUserEntrySummaries(userId)
+	assert.NoError(t, err)
+	assert.Len(t, summaries, 2)
+	assert.Equal(t, "Entry 1", summaries[0].Title)
+	assert.Equal(t, int64(100), summaries[0].RegistrationDate)
+	assert.Len(t, summaries[0].ContentPreview, constants.DiaryEntrySummaryPreviewLength)
+	assert.Equal(t, "short", summaries[1].ContentPreview)
+
+	otherSummaries, err := diaryEntryService.GetUserEntrySummaries(2) // Non-existent user
+	assert.NoError(t, err)
+	assert.Empty(t, otherSummaries)
+
+	diaryEntryStorageMock.SummaryErr = errors.New("forced SummaryErr error")
+	_, err = diaryEntryService.GetUserEntrySummaries(userId)
+	assert.EqualError(t, err, "forced SummaryErr error")
+}
+
+func TestGetUserEntrySummariesTimeRange(t *testing.T) {
+	t.Parallel()
+
+	diaryEntryStorageMock := &mockDiaryEntryStorage{
+		UserEntries: make(map[uint][]*models.DiaryEntry),
+	}
+	diaryEntryService := NewDefaultDiaryEntryService(diaryEntryStorageMock, &mockActivityRegistrationStorage{}, newuserStorageMockUserStorage())
+
+	userId := uint(1)
+	diaryEntryStorageMock.UserEntries[userId] = []*models.DiaryEntry{
+		{Id: 1, Title: "Entry 1", Registration: models.ActivityRegistration{UserRefer: userId, RegistrationDate: 100}},
+		{Id: 2, Title: "Entry 2", Registration: models.ActivityRegistration{UserRefer: userId, RegistrationDate: 200}},
+	}
+
+	summaries, err := diaryEntryService.GetUserEntrySummariesTimeRange(userId, 150, 250)
+	assert.NoError(t, err)
+	assert.Len(t, summaries, 1)
+	assert.Equal(t, uint(2), summaries[0].Id)
+
+	diaryEntryStorageMock.SummaryErr = errors.New("forced SummaryErr error")
+	_, err = diaryEntryService.GetUserEntrySummariesTimeRange(userId, 150, 250)
+	assert.EqualError(t, err, "forced SummaryErr error")
+}
+
+func TestGetUserEntrySummariesByDay(t *testing.T) {
+	t.Parallel()
+
+	diaryEntryStorageMock := &mockDiaryEntryStorage{
+		UserEntries: make(map[uint][]*models.DiaryEntry),
+	}
+	diaryEntryService := NewDefaultDiaryEntryService(diaryEntryStorageMock, &mockActivityRegistrationStorage{}, newuserStorageMockUserStorage())
+
+	userId := uint(1)
+	// 2024-01-01T23:30:00Z, 2024-01-02T00:30:00Z and 2024-01-02T10:00:00Z
+	diaryEntryStorageMock.UserEntries[userId] = []*models.DiaryEntry{
+		{Id: 1, Title: "Entry 1", Registration: models.ActivityRegistration{UserRefer: userId, RegistrationDate: 1704151800}},
+		{Id: 2, Title: "Entry 2", Registration: models.ActivityRegistration{UserRefer: userId, RegistrationDate: 1704155400}},
+		{Id: 3, Title: "Entry 3", Registration: models.ActivityRegistration{UserRefer: userId, RegistrationDate: 1704189600}},
+	}
+
+	entriesByDay, err := diaryEntryService.GetUserEntrySummariesByDay(userId, 0, 1704240000, time.UTC)
+	assert.NoError(t, err)
+	assert.Len(t, entriesByDay, 2)
+	assert.Len(t, entriesByDay["2024-01-01"], 1)
+	assert.Len(t, entriesByDay["2024-01-02"], 2)
+
+	newYork, _ := time.LoadLocation("America/New_York")
+	entriesByDay, err = diaryEntryService.GetUserEntrySummariesByDay(userId, 0, 1704240000, newYork)
+	assert.NoError(t, err)
+	assert.Len(t, entriesByDay, 2)
+	assert.Len(t, entriesByDay["2024-01-01"], 2)
+	assert.Len(t, entriesByDay["2024-01-02"], 1)
+
+	diaryEntryStorageMock.SummaryErr = errors.New("forced SummaryErr error")
+	_, err = diaryEntryService.GetUserEntrySummariesByDay(userId, 0, 1704240000, time.UTC)
+	assert.EqualError(t, err, "forced SummaryErr error")
+}
+
+func TestGetUserEntriesOnThisDay(t *testing.T) {
+	t.Parallel()
+
+	diaryEntryStorageMock := &mockDiaryEntryStorage{
+		UserEntries: make(map[uint][]*models.DiaryEntry),
+	}
+	diaryEntryService := NewDefaultDiaryEntryService(diaryEntryStorageMock, &mockActivityRegistrationStorage{}, newuserStorageMockUserStorage())
+
+	userId := uint(1)
+	// 2022-03-15T12:00:00Z, 2023-03-15T23:30:00Z, 2023-03-16T10:00:00Z and 2024-03-15T10:00:00Z
+	diaryEntryStorageMock.UserEntries[userId] = []*models.DiaryEntry{
+		{Id: 1, Title: "Entry 1", Registration: models.ActivityRegistration{UserRefer: userId, RegistrationDate: 1647345600}},
+		{Id: 2, Title: "Entry 2", Registration: models.ActivityRegistration{UserRefer: userId, RegistrationDate: 1678923000}},
+		{Id: 3, Title: "Entry 3", Registration: models.ActivityRegistration{UserRefer: userId, RegistrationDate: 1678960800}},
+		{Id: 4, Title: "Entry 4", Registration: models.ActivityRegistration{UserRefer: userId, RegistrationDate: 1710496800}},
+	}
+
+	// Test case: Entries of previous years on the same day are grouped by year, leaving out the current year
+	entriesByYear, err := diaryEntryService.GetUserEntriesOnThisDay(userId, time.Date(2024, time.March, 15, 18, 0, 0, 0, time.UTC))
+	assert.NoError(t, err)
+	assert.Len(t, entriesByYear, 2)
+	assert.Equal(t, []*models.DiaryEntry{diaryEntryStorageMock.UserEntries[userId][0]}, entriesByYear["2022"])
+	assert.Equal(t, []*models.DiaryEntry{diaryEntryStorageMock.UserEntries[userId][1]}, entriesByYear["2023"])
+
+	// Test case: Days are computed in the location of the given time
+	madrid, _ := time.LoadLocation("Europe/Madrid")
+	entriesByYear, err = diaryEntryService.GetUserEntriesOnThisDay(userId, time.Date(2024, time.March, 16, 9, 0, 0, 0, madrid))
+	assert.NoError(t, err)
+	assert.Len(t, entriesByYear, 1)
+	assert.Len(t, entriesByYear["2023"], 2)
+
+	// Test case: On February 29, only the entries of leap years are found
+	diaryEntryStorageMock.UserEntries[userId] = append(diaryEntryStorageMock.UserEntries[userId],
+		&models.DiaryEntry{Id: 5, Title: "Entry 5", Registration: models.ActivityRegistration{UserRefer: userId, RegistrationDate: time.Date(2020, time.February, 29, 10, 0, 0, 0, time.UTC).Unix()}},
+		&models.DiaryEntry{Id: 6, Title: "Entry 6", Registration: models.ActivityRegistration{UserRefer: userId, RegistrationDate: time.Date(2023, time.March, 1, 10, 0, 0, 0, time.UTC).Unix()}},
+	)
+	entriesByYear, err = diaryEntryService.GetUserEntriesOnThisDay(userId, time.Date(2024, time.February, 29, 18, 0, 0, 0, time.UTC))
+	assert.NoError(t, err)
+	assert.Len(t, entriesByYear, 1)
+	assert.Len(t, entriesByYear["2020"], 1)
+
+	diaryEntryStorageMock.GetByDateErr = errors.New("forced GetByDateErr error")
+	_, err = diaryEntryService.GetUserEntriesOnThisDay(userId, time.Date(2024, time.March, 15, 18, 0, 0, 0, time.UTC))
+	assert.EqualError(t, err, "forced GetByDateErr error")
+}
+
 func TestSaveDiaryEntry(t *testing.T) {
-	originalDiaryEntryStorage := diaryEntryStorage
-	originalActivityRegistrationStorage := activityRegistrationStorage // ARS for ActivityRegistrationStorage
+	t.Parallel()
 
 	diaryEntryStorageMock := &mockDiaryEntryStorage{
 		Entries:     make(map[uint]*models.DiaryEntry),
@@ -195,12 +465,7 @@ func TestSaveDiaryEntry(t *testing.T) {
 	// Assuming mockActivityRegistrationStorage is available from activityRegistration_test.go
 	activityRegistrationStorageMock := &mockActivityRegistrationStorage{}
 
-	diaryEntryStorage = diaryEntryStorageMock
-	activityRegistrationStorage = activityRegistrationStorageMock
-	defer func() {
-		diaryEntryStorage = originalDiaryEntryStorage
-		activityRegistrationStorage = originalActivityRegistrationStorage
-	}()
+	diaryEntryService := NewDefaultDiaryEntryService(diaryEntryStorageMock, activityRegistrationStorageMock, newuserStorageMockUserStorage())
 
 	saveBody := &SaveDiaryEntryBody{
 		Title:       "New Diary Entry",
@@ -210,7 +475,7 @@ func TestSaveDiaryEntry(t *testing.T) {
 
 	// --- Test successful save ---
 	userId := uint(1)
-	createdEntry, err := diaryEntryService.SaveDiaryEntry(saveBody, userId)
+	createdEntry, err := diaryEntryService.SaveDiaryEntry(saveBody, userId, time.UTC)
 
 	assert.NoError(t, err)
 	assert.NotNil(t, createdEntry)
@@ -223,22 +488,368 @@ func TestSaveDiaryEntry(t *testing.T) {
 
 	// --- Test error from activityRegistrationStorage.Create ---
 	activityRegistrationStorageMock.Err = errors.New("ARS create failed")
-	_, err = diaryEntryService.SaveDiaryEntry(saveBody, userId)
+	_, err = diaryEntryService.SaveDiaryEntry(saveBody, userId, time.UTC)
 	assert.Error(t, err)
 	assert.EqualError(t, err, "ARS create failed")
 	activityRegistrationStorageMock.Err = nil // Reset error
 
 	// --- Test error from diaryEntryStorage.Create ---
 	diaryEntryStorageMock.CreateErr = errors.New("DES create failed")
-	_, err = diaryEntryService.SaveDiaryEntry(saveBody, userId)
+	_, err = diaryEntryService.SaveDiaryEntry(saveBody, userId, time.UTC)
 	assert.Error(t, err)
 	assert.EqualError(t, err, "DES create failed")
 	diaryEntryStorageMock.CreateErr = nil // Reset error
 }
 
+func TestDiaryEntriesQuota(t *testing.T) {
+	diaryEntryStorageMock := &mockDiaryEntryStorage{
+		Entries:     make(map[uint]*models.DiaryEntry),
+		UserEntries: make(map[uint][]*models.DiaryEntry),
+	}
+	userStorageMock := newuserStorageMockUserStorage()
+	userStorageMock.UsersById[1] = &models.User{Id: 1, Role: models.Standard}
+	userStorageMock.UsersById[2] = &models.User{Id: 2, Role: models.Admin}
+
+	diaryEntryService := NewDefaultDiaryEntryService(diaryEntryStorageMock, &mockActivityRegistrationStorage{}, userStorageMock)
+
+	t.Setenv("API_MAX_DIARY_ENTRIES_PER_USER", "2")
+	saveBody := &SaveDiaryEntryBody{Title: "Title", Content: "Content", PublishDate: 1700000000}
+
+	t.Run("below_and_at_quota", func(t *testing.T) {
+		_, err := diaryEntryService.SaveDiaryEntry(saveBody, 1, time.UTC)
+		assert.NoError(t, err)
+
+		// The second entry reaches the quota, which is still allowed
+		_, err = diaryEntryService.SaveDiaryEntry(saveBody, 1, time.UTC)
+		assert.NoError(t, err)
+
+		_, err = diaryEntryService.SaveDiaryEntry(saveBody, 1, time.UTC)
+		assert.ErrorIs(t, err, ErrDiaryEntryQuotaReached)
+		assert.Len(t, diaryEntryStorageMock.UserEntries[1], 2)
+	})
+
+	t.Run("import_over_quota", func(t *testing.T) {
+		_, err := diaryEntryService.ImportDiaryEntries([]*SaveDiaryEntryBody{saveBody}, 1, time.UTC)
+		assert.ErrorIs(t, err, ErrDiaryEntryQuotaReached)
+		assert.Empty(t, diaryEntryStorageMock.CreatedBatches)
+	})
+
+	t.Run("admin_exempt", func(t *testing.T) {
+		for i := 0; i < 3; i++ {
+			_, err := diaryEntryService.SaveDiaryEntry(saveBody, 2, time.UTC)
+			assert.NoError(t, err)
+		}
+		assert.Len(t, diaryEntryStorageMock.UserEntries[2], 3)
+	})
+
+	t.Run("no_quota", func(t *testing.T) {
+		t.Setenv("API_MAX_DIARY_ENTRIES_PER_USER", "")
+		_, err := diaryEntryService.SaveDiaryEntry(saveBody, 1, time.UTC)
+		assert.NoError(t, err)
+	})
+
+	t.Run("count_error", func(t *testing.T) {
+		diaryEntryStorageMock.CountErr = errors.New("forced CountErr error")
+		defer func() { diaryEntryStorageMock.CountErr = nil }()
+
+		_, err := diaryEntryService.SaveDiaryEntry(saveBody, 1, time.UTC)
+		assert.EqualError(t, err, "forced CountErr error")
+	})
+}
+
+// Diary entry storage that is slow to answer the reads of the quota and day checks.
+type slowCheckDiaryEntryStorage struct {
+	*memory.DiaryEntryStorage
+}
+
+func (storage *slowCheckDiaryEntryStorage) CountByUserId(userId uint) (int64, error) {
+	count, err := storage.DiaryEntryStorage.CountByUserId(userId)
+
+	// Widens the window between the quota check and the entry creation
+	time.Sleep(time.Millisecond)
+
+	return count, err
+}
+
+func (storage *slowCheckDiaryEntryStorage) GetByUserIdAndDateInterval(userId uint, startDate int64, endDate int64) (interface{}, error) {
+	diaryEntries, err := storage.DiaryEntryStorage.GetByUserIdAndDateInterval(userId, startDate, endDate)
+
+	// Widens the window between the day check and the entry creation
+	time.Sleep(time.Millisecond)
+
+	return diaryEntries, err
+}
+
+func TestDiaryEntriesQuotaConcurrent(t *testing.T) {
+	database := memory.NewDatabase()
+	diaryEntryStorage := &slowCheckDiaryEntryStorage{DiaryEntryStorage: memory.NewDiaryEntryStorage(database)}
+	userStorage := memory.NewUserStorage(database)
+	diaryEntryService := NewDefaultDiaryEntryService(diaryEntryStorage, memory.NewActivityRegistrationStorage(database), userStorage)
+
+	user := &models.User{Email: "quota@example.com", Role: models.Standard}
+	assert.NoError(t, userStorage.Create(user))
+
+	t.Setenv("API_MAX_DIARY_ENTRIES_PER_USER", "3")
+
+	const creations = 20
+	var waitGroup sync.WaitGroup
+	var created atomic.Int32
+
+	for i := 0; i < creations; i++ {
+		waitGroup.Add(1)
+		go func() {
+			defer waitGroup.Done()
+			saveBody := &SaveDiaryEntryBody{Title: "Title", Content: "Content", PublishDate: 1700000000}
+			if _, err := diaryEntryService.SaveDiaryEntry(saveBody, user.Id, time.UTC); err == nil {
+				created.Add(1)
+			} else {
+				assert.ErrorIs(t, err, ErrDiaryEntryQuotaReached)
+			}
+		}()
+	}
+	waitGroup.Wait()
+
+	// Test case: Concurrent creations never store more entries than the quota
+	entriesCount, err := diaryEntryStorage.CountByUserId(user.Id)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), entriesCount)
+	assert.Equal(t, int32(3), created.Load())
+
+	// Test case: The lock of the user is released
+	diaryEntryCreationLocks.lock.Lock()
+	defer diaryEntryCreationLocks.lock.Unlock()
+	assert.NotContains(t, diaryEntryCreationLocks.locks, user.Id)
+}
+
+func TestDiaryEntryOnePerDay(t *testing.T) {
+	diaryEntryStorageMock := &mockDiaryEntryStorage{
+		Entries:     make(map[uint]*models.DiaryEntry),
+		UserEntries: make(map[uint][]*models.DiaryEntry),
+	}
+	diaryEntryService := NewDefaultDiaryEntryService(diaryEntryStorageMock, &mockActivityRegistrationStorage{}, newuserStorageMockUserStorage())
+	madrid, _ := time.LoadLocation("Europe/Madrid")
+	// 2024-03-10 23:30 UTC, which is already 2024-03-11 in Madrid
+	publishDate := time.Date(2024, time.March, 10, 23, 30, 0, 0, time.UTC).Unix()
+
+	t.Setenv("API_DIARY_ONE_PER_DAY", "true")
+
+	_, err := diaryEntryService.SaveDiaryEntry(&SaveDiaryEntryBody{Title: "Title", Content: "Content", PublishDate: publishDate}, 1, time.UTC)
+	assert.NoError(t, err)
+
+	// Test case: Another entry on the same day is rejected
+	sameDay := time.Date(2024, time.March, 10, 8, 0, 0, 0, time.UTC).Unix()
+	_, err = diaryEntryService.SaveDiaryEntry(&SaveDiaryEntryBody{Title: "Title", Content: "Content", PublishDate: sameDay}, 1, time.UTC)
+	assert.ErrorIs(t, err, ErrDiaryEntryDayTaken)
+
+	// Test case: An entry on a different day is accepted
+	nextDay := time.Date(2024, time.March, 11, 8, 0, 0, 0, time.UTC).Unix()
+	_, err = diaryEntryService.SaveDiaryEntry(&SaveDiaryEntryBody{Title: "Title", Content: "Content", PublishDate: nextDay}, 1, time.UTC)
+	assert.NoError(t, err)
+
+	// Test case: The day is taken in the given timezone, so the first entry falls on the next day in Madrid
+	_, err = diaryEntryService.SaveDiaryEntry(&SaveDiaryEntryBody{Title: "Title", Content: "Content", PublishDate: sameDay}, 1, madrid)
+	assert.NoError(t, err)
+
+	// Test case: Other users are not affected
+	_, err = diaryEntryService.SaveDiaryEntry(&SaveDiaryEntryBody{Title: "Title", Content: "Content", PublishDate: publishDate}, 2, time.UTC)
+	assert.NoError(t, err)
+
+	t.Setenv("API_DIARY_ONE_PER_DAY", "false")
+
+	_, err = diaryEntryService.SaveDiaryEntry(&SaveDiaryEntryBody{Title: "Title", Content: "Content", PublishDate: sameDay}, 1, time.UTC)
+	assert.NoError(t, err)
+}
+
+func TestDiaryEntryOnePerDayConcurrent(t *testing.T) {
+	database := memory.NewDatabase()
+	diaryEntryStorage := &slowCheckDiaryEntryStorage{DiaryEntryStorage: memory.NewDiaryEntryStorage(database)}
+	diaryEntryService := NewDefaultDiaryEntryService(diaryEntryStorage, memory.NewActivityRegistrationStorage(database), memory.NewUserStorage(database))
+	firstDay := time.Date(2024, time.March, 10, 8, 0, 0, 0, time.UTC).Unix()
+	secondDay := time.Date(2024, time.March, 11, 8, 0, 0, 0, time.UTC).Unix()
+
+	t.Setenv("API_DIARY_ONE_PER_DAY", "true")
+
+	movedEntry, err := diaryEntryService.SaveDiaryEntry(&SaveDiaryEntryBody{Title: "Title", Content: "Content", PublishDate: secondDay}, 1, time.UTC)
+	assert.NoError(t, err)
+
+	const creations = 10
+	var waitGroup sync.WaitGroup
+
+	for i := 0; i < creations; i++ {
+		waitGroup.Add(1)
+		go func() {
+			defer waitGroup.Done()
+			_, err := diaryEntryService.SaveDiaryEntry(&SaveDiaryEntryBody{Title: "Title", Content: "Content", PublishDate: firstDay + int64(i)}, 1, time.UTC)
+			if err != nil {
+				assert.ErrorIs(t, err, ErrDiaryEntryDayTaken)
+			}
+		}()
+	}
+
+	// The other entry of the user is moved to the same day meanwhile
+	waitGroup.Add(1)
+	go func() {
+		defer waitGroup.Done()
+		_, err := diaryEntryService.UpdateDiaryEntry(movedEntry.Id, &UpdateDiaryEntryBody{Title: "Title", Content: "Content", PublishDate: firstDay}, time.UTC)
+		if err != nil {
+			assert.ErrorIs(t, err, ErrDiaryEntryDayTaken)
+		}
+	}()
+	waitGroup.Wait()
+
+	// Test case: Concurrent creations and updates never store two entries on the same day
+	dayEntries, err := diaryEntryStorage.GetByUserIdAndDateInterval(1, firstDay-8*3600, firstDay+16*3600-1)
+	assert.NoError(t, err)
+	assert.Len(t, dayEntries, 1)
+}
+
+func TestImportDiaryEntriesOnePerDay(t *testing.T) {
+	diaryEntryStorageMock := &mockDiaryEntryStorage{
+		Entries:     make(map[uint]*models.DiaryEntry),
+		UserEntries: make(map[uint][]*models.DiaryEntry),
+	}
+	diaryEntryService := NewDefaultDiaryEntryService(diaryEntryStorageMock, &mockActivityRegistrationStorage{}, newuserStorageMockUserStorage())
+	storedDay := time.Date(2024, time.March, 10, 8, 0, 0, 0, time.UTC).Unix()
+	nextDay := time.Date(2024, time.March, 11, 8, 0, 0, 0, time.UTC).Unix()
+
+	t.Setenv("API_DIARY_ONE_PER_DAY", "true")
+
+	_, err := diaryEntryService.SaveDiaryEntry(&SaveDiaryEntryBody{Title: "Title", Content: "Content", PublishDate: storedDay}, 1, time.UTC)
+	assert.NoError(t, err)
+
+	importResponse, err := diaryEntryService.ImportDiaryEntries([]*SaveDiaryEntryBody{
+		{Title: "Stored day", Content: "Content", PublishDate: storedDay + 60},
+		{Title: "Next day", Content: "Content", PublishDate: nextDay},
+		{Title: "Next day again", Content: "Content", PublishDate: nextDay + 60},
+	}, 1, time.UTC)
+
+	assert.NoError(t, err)
+	assert.Equal(t, 1, importResponse.Imported)
+	assert.Equal(t, "Next day", importResponse.Entries[0].Title)
+	// Test case: Entries on a day taken by a stored entry or by a previous entry of the batch are rejected
+	assert.Equal(t, 2, importResponse.Failed)
+	assert.Equal(t, 0, importResponse.Errors[0].Index)
+	assert.Equal(t, []string{ErrDiaryEntryDayTaken.Error()}, importResponse.Errors[0].Errors)
+	assert.Equal(t, 2, importResponse.Errors[1].Index)
+	assert.Equal(t, []string{ErrDiaryEntryDayTaken.Error()}, importResponse.Errors[1].Errors)
+}
+
+func TestUpdateDiaryEntryOnePerDay(t *testing.T) {
+	diaryEntryStorageMock := &mockDiaryEntryStorage{
+		Entries:     make(map[uint]*models.DiaryEntry),
+		UserEntries: make(map[uint][]*models.DiaryEntry),
+	}
+	diaryEntryService := NewDefaultDiaryEntryService(diaryEntryStorageMock, &mockActivityRegistrationStorage{}, newuserStorageMockUserStorage())
+	firstDay := time.Date(2024, time.March, 10, 8, 0, 0, 0, time.UTC).Unix()
+	secondDay := time.Date(2024, time.March, 11, 8, 0, 0, 0, time.UTC).Unix()
+
+	t.Setenv("API_DIARY_ONE_PER_DAY", "true")
+
+	firstEntry, err := diaryEntryService.SaveDiaryEntry(&SaveDiaryEntryBody{Title: "Title", Content: "Content", PublishDate: firstDay}, 1, time.UTC)
+	assert.NoError(t, err)
+	_, err = diaryEntryService.SaveDiaryEntry(&SaveDiaryEntryBody{Title: "Title", Content: "Content", PublishDate: secondDay}, 1, time.UTC)
+	assert.NoError(t, err)
+
+	// Test case: An entry can be moved within its own day
+	_, err = diaryEntryService.UpdateDiaryEntry(firstEntry.Id, &UpdateDiaryEntryBody{Title: "Title", Content: "Content", PublishDate: firstDay + 60}, time.UTC)
+	assert.NoError(t, err)
+
+	// Test case: An entry cannot be moved to a day taken by another entry
+	_, err = diaryEntryService.UpdateDiaryEntry(firstEntry.Id, &UpdateDiaryEntryBody{Title: "Title", Content: "Content", PublishDate: secondDay + 60}, time.UTC)
+	assert.ErrorIs(t, err, ErrDiaryEntryDayTaken)
+}
+
+func TestImportDiaryEntries(t *testing.T) {
+	t.Parallel()
+
+	diaryEntryStorageMock := &mockDiaryEntryStorage{
+		Entries:     make(map[uint]*models.DiaryEntry),
+		UserEntries: make(map[uint][]*models.DiaryEntry),
+	}
+	diaryEntryService := NewDefaultDiaryEntryService(diaryEntryStorageMock, &mockActivityRegistrationStorage{}, newuserStorageMockUserStorage())
+
+	userId := uint(1)
+	importBodies := []*SaveDiaryEntryBody{
+		{Title: "First", Content: "First content", PublishDate: 1700000001},
+		{Title: "", Content: "Missing title", PublishDate: 1700000002},
+		{Title: "Third", Content: "Third content", PublishDate: 1700000003},
+		nil,
+	}
+
+	// --- Test partial import ---
+	importResponse, err := diaryEntryService.ImportDiaryEntries(importBodies, userId, time.UTC)
+
+	assert.NoError(t, err)
+	assert.Equal(t, 2, importResponse.Imported)
+	assert.Equal(t, 2, importResponse.Failed)
+	assert.Len(t, diaryEntryStorageMock.CreatedBatches, 1) // Valid entries are stored in a single call
+	assert.Len(t, diaryEntryStorageMock.UserEntries[userId], 2)
+	assert.Equal(t, "First", importResponse.Entries[0].Title)
+	assert.Equal(t, int64(1700000003), importResponse.Entries[1].Registration.RegistrationDate)
+	assert.Equal(t, userId, importResponse.Entries[1].Registration.UserRefer)
+	assert.Equal(t, 1, importResponse.Errors[0].Index)
+	assert.Equal(t, []string{"FieldTitle must be provided."}, importResponse.Errors[0].Errors)
+	assert.Equal(t, 3, importResponse.Errors[1].Index)
+
+	// --- Test no valid entries does not touch storage ---
+	importResponse, err = diaryEntryService.ImportDiaryEntries(importBodies[1:2], userId, time.UTC)
+
+	assert.NoError(t, err)
+	assert.Equal(t, 0, importResponse.Imported)
+	assert.Equal(t, 1, importResponse.Failed)
+	assert.Len(t, diaryEntryStorageMock.CreatedBatches, 1)
+
+	// --- Test batch size limits ---
+	_, err = diaryEntryService.ImportDiaryEntries([]*SaveDiaryEntryBody{}, userId, time.UTC)
+	assert.ErrorIs(t, err, ErrDiaryEntryImportBatchSize)
+
+	oversizedBodies := make([]*SaveDiaryEntryBody, constants.DiaryEntryImportMaxBatchSize+1)
+	_, err = diaryEntryService.ImportDiaryEntries(oversizedBodies, userId, time.UTC)
+	assert.ErrorIs(t, err, ErrDiaryEntryImportBatchSize)
+
+	// --- Test error from diaryEntryStorage.CreateMany ---
+	diaryEntryStorageMock.CreateErr = errors.New("DES create many failed")
+	_, err = diaryEntryService.ImportDiaryEntries(importBodies[:1], userId, time.UTC)
+	assert.EqualError(t, err, "DES create many failed")
+}
+
+func TestValidateDiaryEntries(t *testing.T) {
+	t.Parallel()
+
+	diaryEntryStorageMock := &mockDiaryEntryStorage{
+		Entries:     make(map[uint]*models.DiaryEntry),
+		UserEntries: make(map[uint][]*models.DiaryEntry),
+	}
+	diaryEntryService := NewDefaultDiaryEntryService(diaryEntryStorageMock, &mockActivityRegistrationStorage{}, newuserStorageMockUserStorage())
+
+	validations, err := diaryEntryService.ValidateDiaryEntries([]*SaveDiaryEntryBody{
+		{Title: "First", Content: "First content", PublishDate: 1700000001},
+		{Title: "", Content: "Missing title", PublishDate: 1700000002},
+		nil,
+		{Title: "Fourth", Content: "Fourth content", PublishDate: 1700000004},
+		// Publish date in milliseconds instead of seconds
+		{Title: "Fifth", Content: "Fifth content", PublishDate: 1700000005000},
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, []*DiaryEntryValidation{
+		{Index: 0, Valid: true, Errors: []string{}},
+		{Index: 1, Valid: false, Errors: []string{"FieldTitle must be provided."}},
+		{Index: 2, Valid: false, Errors: []string{"Not valid JSON."}},
+		{Index: 3, Valid: true, Errors: []string{}},
+		{Index: 4, Valid: false, Errors: []string{"FieldPublishDate must be a Unix timestamp in seconds, not before 2000 nor in the future."}},
+	}, validations)
+	assert.Empty(t, diaryEntryStorageMock.CreatedBatches)
+
+	_, err = diaryEntryService.ValidateDiaryEntries([]*SaveDiaryEntryBody{})
+	assert.ErrorIs(t, err, ErrDiaryEntryImportBatchSize)
+
+	_, err = diaryEntryService.ValidateDiaryEntries(make([]*SaveDiaryEntryBody, constants.DiaryEntryImportMaxBatchSize+1))
+	assert.ErrorIs(t, err, ErrDiaryEntryImportBatchSize)
+}
+
 func TestUpdateDiaryEntry(t *testing.T) {
-	originalDiaryEntryStorage := diaryEntryStorage
-	originalActivityRegistrationStorage := activityRegistrationStorage
+	t.Parallel()
 
 	diaryEntryStorageMock := &mockDiaryEntryStorage{
 		Entries:     make(map[uint]*models.DiaryEntry),
@@ -246,12 +857,7 @@ func TestUpdateDiaryEntry(t *testing.T) {
 	}
 	activityRegistrationStorageMock := &mockActivityRegistrationStorage{}
 
-	diaryEntryStorage = diaryEntryStorageMock
-	activityRegistrationStorage = activityRegistrationStorageMock
-	defer func() {
-		diaryEntryStorage = originalDiaryEntryStorage
-		activityRegistrationStorage = originalActivityRegistrationStorage
-	}()
+	diaryEntryService := NewDefaultDiaryEntryService(diaryEntryStorageMock, activityRegistrationStorageMock, newuserStorageMockUserStorage())
 
 	userId := uint(10)
 	originalTime := time.Now().Unix() - 1000
@@ -271,7 +877,7 @@ func TestUpdateDiaryEntry(t *testing.T) {
 	}
 
 	// Test successful update
-	updatedEntry, err := diaryEntryService.UpdateDiaryEntry(storedEntry.Id, updateBody)
+	updatedEntry, err := diaryEntryService.UpdateDiaryEntry(storedEntry.Id, updateBody, time.UTC)
 	assert.NoError(t, err)
 	assert.NotNil(t, updatedEntry)
 	assert.Equal(t, updateBody.Title, updatedEntry.Title)
@@ -284,64 +890,211 @@ func TestUpdateDiaryEntry(t *testing.T) {
 
 	// Test error from GetDiaryEntryById
 	diaryEntryStorageMock.GetErr = errors.New("get failed for update")
-	_, err = diaryEntryService.UpdateDiaryEntry(storedEntry.Id, updateBody)
+	_, err = diaryEntryService.UpdateDiaryEntry(storedEntry.Id, updateBody, time.UTC)
 	assert.Error(t, err)
 	assert.EqualError(t, err, "get failed for update")
 	diaryEntryStorageMock.GetErr = nil
 
 	// Test error from activityRegistrationStorage.Update
 	activityRegistrationStorageMock.UpdateErr = errors.New("ARS update failed")
-	_, err = diaryEntryService.UpdateDiaryEntry(storedEntry.Id, updateBody)
+	_, err = diaryEntryService.UpdateDiaryEntry(storedEntry.Id, updateBody, time.UTC)
 	assert.Error(t, err)
 	assert.EqualError(t, err, "ARS update failed")
 	activityRegistrationStorageMock.UpdateErr = nil
 
 	// Test error from diaryEntryStorage.Update
 	diaryEntryStorageMock.UpdateErr = errors.New("DES update failed")
-	_, err = diaryEntryService.UpdateDiaryEntry(storedEntry.Id, updateBody)
+	_, err = diaryEntryService.UpdateDiaryEntry(storedEntry.Id, updateBody, time.UTC)
 	assert.Error(t, err)
 	assert.EqualError(t, err, "DES update failed")
 	diaryEntryStorageMock.UpdateErr = nil
 }
 
+// Activity registration storage that tracks how many updates run at once.
+type overlapTrackingRegistrationStorage struct {
+	*memory.ActivityRegistrationStorage
+	inFlight    atomic.Int32
+	maxInFlight atomic.Int32
+}
+
+func (storage *overlapTrackingRegistrationStorage) Update(data interface{}) error {
+	inFlight := storage.inFlight.Add(1)
+	defer storage.inFlight.Add(-1)
+
+	for {
+		maxInFlight := storage.maxInFlight.Load()
+		if inFlight <= maxInFlight || storage.maxInFlight.CompareAndSwap(maxInFlight, inFlight) {
+			break
+		}
+	}
+
+	// Widens the window between the registration and the entry updates
+	time.Sleep(time.Millisecond)
+
+	return storage.ActivityRegistrationStorage.Update(data)
+}
+
+func TestUpdateDiaryEntryConcurrent(t *testing.T) {
+	t.Parallel()
+
+	database := memory.NewDatabase()
+	diaryEntryStorage := memory.NewDiaryEntryStorage(database)
+	registrationStorage := &overlapTrackingRegistrationStorage{ActivityRegistrationStorage: memory.NewActivityRegistrationStorage(database)}
+	diaryEntryService := NewDefaultDiaryEntryService(diaryEntryStorage, registrationStorage, memory.NewUserStorage(database))
+
+	storedEntry := &models.DiaryEntry{Title: "title", Content: "content", Registration: models.ActivityRegistration{RegistrationDate: 1, UserRefer: 1}}
+	otherEntry := &models.DiaryEntry{Title: "title", Content: "content", Registration: models.ActivityRegistration{RegistrationDate: 1, UserRefer: 1}}
+	assert.NoError(t, diaryEntryStorage.CreateMany([]*models.DiaryEntry{storedEntry, otherEntry}))
+
+	const updates = 20
+	var waitGroup sync.WaitGroup
+
+	for i := 1; i <= updates; i++ {
+		waitGroup.Add(1)
+		go func() {
+			defer waitGroup.Done()
+			_, err := diaryEntryService.UpdateDiaryEntry(storedEntry.Id, &UpdateDiaryEntryBody{
+				Title:       fmt.Sprintf("title %d", i),
+				Content:     fmt.Sprintf("content %d", i),
+				PublishDate: int64(i),
+			}, time.UTC)
+			assert.NoError(t, err)
+		}()
+	}
+	waitGroup.Wait()
+
+	// Test case: Updates of the same entry never overlap
+	assert.Equal(t, int32(1), registrationStorage.maxInFlight.Load())
+
+	// Test case: The stored entry is entirely the one of a single update
+	updatedEntry, err := diaryEntryService.GetDiaryEntryById(storedEntry.Id)
+	assert.NoError(t, err)
+	publishDate := updatedEntry.Registration.RegistrationDate
+	assert.Equal(t, fmt.Sprintf("title %d", publishDate), updatedEntry.Title)
+	assert.Equal(t, fmt.Sprintf("content %d", publishDate), updatedEntry.Content)
+
+	// Test case: The locks of the updated entries are released
+	waitGroup.Add(2)
+	for _, entryId := range []uint{storedEntry.Id, otherEntry.Id} {
+		go func() {
+			defer waitGroup.Done()
+			_, err := diaryEntryService.UpdateDiaryEntry(entryId, &UpdateDiaryEntryBody{Title: "title", Content: "content", PublishDate: 1}, time.UTC)
+			assert.NoError(t, err)
+		}()
+	}
+	waitGroup.Wait()
+
+	diaryEntryUpdateLocks.lock.Lock()
+	defer diaryEntryUpdateLocks.lock.Unlock()
+	assert.NotContains(t, diaryEntryUpdateLocks.locks, storedEntry.Id)
+	assert.NotContains(t, diaryEntryUpdateLocks.locks, otherEntry.Id)
+}
+
 func TestDeleteDiaryEntry(t *testing.T) {
-	originalDiaryEntryStorage := diaryEntryStorage
-	originalActivityRegistrationStorage := activityRegistrationStorage
+	t.Parallel()
 
 	diaryEntryStorageMock := &mockDiaryEntryStorage{
 		Entries: make(map[uint]*models.DiaryEntry),
 	}
 	activityRegistrationStorageMock := &mockActivityRegistrationStorage{}
 
-	diaryEntryStorage = diaryEntryStorageMock
-	activityRegistrationStorage = activityRegistrationStorageMock
-	defer func() {
-		diaryEntryStorage = originalDiaryEntryStorage
-		activityRegistrationStorage = originalActivityRegistrationStorage
-	}()
+	diaryEntryService := NewDefaultDiaryEntryService(diaryEntryStorageMock, activityRegistrationStorageMock, newuserStorageMockUserStorage())
 
 	activityRegId := uint(200)
-	entryToDelete := &models.DiaryEntry{Id: 2, Registration: models.ActivityRegistration{Id: activityRegId}}
+	entryToDelete := &models.DiaryEntry{Id: 2, Registration: models.ActivityRegistration{Id: activityRegId, UserRefer: 1}}
 	diaryEntryStorageMock.Entries[entryToDelete.Id] = entryToDelete
 
-	// Test successful delete
+	// Test case: The entry is deleted along with its registration in a single batch
 	err := diaryEntryService.DeleteDiaryEntry(entryToDelete.Id)
 	assert.NoError(t, err)
-	assert.Equal(t, activityRegId, activityRegistrationStorageMock.DeletedId)
+	assert.NotContains(t, diaryEntryStorageMock.Entries, entryToDelete.Id)
+	assert.Equal(t, [][]*models.DiaryEntry{{entryToDelete}}, diaryEntryStorageMock.DeletedBatches)
+	assert.Equal(t, uint(0), activityRegistrationStorageMock.DeletedId)
 
-	// Test error from GetDiaryEntryById
+	// Test case: Error from GetDiaryEntryById
 	diaryEntryStorageMock.GetErr = errors.New("get failed for delete")
 	err = diaryEntryService.DeleteDiaryEntry(entryToDelete.Id)
-	assert.Error(t, err)
 	assert.EqualError(t, err, "get failed for delete")
 	diaryEntryStorageMock.GetErr = nil
 
-	// Test error from activityRegistrationStorage.Delete
-	// Need to ensure the entry is found again by GetDiaryEntryById for this sub-test
+	// Test case: Error from the batch delete
 	diaryEntryStorageMock.Entries[entryToDelete.Id] = entryToDelete
-	activityRegistrationStorageMock.DeleteErr = errors.New("ARS delete failed")
+	diaryEntryStorageMock.DeleteErr = errors.New("DES delete failed")
 	err = diaryEntryService.DeleteDiaryEntry(entryToDelete.Id)
-	assert.Error(t, err)
-	assert.EqualError(t, err, "ARS delete failed")
-	activityRegistrationStorageMock.DeleteErr = nil
+	assert.EqualError(t, err, "DES delete failed")
+	diaryEntryStorageMock.DeleteErr = nil
+}
+
+func TestDeleteUserEntriesTimeRange(t *testing.T) {
+	t.Parallel()
+
+	database := memory.NewDatabase()
+	diaryEntryStorage := memory.NewDiaryEntryStorage(database)
+	diaryEntryService := NewDefaultDiaryEntryService(diaryEntryStorage, memory.NewActivityRegistrationStorage(database), memory.NewUserStorage(database))
+
+	diaryEntries := []*models.DiaryEntry{}
+
+	for _, registrationDate := range []int64{99, 100, 150, 200, 201} {
+		diaryEntries = append(diaryEntries, &models.DiaryEntry{Title: "title", Registration: models.ActivityRegistration{RegistrationDate: registrationDate, UserRefer: 1}})
+	}
+
+	otherUserEntry := &models.DiaryEntry{Title: "title", Registration: models.ActivityRegistration{RegistrationDate: 150, UserRefer: 2}}
+	assert.NoError(t, diaryEntryStorage.CreateMany(append(diaryEntries, otherUserEntry)))
+
+	// Test case: The entries on both ends of the range are deleted, but not the ones outside it or other users' ones
+	deleted, err := diaryEntryService.DeleteUserEntriesTimeRange(1, 100, 200)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, deleted)
+
+	userEntries, err := diaryEntryService.GetUserEntries(1)
+	assert.NoError(t, err)
+	assert.Equal(t, []*models.DiaryEntry{diaryEntries[4], diaryEntries[0]}, userEntries)
+
+	otherUserEntries, err := diaryEntryService.GetUserEntries(2)
+	assert.NoError(t, err)
+	assert.Len(t, otherUserEntries, 1)
+
+	// Test case: An empty range deletes nothing
+	deleted, err = diaryEntryService.DeleteUserEntriesTimeRange(1, 100, 200)
+	assert.NoError(t, err)
+	assert.Zero(t, deleted)
+
+	// Test case: A failed delete reports no deleted entries
+	diaryEntryStorageMock := &mockDiaryEntryStorage{
+		Entries:     map[uint]*models.DiaryEntry{1: {Id: 1}},
+		UserEntries: map[uint][]*models.DiaryEntry{1: {{Id: 1, Registration: models.ActivityRegistration{RegistrationDate: 100, UserRefer: 1}}}},
+		DeleteErr:   errors.New("delete failed"),
+	}
+	failingService := NewDefaultDiaryEntryService(diaryEntryStorageMock, &mockActivityRegistrationStorage{}, newuserStorageMockUserStorage())
+
+	deleted, err = failingService.DeleteUserEntriesTimeRange(1, 0, 1000)
+	assert.EqualError(t, err, "delete failed")
+	assert.Zero(t, deleted)
+}
+
+func TestDiaryEntryServiceWithMemoryStorage(t *testing.T) {
+	t.Parallel()
+
+	database := memory.NewDatabase()
+	diaryEntryService := NewDefaultDiaryEntryService(
+		memory.NewDiaryEntryStorage(database),
+		memory.NewActivityRegistrationStorage(database),
+		memory.NewUserStorage(database),
+	)
+
+	savedEntry, err := diaryEntryService.SaveDiaryEntry(&SaveDiaryEntryBody{Title: "Title", Content: "Content", PublishDate: 100}, 1, time.UTC)
+	assert.NoError(t, err)
+
+	_, err = diaryEntryService.UpdateDiaryEntry(savedEntry.Id, &UpdateDiaryEntryBody{Title: "New title", Content: "New content", PublishDate: 200}, time.UTC)
+	assert.NoError(t, err)
+
+	userEntries, err := diaryEntryService.GetUserEntries(1)
+	assert.NoError(t, err)
+	assert.Len(t, userEntries, 1)
+	assert.Equal(t, "New title", userEntries[0].Title)
+	assert.Equal(t, int64(200), userEntries[0].Registration.RegistrationDate)
+
+	assert.NoError(t, diaryEntryService.DeleteDiaryEntry(savedEntry.Id))
+	_, err = diaryEntryService.GetDiaryEntryById(savedEntry.Id)
+	assert.IsType(t, &models.DbNotFoundError{}, err)
 }
@@ -0,0 +1,28 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/adfer-dev/analock-api/constants"
+)
+
+// Sentinel errors returned by services, so handlers can map them to status codes using errors.Is
+var (
+	ErrInvalidToken              = errors.New(constants.ErrorTokenNotValid)
+	ErrRefreshTokenExpired       = errors.New("refresh token expired. Please, authenticate again at /auth/authenticate")
+	ErrUserNotFound              = errors.New("user not found")
+	ErrSessionNotFound           = errors.New("session not found")
+	ErrImpersonationNotAllowed   = errors.New("admins cannot be impersonated")
+	ErrProviderTokenInvalid      = errors.New("provider token not valid")
+	ErrProviderNotSupported      = errors.New("login provider not supported")
+	ErrProviderAlreadyLinked     = errors.New("login provider already linked to an account")
+	ErrSignupClosed              = errors.New("registration closed")
+	ErrInviteCodeInvalid         = errors.New("invite code not valid")
+	ErrDiaryEntryImportBatchSize = fmt.Errorf("the number of entries to import must be between 1 and %d", constants.DiaryEntryImportMaxBatchSize)
+	ErrDiaryEntryQuotaReached    = errors.New("the maximum number of diary entries has been reached")
+	ErrDiaryEntryDayTaken        = errors.New("there is already a diary entry on that day")
+	ErrSweepWritesInFlight       = errors.New("activity registrations are being written, please try again later")
+	ErrUpstreamUnavailable       = errors.New("upstream service unavailable")
+	ErrCollectionNotAllowed      = errors.New("the book is not in any of the allowed collections")
+)
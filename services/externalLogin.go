@@ -6,15 +6,15 @@ import (
 )
 
 type UpdateExternalLoginBody struct {
-	ClientToken string `json:"provider_client_token"`
+	Provider    models.LoginProvider `json:"provider"`
+	ClientToken string               `json:"provider_client_token"`
 }
 
-var externalLoginStorage storage.ExternalLoginStorageInterface = &storage.ExternalLoginStorage{}
-
 // ExternalLoginService defines all operations for the external login service.
 type ExternalLoginService interface {
 	GetExternalLoginById(id uint) (*models.ExternalLogin, error)
 	GetExternalLoginByClientId(clientId string) (*models.ExternalLogin, error)
+	GetUserExternalLogins(userId uint) ([]*models.ExternalLogin, error)
 	SaveExternalLogin(externalLoginBody *models.ExternalLogin) (*models.ExternalLogin, error)
 	UpdateExternalLogin(externalLoginBody *models.ExternalLogin) (*models.ExternalLogin, error)
 	UpdateUserExternalLoginToken(userId uint, externalLoginBody *UpdateExternalLoginBody) (*models.ExternalLogin, error)
@@ -22,15 +22,19 @@ type ExternalLoginService interface {
 }
 
 // ExternalLoginServiceImpl is the concrete implementation of ExternalLoginService.
-type ExternalLoginServiceImpl struct{}
+type ExternalLoginServiceImpl struct {
+	externalLoginStorage storage.ExternalLoginStorageInterface
+}
 
-// NewExternalLoginServiceImpl creates a new DefaultExternalLoginService.
-func NewExternalLoginServiceImpl() *ExternalLoginServiceImpl {
-	return &ExternalLoginServiceImpl{}
+var _ ExternalLoginService = (*ExternalLoginServiceImpl)(nil)
+
+// NewExternalLoginServiceImpl creates a new ExternalLoginServiceImpl backed by the given storage.
+func NewExternalLoginServiceImpl(externalLoginStorage storage.ExternalLoginStorageInterface) *ExternalLoginServiceImpl {
+	return &ExternalLoginServiceImpl{externalLoginStorage: externalLoginStorage}
 }
 
 func (externalLoginService *ExternalLoginServiceImpl) GetExternalLoginById(id uint) (*models.ExternalLogin, error) {
-	externalLogin, err := externalLoginStorage.Get(id)
+	externalLogin, err := externalLoginService.externalLoginStorage.Get(id)
 	if err != nil {
 		return nil, err
 	}
@@ -38,15 +42,23 @@ func (externalLoginService *ExternalLoginServiceImpl) GetExternalLoginById(id ui
 }
 
 func (externalLoginService *ExternalLoginServiceImpl) GetExternalLoginByClientId(clientId string) (*models.ExternalLogin, error) {
-	externalLogin, err := externalLoginStorage.GetByClientId(clientId)
+	externalLogin, err := externalLoginService.externalLoginStorage.GetByClientId(clientId)
 	if err != nil {
 		return nil, err
 	}
 	return externalLogin.(*models.ExternalLogin), nil
 }
 
+func (externalLoginService *ExternalLoginServiceImpl) GetUserExternalLogins(userId uint) ([]*models.ExternalLogin, error) {
+	externalLogins, err := externalLoginService.externalLoginStorage.GetByUserId(userId)
+	if err != nil {
+		return nil, err
+	}
+	return externalLogins.([]*models.ExternalLogin), nil
+}
+
 func (externalLoginService *ExternalLoginServiceImpl) SaveExternalLogin(externalLoginBody *models.ExternalLogin) (*models.ExternalLogin, error) {
-	err := externalLoginStorage.Create(externalLoginBody)
+	err := externalLoginService.externalLoginStorage.Create(externalLoginBody)
 	if err != nil {
 		return nil, err
 	}
@@ -54,7 +66,7 @@ func (externalLoginService *ExternalLoginServiceImpl) SaveExternalLogin(external
 }
 
 func (externalLoginService *ExternalLoginServiceImpl) UpdateExternalLogin(externalLoginBody *models.ExternalLogin) (*models.ExternalLogin, error) {
-	err := externalLoginStorage.Update(externalLoginBody)
+	err := externalLoginService.externalLoginStorage.Update(externalLoginBody)
 	if err != nil {
 		return nil, err
 	}
@@ -64,9 +76,10 @@ func (externalLoginService *ExternalLoginServiceImpl) UpdateExternalLogin(extern
 func (externalLoginService *ExternalLoginServiceImpl) UpdateUserExternalLoginToken(userId uint, externalLoginBody *UpdateExternalLoginBody) (*models.ExternalLogin, error) {
 	dbExternalLogin := &models.ExternalLogin{
 		UserRefer:   userId,
+		Provider:    externalLoginBody.Provider,
 		ClientToken: externalLoginBody.ClientToken,
 	}
-	err := externalLoginStorage.UpdateUserExternalLoginToken(dbExternalLogin)
+	err := externalLoginService.externalLoginStorage.UpdateUserExternalLoginToken(dbExternalLogin)
 	if err != nil {
 		return nil, err
 	}
@@ -74,5 +87,5 @@ func (externalLoginService *ExternalLoginServiceImpl) UpdateUserExternalLoginTok
 }
 
 func (externalLoginService *ExternalLoginServiceImpl) DeleteExternalLogin(id uint) error {
-	return externalLoginStorage.Delete(id)
+	return externalLoginService.externalLoginStorage.Delete(id)
 }
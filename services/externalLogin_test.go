@@ -14,6 +14,7 @@ type mockExternalLoginStorage struct {
 	LoginsByClientId                map[string]*models.ExternalLogin
 	GetErr                          error
 	GetByClientIdErr                error
+	GetByUserIdErr                  error
 	CreateErr                       error
 	UpdateErr                       error
 	UpdateUserExternalLoginTokenErr error
@@ -50,6 +51,19 @@ func (externalLoginStorageMock *mockExternalLoginStorage) GetByClientId(clientId
 	return login, nil
 }
 
+func (externalLoginStorageMock *mockExternalLoginStorage) GetByUserId(userId uint) (interface{}, error) {
+	if externalLoginStorageMock.GetByUserIdErr != nil {
+		return nil, externalLoginStorageMock.GetByUserIdErr
+	}
+	userLogins := []*models.ExternalLogin{}
+	for _, login := range externalLoginStorageMock.LoginsById {
+		if login.UserRefer == userId {
+			userLogins = append(userLogins, login)
+		}
+	}
+	return userLogins, nil
+}
+
 func (externalLoginStorageMock *mockExternalLoginStorage) Create(data interface{}) error {
 	if externalLoginStorageMock.CreateErr != nil {
 		return externalLoginStorageMock.CreateErr
@@ -112,13 +126,11 @@ func (externalLoginStorageMock *mockExternalLoginStorage) Delete(id uint) error
 }
 
 // --- Test Cases ---
-var externalLoginService ExternalLoginService = &ExternalLoginServiceImpl{}
-
 func TestGetExternalLoginById(t *testing.T) {
-	originalExternalLoginStorage := externalLoginStorage
+	t.Parallel()
+
 	externalLoginStorageMock := newMockExternalLoginStorage()
-	externalLoginStorage = externalLoginStorageMock
-	defer func() { externalLoginStorage = originalExternalLoginStorage }()
+	externalLoginService := NewExternalLoginServiceImpl(externalLoginStorageMock)
 
 	testLogin := &models.ExternalLogin{Id: 1, ClientId: "client1", UserRefer: 10}
 	externalLoginStorageMock.LoginsById[testLogin.Id] = testLogin
@@ -137,10 +149,10 @@ func TestGetExternalLoginById(t *testing.T) {
 }
 
 func TestGetExternalLoginByClientId(t *testing.T) {
-	originalExternalLoginStorage := externalLoginStorage
+	t.Parallel()
+
 	externalLoginStorageMock := newMockExternalLoginStorage()
-	externalLoginStorage = externalLoginStorageMock
-	defer func() { externalLoginStorage = originalExternalLoginStorage }()
+	externalLoginService := NewExternalLoginServiceImpl(externalLoginStorageMock)
 
 	testLogin := &models.ExternalLogin{Id: 1, ClientId: "client-abc", UserRefer: 11}
 	externalLoginStorageMock.LoginsByClientId[testLogin.ClientId] = testLogin
@@ -159,10 +171,10 @@ func TestGetExternalLoginByClientId(t *testing.T) {
 }
 
 func TestSaveExternalLogin(t *testing.T) {
-	originalExternalLoginStorage := externalLoginStorage
+	t.Parallel()
+
 	externalLoginStorageMock := newMockExternalLoginStorage()
-	externalLoginStorage = externalLoginStorageMock
-	defer func() { externalLoginStorage = originalExternalLoginStorage }()
+	externalLoginService := NewExternalLoginServiceImpl(externalLoginStorageMock)
 
 	loginToSave := &models.ExternalLogin{ClientId: "new-client", UserRefer: 12, ClientToken: "token"}
 
@@ -180,10 +192,10 @@ func TestSaveExternalLogin(t *testing.T) {
 }
 
 func TestUpdateExternalLogin(t *testing.T) {
-	originalExternalLoginStorage := externalLoginStorage
+	t.Parallel()
+
 	externalLoginStorageMock := newMockExternalLoginStorage()
-	externalLoginStorage = externalLoginStorageMock
-	defer func() { externalLoginStorage = originalExternalLoginStorage }()
+	externalLoginService := NewExternalLoginServiceImpl(externalLoginStorageMock)
 
 	initialLogin := &models.ExternalLogin{Id: 20, ClientId: "client-initial", UserRefer: 15}
 	externalLoginStorageMock.LoginsById[initialLogin.Id] = initialLogin
@@ -203,13 +215,13 @@ func TestUpdateExternalLogin(t *testing.T) {
 }
 
 func TestUpdateUserExternalLoginToken(t *testing.T) {
-	originalExternalLoginStorage := externalLoginStorage
+	t.Parallel()
+
 	externalLoginStorageMock := newMockExternalLoginStorage()
-	externalLoginStorage = externalLoginStorageMock
-	defer func() { externalLoginStorage = originalExternalLoginStorage }()
+	externalLoginService := NewExternalLoginServiceImpl(externalLoginStorageMock)
 
 	userId := uint(25)
-	updateBody := &UpdateExternalLoginBody{ClientToken: "new-user-token"}
+	updateBody := &UpdateExternalLoginBody{Provider: models.Google, ClientToken: "new-user-token"}
 
 	updatedLogin, err := externalLoginService.UpdateUserExternalLoginToken(userId, updateBody)
 
@@ -224,6 +236,7 @@ func TestUpdateUserExternalLoginToken(t *testing.T) {
 	assert.NotNil(t, externalLoginStorageMock.LastUpdatedUserTokenLogin)
 	assert.Equal(t, userId, externalLoginStorageMock.LastUpdatedUserTokenLogin.UserRefer)
 	assert.Equal(t, updateBody.ClientToken, externalLoginStorageMock.LastUpdatedUserTokenLogin.ClientToken)
+	assert.Equal(t, models.Google, externalLoginStorageMock.LastUpdatedUserTokenLogin.Provider)
 
 	externalLoginStorageMock.UpdateUserExternalLoginTokenErr = errors.New("forced UpdateUserExternalLoginToken error")
 	_, err = externalLoginService.UpdateUserExternalLoginToken(userId, updateBody)
@@ -231,11 +244,31 @@ func TestUpdateUserExternalLoginToken(t *testing.T) {
 	assert.EqualError(t, err, "forced UpdateUserExternalLoginToken error")
 }
 
+func TestGetUserExternalLogins(t *testing.T) {
+	t.Parallel()
+
+	externalLoginStorageMock := newMockExternalLoginStorage()
+	externalLoginService := NewExternalLoginServiceImpl(externalLoginStorageMock)
+
+	userLogin := &models.ExternalLogin{Id: 1, ClientId: "client-user", UserRefer: 3, Provider: models.Google}
+	otherUserLogin := &models.ExternalLogin{Id: 2, ClientId: "client-other", UserRefer: 4, Provider: models.Google}
+	externalLoginStorageMock.LoginsById[userLogin.Id] = userLogin
+	externalLoginStorageMock.LoginsById[otherUserLogin.Id] = otherUserLogin
+
+	logins, err := externalLoginService.GetUserExternalLogins(3)
+	assert.NoError(t, err)
+	assert.Equal(t, []*models.ExternalLogin{userLogin}, logins)
+
+	externalLoginStorageMock.GetByUserIdErr = errors.New("forced GetByUserId error")
+	_, err = externalLoginService.GetUserExternalLogins(3)
+	assert.EqualError(t, err, "forced GetByUserId error")
+}
+
 func TestDeleteExternalLogin(t *testing.T) {
-	originalELS := externalLoginStorage
+	t.Parallel()
+
 	externalLoginStorageMock := newMockExternalLoginStorage()
-	externalLoginStorage = externalLoginStorageMock
-	defer func() { externalLoginStorage = originalELS }()
+	externalLoginService := NewExternalLoginServiceImpl(externalLoginStorageMock)
 
 	loginToDelete := &models.ExternalLogin{Id: 30, ClientId: "client-delete"}
 	externalLoginStorageMock.LoginsById[loginToDelete.Id] = loginToDelete
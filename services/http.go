@@ -11,8 +11,13 @@ import (
 	"github.com/adfer-dev/analock-api/utils"
 )
 
-// Performs an HTTP request with given method, URL, body and retry count.
-func PerformRequest[T any](method string, url string, body interface{}) (*T, error) {
+// Time waited before the first retry of a failed request.
+var retryInitialInterval = time.Second
+
+// Performs an HTTP request with given method, URL, body and headers, retrying it up to the given number of times.
+// Calls are guarded by the given circuit breaker, which only counts network errors and 5xx responses as failures.
+// An empty response body is read as the zero value of T.
+func PerformRequest[T any](breaker *CircuitBreaker, method string, url string, body interface{}, headers map[string]string, maxRetries uint) (*T, error) {
 	utils.GetCustomLogger().Infof(
 		"HTTP request: [%s]%s\n",
 		method,
@@ -30,17 +35,32 @@ func PerformRequest[T any](method string, url string, body interface{}) (*T, err
 		bodyReader = bytes.NewReader(bodyBytes)
 	}
 	request, buildReqErr := http.NewRequest(method, url, bodyReader)
-	request.Header.Set("Content-Type", "application/json")
 
 	if buildReqErr != nil {
 		return nil, buildReqErr
 	}
 
+	request.Header.Set("Content-Type", "application/json")
+
+	for name, value := range headers {
+		request.Header.Set(name, value)
+	}
+
 	client := utils.GetDefaultHttpClient()
 
 	// wrap request execution inside a function variable
 	reqExecution := func() (io.ReadCloser, error) {
+		if allowErr := breaker.Allow(); allowErr != nil {
+			return nil, allowErr
+		}
+
+		// retries must send the body again, as the previous attempt consumed it
+		if request.GetBody != nil {
+			request.Body, _ = request.GetBody()
+		}
+
 		response, reqErr := client.Do(request)
+		recordUpstreamResult(breaker, response, reqErr)
 
 		if reqErr != nil {
 			return nil, reqErr
@@ -54,12 +74,13 @@ func PerformRequest[T any](method string, url string, body interface{}) (*T, err
 				url,
 				response.StatusCode,
 			)
+			response.Body.Close()
 			return nil, errors.New("request error")
 		}
 		return response.Body, nil
 	}
 
-	responseBody, reqErr := retry(reqExecution, 5)
+	responseBody, reqErr := retry(reqExecution, maxRetries)
 
 	if reqErr != nil {
 		return nil, reqErr
@@ -68,9 +89,9 @@ func PerformRequest[T any](method string, url string, body interface{}) (*T, err
 
 	// Write response body into given data structure
 	var res T
-	readErr := utils.ReadJSON(responseBody, &res)
+	readErr := utils.ReadResponseJSON(responseBody, &res)
 
-	if readErr != nil {
+	if readErr != nil && !errors.Is(readErr, io.EOF) {
 		utils.GetCustomLogger().Errorf(
 			"Error on response unmarshal: %s\n",
 			readErr.Error(),
@@ -83,30 +104,53 @@ func PerformRequest[T any](method string, url string, body interface{}) (*T, err
 
 // Executes the HTTP request that is wrapped in given function and retries it.
 //
-// It retries for the given maximum number of retries.
-// The retry interval is exponential, being doubled for each retry (starting at 1s).
-func retry(f func() (io.ReadCloser, error), maxRetries uint) (io.ReadCloser, error) {
+// It retries for the given maximum number of retries, unless the circuit breaker short-circuits the request.
+// The first retry is immediate, and the interval between the next ones is exponential, starting at the initial one.
+func retry[T any](f func() (T, error), maxRetries uint) (T, error) {
+	var zero T
+
 	// First execute request
-	if res, err := f(); err == nil {
+	res, err := f()
+
+	if err == nil {
 		return res, nil
 	}
 
 	// If request fails, retry
 	var currentRetries uint = 0
-	interval := 1000
+	interval := retryInitialInterval
 
-	for currentRetries < maxRetries {
+	for currentRetries < maxRetries && !errors.Is(err, ErrUpstreamUnavailable) {
 		utils.GetCustomLogger().Errorf(
 			"Performing request retry... %d retries left.\n",
 			maxRetries-currentRetries,
 		)
-		if res, err := f(); err == nil {
+		if res, err = f(); err == nil {
 			return res, nil
 		}
 		currentRetries++
-		interval *= 2
-		time.Sleep(time.Duration(interval) * time.Millisecond)
+
+		// No need to wait when there are no retries left or the circuit is open
+		if currentRetries < maxRetries && !errors.Is(err, ErrUpstreamUnavailable) {
+			time.Sleep(interval)
+			interval *= 2
+		}
+	}
+
+	if errors.Is(err, ErrUpstreamUnavailable) {
+		return zero, err
+	}
+
+	return zero, errors.New("request error")
+}
+
+// Records the result of a call to an upstream service on the given circuit breaker.
+// Client errors do not mean the service is down, so only network errors and 5xx responses are failures.
+func recordUpstreamResult(breaker *CircuitBreaker, response *http.Response, reqErr error) {
+	if reqErr != nil || response.StatusCode >= 500 {
+		breaker.RecordFailure()
+		return
 	}
 
-	return nil, errors.New("request error")
+	breaker.RecordSuccess()
 }
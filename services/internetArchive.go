@@ -3,69 +3,284 @@ package services
 import (
 	"fmt"
 	"net/http"
+	neturl "net/url"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/adfer-dev/analock-api/config"
+	"github.com/adfer-dev/analock-api/constants"
 	"github.com/adfer-dev/analock-api/models"
 	"github.com/adfer-dev/analock-api/utils"
 )
 
 type InternetArchiveService interface {
-	SearchBooks(collection string, language string, subject string, rows string) (*models.InternetArchiveSearchResponse, error)
+	SearchBooks(collection string, language string, subjects []string, rows string, page int) (*models.InternetArchiveSearchResponse, error)
 	GetBookMetadata(bookId string) (*models.InternetArchiveMetadataResponse, error)
-	DownloadBook(bookId string, fileName string) (*http.Response, error)
+	GetRelatedBooks(metadata *models.InternetArchiveMetadata, rows int) (*models.InternetArchiveSearchResponse, error)
+	DownloadBook(bookId string, fileName string, byteRange string) (*http.Response, error)
+	GetBookFileHeaders(bookId string, fileName string) (*http.Response, error)
+	GetBookFileUrl(bookId string, fileName string) string
 }
 
-type InternetArchiveServiceImpl struct{}
+// Times each kind of call to Internet Archive API is retried after failing.
+// Downloads can take minutes and clients can resume them, so they are retried the least.
+const (
+	internetArchiveSearchRetries   uint = 2
+	internetArchiveMetadataRetries uint = 3
+	internetArchiveDownloadRetries uint = 1
+)
+
+type InternetArchiveServiceImpl struct {
+	// Base URL of the Internet Archive API. If empty, the one in the config is used.
+	BaseURL string
+	// Circuit breaker guarding the calls to the Internet Archive API. If nil, the breaker shared by all
+	// the services is used, configured from the config.
+	CircuitBreaker *CircuitBreaker
+}
+
+var _ InternetArchiveService = (*InternetArchiveServiceImpl)(nil)
+
+// Gets the base URL of the Internet Archive API.
+func (iaService *InternetArchiveServiceImpl) getBaseUrl() string {
+	if len(iaService.BaseURL) > 0 {
+		return iaService.BaseURL
+	}
+
+	return config.Get().InternetArchive.BaseUrl
+}
+
+// Gets the circuit breaker guarding the calls to the Internet Archive API.
+func (iaService *InternetArchiveServiceImpl) getCircuitBreaker() *CircuitBreaker {
+	if iaService.CircuitBreaker != nil {
+		return iaService.CircuitBreaker
+	}
+
+	return getInternetArchiveCircuitBreaker()
+}
+
+// Performs the given request to Internet Archive API, guarded by the circuit breaker.
+// Network errors and 5xx responses are retried up to the given number of times, other responses are returned as they are.
+func (iaService *InternetArchiveServiceImpl) doRequest(httpClient *http.Client, request *http.Request, maxRetries uint) (*http.Response, error) {
+	breaker := iaService.getCircuitBreaker()
+
+	return retry(func() (*http.Response, error) {
+		if allowErr := breaker.Allow(); allowErr != nil {
+			return nil, allowErr
+		}
+
+		response, requestErr := httpClient.Do(request)
+		recordUpstreamResult(breaker, response, requestErr)
+
+		if requestErr != nil {
+			return nil, requestErr
+		}
+
+		if response.StatusCode >= 500 {
+			utils.GetCustomLogger().Errorf(
+				"Error on HTTP request: [%s]%s - STATUS: %d\n",
+				request.Method,
+				request.URL.Redacted(),
+				response.StatusCode,
+			)
+			response.Body.Close()
+			return nil, fmt.Errorf("request error: status %d", response.StatusCode)
+		}
+
+		return response, nil
+	}, maxRetries)
+}
+
+// Builds the URL of the given book's file.
+func (iaService *InternetArchiveServiceImpl) buildDownloadUrl(bookId string, fileName string) string {
+	return fmt.Sprintf("%s/download/%s/%s", iaService.getBaseUrl(), bookId, fileName)
+}
+
+// Builds the URL clients can download the given book's file from directly.
+// Each segment of the identifier and file name is escaped, as file names can have spaces and belong to subdirectories.
+func (iaService *InternetArchiveServiceImpl) GetBookFileUrl(bookId string, fileName string) string {
+	fileSegments := strings.Split(fileName, "/")
+
+	for i, segment := range fileSegments {
+		fileSegments[i] = neturl.PathEscape(segment)
+	}
+
+	return fmt.Sprintf("%s/download/%s/%s", iaService.getBaseUrl(), neturl.PathEscape(bookId), strings.Join(fileSegments, "/"))
+}
 
 // Performs an HTTP request to Internet Archive API to get books that match the given criteria.
 //
-// It returns the number of books given in the rows param.
-func (iaService *InternetArchiveServiceImpl) SearchBooks(collection string, language string, subject string, rows string) (*models.InternetArchiveSearchResponse, error) {
+// Books match if they have any of the given subjects.
+// It returns the given page of results, each page having the number of books given in the rows param.
+func (iaService *InternetArchiveServiceImpl) SearchBooks(collection string, language string, subjects []string, rows string, page int) (*models.InternetArchiveSearchResponse, error) {
+	query := fmt.Sprintf(
+		"collection:%s AND language:%s AND subject:(%s) AND mediatype:texts",
+		quoteSearchTerm(collection),
+		quoteSearchTerm(language),
+		joinSearchTerms(subjects),
+	)
+
+	return iaService.searchBooks(query, rows, page)
+}
+
+// Quotes the given value as a phrase of a search query, escaping its quotes and backslashes,
+// so it is matched as a whole and cannot add conditions to the query.
+func quoteSearchTerm(value string) string {
+	escaped := strings.ReplaceAll(value, "\\", "\\\\")
+	escaped = strings.ReplaceAll(escaped, "\"", "\\\"")
+
+	return fmt.Sprintf("\"%s\"", escaped)
+}
+
+// Quotes each of the given values and joins them with OR, to match any of them.
+func joinSearchTerms(values []string) string {
+	quotedValues := make([]string, 0, len(values))
+
+	for _, value := range values {
+		quotedValues = append(quotedValues, quoteSearchTerm(value))
+	}
+
+	return strings.Join(quotedValues, " OR ")
+}
+
+// Checks whether any of the given collections is in the allowlist of the config.
+// Every collection is allowed when the allowlist is empty.
+func IsInternetArchiveCollectionAllowed(collections ...string) bool {
+	allowedCollections := config.Get().InternetArchive.AllowedCollections
+
+	if len(allowedCollections) == 0 {
+		return true
+	}
+
+	for _, collection := range collections {
+		if slices.Contains(allowedCollections, collection) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Performs a search on Internet Archive API for books that share subjects with the given book, excluding the book itself.
+// Only the first subjects of the book are used, and its language if known, so the query stays short.
+// If the config has an allowlist of collections, only books in them are searched.
+func (iaService *InternetArchiveServiceImpl) GetRelatedBooks(metadata *models.InternetArchiveMetadata, rows int) (*models.InternetArchiveSearchResponse, error) {
+	subjects := metadata.GetSubjects()
+
+	if len(subjects) == 0 {
+		return &models.InternetArchiveSearchResponse{Response: models.InternetArchiveBookResponse{Docs: []models.InternetArchiveBook{}}}, nil
+	}
+
+	if len(subjects) > constants.InternetArchiveRelatedBooksMaxSubjects {
+		subjects = subjects[:constants.InternetArchiveRelatedBooksMaxSubjects]
+	}
+
+	query := fmt.Sprintf("subject:(%s) AND mediatype:texts", joinSearchTerms(subjects))
+
+	if len(metadata.Language) > 0 {
+		query = fmt.Sprintf("%s AND language:%s", query, quoteSearchTerm(metadata.Language))
+	}
+
+	if allowedCollections := config.Get().InternetArchive.AllowedCollections; len(allowedCollections) > 0 {
+		query = fmt.Sprintf("%s AND collection:(%s)", query, joinSearchTerms(allowedCollections))
+	}
+
+	query = fmt.Sprintf("%s AND NOT identifier:%s", query, quoteSearchTerm(metadata.Identifier))
+
+	return iaService.searchBooks(query, strconv.Itoa(rows), 1)
+}
+
+// Performs an HTTP request to Internet Archive API to get the given page of the books that match the given query,
+// sorted by popularity.
+func (iaService *InternetArchiveServiceImpl) searchBooks(query string, rows string, page int) (*models.InternetArchiveSearchResponse, error) {
 	url := fmt.Sprintf(
-		"https://archive.org/advancedsearch.php?q=collection:%s+AND+language:%s+AND+subject:%s+AND+mediatype:texts&fl=title,creator,identifier&sort[]=downloads+desc&sort[]=avg_rating+desc&rows=%s&page=1&output=json",
-		collection,
-		language,
-		subject,
-		rows,
+		"%s/advancedsearch.php?q=%s&fl=title,creator,identifier,year,downloads&sort[]=downloads+desc&sort[]=avg_rating+desc&rows=%s&page=%d&output=json",
+		iaService.getBaseUrl(),
+		neturl.QueryEscape(query),
+		neturl.QueryEscape(rows),
+		page,
 	)
 
-	res, err := PerformRequest[models.InternetArchiveSearchResponse](http.MethodGet, url, nil)
+	res, err := PerformRequest[models.InternetArchiveSearchResponse](
+		iaService.getCircuitBreaker(),
+		http.MethodGet,
+		url,
+		nil,
+		nil,
+		internetArchiveSearchRetries,
+	)
 
 	if err != nil {
 		return nil, err
 	}
 
+	// Clients expect the books as an array, even if Internet Archive gives none
+	if res.Response.Docs == nil {
+		res.Response.Docs = []models.InternetArchiveBook{}
+	}
+
 	return res, nil
 }
 
 // Performs an HTTP request to Internet Archive API to get the metadata of the book that matches given identifier.
 func (iaService *InternetArchiveServiceImpl) GetBookMetadata(bookId string) (*models.InternetArchiveMetadataResponse, error) {
 	url := fmt.Sprintf(
-		"https://archive.org/metadata/%s", bookId)
+		"%s/metadata/%s", iaService.getBaseUrl(), bookId)
 
-	res, err := PerformRequest[models.InternetArchiveMetadataResponse](http.MethodGet, url, nil)
+	res, err := PerformRequest[models.InternetArchiveMetadataResponse](
+		iaService.getCircuitBreaker(),
+		http.MethodGet,
+		url,
+		nil,
+		nil,
+		internetArchiveMetadataRetries,
+	)
 
 	if err != nil {
 		return nil, err
 	}
 
+	// Clients expect the files as an array, even if Internet Archive gives none
+	if res.Files == nil {
+		res.Files = []models.InternetArchiveFile{}
+	}
+
 	return res, nil
 }
 
 // Performs an HTTP request to Internet Archive API to download a book's file.
 // The file that is returned depends on the given book identifier and file name.
-func (iaService *InternetArchiveServiceImpl) DownloadBook(bookId string, fileName string) (*http.Response, error) {
-	url := fmt.Sprintf(
-		"https://archive.org/download/%s/%s", bookId, fileName)
+// If byteRange is not empty, it is forwarded as the Range header so only that part of the file is returned.
+func (iaService *InternetArchiveServiceImpl) DownloadBook(bookId string, fileName string, byteRange string) (*http.Response, error) {
+	request, buildReqErr := http.NewRequest(http.MethodGet, iaService.buildDownloadUrl(bookId, fileName), nil)
+
+	if buildReqErr != nil {
+		return nil, buildReqErr
+	}
+
+	if len(byteRange) > 0 {
+		request.Header.Set("Range", byteRange)
+	}
+
+	response, requestErr := iaService.doRequest(utils.GetCustomHttpClient(10*time.Minute), request, internetArchiveDownloadRetries)
+
+	if requestErr != nil {
+		return nil, requestErr
+	}
+
+	return response, nil
+}
 
-	request, buildReqErr := http.NewRequest(http.MethodGet, url, nil)
+// Performs a HEAD request to Internet Archive API to get the headers of a book's file without downloading it.
+func (iaService *InternetArchiveServiceImpl) GetBookFileHeaders(bookId string, fileName string) (*http.Response, error) {
+	request, buildReqErr := http.NewRequest(http.MethodHead, iaService.buildDownloadUrl(bookId, fileName), nil)
 
 	if buildReqErr != nil {
 		return nil, buildReqErr
 	}
 
-	httpClient := utils.GetCustomHttpClient(10 * time.Minute)
-	response, requestErr := httpClient.Do(request)
+	response, requestErr := iaService.doRequest(utils.GetDefaultHttpClient(), request, internetArchiveDownloadRetries)
 
 	if requestErr != nil {
 		return nil, requestErr
@@ -0,0 +1,371 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/adfer-dev/analock-api/config"
+	"github.com/adfer-dev/analock-api/models"
+	"github.com/stretchr/testify/assert"
+)
+
+// Mock Internet Archive server, serving a search result, the metadata of a book and its file.
+// Requests must identify the API with the default User-Agent.
+func newMockInternetArchiveServer(t *testing.T, bookContent []byte) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		assert.Equal(t, config.DefaultOutboundUserAgent, req.Header.Get("User-Agent"))
+
+		switch req.URL.Path {
+		case "/advancedsearch.php":
+			assert.Equal(t, "5", req.URL.Query().Get("rows"))
+			assert.Equal(t, "title,creator,identifier,year,downloads", req.URL.Query().Get("fl"))
+			res.Header().Set("Content-Type", "application/json")
+			res.Write([]byte(`{"response":{"numFound":2,"start":0,"docs":[` +
+				`{"identifier":"book1","title":"Book 1","creator":"Author","year":"1865","downloads":1200},` +
+				`{"identifier":"book2","title":"Book 2"}]}}`))
+		case "/metadata/book1":
+			res.Header().Set("Content-Type", "application/json")
+			res.Write([]byte(`{"files":[{"name":"book1.epub","format":"EPUB"}],"metadata":{"identifier":"book1"}}`))
+		case "/download/book1/book1.epub":
+			http.ServeContent(res, req, "", time.Time{}, bytes.NewReader(bookContent))
+		default:
+			res.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+func TestInternetArchiveBaseUrl(t *testing.T) {
+	t.Run("default", func(t *testing.T) {
+		t.Setenv("API_IA_BASE_URL", "")
+		assert.Equal(t, config.DefaultInternetArchiveUrl, (&InternetArchiveServiceImpl{}).getBaseUrl())
+	})
+
+	t.Run("from_env", func(t *testing.T) {
+		t.Setenv("API_IA_BASE_URL", "https://mirror.example.com")
+		assert.Equal(t, "https://mirror.example.com", (&InternetArchiveServiceImpl{}).getBaseUrl())
+	})
+
+	t.Run("field_over_env", func(t *testing.T) {
+		t.Setenv("API_IA_BASE_URL", "https://mirror.example.com")
+		iaService := &InternetArchiveServiceImpl{BaseURL: "http://localhost:8080"}
+		assert.Equal(t, "http://localhost:8080", iaService.getBaseUrl())
+	})
+}
+
+func TestSearchBooks(t *testing.T) {
+	server := newMockInternetArchiveServer(t, nil)
+	iaService := &InternetArchiveServiceImpl{BaseURL: server.URL}
+
+	searchResponse, err := iaService.SearchBooks("books", "english", []string{"fiction"}, "5", 1)
+
+	assert.NoError(t, err)
+	assert.Equal(t, 2, searchResponse.Response.NumFound)
+	assert.Equal(t, []models.InternetArchiveBook{
+		{Identifier: "book1", Title: "Book 1", Creator: "Author", Year: 1865, Downloads: 1200},
+		// Books without the optional fields are still returned
+		{Identifier: "book2", Title: "Book 2"},
+	}, searchResponse.Response.Docs)
+}
+
+func TestSearchBooksPage(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		assert.Equal(t, "3", req.URL.Query().Get("page"))
+		res.Header().Set("Content-Type", "application/json")
+		res.Write([]byte(`{"response":{"numFound":12,"start":10,"docs":[{"identifier":"book11"},{"identifier":"book12"}]}}`))
+	}))
+	defer server.Close()
+	iaService := &InternetArchiveServiceImpl{BaseURL: server.URL}
+
+	searchResponse, err := iaService.SearchBooks("books", "english", []string{"fiction"}, "5", 3)
+
+	assert.NoError(t, err)
+	assert.Equal(t, 12, searchResponse.Response.NumFound)
+	assert.Equal(t, 10, searchResponse.Response.Start)
+	assert.Len(t, searchResponse.Response.Docs, 2)
+}
+
+func TestSearchBooksSubjects(t *testing.T) {
+	tests := []struct {
+		name          string
+		subjects      []string
+		expectedQuery string
+	}{
+		{"Single subject", []string{"fiction"}, `collection:"books" AND language:"english" AND subject:("fiction") AND mediatype:texts`},
+		{"Multiple subjects", []string{"fiction", "poetry"}, `collection:"books" AND language:"english" AND subject:("fiction" OR "poetry") AND mediatype:texts`},
+		{"Subject with spaces", []string{"science fiction"}, `collection:"books" AND language:"english" AND subject:("science fiction") AND mediatype:texts`},
+		{"Subject with query syntax", []string{`fiction") OR collection:("other`, `a\b`}, `collection:"books" AND language:"english" AND subject:("fiction\") OR collection:(\"other" OR "a\\b") AND mediatype:texts`},
+	}
+
+	for _, testCase := range tests {
+		t.Run(testCase.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+				assert.Equal(t, testCase.expectedQuery, req.URL.Query().Get("q"))
+				res.Header().Set("Content-Type", "application/json")
+				res.Write([]byte(`{"response":{"numFound":0,"start":0,"docs":[]}}`))
+			}))
+			defer server.Close()
+			iaService := &InternetArchiveServiceImpl{BaseURL: server.URL}
+
+			_, err := iaService.SearchBooks("books", "english", testCase.subjects, "5", 1)
+
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestInternetArchiveEmptyLists(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		// Internet Archive leaves out the lists it has no items for
+		res.Header().Set("Content-Type", "application/json")
+		res.Write([]byte(`{"response":{"numFound":0,"start":0}}`))
+	}))
+	defer server.Close()
+	iaService := &InternetArchiveServiceImpl{BaseURL: server.URL}
+
+	searchResponse, err := iaService.SearchBooks("books", "english", []string{"fiction"}, "5", 1)
+	assert.NoError(t, err)
+	serializedResponse, marshalErr := json.Marshal(searchResponse)
+	assert.NoError(t, marshalErr)
+	assert.JSONEq(t, `{"response":{"numFound":0,"start":0,"docs":[]}}`, string(serializedResponse))
+
+	metadata, err := iaService.GetBookMetadata("book1")
+	assert.NoError(t, err)
+	serializedMetadata, marshalErr := json.Marshal(metadata)
+	assert.NoError(t, marshalErr)
+	assert.JSONEq(t, `{"files":[],"metadata":{"identifier":"","title":""}}`, string(serializedMetadata))
+}
+
+func TestGetBookMetadata(t *testing.T) {
+	server := newMockInternetArchiveServer(t, nil)
+	iaService := &InternetArchiveServiceImpl{BaseURL: server.URL}
+
+	metadata, err := iaService.GetBookMetadata("book1")
+
+	assert.NoError(t, err)
+	assert.Equal(t, "book1", metadata.Metadata.Identifier)
+	assert.NotNil(t, metadata.FindFile("book1.epub"))
+}
+
+func TestDownloadBook(t *testing.T) {
+	bookContent := []byte("0123456789")
+	server := newMockInternetArchiveServer(t, bookContent)
+	iaService := &InternetArchiveServiceImpl{BaseURL: server.URL}
+
+	t.Run("whole_file", func(t *testing.T) {
+		response, err := iaService.DownloadBook("book1", "book1.epub", "")
+		assert.NoError(t, err)
+		defer response.Body.Close()
+
+		body, _ := io.ReadAll(response.Body)
+		assert.Equal(t, http.StatusOK, response.StatusCode)
+		assert.Equal(t, bookContent, body)
+	})
+
+	t.Run("byte_range", func(t *testing.T) {
+		response, err := iaService.DownloadBook("book1", "book1.epub", "bytes=2-4")
+		assert.NoError(t, err)
+		defer response.Body.Close()
+
+		body, _ := io.ReadAll(response.Body)
+		assert.Equal(t, http.StatusPartialContent, response.StatusCode)
+		assert.Equal(t, []byte("234"), body)
+	})
+
+	t.Run("missing_file", func(t *testing.T) {
+		response, err := iaService.DownloadBook("book1", "missing.epub", "")
+		assert.NoError(t, err)
+		defer response.Body.Close()
+
+		assert.Equal(t, http.StatusNotFound, response.StatusCode)
+	})
+}
+
+func TestGetBookFileUrl(t *testing.T) {
+	iaService := &InternetArchiveServiceImpl{BaseURL: "https://archive.org"}
+
+	tests := []struct {
+		name     string
+		bookId   string
+		fileName string
+		expected string
+	}{
+		{"Plain file", "book1", "book1.epub", "https://archive.org/download/book1/book1.epub"},
+		{"File with spaces", "book1", "my book.epub", "https://archive.org/download/book1/my%20book.epub"},
+		{"File in a subdirectory", "book1", "epub/book1#1.epub", "https://archive.org/download/book1/epub/book1%231.epub"},
+	}
+
+	for _, testCase := range tests {
+		t.Run(testCase.name, func(t *testing.T) {
+			assert.Equal(t, testCase.expected, iaService.GetBookFileUrl(testCase.bookId, testCase.fileName))
+		})
+	}
+}
+
+func TestGetRelatedBooks(t *testing.T) {
+	var receivedQuery, receivedRows string
+	server := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		receivedQuery = req.URL.Query().Get("q")
+		receivedRows = req.URL.Query().Get("rows")
+		res.Header().Set("Content-Type", "application/json")
+		res.Write([]byte(`{"response":{"numFound":1,"start":0,"docs":[{"identifier":"book2","title":"Book 2","creator":"Author"}]}}`))
+	}))
+	t.Cleanup(server.Close)
+	iaService := &InternetArchiveServiceImpl{BaseURL: server.URL}
+
+	t.Run("subjects_array", func(t *testing.T) {
+		metadata := &models.InternetArchiveMetadata{
+			Identifier: "book1",
+			Language:   "eng",
+			Subject:    models.InternetArchiveSubjects{"Fiction", " Science fiction ", "fiction"},
+		}
+
+		related, err := iaService.GetRelatedBooks(metadata, 5)
+
+		assert.NoError(t, err)
+		assert.Equal(t, "book2", related.Response.Docs[0].Identifier)
+		assert.Equal(t, `subject:("Fiction" OR "Science fiction") AND mediatype:texts AND language:"eng" AND NOT identifier:"book1"`, receivedQuery)
+		assert.Equal(t, "5", receivedRows)
+	})
+
+	t.Run("subjects_string", func(t *testing.T) {
+		metadata := &models.InternetArchiveMetadata{Identifier: "book1", Subject: models.InternetArchiveSubjects{"Poetry;History"}}
+
+		_, err := iaService.GetRelatedBooks(metadata, 10)
+
+		assert.NoError(t, err)
+		assert.Equal(t, `subject:("Poetry" OR "History") AND mediatype:texts AND NOT identifier:"book1"`, receivedQuery)
+	})
+
+	t.Run("allowed_collections", func(t *testing.T) {
+		t.Setenv("API_IA_ALLOWED_COLLECTIONS", "gutenberg,americana")
+		metadata := &models.InternetArchiveMetadata{Identifier: "book1", Subject: models.InternetArchiveSubjects{"Poetry"}}
+
+		_, err := iaService.GetRelatedBooks(metadata, 10)
+
+		assert.NoError(t, err)
+		assert.Equal(t, `subject:("Poetry") AND mediatype:texts AND collection:("gutenberg" OR "americana") AND NOT identifier:"book1"`, receivedQuery)
+	})
+
+	t.Run("no_subjects", func(t *testing.T) {
+		receivedQuery = ""
+		metadata := &models.InternetArchiveMetadata{Identifier: "book1"}
+
+		related, err := iaService.GetRelatedBooks(metadata, 10)
+
+		assert.NoError(t, err)
+		assert.Empty(t, related.Response.Docs)
+		assert.Empty(t, receivedQuery)
+	})
+}
+
+func TestInternetArchiveCircuitBreaker(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		requests++
+		res.WriteHeader(http.StatusBadGateway)
+	}))
+	t.Cleanup(server.Close)
+	iaService := &InternetArchiveServiceImpl{
+		BaseURL:        server.URL,
+		CircuitBreaker: NewCircuitBreaker(CircuitBreakerConfig{FailureThreshold: 1, FailureWindow: time.Minute, Cooldown: time.Hour}),
+	}
+
+	_, err := iaService.GetBookMetadata("book1")
+	assert.ErrorIs(t, err, ErrUpstreamUnavailable, "retries stop once the circuit opens")
+	assert.Equal(t, 1, requests)
+
+	_, err = iaService.SearchBooks("books", "english", []string{"fiction"}, "5", 1)
+	assert.ErrorIs(t, err, ErrUpstreamUnavailable)
+
+	_, err = iaService.DownloadBook("book1", "book1.epub", "")
+	assert.ErrorIs(t, err, ErrUpstreamUnavailable)
+
+	assert.Equal(t, 1, requests)
+}
+
+func TestInternetArchiveCircuitBreakerIgnoresClientErrors(t *testing.T) {
+	server := newMockInternetArchiveServer(t, nil)
+	iaService := &InternetArchiveServiceImpl{
+		BaseURL:        server.URL,
+		CircuitBreaker: NewCircuitBreaker(CircuitBreakerConfig{FailureThreshold: 1, FailureWindow: time.Minute, Cooldown: time.Hour}),
+	}
+
+	response, err := iaService.DownloadBook("book1", "missing.epub", "")
+	assert.NoError(t, err)
+	response.Body.Close()
+	assert.Equal(t, http.StatusNotFound, response.StatusCode)
+
+	_, err = iaService.GetBookMetadata("book1")
+	assert.NoError(t, err)
+}
+
+func TestInternetArchiveRetries(t *testing.T) {
+	originalRetryInitialInterval := retryInitialInterval
+	retryInitialInterval = time.Millisecond
+	defer func() { retryInitialInterval = originalRetryInitialInterval }()
+
+	requests := map[string]int{}
+	server := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		requests[req.URL.Path]++
+		res.WriteHeader(http.StatusInternalServerError)
+	}))
+	t.Cleanup(server.Close)
+	iaService := &InternetArchiveServiceImpl{
+		BaseURL:        server.URL,
+		CircuitBreaker: NewCircuitBreaker(CircuitBreakerConfig{}),
+	}
+
+	_, err := iaService.SearchBooks("books", "english", []string{"fiction"}, "5", 1)
+	assert.Error(t, err)
+
+	_, err = iaService.GetBookMetadata("book1")
+	assert.Error(t, err)
+
+	_, err = iaService.DownloadBook("book1", "book1.epub", "")
+	assert.Error(t, err)
+
+	// Test case: Each call is made once and then retried the number of times set for its kind
+	assert.Equal(t, map[string]int{
+		"/advancedsearch.php":        1 + int(internetArchiveSearchRetries),
+		"/metadata/book1":            1 + int(internetArchiveMetadataRetries),
+		"/download/book1/book1.epub": 1 + int(internetArchiveDownloadRetries),
+	}, requests)
+}
+
+func TestPerformRequestRetries(t *testing.T) {
+	originalRetryInitialInterval := retryInitialInterval
+	retryInitialInterval = time.Millisecond
+	defer func() { retryInitialInterval = originalRetryInitialInterval }()
+
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		requests++
+		if requests < 3 {
+			res.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		res.Write([]byte(`{"identifier":"book1"}`))
+	}))
+	t.Cleanup(server.Close)
+
+	// Test case: The request fails on every allowed attempt
+	_, err := PerformRequest[models.InternetArchiveMetadata](NewCircuitBreaker(CircuitBreakerConfig{}), http.MethodGet, server.URL, nil, nil, 1)
+
+	assert.EqualError(t, err, "request error")
+	assert.Equal(t, 2, requests)
+
+	// Test case: The request succeeds on a retry
+	metadata, err := PerformRequest[models.InternetArchiveMetadata](NewCircuitBreaker(CircuitBreakerConfig{}), http.MethodGet, server.URL, nil, nil, 1)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "book1", metadata.Identifier)
+	assert.Equal(t, 3, requests)
+}
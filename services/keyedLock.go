@@ -0,0 +1,51 @@
+package services
+
+import "sync"
+
+// Lock per key, so operations on the same key are serialized while the ones on different keys run concurrently.
+// The lock of a key is only kept while it is held or waited for, so the map does not grow with every key ever locked.
+// The locks live in the memory of the process, so they do not serialize operations run by other instances of the API.
+type keyedLock struct {
+	lock  sync.Mutex
+	locks map[uint]*keyLock
+}
+
+type keyLock struct {
+	lock sync.Mutex
+	// Number of callers holding or waiting for the lock.
+	users int
+}
+
+func newKeyedLock() *keyedLock {
+	return &keyedLock{locks: make(map[uint]*keyLock)}
+}
+
+// Locks the given key, waiting for any other holder of it to unlock it first.
+// Returns the function that unlocks it.
+func (keyed *keyedLock) Lock(key uint) func() {
+	keyed.lock.Lock()
+	lock, exists := keyed.locks[key]
+
+	if !exists {
+		lock = &keyLock{}
+		keyed.locks[key] = lock
+	}
+
+	lock.users++
+	keyed.lock.Unlock()
+
+	lock.lock.Lock()
+
+	return func() {
+		lock.lock.Unlock()
+
+		keyed.lock.Lock()
+		defer keyed.lock.Unlock()
+
+		lock.users--
+
+		if lock.users == 0 {
+			delete(keyed.locks, key)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/adfer-dev/analock-api/config"
+	"github.com/adfer-dev/analock-api/constants"
+	"github.com/adfer-dev/analock-api/jobs"
+	"github.com/adfer-dev/analock-api/storage"
+	"github.com/adfer-dev/analock-api/utils"
+)
+
+// Lock shared by every operation that creates activity registrations.
+// Writers hold it for reading, so they can run concurrently, while the sweeper needs it exclusively.
+var registrationWritesLock sync.RWMutex
+
+type OrphanRegistrationSweeper interface {
+	Sweep() (int64, error)
+}
+
+type OrphanRegistrationSweeperImpl struct {
+	activityRegistrationStorage storage.ActivityRegistrationStorageInterface
+}
+
+var _ OrphanRegistrationSweeper = (*OrphanRegistrationSweeperImpl)(nil)
+
+// Creates an orphan registration sweeper that deletes from the given storage.
+func NewOrphanRegistrationSweeperImpl(activityRegistrationStorage storage.ActivityRegistrationStorageInterface) *OrphanRegistrationSweeperImpl {
+	return &OrphanRegistrationSweeperImpl{activityRegistrationStorage: activityRegistrationStorage}
+}
+
+// Deletes the activity registrations that have no child row, returning how many were deleted.
+// It returns ErrSweepWritesInFlight instead of waiting if any registration is being written,
+// as a registration whose child row has not been inserted yet would be taken as an orphan.
+func (sweeper *OrphanRegistrationSweeperImpl) Sweep() (int64, error) {
+	if !registrationWritesLock.TryLock() {
+		return 0, ErrSweepWritesInFlight
+	}
+	defer registrationWritesLock.Unlock()
+
+	return sweeper.activityRegistrationStorage.DeleteOrphans()
+}
+
+// Checks whether the orphan registration sweeper is enabled.
+func IsOrphanRegistrationSweeperEnabled() bool {
+	return config.Get().OrphanSweeper.Enabled
+}
+
+// Gets the interval between scheduled sweeps from the config.
+func getOrphanSweepInterval() time.Duration {
+	return config.Get().OrphanSweeper.Interval
+}
+
+// Builds the job that runs the orphan registration sweeper periodically.
+func NewOrphanRegistrationSweepJob() jobs.Job {
+	sweeper := NewOrphanRegistrationSweeperImpl(&storage.ActivityRegistrationStorage{})
+
+	return jobs.Job{
+		Name:     constants.OrphanRegistrationSweepJobName,
+		Interval: getOrphanSweepInterval(),
+		Run: func(ctx context.Context) error {
+			deleted, sweepErr := sweeper.Sweep()
+
+			if sweepErr != nil {
+				return fmt.Errorf("error sweeping orphan activity registrations: %w", sweepErr)
+			}
+
+			utils.GetCustomLogger().Infof("Deleted %d orphan activity registrations\n", deleted)
+
+			return nil
+		},
+	}
+}
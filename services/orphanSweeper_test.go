@@ -0,0 +1,51 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/adfer-dev/analock-api/config"
+	"github.com/stretchr/testify/assert"
+)
+
+// Not run in parallel, as writes from other tests would hold the registration writes lock.
+func TestOrphanRegistrationSweep(t *testing.T) {
+	mockActivityStore := &mockActivityRegistrationStorage{OrphanCount: 3}
+
+	sweeper := NewOrphanRegistrationSweeperImpl(mockActivityStore)
+
+	// Test case: Sweep is skipped while registrations are being written
+	registrationWritesLock.RLock()
+	deleted, err := sweeper.Sweep()
+	registrationWritesLock.RUnlock()
+
+	assert.ErrorIs(t, err, ErrSweepWritesInFlight)
+	assert.Equal(t, int64(0), deleted)
+	assert.Equal(t, int64(3), mockActivityStore.OrphanCount)
+
+	// Test case: Orphans are deleted and counted
+	deleted, err = sweeper.Sweep()
+
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), deleted)
+
+	// Test case: Error from storage
+	mockActivityStore.DeleteErr = assert.AnError
+	_, err = sweeper.Sweep()
+	assert.ErrorIs(t, err, assert.AnError)
+
+	// Test case: Writes can run again after the sweep
+	assert.True(t, registrationWritesLock.TryRLock())
+	registrationWritesLock.RUnlock()
+}
+
+func TestGetOrphanSweepInterval(t *testing.T) {
+	t.Setenv("API_ORPHAN_SWEEPER_INTERVAL", "")
+	assert.Equal(t, config.DefaultOrphanSweepInterval, getOrphanSweepInterval())
+
+	t.Setenv("API_ORPHAN_SWEEPER_INTERVAL", "30m")
+	assert.Equal(t, 30*time.Minute, getOrphanSweepInterval())
+
+	t.Setenv("API_ORPHAN_SWEEPER_INTERVAL", "-1h")
+	assert.Equal(t, config.DefaultOrphanSweepInterval, getOrphanSweepInterval())
+}
@@ -0,0 +1,39 @@
+package services
+
+import (
+	"time"
+
+	"github.com/adfer-dev/analock-api/constants"
+	"github.com/adfer-dev/analock-api/models"
+	"github.com/adfer-dev/analock-api/storage"
+)
+
+// PlatformStatsService gets aggregate stats of the whole platform.
+type PlatformStatsService interface {
+	GetPlatformStats(newUsersDays int) (*models.PlatformStats, error)
+}
+
+type PlatformStatsServiceImpl struct {
+	platformStatsStorage storage.PlatformStatsStorageInterface
+}
+
+var _ PlatformStatsService = (*PlatformStatsServiceImpl)(nil)
+
+// Creates a platform stats service backed by the given storage.
+func NewPlatformStatsServiceImpl(platformStatsStorage storage.PlatformStatsStorageInterface) *PlatformStatsServiceImpl {
+	return &PlatformStatsServiceImpl{platformStatsStorage: platformStatsStorage}
+}
+
+// Gets the platform stats, counting as new the users created within the given number of days.
+func (platformStatsService *PlatformStatsServiceImpl) GetPlatformStats(newUsersDays int) (*models.PlatformStats, error) {
+	newUsersSince := time.Now().Unix() - int64(newUsersDays)*constants.DaySeconds
+	stats, statsErr := platformStatsService.platformStatsStorage.Get(newUsersSince)
+
+	if statsErr != nil {
+		return nil, statsErr
+	}
+
+	stats.NewUsersDays = newUsersDays
+
+	return stats, nil
+}
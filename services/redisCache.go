@@ -0,0 +1,280 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/adfer-dev/analock-api/config"
+	"github.com/adfer-dev/analock-api/constants"
+	"github.com/adfer-dev/analock-api/utils"
+	"github.com/redis/go-redis/v9"
+)
+
+// Amount of keys requested on each SCAN iteration when evicting user resources.
+const redisScanCount = 100
+
+// The cache is skipped after this many consecutive Redis failures, until the cooldown passes.
+// Without it, every request would wait for Redis to time out while it is down.
+const (
+	redisBreakerFailureThreshold = 3
+	redisBreakerFailureWindow    = time.Minute
+	redisBreakerCooldown         = 30 * time.Second
+)
+
+// Redis backed Cache Service. Redis failures are logged and handled as cache misses,
+// so while Redis is down the resources are got from their source.
+type redisCacheServiceImpl struct {
+	client      *redis.Client
+	expirations CacheExpirations
+	breaker     *CircuitBreaker
+}
+
+var _ CacheService = (*redisCacheServiceImpl)(nil)
+
+// Builds a new Redis backed Cache Service from the Redis URL in the config.
+func NewRedisCacheServiceFromConfig() *redisCacheServiceImpl {
+	options, parseErr := redis.ParseURL(config.Get().Cache.RedisUrl)
+
+	if parseErr != nil {
+		log.Fatalf(
+			"Error when parsing redis url from config: %s",
+			parseErr.Error(),
+		)
+	}
+
+	return NewRedisCacheService(redis.NewClient(options), getCacheExpirations())
+}
+
+// Builds a new Redis backed Cache Service, whose entries expire after the given times.
+func NewRedisCacheService(client *redis.Client, expirations CacheExpirations) *redisCacheServiceImpl {
+	breaker := NewCircuitBreaker(CircuitBreakerConfig{
+		FailureThreshold: redisBreakerFailureThreshold,
+		FailureWindow:    redisBreakerFailureWindow,
+		Cooldown:         redisBreakerCooldown,
+	})
+
+	return &redisCacheServiceImpl{client: client, expirations: expirations, breaker: breaker}
+}
+
+// Caches the result of the given function or returns the already cached value if exists.
+// When caching the resource, builds a key based on the concatenation of resource + key.
+// Cached values are returned as JSON; use CachedValueAs to read them as a concrete type.
+// If bypass is set, the cached value is not read, but it is still replaced by the function result.
+func (cs *redisCacheServiceImpl) CacheResource(f func() (interface{}, error), resource constants.CacheResource, key string, bypass bool) (interface{}, error) {
+	ctx := context.Background()
+	fullKey := buildRedisCacheKey(fmt.Sprintf("%s-%s", resource, key))
+
+	if !bypass {
+		if cached, hit := cs.get(ctx, fullKey); hit {
+			log.Printf("CACHE HIT: key: %s\n", fullKey)
+			return json.RawMessage(cached), nil
+		}
+	}
+
+	fnRes, fnErr := f()
+
+	if fnErr == nil {
+		cs.put(ctx, fullKey, fnRes, cs.expirations.ForResource(resource))
+	}
+
+	return fnRes, fnErr
+}
+
+// Caches the result of the given function or returns the already cached value if exists, like CacheResource.
+// While the stale retention is positive, a copy of the cached value outlives it by that time under a stale key.
+// If the function fails, that copy is returned instead, reporting the value is stale. Otherwise, the function error is returned.
+// If bypass is set, the fresh cached value is not read, but it is still replaced by the function result.
+func (cs *redisCacheServiceImpl) CacheResourceOrStale(f func() (interface{}, error), resource constants.CacheResource, key string, bypass bool) (interface{}, bool, error) {
+	ctx := context.Background()
+	resourceKey := fmt.Sprintf("%s-%s", resource, key)
+	fullKey := buildRedisCacheKey(resourceKey)
+	staleKey := buildRedisStaleCacheKey(resourceKey)
+
+	if !bypass {
+		if cached, hit := cs.get(ctx, fullKey); hit {
+			log.Printf("CACHE HIT: key: %s\n", fullKey)
+			return json.RawMessage(cached), false, nil
+		}
+	}
+
+	fnRes, fnErr := f()
+
+	if fnErr == nil {
+		expiration := cs.expirations.ForResource(resource)
+		cs.put(ctx, fullKey, fnRes, expiration)
+
+		if cs.expirations.StaleRetention > 0 {
+			cs.put(ctx, staleKey, fnRes, expiration+cs.expirations.StaleRetention)
+		}
+
+		return fnRes, false, nil
+	}
+
+	if cs.expirations.StaleRetention > 0 {
+		if stale, hit := cs.get(ctx, staleKey); hit {
+			log.Printf("CACHE STALE HIT: key: %s\n", staleKey)
+			return json.RawMessage(stale), true, nil
+		}
+	}
+
+	return fnRes, false, fnErr
+}
+
+// Evicts all the cache entries whose keys starts with a concatenation of the given resource and user.
+func (cs *redisCacheServiceImpl) EvictUserResource(resource constants.CacheResource, userId uint) error {
+	return cs.EvictUserResources([]constants.CacheResource{resource}, userId)
+}
+
+// Evicts the cache entries of the given user for all the given resources, scanning the keys once.
+// As Redis can only match glob patterns, the scanned keys are also checked against the same regex the in-memory cache uses.
+// Redis is not called while the breaker is open, returning ErrUpstreamUnavailable.
+func (cs *redisCacheServiceImpl) EvictUserResources(resources []constants.CacheResource, userId uint) error {
+	regex, regexErr := buildUserResourcesRegex(resources, userId)
+
+	if regexErr != nil {
+		return regexErr
+	}
+
+	if allowErr := cs.breaker.Allow(); allowErr != nil {
+		return allowErr
+	}
+
+	ctx := context.Background()
+	resourcePattern := "*"
+
+	if len(resources) == 1 {
+		resourcePattern = string(resources[0])
+	}
+
+	pattern := buildRedisCacheKey(fmt.Sprintf("%s-%s*", resourcePattern, utils.BuildUserCacheKey(userId)))
+	iterator := cs.client.Scan(ctx, 0, pattern, redisScanCount).Iterator()
+	matchingKeys := []string{}
+
+	for iterator.Next(ctx) {
+		if regex.MatchString(iterator.Val()[len(constants.RedisCacheKeyPrefix):]) {
+			matchingKeys = append(matchingKeys, iterator.Val())
+		}
+	}
+
+	if scanErr := iterator.Err(); scanErr != nil {
+		cs.breaker.RecordFailure()
+		utils.GetCustomLogger().Errorf(
+			"Redis error on cache evict: %s",
+			scanErr.Error(),
+		)
+		return scanErr
+	}
+
+	log.Printf("DELETE FROM CACHE: pattern: %s\n", pattern)
+
+	if len(matchingKeys) == 0 {
+		cs.breaker.RecordSuccess()
+		return nil
+	}
+
+	if delErr := cs.client.Del(ctx, matchingKeys...).Err(); delErr != nil {
+		cs.breaker.RecordFailure()
+		utils.GetCustomLogger().Errorf(
+			"Redis error on cache evict: %s",
+			delErr.Error(),
+		)
+		return delErr
+	}
+
+	cs.breaker.RecordSuccess()
+
+	return nil
+}
+
+// Evicts the cache entry holding the key that results from the concatenation of resource + key params, along with its stale copy.
+// Redis is not called while the breaker is open.
+func (cs *redisCacheServiceImpl) EvictResourceItem(resource constants.CacheResource, key string) {
+	resourceKey := fmt.Sprintf("%s-%s", resource, key)
+	fullKey := buildRedisCacheKey(resourceKey)
+
+	if cs.breaker.Allow() != nil {
+		return
+	}
+
+	log.Printf("DELETE FROM CACHE: key: %s\n", fullKey)
+
+	if delErr := cs.client.Del(context.Background(), fullKey, buildRedisStaleCacheKey(resourceKey)).Err(); delErr != nil {
+		cs.breaker.RecordFailure()
+		utils.GetCustomLogger().Errorf(
+			"Redis error on cache delete: %s",
+			delErr.Error(),
+		)
+		return
+	}
+
+	cs.breaker.RecordSuccess()
+}
+
+// Gets the value stored under the given key, reporting whether it was found.
+// Redis errors are logged and reported as misses, and Redis is not called while the breaker is open.
+func (cs *redisCacheServiceImpl) get(ctx context.Context, key string) ([]byte, bool) {
+	if cs.breaker.Allow() != nil {
+		return nil, false
+	}
+
+	cached, getErr := cs.client.Get(ctx, key).Bytes()
+
+	if getErr != nil && !errors.Is(getErr, redis.Nil) {
+		cs.breaker.RecordFailure()
+		utils.GetCustomLogger().Errorf(
+			"Redis error on cache get: %s",
+			getErr.Error(),
+		)
+		return nil, false
+	}
+
+	cs.breaker.RecordSuccess()
+
+	return cached, getErr == nil
+}
+
+// Stores the JSON encoding of the given value, which expires after the given time.
+// Failing to cache it is only logged, as the value can still be served.
+func (cs *redisCacheServiceImpl) put(ctx context.Context, key string, value interface{}, expiration time.Duration) {
+	encoded, encodeErr := json.Marshal(value)
+
+	if encodeErr != nil {
+		utils.GetCustomLogger().Errorf(
+			"Could not encode cache entry %s: %s",
+			key,
+			encodeErr.Error(),
+		)
+		return
+	}
+
+	if cs.breaker.Allow() != nil {
+		return
+	}
+
+	log.Printf("CACHE PUT: key: %s\n", key)
+
+	if setErr := cs.client.Set(ctx, key, encoded, expiration).Err(); setErr != nil {
+		cs.breaker.RecordFailure()
+		utils.GetCustomLogger().Errorf(
+			"Redis error on cache put: %s",
+			setErr.Error(),
+		)
+		return
+	}
+
+	cs.breaker.RecordSuccess()
+}
+
+// Namespaces the given cache key, so the Redis instance can be shared.
+func buildRedisCacheKey(key string) string {
+	return constants.RedisCacheKeyPrefix + key
+}
+
+// Namespaces the stale copy of the given cache key, apart from the keys evicted by user.
+func buildRedisStaleCacheKey(key string) string {
+	return constants.RedisStaleCacheKeyPrefix + key
+}
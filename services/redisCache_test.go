@@ -0,0 +1,312 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/adfer-dev/analock-api/constants"
+	"github.com/adfer-dev/analock-api/models"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestRedisCacheService(t *testing.T) (*redisCacheServiceImpl, *miniredis.Miniredis) {
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { client.Close() })
+
+	return NewRedisCacheService(client, CacheExpirations{Default: 5 * time.Minute}), server
+}
+
+func TestRedisCacheResource(t *testing.T) {
+	t.Parallel()
+	cacheService, server := newTestRedisCacheService(t)
+	calls := 0
+	diaryEntry := &models.DiaryEntry{
+		Id:      1,
+		Title:   "title",
+		Content: "content",
+		Registration: models.ActivityRegistration{
+			Id:               1,
+			RegistrationDate: 123,
+			UserRefer:        1,
+		},
+	}
+	getDiaryEntry := func() (interface{}, error) {
+		calls++
+		return diaryEntry, nil
+	}
+
+	missed, missErr := cacheService.CacheResource(getDiaryEntry, constants.DiaryEntriesCacheResource, "user-1", false)
+	assert.NoError(t, missErr)
+	assert.Same(t, diaryEntry, missed)
+	assert.True(t, server.Exists(constants.RedisCacheKeyPrefix+string(constants.DiaryEntriesCacheResource)+"-user-1"))
+	assert.Equal(t, 5*time.Minute, server.TTL(constants.RedisCacheKeyPrefix+string(constants.DiaryEntriesCacheResource)+"-user-1"))
+
+	hit, hitErr := cacheService.CacheResource(getDiaryEntry, constants.DiaryEntriesCacheResource, "user-1", false)
+	assert.NoError(t, hitErr)
+	assert.Equal(t, 1, calls)
+
+	cachedDiaryEntry, decodeErr := CachedValueAs[*models.DiaryEntry](hit)
+	assert.NoError(t, decodeErr)
+	assert.Equal(t, diaryEntry, cachedDiaryEntry)
+}
+
+func TestRedisCacheResourceBypass(t *testing.T) {
+	t.Parallel()
+	cacheService, _ := newTestRedisCacheService(t)
+	calls := 0
+	getValue := func() (interface{}, error) {
+		calls++
+		return calls, nil
+	}
+
+	cacheService.CacheResource(getValue, constants.DiaryEntriesCacheResource, "user-1", false)
+
+	bypassed, bypassErr := cacheService.CacheResource(getValue, constants.DiaryEntriesCacheResource, "user-1", true)
+	assert.NoError(t, bypassErr)
+	assert.Equal(t, 2, bypassed)
+
+	cached, cachedErr := cacheService.CacheResource(getValue, constants.DiaryEntriesCacheResource, "user-1", false)
+	assert.NoError(t, cachedErr)
+	assert.Equal(t, 2, calls)
+
+	cachedValue, decodeErr := CachedValueAs[int](cached)
+	assert.NoError(t, decodeErr)
+	assert.Equal(t, 2, cachedValue)
+
+	bypassedStale, stale, staleErr := cacheService.CacheResourceOrStale(getValue, constants.InternetArchiveBookSearchCacheResource, "query", true)
+	assert.NoError(t, staleErr)
+	assert.False(t, stale)
+	assert.Equal(t, 3, bypassedStale)
+}
+
+func TestRedisCacheResourceExpires(t *testing.T) {
+	t.Parallel()
+	cacheService, server := newTestRedisCacheService(t)
+	calls := 0
+	getValue := func() (interface{}, error) {
+		calls++
+		return "value", nil
+	}
+
+	cacheService.CacheResource(getValue, constants.DiaryEntriesCacheResource, "user-1", false)
+	server.FastForward(6 * time.Minute)
+	cacheService.CacheResource(getValue, constants.DiaryEntriesCacheResource, "user-1", false)
+
+	assert.Equal(t, 2, calls)
+}
+
+func TestRedisCacheResourceOrStale(t *testing.T) {
+	t.Parallel()
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { client.Close() })
+	cacheService := NewRedisCacheService(client, CacheExpirations{Default: 5 * time.Minute, StaleRetention: time.Hour})
+	staleKey := constants.RedisStaleCacheKeyPrefix + string(constants.InternetArchiveBookSearchCacheResource) + "-query"
+	failingValue := func() (interface{}, error) { return nil, errors.New("upstream failed") }
+
+	cacheService.CacheResourceOrStale(func() (interface{}, error) { return "value", nil }, constants.InternetArchiveBookSearchCacheResource, "query", false)
+	assert.Equal(t, 65*time.Minute, server.TTL(staleKey))
+
+	server.FastForward(6 * time.Minute)
+	value, stale, err := cacheService.CacheResourceOrStale(failingValue, constants.InternetArchiveBookSearchCacheResource, "query", false)
+
+	assert.NoError(t, err)
+	assert.True(t, stale)
+	staleValue, decodeErr := CachedValueAs[string](value)
+	assert.NoError(t, decodeErr)
+	assert.Equal(t, "value", staleValue)
+
+	server.FastForward(time.Hour)
+	_, stale, err = cacheService.CacheResourceOrStale(failingValue, constants.InternetArchiveBookSearchCacheResource, "query", false)
+
+	assert.Error(t, err)
+	assert.False(t, stale)
+}
+
+func TestRedisCacheResourceOrStaleWithoutRetention(t *testing.T) {
+	t.Parallel()
+	cacheService, server := newTestRedisCacheService(t)
+
+	cacheService.CacheResourceOrStale(func() (interface{}, error) { return "value", nil }, constants.InternetArchiveBookSearchCacheResource, "query", false)
+	server.FastForward(6 * time.Minute)
+	_, stale, err := cacheService.CacheResourceOrStale(
+		func() (interface{}, error) { return nil, errors.New("upstream failed") },
+		constants.InternetArchiveBookSearchCacheResource,
+		"query",
+		false,
+	)
+
+	assert.Error(t, err)
+	assert.False(t, stale)
+	assert.False(t, server.Exists(constants.RedisStaleCacheKeyPrefix+string(constants.InternetArchiveBookSearchCacheResource)+"-query"))
+}
+
+func TestRedisEvictResourceItem(t *testing.T) {
+	t.Parallel()
+	cacheService, server := newTestRedisCacheService(t)
+
+	cacheService.CacheResource(func() (interface{}, error) { return "value", nil }, constants.DiaryEntriesCacheResource, "user-1", false)
+	cacheService.EvictResourceItem(constants.DiaryEntriesCacheResource, "user-1")
+
+	assert.False(t, server.Exists(constants.RedisCacheKeyPrefix+string(constants.DiaryEntriesCacheResource)+"-user-1"))
+}
+
+func TestRedisEvictUserResource(t *testing.T) {
+	t.Parallel()
+	cacheService, server := newTestRedisCacheService(t)
+	getValue := func() (interface{}, error) { return "value", nil }
+
+	cacheService.CacheResource(getValue, constants.DiaryEntriesCacheResource, "user-1", false)
+	cacheService.CacheResource(getValue, constants.DiaryEntriesCacheResource, "user-1-start-1-end-2", false)
+	cacheService.CacheResource(getValue, constants.DiaryEntriesCacheResource, "user-2", false)
+	cacheService.CacheResource(getValue, constants.DiaryEntriesCacheResource, "user-12", false)
+	cacheService.CacheResource(getValue, constants.BookActivityRegistrationsCacheResource, "user-1", false)
+
+	assert.NoError(t, cacheService.EvictUserResource(constants.DiaryEntriesCacheResource, 1))
+
+	assert.False(t, server.Exists(constants.RedisCacheKeyPrefix+string(constants.DiaryEntriesCacheResource)+"-user-1"))
+	assert.False(t, server.Exists(constants.RedisCacheKeyPrefix+string(constants.DiaryEntriesCacheResource)+"-user-1-start-1-end-2"))
+	assert.True(t, server.Exists(constants.RedisCacheKeyPrefix+string(constants.DiaryEntriesCacheResource)+"-user-2"))
+	assert.True(t, server.Exists(constants.RedisCacheKeyPrefix+string(constants.DiaryEntriesCacheResource)+"-user-12"))
+	assert.True(t, server.Exists(constants.RedisCacheKeyPrefix+string(constants.BookActivityRegistrationsCacheResource)+"-user-1"))
+}
+
+func TestRedisEvictUserResources(t *testing.T) {
+	t.Parallel()
+	cacheService, server := newTestRedisCacheService(t)
+	getValue := func() (interface{}, error) { return "value", nil }
+
+	cacheService.CacheResource(getValue, constants.DiaryEntriesCacheResource, "user-1-summary", false)
+	cacheService.CacheResource(getValue, constants.BookActivityRegistrationsCacheResource, "user-1", false)
+	cacheService.CacheResource(getValue, constants.GameActivityRegistrationsCacheResource, "user-1", false)
+	cacheService.CacheResource(getValue, constants.BookActivityRegistrationsCacheResource, "user-12", false)
+
+	assert.NoError(t, cacheService.EvictUserResources([]constants.CacheResource{constants.DiaryEntriesCacheResource, constants.BookActivityRegistrationsCacheResource}, 1))
+
+	assert.False(t, server.Exists(constants.RedisCacheKeyPrefix+string(constants.DiaryEntriesCacheResource)+"-user-1-summary"))
+	assert.False(t, server.Exists(constants.RedisCacheKeyPrefix+string(constants.BookActivityRegistrationsCacheResource)+"-user-1"))
+	assert.True(t, server.Exists(constants.RedisCacheKeyPrefix+string(constants.GameActivityRegistrationsCacheResource)+"-user-1"))
+	assert.True(t, server.Exists(constants.RedisCacheKeyPrefix+string(constants.BookActivityRegistrationsCacheResource)+"-user-12"))
+}
+
+func TestRedisCacheResourceFallsBackWhenUnavailable(t *testing.T) {
+	t.Parallel()
+	cacheService, server := newTestRedisCacheService(t)
+	server.Close()
+
+	value, err := cacheService.CacheResource(func() (interface{}, error) { return "value", nil }, constants.DiaryEntriesCacheResource, "user-1", false)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "value", value)
+}
+
+func TestRedisCacheResourceOrStaleFallsBackWhenUnavailable(t *testing.T) {
+	t.Parallel()
+	cacheService, server := newTestRedisCacheService(t)
+	server.Close()
+
+	value, stale, err := cacheService.CacheResourceOrStale(func() (interface{}, error) { return "value", nil }, constants.InternetArchiveBookSearchCacheResource, "query", false)
+
+	assert.NoError(t, err)
+	assert.False(t, stale)
+	assert.Equal(t, "value", value)
+}
+
+func TestRedisCacheSkippedWhileUnavailable(t *testing.T) {
+	t.Parallel()
+	cacheService, server := newTestRedisCacheService(t)
+	getValue := func() (interface{}, error) { return "value", nil }
+	server.Close()
+
+	for i := 0; i < redisBreakerFailureThreshold; i++ {
+		value, err := cacheService.CacheResource(getValue, constants.DiaryEntriesCacheResource, "user-1", false)
+
+		assert.NoError(t, err)
+		assert.Equal(t, "value", value)
+	}
+
+	assert.ErrorIs(t, cacheService.breaker.Allow(), ErrUpstreamUnavailable)
+
+	// Test case: Redis is not called until the cooldown passes, even if it is back
+	assert.NoError(t, server.Restart())
+
+	value, err := cacheService.CacheResource(getValue, constants.DiaryEntriesCacheResource, "user-1", false)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "value", value)
+	assert.False(t, server.Exists(constants.RedisCacheKeyPrefix+string(constants.DiaryEntriesCacheResource)+"-user-1"))
+}
+
+func TestRedisEvictionSkippedWhileUnavailable(t *testing.T) {
+	t.Parallel()
+	cacheService, server := newTestRedisCacheService(t)
+	server.Close()
+
+	// Evicts the cache entries a diary entry write evicts
+	evictOnWrite := func() error {
+		cacheService.EvictResourceItem(constants.DiaryEntriesCacheResource, "user-1-summary")
+		return cacheService.EvictUserResource(constants.DiaryEntriesCacheResource, 1)
+	}
+
+	for i := 0; i < redisBreakerFailureThreshold; i++ {
+		assert.Error(t, cacheService.EvictUserResource(constants.DiaryEntriesCacheResource, 1))
+	}
+
+	// Test case: Failed evictions open the breaker on their own
+	assert.ErrorIs(t, cacheService.breaker.Allow(), ErrUpstreamUnavailable)
+
+	// Test case: Later writes do not wait for Redis while the breaker is open
+	start := time.Now()
+
+	for i := 0; i < 10; i++ {
+		assert.ErrorIs(t, evictOnWrite(), ErrUpstreamUnavailable)
+	}
+
+	assert.Less(t, time.Since(start), 50*time.Millisecond)
+}
+
+func TestCachedValueAsBookMetadata(t *testing.T) {
+	t.Parallel()
+	cacheService, _ := newTestRedisCacheService(t)
+	metadata := &models.InternetArchiveMetadataResponse{
+		Metadata: models.InternetArchiveMetadata{Subject: models.InternetArchiveSubjects{"fiction", "poetry"}},
+	}
+	getMetadata := func() (interface{}, error) { return metadata, nil }
+
+	cacheService.CacheResource(getMetadata, constants.InternetArchiveBookMetadataCacheResource, "book-1", false)
+	hit, _ := cacheService.CacheResource(getMetadata, constants.InternetArchiveBookMetadataCacheResource, "book-1", false)
+
+	cachedMetadata, err := CachedValueAs[*models.InternetArchiveMetadataResponse](hit)
+
+	assert.NoError(t, err)
+	assert.Equal(t, metadata.Metadata.Subject, cachedMetadata.Metadata.Subject)
+}
+
+func TestCachedValueAsWrongType(t *testing.T) {
+	t.Parallel()
+	_, err := CachedValueAs[*models.DiaryEntry]("value")
+
+	assert.Error(t, err)
+}
+
+func TestRedisCacheResourceExpirations(t *testing.T) {
+	t.Parallel()
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { client.Close() })
+	cacheService := NewRedisCacheService(client, CacheExpirations{
+		Default:   5 * time.Minute,
+		Resources: map[constants.CacheResource]time.Duration{constants.InternetArchiveBookMetadataCacheResource: 6 * time.Hour},
+	})
+	getValue := func() (interface{}, error) { return "value", nil }
+
+	cacheService.CacheResource(getValue, constants.DiaryEntriesCacheResource, "user-1", false)
+	cacheService.CacheResource(getValue, constants.InternetArchiveBookMetadataCacheResource, "book-1", false)
+
+	assert.Equal(t, 5*time.Minute, server.TTL(constants.RedisCacheKeyPrefix+string(constants.DiaryEntriesCacheResource)+"-user-1"))
+	assert.Equal(t, 6*time.Hour, server.TTL(constants.RedisCacheKeyPrefix+string(constants.InternetArchiveBookMetadataCacheResource)+"-book-1"))
+}
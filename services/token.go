@@ -1,6 +1,10 @@
 package services
 
 import (
+	"time"
+
+	"github.com/adfer-dev/analock-api/config"
+	"github.com/adfer-dev/analock-api/constants"
 	"github.com/adfer-dev/analock-api/models"
 	"github.com/adfer-dev/analock-api/storage"
 )
@@ -11,8 +15,6 @@ type TokenBody struct {
 	Kind       models.TokenKind `json:"kind" validate:"required,number"`
 }
 
-var tokenStorage storage.TokenStorageInterface = &storage.TokenStorage{}
-
 // TokenService defines all operations for the token service.
 type TokenService interface {
 	GetTokenById(id uint) (*models.Token, error)
@@ -21,19 +23,29 @@ type TokenService interface {
 	GetUserTokenPair(userId uint) ([2]*models.Token, error)
 	SaveToken(tokenBody *models.Token) (*models.Token, error)
 	UpdateToken(tokenBody *models.Token) (*models.Token, error)
+	UpdateTokenPair(tokenPair [2]*models.Token) ([2]*models.Token, error)
+	UpdateTokenLastUsedAt(id uint, lastUsedAt int64) error
 	DeleteToken(id uint) error
+	DeleteTokenWithGracePeriod(id uint) error
+	IsTokenInGracePeriod(tokenValue string) bool
+	RenewToken(token *models.Token, newTokenValue string) (bool, error)
+	IsTokenInRenewalOverlap(tokenValue string) bool
 }
 
 // TokenServiceImpl is the concrete implementation of TokenService.
-type TokenServiceImpl struct{}
+type TokenServiceImpl struct {
+	tokenStorage storage.TokenStorageInterface
+}
 
-// NewTokenServiceImpl creates a new DefaultTokenService.
-func NewTokenServiceImpl() *TokenServiceImpl {
-	return &TokenServiceImpl{}
+var _ TokenService = (*TokenServiceImpl)(nil)
+
+// NewTokenServiceImpl creates a new TokenServiceImpl backed by the given storage.
+func NewTokenServiceImpl(tokenStorage storage.TokenStorageInterface) *TokenServiceImpl {
+	return &TokenServiceImpl{tokenStorage: tokenStorage}
 }
 
 func (tokenService *TokenServiceImpl) GetTokenById(id uint) (*models.Token, error) {
-	token, err := tokenStorage.Get(id)
+	token, err := tokenService.tokenStorage.Get(id)
 	if err != nil {
 		return nil, err
 	}
@@ -41,7 +53,7 @@ func (tokenService *TokenServiceImpl) GetTokenById(id uint) (*models.Token, erro
 }
 
 func (tokenService *TokenServiceImpl) GetTokenByValue(tokenValue string) (*models.Token, error) {
-	token, err := tokenStorage.GetByValue(tokenValue)
+	token, err := tokenService.tokenStorage.GetByValue(tokenValue)
 	if err != nil {
 		return nil, err
 	}
@@ -49,7 +61,7 @@ func (tokenService *TokenServiceImpl) GetTokenByValue(tokenValue string) (*model
 }
 
 func (tokenService *TokenServiceImpl) GetUserTokenByKind(userId uint, kind models.TokenKind) (*models.Token, error) {
-	token, err := tokenStorage.GetByUserAndKind(userId, kind)
+	token, err := tokenService.tokenStorage.GetByUserAndKind(userId, kind)
 	if err != nil {
 		return nil, err
 	}
@@ -57,7 +69,7 @@ func (tokenService *TokenServiceImpl) GetUserTokenByKind(userId uint, kind model
 }
 
 func (tokenService *TokenServiceImpl) GetUserTokenPair(userId uint) ([2]*models.Token, error) {
-	tokenPair, err := tokenStorage.GetByUserId(userId)
+	tokenPair, err := tokenService.tokenStorage.GetByUserId(userId)
 	if err != nil {
 		return [2]*models.Token{}, err
 	}
@@ -65,7 +77,7 @@ func (tokenService *TokenServiceImpl) GetUserTokenPair(userId uint) ([2]*models.
 }
 
 func (tokenService *TokenServiceImpl) SaveToken(tokenBody *models.Token) (*models.Token, error) {
-	err := tokenStorage.Create(tokenBody)
+	err := tokenService.tokenStorage.Create(tokenBody)
 	if err != nil {
 		return nil, err
 	}
@@ -73,13 +85,101 @@ func (tokenService *TokenServiceImpl) SaveToken(tokenBody *models.Token) (*model
 }
 
 func (tokenService *TokenServiceImpl) UpdateToken(tokenBody *models.Token) (*models.Token, error) {
-	err := tokenStorage.Update(tokenBody)
+	err := tokenService.tokenStorage.Update(tokenBody)
 	if err != nil {
 		return nil, err
 	}
 	return tokenBody, nil
 }
 
+// Updates both tokens of the pair, so that either both are updated or none is.
+func (tokenService *TokenServiceImpl) UpdateTokenPair(tokenPair [2]*models.Token) ([2]*models.Token, error) {
+	err := tokenService.tokenStorage.UpdateMany(tokenPair[:])
+	if err != nil {
+		return [2]*models.Token{}, err
+	}
+	return tokenPair, nil
+}
+
+func (tokenService *TokenServiceImpl) UpdateTokenLastUsedAt(id uint, lastUsedAt int64) error {
+	return tokenService.tokenStorage.UpdateLastUsedAt(id, lastUsedAt)
+}
+
+// Access tokens deleted within their grace period, shared by all the token services.
+var deletedAccessTokens = newDeletedTokenSet()
+
+// Deletes the token with the given id, which is rejected right away.
 func (tokenService *TokenServiceImpl) DeleteToken(id uint) error {
-	return tokenStorage.Delete(id)
+	return tokenService.tokenStorage.Delete(id)
+}
+
+// Deletes the token with the given id, as done on logout.
+// If API_DELETED_TOKEN_GRACE_PERIOD is set and it is an access token, it is kept in the grace period for that time,
+// so the requests the client still has in flight can read. Revocations must use DeleteToken instead.
+func (tokenService *TokenServiceImpl) DeleteTokenWithGracePeriod(id uint) error {
+	gracePeriod := config.Get().DeletedTokenGracePeriod
+	var deletedToken *models.Token
+
+	if gracePeriod > 0 {
+		// The grace period is best effort, so the token is deleted even if it cannot be read first
+		deletedToken, _ = tokenService.GetTokenById(id)
+	}
+
+	if deleteErr := tokenService.tokenStorage.Delete(id); deleteErr != nil {
+		return deleteErr
+	}
+
+	if deletedToken != nil && deletedToken.Kind == models.Access {
+		deletedAccessTokens.Add(deletedToken.TokenValue, time.Now().Add(gracePeriod))
+	}
+
+	return nil
+}
+
+// Checks whether the given token value is of an access token deleted within its grace period.
+func (tokenService *TokenServiceImpl) IsTokenInGracePeriod(tokenValue string) bool {
+	return deletedAccessTokens.Contains(tokenValue)
+}
+
+// Locks per user held while its access token is renewed, so concurrent requests renew it once.
+// They only serialize the renewals of this process, and the renewal overlap is also kept in its memory: requests sent
+// to other instances of the API with the old token are rejected, and renewals on different instances can still race.
+var accessTokenRenewalLocks = newKeyedLock()
+
+// Access tokens replaced by a renewal within the renewal overlap, shared by all the token services.
+var renewedAccessTokens = newDeletedTokenSet()
+
+// Replaces the value of the given stored token with the given one, unless another request already replaced it.
+// The replaced value is still accepted for constants.AccessTokenRenewalOverlap, so the requests sent with it
+// concurrently, before the client adopts the new one, do not fail. Returns whether the token was renewed.
+func (tokenService *TokenServiceImpl) RenewToken(token *models.Token, newTokenValue string) (bool, error) {
+	unlock := accessTokenRenewalLocks.Lock(token.UserRefer)
+	defer unlock()
+
+	storedToken, getErr := tokenService.GetTokenById(token.Id)
+
+	if getErr != nil {
+		return false, getErr
+	}
+
+	if storedToken.TokenValue != token.TokenValue {
+		return false, nil
+	}
+
+	renewedToken := *storedToken
+	renewedToken.TokenValue = newTokenValue
+	renewedToken.CreatedAt = time.Now().Unix()
+
+	if updateErr := tokenService.tokenStorage.Update(&renewedToken); updateErr != nil {
+		return false, updateErr
+	}
+
+	renewedAccessTokens.Add(token.TokenValue, time.Now().Add(constants.AccessTokenRenewalOverlap))
+
+	return true, nil
+}
+
+// Checks whether the given token value is of an access token replaced by a renewal within the renewal overlap.
+func (tokenService *TokenServiceImpl) IsTokenInRenewalOverlap(tokenValue string) bool {
+	return renewedAccessTokens.Contains(tokenValue)
 }
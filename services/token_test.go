@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"testing"
+	"time"
 
 	"github.com/adfer-dev/analock-api/models"
 	"github.com/stretchr/testify/assert"
@@ -115,6 +116,38 @@ func (m *mockTokenStorage) Update(data interface{}) error {
 	return nil
 }
 
+// Updates the given tokens only if all of them exist, as the transaction would.
+func (m *mockTokenStorage) UpdateMany(data interface{}) error {
+	if m.UpdateErr != nil {
+		return m.UpdateErr
+	}
+	tokens, ok := data.([]*models.Token)
+	if !ok {
+		return errors.New("update many: invalid type for Token")
+	}
+	for _, token := range tokens {
+		if _, exists := m.TokensById[token.Id]; !exists {
+			return errors.New("update many: token not found")
+		}
+	}
+	for _, token := range tokens {
+		m.Update(token)
+	}
+	return nil
+}
+
+func (m *mockTokenStorage) UpdateLastUsedAt(id uint, lastUsedAt int64) error {
+	if m.UpdateErr != nil {
+		return m.UpdateErr
+	}
+	token, exists := m.TokensById[id]
+	if !exists {
+		return errors.New("update last used at: token not found")
+	}
+	token.LastUsedAt = lastUsedAt
+	return nil
+}
+
 func (m *mockTokenStorage) Delete(id uint) error {
 	if m.DeleteErr != nil {
 		return m.DeleteErr
@@ -136,13 +169,11 @@ func getTokenStorageKey(userId uint, kind models.TokenKind) string {
 }
 
 // --- Test Cases ---
-var tokenService TokenService = &TokenServiceImpl{}
-
 func TestGetTokenById(t *testing.T) {
-	originalTS := tokenStorage
+	t.Parallel()
+
 	tokenStorageMock := newMockTokenStorage()
-	tokenStorage = tokenStorageMock
-	defer func() { tokenStorage = originalTS }()
+	tokenService := NewTokenServiceImpl(tokenStorageMock)
 
 	testToken := &models.Token{Id: 1, TokenValue: "abc", Kind: models.Access, UserRefer: 10}
 	tokenStorageMock.TokensById[testToken.Id] = testToken
@@ -161,10 +192,10 @@ func TestGetTokenById(t *testing.T) {
 }
 
 func TestGetTokenByValue(t *testing.T) {
-	originalTS := tokenStorage
+	t.Parallel()
+
 	tokenStorageMock := newMockTokenStorage()
-	tokenStorage = tokenStorageMock
-	defer func() { tokenStorage = originalTS }()
+	tokenService := NewTokenServiceImpl(tokenStorageMock)
 
 	testToken := &models.Token{Id: 1, TokenValue: "token123", Kind: models.Refresh, UserRefer: 11}
 	tokenStorageMock.TokensByValue[testToken.TokenValue] = testToken
@@ -183,10 +214,10 @@ func TestGetTokenByValue(t *testing.T) {
 }
 
 func TestGetUserTokenByKind(t *testing.T) {
-	originalTS := tokenStorage
+	t.Parallel()
+
 	tokenStorageMock := newMockTokenStorage()
-	tokenStorage = tokenStorageMock
-	defer func() { tokenStorage = originalTS }()
+	tokenService := NewTokenServiceImpl(tokenStorageMock)
 
 	userId := uint(15)
 	kind := models.Access
@@ -207,10 +238,10 @@ func TestGetUserTokenByKind(t *testing.T) {
 }
 
 func TestGetUserTokenPair(t *testing.T) {
-	originalTS := tokenStorage
+	t.Parallel()
+
 	tokenStorageMock := newMockTokenStorage()
-	tokenStorage = tokenStorageMock
-	defer func() { tokenStorage = originalTS }()
+	tokenService := NewTokenServiceImpl(tokenStorageMock)
 
 	userId := uint(20)
 	accessToken := &models.Token{Id: 10, TokenValue: "accessPair", Kind: models.Access, UserRefer: userId}
@@ -232,10 +263,10 @@ func TestGetUserTokenPair(t *testing.T) {
 }
 
 func TestSaveToken(t *testing.T) {
-	originalTS := tokenStorage
+	t.Parallel()
+
 	tokenStorageMock := newMockTokenStorage()
-	tokenStorage = tokenStorageMock
-	defer func() { tokenStorage = originalTS }()
+	tokenService := NewTokenServiceImpl(tokenStorageMock)
 
 	tokenToSave := &models.Token{TokenValue: "newtoken", Kind: models.Access, UserRefer: 25}
 
@@ -253,10 +284,10 @@ func TestSaveToken(t *testing.T) {
 }
 
 func TestUpdateToken(t *testing.T) {
-	originalTS := tokenStorage
+	t.Parallel()
+
 	tokenStorageMock := newMockTokenStorage()
-	tokenStorage = tokenStorageMock
-	defer func() { tokenStorage = originalTS }()
+	tokenService := NewTokenServiceImpl(tokenStorageMock)
 
 	initialToken := &models.Token{Id: 30, TokenValue: "initial", Kind: models.Refresh, UserRefer: 30}
 	tokenStorageMock.TokensById[initialToken.Id] = initialToken
@@ -276,11 +307,40 @@ func TestUpdateToken(t *testing.T) {
 	assert.EqualError(t, err, "forced Update error")
 }
 
+func TestUpdateTokenPair(t *testing.T) {
+	t.Parallel()
+
+	tokenStorageMock := newMockTokenStorage()
+	tokenService := NewTokenServiceImpl(tokenStorageMock)
+
+	accessToken := &models.Token{Id: 50, TokenValue: "access", Kind: models.Access, UserRefer: 50}
+	tokenStorageMock.TokensById[accessToken.Id] = accessToken
+
+	// Test case: The second token does not exist, so the first one is not updated either
+	tokenPair := [2]*models.Token{
+		{Id: 50, TokenValue: "new_access", Kind: models.Access, UserRefer: 50},
+		{Id: 51, TokenValue: "new_refresh", Kind: models.Refresh, UserRefer: 50},
+	}
+	_, err := tokenService.UpdateTokenPair(tokenPair)
+	assert.Error(t, err)
+	assert.Equal(t, "access", tokenStorageMock.TokensById[50].TokenValue)
+
+	refreshToken := &models.Token{Id: 51, TokenValue: "refresh", Kind: models.Refresh, UserRefer: 50}
+	tokenStorageMock.TokensById[refreshToken.Id] = refreshToken
+
+	// Test case: Both tokens are updated
+	updatedPair, err := tokenService.UpdateTokenPair(tokenPair)
+	assert.NoError(t, err)
+	assert.Equal(t, tokenPair, updatedPair)
+	assert.Equal(t, "new_access", tokenStorageMock.TokensById[50].TokenValue)
+	assert.Equal(t, "new_refresh", tokenStorageMock.TokensById[51].TokenValue)
+}
+
 func TestDeleteToken(t *testing.T) {
-	originalTS := tokenStorage
+	t.Parallel()
+
 	tokenStorageMock := newMockTokenStorage()
-	tokenStorage = tokenStorageMock
-	defer func() { tokenStorage = originalTS }()
+	tokenService := NewTokenServiceImpl(tokenStorageMock)
 
 	tokenToDelete := &models.Token{Id: 40, TokenValue: "deleteme", Kind: models.Access, UserRefer: 40}
 	tokenStorageMock.TokensById[tokenToDelete.Id] = tokenToDelete
@@ -303,3 +363,72 @@ func TestDeleteToken(t *testing.T) {
 	assert.Error(t, err)
 	assert.EqualError(t, err, "forced Delete error")
 }
+
+func TestDeleteTokenGracePeriod(t *testing.T) {
+	tokenStorageMock := newMockTokenStorage()
+	tokenService := NewTokenServiceImpl(tokenStorageMock)
+
+	addToken := func(token *models.Token) {
+		tokenStorageMock.TokensById[token.Id] = token
+		tokenStorageMock.TokensByValue[token.TokenValue] = token
+	}
+
+	// Test case: Deleted tokens are rejected right away when there is no grace period
+	t.Setenv("API_DELETED_TOKEN_GRACE_PERIOD", "0")
+	addToken(&models.Token{Id: 60, TokenValue: "no-grace-access", Kind: models.Access, UserRefer: 60})
+	assert.NoError(t, tokenService.DeleteTokenWithGracePeriod(60))
+	assert.False(t, tokenService.IsTokenInGracePeriod("no-grace-access"))
+
+	// Test case: Deleted access tokens are in the grace period, but not refresh tokens
+	t.Setenv("API_DELETED_TOKEN_GRACE_PERIOD", "50ms")
+	addToken(&models.Token{Id: 61, TokenValue: "grace-access", Kind: models.Access, UserRefer: 61})
+	addToken(&models.Token{Id: 62, TokenValue: "grace-refresh", Kind: models.Refresh, UserRefer: 61})
+	assert.NoError(t, tokenService.DeleteTokenWithGracePeriod(61))
+	assert.NoError(t, tokenService.DeleteTokenWithGracePeriod(62))
+	assert.True(t, tokenService.IsTokenInGracePeriod("grace-access"))
+	assert.False(t, tokenService.IsTokenInGracePeriod("grace-refresh"))
+	assert.False(t, tokenService.IsTokenInGracePeriod("never-deleted"))
+
+	// Test case: Tokens deleted without the grace period are rejected right away, even when it is set
+	addToken(&models.Token{Id: 64, TokenValue: "revoked-access", Kind: models.Access, UserRefer: 64})
+	assert.NoError(t, tokenService.DeleteToken(64))
+	assert.False(t, tokenService.IsTokenInGracePeriod("revoked-access"))
+
+	// Test case: Tokens that fail to be deleted are not in the grace period
+	addToken(&models.Token{Id: 63, TokenValue: "failed-access", Kind: models.Access, UserRefer: 63})
+	tokenStorageMock.DeleteErr = errors.New("forced Delete error")
+	assert.Error(t, tokenService.DeleteTokenWithGracePeriod(63))
+	assert.False(t, tokenService.IsTokenInGracePeriod("failed-access"))
+
+	// Test case: The grace period ends
+	assert.Eventually(t, func() bool { return !tokenService.IsTokenInGracePeriod("grace-access") }, time.Second, 10*time.Millisecond)
+}
+
+func TestRenewToken(t *testing.T) {
+	tokenStorageMock := newMockTokenStorage()
+	tokenService := NewTokenServiceImpl(tokenStorageMock)
+	token := &models.Token{Id: 80, TokenValue: "old-access", Kind: models.Access, UserRefer: 80, LastUsedAt: 5}
+	tokenStorageMock.TokensById[token.Id] = token
+	tokenStorageMock.TokensByValue[token.TokenValue] = token
+
+	// Test case: The stored token is replaced and the old value is accepted within the overlap
+	renewed, err := tokenService.RenewToken(token, "new-access")
+	assert.NoError(t, err)
+	assert.True(t, renewed)
+	assert.Equal(t, "new-access", tokenStorageMock.TokensById[80].TokenValue)
+	assert.Equal(t, int64(5), tokenStorageMock.TokensById[80].LastUsedAt)
+	assert.InDelta(t, time.Now().Unix(), tokenStorageMock.TokensById[80].CreatedAt, 5)
+	assert.True(t, tokenService.IsTokenInRenewalOverlap("old-access"))
+	assert.False(t, tokenService.IsTokenInRenewalOverlap("new-access"))
+
+	// Test case: A token already replaced by another request is not renewed again
+	renewed, err = tokenService.RenewToken(token, "newer-access")
+	assert.NoError(t, err)
+	assert.False(t, renewed)
+	assert.Equal(t, "new-access", tokenStorageMock.TokensById[80].TokenValue)
+
+	// Test case: Update errors are returned
+	tokenStorageMock.UpdateErr = errors.New("forced Update error")
+	_, err = tokenService.RenewToken(tokenStorageMock.TokensById[80], "newer-access")
+	assert.EqualError(t, err, "forced Update error")
+}
@@ -1,6 +1,8 @@
 package services
 
 import (
+	"time"
+
 	"github.com/adfer-dev/analock-api/models"
 	"github.com/adfer-dev/analock-api/storage"
 )
@@ -8,9 +10,26 @@ import (
 type UserBody struct {
 	Email    string `json:"email" validate:"required,email"`
 	UserName string `json:"username" validate:"required,alphanum"`
+	// Set by the API when the login provider asserts the email is verified, never read from requests.
+	EmailVerified bool `json:"-"`
 }
 
-var userStorage storage.UserStorageInterface = &storage.UserStorage{}
+// UserListQuery holds the criteria and page to list users by.
+type UserListQuery struct {
+	Role          models.UserRole
+	EmailContains string
+	SortBy        models.UserSortField
+	Page          int
+	PageSize      int
+}
+
+// UserPage is a page of listed users, along with the count of users matching the criteria.
+type UserPage struct {
+	Users    []*models.User `json:"users"`
+	Total    int64          `json:"total"`
+	Page     int            `json:"page"`
+	PageSize int            `json:"pageSize"`
+}
 
 // UserService defines all operations for the user service.
 type UserService interface {
@@ -18,14 +37,25 @@ type UserService interface {
 	GetUserByEmail(email string) (*models.User, error)
 	SaveUser(userBody UserBody) (*models.User, error)
 	UpdateUser(userBody UserBody) (*models.User, error)
+	MarkEmailVerified(id uint) error
 	DeleteUser(id uint) error
+	ListUsers(query UserListQuery) (*UserPage, error)
 }
 
 // UserServiceImpl is the concrete implementation of UserService.
-type UserServiceImpl struct{}
+type UserServiceImpl struct {
+	userStorage storage.UserStorageInterface
+}
+
+var _ UserService = (*UserServiceImpl)(nil)
+
+// NewUserServiceImpl creates a new UserServiceImpl backed by the given storage.
+func NewUserServiceImpl(userStorage storage.UserStorageInterface) *UserServiceImpl {
+	return &UserServiceImpl{userStorage: userStorage}
+}
 
 func (userService *UserServiceImpl) GetUserById(id uint) (*models.User, error) {
-	user, err := userStorage.Get(id)
+	user, err := userService.userStorage.Get(id)
 	if err != nil {
 		return nil, err
 	}
@@ -33,7 +63,7 @@ func (userService *UserServiceImpl) GetUserById(id uint) (*models.User, error) {
 }
 
 func (userService *UserServiceImpl) GetUserByEmail(email string) (*models.User, error) {
-	user, err := userStorage.GetByEmail(email)
+	user, err := userService.userStorage.GetByEmail(email)
 	if err != nil {
 		return nil, err
 	}
@@ -42,11 +72,13 @@ func (userService *UserServiceImpl) GetUserByEmail(email string) (*models.User,
 
 func (userService *UserServiceImpl) SaveUser(userBody UserBody) (*models.User, error) {
 	savedUser := &models.User{
-		Email:    userBody.Email,
-		UserName: userBody.UserName,
-		Role:     models.Standard,
+		Email:         userBody.Email,
+		UserName:      userBody.UserName,
+		Role:          models.Standard,
+		CreatedAt:     time.Now().Unix(),
+		EmailVerified: userBody.EmailVerified,
 	}
-	err := userStorage.Create(savedUser)
+	err := userService.userStorage.Create(savedUser)
 	if err != nil {
 		return nil, err
 	}
@@ -58,13 +90,48 @@ func (userService *UserServiceImpl) UpdateUser(userBody UserBody) (*models.User,
 	updatedUser.UserName = userBody.UserName
 	updatedUser.Email = userBody.Email
 	updatedUser.Role = models.Standard
-	err := userStorage.Update(updatedUser)
+	err := userService.userStorage.Update(updatedUser)
 	if err != nil {
 		return nil, err
 	}
 	return updatedUser, nil
 }
 
+// Marks the email of the user with the given id as verified.
+func (userService *UserServiceImpl) MarkEmailVerified(id uint) error {
+	return userService.userStorage.UpdateEmailVerified(id, true)
+}
+
 func (userService *UserServiceImpl) DeleteUser(id uint) error {
-	return userStorage.Delete(id)
+	return userService.userStorage.Delete(id)
+}
+
+// Lists the page of users matching the given criteria. Pages start at 1.
+func (userService *UserServiceImpl) ListUsers(query UserListQuery) (*UserPage, error) {
+	filter := &models.UserListFilter{
+		Role:          query.Role,
+		EmailContains: query.EmailContains,
+		SortBy:        query.SortBy,
+		Limit:         query.PageSize,
+		Offset:        (query.Page - 1) * query.PageSize,
+	}
+
+	users, listErr := userService.userStorage.List(filter)
+
+	if listErr != nil {
+		return nil, listErr
+	}
+
+	total, countErr := userService.userStorage.Count(filter)
+
+	if countErr != nil {
+		return nil, countErr
+	}
+
+	return &UserPage{
+		Users:    users.([]*models.User),
+		Total:    total,
+		Page:     query.Page,
+		PageSize: query.PageSize,
+	}, nil
 }
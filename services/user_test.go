@@ -6,6 +6,7 @@ import (
 	"testing"
 
 	"github.com/adfer-dev/analock-api/models"
+	"github.com/adfer-dev/analock-api/storage/memory"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -18,6 +19,8 @@ type userStorageMockUserStorage struct {
 	CreateErr     error
 	UpdateErr     error
 	DeleteErr     error
+	ListErr       error
+	CountErr      error
 	nextId        uint
 }
 
@@ -106,6 +109,18 @@ func (m *userStorageMockUserStorage) Update(data interface{}) error {
 	return fmt.Errorf("update: user with email %s not found to update", user.Email)
 }
 
+func (m *userStorageMockUserStorage) UpdateEmailVerified(id uint, emailVerified bool) error {
+	if m.UpdateErr != nil {
+		return m.UpdateErr
+	}
+	user, ok := m.UsersById[id]
+	if !ok {
+		return fmt.Errorf("user with id %d not found", id)
+	}
+	user.EmailVerified = emailVerified
+	return nil
+}
+
 func (m *userStorageMockUserStorage) Delete(id uint) error {
 	if m.DeleteErr != nil {
 		return m.DeleteErr
@@ -119,13 +134,29 @@ func (m *userStorageMockUserStorage) Delete(id uint) error {
 	return nil
 }
 
-var userService UserService = &UserServiceImpl{}
+func (m *userStorageMockUserStorage) List(filter *models.UserListFilter) (interface{}, error) {
+	if m.ListErr != nil {
+		return nil, m.ListErr
+	}
+	users := []*models.User{}
+	for _, user := range m.UsersById {
+		users = append(users, user)
+	}
+	return users, nil
+}
+
+func (m *userStorageMockUserStorage) Count(filter *models.UserListFilter) (int64, error) {
+	if m.CountErr != nil {
+		return 0, m.CountErr
+	}
+	return int64(len(m.UsersById)), nil
+}
 
 func TestGetUserById(t *testing.T) {
-	originalStorage := userStorage
+	t.Parallel()
+
 	userStorageMock := newuserStorageMockUserStorage()
-	userStorage = userStorageMock
-	defer func() { userStorage = originalStorage }()
+	userService := NewUserServiceImpl(userStorageMock)
 
 	testUser := &models.User{Id: 1, Email: "test@example.com", UserName: "testuser"}
 	userStorageMock.UsersById[testUser.Id] = testUser
@@ -145,10 +176,10 @@ func TestGetUserById(t *testing.T) {
 }
 
 func TestGetUserByEmail(t *testing.T) {
-	originalStorage := userStorage
+	t.Parallel()
+
 	userStorageMock := newuserStorageMockUserStorage()
-	userStorage = userStorageMock
-	defer func() { userStorage = originalStorage }()
+	userService := NewUserServiceImpl(userStorageMock)
 
 	testUser := &models.User{Id: 1, Email: "test@example.com", UserName: "testuser"}
 	userStorageMock.UsersByEmail[testUser.Email] = testUser
@@ -168,10 +199,10 @@ func TestGetUserByEmail(t *testing.T) {
 }
 
 func TestSaveUser(t *testing.T) {
-	originalStorage := userStorage
+	t.Parallel()
+
 	userStorageMock := newuserStorageMockUserStorage()
-	userStorage = userStorageMock
-	defer func() { userStorage = originalStorage }()
+	userService := NewUserServiceImpl(userStorageMock)
 
 	userBody := UserBody{Email: "new@example.com", UserName: "newuser"}
 
@@ -198,10 +229,10 @@ func TestSaveUser(t *testing.T) {
 }
 
 func TestUpdateUser(t *testing.T) {
-	originalStorage := userStorage
+	t.Parallel()
+
 	userStorageMock := newuserStorageMockUserStorage()
-	userStorage = userStorageMock
-	defer func() { userStorage = originalStorage }()
+	userService := NewUserServiceImpl(userStorageMock)
 
 	// Pre-populate a user
 	initialEmail := "update@example.com"
@@ -238,10 +269,10 @@ func TestUpdateUser(t *testing.T) {
 }
 
 func TestDeleteUser(t *testing.T) {
-	originalStorage := userStorage
+	t.Parallel()
+
 	userStorageMock := newuserStorageMockUserStorage()
-	userStorage = userStorageMock
-	defer func() { userStorage = originalStorage }()
+	userService := NewUserServiceImpl(userStorageMock)
 
 	userToDelete := &models.User{Id: 10, Email: "delete@example.com", UserName: "deleteuser"}
 	userStorageMock.UsersById[userToDelete.Id] = userToDelete
@@ -267,3 +298,60 @@ func TestDeleteUser(t *testing.T) {
 	assert.Error(t, err)
 	assert.EqualError(t, err, "forced Delete error")
 }
+
+func TestListUsers(t *testing.T) {
+	t.Parallel()
+
+	userService := NewUserServiceImpl(memory.NewUserStorage(memory.NewDatabase()))
+
+	for i, email := range []string{"carol@example.com", "alice@example.com", "bob@test.com", "dave@example.com"} {
+		user := &models.User{Email: email, UserName: fmt.Sprintf("user%d", i), Role: models.Standard, CreatedAt: int64(i)}
+
+		if email == "dave@example.com" {
+			user.Role = models.Admin
+		}
+
+		assert.NoError(t, userService.userStorage.Create(user))
+	}
+
+	page, err := userService.ListUsers(UserListQuery{SortBy: models.UserSortByEmail, Page: 1, PageSize: 2})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(4), page.Total)
+	assert.Equal(t, []string{"alice@example.com", "bob@test.com"}, userEmails(page.Users))
+
+	page, err = userService.ListUsers(UserListQuery{SortBy: models.UserSortByCreatedAt, Page: 2, PageSize: 3})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(4), page.Total)
+	assert.Equal(t, 2, page.Page)
+	assert.Equal(t, []string{"dave@example.com"}, userEmails(page.Users))
+
+	page, err = userService.ListUsers(UserListQuery{Role: models.Standard, EmailContains: "EXAMPLE", SortBy: models.UserSortByCreatedAt, Page: 1, PageSize: 10})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), page.Total)
+	assert.Equal(t, []string{"carol@example.com", "alice@example.com"}, userEmails(page.Users))
+}
+
+func TestListUsersStorageErrors(t *testing.T) {
+	t.Parallel()
+
+	userStorageMock := newuserStorageMockUserStorage()
+	userService := NewUserServiceImpl(userStorageMock)
+
+	userStorageMock.CountErr = errors.New("forced Count error")
+	_, err := userService.ListUsers(UserListQuery{Page: 1, PageSize: 10})
+	assert.EqualError(t, err, "forced Count error")
+
+	userStorageMock.ListErr = errors.New("forced List error")
+	_, err = userService.ListUsers(UserListQuery{Page: 1, PageSize: 10})
+	assert.EqualError(t, err, "forced List error")
+}
+
+func userEmails(users []*models.User) []string {
+	emails := make([]string, 0, len(users))
+
+	for _, user := range users {
+		emails = append(emails, user.Email)
+	}
+
+	return emails
+}
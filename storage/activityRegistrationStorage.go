@@ -2,27 +2,46 @@ package storage
 
 import (
 	"database/sql"
+	"fmt"
+	"time"
 
 	"github.com/adfer-dev/analock-api/database"
 	"github.com/adfer-dev/analock-api/models"
+	"github.com/adfer-dev/analock-api/utils"
 )
 
 const (
-	getActivityRegistrationByIdentifierQuery = "SELECT * FROM activity_registration WHERE id = ?;"
-	insertActivityRegistrationQuery          = "INSERT INTO activity_registration (registration_date, user_id) VALUES (?, ?);"
+	getActivityRegistrationByIdentifierQuery = "SELECT id, registration_date, user_id, COALESCE(platform, '') FROM activity_registration WHERE id = ?;"
+	insertActivityRegistrationQuery          = "INSERT INTO activity_registration (registration_date, user_id, platform) VALUES (?, ?, ?);"
 	updateActivityRegistrationQuery          = "UPDATE activity_registration SET registration_date = ? WHERE id = ?;"
 	deleteActivityRegistrationQuery          = "DELETE FROM activity_registration WHERE id = ?;"
+	userActivityFeedQuery                    = "SELECT 'book', arb.id, arb.internet_archive_id, '', ar.id AS registration_id, ar.registration_date AS registration_date, ar.user_id, COALESCE(ar.platform, '')" +
+		" FROM activity_registration_book arb INNER JOIN activity_registration ar ON (arb.registration_id = ar.id) WHERE ar.user_id = ? AND ? IN ('', 'book')" +
+		" UNION ALL" +
+		" SELECT 'game', arg.id, '', arg.game_name, ar.id, ar.registration_date, ar.user_id, COALESCE(ar.platform, '')" +
+		" FROM activity_registration_game arg INNER JOIN activity_registration ar ON (arg.registration_id = ar.id) WHERE ar.user_id = ? AND ? IN ('', 'game')"
+	getUserActivityFeedQuery               = userActivityFeedQuery + " ORDER BY registration_date %[1]s, registration_id %[1]s LIMIT ? OFFSET ?;"
+	countUserActivityFeedQuery             = "SELECT COUNT(*) FROM (" + userActivityFeedQuery + ");"
+	getUserActivityRegistrationDatesQuery  = "SELECT registration_date FROM activity_registration WHERE user_id = ? AND registration_date BETWEEN ? AND ?;"
+	deleteOrphanActivityRegistrationsQuery = "DELETE FROM activity_registration WHERE NOT EXISTS (SELECT 1 FROM diary_entry WHERE registration_id = activity_registration.id) AND NOT EXISTS (SELECT 1 FROM activity_registration_book WHERE registration_id = activity_registration.id) AND NOT EXISTS (SELECT 1 FROM activity_registration_game WHERE registration_id = activity_registration.id);"
 )
 
 type ActivityRegistrationStorageInterface interface {
 	Create(data interface{}) error
 	Update(data interface{}) error
 	Delete(id uint) error
+	DeleteOrphans() (int64, error)
+	GetFeed(filter *models.ActivityFeedFilter) (interface{}, error)
+	CountFeed(filter *models.ActivityFeedFilter) (int64, error)
+	CountByDay(userId uint, startTime int64, endTime int64, location *time.Location) (map[int64]int64, error)
 }
 
 type ActivityRegistrationStorage struct{}
 
+var _ ActivityRegistrationStorageInterface = (*ActivityRegistrationStorage)(nil)
+
 var activityRegistrationNotFoundError = &models.DbNotFoundError{DbItem: &models.ActivityRegistration{}}
+var activityRegistrationAlreadyExistsError = &models.DbItemAlreadyExistsError{DbItem: &models.ActivityRegistration{}}
 var failedToParseActivityRegistrationError = &models.DbCouldNotParseItemError{DbItem: &models.ActivityRegistration{}}
 
 func (activityRegistrationStorage *ActivityRegistrationStorage) Get(id uint) (interface{}, error) {
@@ -61,7 +80,12 @@ func (activityRegistrationStorage *ActivityRegistrationStorage) Create(activityR
 
 	result, err := database.GetDatabaseInstance().GetConnection().Exec(insertActivityRegistrationQuery,
 		dbActivityRegistration.RegistrationDate,
-		dbActivityRegistration.UserRefer)
+		dbActivityRegistration.UserRefer,
+		dbActivityRegistration.Platform)
+
+	if isUniqueConstraintError(err) {
+		return activityRegistrationAlreadyExistsError
+	}
 
 	if err != nil {
 		return err
@@ -126,10 +150,103 @@ func (activityRegistrationStorage *ActivityRegistrationStorage) Delete(id uint)
 	return nil
 }
 
+// Deletes the activity registrations that have no diary entry, book or game registration attached.
+// Returns the number of deleted registrations.
+func (activityRegistrationStorage *ActivityRegistrationStorage) DeleteOrphans() (int64, error) {
+	result, err := database.GetDatabaseInstance().GetConnection().Exec(deleteOrphanActivityRegistrationsQuery)
+
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
+
+// Lists the book and game registrations of a user together, sorted by registration date.
+func (activityRegistrationStorage *ActivityRegistrationStorage) GetFeed(filter *models.ActivityFeedFilter) (interface{}, error) {
+	direction := "ASC"
+
+	if filter.Descending {
+		direction = "DESC"
+	}
+
+	result, err := database.GetDatabaseInstance().GetConnection().Query(
+		fmt.Sprintf(getUserActivityFeedQuery, direction),
+		filter.UserId, string(filter.Type), filter.UserId, string(filter.Type), filter.Limit, filter.Offset,
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer result.Close()
+
+	feedItems := []*models.ActivityFeedItem{}
+
+	for result.Next() {
+		var feedItem models.ActivityFeedItem
+
+		scanErr := result.Scan(&feedItem.Type, &feedItem.Id, &feedItem.InternetArchiveIdentifier, &feedItem.GameName,
+			&feedItem.Registration.Id, &feedItem.Registration.RegistrationDate, &feedItem.Registration.UserRefer,
+			&feedItem.Registration.Platform)
+
+		if scanErr != nil {
+			return nil, scanErr
+		}
+
+		feedItems = append(feedItems, &feedItem)
+	}
+
+	return feedItems, result.Err()
+}
+
+// Counts the book and game registrations of a user matching the given filter, ignoring its limit and offset.
+func (activityRegistrationStorage *ActivityRegistrationStorage) CountFeed(filter *models.ActivityFeedFilter) (int64, error) {
+	var count int64
+
+	countErr := database.GetDatabaseInstance().GetConnection().
+		QueryRow(countUserActivityFeedQuery, filter.UserId, string(filter.Type), filter.UserId, string(filter.Type)).
+		Scan(&count)
+
+	return count, countErr
+}
+
+// Counts the activity registrations of a user within the given interval, by the start of the calendar day they belong to
+// in the given location, in Unix seconds.
+// The days are not grouped by the database, as it does not know the daylight saving changes of the location.
+func (activityRegistrationStorage *ActivityRegistrationStorage) CountByDay(userId uint, startTime int64, endTime int64, location *time.Location) (map[int64]int64, error) {
+	result, err := database.GetDatabaseInstance().GetConnection().Query(
+		getUserActivityRegistrationDatesQuery,
+		userId, startTime, endTime,
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer result.Close()
+
+	dayCounts := make(map[int64]int64)
+
+	for result.Next() {
+		var registrationDate int64
+
+		if scanErr := result.Scan(&registrationDate); scanErr != nil {
+			return nil, scanErr
+		}
+
+		dayStart, _ := utils.LocationDayBounds(registrationDate, location)
+		dayCounts[dayStart]++
+	}
+
+	return dayCounts, result.Err()
+}
+
 func (activityRegistrationStorage *ActivityRegistrationStorage) Scan(rows *sql.Rows) (interface{}, error) {
 	var activityRegistration models.ActivityRegistration
 
-	scanErr := rows.Scan(&activityRegistration.Id, &activityRegistration.RegistrationDate, &activityRegistration.UserRefer)
+	scanErr := rows.Scan(&activityRegistration.Id, &activityRegistration.RegistrationDate, &activityRegistration.UserRefer,
+		&activityRegistration.Platform)
 
 	return activityRegistration, scanErr
 }
@@ -0,0 +1,243 @@
+package storage
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/adfer-dev/analock-api/constants"
+	"github.com/adfer-dev/analock-api/database"
+	"github.com/adfer-dev/analock-api/models"
+	"github.com/stretchr/testify/assert"
+)
+
+// Points the database instance at a local database file, shared by all the tests of the package.
+func TestMain(m *testing.M) {
+	databaseDir, dirErr := os.MkdirTemp("", "analock-storage")
+
+	if dirErr != nil {
+		panic(dirErr)
+	}
+
+	os.Setenv("TURSO_DB_URL", "file:"+databaseDir+"/test.db")
+	os.Setenv("API_DB_CONNECTION_RETRIES", "0")
+
+	code := m.Run()
+
+	os.RemoveAll(databaseDir)
+	os.Exit(code)
+}
+
+func TestActivityRegistrationStorageFeed(t *testing.T) {
+	userStorage := &UserStorage{}
+	activityRegistrationStorage := &ActivityRegistrationStorage{}
+	bookRegistrationStorage := &BookActivityRegistrationStorage{}
+	gameRegistrationStorage := &GameActivityRegistrationStorage{}
+
+	user := &models.User{Email: "feed@example.com", UserName: "feed", Role: models.Standard}
+	otherUser := &models.User{Email: "other@example.com", UserName: "other", Role: models.Standard}
+	assert.NoError(t, userStorage.Create(user))
+	assert.NoError(t, userStorage.Create(otherUser))
+
+	for _, registrationDate := range []int64{100, 300, 500} {
+		bookRegistration := &models.BookActivityRegistration{InternetArchiveIdentifier: "book", Registration: models.ActivityRegistration{RegistrationDate: registrationDate, UserRefer: user.Id}}
+		assert.NoError(t, activityRegistrationStorage.Create(&bookRegistration.Registration))
+		assert.NoError(t, bookRegistrationStorage.Create(bookRegistration))
+	}
+
+	for _, registrationDate := range []int64{200, 400} {
+		gameRegistration := &models.GameActivityRegistration{GameName: "sudoku", Registration: models.ActivityRegistration{RegistrationDate: registrationDate, UserRefer: user.Id}}
+		assert.NoError(t, activityRegistrationStorage.Create(&gameRegistration.Registration))
+		assert.NoError(t, gameRegistrationStorage.Create(gameRegistration))
+	}
+
+	otherUserRegistration := &models.GameActivityRegistration{GameName: "sudoku", Registration: models.ActivityRegistration{RegistrationDate: 250, UserRefer: otherUser.Id}}
+	assert.NoError(t, activityRegistrationStorage.Create(&otherUserRegistration.Registration))
+	assert.NoError(t, gameRegistrationStorage.Create(otherUserRegistration))
+
+	tests := []struct {
+		name          string
+		filter        *models.ActivityFeedFilter
+		expectedDates []int64
+		expectedTotal int64
+	}{
+		{"Descending first page", &models.ActivityFeedFilter{UserId: user.Id, Descending: true, Limit: 2}, []int64{500, 400}, 5},
+		{"Descending last page", &models.ActivityFeedFilter{UserId: user.Id, Descending: true, Limit: 2, Offset: 4}, []int64{100}, 5},
+		{"Ascending middle page", &models.ActivityFeedFilter{UserId: user.Id, Limit: 2, Offset: 2}, []int64{300, 400}, 5},
+		{"Page past the end", &models.ActivityFeedFilter{UserId: user.Id, Limit: 2, Offset: 6}, []int64{}, 5},
+		{"Only books", &models.ActivityFeedFilter{UserId: user.Id, Type: models.BookActivityFeedItem, Limit: 10}, []int64{100, 300, 500}, 3},
+		{"Only games", &models.ActivityFeedFilter{UserId: user.Id, Type: models.GameActivityFeedItem, Descending: true, Limit: 10}, []int64{400, 200}, 2},
+	}
+
+	for _, testCase := range tests {
+		t.Run(testCase.name, func(t *testing.T) {
+			feed, err := activityRegistrationStorage.GetFeed(testCase.filter)
+			assert.NoError(t, err)
+
+			dates := []int64{}
+
+			for _, feedItem := range feed.([]*models.ActivityFeedItem) {
+				dates = append(dates, feedItem.Registration.RegistrationDate)
+				assert.Equal(t, user.Id, feedItem.Registration.UserRefer)
+
+				switch feedItem.Type {
+				case models.BookActivityFeedItem:
+					assert.Equal(t, "book", feedItem.InternetArchiveIdentifier)
+				case models.GameActivityFeedItem:
+					assert.Equal(t, "sudoku", feedItem.GameName)
+				default:
+					t.Errorf("unexpected feed item type %q", feedItem.Type)
+				}
+			}
+
+			assert.Equal(t, testCase.expectedDates, dates)
+
+			total, err := activityRegistrationStorage.CountFeed(testCase.filter)
+			assert.NoError(t, err)
+			assert.Equal(t, testCase.expectedTotal, total)
+		})
+	}
+}
+
+func TestActivityRegistrationStorageCountByDay(t *testing.T) {
+	userStorage := &UserStorage{}
+	activityRegistrationStorage := &ActivityRegistrationStorage{}
+
+	user := &models.User{Email: "days@example.com", UserName: "days", Role: models.Standard}
+	otherUser := &models.User{Email: "days-other@example.com", UserName: "days-other", Role: models.Standard}
+	assert.NoError(t, userStorage.Create(user))
+	assert.NoError(t, userStorage.Create(otherUser))
+
+	for _, registration := range []models.ActivityRegistration{
+		{RegistrationDate: 100, UserRefer: user.Id},
+		{RegistrationDate: 200, UserRefer: user.Id},
+		{RegistrationDate: constants.DaySeconds + 100, UserRefer: user.Id},
+		{RegistrationDate: 2*constants.DaySeconds + 100, UserRefer: user.Id},
+		{RegistrationDate: 300, UserRefer: otherUser.Id},
+	} {
+		assert.NoError(t, activityRegistrationStorage.Create(&registration))
+	}
+
+	dayCounts, err := activityRegistrationStorage.CountByDay(user.Id, 0, 2*constants.DaySeconds-1, time.UTC)
+
+	assert.NoError(t, err)
+	assert.Equal(t, map[int64]int64{0: 2, constants.DaySeconds: 1}, dayCounts)
+
+	// Test case: Registrations are counted by the day of the given location
+	newYork, _ := time.LoadLocation("America/New_York")
+	dayCounts, err = activityRegistrationStorage.CountByDay(user.Id, 0, 2*constants.DaySeconds-1, newYork)
+
+	assert.NoError(t, err)
+	assert.Equal(t, map[int64]int64{-19 * 3600: 2, 5 * 3600: 1}, dayCounts)
+}
+
+func TestActivityRegistrationStorageGetById(t *testing.T) {
+	userStorage := &UserStorage{}
+	activityRegistrationStorage := &ActivityRegistrationStorage{}
+	bookRegistrationStorage := &BookActivityRegistrationStorage{}
+	gameRegistrationStorage := &GameActivityRegistrationStorage{}
+
+	user := &models.User{Email: "getbyid@example.com", UserName: "getbyid", Role: models.Standard}
+	assert.NoError(t, userStorage.Create(user))
+
+	bookRegistration := &models.BookActivityRegistration{InternetArchiveIdentifier: "book", Registration: models.ActivityRegistration{RegistrationDate: 100, UserRefer: user.Id, Platform: "android"}}
+	assert.NoError(t, activityRegistrationStorage.Create(&bookRegistration.Registration))
+	assert.NoError(t, bookRegistrationStorage.Create(bookRegistration))
+
+	gameRegistration := &models.GameActivityRegistration{GameName: "sudoku", Registration: models.ActivityRegistration{RegistrationDate: 200, UserRefer: user.Id}}
+	assert.NoError(t, activityRegistrationStorage.Create(&gameRegistration.Registration))
+	assert.NoError(t, gameRegistrationStorage.Create(gameRegistration))
+
+	// Test case: The registrations are joined with their activity registration
+	storedBookRegistration, err := bookRegistrationStorage.Get(bookRegistration.Id)
+	assert.NoError(t, err)
+	assert.Equal(t, bookRegistration, storedBookRegistration)
+
+	storedGameRegistration, err := gameRegistrationStorage.Get(gameRegistration.Id)
+	assert.NoError(t, err)
+	assert.Equal(t, gameRegistration, storedGameRegistration)
+
+	// Test case: Unknown ids are not found
+	_, err = bookRegistrationStorage.Get(gameRegistration.Id + 1000)
+	assert.IsType(t, &models.DbNotFoundError{}, err)
+
+	_, err = gameRegistrationStorage.Get(bookRegistration.Id + 1000)
+	assert.IsType(t, &models.DbNotFoundError{}, err)
+}
+
+func TestActivityRegistrationStorageUniqueConstraint(t *testing.T) {
+	userStorage := &UserStorage{}
+	activityRegistrationStorage := &ActivityRegistrationStorage{}
+	gameRegistrationStorage := &GameActivityRegistrationStorage{}
+
+	user := &models.User{Email: "unique@example.com", UserName: "unique", Role: models.Standard}
+	assert.NoError(t, userStorage.Create(user))
+
+	// Simulating a unique index on the registrations of a user per day, and on the games of a registration
+	connection := database.GetDatabaseInstance().GetConnection()
+	_, indexErr := connection.Exec("CREATE UNIQUE INDEX `idx_test_activity_registration_user_date` ON `activity_registration` (`user_id`, `registration_date`);")
+	assert.NoError(t, indexErr)
+	_, indexErr = connection.Exec("CREATE UNIQUE INDEX `idx_test_activity_registration_game` ON `activity_registration_game` (`registration_id`, `game_name`);")
+	assert.NoError(t, indexErr)
+	t.Cleanup(func() {
+		connection.Exec("DROP INDEX `idx_test_activity_registration_user_date`;")
+		connection.Exec("DROP INDEX `idx_test_activity_registration_game`;")
+	})
+
+	registration := &models.ActivityRegistration{RegistrationDate: 100, UserRefer: user.Id}
+	assert.NoError(t, activityRegistrationStorage.Create(registration))
+
+	createErr := activityRegistrationStorage.Create(&models.ActivityRegistration{RegistrationDate: 100, UserRefer: user.Id})
+	assert.IsType(t, &models.DbItemAlreadyExistsError{}, createErr)
+
+	gameRegistration := &models.GameActivityRegistration{GameName: "sudoku", Registration: *registration}
+	assert.NoError(t, gameRegistrationStorage.Create(gameRegistration))
+
+	createErr = gameRegistrationStorage.Create(&models.GameActivityRegistration{GameName: "sudoku", Registration: *registration})
+	assert.IsType(t, &models.DbItemAlreadyExistsError{}, createErr)
+
+	// Test case: Other errors are not translated
+	createErr = activityRegistrationStorage.Create(&models.GameActivityRegistration{})
+	assert.IsType(t, &models.DbCouldNotParseItemError{}, createErr)
+}
+
+func TestStorageEmptyListsSerialization(t *testing.T) {
+	userStorage := &UserStorage{}
+	user := &models.User{Email: "empty-lists@example.com", UserName: "empty-lists", Role: models.Standard}
+	assert.NoError(t, userStorage.Create(user))
+
+	activityRegistrationStorage := &ActivityRegistrationStorage{}
+	diaryEntryStorage := &DiaryEntryStorage{}
+	bookRegistrationStorage := &BookActivityRegistrationStorage{}
+	gameRegistrationStorage := &GameActivityRegistrationStorage{}
+	externalLoginStorage := &ExternalLoginStorage{}
+
+	tests := []struct {
+		name    string
+		getList func() (interface{}, error)
+	}{
+		{"Diary entries", func() (interface{}, error) { return diaryEntryStorage.GetByUserId(user.Id) }},
+		{"Diary entries in an interval", func() (interface{}, error) { return diaryEntryStorage.GetByUserIdAndDateInterval(user.Id, 0, 1000) }},
+		{"Diary entry summaries", func() (interface{}, error) { return diaryEntryStorage.GetSummariesByUserId(user.Id, 10) }},
+		{"Book registrations", func() (interface{}, error) { return bookRegistrationStorage.GetByUserId(user.Id) }},
+		{"Book registrations in an interval", func() (interface{}, error) { return bookRegistrationStorage.GetByUserIdAndTimeRange(user.Id, 0, 1000) }},
+		{"Game registrations", func() (interface{}, error) { return gameRegistrationStorage.GetByUserId(user.Id) }},
+		{"Game registrations in an interval", func() (interface{}, error) { return gameRegistrationStorage.GetByUserIdAndInterval(user.Id, 0, 1000) }},
+		{"Activity feed", func() (interface{}, error) {
+			return activityRegistrationStorage.GetFeed(&models.ActivityFeedFilter{UserId: user.Id, Limit: 10})
+		}},
+		{"External logins", func() (interface{}, error) { return externalLoginStorage.GetByUserId(user.Id) }},
+	}
+
+	for _, testCase := range tests {
+		t.Run(testCase.name, func(t *testing.T) {
+			list, err := testCase.getList()
+			assert.NoError(t, err)
+
+			serializedList, marshalErr := json.Marshal(list)
+			assert.NoError(t, marshalErr)
+			assert.Equal(t, "[]", string(serializedList))
+		})
+	}
+}
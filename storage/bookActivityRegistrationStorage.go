@@ -8,23 +8,30 @@ import (
 )
 
 const (
-	getBookActivityRegistrationByIdentifierQuery  = "SELECT arb.id, arb.internet_archive_id, ar.registration_date, ar.user_id FROM activity_registration_book arb INNER JOIN activity_registration ar ON (arb.registration_id = ar.id) WHERE arb.id = ?;"
-	getUserBookActivityRegistrationsQuery         = "SELECT arb.id, arb.internet_archive_id, ar.id, ar.registration_date, ar.user_id FROM activity_registration_book arb INNER JOIN activity_registration ar ON (arb.registration_id = ar.id) WHERE ar.user_id = ?;"
-	getIntervalUserBookActivityRegistrationsQuery = "SELECT arb.id, arb.internet_archive_id, ar.id, ar.registration_date, ar.user_id FROM activity_registration_book arb INNER JOIN activity_registration ar ON (arb.registration_id = ar.id) WHERE ar.user_id = ? AND ar.registration_date >= ? AND ar.registration_date <= ?;"
-	insertBookActivityRegistrationQuery           = "INSERT INTO activity_registration_book (internet_archive_id, registration_id) VALUES (?, ?);"
-	updateBookActivityRegistrationQuery           = "UPDATE activity_registration_book SET internet_archive_id = ? WHERE id = ?;"
-	deleteBookActivityRegistrationQuery           = "DELETE FROM activity_registration_book WHERE id = ?;"
+	getBookActivityRegistrationByIdentifierQuery                = "SELECT arb.id, arb.internet_archive_id, ar.id, ar.registration_date, ar.user_id, COALESCE(ar.platform, '') FROM activity_registration_book arb INNER JOIN activity_registration ar ON (arb.registration_id = ar.id) WHERE arb.id = ?;"
+	getUserBookActivityRegistrationsQuery                       = "SELECT arb.id, arb.internet_archive_id, ar.id, ar.registration_date, ar.user_id, COALESCE(ar.platform, '') FROM activity_registration_book arb INNER JOIN activity_registration ar ON (arb.registration_id = ar.id) WHERE ar.user_id = ? ORDER BY ar.registration_date DESC, arb.id DESC;"
+	getIntervalUserBookActivityRegistrationsQuery               = "SELECT arb.id, arb.internet_archive_id, ar.id, ar.registration_date, ar.user_id, COALESCE(ar.platform, '') FROM activity_registration_book arb INNER JOIN activity_registration ar ON (arb.registration_id = ar.id) WHERE ar.user_id = ? AND ar.registration_date >= ? AND ar.registration_date <= ? ORDER BY ar.registration_date DESC, arb.id DESC;"
+	getUserBookActivityRegistrationByIdentifierAndIntervalQuery = "SELECT arb.id, arb.internet_archive_id, ar.id, ar.registration_date, ar.user_id, COALESCE(ar.platform, '') FROM activity_registration_book arb INNER JOIN activity_registration ar ON (arb.registration_id = ar.id) WHERE ar.user_id = ? AND arb.internet_archive_id = ? AND ar.registration_date >= ? AND ar.registration_date <= ? LIMIT 1;"
+	insertBookActivityRegistrationQuery                         = "INSERT INTO activity_registration_book (internet_archive_id, registration_id) VALUES (?, ?);"
+	updateBookActivityRegistrationQuery                         = "UPDATE activity_registration_book SET internet_archive_id = ? WHERE id = ?;"
+	deleteBookActivityRegistrationQuery                         = "DELETE FROM activity_registration_book WHERE id = ?;"
 )
 
 type BookActivityRegistrationStorageInterface interface {
+	Get(id uint) (interface{}, error)
 	GetByUserId(userId uint) (interface{}, error)
 	GetByUserIdAndTimeRange(userId uint, startTime int64, endTime int64) (interface{}, error)
+	GetByUserIdIdentifierAndTimeRange(userId uint, internetArchiveId string, startTime int64, endTime int64) (interface{}, error)
 	Create(data interface{}) error
+	Update(data interface{}) error
 }
 
 type BookActivityRegistrationStorage struct{}
 
+var _ BookActivityRegistrationStorageInterface = (*BookActivityRegistrationStorage)(nil)
+
 var bookActivityRegistrationNotFoundError = &models.DbNotFoundError{DbItem: &models.BookActivityRegistration{}}
+var bookActivityRegistrationAlreadyExistsError = &models.DbItemAlreadyExistsError{DbItem: &models.BookActivityRegistration{}}
 var failedToParseBookActivityRegistrationError = &models.DbCouldNotParseItemError{DbItem: &models.BookActivityRegistration{}}
 
 func (bookActivityRegistrationStorage *BookActivityRegistrationStorage) Get(id uint) (interface{}, error) {
@@ -119,6 +126,35 @@ func (bookActivityRegistrationStorage *BookActivityRegistrationStorage) GetByUse
 	return userBookActivityRegistrations, nil
 }
 
+// Gets the first registration of the given book made by the user within the given time range.
+func (bookActivityRegistrationStorage *BookActivityRegistrationStorage) GetByUserIdIdentifierAndTimeRange(userId uint, internetArchiveId string, startTime int64, endTime int64) (interface{}, error) {
+	result, err := database.GetDatabaseInstance().GetConnection().Query(getUserBookActivityRegistrationByIdentifierAndIntervalQuery, userId, internetArchiveId, startTime, endTime)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer result.Close()
+
+	if !result.Next() {
+		return nil, bookActivityRegistrationNotFoundError
+	}
+
+	scannedBookActivityRegistration, scanErr := bookActivityRegistrationStorage.Scan(result)
+
+	if scanErr != nil {
+		return nil, scanErr
+	}
+
+	bookActivityRegistration, ok := scannedBookActivityRegistration.(models.BookActivityRegistration)
+
+	if !ok {
+		return nil, failedToParseBookActivityRegistrationError
+	}
+
+	return &bookActivityRegistration, nil
+}
+
 func (bookActivityRegistrationStorage *BookActivityRegistrationStorage) Create(bookRegistration interface{}) error {
 	dbBookRegistration, ok := bookRegistration.(*models.BookActivityRegistration)
 
@@ -130,6 +166,10 @@ func (bookActivityRegistrationStorage *BookActivityRegistrationStorage) Create(b
 		dbBookRegistration.InternetArchiveIdentifier,
 		dbBookRegistration.Registration.Id)
 
+	if isUniqueConstraintError(err) {
+		return bookActivityRegistrationAlreadyExistsError
+	}
+
 	if err != nil {
 		return err
 	}
@@ -151,7 +191,7 @@ func (bookActivityRegistrationStorage *BookActivityRegistrationStorage) Update(b
 		return failedToParseBookActivityRegistrationError
 	}
 
-	result, err := database.GetDatabaseInstance().GetConnection().Exec(updateDiaryEntryQuery,
+	result, err := database.GetDatabaseInstance().GetConnection().Exec(updateBookActivityRegistrationQuery,
 		dbBookRegistration.InternetArchiveIdentifier,
 		dbBookRegistration.Id)
 
@@ -196,7 +236,8 @@ func (bookActivityRegistrationStorage *BookActivityRegistrationStorage) Scan(row
 	var bookActivityRegistration models.BookActivityRegistration
 
 	scanErr := rows.Scan(&bookActivityRegistration.Id, &bookActivityRegistration.InternetArchiveIdentifier, &bookActivityRegistration.Registration.Id,
-		&bookActivityRegistration.Registration.RegistrationDate, &bookActivityRegistration.Registration.UserRefer)
+		&bookActivityRegistration.Registration.RegistrationDate, &bookActivityRegistration.Registration.UserRefer,
+		&bookActivityRegistration.Registration.Platform)
 
 	return bookActivityRegistration, scanErr
 }
@@ -2,30 +2,53 @@ package storage
 
 import (
 	"database/sql"
+	"fmt"
+	"strings"
 
 	"github.com/adfer-dev/analock-api/database"
 	"github.com/adfer-dev/analock-api/models"
 )
 
 const (
-	getDiaryEntryByIdentifierQuery   = "SELECT de.id, de.title, de.content, ar.id, ar.registration_date, ar.user_id FROM diary_entry de INNER JOIN activity_registration ar ON (de.registration_id = ar.id) WHERE de.id = ?;"
-	getUserDiaryEntriesQuery         = "SELECT de.id, de.title, de.content, ar.id, ar.registration_date, ar.user_id FROM diary_entry de INNER JOIN activity_registration ar ON (de.registration_id = ar.id) WHERE ar.user_id = ?;"
-	getIntervalUserDiaryEntriesQuery = "SELECT de.id, de.title, de.content, ar.id, ar.registration_date, ar.user_id FROM diary_entry de INNER JOIN activity_registration ar ON (de.registration_id = ar.id) WHERE ar.user_id = ? AND ar.registration_date >= ? AND ar.registration_date <= ?;"
-	insertDiaryEntryQuery            = "INSERT INTO diary_entry (title, content, registration_id) VALUES (?, ?, ?);"
-	updateDiaryEntryQuery            = "UPDATE diary_entry SET title = ?, content = ? WHERE id = ?;"
-	deleteDiaryEntryQuery            = "DELETE FROM diary_entry WHERE id = ?;"
+	getDiaryEntryByIdentifierQuery          = "SELECT de.id, de.title, de.content, ar.id, ar.registration_date, ar.user_id, COALESCE(de.updated_at, 0) FROM diary_entry de INNER JOIN activity_registration ar ON (de.registration_id = ar.id) WHERE de.id = ?;"
+	getUserDiaryEntriesQuery                = "SELECT de.id, de.title, de.content, ar.id, ar.registration_date, ar.user_id, COALESCE(de.updated_at, 0) FROM diary_entry de INNER JOIN activity_registration ar ON (de.registration_id = ar.id) WHERE ar.user_id = ? ORDER BY ar.registration_date DESC, de.id DESC;"
+	getIntervalUserDiaryEntriesQuery        = "SELECT de.id, de.title, de.content, ar.id, ar.registration_date, ar.user_id, COALESCE(de.updated_at, 0) FROM diary_entry de INNER JOIN activity_registration ar ON (de.registration_id = ar.id) WHERE ar.user_id = ? AND ar.registration_date >= ? AND ar.registration_date <= ? ORDER BY ar.registration_date DESC, de.id DESC;"
+	getIntervalsUserDiaryEntriesQuery       = "SELECT de.id, de.title, de.content, ar.id, ar.registration_date, ar.user_id, COALESCE(de.updated_at, 0) FROM diary_entry de INNER JOIN activity_registration ar ON (de.registration_id = ar.id) WHERE ar.user_id = ? AND (%s) ORDER BY ar.registration_date DESC, de.id DESC;"
+	dateIntervalCondition                   = "(ar.registration_date >= ? AND ar.registration_date <= ?)"
+	getUserDiaryEntrySummariesQuery         = "SELECT de.id, de.title, substr(de.content, 1, ?), ar.registration_date FROM diary_entry de INNER JOIN activity_registration ar ON (de.registration_id = ar.id) WHERE ar.user_id = ? ORDER BY ar.registration_date DESC, de.id DESC;"
+	getIntervalUserDiaryEntrySummariesQuery = "SELECT de.id, de.title, substr(de.content, 1, ?), ar.registration_date FROM diary_entry de INNER JOIN activity_registration ar ON (de.registration_id = ar.id) WHERE ar.user_id = ? AND ar.registration_date >= ? AND ar.registration_date <= ? ORDER BY ar.registration_date DESC, de.id DESC;"
+	countUserDiaryEntriesQuery              = "SELECT COUNT(*) FROM diary_entry de INNER JOIN activity_registration ar ON (de.registration_id = ar.id) WHERE ar.user_id = ?;"
+	insertDiaryEntryQuery                   = "INSERT INTO diary_entry (title, content, registration_id, updated_at) VALUES (?, ?, ?, ?);"
+	updateDiaryEntryQuery                   = "UPDATE diary_entry SET title = ?, content = ?, updated_at = ? WHERE id = ?;"
+	deleteDiaryEntryQuery                   = "DELETE FROM diary_entry WHERE id = ?;"
 )
 
 type DiaryEntryStorageInterface interface {
 	Get(id uint) (interface{}, error)
 	GetByUserId(userId uint) (interface{}, error)
+	StreamByUserId(userId uint, yield func(diaryEntry *models.DiaryEntry) error) error
 	GetByUserIdAndDateInterval(userId uint, startDate int64, endDate int64) (interface{}, error)
+	GetByUserIdAndDateIntervals(userId uint, intervals []DateInterval) (interface{}, error)
+	GetSummariesByUserId(userId uint, previewLength int) (interface{}, error)
+	GetSummariesByUserIdAndDateInterval(userId uint, startDate int64, endDate int64, previewLength int) (interface{}, error)
+	CountByUserId(userId uint) (int64, error)
 	Create(data interface{}) error
+	CreateMany(data interface{}) error
 	Update(data interface{}) error
+	Delete(id uint) error
+	DeleteMany(data interface{}) error
+}
+
+// Date interval in Unix seconds, both ends included.
+type DateInterval struct {
+	StartDate int64
+	EndDate   int64
 }
 
 type DiaryEntryStorage struct{}
 
+var _ DiaryEntryStorageInterface = (*DiaryEntryStorage)(nil)
+
 var diaryEntryNotFoundError = &models.DbNotFoundError{DbItem: &models.DiaryEntry{}}
 var failedToParseDiaryEntryError = &models.DbCouldNotParseItemError{DbItem: &models.DiaryEntry{}}
 
@@ -58,8 +81,54 @@ func (diaryEntryStorage *DiaryEntryStorage) Get(id uint) (interface{}, error) {
 
 func (diaryEntryStorage *DiaryEntryStorage) GetByUserId(userId uint) (interface{}, error) {
 	userDiaryEntries := []*models.DiaryEntry{}
+
+	streamErr := diaryEntryStorage.StreamByUserId(userId, func(diaryEntry *models.DiaryEntry) error {
+		userDiaryEntries = append(userDiaryEntries, diaryEntry)
+		return nil
+	})
+
+	if streamErr != nil {
+		return nil, streamErr
+	}
+
+	return userDiaryEntries, nil
+}
+
+// Calls yield with each of the user's entries as it is scanned, in the same order GetByUserId returns them,
+// so they do not need to be held in memory at once. Stops at the first error yield returns.
+func (diaryEntryStorage *DiaryEntryStorage) StreamByUserId(userId uint, yield func(diaryEntry *models.DiaryEntry) error) error {
 	result, err := database.GetDatabaseInstance().GetConnection().Query(getUserDiaryEntriesQuery, userId)
 
+	if err != nil {
+		return err
+	}
+
+	defer result.Close()
+
+	for result.Next() {
+		scannedDiaryEntry, scanErr := diaryEntryStorage.Scan(result)
+
+		if scanErr != nil {
+			return scanErr
+		}
+		diaryEntry, ok := scannedDiaryEntry.(models.DiaryEntry)
+
+		if !ok {
+			return failedToParseDiaryEntryError
+		}
+
+		if yieldErr := yield(&diaryEntry); yieldErr != nil {
+			return yieldErr
+		}
+	}
+
+	return result.Err()
+}
+
+func (diaryEntryStorage *DiaryEntryStorage) GetByUserIdAndDateInterval(userId uint, startDate int64, endDate int64) (interface{}, error) {
+	userDiaryEntries := []*models.DiaryEntry{}
+	result, err := database.GetDatabaseInstance().GetConnection().Query(getIntervalUserDiaryEntriesQuery, userId, startDate, endDate)
+
 	if err != nil {
 		return nil, err
 	}
@@ -84,9 +153,26 @@ func (diaryEntryStorage *DiaryEntryStorage) GetByUserId(userId uint) (interface{
 	return userDiaryEntries, nil
 }
 
-func (diaryEntryStorage *DiaryEntryStorage) GetByUserIdAndDateInterval(userId uint, startDate int64, endDate int64) (interface{}, error) {
+// Gets the entries of a user within any of the given date intervals with a single query.
+func (diaryEntryStorage *DiaryEntryStorage) GetByUserIdAndDateIntervals(userId uint, intervals []DateInterval) (interface{}, error) {
 	userDiaryEntries := []*models.DiaryEntry{}
-	result, err := database.GetDatabaseInstance().GetConnection().Query(getIntervalUserDiaryEntriesQuery, userId, startDate, endDate)
+
+	if len(intervals) == 0 {
+		return userDiaryEntries, nil
+	}
+
+	conditions := make([]string, 0, len(intervals))
+	args := []any{userId}
+
+	for _, interval := range intervals {
+		conditions = append(conditions, dateIntervalCondition)
+		args = append(args, interval.StartDate, interval.EndDate)
+	}
+
+	result, err := database.GetDatabaseInstance().GetConnection().Query(
+		fmt.Sprintf(getIntervalsUserDiaryEntriesQuery, strings.Join(conditions, " OR ")),
+		args...,
+	)
 
 	if err != nil {
 		return nil, err
@@ -109,7 +195,44 @@ func (diaryEntryStorage *DiaryEntryStorage) GetByUserIdAndDateInterval(userId ui
 		userDiaryEntries = append(userDiaryEntries, &diaryEntry)
 	}
 
-	return userDiaryEntries, nil
+	return userDiaryEntries, result.Err()
+}
+
+// Gets the summaries of a user's entries, only selecting the first previewLength characters of their content.
+func (diaryEntryStorage *DiaryEntryStorage) GetSummariesByUserId(userId uint, previewLength int) (interface{}, error) {
+	result, err := database.GetDatabaseInstance().GetConnection().Query(getUserDiaryEntrySummariesQuery, previewLength, userId)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer result.Close()
+
+	return diaryEntryStorage.scanSummaries(result)
+}
+
+// Gets the summaries of a user's entries within the given date interval.
+func (diaryEntryStorage *DiaryEntryStorage) GetSummariesByUserIdAndDateInterval(userId uint, startDate int64, endDate int64, previewLength int) (interface{}, error) {
+	result, err := database.GetDatabaseInstance().GetConnection().Query(getIntervalUserDiaryEntrySummariesQuery, previewLength, userId, startDate, endDate)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer result.Close()
+
+	return diaryEntryStorage.scanSummaries(result)
+}
+
+// Counts the entries of a user.
+func (diaryEntryStorage *DiaryEntryStorage) CountByUserId(userId uint) (int64, error) {
+	var count int64
+
+	if err := database.GetDatabaseInstance().GetConnection().QueryRow(countUserDiaryEntriesQuery, userId).Scan(&count); err != nil {
+		return 0, err
+	}
+
+	return count, nil
 }
 
 func (diaryEntryStorage *DiaryEntryStorage) Create(diaryEntry interface{}) error {
@@ -122,7 +245,70 @@ func (diaryEntryStorage *DiaryEntryStorage) Create(diaryEntry interface{}) error
 	result, err := database.GetDatabaseInstance().GetConnection().Exec(insertDiaryEntryQuery,
 		dbDiaryEntry.Title,
 		dbDiaryEntry.Content,
-		dbDiaryEntry.Registration.Id)
+		dbDiaryEntry.Registration.Id,
+		dbDiaryEntry.UpdatedAt)
+
+	if err != nil {
+		return err
+	}
+
+	diaryEntryId, idErr := result.LastInsertId()
+	if idErr != nil {
+		return idErr
+	}
+
+	dbDiaryEntry.Id = uint(diaryEntryId)
+
+	return nil
+}
+
+// Creates the given diary entries along with their activity registrations within a single transaction.
+// If any insert fails, none of the entries are stored.
+func (diaryEntryStorage *DiaryEntryStorage) CreateMany(diaryEntries interface{}) error {
+	dbDiaryEntries, ok := diaryEntries.([]*models.DiaryEntry)
+
+	if !ok {
+		return failedToParseDiaryEntryError
+	}
+
+	tx, txErr := database.GetDatabaseInstance().GetConnection().Begin()
+
+	if txErr != nil {
+		return txErr
+	}
+
+	for _, dbDiaryEntry := range dbDiaryEntries {
+		if insertErr := insertDiaryEntryWithRegistration(tx, dbDiaryEntry); insertErr != nil {
+			tx.Rollback()
+			return insertErr
+		}
+	}
+
+	return tx.Commit()
+}
+
+func insertDiaryEntryWithRegistration(tx *sql.Tx, dbDiaryEntry *models.DiaryEntry) error {
+	registrationResult, registrationErr := tx.Exec(insertActivityRegistrationQuery,
+		dbDiaryEntry.Registration.RegistrationDate,
+		dbDiaryEntry.Registration.UserRefer,
+		dbDiaryEntry.Registration.Platform)
+
+	if registrationErr != nil {
+		return registrationErr
+	}
+
+	registrationId, registrationIdErr := registrationResult.LastInsertId()
+	if registrationIdErr != nil {
+		return registrationIdErr
+	}
+
+	dbDiaryEntry.Registration.Id = uint(registrationId)
+
+	result, err := tx.Exec(insertDiaryEntryQuery,
+		dbDiaryEntry.Title,
+		dbDiaryEntry.Content,
+		dbDiaryEntry.Registration.Id,
+		dbDiaryEntry.UpdatedAt)
 
 	if err != nil {
 		return err
@@ -148,6 +334,7 @@ func (diaryEntryStorage *DiaryEntryStorage) Update(diaryEntry interface{}) error
 	result, err := database.GetDatabaseInstance().GetConnection().Exec(updateDiaryEntryQuery,
 		dbDiaryEntry.Title,
 		dbDiaryEntry.Content,
+		dbDiaryEntry.UpdatedAt,
 		dbDiaryEntry.Id)
 
 	if err != nil {
@@ -187,11 +374,74 @@ func (diaryEntryStorage *DiaryEntryStorage) Delete(id uint) error {
 	return nil
 }
 
+// Deletes the given diary entries along with their activity registrations within a single transaction.
+// If any of them does not exist or fails to be deleted, none of the entries are deleted.
+func (diaryEntryStorage *DiaryEntryStorage) DeleteMany(diaryEntries interface{}) error {
+	dbDiaryEntries, ok := diaryEntries.([]*models.DiaryEntry)
+
+	if !ok {
+		return failedToParseDiaryEntryError
+	}
+
+	tx, txErr := database.GetDatabaseInstance().GetConnection().Begin()
+
+	if txErr != nil {
+		return txErr
+	}
+
+	for _, dbDiaryEntry := range dbDiaryEntries {
+		if deleteErr := deleteDiaryEntryWithRegistration(tx, dbDiaryEntry); deleteErr != nil {
+			tx.Rollback()
+			return deleteErr
+		}
+	}
+
+	return tx.Commit()
+}
+
+func deleteDiaryEntryWithRegistration(tx *sql.Tx, dbDiaryEntry *models.DiaryEntry) error {
+	result, err := tx.Exec(deleteDiaryEntryQuery, dbDiaryEntry.Id)
+
+	if err != nil {
+		return err
+	}
+
+	affectedRows, errAffectedRows := result.RowsAffected()
+
+	if errAffectedRows != nil {
+		return errAffectedRows
+	}
+
+	if affectedRows == 0 {
+		return diaryEntryNotFoundError
+	}
+
+	_, registrationErr := tx.Exec(deleteActivityRegistrationQuery, dbDiaryEntry.Registration.Id)
+
+	return registrationErr
+}
+
 func (diaryEntryStorage *DiaryEntryStorage) Scan(rows *sql.Rows) (interface{}, error) {
 	var diaryEntry models.DiaryEntry
 
 	scanErr := rows.Scan(&diaryEntry.Id, &diaryEntry.Title, &diaryEntry.Content, &diaryEntry.Registration.Id,
-		&diaryEntry.Registration.RegistrationDate, &diaryEntry.Registration.UserRefer)
+		&diaryEntry.Registration.RegistrationDate, &diaryEntry.Registration.UserRefer, &diaryEntry.UpdatedAt)
 
 	return diaryEntry, scanErr
 }
+
+func (diaryEntryStorage *DiaryEntryStorage) scanSummaries(rows *sql.Rows) ([]*models.DiaryEntrySummary, error) {
+	summaries := []*models.DiaryEntrySummary{}
+
+	for rows.Next() {
+		var summary models.DiaryEntrySummary
+
+		if scanErr := rows.Scan(&summary.Id, &summary.Title, &summary.ContentPreview, &summary.RegistrationDate); scanErr != nil {
+			return nil, scanErr
+		}
+
+		summaries = append(summaries, &summary)
+	}
+
+	return summaries, nil
+}
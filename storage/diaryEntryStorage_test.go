@@ -0,0 +1,315 @@
+package storage
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/adfer-dev/analock-api/database"
+	"github.com/adfer-dev/analock-api/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiaryEntryStorageUpdatedAt(t *testing.T) {
+	userStorage := &UserStorage{}
+	activityRegistrationStorage := &ActivityRegistrationStorage{}
+	diaryEntryStorage := &DiaryEntryStorage{}
+
+	user := &models.User{Email: "diary@example.com", UserName: "diary", Role: models.Standard}
+	assert.NoError(t, userStorage.Create(user))
+
+	diaryEntry := &models.DiaryEntry{Title: "title", Content: "content", Registration: models.ActivityRegistration{RegistrationDate: 100, UserRefer: user.Id}, UpdatedAt: 1000}
+	assert.NoError(t, activityRegistrationStorage.Create(&diaryEntry.Registration))
+	assert.NoError(t, diaryEntryStorage.Create(diaryEntry))
+
+	storedDiaryEntry, err := diaryEntryStorage.Get(diaryEntry.Id)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1000), storedDiaryEntry.(*models.DiaryEntry).UpdatedAt)
+
+	diaryEntry.Title = "new title"
+	diaryEntry.UpdatedAt = 2000
+	assert.NoError(t, diaryEntryStorage.Update(diaryEntry))
+
+	storedDiaryEntry, err = diaryEntryStorage.Get(diaryEntry.Id)
+	assert.NoError(t, err)
+	assert.Equal(t, diaryEntry, storedDiaryEntry)
+}
+
+func TestDiaryEntryStorageGetByDateIntervals(t *testing.T) {
+	userStorage := &UserStorage{}
+	diaryEntryStorage := &DiaryEntryStorage{}
+
+	user := &models.User{Email: "intervals@example.com", UserName: "intervals", Role: models.Standard}
+	assert.NoError(t, userStorage.Create(user))
+
+	diaryEntries := []*models.DiaryEntry{
+		{Title: "first", Content: "content", Registration: models.ActivityRegistration{RegistrationDate: 100, UserRefer: user.Id}},
+		{Title: "second", Content: "content", Registration: models.ActivityRegistration{RegistrationDate: 200, UserRefer: user.Id}},
+		{Title: "third", Content: "content", Registration: models.ActivityRegistration{RegistrationDate: 300, UserRefer: user.Id}},
+	}
+	assert.NoError(t, diaryEntryStorage.CreateMany(diaryEntries))
+
+	// Test case: Entries within any of the intervals are returned, newest first
+	intervalEntries, err := diaryEntryStorage.GetByUserIdAndDateIntervals(user.Id, []DateInterval{{StartDate: 50, EndDate: 150}, {StartDate: 250, EndDate: 300}})
+	assert.NoError(t, err)
+	assert.Len(t, intervalEntries, 2)
+	assert.Equal(t, "third", intervalEntries.([]*models.DiaryEntry)[0].Title)
+	assert.Equal(t, "first", intervalEntries.([]*models.DiaryEntry)[1].Title)
+
+	// Test case: No intervals find no entries
+	intervalEntries, err = diaryEntryStorage.GetByUserIdAndDateIntervals(user.Id, nil)
+	assert.NoError(t, err)
+	assert.Empty(t, intervalEntries)
+}
+
+func TestDiaryEntryStorageDeleteManyRollsBack(t *testing.T) {
+	userStorage := &UserStorage{}
+	activityRegistrationStorage := &ActivityRegistrationStorage{}
+	diaryEntryStorage := &DiaryEntryStorage{}
+
+	user := &models.User{Email: "bulkdelete@example.com", UserName: "bulkdelete", Role: models.Standard}
+	assert.NoError(t, userStorage.Create(user))
+
+	diaryEntries := []*models.DiaryEntry{
+		{Title: "first", Content: "content", Registration: models.ActivityRegistration{RegistrationDate: 100, UserRefer: user.Id}},
+		{Title: "second", Content: "content", Registration: models.ActivityRegistration{RegistrationDate: 200, UserRefer: user.Id}},
+	}
+	assert.NoError(t, diaryEntryStorage.CreateMany(diaryEntries))
+
+	// Test case: The second delete fails, so the first one is rolled back
+	deleteErr := diaryEntryStorage.DeleteMany([]*models.DiaryEntry{
+		diaryEntries[0],
+		{Id: diaryEntries[1].Id + 100, Registration: models.ActivityRegistration{Id: diaryEntries[1].Registration.Id + 100}},
+	})
+
+	assert.ErrorIs(t, deleteErr, diaryEntryNotFoundError)
+	_, getErr := diaryEntryStorage.Get(diaryEntries[0].Id)
+	assert.NoError(t, getErr)
+	_, getRegistrationErr := activityRegistrationStorage.Get(diaryEntries[0].Registration.Id)
+	assert.NoError(t, getRegistrationErr)
+
+	// Test case: Both entries are deleted along with their activity registrations
+	assert.NoError(t, diaryEntryStorage.DeleteMany(diaryEntries))
+
+	userDiaryEntries, getUserEntriesErr := diaryEntryStorage.GetByUserId(user.Id)
+	assert.NoError(t, getUserEntriesErr)
+	assert.Empty(t, userDiaryEntries)
+
+	for _, diaryEntry := range diaryEntries {
+		_, getRegistrationErr = activityRegistrationStorage.Get(diaryEntry.Registration.Id)
+		assert.Error(t, getRegistrationErr)
+	}
+}
+
+func TestUserListsNewestFirst(t *testing.T) {
+	userStorage := &UserStorage{}
+	activityRegistrationStorage := &ActivityRegistrationStorage{}
+	diaryEntryStorage := &DiaryEntryStorage{}
+	bookRegistrationStorage := &BookActivityRegistrationStorage{}
+	gameRegistrationStorage := &GameActivityRegistrationStorage{}
+
+	user := &models.User{Email: "order@example.com", UserName: "order", Role: models.Standard}
+	assert.NoError(t, userStorage.Create(user))
+
+	// Rows are inserted out of order, with two of them sharing their registration date
+	registrationDates := []int64{200, 100, 300, 200}
+
+	for _, registrationDate := range registrationDates {
+		diaryEntry := &models.DiaryEntry{Title: "title", Content: "content", Registration: models.ActivityRegistration{RegistrationDate: registrationDate, UserRefer: user.Id}}
+		assert.NoError(t, activityRegistrationStorage.Create(&diaryEntry.Registration))
+		assert.NoError(t, diaryEntryStorage.Create(diaryEntry))
+
+		bookRegistration := &models.BookActivityRegistration{InternetArchiveIdentifier: "book", Registration: models.ActivityRegistration{RegistrationDate: registrationDate, UserRefer: user.Id}}
+		assert.NoError(t, activityRegistrationStorage.Create(&bookRegistration.Registration))
+		assert.NoError(t, bookRegistrationStorage.Create(bookRegistration))
+
+		gameRegistration := &models.GameActivityRegistration{GameName: "sudoku", Registration: models.ActivityRegistration{RegistrationDate: registrationDate, UserRefer: user.Id}}
+		assert.NoError(t, activityRegistrationStorage.Create(&gameRegistration.Registration))
+		assert.NoError(t, gameRegistrationStorage.Create(gameRegistration))
+	}
+
+	// Asserts the given rows are sorted by registration date and then by identifier, both descending.
+	assertNewestFirst := func(t *testing.T, dates []int64, ids []uint, expectedDates []int64) {
+		assert.Equal(t, expectedDates, dates)
+
+		for index := 1; index < len(ids); index++ {
+			if dates[index] == dates[index-1] {
+				assert.Greater(t, ids[index-1], ids[index])
+			}
+		}
+	}
+
+	t.Run("diary_entries", func(t *testing.T) {
+		for _, query := range []func() (interface{}, error){
+			func() (interface{}, error) { return diaryEntryStorage.GetByUserId(user.Id) },
+			func() (interface{}, error) { return diaryEntryStorage.GetByUserIdAndDateInterval(user.Id, 0, 1000) },
+		} {
+			diaryEntries, err := query()
+			assert.NoError(t, err)
+
+			dates, ids := []int64{}, []uint{}
+
+			for _, diaryEntry := range diaryEntries.([]*models.DiaryEntry) {
+				dates = append(dates, diaryEntry.Registration.RegistrationDate)
+				ids = append(ids, diaryEntry.Id)
+			}
+
+			assertNewestFirst(t, dates, ids, []int64{300, 200, 200, 100})
+		}
+
+		summaries, err := diaryEntryStorage.GetSummariesByUserIdAndDateInterval(user.Id, 0, 1000, 5)
+		assert.NoError(t, err)
+
+		dates, ids := []int64{}, []uint{}
+
+		for _, summary := range summaries.([]*models.DiaryEntrySummary) {
+			dates = append(dates, summary.RegistrationDate)
+			ids = append(ids, summary.Id)
+		}
+
+		assertNewestFirst(t, dates, ids, []int64{300, 200, 200, 100})
+	})
+
+	t.Run("book_registrations", func(t *testing.T) {
+		for _, query := range []func() (interface{}, error){
+			func() (interface{}, error) { return bookRegistrationStorage.GetByUserId(user.Id) },
+			func() (interface{}, error) { return bookRegistrationStorage.GetByUserIdAndTimeRange(user.Id, 0, 1000) },
+		} {
+			bookRegistrations, err := query()
+			assert.NoError(t, err)
+
+			dates, ids := []int64{}, []uint{}
+
+			for _, bookRegistration := range bookRegistrations.([]*models.BookActivityRegistration) {
+				dates = append(dates, bookRegistration.Registration.RegistrationDate)
+				ids = append(ids, bookRegistration.Id)
+			}
+
+			assertNewestFirst(t, dates, ids, []int64{300, 200, 200, 100})
+		}
+	})
+
+	t.Run("game_registrations", func(t *testing.T) {
+		for _, query := range []func() (interface{}, error){
+			func() (interface{}, error) { return gameRegistrationStorage.GetByUserId(user.Id) },
+			func() (interface{}, error) { return gameRegistrationStorage.GetByUserIdAndInterval(user.Id, 0, 1000) },
+		} {
+			gameRegistrations, err := query()
+			assert.NoError(t, err)
+
+			dates, ids := []int64{}, []uint{}
+
+			for _, gameRegistration := range gameRegistrations.([]*models.GameActivityRegistration) {
+				dates = append(dates, gameRegistration.Registration.RegistrationDate)
+				ids = append(ids, gameRegistration.Id)
+			}
+
+			assertNewestFirst(t, dates, ids, []int64{300, 200, 200, 100})
+		}
+	})
+}
+
+// Gets the detail column of every row of the query plan of the given query.
+func getQueryPlan(tb testing.TB, query string, args ...any) string {
+	rows, queryErr := database.GetDatabaseInstance().GetConnection().Query("EXPLAIN QUERY PLAN "+query, args...)
+
+	if queryErr != nil {
+		tb.Fatal(queryErr)
+	}
+
+	defer rows.Close()
+
+	plan := []string{}
+	for rows.Next() {
+		var id, parent, notUsed int
+		var detail string
+
+		if scanErr := rows.Scan(&id, &parent, &notUsed, &detail); scanErr != nil {
+			tb.Fatal(scanErr)
+		}
+		plan = append(plan, detail)
+	}
+
+	return strings.Join(plan, "\n")
+}
+
+func TestDiaryEntryDateRangeQueriesUseUserDateIndex(t *testing.T) {
+	plan := getQueryPlan(t, getIntervalUserDiaryEntriesQuery, 1, 0, 1)
+
+	assert.Contains(t, plan, "idx_activity_registration_user_date")
+	assert.Contains(t, plan, "idx_diary_entry_registration")
+
+	intervalsQuery := fmt.Sprintf(getIntervalsUserDiaryEntriesQuery, dateIntervalCondition+" OR "+dateIntervalCondition)
+	intervalsPlan := getQueryPlan(t, intervalsQuery, 1, 0, 1, 2, 3)
+
+	assert.Contains(t, intervalsPlan, "idx_activity_registration_user_date")
+	assert.NotContains(t, intervalsPlan, "SCAN ar")
+
+	summariesPlan := getQueryPlan(t, getIntervalUserDiaryEntrySummariesQuery, 100, 1, 0, 1)
+
+	assert.Contains(t, summariesPlan, "idx_activity_registration_user_date")
+	assert.Contains(t, summariesPlan, "idx_diary_entry_registration")
+}
+
+const (
+	benchmarkSeedUsers           = 50
+	benchmarkSeedEntriesPerUser  = 200
+	benchmarkSeedFirstDate       = int64(1700000000)
+	benchmarkSeedEntriesInterval = int64(3600)
+)
+
+// Stores several users with an entry every hour each, returning their ids.
+func seedDiaryEntries(b *testing.B) []uint {
+	userStorage := &UserStorage{}
+	diaryEntryStorage := &DiaryEntryStorage{}
+	userIds := make([]uint, 0, benchmarkSeedUsers)
+
+	for userIndex := 0; userIndex < benchmarkSeedUsers; userIndex++ {
+		user := &models.User{Email: fmt.Sprintf("benchmark%d@example.com", userIndex), UserName: "benchmark", Role: models.Standard}
+
+		if createErr := userStorage.Create(user); createErr != nil {
+			b.Fatal(createErr)
+		}
+
+		diaryEntries := make([]*models.DiaryEntry, 0, benchmarkSeedEntriesPerUser)
+		for entryIndex := 0; entryIndex < benchmarkSeedEntriesPerUser; entryIndex++ {
+			diaryEntries = append(diaryEntries, &models.DiaryEntry{
+				Title:        "title",
+				Content:      "content",
+				Registration: models.ActivityRegistration{RegistrationDate: benchmarkSeedFirstDate + int64(entryIndex)*benchmarkSeedEntriesInterval, UserRefer: user.Id},
+			})
+		}
+
+		if createErr := diaryEntryStorage.CreateMany(diaryEntries); createErr != nil {
+			b.Fatal(createErr)
+		}
+
+		userIds = append(userIds, user.Id)
+	}
+
+	return userIds
+}
+
+func BenchmarkDiaryEntryDateRangeQuery(b *testing.B) {
+	userIds := seedDiaryEntries(b)
+	endDate := benchmarkSeedFirstDate + 50*benchmarkSeedEntriesInterval
+
+	runQuery := func(query string) func(b *testing.B) {
+		return func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				rows, queryErr := database.GetDatabaseInstance().GetConnection().Query(query, userIds[i%len(userIds)], benchmarkSeedFirstDate, endDate)
+
+				if queryErr != nil {
+					b.Fatal(queryErr)
+				}
+				for rows.Next() {
+				}
+				rows.Close()
+			}
+		}
+	}
+
+	b.Run("with_index", runQuery(getIntervalUserDiaryEntriesQuery))
+	// The same query, with the planner kept from using the indexes of the activity registrations
+	b.Run("without_index", runQuery(strings.Replace(getIntervalUserDiaryEntriesQuery, "activity_registration ar", "activity_registration ar NOT INDEXED", 1)))
+}
@@ -10,11 +10,12 @@ import (
 const (
 	getExternalLoginQuery         = "SELECT * FROM external_login where id = ?;"
 	getExternalLoginByClientQuery = "SELECT * FROM external_login where provider_client_id = ?;"
+	getUserExternalLoginsQuery    = "SELECT * FROM external_login where user_id = ?;"
 	insertExternalLoginQuery      = "INSERT INTO external_login (provider, provider_client_id, provider_client_token" +
 		", user_id) VALUES (?, ?, ?, ?);"
 	updateExternalLoginQuery = "UPDATE external_login SET provider = ?, provider_client_id = ?" +
 		", user_id = ? WHERE id = ?;"
-	updateUserExternalLoginQuery = "UPDATE external_login SET provider_client_token = ? WHERE user_id = ?;"
+	updateUserExternalLoginQuery = "UPDATE external_login SET provider_client_token = ? WHERE user_id = ? AND provider = ?;"
 	deleteExternalLoginQuery     = "DELETE FROM external_login WHERE id = ?;"
 )
 
@@ -22,6 +23,7 @@ const (
 type ExternalLoginStorageInterface interface {
 	Get(id uint) (interface{}, error)
 	GetByClientId(clientId string) (interface{}, error)
+	GetByUserId(userId uint) (interface{}, error)
 	Create(data interface{}) error
 	Update(data interface{}) error
 	UpdateUserExternalLoginToken(data interface{}) error
@@ -30,6 +32,8 @@ type ExternalLoginStorageInterface interface {
 
 type ExternalLoginStorage struct{}
 
+var _ ExternalLoginStorageInterface = (*ExternalLoginStorage)(nil)
+
 var externalLoginNotFoundError = &models.DbNotFoundError{DbItem: &models.ExternalLogin{}}
 var failedToParseExternalLoginError = &models.DbCouldNotParseItemError{DbItem: &models.ExternalLogin{}}
 
@@ -89,6 +93,35 @@ func (externalLoginStorage *ExternalLoginStorage) GetByClientId(clientId string)
 	return externalLogin, nil
 }
 
+func (externalLoginStorage *ExternalLoginStorage) GetByUserId(userId uint) (interface{}, error) {
+	userExternalLogins := []*models.ExternalLogin{}
+	result, err := database.GetDatabaseInstance().GetConnection().Query(getUserExternalLoginsQuery, userId)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer result.Close()
+
+	for result.Next() {
+		scannedExternalLogin, scanErr := externalLoginStorage.Scan(result)
+
+		if scanErr != nil {
+			return nil, scanErr
+		}
+
+		externalLogin, ok := scannedExternalLogin.(*models.ExternalLogin)
+
+		if !ok {
+			return nil, failedToParseExternalLoginError
+		}
+
+		userExternalLogins = append(userExternalLogins, externalLogin)
+	}
+
+	return userExternalLogins, nil
+}
+
 func (externalLoginStorage *ExternalLoginStorage) Create(externalLogin interface{}) error {
 	dbExternalLogin, ok := externalLogin.(*models.ExternalLogin)
 
@@ -147,7 +180,7 @@ func (externalLoginStorage *ExternalLoginStorage) UpdateUserExternalLoginToken(e
 	}
 
 	result, err := database.GetDatabaseInstance().GetConnection().Exec(updateUserExternalLoginQuery, dbExternalLogin.ClientToken,
-		dbExternalLogin.UserRefer)
+		dbExternalLogin.UserRefer, dbExternalLogin.Provider)
 
 	if err != nil {
 		return err
@@ -8,23 +8,30 @@ import (
 )
 
 const (
-	getGameActivityRegistrationByIdentifierQuery    = "SELECT arg.id, arb.game_name, ar.id, ar.registration_date, ar.user_id FROM activity_registration_game arg INNER JOIN activity_registration ar ON (arg.registration_id = ar.id) WHERE arg.id = ?;"
-	getUserGameActivityRegistrationsQuery           = "SELECT arg.id, arg.game_name, ar.id, ar.registration_date, ar.user_id FROM activity_registration_game arg INNER JOIN activity_registration ar ON (arg.registration_id = ar.id) WHERE ar.user_id = ?;"
-	getUserGameActivityRegistrationsByIntervalQuery = "SELECT arg.id, arg.game_name, ar.id, ar.registration_date, ar.user_id FROM activity_registration_game arg INNER JOIN activity_registration ar ON (arg.registration_id = ar.id) WHERE ar.user_id = ? AND ar.registration_date >= ? AND ar.registration_date <= ?;"
-	insertGameActivityRegistrationQuery             = "INSERT INTO activity_registration_game (game_name, registration_id) VALUES (?, ?);"
-	updateGameActivityRegistrationQuery             = "UPDATE activity_registration_game SET game_name = ? WHERE id = ?;"
-	deleteGameActivityRegistrationQuery             = "DELETE FROM activity_registration_game WHERE id = ?;"
+	getGameActivityRegistrationByIdentifierQuery          = "SELECT arg.id, arg.game_name, ar.id, ar.registration_date, ar.user_id, COALESCE(ar.platform, '') FROM activity_registration_game arg INNER JOIN activity_registration ar ON (arg.registration_id = ar.id) WHERE arg.id = ?;"
+	getUserGameActivityRegistrationsQuery                 = "SELECT arg.id, arg.game_name, ar.id, ar.registration_date, ar.user_id, COALESCE(ar.platform, '') FROM activity_registration_game arg INNER JOIN activity_registration ar ON (arg.registration_id = ar.id) WHERE ar.user_id = ? ORDER BY ar.registration_date DESC, arg.id DESC;"
+	getUserGameActivityRegistrationsByIntervalQuery       = "SELECT arg.id, arg.game_name, ar.id, ar.registration_date, ar.user_id, COALESCE(ar.platform, '') FROM activity_registration_game arg INNER JOIN activity_registration ar ON (arg.registration_id = ar.id) WHERE ar.user_id = ? AND ar.registration_date >= ? AND ar.registration_date <= ? ORDER BY ar.registration_date DESC, arg.id DESC;"
+	getUserGameActivityRegistrationByNameAndIntervalQuery = "SELECT arg.id, arg.game_name, ar.id, ar.registration_date, ar.user_id, COALESCE(ar.platform, '') FROM activity_registration_game arg INNER JOIN activity_registration ar ON (arg.registration_id = ar.id) WHERE ar.user_id = ? AND arg.game_name = ? AND ar.registration_date >= ? AND ar.registration_date <= ? LIMIT 1;"
+	insertGameActivityRegistrationQuery                   = "INSERT INTO activity_registration_game (game_name, registration_id) VALUES (?, ?);"
+	updateGameActivityRegistrationQuery                   = "UPDATE activity_registration_game SET game_name = ? WHERE id = ?;"
+	deleteGameActivityRegistrationQuery                   = "DELETE FROM activity_registration_game WHERE id = ?;"
 )
 
 type GameActivityRegistrationStorageInterface interface {
+	Get(id uint) (interface{}, error)
 	GetByUserId(userId uint) (interface{}, error)
 	GetByUserIdAndInterval(userId uint, startDate int64, endDate int64) (interface{}, error)
+	GetByUserIdGameNameAndInterval(userId uint, gameName string, startDate int64, endDate int64) (interface{}, error)
 	Create(data interface{}) error
+	Update(data interface{}) error
 }
 
 type GameActivityRegistrationStorage struct{}
 
+var _ GameActivityRegistrationStorageInterface = (*GameActivityRegistrationStorage)(nil)
+
 var gameActivityRegistrationNotFoundError = &models.DbNotFoundError{DbItem: &models.GameActivityRegistration{}}
+var gameActivityRegistrationAlreadyExistsError = &models.DbItemAlreadyExistsError{DbItem: &models.GameActivityRegistration{}}
 var failedToParseGameActivityRegistrationError = &models.DbCouldNotParseItemError{DbItem: &models.GameActivityRegistration{}}
 
 func (gameActivityRegistrationStorage *GameActivityRegistrationStorage) Get(id uint) (interface{}, error) {
@@ -119,6 +126,35 @@ func (gameActivityRegistrationStorage *GameActivityRegistrationStorage) GetByUse
 	return userGameActivityRegistrations, nil
 }
 
+// Gets the first registration of the given game made by the user within the given interval.
+func (gameActivityRegistrationStorage *GameActivityRegistrationStorage) GetByUserIdGameNameAndInterval(userId uint, gameName string, startDate int64, endDate int64) (interface{}, error) {
+	result, err := database.GetDatabaseInstance().GetConnection().Query(getUserGameActivityRegistrationByNameAndIntervalQuery, userId, gameName, startDate, endDate)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer result.Close()
+
+	if !result.Next() {
+		return nil, gameActivityRegistrationNotFoundError
+	}
+
+	scannedGameActivityRegistration, scanErr := gameActivityRegistrationStorage.Scan(result)
+
+	if scanErr != nil {
+		return nil, scanErr
+	}
+
+	gameActivityRegistration, ok := scannedGameActivityRegistration.(models.GameActivityRegistration)
+
+	if !ok {
+		return nil, failedToParseGameActivityRegistrationError
+	}
+
+	return &gameActivityRegistration, nil
+}
+
 func (gameActivityRegistrationStorage *GameActivityRegistrationStorage) Create(gameRegistration interface{}) error {
 	dbGameRegistration, ok := gameRegistration.(*models.GameActivityRegistration)
 
@@ -130,6 +166,10 @@ func (gameActivityRegistrationStorage *GameActivityRegistrationStorage) Create(g
 		dbGameRegistration.GameName,
 		dbGameRegistration.Registration.Id)
 
+	if isUniqueConstraintError(err) {
+		return gameActivityRegistrationAlreadyExistsError
+	}
+
 	if err != nil {
 		return err
 	}
@@ -151,7 +191,7 @@ func (gameActivityRegistrationStorage *GameActivityRegistrationStorage) Update(g
 		return failedToParseGameActivityRegistrationError
 	}
 
-	result, err := database.GetDatabaseInstance().GetConnection().Exec(updateDiaryEntryQuery,
+	result, err := database.GetDatabaseInstance().GetConnection().Exec(updateGameActivityRegistrationQuery,
 		dbGameRegistration.GameName,
 		dbGameRegistration.Id)
 
@@ -196,7 +236,8 @@ func (gameActivityRegistrationStorage *GameActivityRegistrationStorage) Scan(row
 	var gameActivityRegistration models.GameActivityRegistration
 
 	scanErr := rows.Scan(&gameActivityRegistration.Id, &gameActivityRegistration.GameName, &gameActivityRegistration.Registration.Id,
-		&gameActivityRegistration.Registration.RegistrationDate, &gameActivityRegistration.Registration.UserRefer)
+		&gameActivityRegistration.Registration.RegistrationDate, &gameActivityRegistration.Registration.UserRefer,
+		&gameActivityRegistration.Registration.Platform)
 
 	return gameActivityRegistration, scanErr
 }
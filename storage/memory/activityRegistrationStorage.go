@@ -0,0 +1,189 @@
+package memory
+
+import (
+	"sort"
+	"time"
+
+	"github.com/adfer-dev/analock-api/models"
+	"github.com/adfer-dev/analock-api/storage"
+	"github.com/adfer-dev/analock-api/utils"
+)
+
+// ActivityRegistrationStorage is an in-memory implementation of storage.ActivityRegistrationStorageInterface.
+type ActivityRegistrationStorage struct {
+	database *Database
+}
+
+var _ storage.ActivityRegistrationStorageInterface = (*ActivityRegistrationStorage)(nil)
+
+// Creates an activity registration storage backed by the given in-memory database.
+func NewActivityRegistrationStorage(database *Database) *ActivityRegistrationStorage {
+	return &ActivityRegistrationStorage{database: database}
+}
+
+var activityRegistrationNotFoundError = &models.DbNotFoundError{DbItem: &models.ActivityRegistration{}}
+var failedToParseActivityRegistrationError = &models.DbCouldNotParseItemError{DbItem: &models.ActivityRegistration{}}
+
+func (activityRegistrationStorage *ActivityRegistrationStorage) Create(activityRegistration interface{}) error {
+	dbActivityRegistration, ok := activityRegistration.(*models.ActivityRegistration)
+
+	if !ok {
+		return failedToParseActivityRegistrationError
+	}
+
+	activityRegistrationStorage.database.lock.Lock()
+	defer activityRegistrationStorage.database.lock.Unlock()
+
+	dbActivityRegistration.Id = activityRegistrationStorage.database.nextId()
+	activityRegistrationStorage.database.activityRegistrations[dbActivityRegistration.Id] = *dbActivityRegistration
+
+	return nil
+}
+
+// Updates the registration date of the activity registration.
+func (activityRegistrationStorage *ActivityRegistrationStorage) Update(activityRegistration interface{}) error {
+	dbActivityRegistration, ok := activityRegistration.(*models.ActivityRegistration)
+
+	if !ok {
+		return failedToParseActivityRegistrationError
+	}
+
+	activityRegistrationStorage.database.lock.Lock()
+	defer activityRegistrationStorage.database.lock.Unlock()
+
+	storedRegistration, exists := activityRegistrationStorage.database.activityRegistrations[dbActivityRegistration.Id]
+
+	if !exists {
+		return activityRegistrationNotFoundError
+	}
+
+	storedRegistration.RegistrationDate = dbActivityRegistration.RegistrationDate
+	activityRegistrationStorage.database.activityRegistrations[dbActivityRegistration.Id] = storedRegistration
+
+	return nil
+}
+
+// Deletes the activity registration and, as the database cascades, the rows referencing it.
+func (activityRegistrationStorage *ActivityRegistrationStorage) Delete(id uint) error {
+	activityRegistrationStorage.database.lock.Lock()
+	defer activityRegistrationStorage.database.lock.Unlock()
+
+	if _, exists := activityRegistrationStorage.database.activityRegistrations[id]; !exists {
+		return activityRegistrationNotFoundError
+	}
+
+	activityRegistrationStorage.database.deleteActivityRegistration(id)
+
+	return nil
+}
+
+// Deletes the activity registrations no diary entry, book or game registration references, returning how many were deleted.
+func (activityRegistrationStorage *ActivityRegistrationStorage) DeleteOrphans() (int64, error) {
+	activityRegistrationStorage.database.lock.Lock()
+	defer activityRegistrationStorage.database.lock.Unlock()
+
+	var deleted int64
+
+	for id := range activityRegistrationStorage.database.activityRegistrations {
+		if !activityRegistrationStorage.database.isActivityRegistrationReferenced(id) {
+			delete(activityRegistrationStorage.database.activityRegistrations, id)
+			deleted++
+		}
+	}
+
+	return deleted, nil
+}
+
+// Counts the activity registrations of a user within the given interval, by the start of the calendar day they belong to
+// in the given location, in Unix seconds.
+func (activityRegistrationStorage *ActivityRegistrationStorage) CountByDay(userId uint, startTime int64, endTime int64, location *time.Location) (map[int64]int64, error) {
+	activityRegistrationStorage.database.lock.RLock()
+	defer activityRegistrationStorage.database.lock.RUnlock()
+
+	dayCounts := make(map[int64]int64)
+
+	for _, registration := range activityRegistrationStorage.database.activityRegistrations {
+		if isRegistrationInInterval(registration, userId, startTime, endTime) {
+			dayStart, _ := utils.LocationDayBounds(registration.RegistrationDate, location)
+			dayCounts[dayStart]++
+		}
+	}
+
+	return dayCounts, nil
+}
+
+// Lists the book and game registrations of a user together, sorted by registration date.
+func (activityRegistrationStorage *ActivityRegistrationStorage) GetFeed(filter *models.ActivityFeedFilter) (interface{}, error) {
+	feedItems := activityRegistrationStorage.feed(filter)
+
+	sort.Slice(feedItems, func(i, j int) bool {
+		first, second := feedItems[i].Registration, feedItems[j].Registration
+
+		if filter.Descending {
+			first, second = second, first
+		}
+
+		if first.RegistrationDate != second.RegistrationDate {
+			return first.RegistrationDate < second.RegistrationDate
+		}
+
+		return first.Id < second.Id
+	})
+
+	if filter.Offset >= len(feedItems) {
+		return []*models.ActivityFeedItem{}, nil
+	}
+
+	feedItems = feedItems[filter.Offset:]
+
+	if filter.Limit < len(feedItems) {
+		feedItems = feedItems[:filter.Limit]
+	}
+
+	return feedItems, nil
+}
+
+// Counts the book and game registrations of a user matching the given filter, ignoring its limit and offset.
+func (activityRegistrationStorage *ActivityRegistrationStorage) CountFeed(filter *models.ActivityFeedFilter) (int64, error) {
+	return int64(len(activityRegistrationStorage.feed(filter))), nil
+}
+
+// Gets the book and game registrations of the user matching the type of the given filter, unsorted.
+func (activityRegistrationStorage *ActivityRegistrationStorage) feed(filter *models.ActivityFeedFilter) []*models.ActivityFeedItem {
+	activityRegistrationStorage.database.lock.RLock()
+	defer activityRegistrationStorage.database.lock.RUnlock()
+
+	feedItems := []*models.ActivityFeedItem{}
+
+	if filter.Type == "" || filter.Type == models.BookActivityFeedItem {
+		for _, bookRegistration := range activityRegistrationStorage.database.bookActivityRegistrations {
+			registration, exists := activityRegistrationStorage.database.activityRegistrations[bookRegistration.registrationId]
+
+			if exists && registration.UserRefer == filter.UserId {
+				feedItems = append(feedItems, &models.ActivityFeedItem{
+					Type:                      models.BookActivityFeedItem,
+					Id:                        bookRegistration.id,
+					Registration:              registration,
+					InternetArchiveIdentifier: bookRegistration.internetArchiveId,
+				})
+			}
+		}
+	}
+
+	if filter.Type == "" || filter.Type == models.GameActivityFeedItem {
+		for _, gameRegistration := range activityRegistrationStorage.database.gameActivityRegistrations {
+			registration, exists := activityRegistrationStorage.database.activityRegistrations[gameRegistration.registrationId]
+
+			if exists && registration.UserRefer == filter.UserId {
+				feedItems = append(feedItems, &models.ActivityFeedItem{
+					Type:         models.GameActivityFeedItem,
+					Id:           gameRegistration.id,
+					Registration: registration,
+					GameName:     gameRegistration.gameName,
+				})
+			}
+		}
+	}
+
+	return feedItems
+}
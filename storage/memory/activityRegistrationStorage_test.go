@@ -0,0 +1,137 @@
+package memory
+
+import (
+	"testing"
+	"time"
+
+	"github.com/adfer-dev/analock-api/constants"
+	"github.com/adfer-dev/analock-api/models"
+	"github.com/adfer-dev/analock-api/storage"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestActivityRegistrationStorageDeleteOrphans(t *testing.T) {
+	t.Parallel()
+
+	database := NewDatabase()
+	var activityRegistrationStorage storage.ActivityRegistrationStorageInterface = NewActivityRegistrationStorage(database)
+	var bookRegistrationStorage storage.BookActivityRegistrationStorageInterface = NewBookActivityRegistrationStorage(database)
+	var gameRegistrationStorage storage.GameActivityRegistrationStorageInterface = NewGameActivityRegistrationStorage(database)
+
+	bookRegistration := &models.BookActivityRegistration{InternetArchiveIdentifier: "book", Registration: models.ActivityRegistration{RegistrationDate: 100, UserRefer: 1}}
+	gameRegistration := &models.GameActivityRegistration{GameName: "sudoku", Registration: models.ActivityRegistration{RegistrationDate: 100, UserRefer: 1}}
+	orphanRegistration := &models.ActivityRegistration{RegistrationDate: 100, UserRefer: 1}
+
+	assert.NoError(t, activityRegistrationStorage.Create(&bookRegistration.Registration))
+	assert.NoError(t, bookRegistrationStorage.Create(bookRegistration))
+	assert.NoError(t, activityRegistrationStorage.Create(&gameRegistration.Registration))
+	assert.NoError(t, gameRegistrationStorage.Create(gameRegistration))
+	assert.NoError(t, activityRegistrationStorage.Create(orphanRegistration))
+
+	deleted, err := activityRegistrationStorage.DeleteOrphans()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), deleted)
+	assert.IsType(t, &models.DbNotFoundError{}, activityRegistrationStorage.Delete(orphanRegistration.Id))
+
+	storedBookRegistration, err := bookRegistrationStorage.Get(bookRegistration.Id)
+	assert.NoError(t, err)
+	assert.Equal(t, bookRegistration, storedBookRegistration)
+
+	storedGameRegistration, err := gameRegistrationStorage.GetByUserIdGameNameAndInterval(1, "sudoku", 0, 200)
+	assert.NoError(t, err)
+	assert.Equal(t, gameRegistration, storedGameRegistration)
+
+	_, err = bookRegistrationStorage.GetByUserIdIdentifierAndTimeRange(1, "other", 0, 200)
+	assert.IsType(t, &models.DbNotFoundError{}, err)
+}
+
+func TestActivityRegistrationStorageFeed(t *testing.T) {
+	t.Parallel()
+
+	database := NewDatabase()
+	activityRegistrationStorage := NewActivityRegistrationStorage(database)
+	bookRegistrationStorage := NewBookActivityRegistrationStorage(database)
+	gameRegistrationStorage := NewGameActivityRegistrationStorage(database)
+
+	for _, registrationDate := range []int64{100, 300, 500} {
+		bookRegistration := &models.BookActivityRegistration{InternetArchiveIdentifier: "book", Registration: models.ActivityRegistration{RegistrationDate: registrationDate, UserRefer: 1}}
+		assert.NoError(t, activityRegistrationStorage.Create(&bookRegistration.Registration))
+		assert.NoError(t, bookRegistrationStorage.Create(bookRegistration))
+	}
+
+	for _, registrationDate := range []int64{200, 400} {
+		gameRegistration := &models.GameActivityRegistration{GameName: "sudoku", Registration: models.ActivityRegistration{RegistrationDate: registrationDate, UserRefer: 1}}
+		assert.NoError(t, activityRegistrationStorage.Create(&gameRegistration.Registration))
+		assert.NoError(t, gameRegistrationStorage.Create(gameRegistration))
+	}
+
+	otherUserRegistration := &models.GameActivityRegistration{GameName: "sudoku", Registration: models.ActivityRegistration{RegistrationDate: 250, UserRefer: 2}}
+	assert.NoError(t, activityRegistrationStorage.Create(&otherUserRegistration.Registration))
+	assert.NoError(t, gameRegistrationStorage.Create(otherUserRegistration))
+
+	tests := []struct {
+		name          string
+		filter        *models.ActivityFeedFilter
+		expectedDates []int64
+		expectedTotal int64
+	}{
+		{"Descending first page", &models.ActivityFeedFilter{UserId: 1, Descending: true, Limit: 2}, []int64{500, 400}, 5},
+		{"Descending last page", &models.ActivityFeedFilter{UserId: 1, Descending: true, Limit: 2, Offset: 4}, []int64{100}, 5},
+		{"Ascending middle page", &models.ActivityFeedFilter{UserId: 1, Limit: 2, Offset: 2}, []int64{300, 400}, 5},
+		{"Page past the end", &models.ActivityFeedFilter{UserId: 1, Limit: 2, Offset: 6}, []int64{}, 5},
+		{"Only books", &models.ActivityFeedFilter{UserId: 1, Type: models.BookActivityFeedItem, Limit: 10}, []int64{100, 300, 500}, 3},
+		{"Only games", &models.ActivityFeedFilter{UserId: 1, Type: models.GameActivityFeedItem, Descending: true, Limit: 10}, []int64{400, 200}, 2},
+	}
+
+	for _, testCase := range tests {
+		t.Run(testCase.name, func(t *testing.T) {
+			feed, err := activityRegistrationStorage.GetFeed(testCase.filter)
+			assert.NoError(t, err)
+
+			dates := []int64{}
+
+			for _, feedItem := range feed.([]*models.ActivityFeedItem) {
+				dates = append(dates, feedItem.Registration.RegistrationDate)
+				assert.Equal(t, uint(1), feedItem.Registration.UserRefer)
+
+				if testCase.filter.Type != "" {
+					assert.Equal(t, testCase.filter.Type, feedItem.Type)
+				}
+			}
+
+			assert.Equal(t, testCase.expectedDates, dates)
+
+			total, err := activityRegistrationStorage.CountFeed(testCase.filter)
+			assert.NoError(t, err)
+			assert.Equal(t, testCase.expectedTotal, total)
+		})
+	}
+}
+
+func TestActivityRegistrationStorageCountByDay(t *testing.T) {
+	t.Parallel()
+
+	activityRegistrationStorage := NewActivityRegistrationStorage(NewDatabase())
+
+	for _, registration := range []models.ActivityRegistration{
+		{RegistrationDate: 100, UserRefer: 1},
+		{RegistrationDate: 200, UserRefer: 1},
+		{RegistrationDate: constants.DaySeconds + 100, UserRefer: 1},
+		{RegistrationDate: 2*constants.DaySeconds + 100, UserRefer: 1},
+		{RegistrationDate: 300, UserRefer: 2},
+	} {
+		assert.NoError(t, activityRegistrationStorage.Create(&registration))
+	}
+
+	dayCounts, err := activityRegistrationStorage.CountByDay(1, 0, 2*constants.DaySeconds-1, time.UTC)
+
+	assert.NoError(t, err)
+	assert.Equal(t, map[int64]int64{0: 2, constants.DaySeconds: 1}, dayCounts)
+
+	// Test case: Registrations are counted by the day of the given location
+	newYork, _ := time.LoadLocation("America/New_York")
+	dayCounts, err = activityRegistrationStorage.CountByDay(1, 0, 2*constants.DaySeconds-1, newYork)
+
+	assert.NoError(t, err)
+	assert.Equal(t, map[int64]int64{-19 * 3600: 2, 5 * 3600: 1}, dayCounts)
+}
@@ -0,0 +1,151 @@
+package memory
+
+import (
+	"github.com/adfer-dev/analock-api/models"
+	"github.com/adfer-dev/analock-api/storage"
+)
+
+// BookActivityRegistrationStorage is an in-memory implementation of storage.BookActivityRegistrationStorageInterface.
+type BookActivityRegistrationStorage struct {
+	database *Database
+}
+
+var _ storage.BookActivityRegistrationStorageInterface = (*BookActivityRegistrationStorage)(nil)
+
+// Creates a book activity registration storage backed by the given in-memory database.
+func NewBookActivityRegistrationStorage(database *Database) *BookActivityRegistrationStorage {
+	return &BookActivityRegistrationStorage{database: database}
+}
+
+var bookActivityRegistrationNotFoundError = &models.DbNotFoundError{DbItem: &models.BookActivityRegistration{}}
+var failedToParseBookActivityRegistrationError = &models.DbCouldNotParseItemError{DbItem: &models.BookActivityRegistration{}}
+
+func (bookActivityRegistrationStorage *BookActivityRegistrationStorage) Get(id uint) (interface{}, error) {
+	bookActivityRegistrationStorage.database.lock.RLock()
+	defer bookActivityRegistrationStorage.database.lock.RUnlock()
+
+	bookRegistrationRow, exists := bookActivityRegistrationStorage.database.bookActivityRegistrations[id]
+
+	if !exists {
+		return nil, bookActivityRegistrationNotFoundError
+	}
+
+	bookRegistration, joined := bookActivityRegistrationStorage.join(bookRegistrationRow)
+
+	if !joined {
+		return nil, bookActivityRegistrationNotFoundError
+	}
+
+	return bookRegistration, nil
+}
+
+func (bookActivityRegistrationStorage *BookActivityRegistrationStorage) GetByUserId(userId uint) (interface{}, error) {
+	return bookActivityRegistrationStorage.filter(func(bookRegistration *models.BookActivityRegistration) bool {
+		return bookRegistration.Registration.UserRefer == userId
+	}), nil
+}
+
+func (bookActivityRegistrationStorage *BookActivityRegistrationStorage) GetByUserIdAndTimeRange(userId uint, startTime int64, endTime int64) (interface{}, error) {
+	return bookActivityRegistrationStorage.filter(func(bookRegistration *models.BookActivityRegistration) bool {
+		return isRegistrationInInterval(bookRegistration.Registration, userId, startTime, endTime)
+	}), nil
+}
+
+func (bookActivityRegistrationStorage *BookActivityRegistrationStorage) GetByUserIdIdentifierAndTimeRange(userId uint, internetArchiveId string, startTime int64, endTime int64) (interface{}, error) {
+	bookRegistrations := bookActivityRegistrationStorage.filter(func(bookRegistration *models.BookActivityRegistration) bool {
+		return bookRegistration.InternetArchiveIdentifier == internetArchiveId &&
+			isRegistrationInInterval(bookRegistration.Registration, userId, startTime, endTime)
+	})
+
+	if len(bookRegistrations) == 0 {
+		return nil, bookActivityRegistrationNotFoundError
+	}
+
+	return bookRegistrations[0], nil
+}
+
+// Creates the book registration, referencing its already created activity registration.
+func (bookActivityRegistrationStorage *BookActivityRegistrationStorage) Create(bookRegistration interface{}) error {
+	dbBookRegistration, ok := bookRegistration.(*models.BookActivityRegistration)
+
+	if !ok {
+		return failedToParseBookActivityRegistrationError
+	}
+
+	bookActivityRegistrationStorage.database.lock.Lock()
+	defer bookActivityRegistrationStorage.database.lock.Unlock()
+
+	dbBookRegistration.Id = bookActivityRegistrationStorage.database.nextId()
+	bookActivityRegistrationStorage.database.bookActivityRegistrations[dbBookRegistration.Id] = bookActivityRegistrationRow{
+		id:                dbBookRegistration.Id,
+		internetArchiveId: dbBookRegistration.InternetArchiveIdentifier,
+		registrationId:    dbBookRegistration.Registration.Id,
+	}
+
+	return nil
+}
+
+// Updates the Internet Archive identifier of the book registration.
+func (bookActivityRegistrationStorage *BookActivityRegistrationStorage) Update(bookRegistration interface{}) error {
+	dbBookRegistration, ok := bookRegistration.(*models.BookActivityRegistration)
+
+	if !ok {
+		return failedToParseBookActivityRegistrationError
+	}
+
+	bookActivityRegistrationStorage.database.lock.Lock()
+	defer bookActivityRegistrationStorage.database.lock.Unlock()
+
+	bookRegistrationRow, exists := bookActivityRegistrationStorage.database.bookActivityRegistrations[dbBookRegistration.Id]
+
+	if !exists {
+		return bookActivityRegistrationNotFoundError
+	}
+
+	bookRegistrationRow.internetArchiveId = dbBookRegistration.InternetArchiveIdentifier
+	bookActivityRegistrationStorage.database.bookActivityRegistrations[dbBookRegistration.Id] = bookRegistrationRow
+
+	return nil
+}
+
+// Joins the book registration row with its activity registration.
+// Returns false if the registration does not exist. The caller must hold the lock.
+func (bookActivityRegistrationStorage *BookActivityRegistrationStorage) join(bookRegistrationRow bookActivityRegistrationRow) (*models.BookActivityRegistration, bool) {
+	registration, exists := bookActivityRegistrationStorage.database.activityRegistrations[bookRegistrationRow.registrationId]
+
+	if !exists {
+		return nil, false
+	}
+
+	return &models.BookActivityRegistration{
+		Id:                        bookRegistrationRow.id,
+		Registration:              registration,
+		InternetArchiveIdentifier: bookRegistrationRow.internetArchiveId,
+	}, true
+}
+
+// Gets the book registrations that match the given filter, newest first.
+func (bookActivityRegistrationStorage *BookActivityRegistrationStorage) filter(matches func(bookRegistration *models.BookActivityRegistration) bool) []*models.BookActivityRegistration {
+	bookActivityRegistrationStorage.database.lock.RLock()
+	defer bookActivityRegistrationStorage.database.lock.RUnlock()
+
+	bookRegistrations := []*models.BookActivityRegistration{}
+
+	for _, id := range sortedIds(bookActivityRegistrationStorage.database.bookActivityRegistrations) {
+		bookRegistration, joined := bookActivityRegistrationStorage.join(bookActivityRegistrationStorage.database.bookActivityRegistrations[id])
+
+		if joined && matches(bookRegistration) {
+			bookRegistrations = append(bookRegistrations, bookRegistration)
+		}
+	}
+
+	sortNewestFirst(
+		bookRegistrations,
+		func(bookRegistration *models.BookActivityRegistration) models.ActivityRegistration {
+			return bookRegistration.Registration
+		},
+		func(bookRegistration *models.BookActivityRegistration) uint { return bookRegistration.Id },
+	)
+
+	return bookRegistrations
+}
@@ -0,0 +1,140 @@
+// Package memory provides in-memory implementations of the storage interfaces,
+// meant to be injected into services by tests instead of the database backed ones.
+package memory
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/adfer-dev/analock-api/models"
+)
+
+type diaryEntryRow struct {
+	id             uint
+	title          string
+	content        string
+	registrationId uint
+	updatedAt      int64
+}
+
+type bookActivityRegistrationRow struct {
+	id                uint
+	internetArchiveId string
+	registrationId    uint
+}
+
+type gameActivityRegistrationRow struct {
+	id             uint
+	gameName       string
+	registrationId uint
+}
+
+// Database holds the in-memory tables shared by the storages of this package,
+// so rows referencing an activity registration are joined with it as they are in the database.
+// It is safe for concurrent use.
+type Database struct {
+	lock                      sync.RWMutex
+	lastId                    uint
+	users                     map[uint]models.User
+	activityRegistrations     map[uint]models.ActivityRegistration
+	diaryEntries              map[uint]diaryEntryRow
+	bookActivityRegistrations map[uint]bookActivityRegistrationRow
+	gameActivityRegistrations map[uint]gameActivityRegistrationRow
+}
+
+// Creates an empty in-memory database.
+func NewDatabase() *Database {
+	return &Database{
+		users:                     make(map[uint]models.User),
+		activityRegistrations:     make(map[uint]models.ActivityRegistration),
+		diaryEntries:              make(map[uint]diaryEntryRow),
+		bookActivityRegistrations: make(map[uint]bookActivityRegistrationRow),
+		gameActivityRegistrations: make(map[uint]gameActivityRegistrationRow),
+	}
+}
+
+// Returns a new row identifier. Identifiers are unique across tables.
+// The caller must hold the write lock.
+func (database *Database) nextId() uint {
+	database.lastId++
+	return database.lastId
+}
+
+// Deletes the given activity registration and, as the database cascades, the rows referencing it.
+// The caller must hold the write lock.
+func (database *Database) deleteActivityRegistration(id uint) {
+	delete(database.activityRegistrations, id)
+
+	for entryId, entry := range database.diaryEntries {
+		if entry.registrationId == id {
+			delete(database.diaryEntries, entryId)
+		}
+	}
+
+	for bookRegistrationId, bookRegistration := range database.bookActivityRegistrations {
+		if bookRegistration.registrationId == id {
+			delete(database.bookActivityRegistrations, bookRegistrationId)
+		}
+	}
+
+	for gameRegistrationId, gameRegistration := range database.gameActivityRegistrations {
+		if gameRegistration.registrationId == id {
+			delete(database.gameActivityRegistrations, gameRegistrationId)
+		}
+	}
+}
+
+// Checks whether any diary entry, book or game registration references the given activity registration.
+// The caller must hold the lock.
+func (database *Database) isActivityRegistrationReferenced(id uint) bool {
+	for _, entry := range database.diaryEntries {
+		if entry.registrationId == id {
+			return true
+		}
+	}
+
+	for _, bookRegistration := range database.bookActivityRegistrations {
+		if bookRegistration.registrationId == id {
+			return true
+		}
+	}
+
+	for _, gameRegistration := range database.gameActivityRegistrations {
+		if gameRegistration.registrationId == id {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Checks whether the registration belongs to the given user and falls within the given interval, both ends included.
+func isRegistrationInInterval(registration models.ActivityRegistration, userId uint, startDate int64, endDate int64) bool {
+	return registration.UserRefer == userId && registration.RegistrationDate >= startDate && registration.RegistrationDate <= endDate
+}
+
+// Sorts the given items newest first, by registration date and then by identifier, as the database lists them.
+func sortNewestFirst[Item any](items []Item, registration func(item Item) models.ActivityRegistration, id func(item Item) uint) {
+	sort.Slice(items, func(i, j int) bool {
+		first, second := registration(items[i]), registration(items[j])
+
+		if first.RegistrationDate != second.RegistrationDate {
+			return first.RegistrationDate > second.RegistrationDate
+		}
+
+		return id(items[i]) > id(items[j])
+	})
+}
+
+// Returns the identifiers of the given table sorted, so rows are listed in insertion order as the database does.
+func sortedIds[Row any](table map[uint]Row) []uint {
+	ids := make([]uint, 0, len(table))
+
+	for id := range table {
+		ids = append(ids, id)
+	}
+
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	return ids
+}
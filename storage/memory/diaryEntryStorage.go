@@ -0,0 +1,283 @@
+package memory
+
+import (
+	"github.com/adfer-dev/analock-api/models"
+	"github.com/adfer-dev/analock-api/storage"
+)
+
+// DiaryEntryStorage is an in-memory implementation of storage.DiaryEntryStorageInterface.
+type DiaryEntryStorage struct {
+	database *Database
+}
+
+var _ storage.DiaryEntryStorageInterface = (*DiaryEntryStorage)(nil)
+
+// Creates a diary entry storage backed by the given in-memory database.
+func NewDiaryEntryStorage(database *Database) *DiaryEntryStorage {
+	return &DiaryEntryStorage{database: database}
+}
+
+var diaryEntryNotFoundError = &models.DbNotFoundError{DbItem: &models.DiaryEntry{}}
+var failedToParseDiaryEntryError = &models.DbCouldNotParseItemError{DbItem: &models.DiaryEntry{}}
+
+func (diaryEntryStorage *DiaryEntryStorage) Get(id uint) (interface{}, error) {
+	diaryEntryStorage.database.lock.RLock()
+	defer diaryEntryStorage.database.lock.RUnlock()
+
+	entry, exists := diaryEntryStorage.database.diaryEntries[id]
+
+	if !exists {
+		return nil, diaryEntryNotFoundError
+	}
+
+	diaryEntry, joined := diaryEntryStorage.join(entry)
+
+	if !joined {
+		return nil, diaryEntryNotFoundError
+	}
+
+	return diaryEntry, nil
+}
+
+func (diaryEntryStorage *DiaryEntryStorage) GetByUserId(userId uint) (interface{}, error) {
+	return diaryEntryStorage.filter(func(registration models.ActivityRegistration) bool {
+		return registration.UserRefer == userId
+	}), nil
+}
+
+func (diaryEntryStorage *DiaryEntryStorage) StreamByUserId(userId uint, yield func(diaryEntry *models.DiaryEntry) error) error {
+	diaryEntries := diaryEntryStorage.filter(func(registration models.ActivityRegistration) bool {
+		return registration.UserRefer == userId
+	})
+
+	for _, diaryEntry := range diaryEntries {
+		if yieldErr := yield(diaryEntry); yieldErr != nil {
+			return yieldErr
+		}
+	}
+
+	return nil
+}
+
+func (diaryEntryStorage *DiaryEntryStorage) GetByUserIdAndDateInterval(userId uint, startDate int64, endDate int64) (interface{}, error) {
+	return diaryEntryStorage.filter(func(registration models.ActivityRegistration) bool {
+		return isRegistrationInInterval(registration, userId, startDate, endDate)
+	}), nil
+}
+
+func (diaryEntryStorage *DiaryEntryStorage) GetByUserIdAndDateIntervals(userId uint, intervals []storage.DateInterval) (interface{}, error) {
+	return diaryEntryStorage.filter(func(registration models.ActivityRegistration) bool {
+		for _, interval := range intervals {
+			if isRegistrationInInterval(registration, userId, interval.StartDate, interval.EndDate) {
+				return true
+			}
+		}
+
+		return false
+	}), nil
+}
+
+func (diaryEntryStorage *DiaryEntryStorage) GetSummariesByUserId(userId uint, previewLength int) (interface{}, error) {
+	return buildSummaries(diaryEntryStorage.filter(func(registration models.ActivityRegistration) bool {
+		return registration.UserRefer == userId
+	}), previewLength), nil
+}
+
+func (diaryEntryStorage *DiaryEntryStorage) GetSummariesByUserIdAndDateInterval(userId uint, startDate int64, endDate int64, previewLength int) (interface{}, error) {
+	return buildSummaries(diaryEntryStorage.filter(func(registration models.ActivityRegistration) bool {
+		return isRegistrationInInterval(registration, userId, startDate, endDate)
+	}), previewLength), nil
+}
+
+func (diaryEntryStorage *DiaryEntryStorage) CountByUserId(userId uint) (int64, error) {
+	return int64(len(diaryEntryStorage.filter(func(registration models.ActivityRegistration) bool {
+		return registration.UserRefer == userId
+	}))), nil
+}
+
+// Creates the diary entry, referencing its already created activity registration.
+func (diaryEntryStorage *DiaryEntryStorage) Create(diaryEntry interface{}) error {
+	dbDiaryEntry, ok := diaryEntry.(*models.DiaryEntry)
+
+	if !ok {
+		return failedToParseDiaryEntryError
+	}
+
+	diaryEntryStorage.database.lock.Lock()
+	defer diaryEntryStorage.database.lock.Unlock()
+
+	diaryEntryStorage.insert(dbDiaryEntry)
+
+	return nil
+}
+
+// Creates the diary entries along with their activity registrations.
+func (diaryEntryStorage *DiaryEntryStorage) CreateMany(diaryEntries interface{}) error {
+	dbDiaryEntries, ok := diaryEntries.([]*models.DiaryEntry)
+
+	if !ok {
+		return failedToParseDiaryEntryError
+	}
+
+	diaryEntryStorage.database.lock.Lock()
+	defer diaryEntryStorage.database.lock.Unlock()
+
+	for _, dbDiaryEntry := range dbDiaryEntries {
+		dbDiaryEntry.Registration.Id = diaryEntryStorage.database.nextId()
+		diaryEntryStorage.database.activityRegistrations[dbDiaryEntry.Registration.Id] = dbDiaryEntry.Registration
+		diaryEntryStorage.insert(dbDiaryEntry)
+	}
+
+	return nil
+}
+
+// Updates the title, content and update time of the diary entry.
+func (diaryEntryStorage *DiaryEntryStorage) Update(diaryEntry interface{}) error {
+	dbDiaryEntry, ok := diaryEntry.(*models.DiaryEntry)
+
+	if !ok {
+		return failedToParseDiaryEntryError
+	}
+
+	diaryEntryStorage.database.lock.Lock()
+	defer diaryEntryStorage.database.lock.Unlock()
+
+	entry, exists := diaryEntryStorage.database.diaryEntries[dbDiaryEntry.Id]
+
+	if !exists {
+		return diaryEntryNotFoundError
+	}
+
+	entry.title = dbDiaryEntry.Title
+	entry.content = dbDiaryEntry.Content
+	entry.updatedAt = dbDiaryEntry.UpdatedAt
+	diaryEntryStorage.database.diaryEntries[dbDiaryEntry.Id] = entry
+
+	return nil
+}
+
+func (diaryEntryStorage *DiaryEntryStorage) Delete(id uint) error {
+	diaryEntryStorage.database.lock.Lock()
+	defer diaryEntryStorage.database.lock.Unlock()
+
+	if _, exists := diaryEntryStorage.database.diaryEntries[id]; !exists {
+		return diaryEntryNotFoundError
+	}
+
+	delete(diaryEntryStorage.database.diaryEntries, id)
+
+	return nil
+}
+
+// Deletes the diary entries along with their activity registrations.
+// If any of them does not exist, none of the entries are deleted.
+func (diaryEntryStorage *DiaryEntryStorage) DeleteMany(diaryEntries interface{}) error {
+	dbDiaryEntries, ok := diaryEntries.([]*models.DiaryEntry)
+
+	if !ok {
+		return failedToParseDiaryEntryError
+	}
+
+	diaryEntryStorage.database.lock.Lock()
+	defer diaryEntryStorage.database.lock.Unlock()
+
+	entries := make([]diaryEntryRow, 0, len(dbDiaryEntries))
+
+	for _, dbDiaryEntry := range dbDiaryEntries {
+		entry, exists := diaryEntryStorage.database.diaryEntries[dbDiaryEntry.Id]
+
+		if !exists {
+			return diaryEntryNotFoundError
+		}
+
+		entries = append(entries, entry)
+	}
+
+	// Deleting the activity registration also deletes the entry referencing it
+	for _, entry := range entries {
+		diaryEntryStorage.database.deleteActivityRegistration(entry.registrationId)
+	}
+
+	return nil
+}
+
+// Stores the diary entry row, setting its identifier.
+// The caller must hold the write lock.
+func (diaryEntryStorage *DiaryEntryStorage) insert(dbDiaryEntry *models.DiaryEntry) {
+	dbDiaryEntry.Id = diaryEntryStorage.database.nextId()
+	diaryEntryStorage.database.diaryEntries[dbDiaryEntry.Id] = diaryEntryRow{
+		id:             dbDiaryEntry.Id,
+		title:          dbDiaryEntry.Title,
+		content:        dbDiaryEntry.Content,
+		registrationId: dbDiaryEntry.Registration.Id,
+		updatedAt:      dbDiaryEntry.UpdatedAt,
+	}
+}
+
+// Joins the diary entry row with its activity registration.
+// Returns false if the registration does not exist. The caller must hold the lock.
+func (diaryEntryStorage *DiaryEntryStorage) join(entry diaryEntryRow) (*models.DiaryEntry, bool) {
+	registration, exists := diaryEntryStorage.database.activityRegistrations[entry.registrationId]
+
+	if !exists {
+		return nil, false
+	}
+
+	return &models.DiaryEntry{
+		Id:      entry.id,
+		Title:   entry.title,
+		Content: entry.content,
+		Registration: models.ActivityRegistration{
+			Id:               registration.Id,
+			RegistrationDate: registration.RegistrationDate,
+			UserRefer:        registration.UserRefer,
+		},
+		UpdatedAt: entry.updatedAt,
+	}, true
+}
+
+// Gets the diary entries whose activity registration matches the given filter, newest first.
+func (diaryEntryStorage *DiaryEntryStorage) filter(matches func(registration models.ActivityRegistration) bool) []*models.DiaryEntry {
+	diaryEntryStorage.database.lock.RLock()
+	defer diaryEntryStorage.database.lock.RUnlock()
+
+	diaryEntries := []*models.DiaryEntry{}
+
+	for _, id := range sortedIds(diaryEntryStorage.database.diaryEntries) {
+		diaryEntry, joined := diaryEntryStorage.join(diaryEntryStorage.database.diaryEntries[id])
+
+		if joined && matches(diaryEntry.Registration) {
+			diaryEntries = append(diaryEntries, diaryEntry)
+		}
+	}
+
+	sortNewestFirst(
+		diaryEntries,
+		func(diaryEntry *models.DiaryEntry) models.ActivityRegistration { return diaryEntry.Registration },
+		func(diaryEntry *models.DiaryEntry) uint { return diaryEntry.Id },
+	)
+
+	return diaryEntries
+}
+
+// Builds the summaries of the given diary entries, previewing at most previewLength characters of their content.
+func buildSummaries(diaryEntries []*models.DiaryEntry, previewLength int) []*models.DiaryEntrySummary {
+	summaries := make([]*models.DiaryEntrySummary, 0, len(diaryEntries))
+
+	for _, diaryEntry := range diaryEntries {
+		preview := []rune(diaryEntry.Content)
+
+		if len(preview) > previewLength {
+			preview = preview[:previewLength]
+		}
+
+		summaries = append(summaries, &models.DiaryEntrySummary{
+			Id:               diaryEntry.Id,
+			Title:            diaryEntry.Title,
+			ContentPreview:   string(preview),
+			RegistrationDate: diaryEntry.Registration.RegistrationDate,
+		})
+	}
+
+	return summaries
+}
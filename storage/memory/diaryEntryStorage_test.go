@@ -0,0 +1,116 @@
+package memory
+
+import (
+	"testing"
+
+	"github.com/adfer-dev/analock-api/models"
+	"github.com/adfer-dev/analock-api/storage"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiaryEntryStorage(t *testing.T) {
+	t.Parallel()
+
+	database := NewDatabase()
+	var activityRegistrationStorage storage.ActivityRegistrationStorageInterface = NewActivityRegistrationStorage(database)
+	var diaryEntryStorage storage.DiaryEntryStorageInterface = NewDiaryEntryStorage(database)
+
+	registration := &models.ActivityRegistration{RegistrationDate: 100, UserRefer: 1}
+	assert.NoError(t, activityRegistrationStorage.Create(registration))
+
+	entry := &models.DiaryEntry{Title: "First", Content: "First content", Registration: *registration}
+	assert.NoError(t, diaryEntryStorage.Create(entry))
+
+	importedEntries := []*models.DiaryEntry{
+		{Title: "Second", Content: "Second content", Registration: models.ActivityRegistration{RegistrationDate: 200, UserRefer: 1}},
+		{Title: "Other", Content: "Other content", Registration: models.ActivityRegistration{RegistrationDate: 200, UserRefer: 2}},
+	}
+	assert.NoError(t, diaryEntryStorage.CreateMany(importedEntries))
+	assert.NotZero(t, importedEntries[0].Id)
+	assert.NotZero(t, importedEntries[0].Registration.Id)
+
+	t.Run("get", func(t *testing.T) {
+		storedEntry, err := diaryEntryStorage.Get(entry.Id)
+		assert.NoError(t, err)
+		assert.Equal(t, entry, storedEntry)
+
+		_, err = diaryEntryStorage.Get(999)
+		assert.IsType(t, &models.DbNotFoundError{}, err)
+	})
+
+	t.Run("get_by_user", func(t *testing.T) {
+		userEntries, err := diaryEntryStorage.GetByUserId(1)
+		assert.NoError(t, err)
+		assert.Equal(t, []*models.DiaryEntry{importedEntries[0], entry}, userEntries)
+
+		intervalEntries, err := diaryEntryStorage.GetByUserIdAndDateInterval(1, 150, 250)
+		assert.NoError(t, err)
+		assert.Equal(t, []*models.DiaryEntry{importedEntries[0]}, intervalEntries)
+
+		intervalsEntries, err := diaryEntryStorage.GetByUserIdAndDateIntervals(1, []storage.DateInterval{{StartDate: 0, EndDate: 150}, {StartDate: 200, EndDate: 200}})
+		assert.NoError(t, err)
+		assert.Equal(t, []*models.DiaryEntry{importedEntries[0], entry}, intervalsEntries)
+
+		count, err := diaryEntryStorage.CountByUserId(1)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(2), count)
+	})
+
+	t.Run("summaries", func(t *testing.T) {
+		summaries, err := diaryEntryStorage.GetSummariesByUserIdAndDateInterval(1, 0, 150, 5)
+		assert.NoError(t, err)
+		assert.Equal(t, []*models.DiaryEntrySummary{{Id: entry.Id, Title: "First", ContentPreview: "First", RegistrationDate: 100}}, summaries)
+	})
+}
+
+func TestDiaryEntryStorageUpdateAndDelete(t *testing.T) {
+	t.Parallel()
+
+	database := NewDatabase()
+	activityRegistrationStorage := NewActivityRegistrationStorage(database)
+	diaryEntryStorage := NewDiaryEntryStorage(database)
+
+	entry := &models.DiaryEntry{Title: "Title", Content: "Content", Registration: models.ActivityRegistration{RegistrationDate: 100, UserRefer: 1}}
+	assert.NoError(t, diaryEntryStorage.CreateMany([]*models.DiaryEntry{entry}))
+
+	// Registration updates are seen through the entry, as they are joined
+	assert.NoError(t, activityRegistrationStorage.Update(&models.ActivityRegistration{Id: entry.Registration.Id, RegistrationDate: 300}))
+	assert.NoError(t, diaryEntryStorage.Update(&models.DiaryEntry{Id: entry.Id, Title: "New title", Content: "New content"}))
+
+	storedEntry, err := diaryEntryStorage.Get(entry.Id)
+	assert.NoError(t, err)
+	assert.Equal(t, "New title", storedEntry.(*models.DiaryEntry).Title)
+	assert.Equal(t, int64(300), storedEntry.(*models.DiaryEntry).Registration.RegistrationDate)
+	assert.Equal(t, uint(1), storedEntry.(*models.DiaryEntry).Registration.UserRefer)
+
+	assert.IsType(t, &models.DbNotFoundError{}, diaryEntryStorage.Update(&models.DiaryEntry{Id: 999}))
+
+	// Deleting the registration cascades to the entry
+	assert.NoError(t, activityRegistrationStorage.Delete(entry.Registration.Id))
+	_, err = diaryEntryStorage.Get(entry.Id)
+	assert.IsType(t, &models.DbNotFoundError{}, err)
+	assert.IsType(t, &models.DbNotFoundError{}, diaryEntryStorage.Delete(entry.Id))
+}
+
+func TestDiaryEntryStorageDeleteMany(t *testing.T) {
+	t.Parallel()
+
+	database := NewDatabase()
+	diaryEntryStorage := NewDiaryEntryStorage(database)
+
+	first := &models.DiaryEntry{Title: "First", Registration: models.ActivityRegistration{RegistrationDate: 100, UserRefer: 1}}
+	second := &models.DiaryEntry{Title: "Second", Registration: models.ActivityRegistration{RegistrationDate: 200, UserRefer: 1}}
+	assert.NoError(t, diaryEntryStorage.CreateMany([]*models.DiaryEntry{first, second}))
+
+	// Test case: One of the entries does not exist, so none are deleted
+	assert.IsType(t, &models.DbNotFoundError{}, diaryEntryStorage.DeleteMany([]*models.DiaryEntry{first, {Id: 999}}))
+	_, err := diaryEntryStorage.Get(first.Id)
+	assert.NoError(t, err)
+
+	// Test case: The entries are deleted along with their registrations
+	assert.NoError(t, diaryEntryStorage.DeleteMany([]*models.DiaryEntry{first, second}))
+	userEntries, _ := diaryEntryStorage.GetByUserId(1)
+	assert.Empty(t, userEntries)
+	assert.NotContains(t, database.activityRegistrations, first.Registration.Id)
+	assert.NotContains(t, database.activityRegistrations, second.Registration.Id)
+}
@@ -0,0 +1,151 @@
+package memory
+
+import (
+	"github.com/adfer-dev/analock-api/models"
+	"github.com/adfer-dev/analock-api/storage"
+)
+
+// GameActivityRegistrationStorage is an in-memory implementation of storage.GameActivityRegistrationStorageInterface.
+type GameActivityRegistrationStorage struct {
+	database *Database
+}
+
+var _ storage.GameActivityRegistrationStorageInterface = (*GameActivityRegistrationStorage)(nil)
+
+// Creates a game activity registration storage backed by the given in-memory database.
+func NewGameActivityRegistrationStorage(database *Database) *GameActivityRegistrationStorage {
+	return &GameActivityRegistrationStorage{database: database}
+}
+
+var gameActivityRegistrationNotFoundError = &models.DbNotFoundError{DbItem: &models.GameActivityRegistration{}}
+var failedToParseGameActivityRegistrationError = &models.DbCouldNotParseItemError{DbItem: &models.GameActivityRegistration{}}
+
+func (gameActivityRegistrationStorage *GameActivityRegistrationStorage) Get(id uint) (interface{}, error) {
+	gameActivityRegistrationStorage.database.lock.RLock()
+	defer gameActivityRegistrationStorage.database.lock.RUnlock()
+
+	gameRegistrationRow, exists := gameActivityRegistrationStorage.database.gameActivityRegistrations[id]
+
+	if !exists {
+		return nil, gameActivityRegistrationNotFoundError
+	}
+
+	gameRegistration, joined := gameActivityRegistrationStorage.join(gameRegistrationRow)
+
+	if !joined {
+		return nil, gameActivityRegistrationNotFoundError
+	}
+
+	return gameRegistration, nil
+}
+
+func (gameActivityRegistrationStorage *GameActivityRegistrationStorage) GetByUserId(userId uint) (interface{}, error) {
+	return gameActivityRegistrationStorage.filter(func(gameRegistration *models.GameActivityRegistration) bool {
+		return gameRegistration.Registration.UserRefer == userId
+	}), nil
+}
+
+func (gameActivityRegistrationStorage *GameActivityRegistrationStorage) GetByUserIdAndInterval(userId uint, startDate int64, endDate int64) (interface{}, error) {
+	return gameActivityRegistrationStorage.filter(func(gameRegistration *models.GameActivityRegistration) bool {
+		return isRegistrationInInterval(gameRegistration.Registration, userId, startDate, endDate)
+	}), nil
+}
+
+func (gameActivityRegistrationStorage *GameActivityRegistrationStorage) GetByUserIdGameNameAndInterval(userId uint, gameName string, startDate int64, endDate int64) (interface{}, error) {
+	gameRegistrations := gameActivityRegistrationStorage.filter(func(gameRegistration *models.GameActivityRegistration) bool {
+		return gameRegistration.GameName == gameName &&
+			isRegistrationInInterval(gameRegistration.Registration, userId, startDate, endDate)
+	})
+
+	if len(gameRegistrations) == 0 {
+		return nil, gameActivityRegistrationNotFoundError
+	}
+
+	return gameRegistrations[0], nil
+}
+
+// Creates the game registration, referencing its already created activity registration.
+func (gameActivityRegistrationStorage *GameActivityRegistrationStorage) Create(gameRegistration interface{}) error {
+	dbGameRegistration, ok := gameRegistration.(*models.GameActivityRegistration)
+
+	if !ok {
+		return failedToParseGameActivityRegistrationError
+	}
+
+	gameActivityRegistrationStorage.database.lock.Lock()
+	defer gameActivityRegistrationStorage.database.lock.Unlock()
+
+	dbGameRegistration.Id = gameActivityRegistrationStorage.database.nextId()
+	gameActivityRegistrationStorage.database.gameActivityRegistrations[dbGameRegistration.Id] = gameActivityRegistrationRow{
+		id:             dbGameRegistration.Id,
+		gameName:       dbGameRegistration.GameName,
+		registrationId: dbGameRegistration.Registration.Id,
+	}
+
+	return nil
+}
+
+// Updates the game name of the game registration.
+func (gameActivityRegistrationStorage *GameActivityRegistrationStorage) Update(gameRegistration interface{}) error {
+	dbGameRegistration, ok := gameRegistration.(*models.GameActivityRegistration)
+
+	if !ok {
+		return failedToParseGameActivityRegistrationError
+	}
+
+	gameActivityRegistrationStorage.database.lock.Lock()
+	defer gameActivityRegistrationStorage.database.lock.Unlock()
+
+	gameRegistrationRow, exists := gameActivityRegistrationStorage.database.gameActivityRegistrations[dbGameRegistration.Id]
+
+	if !exists {
+		return gameActivityRegistrationNotFoundError
+	}
+
+	gameRegistrationRow.gameName = dbGameRegistration.GameName
+	gameActivityRegistrationStorage.database.gameActivityRegistrations[dbGameRegistration.Id] = gameRegistrationRow
+
+	return nil
+}
+
+// Joins the game registration row with its activity registration.
+// Returns false if the registration does not exist. The caller must hold the lock.
+func (gameActivityRegistrationStorage *GameActivityRegistrationStorage) join(gameRegistrationRow gameActivityRegistrationRow) (*models.GameActivityRegistration, bool) {
+	registration, exists := gameActivityRegistrationStorage.database.activityRegistrations[gameRegistrationRow.registrationId]
+
+	if !exists {
+		return nil, false
+	}
+
+	return &models.GameActivityRegistration{
+		Id:           gameRegistrationRow.id,
+		Registration: registration,
+		GameName:     gameRegistrationRow.gameName,
+	}, true
+}
+
+// Gets the game registrations that match the given filter, newest first.
+func (gameActivityRegistrationStorage *GameActivityRegistrationStorage) filter(matches func(gameRegistration *models.GameActivityRegistration) bool) []*models.GameActivityRegistration {
+	gameActivityRegistrationStorage.database.lock.RLock()
+	defer gameActivityRegistrationStorage.database.lock.RUnlock()
+
+	gameRegistrations := []*models.GameActivityRegistration{}
+
+	for _, id := range sortedIds(gameActivityRegistrationStorage.database.gameActivityRegistrations) {
+		gameRegistration, joined := gameActivityRegistrationStorage.join(gameActivityRegistrationStorage.database.gameActivityRegistrations[id])
+
+		if joined && matches(gameRegistration) {
+			gameRegistrations = append(gameRegistrations, gameRegistration)
+		}
+	}
+
+	sortNewestFirst(
+		gameRegistrations,
+		func(gameRegistration *models.GameActivityRegistration) models.ActivityRegistration {
+			return gameRegistration.Registration
+		},
+		func(gameRegistration *models.GameActivityRegistration) uint { return gameRegistration.Id },
+	)
+
+	return gameRegistrations
+}
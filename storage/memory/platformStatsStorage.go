@@ -0,0 +1,38 @@
+package memory
+
+import (
+	"github.com/adfer-dev/analock-api/models"
+	"github.com/adfer-dev/analock-api/storage"
+)
+
+// PlatformStatsStorage is an in-memory implementation of storage.PlatformStatsStorageInterface.
+type PlatformStatsStorage struct {
+	database *Database
+}
+
+var _ storage.PlatformStatsStorageInterface = (*PlatformStatsStorage)(nil)
+
+// Creates a platform stats storage backed by the given in-memory database.
+func NewPlatformStatsStorage(database *Database) *PlatformStatsStorage {
+	return &PlatformStatsStorage{database: database}
+}
+
+func (platformStatsStorage *PlatformStatsStorage) Get(newUsersSince int64) (*models.PlatformStats, error) {
+	platformStatsStorage.database.lock.RLock()
+	defer platformStatsStorage.database.lock.RUnlock()
+
+	stats := &models.PlatformStats{
+		TotalUsers:             int64(len(platformStatsStorage.database.users)),
+		TotalDiaryEntries:      int64(len(platformStatsStorage.database.diaryEntries)),
+		TotalBookRegistrations: int64(len(platformStatsStorage.database.bookActivityRegistrations)),
+		TotalGameRegistrations: int64(len(platformStatsStorage.database.gameActivityRegistrations)),
+	}
+
+	for _, user := range platformStatsStorage.database.users {
+		if user.CreatedAt >= newUsersSince {
+			stats.NewUsers++
+		}
+	}
+
+	return stats, nil
+}
@@ -0,0 +1,180 @@
+package memory
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/adfer-dev/analock-api/models"
+	"github.com/adfer-dev/analock-api/storage"
+)
+
+// UserStorage is an in-memory implementation of storage.UserStorageInterface.
+type UserStorage struct {
+	database *Database
+}
+
+var _ storage.UserStorageInterface = (*UserStorage)(nil)
+
+// Creates a user storage backed by the given in-memory database.
+func NewUserStorage(database *Database) *UserStorage {
+	return &UserStorage{database: database}
+}
+
+var userNotFoundError = &models.DbNotFoundError{DbItem: &models.User{}}
+var failedToParseUserError = &models.DbCouldNotParseItemError{DbItem: &models.User{}}
+
+func (userStorage *UserStorage) Get(id uint) (interface{}, error) {
+	userStorage.database.lock.RLock()
+	defer userStorage.database.lock.RUnlock()
+
+	user, exists := userStorage.database.users[id]
+
+	if !exists {
+		return nil, userNotFoundError
+	}
+
+	return &user, nil
+}
+
+func (userStorage *UserStorage) GetByEmail(email string) (interface{}, error) {
+	userStorage.database.lock.RLock()
+	defer userStorage.database.lock.RUnlock()
+
+	for _, id := range sortedIds(userStorage.database.users) {
+		if user := userStorage.database.users[id]; user.Email == email {
+			return &user, nil
+		}
+	}
+
+	return nil, userNotFoundError
+}
+
+func (userStorage *UserStorage) Create(user interface{}) error {
+	dbUser, ok := user.(*models.User)
+
+	if !ok {
+		return failedToParseUserError
+	}
+
+	userStorage.database.lock.Lock()
+	defer userStorage.database.lock.Unlock()
+
+	for _, storedUser := range userStorage.database.users {
+		if storedUser.Email == dbUser.Email {
+			return &models.DbItemAlreadyExistsError{DbItem: &models.User{}}
+		}
+	}
+
+	dbUser.Id = userStorage.database.nextId()
+	userStorage.database.users[dbUser.Id] = *dbUser
+
+	return nil
+}
+
+func (userStorage *UserStorage) Update(user interface{}) error {
+	dbUser, ok := user.(*models.User)
+
+	if !ok {
+		return failedToParseUserError
+	}
+
+	userStorage.database.lock.Lock()
+	defer userStorage.database.lock.Unlock()
+
+	storedUser, exists := userStorage.database.users[dbUser.Id]
+
+	if !exists {
+		return userNotFoundError
+	}
+
+	storedUser.UserName = dbUser.UserName
+	storedUser.Role = dbUser.Role
+	userStorage.database.users[dbUser.Id] = storedUser
+
+	return nil
+}
+
+func (userStorage *UserStorage) UpdateEmailVerified(id uint, emailVerified bool) error {
+	userStorage.database.lock.Lock()
+	defer userStorage.database.lock.Unlock()
+
+	storedUser, exists := userStorage.database.users[id]
+
+	if !exists {
+		return userNotFoundError
+	}
+
+	storedUser.EmailVerified = emailVerified
+	userStorage.database.users[id] = storedUser
+
+	return nil
+}
+
+// Deletes the user and, as the database cascades, its activity registrations.
+func (userStorage *UserStorage) Delete(id uint) error {
+	userStorage.database.lock.Lock()
+	defer userStorage.database.lock.Unlock()
+
+	if _, exists := userStorage.database.users[id]; !exists {
+		return userNotFoundError
+	}
+
+	delete(userStorage.database.users, id)
+
+	for registrationId, registration := range userStorage.database.activityRegistrations {
+		if registration.UserRefer == id {
+			userStorage.database.deleteActivityRegistration(registrationId)
+		}
+	}
+
+	return nil
+}
+
+// Lists the users matching the given filter, sorted by the given field.
+func (userStorage *UserStorage) List(filter *models.UserListFilter) (interface{}, error) {
+	users := userStorage.filter(filter)
+
+	sort.SliceStable(users, func(i, j int) bool {
+		if filter.SortBy == models.UserSortByEmail {
+			return users[i].Email < users[j].Email
+		}
+
+		return users[i].CreatedAt < users[j].CreatedAt
+	})
+
+	if filter.Offset >= len(users) {
+		return []*models.User{}, nil
+	}
+
+	users = users[filter.Offset:]
+
+	if filter.Limit < len(users) {
+		users = users[:filter.Limit]
+	}
+
+	return users, nil
+}
+
+// Counts the users matching the given filter, ignoring its limit and offset.
+func (userStorage *UserStorage) Count(filter *models.UserListFilter) (int64, error) {
+	return int64(len(userStorage.filter(filter))), nil
+}
+
+// Gets the users matching the role and email of the given filter, in insertion order.
+func (userStorage *UserStorage) filter(filter *models.UserListFilter) []*models.User {
+	userStorage.database.lock.RLock()
+	defer userStorage.database.lock.RUnlock()
+
+	users := []*models.User{}
+
+	for _, id := range sortedIds(userStorage.database.users) {
+		user := userStorage.database.users[id]
+
+		if (filter.Role == 0 || user.Role == filter.Role) &&
+			strings.Contains(strings.ToLower(user.Email), strings.ToLower(filter.EmailContains)) {
+			users = append(users, &user)
+		}
+	}
+
+	return users
+}
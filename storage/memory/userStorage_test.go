@@ -0,0 +1,48 @@
+package memory
+
+import (
+	"testing"
+
+	"github.com/adfer-dev/analock-api/models"
+	"github.com/adfer-dev/analock-api/storage"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUserStorage(t *testing.T) {
+	t.Parallel()
+
+	database := NewDatabase()
+	var userStorage storage.UserStorageInterface = NewUserStorage(database)
+	diaryEntryStorage := NewDiaryEntryStorage(database)
+
+	user := &models.User{Email: "user@example.com", UserName: "user", Role: models.Standard}
+	assert.NoError(t, userStorage.Create(user))
+	assert.NotZero(t, user.Id)
+	assert.IsType(t, &models.DbItemAlreadyExistsError{}, userStorage.Create(&models.User{Email: "user@example.com"}))
+
+	storedUser, err := userStorage.GetByEmail("user@example.com")
+	assert.NoError(t, err)
+	assert.Equal(t, user, storedUser)
+
+	assert.NoError(t, userStorage.Update(&models.User{Id: user.Id, UserName: "renamed", Role: models.Admin}))
+	storedUser, err = userStorage.Get(user.Id)
+	assert.NoError(t, err)
+	assert.Equal(t, &models.User{Id: user.Id, Email: "user@example.com", UserName: "renamed", Role: models.Admin}, storedUser)
+
+	assert.NoError(t, userStorage.UpdateEmailVerified(user.Id, true))
+	storedUser, err = userStorage.Get(user.Id)
+	assert.NoError(t, err)
+	assert.True(t, storedUser.(*models.User).EmailVerified)
+	assert.IsType(t, &models.DbNotFoundError{}, userStorage.UpdateEmailVerified(user.Id+100, true))
+
+	// Deleting the user cascades to its registrations and their rows
+	entry := &models.DiaryEntry{Title: "Title", Content: "Content", Registration: models.ActivityRegistration{RegistrationDate: 100, UserRefer: user.Id}}
+	assert.NoError(t, diaryEntryStorage.CreateMany([]*models.DiaryEntry{entry}))
+	assert.NoError(t, userStorage.Delete(user.Id))
+
+	_, err = userStorage.Get(user.Id)
+	assert.IsType(t, &models.DbNotFoundError{}, err)
+	_, err = diaryEntryStorage.Get(entry.Id)
+	assert.IsType(t, &models.DbNotFoundError{}, err)
+	assert.IsType(t, &models.DbNotFoundError{}, userStorage.Delete(user.Id))
+}
@@ -0,0 +1,37 @@
+package storage
+
+import (
+	"github.com/adfer-dev/analock-api/database"
+	"github.com/adfer-dev/analock-api/models"
+)
+
+const getPlatformStatsQuery = "SELECT " +
+	"(SELECT COUNT(*) FROM user), " +
+	"(SELECT COUNT(*) FROM diary_entry), " +
+	"(SELECT COUNT(*) FROM activity_registration_book), " +
+	"(SELECT COUNT(*) FROM activity_registration_game), " +
+	"(SELECT COUNT(*) FROM user WHERE created_at >= ?);"
+
+// PlatformStatsStorageInterface defines the aggregate queries over the whole platform.
+type PlatformStatsStorageInterface interface {
+	Get(newUsersSince int64) (*models.PlatformStats, error)
+}
+
+type PlatformStatsStorage struct{}
+
+var _ PlatformStatsStorageInterface = (*PlatformStatsStorage)(nil)
+
+// Counts the users, diary entries, book and game registrations, and the users created since the given time.
+func (platformStatsStorage *PlatformStatsStorage) Get(newUsersSince int64) (*models.PlatformStats, error) {
+	var stats models.PlatformStats
+
+	scanErr := database.GetDatabaseInstance().GetConnection().
+		QueryRow(getPlatformStatsQuery, newUsersSince).
+		Scan(&stats.TotalUsers, &stats.TotalDiaryEntries, &stats.TotalBookRegistrations, &stats.TotalGameRegistrations, &stats.NewUsers)
+
+	if scanErr != nil {
+		return nil, scanErr
+	}
+
+	return &stats, nil
+}
@@ -0,0 +1,53 @@
+package storage
+
+import (
+	"testing"
+
+	"github.com/adfer-dev/analock-api/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPlatformStatsStorageGet(t *testing.T) {
+	userStorage := &UserStorage{}
+	activityRegistrationStorage := &ActivityRegistrationStorage{}
+	diaryEntryStorage := &DiaryEntryStorage{}
+	bookRegistrationStorage := &BookActivityRegistrationStorage{}
+	gameRegistrationStorage := &GameActivityRegistrationStorage{}
+	platformStatsStorage := &PlatformStatsStorage{}
+	// Far in the future, so only the users created by this test count as new.
+	newUsersSince := int64(4000000000000)
+
+	// Other tests share the database, so the counts are compared with the ones before creating any row
+	initialStats, err := platformStatsStorage.Get(newUsersSince)
+	assert.NoError(t, err)
+
+	newUser := &models.User{Email: "stats-new@example.com", UserName: "stats-new", Role: models.Standard, CreatedAt: newUsersSince}
+	oldUser := &models.User{Email: "stats-old@example.com", UserName: "stats-old", Role: models.Standard, CreatedAt: newUsersSince - 1}
+	assert.NoError(t, userStorage.Create(newUser))
+	assert.NoError(t, userStorage.Create(oldUser))
+
+	diaryEntry := &models.DiaryEntry{Title: "title", Content: "content", Registration: models.ActivityRegistration{RegistrationDate: 100, UserRefer: newUser.Id}}
+	assert.NoError(t, activityRegistrationStorage.Create(&diaryEntry.Registration))
+	assert.NoError(t, diaryEntryStorage.Create(diaryEntry))
+
+	for _, identifier := range []string{"book-1", "book-2"} {
+		bookRegistration := &models.BookActivityRegistration{InternetArchiveIdentifier: identifier, Registration: models.ActivityRegistration{RegistrationDate: 200, UserRefer: oldUser.Id}}
+		assert.NoError(t, activityRegistrationStorage.Create(&bookRegistration.Registration))
+		assert.NoError(t, bookRegistrationStorage.Create(bookRegistration))
+	}
+
+	gameRegistration := &models.GameActivityRegistration{GameName: "sudoku", Registration: models.ActivityRegistration{RegistrationDate: 300, UserRefer: newUser.Id}}
+	assert.NoError(t, activityRegistrationStorage.Create(&gameRegistration.Registration))
+	assert.NoError(t, gameRegistrationStorage.Create(gameRegistration))
+
+	stats, err := platformStatsStorage.Get(newUsersSince)
+
+	assert.NoError(t, err)
+	assert.Equal(t, &models.PlatformStats{
+		TotalUsers:             initialStats.TotalUsers + 2,
+		TotalDiaryEntries:      initialStats.TotalDiaryEntries + 1,
+		TotalBookRegistrations: initialStats.TotalBookRegistrations + 2,
+		TotalGameRegistrations: initialStats.TotalGameRegistrations + 1,
+		NewUsers:               initialStats.NewUsers + 1,
+	}, stats)
+}
@@ -2,6 +2,7 @@ package storage
 
 import (
 	"database/sql"
+	"strings"
 )
 
 type Storage interface {
@@ -11,3 +12,9 @@ type Storage interface {
 	Delete(uint) error
 	Scan(*sql.Rows) (interface{}, error)
 }
+
+// Checks whether the given error comes from a violation of a unique constraint or index.
+// The libsql driver has no typed errors, so the SQLite message is matched instead.
+func isUniqueConstraintError(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "UNIQUE constraint failed")
+}
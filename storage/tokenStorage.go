@@ -9,11 +9,12 @@ import (
 
 const (
 	getTokenQuery              = "SELECT * FROM token where id = ?;"
-	getTokenByUserQuery        = "SELECT * FROM token where user_id = ?;"
+	getTokenByUserQuery        = "SELECT * FROM token where user_id = ? AND kind IN (?, ?);"
 	getTokenByValueQuery       = "SELECT * FROM token where value = ?;"
 	getTokenByUserAndKindQuery = "SELECT * FROM token where user_id = ? AND kind = ?;"
-	insertTokenQuery           = "INSERT INTO token (value, kind, user_id) VALUES (?, ?, ?);"
-	updateTokenQuery           = "UPDATE token SET value = ?, kind = ? WHERE id = ?;"
+	insertTokenQuery           = "INSERT INTO token (value, kind, user_id, created_at, last_used_at) VALUES (?, ?, ?, ?, ?);"
+	updateTokenQuery           = "UPDATE token SET value = ?, kind = ?, created_at = ?, last_used_at = ? WHERE id = ?;"
+	updateTokenLastUsedAtQuery = "UPDATE token SET last_used_at = ? WHERE id = ?;"
 	deleteTokenQuery           = "DELETE FROM token WHERE id = ?;"
 )
 
@@ -24,11 +25,15 @@ type TokenStorageInterface interface {
 	GetByUserId(userId uint) ([2]*models.Token, error)
 	Create(data interface{}) error
 	Update(data interface{}) error
+	UpdateMany(data interface{}) error
+	UpdateLastUsedAt(id uint, lastUsedAt int64) error
 	Delete(id uint) error
 }
 
 type TokenStorage struct{}
 
+var _ TokenStorageInterface = (*TokenStorage)(nil)
+
 var tokenNotFoundError = &models.DbNotFoundError{DbItem: &models.Token{}}
 var failedToParseTokenError = &models.DbCouldNotParseItemError{DbItem: &models.Token{}}
 
@@ -60,9 +65,10 @@ func (tokenStorage *TokenStorage) Get(id uint) (interface{}, error) {
 	return token, nil
 }
 
+// Gets the access and refresh tokens of the given user.
 func (tokenStorage *TokenStorage) GetByUserId(id uint) ([2]*models.Token, error) {
 	var tokenPair [2]*models.Token
-	result, err := database.GetDatabaseInstance().GetConnection().Query(getTokenByUserQuery, id)
+	result, err := database.GetDatabaseInstance().GetConnection().Query(getTokenByUserQuery, id, models.Access, models.Refresh)
 
 	if err != nil {
 		return tokenPair, err
@@ -163,7 +169,14 @@ func (tokenStorage *TokenStorage) Create(token interface{}) error {
 		return tokenAlreadyExistsError
 	}
 
-	result, err := database.GetDatabaseInstance().GetConnection().Exec(insertTokenQuery, dbToken.TokenValue, dbToken.Kind, dbToken.UserRefer)
+	result, err := database.GetDatabaseInstance().GetConnection().Exec(
+		insertTokenQuery,
+		dbToken.TokenValue,
+		dbToken.Kind,
+		dbToken.UserRefer,
+		dbToken.CreatedAt,
+		dbToken.LastUsedAt,
+	)
 	if err != nil {
 		return err
 	}
@@ -185,7 +198,87 @@ func (tokenStorage *TokenStorage) Update(token interface{}) error {
 		return failedToParseUserError
 	}
 
-	result, err := database.GetDatabaseInstance().GetConnection().Exec(updateTokenQuery, dbToken.TokenValue, dbToken.Kind, dbToken.Id)
+	result, err := database.GetDatabaseInstance().GetConnection().Exec(
+		updateTokenQuery,
+		dbToken.TokenValue,
+		dbToken.Kind,
+		dbToken.CreatedAt,
+		dbToken.LastUsedAt,
+		dbToken.Id,
+	)
+
+	if err != nil {
+		return err
+	}
+
+	affectedRows, errAffectedRows := result.RowsAffected()
+
+	if errAffectedRows != nil {
+		return errAffectedRows
+	}
+
+	if affectedRows == 0 {
+		return tokenNotFoundError
+	}
+
+	return nil
+}
+
+// Updates the given tokens within a single transaction.
+// If any update fails, none of the tokens are updated.
+func (tokenStorage *TokenStorage) UpdateMany(tokens interface{}) error {
+	dbTokens, ok := tokens.([]*models.Token)
+
+	if !ok {
+		return failedToParseTokenError
+	}
+
+	tx, txErr := database.GetDatabaseInstance().GetConnection().Begin()
+
+	if txErr != nil {
+		return txErr
+	}
+
+	for _, dbToken := range dbTokens {
+		if updateErr := updateTokenInTx(tx, dbToken); updateErr != nil {
+			tx.Rollback()
+			return updateErr
+		}
+	}
+
+	return tx.Commit()
+}
+
+func updateTokenInTx(tx *sql.Tx, dbToken *models.Token) error {
+	result, err := tx.Exec(
+		updateTokenQuery,
+		dbToken.TokenValue,
+		dbToken.Kind,
+		dbToken.CreatedAt,
+		dbToken.LastUsedAt,
+		dbToken.Id,
+	)
+
+	if err != nil {
+		return err
+	}
+
+	affectedRows, errAffectedRows := result.RowsAffected()
+
+	if errAffectedRows != nil {
+		return errAffectedRows
+	}
+
+	if affectedRows == 0 {
+		return tokenNotFoundError
+	}
+
+	return nil
+}
+
+// Sets the time the token with the given id was last used at.
+func (tokenStorage *TokenStorage) UpdateLastUsedAt(id uint, lastUsedAt int64) error {
+	result, err := database.GetDatabaseInstance().GetConnection().Exec(updateTokenLastUsedAtQuery, lastUsedAt, id)
 
 	if err != nil {
 		return err
@@ -226,8 +319,11 @@ func (tokenStorage *TokenStorage) Delete(id uint) error {
 
 func (tokenStorage *TokenStorage) Scan(rows *sql.Rows) (interface{}, error) {
 	var token models.Token
+	var createdAt, lastUsedAt sql.NullInt64
 
-	scanErr := rows.Scan(&token.Id, &token.TokenValue, &token.Kind, &token.UserRefer)
+	scanErr := rows.Scan(&token.Id, &token.TokenValue, &token.Kind, &token.UserRefer, &createdAt, &lastUsedAt)
+	token.CreatedAt = createdAt.Int64
+	token.LastUsedAt = lastUsedAt.Int64
 
 	return &token, scanErr
 }
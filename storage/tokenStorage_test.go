@@ -0,0 +1,64 @@
+package storage
+
+import (
+	"testing"
+
+	"github.com/adfer-dev/analock-api/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTokenStorageUpdateManyRollsBack(t *testing.T) {
+	userStorage := &UserStorage{}
+	tokenStorage := &TokenStorage{}
+
+	user := &models.User{Email: "tokens@example.com", UserName: "tokens", Role: models.Standard}
+	assert.NoError(t, userStorage.Create(user))
+
+	accessToken := &models.Token{TokenValue: "access", Kind: models.Access, UserRefer: user.Id}
+	refreshToken := &models.Token{TokenValue: "refresh", Kind: models.Refresh, UserRefer: user.Id}
+	assert.NoError(t, tokenStorage.Create(accessToken))
+	assert.NoError(t, tokenStorage.Create(refreshToken))
+
+	// Test case: The second update fails, so the first one is rolled back
+	updateErr := tokenStorage.UpdateMany([]*models.Token{
+		{Id: accessToken.Id, TokenValue: "new_access", Kind: models.Access, UserRefer: user.Id},
+		{Id: refreshToken.Id + 100, TokenValue: "new_refresh", Kind: models.Refresh, UserRefer: user.Id},
+	})
+
+	assert.ErrorIs(t, updateErr, tokenNotFoundError)
+	storedAccessToken, getErr := tokenStorage.Get(accessToken.Id)
+	assert.NoError(t, getErr)
+	assert.Equal(t, "access", storedAccessToken.(*models.Token).TokenValue)
+
+	// Test case: Both updates succeed
+	assert.NoError(t, tokenStorage.UpdateMany([]*models.Token{
+		{Id: accessToken.Id, TokenValue: "new_access", Kind: models.Access, UserRefer: user.Id},
+		{Id: refreshToken.Id, TokenValue: "new_refresh", Kind: models.Refresh, UserRefer: user.Id},
+	}))
+
+	tokenPair, pairErr := tokenStorage.GetByUserId(user.Id)
+	assert.NoError(t, pairErr)
+	assert.ElementsMatch(t, []string{"new_access", "new_refresh"}, []string{tokenPair[0].TokenValue, tokenPair[1].TokenValue})
+}
+
+func TestTokenStorageUpdateLastUsedAt(t *testing.T) {
+	userStorage := &UserStorage{}
+	tokenStorage := &TokenStorage{}
+
+	user := &models.User{Email: "sessions@example.com", UserName: "sessions", Role: models.Standard}
+	assert.NoError(t, userStorage.Create(user))
+
+	refreshToken := &models.Token{TokenValue: "session_refresh", Kind: models.Refresh, UserRefer: user.Id, CreatedAt: 1000}
+	assert.NoError(t, tokenStorage.Create(refreshToken))
+
+	// Test case: The last use time is stored along with the creation time
+	assert.NoError(t, tokenStorage.UpdateLastUsedAt(refreshToken.Id, 2000))
+
+	storedToken, getErr := tokenStorage.Get(refreshToken.Id)
+	assert.NoError(t, getErr)
+	assert.Equal(t, int64(1000), storedToken.(*models.Token).CreatedAt)
+	assert.Equal(t, int64(2000), storedToken.(*models.Token).LastUsedAt)
+
+	// Test case: The token does not exist
+	assert.ErrorIs(t, tokenStorage.UpdateLastUsedAt(refreshToken.Id+100, 2000), tokenNotFoundError)
+}
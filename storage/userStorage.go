@@ -3,6 +3,7 @@ package storage
 import (
 	"database/sql"
 	"fmt"
+	"strings"
 
 	"github.com/adfer-dev/analock-api/database"
 	"github.com/adfer-dev/analock-api/models"
@@ -10,24 +11,42 @@ import (
 )
 
 const (
-	getUserQuery            = "SELECT * FROM user where id = ?;"
-	getUserByUserEmailQuery = "SELECT * FROM user where email = ?;"
-	insertUserQuery         = "INSERT INTO user (email, username, role) VALUES (?, ?, ?);"
-	updateUserQuery         = "UPDATE user SET username = ?, role = ? WHERE id = ?;"
-	deleteUserQuery         = "DELETE FROM user WHERE id = ?;"
+	getUserQuery                 = "SELECT * FROM user where id = ?;"
+	getUserByUserEmailQuery      = "SELECT * FROM user where email = ?;"
+	insertUserQuery              = "INSERT INTO user (email, username, role, created_at, email_verified) VALUES (?, ?, ?, ?, ?);"
+	updateUserQuery              = "UPDATE user SET username = ?, role = ? WHERE id = ?;"
+	updateUserEmailVerifiedQuery = "UPDATE user SET email_verified = ? WHERE id = ?;"
+	deleteUserQuery              = "DELETE FROM user WHERE id = ?;"
+	userListFilterCondition      = " WHERE (? = 0 OR role = ?) AND email LIKE ? ESCAPE '\\'"
+	listUsersQuery               = "SELECT * FROM user" + userListFilterCondition + " ORDER BY %s, id LIMIT ? OFFSET ?;"
+	countUsersQuery              = "SELECT COUNT(*) FROM user" + userListFilterCondition + ";"
 )
 
+// Columns users can be sorted by, keyed by the field exposed by the API.
+var userSortColumns = map[models.UserSortField]string{
+	models.UserSortByCreatedAt: "created_at",
+	models.UserSortByEmail:     "email",
+}
+
+// Escapes the wildcards of a LIKE pattern.
+var likeEscaper = strings.NewReplacer("\\", "\\\\", "%", "\\%", "_", "\\_")
+
 // UserStorageInterface defines storage operations for users.
 type UserStorageInterface interface {
 	Get(id uint) (interface{}, error)
 	GetByEmail(email string) (interface{}, error)
 	Create(data interface{}) error
 	Update(data interface{}) error
+	UpdateEmailVerified(id uint, emailVerified bool) error
 	Delete(id uint) error
+	List(filter *models.UserListFilter) (interface{}, error)
+	Count(filter *models.UserListFilter) (int64, error)
 }
 
 type UserStorage struct{}
 
+var _ UserStorageInterface = (*UserStorage)(nil)
+
 var userNotFoundError = &models.DbNotFoundError{DbItem: &models.User{}}
 var failedToParseUserError = &models.DbCouldNotParseItemError{DbItem: &models.User{}}
 
@@ -101,7 +120,7 @@ func (userStorage *UserStorage) Create(user interface{}) error {
 		return userAlreadyExistsError
 	}
 
-	result, err := database.GetDatabaseInstance().GetConnection().Exec(insertUserQuery, dbUser.Email, dbUser.UserName, dbUser.Role)
+	result, err := database.GetDatabaseInstance().GetConnection().Exec(insertUserQuery, dbUser.Email, dbUser.UserName, dbUser.Role, dbUser.CreatedAt, dbUser.EmailVerified)
 	if err != nil {
 		utils.GetCustomLogger().Error(fmt.Sprintf("error when saving user: %s", err.Error()))
 		return err
@@ -143,6 +162,27 @@ func (userStorage *UserStorage) Update(user interface{}) error {
 	return nil
 }
 
+// Updates whether the email of the user with the given id is verified.
+func (userStorage *UserStorage) UpdateEmailVerified(id uint, emailVerified bool) error {
+	result, err := database.GetDatabaseInstance().GetConnection().Exec(updateUserEmailVerifiedQuery, emailVerified, id)
+
+	if err != nil {
+		return err
+	}
+
+	affectedRows, errAffectedRows := result.RowsAffected()
+
+	if errAffectedRows != nil {
+		return errAffectedRows
+	}
+
+	if affectedRows == 0 {
+		return userNotFoundError
+	}
+
+	return nil
+}
+
 func (userStorage *UserStorage) Delete(id uint) error {
 
 	result, err := database.GetDatabaseInstance().GetConnection().Exec(deleteUserQuery, id)
@@ -164,10 +204,70 @@ func (userStorage *UserStorage) Delete(id uint) error {
 	return nil
 }
 
+// Lists the users matching the given filter, sorted by the given field.
+func (userStorage *UserStorage) List(filter *models.UserListFilter) (interface{}, error) {
+	sortColumn, ok := userSortColumns[filter.SortBy]
+
+	if !ok {
+		sortColumn = userSortColumns[models.UserSortByCreatedAt]
+	}
+
+	result, err := database.GetDatabaseInstance().GetConnection().Query(
+		fmt.Sprintf(listUsersQuery, sortColumn),
+		append(buildUserListFilterArgs(filter), filter.Limit, filter.Offset)...,
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer result.Close()
+
+	users := []*models.User{}
+
+	for result.Next() {
+		scannedUser, scanErr := userStorage.Scan(result)
+
+		if scanErr != nil {
+			return nil, scanErr
+		}
+
+		user, ok := scannedUser.(*models.User)
+
+		if !ok {
+			return nil, failedToParseUserError
+		}
+
+		users = append(users, user)
+	}
+
+	return users, result.Err()
+}
+
+// Counts the users matching the given filter, ignoring its limit and offset.
+func (userStorage *UserStorage) Count(filter *models.UserListFilter) (int64, error) {
+	var count int64
+
+	countErr := database.GetDatabaseInstance().GetConnection().
+		QueryRow(countUsersQuery, buildUserListFilterArgs(filter)...).
+		Scan(&count)
+
+	return count, countErr
+}
+
 func (userStorage *UserStorage) Scan(rows *sql.Rows) (interface{}, error) {
 	var user models.User
+	var createdAt sql.NullInt64
+	var emailVerified sql.NullBool
 
-	scanErr := rows.Scan(&user.Id, &user.Email, &user.UserName, &user.Role)
+	scanErr := rows.Scan(&user.Id, &user.Email, &user.UserName, &user.Role, &createdAt, &emailVerified)
+	user.CreatedAt = createdAt.Int64
+	user.EmailVerified = emailVerified.Bool
 
 	return &user, scanErr
 }
+
+// Builds the arguments of the user list filter condition.
+func buildUserListFilterArgs(filter *models.UserListFilter) []interface{} {
+	return []interface{}{filter.Role, filter.Role, "%" + likeEscaper.Replace(filter.EmailContains) + "%"}
+}
@@ -0,0 +1,34 @@
+package storage
+
+import (
+	"testing"
+
+	"github.com/adfer-dev/analock-api/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUserStorageEmailVerified(t *testing.T) {
+	userStorage := &UserStorage{}
+
+	unverifiedUser := &models.User{Email: "unverified@example.com", UserName: "unverified", Role: models.Standard}
+	verifiedUser := &models.User{Email: "verified@example.com", UserName: "verified", Role: models.Standard, EmailVerified: true}
+	assert.NoError(t, userStorage.Create(unverifiedUser))
+	assert.NoError(t, userStorage.Create(verifiedUser))
+
+	// Test case: Users are stored with their verification status
+	storedUser, err := userStorage.Get(unverifiedUser.Id)
+	assert.NoError(t, err)
+	assert.False(t, storedUser.(*models.User).EmailVerified)
+
+	storedUser, err = userStorage.GetByEmail(verifiedUser.Email)
+	assert.NoError(t, err)
+	assert.True(t, storedUser.(*models.User).EmailVerified)
+
+	// Test case: Updating the verification status leaves the rest of the user as it was
+	assert.NoError(t, userStorage.UpdateEmailVerified(unverifiedUser.Id, true))
+	storedUser, err = userStorage.Get(unverifiedUser.Id)
+	assert.NoError(t, err)
+	assert.Equal(t, &models.User{Id: unverifiedUser.Id, Email: unverifiedUser.Email, UserName: unverifiedUser.UserName, Role: models.Standard, EmailVerified: true}, storedUser)
+
+	assert.ErrorIs(t, userStorage.UpdateEmailVerified(verifiedUser.Id+1000, true), userNotFoundError)
+}
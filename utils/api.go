@@ -1,10 +1,15 @@
 package utils
 
 import (
+	"errors"
 	"fmt"
+	"math"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/adfer-dev/analock-api/auth"
+	"github.com/adfer-dev/analock-api/constants"
 	"github.com/adfer-dev/analock-api/models"
 	"github.com/go-playground/validator/v10"
 	"github.com/golang-jwt/jwt"
@@ -25,6 +30,24 @@ func ParseToHandlerFunc(f APIFunc) http.HandlerFunc {
 	}
 }
 
+// Wraps the given handler so its responses can take the given time to be written, instead of the server write timeout.
+// A zero timeout removes the write deadline.
+func WithWriteTimeout(timeout time.Duration, handler http.HandlerFunc) http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		deadline := time.Time{}
+
+		if timeout > 0 {
+			deadline = time.Now().Add(timeout)
+		}
+
+		if deadlineErr := http.NewResponseController(res).SetWriteDeadline(deadline); deadlineErr != nil && !errors.Is(deadlineErr, http.ErrNotSupported) {
+			GetCustomLogger().Errorf("Could not set write deadline: %s\n", deadlineErr.Error())
+		}
+
+		handler(res, req)
+	}
+}
+
 // Maps an error to the HttpError struct
 func TranslateDbErrorToHttpError(err error) *models.HttpError {
 	httpError := &models.HttpError{}
@@ -51,11 +74,12 @@ func HandleValidation(req *http.Request, body interface{}) []*models.HttpError {
 
 	if parseErr := ReadJSON(req.Body, body); parseErr != nil {
 		GetCustomLogger().Info(parseErr)
-		if validationErrs, ok := parseErr.(validator.ValidationErrors); ok {
-			for _, validationErr := range validationErrs {
-				httpErrors = append(httpErrors,
-					&models.HttpError{Status: 400, Description: "Field" + validationErr.Field() + " must be provided."})
-			}
+		if validationErrs := BuildValidationErrors(parseErr); len(validationErrs) > 0 {
+			httpErrors = append(httpErrors, validationErrs...)
+		} else if errors.Is(parseErr, ErrEmptyBody) {
+			httpErrors = append(httpErrors, &models.HttpError{Status: 400, Description: constants.ErrorRequestBodyRequired})
+		} else if field, unknown := UnknownJSONField(parseErr); unknown {
+			httpErrors = append(httpErrors, &models.HttpError{Status: 400, Description: fmt.Sprintf(constants.ErrorUnknownBodyField, field)})
 		} else {
 			httpError := models.HttpError{Status: 400, Description: "Not valid JSON."}
 			httpErrors = append(httpErrors, &httpError)
@@ -65,16 +89,65 @@ func HandleValidation(req *http.Request, body interface{}) []*models.HttpError {
 	return httpErrors
 }
 
+// Validates the given body structure, returning validation errors if found.
+func ValidateBody(body interface{}) []*models.HttpError {
+	return BuildValidationErrors(validateBody(body))
+}
+
+// Maps the field errors of a validation error to HttpError structs.
+// Returns an empty slice if the given error is not a validation error.
+func BuildValidationErrors(err error) []*models.HttpError {
+	httpErrors := make([]*models.HttpError, 0)
+
+	if validationErrs, ok := err.(validator.ValidationErrors); ok {
+		for _, validationErr := range validationErrs {
+			description := "Field" + validationErr.Field() + " must be provided."
+
+			switch validationErr.Tag() {
+			case "required":
+			case "unixseconds":
+				description = fmt.Sprintf(constants.ErrorTimestampNotValid, validationErr.Field())
+			default:
+				description = "Field" + validationErr.Field() + " is not valid."
+			}
+
+			httpErrors = append(httpErrors, &models.HttpError{Status: 400, Description: description})
+		}
+	}
+
+	return httpErrors
+}
+
 // Builds a cache key based on given user ID
 func BuildUserCacheKey(userId uint) string {
 	return fmt.Sprintf("user-%d", userId)
 }
 
+// Builds a cache key for the summaries of a resource based on given user ID
+func BuildUserSummaryCacheKey(userId uint) string {
+	return fmt.Sprintf("%s-summary", BuildUserCacheKey(userId))
+}
+
 // Builds a cache key based on given user ID, start date and end date
 func BuildUserDateRangeCacheKey(userId uint, startDate int, endDate int) string {
 	return fmt.Sprintf("%s-start%d-end%d", BuildUserCacheKey(userId), startDate, endDate)
 }
 
+// Builds a cache key for the summaries of a resource based on given user ID, start date and end date
+func BuildUserSummaryDateRangeCacheKey(userId uint, startDate int, endDate int) string {
+	return fmt.Sprintf("%s-summary", BuildUserDateRangeCacheKey(userId, startDate, endDate))
+}
+
+// Builds a cache key based on given user ID, start date, end date and timezone for the entries grouped by day
+func BuildUserCalendarCacheKey(userId uint, startDate int, endDate int, timezone string) string {
+	return fmt.Sprintf("%s-calendar-tz%s", BuildUserDateRangeCacheKey(userId, startDate, endDate), timezone)
+}
+
+// Builds a cache key based on given user ID, day (formatted as YYYY-MM-DD) and timezone for the entries registered on that day in previous years
+func BuildUserOnThisDayCacheKey(userId uint, day string, timezone string) string {
+	return fmt.Sprintf("%s-onthisday%s-tz%s", BuildUserCacheKey(userId), day, timezone)
+}
+
 // Gets token claims, by first retrieving token value from HTTP headers
 func GetTokenClaimsFromRequest(req *http.Request) (jwt.MapClaims, error) {
 	tokenValue := req.Header.Get("Authorization")[7:]
@@ -86,3 +159,46 @@ func GetTokenClaimsFromRequest(req *http.Request) (jwt.MapClaims, error) {
 
 	return tokenClaims, nil
 }
+
+var ErrInvalidSubjectClaim = errors.New("token subject is missing or is not a valid user id")
+
+// Gets the id of the user a token was issued for from its subject claim.
+// Returns ErrInvalidSubjectClaim if the subject is missing or is not a positive integer.
+func UserIDFromClaims(claims jwt.MapClaims) (uint, error) {
+	subject, ok := claims["sub"].(float64)
+
+	if !ok || subject < 1 || subject > math.MaxUint32 || subject != math.Trunc(subject) {
+		return 0, ErrInvalidSubjectClaim
+	}
+
+	return uint(subject), nil
+}
+
+// Parses the page and pageSize query params of the request, defaulting to the first page of the given size.
+// Returns an error naming the param if it is not a positive number or the page size exceeds the maximum.
+func ParsePageQueryParams(req *http.Request, defaultPageSize int, maxPageSize int) (int, int, error) {
+	page := 1
+	pageSize := defaultPageSize
+
+	if pageString := req.URL.Query().Get("page"); len(pageString) > 0 {
+		parsedPage, parseErr := strconv.Atoi(pageString)
+
+		if parseErr != nil || parsedPage <= 0 {
+			return 0, 0, fmt.Errorf(constants.QueryParamError, "page")
+		}
+
+		page = parsedPage
+	}
+
+	if pageSizeString := req.URL.Query().Get("pageSize"); len(pageSizeString) > 0 {
+		parsedPageSize, parseErr := strconv.Atoi(pageSizeString)
+
+		if parseErr != nil || parsedPageSize <= 0 || parsedPageSize > maxPageSize {
+			return 0, 0, fmt.Errorf(constants.QueryParamError, "pageSize")
+		}
+
+		pageSize = parsedPageSize
+	}
+
+	return page, pageSize, nil
+}
@@ -0,0 +1,77 @@
+package utils
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUserIDFromClaims(t *testing.T) {
+	tests := []struct {
+		name     string
+		claims   jwt.MapClaims
+		expected uint
+		wantErr  bool
+	}{
+		{"Valid subject", jwt.MapClaims{"sub": float64(42)}, 42, false},
+		{"Missing subject", jwt.MapClaims{}, 0, true},
+		{"String subject", jwt.MapClaims{"sub": "42"}, 0, true},
+		{"Zero subject", jwt.MapClaims{"sub": float64(0)}, 0, true},
+		{"Negative subject", jwt.MapClaims{"sub": float64(-1)}, 0, true},
+		{"Fractional subject", jwt.MapClaims{"sub": 1.5}, 0, true},
+	}
+
+	for _, testCase := range tests {
+		t.Run(testCase.name, func(t *testing.T) {
+			userId, err := UserIDFromClaims(testCase.claims)
+
+			if testCase.wantErr {
+				assert.ErrorIs(t, err, ErrInvalidSubjectClaim)
+			} else {
+				assert.NoError(t, err)
+			}
+
+			assert.Equal(t, testCase.expected, userId)
+		})
+	}
+}
+
+func TestWithWriteTimeout(t *testing.T) {
+	slowHandler := func(res http.ResponseWriter, req *http.Request) {
+		time.Sleep(100 * time.Millisecond)
+		res.Write([]byte("book"))
+	}
+
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		wantErr bool
+	}{
+		{"Server write timeout", slowHandler, true},
+		{"Longer write timeout", WithWriteTimeout(time.Second, slowHandler), false},
+		{"No write timeout", WithWriteTimeout(0, slowHandler), false},
+	}
+
+	for _, testCase := range tests {
+		t.Run(testCase.name, func(t *testing.T) {
+			server := httptest.NewUnstartedServer(testCase.handler)
+			server.Config.WriteTimeout = 20 * time.Millisecond
+			server.Start()
+			defer server.Close()
+
+			res, err := server.Client().Get(server.URL)
+
+			if err == nil {
+				_, err = io.ReadAll(res.Body)
+				res.Body.Close()
+			}
+
+			assert.Equal(t, testCase.wantErr, err != nil)
+		})
+	}
+}
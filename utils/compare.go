@@ -0,0 +1,9 @@
+package utils
+
+import "crypto/subtle"
+
+// Compares two secrets (like token values) in constant time, so the comparison duration
+// does not leak how many leading characters of both values match.
+func SecureCompare(a string, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
@@ -0,0 +1,15 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSecureCompare(t *testing.T) {
+	assert.True(t, SecureCompare("token-value", "token-value"))
+	assert.False(t, SecureCompare("token-value", "token-valuf"))
+	assert.False(t, SecureCompare("token-value", "token"))
+	assert.False(t, SecureCompare("", "token-value"))
+	assert.True(t, SecureCompare("", ""))
+}
@@ -0,0 +1,49 @@
+package utils
+
+import (
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Sets the ETag header of the response and, if the last modification time is known, its Last-Modified header.
+func SetValidatorHeaders(res http.ResponseWriter, etag string, lastModified time.Time) {
+	res.Header().Set("ETag", etag)
+
+	if !lastModified.IsZero() {
+		res.Header().Set("Last-Modified", lastModified.UTC().Format(http.TimeFormat))
+	}
+}
+
+// Checks whether the client already has the current representation of a resource, so a 304 can be sent instead.
+//
+// If-None-Match takes precedence over If-Modified-Since, which is only checked when the last modification time is known.
+func IsNotModified(req *http.Request, etag string, lastModified time.Time) bool {
+	if ifNoneMatch := req.Header.Get("If-None-Match"); len(ifNoneMatch) > 0 {
+		return matchesETag(ifNoneMatch, etag)
+	}
+
+	ifModifiedSince, parseErr := http.ParseTime(req.Header.Get("If-Modified-Since"))
+
+	if parseErr != nil || lastModified.IsZero() {
+		return false
+	}
+
+	// HTTP dates have second precision
+	return !lastModified.Truncate(time.Second).After(ifModifiedSince)
+}
+
+// Checks whether the If-None-Match header value matches the given entity tag, using weak comparison.
+func matchesETag(ifNoneMatch string, etag string) bool {
+	if strings.TrimSpace(ifNoneMatch) == "*" {
+		return true
+	}
+
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		if strings.TrimPrefix(strings.TrimSpace(candidate), "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,62 @@
+package utils
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsNotModified(t *testing.T) {
+	lastModified := time.Unix(1715344215, 0).UTC()
+	etag := `"1-1715344215"`
+
+	tests := []struct {
+		name            string
+		ifNoneMatch     string
+		ifModifiedSince string
+		lastModified    time.Time
+		expected        bool
+	}{
+		{"No preconditions", "", "", lastModified, false},
+		{"Matching entity tag", etag, "", lastModified, true},
+		{"Weak matching entity tag in list", `"other", W/` + etag, "", lastModified, true},
+		{"Any entity tag", "*", "", lastModified, true},
+		{"Stale entity tag", `"1-1"`, "", lastModified, false},
+		{"Entity tag takes precedence", `"1-1"`, lastModified.Format(http.TimeFormat), lastModified, false},
+		{"Not modified since", "", lastModified.Format(http.TimeFormat), lastModified, true},
+		{"Modified since", "", lastModified.Add(-time.Minute).Format(http.TimeFormat), lastModified, false},
+		{"Unknown last modification", "", lastModified.Format(http.TimeFormat), time.Time{}, false},
+		{"Invalid date", "", "yesterday", lastModified, false},
+	}
+
+	for _, testCase := range tests {
+		t.Run(testCase.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+
+			if len(testCase.ifNoneMatch) > 0 {
+				req.Header.Set("If-None-Match", testCase.ifNoneMatch)
+			}
+			if len(testCase.ifModifiedSince) > 0 {
+				req.Header.Set("If-Modified-Since", testCase.ifModifiedSince)
+			}
+
+			assert.Equal(t, testCase.expected, IsNotModified(req, etag, testCase.lastModified))
+		})
+	}
+}
+
+func TestSetValidatorHeaders(t *testing.T) {
+	res := httptest.NewRecorder()
+	SetValidatorHeaders(res, `"1-0"`, time.Time{})
+
+	assert.Equal(t, `"1-0"`, res.Header().Get("ETag"))
+	assert.Empty(t, res.Header().Get("Last-Modified"))
+
+	res = httptest.NewRecorder()
+	SetValidatorHeaders(res, `"1-1"`, time.Date(2024, 5, 10, 12, 30, 15, 0, time.FixedZone("CEST", 7200)))
+
+	assert.Equal(t, "Fri, 10 May 2024 10:30:15 GMT", res.Header().Get("Last-Modified"))
+}
@@ -0,0 +1,90 @@
+package utils
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/adfer-dev/analock-api/constants"
+)
+
+// Gets the first and last Unix second of the day the given Unix timestamp in seconds falls on,
+// in the local time of the given offset from UTC, in minutes east of UTC.
+func DayBounds(unix int64, tzOffsetMinutes int) (int64, int64) {
+	offset := int64(tzOffsetMinutes) * 60
+	localTime := unix + offset
+	localDayStart := localTime - localTime%constants.DaySeconds
+
+	// The remainder is negative before the epoch, so the day would start after the time
+	if localDayStart > localTime {
+		localDayStart -= constants.DaySeconds
+	}
+
+	start := localDayStart - offset
+
+	return start, start + constants.DaySeconds - 1
+}
+
+// Gets the first and last Unix second of the calendar day the given Unix timestamp in seconds falls on,
+// in the given location. Unlike DayBounds, it follows the daylight saving changes of the location.
+func LocationDayBounds(unix int64, location *time.Location) (int64, int64) {
+	localTime := time.Unix(unix, 0).In(location)
+	dayStart := time.Date(localTime.Year(), localTime.Month(), localTime.Day(), 0, 0, 0, 0, location)
+	dayEnd := dayStart.AddDate(0, 0, 1)
+
+	return dayStart.Unix(), dayEnd.Unix() - 1
+}
+
+// Parses the date range query params of the request, as Unix seconds.
+// When the day param is given, the range is the whole day it falls on in the local time of the tzOffset param,
+// instead of the one between the start_date and end_date params. Returns false if no range is given.
+// Returns an error naming the param if it is not a valid number, or the offset is out of the UTC offsets range.
+func ParseDateRangeQueryParams(req *http.Request) (int, int, bool, error) {
+	query := req.URL.Query()
+
+	if dayString := query.Get(constants.DayQueryParam); len(dayString) > 0 {
+		day, dayErr := strconv.ParseInt(dayString, 10, 64)
+
+		if dayErr != nil {
+			return 0, 0, false, fmt.Errorf(constants.QueryParamError, constants.DayQueryParam)
+		}
+
+		tzOffset := 0
+
+		if tzOffsetString := query.Get(constants.TzOffsetQueryParam); len(tzOffsetString) > 0 {
+			parsedTzOffset, tzOffsetErr := strconv.Atoi(tzOffsetString)
+
+			if tzOffsetErr != nil || parsedTzOffset < -constants.MaxTzOffsetMinutes || parsedTzOffset > constants.MaxTzOffsetMinutes {
+				return 0, 0, false, fmt.Errorf(constants.QueryParamError, constants.TzOffsetQueryParam)
+			}
+
+			tzOffset = parsedTzOffset
+		}
+
+		start, end := DayBounds(day, tzOffset)
+
+		return int(start), int(end), true, nil
+	}
+
+	startDateString := query.Get(constants.StartDateQueryParam)
+	endDateString := query.Get(constants.EndDateQueryParam)
+
+	if len(startDateString) == 0 || len(endDateString) == 0 {
+		return 0, 0, false, nil
+	}
+
+	startDate, startDateErr := strconv.Atoi(startDateString)
+
+	if startDateErr != nil {
+		return 0, 0, false, fmt.Errorf(constants.QueryParamError, constants.StartDateQueryParam)
+	}
+
+	endDate, endDateErr := strconv.Atoi(endDateString)
+
+	if endDateErr != nil {
+		return 0, 0, false, fmt.Errorf(constants.QueryParamError, constants.EndDateQueryParam)
+	}
+
+	return startDate, endDate, true, nil
+}
@@ -0,0 +1,114 @@
+package utils
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/adfer-dev/analock-api/constants"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDayBounds(t *testing.T) {
+	tests := []struct {
+		name            string
+		instant         time.Time
+		tzOffsetMinutes int
+		expectedStart   time.Time
+	}{
+		{"UTC", time.Date(2024, 3, 10, 15, 30, 0, 0, time.UTC), 0, time.Date(2024, 3, 10, 0, 0, 0, 0, time.UTC)},
+		{"Positive offset on the next local day", time.Date(2024, 3, 30, 23, 30, 0, 0, time.UTC), 60, time.Date(2024, 3, 30, 23, 0, 0, 0, time.UTC)},
+		{"Summer time positive offset", time.Date(2024, 3, 31, 21, 59, 0, 0, time.UTC), 120, time.Date(2024, 3, 30, 22, 0, 0, 0, time.UTC)},
+		{"Negative offset on the previous local day", time.Date(2024, 11, 3, 3, 0, 0, 0, time.UTC), -300, time.Date(2024, 11, 2, 5, 0, 0, 0, time.UTC)},
+		{"Summer time negative offset", time.Date(2024, 11, 3, 3, 0, 0, 0, time.UTC), -240, time.Date(2024, 11, 2, 4, 0, 0, 0, time.UTC)},
+		{"Half hour offset", time.Date(2024, 6, 1, 18, 45, 0, 0, time.UTC), 330, time.Date(2024, 6, 1, 18, 30, 0, 0, time.UTC)},
+		{"Lowest offset", time.Date(2024, 6, 1, 11, 0, 0, 0, time.UTC), -720, time.Date(2024, 5, 31, 12, 0, 0, 0, time.UTC)},
+		{"Highest offset", time.Date(2024, 6, 1, 11, 0, 0, 0, time.UTC), 840, time.Date(2024, 6, 1, 10, 0, 0, 0, time.UTC)},
+		{"Local midnight", time.Date(2024, 6, 1, 4, 0, 0, 0, time.UTC), -240, time.Date(2024, 6, 1, 4, 0, 0, 0, time.UTC)},
+		{"Before the epoch", time.Date(1969, 12, 31, 20, 0, 0, 0, time.UTC), 0, time.Date(1969, 12, 31, 0, 0, 0, 0, time.UTC)},
+	}
+
+	for _, testCase := range tests {
+		t.Run(testCase.name, func(t *testing.T) {
+			start, end := DayBounds(testCase.instant.Unix(), testCase.tzOffsetMinutes)
+
+			assert.Equal(t, testCase.expectedStart.Unix(), start)
+			assert.Equal(t, start+constants.DaySeconds-1, end)
+			assert.LessOrEqual(t, start, testCase.instant.Unix())
+			assert.GreaterOrEqual(t, end, testCase.instant.Unix())
+		})
+	}
+}
+
+func TestLocationDayBounds(t *testing.T) {
+	madrid, _ := time.LoadLocation("Europe/Madrid")
+	newYork, _ := time.LoadLocation("America/New_York")
+
+	tests := []struct {
+		name          string
+		instant       time.Time
+		location      *time.Location
+		expectedStart time.Time
+		expectedEnd   time.Time
+	}{
+		{"UTC", time.Date(2024, 3, 10, 15, 30, 0, 0, time.UTC), time.UTC, time.Date(2024, 3, 10, 0, 0, 0, 0, time.UTC), time.Date(2024, 3, 11, 0, 0, 0, 0, time.UTC)},
+		{"Next local day", time.Date(2024, 3, 10, 23, 30, 0, 0, time.UTC), madrid, time.Date(2024, 3, 10, 23, 0, 0, 0, time.UTC), time.Date(2024, 3, 11, 23, 0, 0, 0, time.UTC)},
+		{"Previous local day", time.Date(2024, 11, 2, 3, 0, 0, 0, time.UTC), newYork, time.Date(2024, 11, 1, 4, 0, 0, 0, time.UTC), time.Date(2024, 11, 2, 4, 0, 0, 0, time.UTC)},
+		{"Day of the summer time change", time.Date(2024, 3, 31, 12, 0, 0, 0, time.UTC), madrid, time.Date(2024, 3, 30, 23, 0, 0, 0, time.UTC), time.Date(2024, 3, 31, 22, 0, 0, 0, time.UTC)},
+		{"Day of the winter time change", time.Date(2024, 11, 3, 12, 0, 0, 0, time.UTC), newYork, time.Date(2024, 11, 3, 4, 0, 0, 0, time.UTC), time.Date(2024, 11, 4, 5, 0, 0, 0, time.UTC)},
+	}
+
+	for _, testCase := range tests {
+		t.Run(testCase.name, func(t *testing.T) {
+			start, end := LocationDayBounds(testCase.instant.Unix(), testCase.location)
+
+			assert.Equal(t, testCase.expectedStart.Unix(), start)
+			assert.Equal(t, testCase.expectedEnd.Unix()-1, end)
+		})
+	}
+}
+
+func TestParseDateRangeQueryParams(t *testing.T) {
+	day := time.Date(2024, 6, 1, 1, 0, 0, 0, time.UTC).Unix()
+	dayStart := time.Date(2024, 5, 31, 4, 0, 0, 0, time.UTC).Unix()
+
+	tests := []struct {
+		name          string
+		query         string
+		expectedStart int
+		expectedEnd   int
+		expectedRange bool
+		expectedError string
+	}{
+		{"No range", "", 0, 0, false, ""},
+		{"Only start date", "?start_date=100", 0, 0, false, ""},
+		{"Date range", "?start_date=100&end_date=200", 100, 200, true, ""},
+		{"Invalid start date", "?start_date=a&end_date=200", 0, 0, false, constants.StartDateQueryParam},
+		{"Invalid end date", "?start_date=100&end_date=b", 0, 0, false, constants.EndDateQueryParam},
+		{"Day in UTC", "?day=" + strconv.FormatInt(day, 10), int(day - 3600), int(day - 3600 + constants.DaySeconds - 1), true, ""},
+		{"Day with offset", "?day=" + strconv.FormatInt(day, 10) + "&tzOffset=-240", int(dayStart), int(dayStart + constants.DaySeconds - 1), true, ""},
+		{"Day takes precedence", "?day=" + strconv.FormatInt(day, 10) + "&tzOffset=-240&start_date=100&end_date=200", int(dayStart), int(dayStart + constants.DaySeconds - 1), true, ""},
+		{"Invalid day", "?day=today", 0, 0, false, constants.DayQueryParam},
+		{"Invalid offset", "?day=" + strconv.FormatInt(day, 10) + "&tzOffset=UTC", 0, 0, false, constants.TzOffsetQueryParam},
+		{"Offset out of range", "?day=" + strconv.FormatInt(day, 10) + "&tzOffset=841", 0, 0, false, constants.TzOffsetQueryParam},
+	}
+
+	for _, testCase := range tests {
+		t.Run(testCase.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/"+testCase.query, nil)
+			startDate, endDate, hasRange, err := ParseDateRangeQueryParams(req)
+
+			if len(testCase.expectedError) > 0 {
+				assert.EqualError(t, err, fmt.Sprintf(constants.QueryParamError, testCase.expectedError))
+			} else {
+				assert.NoError(t, err)
+			}
+
+			assert.Equal(t, testCase.expectedStart, startDate)
+			assert.Equal(t, testCase.expectedEnd, endDate)
+			assert.Equal(t, testCase.expectedRange, hasRange)
+		})
+	}
+}
@@ -2,24 +2,141 @@ package utils
 
 import (
 	"encoding/json"
+	"errors"
 	"io"
 	"net/http"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
 
+	"github.com/adfer-dev/analock-api/config"
+	"github.com/adfer-dev/analock-api/constants"
 	"github.com/adfer-dev/analock-api/models"
 	"github.com/go-playground/validator/v10"
 )
 
+// Shape shared by all responses when the envelope mode is enabled
+type ResponseEnvelope struct {
+	Data  any `json:"data"`
+	Error any `json:"error"`
+}
+
+// Checks whether the response envelope mode is enabled in the config.
+func isResponseEnvelopeEnabled() bool {
+	return config.Get().ResponseEnvelope
+}
+
 // Writes the given value structure as an HTTP response with the given status.
+// If the envelope mode is enabled, the value is wrapped in a ResponseEnvelope,
+// being placed in the error field for error statuses and in the data field otherwise.
 func WriteJSON(res http.ResponseWriter, status int, value any) error {
 	res.Header().Add("Content-Type", "application/json")
 	res.WriteHeader(status)
 
+	if isResponseEnvelopeEnabled() {
+		envelope := ResponseEnvelope{}
+
+		if status >= http.StatusBadRequest {
+			envelope.Error = value
+		} else {
+			envelope.Data = value
+		}
+
+		return json.NewEncoder(res).Encode(envelope)
+	}
+
 	return json.NewEncoder(res).Encode(value)
 }
 
-// Parses JSON from reader and fits it into the given body structure
+// Writes the items the given stream yields as a JSON array response with the given status, encoding each one as it comes,
+// so the whole list is never held in memory. If the envelope mode is enabled, the array is placed in the data field.
+//
+// The status is only written along with the first item or the end of the stream. So, if the stream fails before yielding
+// any item, nothing is written and the caller can still respond with an error. Later failures leave the array unterminated,
+// so the caller should abort the response for the client to notice it is incomplete.
+// Returns whether the response was started, along with any error of the stream.
+func WriteJSONArrayStream(res http.ResponseWriter, status int, stream func(yield func(item any) error) error) (bool, error) {
+	encoder := json.NewEncoder(res)
+	envelope := isResponseEnvelopeEnabled()
+	started := false
+
+	start := func() error {
+		res.Header().Add("Content-Type", "application/json")
+		res.WriteHeader(status)
+		started = true
+
+		if envelope {
+			_, writeErr := io.WriteString(res, `{"data":[`)
+			return writeErr
+		}
+
+		_, writeErr := io.WriteString(res, "[")
+		return writeErr
+	}
+
+	streamErr := stream(func(item any) error {
+		separator := ","
+
+		if !started {
+			if startErr := start(); startErr != nil {
+				return startErr
+			}
+			separator = ""
+		}
+
+		if _, writeErr := io.WriteString(res, separator); writeErr != nil {
+			return writeErr
+		}
+
+		return encoder.Encode(item)
+	})
+
+	if streamErr != nil {
+		return started, streamErr
+	}
+
+	if !started {
+		if startErr := start(); startErr != nil {
+			return true, startErr
+		}
+	}
+
+	if envelope {
+		_, writeErr := io.WriteString(res, "],\"error\":null}\n")
+		return true, writeErr
+	}
+
+	_, writeErr := io.WriteString(res, "]\n")
+	return true, writeErr
+}
+
+// Returned when reading a request body that is empty or only has whitespace.
+var ErrEmptyBody = errors.New(constants.ErrorRequestBodyRequired)
+
+// Parses JSON from reader and fits it into the given body structure.
+// Fields that are not in the body structure are rejected, so clients cannot set fields the API does not expect.
+// Returns ErrEmptyBody if there is no JSON value to read.
 func ReadJSON(reader io.Reader, body interface{}) error {
-	if deserializeErr := json.NewDecoder(reader).Decode(body); deserializeErr != nil {
+	decoder := json.NewDecoder(reader)
+	decoder.DisallowUnknownFields()
+
+	// The decoder only returns io.EOF itself when it finds nothing but whitespace
+	if readErr := decodeAndValidate(decoder, body); readErr != io.EOF {
+		return readErr
+	}
+
+	return ErrEmptyBody
+}
+
+// Parses JSON from the response of an external API and fits it into the given body structure,
+// ignoring the fields that are not in it.
+func ReadResponseJSON(reader io.Reader, body interface{}) error {
+	return decodeAndValidate(json.NewDecoder(reader), body)
+}
+
+func decodeAndValidate(decoder *json.Decoder, body interface{}) error {
+	if deserializeErr := decoder.Decode(body); deserializeErr != nil {
 		return deserializeErr
 	}
 
@@ -30,6 +147,19 @@ func ReadJSON(reader io.Reader, body interface{}) error {
 	return nil
 }
 
+// The JSON decoder has no error type for unknown fields, so they are told by the message prefix.
+const unknownJSONFieldErrorPrefix = "json: unknown field "
+
+// Gets the name of the field a JSON decoding error rejected for not being in the body structure.
+// Returns false if the error is not about an unknown field.
+func UnknownJSONField(err error) (string, bool) {
+	if err == nil || !strings.HasPrefix(err.Error(), unknownJSONFieldErrorPrefix) {
+		return "", false
+	}
+
+	return strings.Trim(strings.TrimPrefix(err.Error(), unknownJSONFieldErrorPrefix), `"`), true
+}
+
 // Wrapper that writes an error as an HTTP response with given info.
 func WriteError(res http.ResponseWriter, status int, description string) error {
 	return WriteJSON(
@@ -42,10 +172,60 @@ func WriteError(res http.ResponseWriter, status int, description string) error {
 	)
 }
 
-func validateBody(body interface{}) error {
+// Wrapper that writes the given validation errors as an HTTP response with the given status.
+func WriteValidationErrors(res http.ResponseWriter, status int, validationErrs []*models.HttpError) error {
+	return WriteJSON(
+		res,
+		status,
+		&models.ValidationErrorResponse{
+			Status: status,
+			Errors: validationErrs,
+		},
+	)
+}
+
+// Internet Archive identifiers are made of letters, digits, dashes, underscores and dots, and are at most 100 characters long.
+var internetArchiveIdentifierRegex = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{0,99}$`)
+
+// Checks whether the given string has the format of an Internet Archive identifier.
+func IsInternetArchiveIdentifier(identifier string) bool {
+	return internetArchiveIdentifierRegex.MatchString(identifier)
+}
+
+// Checks whether the given diary entry title is within the max length in the config.
+func IsValidDiaryEntryTitle(title string) bool {
+	maxLength := config.Get().MaxDiaryEntryTitleLength
+
+	return maxLength == 0 || uint(utf8.RuneCountInString(title)) <= maxLength
+}
+
+// Checks whether the given timestamp is plausible as a date in Unix seconds,
+// between 2000-01-01 UTC and the current time plus the allowed skew of client clocks.
+func IsPlausibleTimestamp(timestamp int64) bool {
+	return timestamp >= constants.MinTimestampSeconds &&
+		timestamp <= time.Now().Unix()+constants.MaxTimestampFutureSkewSeconds
+}
+
+// Validator of the request bodies, with the custom validations of the API registered.
+var bodyValidator = newBodyValidator()
+
+func newBodyValidator() *validator.Validate {
 	newValidator := validator.New()
+	newValidator.RegisterValidation("iaidentifier", func(field validator.FieldLevel) bool {
+		return IsInternetArchiveIdentifier(field.Field().String())
+	})
+	newValidator.RegisterValidation("diarytitle", func(field validator.FieldLevel) bool {
+		return IsValidDiaryEntryTitle(field.Field().String())
+	})
+	newValidator.RegisterValidation("unixseconds", func(field validator.FieldLevel) bool {
+		return IsPlausibleTimestamp(field.Field().Int())
+	})
 
-	if err := newValidator.Struct(body); err != nil {
+	return newValidator
+}
+
+func validateBody(body interface{}) error {
+	if err := bodyValidator.Struct(body); err != nil {
 		return err
 	}
 
@@ -0,0 +1,316 @@
+package utils
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/adfer-dev/analock-api/constants"
+	"github.com/adfer-dev/analock-api/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteJSON(t *testing.T) {
+	t.Run("flat_mode", func(t *testing.T) {
+		t.Setenv("API_RESPONSE_ENVELOPE", "")
+		res := httptest.NewRecorder()
+
+		err := WriteJSON(res, http.StatusOK, map[string]int{"id": 1})
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, res.Code)
+		assert.Equal(t, "application/json", res.Header().Get("Content-Type"))
+		assert.JSONEq(t, `{"id":1}`, res.Body.String())
+	})
+
+	t.Run("envelope_mode", func(t *testing.T) {
+		t.Setenv("API_RESPONSE_ENVELOPE", "true")
+		res := httptest.NewRecorder()
+
+		err := WriteJSON(res, http.StatusOK, map[string]int{"id": 1})
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, res.Code)
+		assert.JSONEq(t, `{"data":{"id":1},"error":null}`, res.Body.String())
+	})
+}
+
+func TestWriteJSONArrayStream(t *testing.T) {
+	items := func(values ...int) func(yield func(item any) error) error {
+		return func(yield func(item any) error) error {
+			for _, value := range values {
+				if err := yield(map[string]int{"id": value}); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+	}
+
+	t.Run("flat_mode", func(t *testing.T) {
+		t.Setenv("API_RESPONSE_ENVELOPE", "")
+		res := httptest.NewRecorder()
+
+		started, err := WriteJSONArrayStream(res, http.StatusOK, items(1, 2, 3))
+
+		assert.NoError(t, err)
+		assert.True(t, started)
+		assert.Equal(t, http.StatusOK, res.Code)
+		assert.Equal(t, "application/json", res.Header().Get("Content-Type"))
+		assert.JSONEq(t, `[{"id":1},{"id":2},{"id":3}]`, res.Body.String())
+	})
+
+	t.Run("envelope_mode", func(t *testing.T) {
+		t.Setenv("API_RESPONSE_ENVELOPE", "true")
+		res := httptest.NewRecorder()
+
+		started, err := WriteJSONArrayStream(res, http.StatusOK, items(1, 2))
+
+		assert.NoError(t, err)
+		assert.True(t, started)
+		assert.JSONEq(t, `{"data":[{"id":1},{"id":2}],"error":null}`, res.Body.String())
+	})
+
+	t.Run("empty_stream", func(t *testing.T) {
+		t.Setenv("API_RESPONSE_ENVELOPE", "")
+		res := httptest.NewRecorder()
+
+		started, err := WriteJSONArrayStream(res, http.StatusOK, items())
+
+		assert.NoError(t, err)
+		assert.True(t, started)
+		assert.JSONEq(t, `[]`, res.Body.String())
+	})
+
+	t.Run("fails_before_first_item", func(t *testing.T) {
+		t.Setenv("API_RESPONSE_ENVELOPE", "")
+		res := httptest.NewRecorder()
+		streamErr := errors.New("query failed")
+
+		started, err := WriteJSONArrayStream(res, http.StatusOK, func(yield func(item any) error) error {
+			return streamErr
+		})
+
+		assert.ErrorIs(t, err, streamErr)
+		assert.False(t, started)
+		assert.Empty(t, res.Body.String())
+		assert.Empty(t, res.Header().Get("Content-Type"))
+	})
+
+	t.Run("fails_after_first_item", func(t *testing.T) {
+		t.Setenv("API_RESPONSE_ENVELOPE", "")
+		res := httptest.NewRecorder()
+		streamErr := errors.New("scan failed")
+
+		started, err := WriteJSONArrayStream(res, http.StatusOK, func(yield func(item any) error) error {
+			if yieldErr := yield(map[string]int{"id": 1}); yieldErr != nil {
+				return yieldErr
+			}
+			return streamErr
+		})
+
+		assert.ErrorIs(t, err, streamErr)
+		assert.True(t, started)
+		assert.Equal(t, http.StatusOK, res.Code)
+		assert.False(t, json.Valid(res.Body.Bytes()))
+	})
+}
+
+func TestWriteError(t *testing.T) {
+	t.Run("flat_mode", func(t *testing.T) {
+		t.Setenv("API_RESPONSE_ENVELOPE", "")
+		res := httptest.NewRecorder()
+
+		err := WriteError(res, http.StatusNotFound, "not found")
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusNotFound, res.Code)
+		assert.JSONEq(t, `{"status":404,"description":"not found"}`, res.Body.String())
+	})
+
+	t.Run("envelope_mode", func(t *testing.T) {
+		t.Setenv("API_RESPONSE_ENVELOPE", "true")
+		res := httptest.NewRecorder()
+
+		err := WriteError(res, http.StatusNotFound, "not found")
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusNotFound, res.Code)
+		assert.JSONEq(t, `{"data":null,"error":{"status":404,"description":"not found"}}`, res.Body.String())
+	})
+}
+
+func TestWriteValidationErrors(t *testing.T) {
+	validationErrs := []*models.HttpError{{Status: http.StatusBadRequest, Description: "FieldTitle must be provided."}}
+
+	t.Run("flat_mode", func(t *testing.T) {
+		t.Setenv("API_RESPONSE_ENVELOPE", "")
+		res := httptest.NewRecorder()
+
+		err := WriteValidationErrors(res, http.StatusBadRequest, validationErrs)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusBadRequest, res.Code)
+		assert.JSONEq(t, `{"status":400,"errors":[{"status":400,"description":"FieldTitle must be provided."}]}`, res.Body.String())
+	})
+
+	t.Run("envelope_mode", func(t *testing.T) {
+		t.Setenv("API_RESPONSE_ENVELOPE", "true")
+		res := httptest.NewRecorder()
+
+		err := WriteValidationErrors(res, http.StatusBadRequest, validationErrs)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusBadRequest, res.Code)
+		assert.JSONEq(t, `{"data":null,"error":{"status":400,"errors":[{"status":400,"description":"FieldTitle must be provided."}]}}`, res.Body.String())
+	})
+}
+
+func TestValidateInternetArchiveIdentifier(t *testing.T) {
+	type bookBody struct {
+		InternetArchiveId string `validate:"required,iaidentifier"`
+	}
+
+	tests := []struct {
+		name       string
+		identifier string
+		valid      bool
+	}{
+		{"Letters and digits", "alicesadventures00carr", true},
+		{"Dashes, underscores and dots", "the-time_machine.1895", true},
+		{"Longest identifier", strings.Repeat("a", 100), true},
+		{"Too long", strings.Repeat("a", 101), false},
+		{"Leading dash", "-book", false},
+		{"Spaces", "alice in wonderland", false},
+		{"Path separator", "book/../other", false},
+		{"Query characters", "book?file=1", false},
+	}
+
+	for _, testCase := range tests {
+		t.Run(testCase.name, func(t *testing.T) {
+			validationErrs := ValidateBody(&bookBody{InternetArchiveId: testCase.identifier})
+
+			if testCase.valid {
+				assert.Empty(t, validationErrs)
+			} else {
+				assert.Equal(t, []*models.HttpError{{Status: 400, Description: "FieldInternetArchiveId is not valid."}}, validationErrs)
+			}
+		})
+	}
+
+	// Test case: A missing identifier is reported as required
+	assert.Equal(t, []*models.HttpError{{Status: 400, Description: "FieldInternetArchiveId must be provided."}}, ValidateBody(&bookBody{}))
+}
+
+func TestValidateDiaryEntryTitle(t *testing.T) {
+	type entryBody struct {
+		Title string `validate:"required,diarytitle"`
+	}
+
+	t.Setenv("API_MAX_DIARY_ENTRY_TITLE_LENGTH", "5")
+
+	assert.Empty(t, ValidateBody(&entryBody{Title: "Title"}))
+	// Titles are measured in characters, not bytes
+	assert.Empty(t, ValidateBody(&entryBody{Title: "Días!"}))
+	assert.Equal(t, []*models.HttpError{{Status: 400, Description: "FieldTitle is not valid."}}, ValidateBody(&entryBody{Title: "Titles"}))
+
+	t.Setenv("API_MAX_DIARY_ENTRY_TITLE_LENGTH", "0")
+
+	assert.Empty(t, ValidateBody(&entryBody{Title: strings.Repeat("a", 1000)}))
+}
+
+func TestValidateTimestamp(t *testing.T) {
+	type entryBody struct {
+		PublishDate int64 `validate:"required,unixseconds"`
+	}
+
+	now := time.Now()
+	timestampErrors := []*models.HttpError{{Status: 400, Description: "FieldPublishDate must be a Unix timestamp in seconds, not before 2000 nor in the future."}}
+
+	tests := []struct {
+		name           string
+		publishDate    int64
+		expectedErrors []*models.HttpError
+	}{
+		{"Seconds", time.Date(2024, time.March, 10, 12, 0, 0, 0, time.UTC).Unix(), []*models.HttpError{}},
+		{"Current time", now.Unix(), []*models.HttpError{}},
+		{"Start of 2000", time.Date(2000, time.January, 1, 0, 0, 0, 0, time.UTC).Unix(), []*models.HttpError{}},
+		// Clients in timezones ahead of the server may send a slightly later date
+		{"Within the future skew", now.Add(12 * time.Hour).Unix(), []*models.HttpError{}},
+		{"Milliseconds", now.UnixMilli(), timestampErrors},
+		{"Milliseconds of 2000", time.Date(2000, time.January, 1, 0, 0, 0, 0, time.UTC).UnixMilli(), timestampErrors},
+		{"Before 2000", time.Date(1999, time.December, 31, 23, 59, 59, 0, time.UTC).Unix(), timestampErrors},
+		{"Beyond the future skew", now.Add(48 * time.Hour).Unix(), timestampErrors},
+		{"Negative", -1, timestampErrors},
+		{"Missing", 0, []*models.HttpError{{Status: 400, Description: "FieldPublishDate must be provided."}}},
+	}
+
+	for _, testCase := range tests {
+		t.Run(testCase.name, func(t *testing.T) {
+			assert.Equal(t, testCase.expectedErrors, ValidateBody(&entryBody{PublishDate: testCase.publishDate}))
+		})
+	}
+}
+
+func TestReadJSONUnknownFields(t *testing.T) {
+	type userBody struct {
+		Email string `json:"email" validate:"required"`
+	}
+
+	// Test case: Request bodies with fields that are not in the body structure are rejected
+	var body userBody
+	readErr := ReadJSON(strings.NewReader(`{"email":"user@example.com","role":1}`), &body)
+	field, unknown := UnknownJSONField(readErr)
+	assert.True(t, unknown)
+	assert.Equal(t, "role", field)
+
+	req := httptest.NewRequest(http.MethodPut, "/", strings.NewReader(`{"email":"user@example.com","role":1}`))
+	assert.Equal(t, []*models.HttpError{{Status: 400, Description: "field role is not allowed in the request body."}}, HandleValidation(req, &userBody{}))
+
+	// Test case: Bodies with the expected fields are read
+	req = httptest.NewRequest(http.MethodPut, "/", strings.NewReader(`{"email":"user@example.com"}`))
+	assert.Empty(t, HandleValidation(req, &body))
+	assert.Equal(t, "user@example.com", body.Email)
+
+	// Test case: External API responses may have fields that are not in the body structure
+	var response userBody
+	assert.NoError(t, ReadResponseJSON(strings.NewReader(`{"email":"user@example.com","role":1}`), &response))
+	assert.Equal(t, "user@example.com", response.Email)
+
+	_, unknown = UnknownJSONField(ReadJSON(strings.NewReader(`{`), &body))
+	assert.False(t, unknown)
+}
+
+func TestHandleValidationEmptyBody(t *testing.T) {
+	type userBody struct {
+		Email string `json:"email" validate:"required"`
+	}
+
+	tests := []struct {
+		name           string
+		body           string
+		expectedErrors []*models.HttpError
+	}{
+		{"Empty body", "", []*models.HttpError{{Status: 400, Description: constants.ErrorRequestBodyRequired}}},
+		{"Whitespace body", " \n\t ", []*models.HttpError{{Status: 400, Description: constants.ErrorRequestBodyRequired}}},
+		{"Truncated body", `{"email":`, []*models.HttpError{{Status: 400, Description: "Not valid JSON."}}},
+		{"Valid body", `{"email":"user@example.com"}`, []*models.HttpError{}},
+	}
+
+	for _, testCase := range tests {
+		t.Run(testCase.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(testCase.body))
+
+			assert.Equal(t, testCase.expectedErrors, HandleValidation(req, &userBody{}))
+		})
+	}
+
+	// Test case: Requests without a body are rejected the same way
+	req := httptest.NewRequest(http.MethodPost, "/", nil)
+	assert.Equal(t, []*models.HttpError{{Status: 400, Description: constants.ErrorRequestBodyRequired}}, HandleValidation(req, &userBody{}))
+	assert.ErrorIs(t, ReadJSON(strings.NewReader(""), &userBody{}), ErrEmptyBody)
+}
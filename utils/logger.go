@@ -3,13 +3,17 @@ package utils
 import (
 	"log"
 	"os"
+
+	"github.com/adfer-dev/analock-api/config"
 )
 
 const loggerFlags = log.Ldate | log.Ltime | log.Lshortfile
 
 type CustomLogger struct {
-	infoLogger  *log.Logger
-	errorLogger *log.Logger
+	debugLogger   *log.Logger
+	infoLogger    *log.Logger
+	warningLogger *log.Logger
+	errorLogger   *log.Logger
 }
 
 var instance *CustomLogger
@@ -19,14 +23,25 @@ func GetCustomLogger() *CustomLogger {
 
 	if instance == nil {
 		instance = &CustomLogger{
-			infoLogger:  log.New(os.Stdout, "[INFO]\t", loggerFlags),
-			errorLogger: log.New(os.Stderr, "[ERROR]\t", loggerFlags),
+			debugLogger:   log.New(os.Stdout, "[DEBUG]\t", loggerFlags),
+			infoLogger:    log.New(os.Stdout, "[INFO]\t", loggerFlags),
+			warningLogger: log.New(os.Stderr, "[WARNING]\t", loggerFlags),
+			errorLogger:   log.New(os.Stderr, "[ERROR]\t", loggerFlags),
 		}
 	}
 
 	return instance
 }
 
+// Logs the given values only when the config sets the debug log level.
+func (logger *CustomLogger) Debugf(format string, values ...any) {
+	if config.Get().LogLevel != config.DebugLogLevel {
+		return
+	}
+
+	instance.debugLogger.Printf(format, values...)
+}
+
 func (logger *CustomLogger) Info(log any) {
 	instance.infoLogger.Println(log)
 }
@@ -35,6 +50,10 @@ func (logger *CustomLogger) Infof(format string, values ...any) {
 	instance.infoLogger.Printf(format, values...)
 }
 
+func (logger *CustomLogger) Warningf(format string, values ...any) {
+	instance.warningLogger.Printf(format, values...)
+}
+
 func (logger *CustomLogger) Error(log string) {
 	instance.errorLogger.Println(log)
 }
@@ -0,0 +1,44 @@
+package utils
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+const maskedSecretPrefixLength = 4
+const maskedSecretHashLength = 8
+
+// Masks a secret (like a token) so it can be logged.
+//
+// Only a short prefix of the secret is kept, followed by a truncated SHA-256 hash of it,
+// so different secrets can still be told apart in logs without exposing them.
+func MaskSecret(secret string) string {
+	if len(secret) == 0 {
+		return ""
+	}
+
+	// Sliced by runes, so the prefix stays valid UTF-8
+	runes := []rune(secret)
+	prefixLength := min(maskedSecretPrefixLength, len(runes)/2)
+	hash := sha256.Sum256([]byte(secret))
+
+	return fmt.Sprintf("%s...(%s)", string(runes[:prefixLength]), hex.EncodeToString(hash[:])[:maskedSecretHashLength])
+}
+
+// Masks an email so it can be logged, only keeping the first character of the local part and the domain.
+//
+// If the given value is not an email, it is masked as a secret.
+func MaskEmail(email string) string {
+	atIndex := strings.LastIndex(email, "@")
+
+	if atIndex <= 0 {
+		return MaskSecret(email)
+	}
+
+	firstRune, _ := utf8.DecodeRuneInString(email)
+
+	return fmt.Sprintf("%c***%s", firstRune, email[atIndex:])
+}
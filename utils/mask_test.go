@@ -0,0 +1,35 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMaskSecret(t *testing.T) {
+	token := "eyJhbGciOiJIUzI1NiIsInR5cCI6IkpXVCJ9.eyJzdWIiOjF9.signature"
+
+	masked := MaskSecret(token)
+
+	assert.True(t, strings.HasPrefix(masked, "eyJh..."))
+	assert.NotContains(t, masked, "signature")
+	assert.Len(t, masked, len("eyJh...()")+maskedSecretHashLength)
+	assert.Equal(t, masked, MaskSecret(token), "masking should be deterministic")
+	assert.NotEqual(t, masked, MaskSecret(token+"x"), "different secrets should be told apart")
+
+	assert.Equal(t, "", MaskSecret(""))
+	assert.True(t, strings.HasPrefix(MaskSecret("abc"), "a..."), "short secrets should keep at most half of their characters")
+}
+
+func TestMaskEmail(t *testing.T) {
+	assert.Equal(t, "j***@example.com", MaskEmail("john.doe@example.com"))
+	assert.Equal(t, "a***@b.io", MaskEmail("a@b.io"))
+	assert.NotContains(t, MaskEmail("not-an-email"), "an-email")
+	assert.NotContains(t, MaskEmail("@example.com"), "example")
+
+	// Test case: Multi-byte first characters are kept whole
+	assert.Equal(t, "é***@example.com", MaskEmail("élise@example.com"))
+	assert.True(t, utf8.ValidString(MaskEmail("日本語")))
+}
@@ -3,6 +3,8 @@ package utils
 import (
 	"net/http"
 	"time"
+
+	"github.com/adfer-dev/analock-api/config"
 )
 
 // Singleton instance of custom HTTP client
@@ -24,14 +26,36 @@ func GetCustomHttpClient(timeout time.Duration) *http.Client {
 // Builds a custom HTTP client
 //
 // It tweaks some settings like response timeout and max connections to get better performance.
+// Its requests identify the API with the configured User-Agent and go through the configured proxy, if any.
 func buildHttpClient(timeout time.Duration) *http.Client {
+	outboundConfig := config.Get().Outbound
 	transport := http.DefaultTransport.(*http.Transport).Clone()
 	transport.MaxIdleConns = 100
 	transport.MaxConnsPerHost = 100
 	transport.MaxIdleConnsPerHost = 100
 
+	if outboundConfig.ProxyUrl != nil {
+		transport.Proxy = http.ProxyURL(outboundConfig.ProxyUrl)
+	}
+
 	return &http.Client{
 		Timeout:   timeout,
-		Transport: transport,
+		Transport: &userAgentTransport{base: transport, userAgent: outboundConfig.UserAgent},
 	}
 }
+
+// Transport that sets the User-Agent header of the requests that do not set their own.
+type userAgentTransport struct {
+	base      http.RoundTripper
+	userAgent string
+}
+
+func (transport *userAgentTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if len(req.Header.Get("User-Agent")) == 0 {
+		// Round trippers must not modify the given request
+		req = req.Clone(req.Context())
+		req.Header.Set("User-Agent", transport.userAgent)
+	}
+
+	return transport.base.RoundTrip(req)
+}
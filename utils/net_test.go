@@ -0,0 +1,63 @@
+package utils
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/adfer-dev/analock-api/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHttpClientUserAgent(t *testing.T) {
+	var userAgent string
+	server := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		userAgent = req.Header.Get("User-Agent")
+	}))
+	defer server.Close()
+
+	t.Run("Default user agent", func(t *testing.T) {
+		t.Setenv("API_OUTBOUND_USER_AGENT", "")
+
+		_, err := buildHttpClient(time.Second).Get(server.URL)
+
+		assert.NoError(t, err)
+		assert.Equal(t, config.DefaultOutboundUserAgent, userAgent)
+	})
+
+	t.Run("Configured user agent", func(t *testing.T) {
+		t.Setenv("API_OUTBOUND_USER_AGENT", "AnalockTest/1.0")
+
+		_, err := buildHttpClient(time.Second).Get(server.URL)
+
+		assert.NoError(t, err)
+		assert.Equal(t, "AnalockTest/1.0", userAgent)
+	})
+
+	t.Run("Request user agent", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+		req.Header.Set("User-Agent", "Custom/1.0")
+
+		_, err := buildHttpClient(time.Second).Do(req)
+
+		assert.NoError(t, err)
+		assert.Equal(t, "Custom/1.0", userAgent)
+		assert.Equal(t, "Custom/1.0", req.Header.Get("User-Agent"))
+	})
+}
+
+func TestHttpClientProxy(t *testing.T) {
+	var proxiedUrl string
+	proxy := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		proxiedUrl = req.URL.String()
+	}))
+	defer proxy.Close()
+
+	t.Setenv("API_OUTBOUND_PROXY", proxy.URL)
+
+	_, err := buildHttpClient(time.Second).Get("http://archive.invalid/metadata/book1")
+
+	assert.NoError(t, err)
+	assert.Equal(t, "http://archive.invalid/metadata/book1", proxiedUrl)
+}